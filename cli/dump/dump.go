@@ -0,0 +1,17 @@
+package dump
+
+import (
+	"fmt"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+// Run print operation.
+func Run() error {
+	contents, err := config.Dump()
+	if nil != err {
+		return err
+	}
+	fmt.Print(string(contents))
+	return nil
+}
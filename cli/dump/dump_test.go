@@ -0,0 +1,9 @@
+package dump
+
+import "testing"
+
+func TestDump(t *testing.T) {
+	if err := Run(); nil != err {
+		t.Errorf("While running dump got %v", err)
+	}
+}
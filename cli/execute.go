@@ -4,8 +4,11 @@ import (
 	"flag"
 	"fmt"
 
+	"github.com/halverneus/static-file-server/cli/dump"
 	"github.com/halverneus/static-file-server/cli/help"
+	"github.com/halverneus/static-file-server/cli/schema"
 	"github.com/halverneus/static-file-server/cli/server"
+	"github.com/halverneus/static-file-server/cli/starter"
 	"github.com/halverneus/static-file-server/cli/version"
 	"github.com/halverneus/static-file-server/config"
 )
@@ -25,6 +28,12 @@ var (
 	runServerFunc   = server.Run
 	runHelpFunc     = help.Run
 	runVersionFunc  = version.Run
+	runResolveFunc  = server.Resolve
+	runBenchFunc    = server.Bench
+	runCheckFunc    = server.CheckCacheHeaders
+	runSchemaFunc   = schema.Run
+	runDumpFunc     = dump.Run
+	runStarterFunc  = starter.Run
 	loadConfig      = config.Load
 )
 
@@ -66,6 +75,39 @@ func selectionRoutine(args Args) func() error {
 	case args.Matches("version") || option.versionFlag:
 		return runVersionFunc
 
+	// serve schema
+	case args.Matches("schema"):
+		return runSchemaFunc
+
+	// serve config dump
+	case args.Matches("config", "dump"):
+		return withConfig(runDumpFunc)
+
+	// serve config init
+	// serve config init /path/to/config.yml
+	case args.Matches("config", "init"):
+		return func() error { return runStarterFunc("") }
+	case args.Matches("config", "init", "*"):
+		return func() error { return runStarterFunc(args[2]) }
+
+	// serve resolve /url/path
+	case args.Matches("resolve", "*"):
+		return withConfig(func() error {
+			return runResolveFunc(args[1])
+		})
+
+	// serve bench /url/path
+	case args.Matches("bench", "*"):
+		return withConfig(func() error {
+			return runBenchFunc(args[1])
+		})
+
+	// serve check-cache-headers /url/path
+	case args.Matches("check-cache-headers", "*"):
+		return withConfig(func() error {
+			return runCheckFunc(args[1])
+		})
+
 	// serve
 	case args.Matches():
 		return withConfig(runServerFunc)
@@ -85,6 +85,30 @@ func TestExecuteAndSelection(t *testing.T) {
 	runServerFunc = func() error {
 		return runServerFuncError
 	}
+	runSchemaFuncError := errors.New("schema")
+	runSchemaFunc = func() error {
+		return runSchemaFuncError
+	}
+	runDumpFuncError := errors.New("dump")
+	runDumpFunc = func() error {
+		return runDumpFuncError
+	}
+	runStarterFuncError := errors.New("starter")
+	runStarterFunc = func(string) error {
+		return runStarterFuncError
+	}
+	runResolveFuncError := errors.New("resolve")
+	runResolveFunc = func(string) error {
+		return runResolveFuncError
+	}
+	runBenchFuncError := errors.New("bench")
+	runBenchFunc = func(string) error {
+		return runBenchFuncError
+	}
+	runCheckFuncError := errors.New("check")
+	runCheckFunc = func(string) error {
+		return runCheckFuncError
+	}
 	unknownArgsFuncError := errors.New("unknown")
 	unknownArgsFunc = func(Args) func() error {
 		return func() error {
@@ -108,6 +132,16 @@ func TestExecuteAndSelection(t *testing.T) {
 		{"Version", []string{app, "version"}, runVersionFuncError},
 		{"Version", []string{app, "--version"}, runVersionFuncError},
 		{"Serve", []string{app}, runServerFuncError},
+		{"Schema", []string{app, "schema"}, runSchemaFuncError},
+		{"Config dump", []string{app, "config", "dump"}, runDumpFuncError},
+		{"Config init", []string{app, "config", "init"}, runStarterFuncError},
+		{"Config init file", []string{app, "config", "init", "config.yml"}, runStarterFuncError},
+		{"Resolve", []string{app, "resolve", "/file.txt"}, runResolveFuncError},
+		{"Resolve without path", []string{app, "resolve"}, unknownArgsFuncError},
+		{"Bench", []string{app, "bench", "/file.txt"}, runBenchFuncError},
+		{"Bench without path", []string{app, "bench"}, unknownArgsFuncError},
+		{"Check cache headers", []string{app, "check-cache-headers", "/file.txt"}, runCheckFuncError},
+		{"Check cache headers without path", []string{app, "check-cache-headers"}, unknownArgsFuncError},
 		{"Unknown", []string{app, "unknown"}, unknownArgsFuncError},
 	}
 
@@ -19,6 +19,12 @@ NAME
 SYNOPSIS
     static-file-server
     static-file-server [ -c | -config | --config ] /path/to/config.yml
+    static-file-server [ -c | -config | --config ] /path/to/config.yml resolve /url/path
+    static-file-server [ -c | -config | --config ] /path/to/config.yml bench /url/path
+    static-file-server [ -c | -config | --config ] /path/to/config.yml check-cache-headers /url/path
+    static-file-server [ -c | -config | --config ] /path/to/config.yml config dump
+    static-file-server config init [ /path/to/config.yml ]
+    static-file-server schema
     static-file-server [ help | -help | --help ]
     static-file-server [ version | -version | --version ]
 
@@ -29,28 +35,687 @@ DESCRIPTION
     URL path prefix and selecting TLS certificates. If you want really awesome
     reverse proxy features, I recommend Nginx.
 
+COMMANDS
+    resolve /url/path
+        Prints how a GET request for the URL path would be served with the
+        current configuration, without starting the server: the response status,
+        each pipeline stage reached, the mount override applied, the file the
+        path resolves to within FOLDER and the response headers. Useful in CI to
+        check routing before deploying a configuration.
+    bench /url/path
+        Serves the current configuration on a local port and sends GET requests
+        for the URL path from several concurrent clients for ten seconds, then
+        prints the request rate, throughput, status codes and latency
+        percentiles. Useful to compare the performance of configurations, such
+        as with and without CACHE_MAX_SIZE, on the same machine.
+    check-cache-headers /url/path
+        Prints the status and caching headers (Cache-Control, Expires, ETag,
+        Last-Modified, Vary, Surrogate-Key and Cache-Tag) a GET request for the
+        URL path would be answered with by the current configuration, without
+        starting the server, followed by the status of revalidating it with
+        If-None-Match or If-Modified-Since. The output is stable, so CI can
+        compare it against an expected copy to assert the caching policy.
+        Exits with an error if the path is not served successfully.
+    config dump
+        Prints the effective configuration as YAML, after merging the
+        configuration file, its includes and environment variables and applying
+        defaults, to find out which value of an option is used. The values of
+        ACCESS_LOG_HASH_KEY, CDN_PURGE_TOKEN, NOTIFY_WEBHOOK,
+        PRESIGN_CREDENTIALS, PURGE_WEBHOOK, TLS_VAULT_TOKEN and TRACE_KEY are
+        masked.
+    config init [ /path/to/config.yml ]
+        Writes a commented starter configuration file, which must not exist,
+        or prints it if no file is given. FOLDER is the first of 'public',
+        'dist', 'build', '_site', 'site', 'www' and 'html' found in the current
+        directory, or the current directory itself. TLS_CERT and TLS_KEY are
+        set if a certificate and key named 'fullchain.pem' and 'privkey.pem',
+        'cert.pem' and 'key.pem', 'server.crt' and 'server.key' or 'tls.crt'
+        and 'tls.key' are found. Other options are commented out with their
+        default values.
+    schema
+        Prints a JSON Schema of the configuration file, including the default
+        value of each option, for editors and CI to validate configuration
+        files. Unknown keys in the configuration file are errors, so misspelled
+        options are reported rather than ignored.
+
 DEPENDENCIES
     None... not even libc!
 
 ENVIRONMENT VARIABLES
+    ACCESS_LOG_EXCLUDE
+        Comma-separated list of URL path globs, such as '/healthz,/**.ico',
+        never written to the access log enabled by DEBUG. In the globs, '**'
+        matches any characters and '*' matches any characters other than '/'.
+        If not supplied, all requests are logged.
+    ACCESS_LOG_FIELDS
+        Comma-separated list of values to add to the access log enabled by
+        DEBUG, in the form 'field=treatment'. The fields are 'ip' (the client
+        IP address), 'query' (the query string), 'access-key' (the key sent
+        as a bearer token or in 'X-Access-Key') and 'tls' (the TLS version,
+        cipher suite and server name of HTTPS requests, logged as is, and the
+        subject of the client certificate when one is presented). The
+        treatment is 'keep' to log the value, 'hash' to log a keyed hash so
+        requests can be correlated, 'redact' to log that the value was present
+        (keeping query parameter names) or, for 'ip', 'mask' to remove the
+        host part of the address. Fields not listed are not logged. For
+        example, 'ip=mask,query=redact,tls=keep'.
+    ACCESS_LOG_HASH_KEY
+        Secret key of the hashes of ACCESS_LOG_FIELDS. If not supplied, a
+        random key is used and hashes only correlate requests until the server
+        restarts.
+    ACCESS_LOG_SAMPLE
+        Write 1 in ACCESS_LOG_SAMPLE successful requests to the access log
+        enabled by DEBUG, while always writing requests resulting in an error.
+        When sampling or excluding paths, requests are logged after they are
+        served and include their status code. Default value is '1' (every
+        request).
+    ALERT_MIN_REQUESTS
+        Number of responses within ALERT_WINDOW needed for ALERTS to be
+        raised or resolved, so quiet windows do not alert on a single error.
+        Default value is '20'.
+    ALERT_WINDOW
+        Duration (e.g. '5m') of the windows ALERTS are evaluated over. Default
+        value is '1m'.
+    ALERTS
+        Comma-separated alert rules in the form 'class>percent', such as
+        '5xx>5' for more than 5% server errors or '4xx>25'. At the end of each
+        ALERT_WINDOW, a rule whose status class exceeds the percent of all
+        responses is raised, logged as an 'Error:' line annotated with
+        'alert=5xx', and resolved once a later window no longer exceeds it.
+        Both are notified as 'alerts' if NOTIFY_WEBHOOK is set. If not
+        supplied, no alerts are raised.
+    AUDIT_LOG
+        File receiving one line of JSON for each authentication success and
+        failure, each lockout ban and each request refused by LOCKOUT_*,
+        POLICY, SCRIPT, USER_AGENT_* or GEOIP_* rules, with the time, event,
+        subject, client IP, country, method, path and the realm or rule
+        involved, suitable for shipping to a SIEM. Use '-' for standard output.
+        If not supplied, no audit log is written.
+    AUTH_REALMS
+        Newline-separated list of authentication realms in the form
+        '/path/prefix=scheme:filename'. Requests for paths within the prefix
+        are only served when authenticated by the realm with the longest
+        matching prefix. The 'basic' scheme uses HTTP basic authentication and
+        the 'key' scheme uses access keys sent as 'Authorization: Bearer <key>'
+        or 'X-Access-Key: <key>'. Each line of the file is 'user:password' or
+        'subject:key'. Secrets are plain text, '{SHA}' followed by the base64
+        encoded SHA-1 hash (as produced by 'htpasswd -s') or '{SHA256}'
+        followed by the hex encoded SHA-256 hash. The authenticated subject can
+        be matched by POLICY rules. If not supplied, all requests are served
+        anonymously.
+    CACHE_CONTROL
+        Browser directives of the 'Cache-Control' header of every response,
+        such as 'public, max-age=60'. HEADERS can override the header for a
+        path prefix. If not supplied, no header is sent.
+    CACHE_CONTROL_S_MAXAGE
+        Duration shared caches, such as CDNs, may keep responses, sent as the
+        's-maxage' directive separately from the browser 'max-age'. Default
+        value is '0', omitting the directive.
+    CACHE_CONTROL_STALE_IF_ERROR
+        Duration a stale response may be served when revalidating it fails,
+        sent as the 'stale-if-error' directive. Default value is '0', omitting
+        the directive.
+    CACHE_CONTROL_STALE_WHILE_REVALIDATE
+        Duration a stale response may be served while it is revalidated in the
+        background, sent as the 'stale-while-revalidate' directive. Default
+        value is '0', omitting the directive.
+    CACHE_IGNORE_QUERY
+        Comma-separated list of query parameters, such as cache busting 'v' or
+        'cb' parameters, ignored when looking up responses in the memory cache
+        so versioned URLs of the same file share a cached response. Files are
+        always resolved without the query string. If not supplied, the whole
+        URL is used.
+    CACHE_MAX_ENTRY_SIZE
+        The size in bytes of the largest response kept in the memory cache.
+        Default value is '1048576' (1MiB).
+    CACHE_MAX_SIZE
+        The total size in bytes of responses kept in the memory cache. If
+        supplied, complete successful responses are kept in memory and replayed
+        for later requests of the same URL, evicting the least recently used
+        responses when full. Default value is '0' (disabled).
+    CACHE_TTL
+        Duration (e.g. '5m') after which a cached response is discarded, so
+        changes to files on disk are served. If set to '0s', responses are only
+        discarded when evicted. Default value is '1m'.
+    CANARY_FOLDER
+        Folder of a canary release of the site, served to CANARY_PERCENT of
+        clients for A/B tests or gradual rollouts. Requests of those clients
+        pass through the stages applying to every request, such as auth and
+        rate limits, then through their own copy of the stages serving files,
+        such as headers, caching and ETags, with the files of the canary
+        release. Stages added by plugins apply to the stable release only. If
+        not supplied, all clients are served from FOLDER.
+    CANARY_PERCENT
+        Percent of clients, from 0 to 100, served the release in
+        CANARY_FOLDER. Default value is '0'.
+    CANARY_STICKY
+        How clients stick to the release they were first served. Valid values
+        are 'cookie', choosing at random and remembering the release in the
+        'canary' cookie for a day ('1' for the canary and '0' for the stable
+        release, which testers may set to pick one), and 'ip', choosing by a
+        hash of the client IP address. With 'ip', caches in front of the
+        server must not share responses between clients. Default value is
+        'cookie'.
+    CDN_PURGE
+        CDN to purge of changed files in FOLDER, from 'cloudflare', 'cloudfront'
+        and 'fastly'. The folder is checked every WATCH_INTERVAL. If FOLDER is a
+        symbolic link, switching it to a new target purges every file. If not
+        supplied, no CDN is purged.
+    CDN_PURGE_BASE_URL
+        Public URL of the site, such as 'https://www.example.com', used to purge
+        files by URL. Required for 'cloudflare'. For 'fastly', files are purged
+        by URL in addition to their surrogate keys if supplied.
+    CDN_PURGE_ID
+        Cloudflare zone ID, CloudFront distribution ID or Fastly service ID.
+    CDN_PURGE_TOKEN
+        Cloudflare or Fastly API token or, for CloudFront, AWS credentials in
+        the form 'access-key-id:secret-access-key[:session-token]'.
+    CHECKSUM_STATE
+        Path of a file persisting the checksums computed for CHECKSUMS. Each
+        checksum is appended as it is computed and the file is loaded at
+        startup, so checksums of unchanged files are not computed again after a
+        restart. If not supplied, checksums are only kept in memory.
+    CHECKSUM_WORKERS
+        Number of workers computing the checksums of every file in FOLDER for
+        CHECKSUMS in the background at startup, rather than when first
+        requested, limiting the CPUs used to hash a large folder. Default value
+        is '0' (computed when requested).
+    CHECKSUMS
+        Comma-separated list of checksum algorithms from 'md5', 'sha1',
+        'sha256' and 'sha512'. If supplied, requesting a file with the algorithm
+        appended as an extension (e.g. '/my.file.sha256') returns the checksum
+        of the file in the format used by 'sha256sum' when no such checksum
+        file exists. Checksums are cached until the file changes. If not
+        supplied, no checksums are computed.
+    CONFIG_DUMP
+        When set to 'true', the effective configuration, as printed by 'config
+        dump', is served as YAML from CONFIG_DUMP_PATH after AUTH and POLICY
+        are applied. Default value is 'false'.
+    CONFIG_DUMP_PATH
+        The URL path of the configuration endpoint. Default value is
+        '/__config'.
+    CONTENT_TYPES
+        Comma-separated list of rules in the form 'pattern=type', where pattern
+        is a URL path (e.g. '/.well-known/apple-app-site-association') or, if
+        it does not begin with '/', the name of files in any folder (e.g.
+        'Caddyfile') and type is the Content-Type they are served with rather
+        than one guessed from their extension or contents. Rules for URL paths
+        take priority over rules for names. If not supplied, content types are
+        guessed.
+    COPY_BUFFER_SIZE
+        Size in bytes of the pooled buffers used when files are copied through
+        user space rather than sent with sendfile, such as memory-mapped files,
+        responses recorded by CACHE_MAX_SIZE, checksums and content searches.
+        Larger buffers need fewer system calls at the cost of memory for each
+        concurrent copy. Default value is '32768'.
+    CORS
+        Comma-separated list of rules in the form '[/path/prefix=]policy',
+        where policy is 'open' for any origin, 'none' for no cross-origin
+        requests or space-separated 'http://' and 'https://' origins. The rule
+        with the longest prefix of the requested path applies, so fonts and
+        WebAssembly can be open while pages stay locked down, for example
+        '/fonts=open,/cdn=open,https://app.example.com'. Preflight requests
+        from allowed origins are answered before authentication. Rules without
+        a prefix apply to all paths. If not supplied, no CORS headers are set.
+    CROSS_ORIGIN_EMBEDDER_POLICY
+        Value of the 'Cross-Origin-Embedder-Policy' header of every response,
+        either 'unsafe-none', 'require-corp' or 'credentialless'. Together with
+        a CROSS_ORIGIN_OPENER_POLICY of 'same-origin', 'require-corp' enables
+        cross-origin isolation for sites using SharedArrayBuffer or WebAssembly
+        threads. HEADERS can override the header for a path prefix. If not
+        supplied, no header is sent.
+    CROSS_ORIGIN_OPENER_POLICY
+        Value of the 'Cross-Origin-Opener-Policy' header of every response,
+        either 'unsafe-none', 'same-origin-allow-popups', 'same-origin' or
+        'noopener-allow-popups'. If not supplied, no header is sent.
+    CROSS_ORIGIN_RESOURCE_POLICY
+        Value of the 'Cross-Origin-Resource-Policy' header of every response,
+        either 'same-site', 'same-origin' or 'cross-origin'. If not supplied,
+        no header is sent.
     DEBUG
         When set to 'true' enables additional logging, including the
-        configuration used and an access log for each request. Default value is
-        'false'.
+        configuration used, with secrets masked as by 'config dump', and an
+        access log for each request. Default value is 'false'.
+    ETAG
+        Strategy for the 'ETag' header of files, answering conditional and
+        Range requests: 'weak' derives it from the modification time and size,
+        'strong' uses the SHA-256 hash of the contents (stable across deploys
+        rewriting unchanged files), 'manifest' uses ETAG_MANIFEST and 'none'
+        sends no ETag. Can be overridden for a path prefix with 'overrides'.
+        Default value is 'none'.
+    ETAG_MANIFEST
+        JSON file mapping file paths, such as '/js/app.js', to their ETags for
+        the 'manifest' strategy. Files missing from the manifest have no ETag.
+    EVENTS
+        When set to 'true', files created, modified and deleted in FOLDER are
+        streamed as Server-Sent Events ('create', 'modify' or 'delete' with
+        the URL path as JSON data) from EVENTS_PATH, after AUTH and POLICY are
+        applied. The 'prefix' query parameter limits the events to files
+        within a URL path prefix, and events of files the client could not
+        read past AUTH_REALMS and POLICY are left out. Requires
+        WATCH_INTERVAL. Default value is 'false'.
+    EVENTS_PATH
+        The URL path of the event stream. Default value is '/__events'.
     FOLDER
         The path to the folder containing the contents to be served over
         HTTP(s). If not supplied, defaults to '/web' (for Docker reasons).
+    GEOIP_ALLOW
+        Comma-separated list of ISO country codes (e.g. 'US,CA'). If supplied,
+        only clients resolved to one of the countries are served and all others
+        (including unknown countries) receive 'FORBIDDEN'. Requires
+        GEOIP_FOLDER. If not supplied, clients from any country are served.
+    GEOIP_DENY
+        Comma-separated list of ISO country codes. Clients resolved to one of
+        the countries receive 'FORBIDDEN'. Takes priority over GEOIP_ALLOW.
+        Requires GEOIP_FOLDER. If not supplied, no country is denied.
+    GEOIP_FOLDER
+        Path to the folder containing the extracted MaxMind GeoLite2 Country
+        CSV database. If supplied, the country of each client is added to the
+        access log when DEBUG is enabled. If not supplied, no GeoIP lookups are
+        performed.
+    HEADERS
+        Newline-separated list of response header rules in the form
+        '[/path/prefix=]Name: value'. Rules apply in order to requests for paths
+        beginning with the prefix (or all paths if no prefix is given), so later
+        rules override earlier rules for the same header. An empty value
+        removes the header. If not supplied, no headers are changed.
     HOST
         The hostname used for binding. If not supplied, contents will be served
         to a client without regard for the hostname.
+    IMAGE_RESIZE
+        If 'true', GET and HEAD requests for JPEG, PNG and GIF images with 'w'
+        and/or 'h' query parameters are served the image resized to that width
+        and height in pixels, such as '/photo.jpg?w=400&h=300&fit=cover'. The
+        'fit' parameter is 'contain' to fit within both (default), 'cover' to
+        fill both and crop the center or 'fill' to stretch to both. Images are
+        not enlarged unless the fit is 'fill'. At most one image per CPU is
+        resized at a time. Default value is 'false'.
+    IMAGE_RESIZE_CACHE
+        Folder keeping resized images, created if missing, so each image is
+        resized once until the original changes. The least recently used
+        images are removed once the folder holds more than
+        IMAGE_RESIZE_CACHE_MAX_SIZE. If not supplied, images are resized for
+        each request.
+    IMAGE_RESIZE_CACHE_MAX_SIZE
+        Largest total size, in bytes, of the images kept in IMAGE_RESIZE_CACHE.
+        Default value is '268435456' (256MiB).
+    IMAGE_RESIZE_MAX_PIXELS
+        Largest original image, in pixels, that is resized. Larger images are
+        refused with '422 Unprocessable Entity' before they are decoded.
+        Default value is '40000000'.
+    IMAGE_RESIZE_MAX_SIZE
+        Largest width or height, in pixels, that can be requested. Larger
+        sizes are refused with '400 Bad Request'. Default value is '2048'.
+    INJECT_BODY
+        HTML snippet, such as a cookie banner, inserted before the last
+        '</body>' of successful HTML responses that are not encoded. Requests
+        for HTML files and folders ignore 'Range' so the snippet is always
+        included. If not supplied, no snippet is inserted.
+    INJECT_HEAD
+        HTML snippet, such as an analytics tag, inserted before the last
+        '</head>' of successful HTML responses, in the same way as INJECT_BODY.
+        If not supplied, no snippet is inserted.
+    LOCKOUT_BAN_TIME
+        Duration a client is banned for after LOCKOUT_THRESHOLD failed
+        authentication attempts. Default value is '15m'.
+    LOCKOUT_PATH
+        URL path listing the currently banned clients as JSON when lockout is
+        enabled. Served after AUTH_REALMS and POLICY, which should restrict it
+        to administrators. Default value is '/__lockout'.
+    LOCKOUT_THRESHOLD
+        Number of failed authentication attempts by a client IP address within
+        LOCKOUT_WINDOW after which the client is refused with 'TOO MANY
+        REQUESTS' for LOCKOUT_BAN_TIME. Only requests supplying credentials
+        count as attempts. Default value is '0', disabling lockout.
+    LOCKOUT_WINDOW
+        Duration within which failed authentication attempts are counted.
+        Default value is '5m'.
+    LOG_OUTPUT
+        Destination the log is shipped to instead of standard error, in the
+        form 'format+network://host:port'. The format is 'gelf' for Graylog
+        Extended Log Format or 'syslog' for RFC 5424 syslog and the network is
+        'udp' or 'tcp', such as 'gelf+udp://graylog:12201'. Access log
+        annotations, such as the subject and status, are sent as additional
+        GELF fields or syslog structured data. Lines that cannot be shipped are
+        written to standard error. If not supplied, the log is written to
+        standard error.
+    METADATA
+        When set to 'true', requesting a file with the 'meta' query parameter
+        (e.g. '/my.file?meta=1') returns JSON with the name, size, modification
+        time, content type and SHA-256 hash of the file instead of its contents.
+        Default value is 'false'.
+    METRICS
+        When set to 'true', request counts, response sizes, durations,
+        requests in progress, HTTPS requests by TLS version and cipher suite,
+        the transfer stats described for STATS, the number of times
+        connections entered each state (including 'hijacked' and 'closed'),
+        the requests served by closed connections and how long they were
+        open, heap allocations, garbage collection cycles and pauses,
+        goroutines, and the requests and response bytes of each of the
+        'tenants' are served from METRICS_PATH in the Prometheus text
+        format, or in the OpenMetrics or Prometheus protobuf format when the
+        scraper accepts them. Both keep the trace ID of requests with a W3C
+        'traceparent' header as exemplars of the request durations, and the
+        protobuf format adds native histograms. Default value is 'false'.
+    METRICS_PATH
+        The URL path of the metrics endpoint. Default value is '/metrics'.
+    MINIFY
+        If 'true', successful HTML, CSS and JavaScript responses are minified
+        on the fly, removing comments and collapsing whitespace, and the result
+        is kept in memory until the file changes. Minification is conservative,
+        keeping line breaks in JavaScript and the contents of 'pre' and
+        'textarea' elements, and JavaScript with a slash after a closing
+        parenthesis is left unchanged. Requests for these files ignore
+        'Range', and their 'ETag' is weakened. Default value is 'false'.
+    MMAP_MIN_SIZE
+        Files in FOLDER of at least MMAP_MIN_SIZE bytes are read through memory
+        maps, reducing read system calls and sharing the pages of popular files
+        across concurrent downloads. Mapped files are not sent with sendfile
+        and must be replaced, such as by renaming, rather than truncated while
+        being served. Ignored where memory maps are not supported. Default
+        value is '0' (disabled).
+    NOISE
+        Response to GET and HEAD requests for NOISE_PATHS that are not files in
+        FOLDER, such as icons browsers ask for whether or not a site has them.
+        Either 'no-content', answering with 'NO CONTENT', or 'synthesize',
+        answering with a transparent image for '.ico' and '.png' paths and
+        'NO CONTENT' for others. Responses are cached for a day and not logged
+        as errors. If not supplied, such requests return 'NOT FOUND'.
+    NOISE_PATHS
+        Comma-separated list of patterns, in the form accepted by Go's
+        path.Match, of the URL paths answered with NOISE. Patterns without a
+        leading '/' match names in any folder. Default value is
+        '/favicon.ico,/apple-touch-icon*.png'.
+    NOTIFY_AUTH_FAILURES
+        Number of authentication failures within NOTIFY_WINDOW notified as
+        'auth-failures'. Default value is '10'.
+    NOTIFY_EVENTS
+        Comma-separated events posted to NOTIFY_WEBHOOK: 'first-download' for
+        the first download of a file added or changed since the server
+        started (requires WATCH_INTERVAL), 'auth-failures', 'server-errors'
+        and 'alerts' raised or resolved by ALERTS. Default value is
+        'first-download,auth-failures,server-errors,alerts'.
+    NOTIFY_INTERVAL
+        Duration (e.g. '1m') between batches posted to NOTIFY_WEBHOOK. Default
+        value is '10s'.
+    NOTIFY_SERVER_ERRORS
+        Number of server error responses (500 and above) within NOTIFY_WINDOW
+        notified as 'server-errors'. Default value is '10'.
+    NOTIFY_WEBHOOK
+        URL posted the NOTIFY_EVENTS in JSON batches holding a 'text' summary,
+        as expected by Slack incoming webhooks, and the 'notifications' with
+        their 'time', 'event', 'path', 'count' and 'message'. Failed batches
+        are logged and dropped. If not supplied, nothing is notified.
+    NOTIFY_WINDOW
+        Duration of the windows NOTIFY_AUTH_FAILURES and NOTIFY_SERVER_ERRORS
+        are counted in. Each is notified at most once per window. Default
+        value is '1m'.
+    OPEN_FILE_CACHE_SIZE
+        Number of regular files in FOLDER kept open between requests, so
+        popular files are not opened and closed for every request. The least
+        recently used files are closed to make room for others. Open files are
+        read with positioned reads rather than sent with sendfile, and changed
+        files are served from the open file until FOLDER is next checked every
+        WATCH_INTERVAL. Default value is '0' (disabled).
+    PATH_NORMALIZATION
+        How requests for ambiguous paths are handled, which a proxy or CDN in
+        front of the server may resolve to a different file than the server
+        does. Paths are ambiguous if, once decoded, they contain backslashes,
+        percent-encoded bytes (from double encoding such as '%252e'), dot or
+        empty segments or control characters, or if they were requested with
+        an encoded slash ('%2f'). Valid values are 'reject' to answer with
+        'BAD REQUEST', 'normalize' to permanently redirect to the normalized
+        path (paths with control characters are still refused) and 'off' to
+        serve them as before. Regardless of the value, paths with dot or empty
+        segments are first permanently redirected to the cleaned path, as by
+        Go's ServeMux, so that prefixes such as AUTH_REALMS always match.
+        'reject' is recommended behind a proxy or CDN. Default value is 'off'.
+    PERMISSIONS_POLICY
+        Newline-separated list of directives in the form
+        'feature=origin origin...' sent as the 'Permissions-Policy' header of
+        every response. Each origin is 'self', '*' or an 'https://' origin and
+        a directive without origins, such as 'camera=', disables the feature.
+        Can be overridden for a path prefix with 'overrides'. If not supplied,
+        no header is sent.
+    POLICY
+        Newline-separated list of access policy rules in the form
+        'outcome methods glob [ip=cidr,...] [country=code,...] [subject=name,...]'.
+        The first rule matching the method, path and client decides whether
+        the request is served. The outcome is 'allow', 'deny' or 'require-auth'
+        (refusing clients that are not authenticated). Methods are
+        comma-separated or '*' for any method. In the glob, '**' matches any
+        characters and '*' matches any characters other than '/'. Countries
+        require GEOIP_FOLDER. If not supplied, or no rule matches, requests are
+        served.
     PORT
         The port used for binding. If not supplied, defaults to port '8080'.
+    PRESIGN_CREDENTIALS
+        Credentials signing PRESIGN_URL redirects in the form
+        'access-key-id:secret-access-key[:session-token]'.
+    PRESIGN_EXPIRES
+        Duration (e.g. '15m') presigned URLs remain valid, between '1s' and
+        '168h'. Default value is '5m'.
+    PRESIGN_REGION
+        Region of the bucket of PRESIGN_URL, or 'auto' for Google Cloud
+        Storage. Default value is 'us-east-1'.
+    PRESIGN_URL
+        Base URL of objects in S3, or another object store accepting AWS
+        Signature Version 4 such as Google Cloud Storage with HMAC keys (e.g.
+        'https://bucket.s3.us-east-1.amazonaws.com'). If supplied, requests for
+        files are answered with a 'FOUND' redirect to a URL of the object with
+        the same path, presigned with PRESIGN_CREDENTIALS, rather than serving
+        it from FOLDER, so clients download directly from the object store
+        while authorization and logging stay with the server. Folders redirect
+        to their 'index.html' object. If not supplied, files are served.
+    PROBLEM_DETAILS
+        When set to 'true', client and server error responses are sent as RFC
+        7807 'application/problem+json' documents with the status, title, path
+        and request ID to clients preferring JSON to HTML in their 'Accept'
+        header, such as single-page applications and API clients. The request
+        ID is taken from the 'X-Request-Id' request header, or generated, and
+        returned in the same header. Default value is 'false'.
+    PROTOCOLS
+        Comma-separated list of the protocols served, of 'h2', 'h2c' and
+        'http/1.1'. 'h2' is advertised to clients during TLS negotiation;
+        remove it to serve HTTP/1.1 only over HTTPS, such as while debugging a
+        proxy that mishandles HTTP/2. 'h2c' serves cleartext HTTP/2 to clients
+        upgrading or connecting with prior knowledge, such as a proxy
+        terminating TLS. HTTP/1.1 must be listed and HTTP/3 is not supported.
+        Listeners can override it (see below). Default value is 'h2,http/1.1'.
+    PURGE_WEBHOOK
+        URL receiving a JSON 'POST' of the changed paths and their surrogate
+        keys, in the form '{"paths":[...],"keys":[...]}', when files in FOLDER
+        are added, changed or removed. The folder is checked every
+        WATCH_INTERVAL. If not supplied, files are not watched.
+    RATE_LIMIT
+        Number of requests each client IP address may make per
+        RATE_LIMIT_WINDOW. Responses carry 'RateLimit-Limit',
+        'RateLimit-Remaining' and 'RateLimit-Reset' headers and requests beyond
+        the limit are refused with 'TOO MANY REQUESTS' and a 'Retry-After'
+        header. Default value is '0', disabling rate limiting.
+    RATE_LIMIT_WINDOW
+        Duration of each rate limiting window. Default value is '1m'.
+    READV_BATCH
+        Experimental. Files in FOLDER are read in batches of READV_BATCH copy
+        buffers (see COPY_BUFFER_SIZE), each filled by a single preadv system
+        call, making fewer read system calls when serving large files over
+        HTTPS. Batched files are not sent with sendfile, so plain HTTP is
+        usually faster without. Only available on Linux when built with
+        'go build -tags readv', and ignored when MMAP_MIN_SIZE is set. Default
+        value is '0' (disabled).
+    RETENTION_DRY_RUN
+        When set to 'true', the versions RETENTION_PATTERNS would remove are
+        only logged, to check a policy before enabling it. Default value is
+        'false'.
+    RETENTION_INTERVAL
+        Duration between applying the retention policy, which is also applied
+        when the server starts. Default value is '1h'.
+    RETENTION_KEEP
+        Number of the newest versions, by modification time, kept in each
+        folder. Older versions are removed. If set to '0', versions are only
+        removed by RETENTION_MAX_AGE. Default value is '0'.
+    RETENTION_MAX_AGE
+        Duration (e.g. '720h') since their modification after which versions
+        are removed, even if among the newest RETENTION_KEEP. If set to '0',
+        versions are only removed by RETENTION_KEEP. Default value is '0'.
+    RETENTION_PATTERNS
+        Comma-separated list of patterns matching the versions of artifacts in
+        FOLDER, such as uploaded release archives or release folders, so
+        artifact servers with uploads do not need cleanup scripts. Patterns
+        are in the form accepted by Go's path.Match and match the name or,
+        with a leading '/', the path of a file or folder (e.g. '*.tar.gz' or
+        '/releases/v*'). Matching folders are removed with their contents.
+        Files and folders not matching are never removed. Each version removed
+        is logged. If not supplied, nothing is removed.
+    ROBOTS_TXT
+        Generate '/robots.txt' when the file does not exist in the folder being
+        served. Set to 'allow' to permit all crawlers, 'deny' to refuse all
+        crawlers or the path to a text template file (which may reference
+        '{{.Scheme}}' and '{{.Host}}'). If not supplied, nothing is generated.
+    ROOTS
+        When set to 'true', files are served from one of several named roots,
+        switched at runtime for blue/green releases managed by the server
+        rather than by replacing a symbolic link. FOLDER is served as the root
+        'default' until another root is activated. The roots are managed from
+        ROOTS_PATH after AUTH and POLICY are applied, by clients authenticated
+        by AUTH_REALMS or on an admin listener only: GET requests return the
+        roots and the active root as JSON, and POST requests with the form
+        value 'activate=name' switch to a root of ROOTS_FOLDERS and
+        'rollback=1' switches back to the previously active root. POST
+        requests from another origin are refused. Responses kept by
+        CACHE_MAX_SIZE are served until CACHE_TTL passes, and
+        OPEN_FILE_CACHE_SIZE is not used. Default value is 'false'.
+    ROOTS_FOLDERS
+        Comma-separated list of roots in the form 'name=folder' registered
+        when the server starts. If not supplied, only FOLDER is registered.
+    ROOTS_PATH
+        The URL path of the roots endpoint. Default value is '/__roots'.
+    SCRIPT
+        Path to a file of statements applied in order to each request after
+        AUTH and POLICY, one per line in the form
+        'action [arguments] [if condition]'. Actions are 'allow', 'deny [code]',
+        'redirect [code] "url"', 'rewrite "path"' and 'header Name "value"'.
+        Conditions compare method, path, query, host, ip, country, subject,
+        header.Name, query.name and cookie.name with quoted strings using
+        '==', '!=', '^=', '~' (regular expression) and '!~', combined with
+        '&&', '||', '!' and parentheses. Arguments can refer to the groups of
+        the regular expression matched last as '$1'. If not supplied, no
+        script is applied.
+    SEARCH
+        When set to 'true', requests for SEARCH_PATH return paginated JSON
+        results of files under FOLDER matching the 'q' query parameter, which is
+        a glob pattern if it contains any of '*?[' or a case-insensitive
+        substring otherwise. The search can be limited to a folder with the
+        'path' query parameter and paginated with the 'page' and 'limit' (max
+        1000) query parameters. Note that file names are revealed regardless
+        of SHOW_LISTING, although files the client could not request through
+        AUTH_REALMS and POLICY are left out. Default value is 'false'.
+    SEARCH_CONTENTS
+        When set to 'true', a search with the 'contents' query parameter set
+        also matches the substring against the contents of text files (up to
+        10MiB). Default value is 'false'.
+    SEARCH_INDEX
+        When set to 'true', searches are answered from a full-text index of
+        the text files in FOLDER, such as HTML, Markdown and plain text (up to
+        10MiB each), turning the server into a documentation host with search.
+        The index is built in the background when the server starts and
+        updated as files change, checked every WATCH_INTERVAL, which is
+        required. The 'q' query parameter is a list of words, and the files
+        containing every word are returned best matches first, with their
+        titles and scores. Text in HTML tags, scripts, styles and comments is
+        not indexed. The 'path', 'page' and 'limit' query parameters are
+        accepted as before, and files the client could not read past
+        AUTH_REALMS and POLICY are left out. Default value is 'false'.
+    SEARCH_PATH
+        The URL path of the search endpoint. Default value is '/__search'.
+    SECURITY_TXT_CONTACT
+        Comma-separated list of contact URIs (e.g. 'mailto:security@my.machine')
+        used to generate '/.well-known/security.txt' (RFC 9116) when the file
+        does not exist in the folder being served. If supplied then
+        SECURITY_TXT_EXPIRES must also be supplied. If not supplied, nothing is
+        generated.
+    SECURITY_TXT_ENCRYPTION
+        Optional URI of the key to use for encrypted security reports.
+    SECURITY_TXT_EXPIRES
+        RFC 3339 timestamp (e.g. '2030-01-01T00:00:00Z') after which the
+        generated security.txt should be considered stale.
+    SECURITY_TXT_POLICY
+        Optional URI of the vulnerability disclosure policy.
+    SECURITY_TXT_PREFERRED_LANGUAGES
+        Optional comma-separated list of languages for security reports.
+    SERVER_HEADER
+        Value of the 'Server' header of every response, replacing any value
+        set by HEADERS. Set to '-' to remove the header from every response.
+        The server sends no 'Server' or 'X-Powered-By' header of its own. If
+        not supplied, responses are left unchanged.
+    SITEMAP
+        When set to 'true', generate '/sitemap.xml' when the file does not
+        exist in the folder being served by walking the folder for files
+        matching SITEMAP_INCLUDE, again whenever files change as checked every
+        WATCH_INTERVAL. Files the client could not read past AUTH_REALMS and
+        POLICY are left out. Default value is 'false'.
+    SITEMAP_BASE_URL
+        The scheme and host (e.g. 'https://my.machine') used for locations in
+        the generated sitemap. Required when SITEMAP is enabled.
+    SITEMAP_EXCLUDE
+        Comma-separated list of glob patterns matched against the name and the
+        path (relative to FOLDER) of each file to remove from the sitemap (e.g.
+        'drafts/*'). If not supplied, no files are excluded.
+    SITEMAP_INCLUDE
+        Comma-separated list of glob patterns matched against the name and the
+        path (relative to FOLDER) of each file to list in the sitemap. Default
+        value is '*.html,*.htm'.
+    SITEMAP_INTERVAL
+        Duration (e.g. '30m') after which the folder is walked again when the
+        sitemap is requested. If set to '0s', the folder is only walked again
+        once files change.
+        Default value is '1h'.
     SHOW_LISTING
         Automatically serve the index file for the directory if requested. For
         example, if the client requests 'http://127.0.0.1/' the 'index.html'
         file in the root of the directory being served is returned. If the value
-        is set to 'false', the same request will return a 'NOT FOUND'. Default
-        value is 'true'.
+        is set to 'false', the same request will return a 'NOT FOUND'. Folders
+        without an index file are listed, streaming large folders a batch of
+        1024 entries at a time. The 'offset' and 'limit' query parameters
+        (e.g. '/big/?offset=1000&limit=1000') list a page of the entries with
+        a link to the next page. Default value is 'true'.
+    STATS
+        When set to 'true', the number of open connections, in total and in
+        the 'new', 'active' (serving a request) or 'idle' (kept alive) state,
+        active transfers, bytes active transfers have yet to send and
+        transfers aborted by clients disconnecting are served as JSON from
+        STATS_PATH, after AUTH and POLICY are applied. Default value is
+        'false'.
+    STATS_PATH
+        The URL path of the stats endpoint. Default value is '/__stats'.
+    STRIP_METADATA
+        If 'true', JPEG and PNG images are served without their metadata: the
+        EXIF and XMP segments, IPTC records and comments of JPEG images and the
+        EXIF, text and modification time chunks of PNG images, which may hold
+        GPS locations and camera details. The rest of each file is served
+        unchanged without decoding the image, so EXIF orientation is removed
+        and photos relying on it may be shown rotated. The locations of the
+        metadata are kept in memory until the file changes. Default value is
+        'false'.
+    SURROGATE_KEY_HEADER
+        Name of the response header listing the surrogate keys of each file,
+        such as 'Surrogate-Key' for Fastly or 'Cache-Tag' for Cloudflare. The
+        keys are the top level folder of the file followed by the keys of the
+        file in SURROGATE_KEY_MANIFEST. If not supplied, no header is sent.
+    SURROGATE_KEY_MANIFEST
+        Path to a JSON file mapping URL paths to lists of additional surrogate
+        keys, such as '{"/index.html":["home"]}'.
+    TEMPLATES
+        If 'true', files ending in '.tmpl' or '.gohtml' are rendered with the
+        variables of TEMPLATE_VARS, referenced as '{{.NAME}}', using
+        html/template for HTML output and text/template otherwise. A missing
+        file, such as 'config.js', is rendered from 'config.js.tmpl' and a
+        folder is served a missing 'index.html' from 'index.html.tmpl'.
+        Default value is 'false'.
+    TEMPLATE_VARS
+        Newline-separated list of template variables in the form 'NAME=value',
+        such as 'API_URL=https://api.example.com'. Names are letters, digits
+        and underscores.
     TLS_CERT
         Path to the TLS certificate file to serve files using HTTPS. If supplied
         then TLS_KEY must also be supplied. If not supplied, contents will be
@@ -59,28 +724,413 @@ ENVIRONMENT VARIABLES
         Path to the TLS key file to serve files using HTTPS. If supplied then
         TLS_CERT must also be supplied. If not supplied, contents will be served
         via HTTPS
+    TLS_OCSP_STAPLING
+        When set to 'true' the OCSP response of the certificate from TLS_CERT or
+        TLS_VAULT_URL is fetched from the responder named by the certificate and
+        stapled to TLS handshakes, so clients need not reach the responder of
+        the CA. The response is refreshed halfway through its validity and when
+        the certificate is reloaded. The certificate file must include the
+        issuer after the certificate, as a 'fullchain.pem' does. Default value
+        is 'false'.
+    TLS_RELOAD_INTERVAL
+        How often TLS_CERT and TLS_KEY, or the secret at TLS_VAULT_URL, are read
+        again. A rotated certificate, such as one renewed in a mounted
+        Kubernetes secret, is used for new connections without a restart. An
+        invalid certificate or key is logged and the current one kept. Default
+        value is '1m'.
+    TLS_SELF_SIGNED
+        When set to 'true', files are served using HTTPS with a certificate
+        generated at start for HOST, if supplied, 'localhost', '127.0.0.1' and
+        '::1', signed by its own key, for testing HTTPS locally without
+        creating certificates. Clients must be told to trust it, such as with
+        'curl --insecure'. The SHA-256 fingerprint of the certificate is logged.
+        TLS_CERT must not be supplied. Default value is 'false'.
+    TLS_VAULT_TOKEN
+        Token authenticating requests for the secret at TLS_VAULT_URL.
+    TLS_VAULT_URL
+        URL of a HashiCorp Vault secret holding the certificate chain and key
+        used to serve files using HTTPS, such as
+        'https://vault:8200/v1/secret/data/web' for a KV version 2 engine. The
+        secret holds them as 'certificate' and 'private_key' or as 'tls.crt'
+        and 'tls.key'. TLS_CERT and TLS_SELF_SIGNED must not be supplied.
+    TRACE_KEY
+        Secret key enabling request tracing. Requests with the key in the
+        'X-Trace-Key' header are traced, logging each stage of the request
+        pipeline they reach, the mount override applied, cache hits and misses
+        and how the URL path was resolved to a file. If not supplied, requests
+        are never traced.
+    TRANSFER_LIMIT
+        Number of simultaneous requests each client IP address may make, such
+        as a download manager opening many parallel connections. Requests
+        beyond the limit are refused with 'TOO MANY REQUESTS' until one of the
+        transfers of the client finishes. Default value is '0' (disabled).
+    TRANSFER_LIMIT_PER_CONNECTION
+        Number of simultaneous requests on each connection, limiting the
+        streams of HTTP/2 clients. Default value is '0' (disabled).
     URL_PREFIX
         The prefix to use in the URL path. If supplied, then the prefix must
         start with a forward-slash and NOT end with a forward-slash. If not
         supplied then no prefix is used.
+    USAGE
+        When set to 'true', the requests and response bytes of each host and
+        the longest of USAGE_PREFIXES containing the path, or '/' if none
+        does, are served as JSON from USAGE_PATH, after AUTH and POLICY are
+        applied. Default value is 'false'.
+    USAGE_PATH
+        The URL path of the usage report. Default value is '/__usage'.
+    USAGE_PREFIXES
+        Comma-separated URL path prefixes usage is accounted by, such as
+        '/team-a,/team-b'. If not supplied, usage is accounted by host only.
+    USAGE_REPORT_INTERVAL
+        How often usage since the previous report is logged, one line for each
+        host and prefix, such as '24h' for a daily report. Default value is
+        '0s' (disabled).
+    USAGE_STATE
+        File usage is saved to every minute and loaded from at start, so
+        totals continue across restarts. If not supplied, usage is kept in
+        memory only.
+    USER_AGENT_ALLOW
+        Comma-separated list of rules in the form '[/path/prefix=]pattern',
+        where pattern is a regular expression matched against the User-Agent
+        header. If any rule applies to the requested path, the User-Agent must
+        match one of the applicable rules or 'FORBIDDEN' is returned. Rules
+        without a prefix apply to all paths. If not supplied, all User-Agents
+        are allowed.
+    USER_AGENT_DENY
+        Comma-separated list of rules in the same form as USER_AGENT_ALLOW.
+        Requests with a User-Agent matching an applicable rule receive
+        'FORBIDDEN' and are logged. Takes priority over USER_AGENT_ALLOW. If not
+        supplied, no User-Agent is denied.
+    VIDEO_BURST
+        Number of bytes of each video stream, a file with a 'video/' MIME type
+        such as MP4 or WebM, sent at full speed before the stream is throttled
+        to VIDEO_RATE, so players start quickly. Each seek starts a new stream.
+        Default value is 0.
+    VIDEO_PRESET
+        When set to 'true', HLS and DASH playlists ('.m3u8', '.mpd') and
+        segments (such as '.ts' and '.m4s') are served with their content types
+        and a Cache-Control header keeping playlists for
+        VIDEO_PRESET_PLAYLIST_MAX_AGE and segments for
+        VIDEO_PRESET_SEGMENT_MAX_AGE, so static packaging output can be played
+        directly. Error responses are not kept. Takes priority over HEADERS and
+        CACHE_CONTROL for these files. Default value is 'false'.
+    VIDEO_PRESET_CORS_ORIGIN
+        Origin allowed to fetch playlists and segments when VIDEO_PRESET is
+        'true', such as '*' or 'https://player.example.com'. CORS preflight
+        requests are answered and ranges may be requested. If not supplied, no
+        CORS headers are set.
+    VIDEO_PRESET_PLAYLIST_MAX_AGE
+        Duration playlists are kept in caches when VIDEO_PRESET is 'true'. Keep
+        it short for live streams. Zero revalidates every request. Default
+        value is '1s'.
+    VIDEO_PRESET_SEGMENT_MAX_AGE
+        Duration segments are kept in caches when VIDEO_PRESET is 'true'. Zero
+        revalidates every request. Default value is '24h'.
+    VIDEO_RATE
+        Number of bytes per second each video stream is throttled to after
+        VIDEO_BURST, so clients do not download whole videos they may not
+        watch. Ranges are served as for other files. Streams, seeks and bytes
+        of each video are recorded when METRICS is 'true'. Default value is 0,
+        for unthrottled video.
+    WARMUP
+        Comma-separated list of files and folders (e.g. '/index.html,/assets')
+        read at startup, so they are in the page cache of the operating system
+        before they are first requested. Folders are read recursively. Files
+        are read in the background while requests are served. If not supplied,
+        no named files are read.
+    WARMUP_RECENT
+        Number of the most recently modified files in FOLDER read at startup in
+        the same way as WARMUP. Default value is '0' (disabled).
+    WATCH_INTERVAL
+        Duration (e.g. '30s') between checks of FOLDER for changed files when
+        PURGE_WEBHOOK or CDN_PURGE is supplied, OPEN_FILE_CACHE_SIZE is
+        positive, EVENTS or SEARCH_INDEX is enabled or NOTIFY_EVENTS includes
+        'first-download', and must then be positive. Default value is '10s'.
+    WELL_KNOWN_ACME_FOLDER
+        Folder of ACME HTTP-01 challenge tokens, such as the webroot of
+        certbot, served from '/.well-known/acme-challenge/' before
+        authentication and regardless of URL_PREFIX, so certificates can be
+        issued for hosts serving private files. If not supplied, challenges
+        are served from FOLDER as other files.
+    WELL_KNOWN_PASSTHROUGH
+        Comma-separated list of names within '/.well-known/' (e.g.
+        'apple-app-site-association,assetlinks.json,matrix') served directly
+        from the '.well-known' folder of FOLDER, before authentication, policies
+        and other rules and regardless of URL_PREFIX. Well-known URIs such as
+        'apple-app-site-association' are always served with the content type
+        their clients expect, despite having no extension. If not supplied,
+        well-known URIs are served as other files.
+    WELL_KNOWN_REDIRECTS
+        Comma-separated list of redirects in the form 'name=URL', where name is
+        the path within '/.well-known/' and URL is a path or an 'http://' or
+        'https://' URL (e.g. 'caldav=/dav/,carddav=/dav/'). Requests are
+        redirected with 'TEMPORARY REDIRECT', keeping their method. If not
+        supplied, no well-known URI is redirected.
 
 CONFIGURATION FILE
     Configuration can also managed used a YAML configuration file. To select the
     configuration values using the YAML file, pass in the path to the file using
     the appropriate flags (-c, --config). Environment variables take priority
-    over the configuration file. The following is an example configuration using
-    the default values.
+    over the configuration file. Files ending in '.json' are read as JSON and
+    files ending in '.toml' as TOML, using the same keys, with durations
+    written as strings such as '1m30s'. Within the file, '${VAR}' is replaced by the
+    value of the environment variable VAR, which must be set, and
+    '${VAR:-fallback}' by the fallback when VAR is unset or empty, so secrets
+    can come from the environment. Write '$${' for a literal '${'. The
+    'include' list names further files to load after the file, relative to
+    it, such as 'conf.d/*.yml'. Globs match files in name order and may match
+    nothing. Options set by included files replace earlier values, except
+    'overrides', 'plugins' and 'tenants' which are appended. The following is
+    an example configuration using the default values.
 
     Example config.yml with defaults:
     ----------------------------------------------------------------------------
+    access-log-exclude: []
+    access-log-fields: []
+    access-log-hash-key: ""
+    access-log-sample: 1
+    alert-min-requests: 20
+    alert-window: 1m0s
+    alerts: []
+    audit-log: ""
+    auth-realms: []
+    cache-control: ""
+    cache-control-s-maxage: 0s
+    cache-control-stale-if-error: 0s
+    cache-control-stale-while-revalidate: 0s
+    cache-ignore-query: []
+    cache-max-entry-size: 1048576
+    cache-max-size: 0
+    cache-ttl: 1m0s
+    canary-folder: ""
+    canary-percent: 0
+    canary-sticky: cookie
+    cdn-purge: ""
+    cdn-purge-base-url: ""
+    cdn-purge-id: ""
+    cdn-purge-token: ""
+    checksum-state: ""
+    checksum-workers: 0
+    checksums: []
+    config-dump: false
+    config-dump-path: /__config
+    content-types: []
+    copy-buffer-size: 32768
+    cors: []
+    cross-origin-embedder-policy: ""
+    cross-origin-opener-policy: ""
+    cross-origin-resource-policy: ""
     debug: false
+    etag: none
+    etag-manifest: ""
+    events: false
+    events-path: /__events
     folder: /web
+    geoip-allow: []
+    geoip-deny: []
+    geoip-folder: ""
+    headers: []
     host: ""
+    image-resize: false
+    image-resize-cache: ""
+    image-resize-cache-max-size: 268435456
+    image-resize-max-pixels: 40000000
+    image-resize-max-size: 2048
+    include: []
+    inject-body: ""
+    inject-head: ""
+    listeners: []
+    lockout-ban-time: 15m0s
+    lockout-path: /__lockout
+    lockout-threshold: 0
+    lockout-window: 5m0s
+    log-output: ""
+    metadata: false
+    metrics: false
+    metrics-path: /metrics
+    minify: false
+    mmap-min-size: 0
+    noise: ""
+    noise-paths:
+    - /favicon.ico
+    - /apple-touch-icon*.png
+    notify-auth-failures: 10
+    notify-events:
+    - first-download
+    - auth-failures
+    - server-errors
+    - alerts
+    notify-interval: 10s
+    notify-server-errors: 10
+    notify-webhook: ""
+    notify-window: 1m0s
+    open-file-cache-size: 0
+    overrides: []
+    path-normalization: "off"
+    permissions-policy: []
+    plugins: []
+    policy: []
     port: 8080
+    presign-credentials: ""
+    presign-expires: 5m0s
+    presign-region: us-east-1
+    presign-url: ""
+    problem-details: false
+    protocols:
+    - h2
+    - http/1.1
+    purge-webhook: ""
+    rate-limit: 0
+    rate-limit-window: 1m0s
+    readv-batch: 0
+    retention-dry-run: false
+    retention-interval: 1h0m0s
+    retention-keep: 0
+    retention-max-age: 0s
+    retention-patterns: []
+    robots-txt: ""
+    roots: false
+    roots-folders: []
+    roots-path: /__roots
+    script: ""
+    search: false
+    search-contents: false
+    search-index: false
+    search-path: /__search
+    security-txt-contact: []
+    security-txt-encryption: ""
+    security-txt-expires: ""
+    security-txt-policy: ""
+    security-txt-preferred-languages: ""
+    server-header: ""
     show-listing: true
+    sitemap: false
+    sitemap-base-url: ""
+    sitemap-exclude: []
+    sitemap-include:
+    - '*.html'
+    - '*.htm'
+    sitemap-interval: 1h0m0s
+    stats: false
+    stats-path: /__stats
+    strip-metadata: false
+    surrogate-key-header: ""
+    surrogate-key-manifest: ""
+    template-vars: []
+    templates: false
+    tenants: []
     tls-cert: ""
     tls-key: ""
+    tls-ocsp-stapling: false
+    tls-reload-interval: 1m0s
+    tls-self-signed: false
+    tls-vault-token: ""
+    tls-vault-url: ""
+    trace-key: ""
+    transfer-limit: 0
+    transfer-limit-per-connection: 0
     url-prefix: ""
+    usage: false
+    usage-path: /__usage
+    usage-prefixes: []
+    usage-report-interval: 0s
+    usage-state: ""
+    user-agent-allow: []
+    user-agent-deny: []
+    video-burst: 0
+    video-preset: false
+    video-preset-cors-origin: ""
+    video-preset-playlist-max-age: 1s
+    video-preset-segment-max-age: 24h0m0s
+    video-rate: 0
+    warmup: []
+    warmup-recent: 0
+    watch-interval: 10s
+    well-known-acme-folder: ""
+    well-known-passthrough: []
+    well-known-redirects: []
+    ----------------------------------------------------------------------------
+
+    Options can be overridden for URL paths within a prefix using 'overrides'
+    in the configuration file. Unset options keep their global values. The
+    longest matching prefix applies.
+
+    Example overrides:
+    ----------------------------------------------------------------------------
+    overrides:
+      - prefix: /internal
+        cache-control: no-store
+        cache-control-s-maxage: 0s
+        etag: strong
+        headers:
+          - "X-Robots-Tag: noindex"
+        permissions-policy:
+          - "camera=self"
+        show-listing: false
+        user-agent-allow: []
+        user-agent-deny: []
+    ----------------------------------------------------------------------------
+
+    Additional ports can be bound with 'listeners' in the configuration file,
+    each serving only the URL paths within its prefixes, or all paths if none
+    are listed. Administrative endpoints, such as METRICS_PATH, STATS_PATH,
+    EVENTS_PATH and SEARCH_PATH, are only served by listeners with 'admin' set
+    to 'true'. Each listener serves its own 'protocols' as for PROTOCOLS,
+    which applies when unset, such as to disable HTTP/2 on one port only or to
+    serve cleartext HTTP/2 ('h2c') to a proxy. HTTP/3 is not supported. HOST
+    and PORT serve all paths and endpoints as before.
+
+    Example listeners:
+    ----------------------------------------------------------------------------
+    listeners:
+      - port: 8081
+        prefixes:
+          - /pub
+      - host: 127.0.0.1
+        port: 9090
+        admin: true
+        protocols:
+          - http/1.1
+    ----------------------------------------------------------------------------
+
+    Teams sharing the server can be isolated with 'tenants' in the
+    configuration file. Requests within the prefix of a tenant, using the
+    longest matching prefix, require the credentials of its 'auth' in the form
+    'scheme:filename' as for AUTH_REALMS, are limited to 'rate-limit' requests
+    of each client per 'rate-limit-window' (RATE_LIMIT_WINDOW if unset) and
+    share 'bandwidth' bytes per second, writing bodies without sendfile. Unset
+    limits do not apply. The limits apply after RATE_LIMIT, TRANSFER_LIMIT and
+    LOCKOUT_THRESHOLD and before AUTH_REALMS. With METRICS enabled, the
+    requests and response bytes of each tenant are counted in
+    'static_file_server_tenant_requests_total' and
+    'static_file_server_tenant_response_bytes_total', labelled by the name
+    of the 'tenant'.
+
+    Example tenants:
+    ----------------------------------------------------------------------------
+    tenants:
+      - name: web
+        prefix: /web
+        auth: key:/etc/static/web-keys.txt
+        rate-limit: 600
+        rate-limit-window: 1m
+      - name: ci
+        prefix: /artifacts/ci
+        bandwidth: 10485760
+    ----------------------------------------------------------------------------
+
+    Applications embedding the server can register middleware by name with
+    'server.RegisterMiddleware'. Each of the 'plugins' in the configuration
+    file places a registered middleware just 'before' or 'after' a pipeline
+    stage, or last if neither is set, passing its 'options' to the factory.
+
+    Example plugins:
+    ----------------------------------------------------------------------------
+    plugins:
+      - name: corp-sso
+        after: auth
+        options:
+          issuer: https://sso.example.com
     ----------------------------------------------------------------------------
 
 USAGE
@@ -136,5 +1186,110 @@ USAGE
         export SHOW_LISTING=false
         static-file-server
             Returns 'NOT FOUND': wget http://my.machine/
+
+        export FOLDER=/var/www
+        export GEOIP_FOLDER=/etc/geoip/GeoLite2-Country-CSV
+        export GEOIP_DENY=KP,IR
+        static-file-server
+            Returns 'FORBIDDEN' to clients from the denied countries.
+
+        export FOLDER=/var/www
+        export USER_AGENT_DENY='(?i)(scrapy|ahrefsbot)'
+        export USER_AGENT_ALLOW='/sub=^deploy-tool/'
+        static-file-server
+            Returns 'FORBIDDEN' to known scrapers and to anything other than
+            'deploy-tool' retrieving files under '/sub'.
+
+        export FOLDER=/var/www/sub
+        export CHECKSUMS=sha256,sha512
+        static-file-server
+            Retrieve checksum with: wget http://my.machine:8080/my.file.sha256
+
+        export FOLDER=/var/www/sub
+        export METADATA=true
+        static-file-server
+            Retrieve metadata with: wget http://my.machine:8080/my.file?meta=1
+
+        export FOLDER=/var/www
+        export HEADERS='X-Frame-Options: DENY
+        /sub=Cache-Control: public, max-age=31536000'
+        static-file-server
+            Returns 'X-Frame-Options: DENY' for all files and caches files
+            under '/sub' for a year.
+
+        export FOLDER=/var/www
+        export POLICY='allow GET,HEAD /sub/** ip=10.0.0.0/8
+        deny * /**'
+        static-file-server
+            Only serves files under '/sub' to clients on the '10.0.0.0/8'
+            network.
+
+        export FOLDER=/var/www
+        export AUTH_REALMS='/sub=basic:/etc/static-file-server/users'
+        static-file-server
+            Requires a user name and password from the file for files under
+            '/sub'.
+
+        export FOLDER=/var/www
+        export AUTH_REALMS='/sub=basic:/etc/static-file-server/users'
+        export AUDIT_LOG=/var/log/static-file-server/audit.log
+        static-file-server
+            Also records each successful and failed login as JSON in the audit
+            log.
+
+        export FOLDER=/var/www
+        export AUTH_REALMS='/sub=basic:/etc/static-file-server/users'
+        export LOCKOUT_THRESHOLD=5
+        static-file-server
+            Bans clients failing to log in 5 times within 5 minutes for 15
+            minutes.
+
+        export FOLDER=/var/www
+        export CROSS_ORIGIN_OPENER_POLICY=same-origin
+        export CROSS_ORIGIN_EMBEDDER_POLICY=require-corp
+        static-file-server
+            Serves the folder cross-origin isolated, as required for
+            SharedArrayBuffer and WebAssembly threads.
+
+        export FOLDER=/var/www
+        export RATE_LIMIT=600
+        static-file-server
+            Allows each client 600 requests per minute, telling clients beyond
+            the limit when to retry.
+
+        export FOLDER=/var/www/current
+        export SURROGATE_KEY_HEADER=Surrogate-Key
+        export CDN_PURGE=fastly
+        export CDN_PURGE_ID=SU1Z0isxPaozGVKXdv0eY
+        export CDN_PURGE_TOKEN=my-fastly-api-token
+        static-file-server
+            Purges the top level folder of each changed file from Fastly and
+            purges everything when '/var/www/current' is linked to a new
+            release.
+
+        export FOLDER=/var/www
+        export TRACE_KEY=my-trace-key
+        static-file-server
+            Explain how a URL is served with:
+            curl -H 'X-Trace-Key: my-trace-key' http://my.machine:8080/file.txt
+
+        export FOLDER=/var/www
+        export TRANSFER_LIMIT=4
+        static-file-server
+            Allows each client 4 downloads at a time, however many connections
+            it opens.
+
+        export FOLDER=/var/www
+        export SEARCH=true
+        static-file-server
+            Find files with: wget 'http://my.machine:8080/__search?q=*.file'
+
+        export FOLDER=/var/www
+        export ROBOTS_TXT=deny
+        export SECURITY_TXT_CONTACT=mailto:security@my.machine
+        export SECURITY_TXT_EXPIRES=2030-01-01T00:00:00Z
+        static-file-server
+            Retrieve generated policies with: wget http://my.machine/robots.txt
+                wget http://my.machine/.well-known/security.txt
 `
 )
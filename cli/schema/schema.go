@@ -0,0 +1,17 @@
+package schema
+
+import (
+	"fmt"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+// Run print operation.
+func Run() error {
+	schema, err := config.Schema()
+	if nil != err {
+		return err
+	}
+	fmt.Println(string(schema))
+	return nil
+}
@@ -0,0 +1,9 @@
+package schema
+
+import "testing"
+
+func TestSchema(t *testing.T) {
+	if err := Run(); nil != err {
+		t.Errorf("While running schema got %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/handle"
+)
+
+var (
+	// Length and concurrency of the load test, overridden to simplify unit
+	// testing.
+	benchDuration = 10 * time.Second
+	benchClients  = 4 * runtime.NumCPU()
+)
+
+// Bench load tests GET requests for the URL path served with the current
+// configuration on a local port, printing the request rate, throughput,
+// status codes and latency percentiles, so changes to the configuration or
+// the server can be compared.
+func Bench(urlPath string) error {
+	return bench(os.Stdout, urlPath, benchDuration, benchClients)
+}
+
+// benchResult of the requests of one client.
+type benchResult struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	bytes     int64
+	errors    int
+}
+
+// bench writes the results of requesting the URL path from the clients until
+// the duration has passed to out.
+func bench(
+	out io.Writer, urlPath string, duration time.Duration, clients int,
+) error {
+	if !strings.HasPrefix(urlPath, "/") {
+		return fmt.Errorf("URL path '%s' must start with '/'", urlPath)
+	}
+	var stats *handle.TransferStats
+	if config.Get.Metrics || config.Get.Stats {
+		stats = handle.NewTransferStats()
+	}
+	handler, err := selectHandler(folderStorage(), stats, nil)
+	if nil != err {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- handle.Serve(ctx, ln, handler)
+	}()
+
+	url := "http://" + ln.Addr().String() + urlPath
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: clients},
+	}
+	results := make([]benchResult, clients)
+	deadline := time.Now().Add(duration)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(result *benchResult) {
+			defer wg.Done()
+			result.statuses = make(map[int]int)
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				resp, err := client.Get(url)
+				if nil != err {
+					result.errors++
+					continue
+				}
+				n, err := io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				if nil != err {
+					result.errors++
+					continue
+				}
+				result.latencies = append(result.latencies, time.Since(start))
+				result.statuses[resp.StatusCode]++
+				result.bytes += n
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	cancel()
+	if err = <-served; nil != err {
+		return err
+	}
+
+	// Combine the results of the clients.
+	total := benchResult{statuses: make(map[int]int)}
+	for _, result := range results {
+		total.latencies = append(total.latencies, result.latencies...)
+		for code, count := range result.statuses {
+			total.statuses[code] += count
+		}
+		total.bytes += result.bytes
+		total.errors += result.errors
+	}
+	sort.Slice(total.latencies, func(i, j int) bool {
+		return total.latencies[i] < total.latencies[j]
+	})
+	seconds := duration.Seconds()
+
+	fmt.Fprintf(out, "GET %s for %v with %d clients\n", urlPath, duration, clients)
+	fmt.Fprintf(
+		out, "Requests: %d (%.1f/s)\n",
+		len(total.latencies), float64(len(total.latencies))/seconds,
+	)
+	fmt.Fprintf(
+		out, "Transferred: %d bytes (%.1f MB/s)\n",
+		total.bytes, float64(total.bytes)/seconds/1e6,
+	)
+	fmt.Fprintf(out, "Errors: %d\n", total.errors)
+	fmt.Fprintln(out, "Status codes:")
+	codes := make([]int, 0, len(total.statuses))
+	for code := range total.statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(
+			out, "    %d %s: %d\n",
+			code, http.StatusText(code), total.statuses[code],
+		)
+	}
+	if 0 == len(total.latencies) {
+		return nil
+	}
+	fmt.Fprintln(out, "Latency:")
+	percentiles := []struct {
+		name     string
+		fraction float64
+	}{
+		{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}, {"max", 1},
+	}
+	for _, p := range percentiles {
+		index := int(p.fraction * float64(len(total.latencies)-1))
+		fmt.Fprintf(out, "    %s: %v\n", p.name, total.latencies[index])
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+func TestBench(t *testing.T) {
+	folder, err := ioutil.TempDir("", "bench")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	if err = ioutil.WriteFile(filepath.Join(folder, "file.txt"), []byte("file"), 0644); nil != err {
+		t.Fatalf("While writing a file got %v", err)
+	}
+
+	config.Get.Folder = folder
+	defer func() {
+		config.Get.Folder = ""
+	}()
+
+	testCases := []struct {
+		name     string
+		urlPath  string
+		isError  bool
+		expected []string
+	}{
+		{"File", "/file.txt", false, []string{
+			"GET /file.txt for 50ms with 2 clients\n",
+			"Errors: 0\n",
+			"    200 OK: ",
+			"    p99: ",
+		}},
+		{"Missing", "/missing.txt", false, []string{
+			"    404 Not Found: ",
+		}},
+		{"Relative", "file.txt", true, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := bench(&out, tc.urlPath, 50*time.Millisecond, 2)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			for _, expected := range tc.expected {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected '%s' in '%s'", expected, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/handle"
+)
+
+// cacheHeaders reported by CheckCacheHeaders, in the order they are printed.
+var cacheHeaders = []string{
+	"Cache-Control",
+	"Expires",
+	"ETag",
+	"Last-Modified",
+	"Vary",
+	"Surrogate-Key",
+	"Cache-Tag",
+}
+
+// CheckCacheHeaders prints the caching headers a GET request for the URL path
+// would be answered with by the current configuration, without starting the
+// server, and whether a conditional request revalidates the response. The
+// output is stable, so it can be compared against an expected copy in CI. An
+// error is returned if the path is not served successfully.
+func CheckCacheHeaders(urlPath string) error {
+	return checkCacheHeaders(os.Stdout, urlPath)
+}
+
+// checkCacheHeaders writes the caching headers of the URL path to out.
+func checkCacheHeaders(out io.Writer, urlPath string) error {
+	if !strings.HasPrefix(urlPath, "/") {
+		return fmt.Errorf("URL path '%s' must start with '/'", urlPath)
+	}
+	var stats *handle.TransferStats
+	if config.Get.Metrics || config.Get.Stats {
+		stats = handle.NewTransferStats()
+	}
+	handler, err := selectHandler(folderStorage(), stats, nil)
+	if nil != err {
+		return err
+	}
+
+	req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+
+	fmt.Fprintf(out, "GET %s -> %d %s\n", urlPath, recorder.Code, http.StatusText(recorder.Code))
+	header := recorder.Header()
+	for _, name := range cacheHeaders {
+		for _, value := range header.Values(name) {
+			fmt.Fprintf(out, "%s: %s\n", name, value)
+		}
+	}
+	if http.StatusBadRequest <= recorder.Code {
+		return fmt.Errorf(
+			"GET %s was answered with %d %s",
+			urlPath, recorder.Code, http.StatusText(recorder.Code),
+		)
+	}
+
+	// Revalidate with the validator a cache would send.
+	req = httptest.NewRequest(http.MethodGet, urlPath, nil)
+	validator := "none"
+	if etag := header.Get("ETag"); 0 < len(etag) {
+		validator = "If-None-Match"
+		req.Header.Set(validator, etag)
+	} else if modified := header.Get("Last-Modified"); 0 < len(modified) {
+		validator = "If-Modified-Since"
+		req.Header.Set(validator, modified)
+	}
+	if "none" == validator {
+		fmt.Fprintln(out, "Revalidation: none")
+		return nil
+	}
+	recorder = httptest.NewRecorder()
+	handler(recorder, req)
+	fmt.Fprintf(
+		out, "Revalidation: %s -> %d %s\n",
+		validator, recorder.Code, http.StatusText(recorder.Code),
+	)
+	return nil
+}
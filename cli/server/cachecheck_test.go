@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+func TestCheckCacheHeaders(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cachecheck")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	if err = ioutil.WriteFile(filepath.Join(folder, "file.txt"), []byte("file"), 0644); nil != err {
+		t.Fatalf("While writing a file got %v", err)
+	}
+
+	config.Get.Folder = folder
+	config.Get.CacheControl = "public, max-age=60"
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.CacheControl = ""
+	}()
+
+	testCases := []struct {
+		name     string
+		urlPath  string
+		isError  bool
+		expected []string
+	}{
+		{"File", "/file.txt", false, []string{
+			"GET /file.txt -> 200 OK\n",
+			"Cache-Control: public, max-age=60\n",
+			"Last-Modified: ",
+			"Revalidation: If-Modified-Since -> 304 Not Modified\n",
+		}},
+		{"Missing", "/missing.txt", true, []string{
+			"GET /missing.txt -> 404 Not Found\n",
+		}},
+		{"Relative", "file.txt", true, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := checkCacheHeaders(&out, tc.urlPath); tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			for _, expected := range tc.expected {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected '%s' in '%s'", expected, out.String())
+				}
+			}
+			if strings.Contains(out.String(), "Content-Type") {
+				t.Errorf("Expected only caching headers in '%s'", out.String())
+			}
+		})
+	}
+}
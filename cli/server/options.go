@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/halverneus/static-file-server/handle"
+)
+
+// Option customizes the server for applications embedding it with RunWith.
+type Option func(*options)
+
+// options collected from each Option.
+type options struct {
+	configure []handle.ServerFunc
+	ctx       context.Context
+	hooks     *handle.Hooks
+	listener  net.Listener
+	routes    handle.Routes
+	stages    []func(*handle.Pipeline) error
+	storage   handle.Storage
+	tlsConfig *tls.Config
+}
+
+// WithServer customizes the HTTP server before it starts serving, such as
+// setting ConnState hooks, BaseContext, ErrorLog or protocol options. May be
+// given multiple times, applied in order.
+func WithServer(configure handle.ServerFunc) Option {
+	return func(opts *options) {
+		opts.configure = append(opts.configure, configure)
+	}
+}
+
+// WithContext stops serving when the context is done. Only used together with
+// WithListener.
+func WithContext(ctx context.Context) Option {
+	return func(opts *options) {
+		opts.ctx = ctx
+	}
+}
+
+// WithHooks calls the hooks around every request served.
+func WithHooks(hooks handle.Hooks) Option {
+	return func(opts *options) {
+		opts.hooks = &hooks
+	}
+}
+
+// WithListener serves requests accepted by the listener instead of listening
+// on the configured host and port.
+func WithListener(ln net.Listener) Option {
+	return func(opts *options) {
+		opts.listener = ln
+	}
+}
+
+// WithTLSConfig serves with encryption configured by the TLS configuration,
+// such as one supplied by a certificate manager. 'TLS_CERT' and 'TLS_KEY' are
+// optional when the configuration provides certificates.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(opts *options) {
+		opts.tlsConfig = tlsConfig
+	}
+}
+
+// WithRoute serves requests for the method, such as PUT for uploads or a
+// WebDAV verb, with the handler once they pass through the pipeline. Routes for
+// GET or HEAD replace serving files. May be given multiple times.
+func WithRoute(method string, handler http.HandlerFunc) Option {
+	return func(opts *options) {
+		if nil == opts.routes {
+			opts.routes = make(handle.Routes)
+		}
+		opts.routes[method] = handler
+	}
+}
+
+// WithStorage serves files from the storage instead of the configured folder.
+func WithStorage(storage handle.Storage) Option {
+	return func(opts *options) {
+		opts.storage = storage
+	}
+}
+
+// WithStageBefore inserts the named middleware into the pipeline so that it
+// receives requests before the stage, such as StageCache.
+func WithStageBefore(stage, name string, middleware handle.Middleware) Option {
+	return func(opts *options) {
+		opts.stages = append(opts.stages, func(pipeline *handle.Pipeline) error {
+			return pipeline.InsertBefore(stage, name, middleware)
+		})
+	}
+}
+
+// WithStageAfter inserts the named middleware into the pipeline so that it
+// receives requests after the stage, such as StageHeaders.
+func WithStageAfter(stage, name string, middleware handle.Middleware) Option {
+	return func(opts *options) {
+		opts.stages = append(opts.stages, func(pipeline *handle.Pipeline) error {
+			return pipeline.InsertAfter(stage, name, middleware)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/handle"
+)
+
+// MiddlewareFactory returns the middleware of a plugin configured with the
+// options of its entry in 'plugins'.
+type MiddlewareFactory func(options map[string]string) (handle.Middleware, error)
+
+var (
+	pluginsMutex sync.RWMutex
+	plugins      = make(map[string]MiddlewareFactory)
+)
+
+// RegisterMiddleware makes the factory available by name to 'plugins' in the
+// configuration file, so applications embedding the server can ship their own
+// stages, such as proprietary authentication, without changing it. Intended to
+// be called from the init function of a package. Panics if the factory is nil
+// or the name is already registered.
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	pluginsMutex.Lock()
+	defer pluginsMutex.Unlock()
+	if nil == factory {
+		panic("server: RegisterMiddleware factory is nil")
+	}
+	if _, found := plugins[name]; found {
+		panic("server: RegisterMiddleware called twice for " + name)
+	}
+	plugins[name] = factory
+}
+
+// Plugins returns the sorted names of the registered middleware factories.
+func Plugins() []string {
+	pluginsMutex.RLock()
+	defer pluginsMutex.RUnlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// insertPlugins adds the middleware of each configured plugin to the pipeline,
+// in the order configured.
+func insertPlugins(pipeline *handle.Pipeline) error {
+	for _, plugin := range config.Get.Plugins {
+		pluginsMutex.RLock()
+		factory, found := plugins[plugin.Name]
+		pluginsMutex.RUnlock()
+		if !found {
+			return fmt.Errorf(
+				"unknown plugin '%s' (registered plugins are '%s')",
+				plugin.Name, strings.Join(Plugins(), "', '"),
+			)
+		}
+		middleware, err := factory(plugin.Options)
+		if nil != err {
+			return fmt.Errorf("while configuring plugin '%s' got %v", plugin.Name, err)
+		}
+		switch {
+		case 0 < len(plugin.Before):
+			err = pipeline.InsertBefore(plugin.Before, plugin.Name, middleware)
+		case 0 < len(plugin.After):
+			err = pipeline.InsertAfter(plugin.After, plugin.Name, middleware)
+		default:
+			err = pipeline.Append(plugin.Name, middleware)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/handle"
+)
+
+// Resolve prints how a GET request for the URL path would be served with the
+// current configuration without starting the server: the response status, the
+// pipeline stages, mount override and policies it passes through, the file it
+// resolves to within the folder and the response headers.
+func Resolve(urlPath string) error {
+	return resolve(os.Stdout, urlPath)
+}
+
+// resolve writes the resolution of the URL path to out.
+func resolve(out io.Writer, urlPath string) error {
+	if !strings.HasPrefix(urlPath, "/") {
+		return fmt.Errorf("URL path '%s' must start with '/'", urlPath)
+	}
+	var stats *handle.TransferStats
+	if config.Get.Metrics || config.Get.Stats {
+		stats = handle.NewTransferStats()
+	}
+	handler, err := selectHandler(folderStorage(), stats, nil)
+	if nil != err {
+		return err
+	}
+
+	req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+	recorder := httptest.NewRecorder()
+	steps := handle.TraceRequest(handler, recorder, req)
+
+	fmt.Fprintf(out, "GET %s -> %d %s\n", urlPath, recorder.Code, http.StatusText(recorder.Code))
+	fmt.Fprintf(out, "Folder: %s\n", config.Get.Folder)
+	fmt.Fprintln(out, "Steps:")
+	for i, step := range steps {
+		fmt.Fprintf(out, "    %d. %s\n", i+1, step)
+	}
+	fmt.Fprintln(out, "Headers:")
+	header := recorder.Header()
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(out, "    %s: %s\n", name, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+func TestResolve(t *testing.T) {
+	folder, err := ioutil.TempDir("", "resolve")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	if err = ioutil.WriteFile(filepath.Join(folder, "file.txt"), []byte("file"), 0644); nil != err {
+		t.Fatalf("While writing a file got %v", err)
+	}
+
+	config.Get.Folder = folder
+	config.Get.Headers = []string{"X-Frame-Options: DENY"}
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.Headers = nil
+	}()
+
+	testCases := []struct {
+		name     string
+		urlPath  string
+		isError  bool
+		expected []string
+	}{
+		{"File", "/file.txt", false, []string{
+			"GET /file.txt -> 200 OK\n",
+			"Folder: " + folder + "\n",
+			"stage 'headers'\n",
+			"resolved '/file.txt' to '/file.txt'\n",
+			"serving file '/file.txt'\n",
+			"    X-Frame-Options: DENY\n",
+		}},
+		{"Missing", "/missing.txt", false, []string{
+			"GET /missing.txt -> 404 Not Found\n",
+			"failed to open '/missing.txt'",
+		}},
+		{"Relative", "file.txt", true, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := resolve(&out, tc.urlPath); tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			for _, expected := range tc.expected {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected '%s' in '%s'", expected, out.String())
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,22 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/halverneus/static-file-server/config"
+	"github.com/halverneus/static-file-server/geoip"
 	"github.com/halverneus/static-file-server/handle"
+	"github.com/halverneus/static-file-server/logging"
+	"github.com/halverneus/static-file-server/metrics"
 )
 
 var (
@@ -16,45 +27,1655 @@ var (
 
 // Run server.
 func Run() error {
+	return RunWith()
+}
+
+// RunWith runs the server customized by the options.
+func RunWith(opts ...Option) error {
+	var settings options
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	// Ship the log to the configured destination.
+	if 0 < len(config.Get.LogOutput) {
+		out, err := logging.Open(config.Get.LogOutput)
+		if nil != err {
+			return err
+		}
+		log.SetFlags(0)
+		log.SetOutput(out)
+	}
+
 	if config.Get.Debug {
 		config.Log()
 	}
+	ctx := settings.ctx
+	if nil == ctx {
+		ctx = context.Background()
+	}
+	// Generate a certificate for testing HTTPS locally, or serve the
+	// certificate files or Vault secret, reloading them when rotated.
+	certFile, keyFile := config.Get.TLSCert, config.Get.TLSKey
+	if nil == settings.tlsConfig {
+		var source handle.CertificateSource
+		switch {
+		case config.Get.TLSSelfSigned:
+			tlsConfig, err := selfSignedConfig()
+			if nil != err {
+				return err
+			}
+			settings.tlsConfig = tlsConfig
+		case 0 < len(config.Get.TLSVaultURL):
+			source = handle.VaultCertificate(
+				config.Get.TLSVaultURL, config.Get.TLSVaultToken,
+			)
+		case 0 < len(certFile):
+			source = handle.CertificateFiles(certFile, keyFile)
+		}
+		if nil != source {
+			reloader, err := handle.NewCertificateReloader(source)
+			if nil != err {
+				return err
+			}
+			go reloader.Watch(ctx, config.Get.TLSReloadInterval)
+			if config.Get.TLSOCSPStapling {
+				go reloader.StapleOCSP(ctx)
+			}
+			settings.tlsConfig = &tls.Config{GetCertificate: reloader.GetCertificate}
+			certFile, keyFile = "", ""
+		}
+	}
+	// Batched reads are only available on Linux builds with the 'readv' tag.
+	if 0 < config.Get.ReadvBatch && !handle.ReadvSupported {
+		log.Printf("Error: READV_BATCH requires a Linux build with '-tags readv', reading files normally\n")
+	}
 	// Choose and set the appropriate, optimized static file serving function.
-	handler := selectHandler()
+	// Serve one of several roots switched at runtime if enabled.
+	storage, folder := settings.storage, ""
+	var roots *handle.Roots
+	if nil == storage && config.Get.Roots {
+		var err error
+		if roots, err = rootsStorage(); nil != err {
+			return err
+		}
+		storage, folder = roots, config.Get.Folder
+	} else if nil == storage {
+		storage, folder = folderStorage(), config.Get.Folder
+	}
+	// Close files kept open once they change.
+	if cache, ok := storage.(*handle.FileCache); ok {
+		go handle.Watch(ctx, cache, config.Get.WatchInterval, cache.Invalidate)
+	}
+	// Serve images without their EXIF and other metadata.
+	if config.Get.StripMetadata {
+		storage = handle.NewMetadataStripper(storage)
+	}
+	// Count connections and transfers if they are reported.
+	var stats *handle.TransferStats
+	if config.Get.Metrics || config.Get.Stats {
+		stats = handle.NewTransferStats()
+		settings.configure = append(settings.configure, stats.ServerFunc())
+	}
+	// Compute checksums ahead of requests, persisting them across restarts.
+	stages := settings.stages
+	if 0 < len(config.Get.Checksums) &&
+		(0 < config.Get.ChecksumWorkers || 0 < len(config.Get.ChecksumState)) {
+		index, err := checksumIndex(ctx, storage)
+		if nil != err {
+			return err
+		}
+		defer index.Close()
+		middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithChecksumIndex(serve, index, config.Get.URLPrefix)
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageChecksums, middleware)
+			},
+		}, stages...)
+	}
+	// Notify access events to the webhook in batches.
+	var notifier *handle.Notifier
+	if 0 < len(config.Get.NotifyWebhook) {
+		notifier = handle.NewNotifier(config.Get.NotifyWebhook, handle.NotifyRules{
+			Events:       config.Get.NotifyEvents,
+			AuthFailures: config.Get.NotifyAuthFailures,
+			ServerErrors: config.Get.NotifyServerErrors,
+			Window:       config.Get.NotifyWindow,
+		})
+		go notifier.Run(ctx, config.Get.NotifyInterval)
+		if contains(config.Get.NotifyEvents, handle.NotifyFirstDownload) {
+			go handle.Watch(ctx, storage, config.Get.WatchInterval, notifier.Changed)
+		}
+		middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithNotifier(serve, notifier, config.Get.URLPrefix)
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageNotify, middleware)
+			},
+		}, stages...)
+	}
+	// Raise alerts when a status class exceeds its share of responses.
+	if 0 < len(config.Get.Alerts) {
+		rules := make([]handle.AlertRule, len(config.Get.Alerts))
+		for index, rule := range config.Get.Alerts {
+			var err error
+			if rules[index], err = handle.ParseAlertRule(rule); nil != err {
+				return err
+			}
+		}
+		alerts := handle.NewAlerts(
+			rules, config.Get.AlertWindow, config.Get.AlertMinRequests, notifier,
+		)
+		go alerts.Run(ctx)
+		middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithAlerts(serve, alerts)
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageAlerts, middleware)
+			},
+		}, stages...)
+	}
+	// Persist usage across restarts and report it periodically.
+	if config.Get.Usage &&
+		(0 < len(config.Get.UsageState) || 0 < config.Get.UsageReportInterval) {
+		usage, err := usageAccounting(ctx)
+		if nil != err {
+			return err
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageUsage, usageMiddleware(usage))
+			},
+		}, stages...)
+	}
+	// Walk the folder again for the sitemap once files change.
+	if config.Get.Sitemap && 0 < config.Get.WatchInterval {
+		sitemap := sitemapGenerator(storage)
+		go handle.Watch(ctx, storage, config.Get.WatchInterval, sitemap.Changed)
+		middleware, err := generatedFiles(storage, sitemap)
+		if nil != err {
+			return err
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageGenerated, middleware)
+			},
+		}, stages...)
+	}
+	// Stream the changes of watched files to subscribers.
+	if config.Get.Events {
+		events := handle.NewChangeEvents(storage, config.Get.URLPrefix)
+		go handle.Watch(ctx, storage, config.Get.WatchInterval, events.Changed)
+		middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithEndpoint(serve, config.Get.EventsPath, events.Handler())
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageEvents, middleware)
+			},
+		}, stages...)
+	}
+	// Answer searches from a full-text index built in the background and
+	// updated as files change.
+	if config.Get.Search && config.Get.SearchIndex {
+		index := handle.NewSearchIndex(storage)
+		interval := config.Get.WatchInterval
+		go func() {
+			start := time.Now()
+			if err := index.Build(ctx); nil != err {
+				if nil == ctx.Err() {
+					log.Printf("Error: while indexing for search got %v\n", err)
+				}
+			} else {
+				log.Printf(
+					"Indexed %d files for search in %v\n",
+					index.Len(), time.Since(start).Round(time.Millisecond),
+				)
+			}
+			handle.Watch(ctx, storage, interval, index.Changed)
+		}()
+		middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithSearchIndex(
+				serve, config.Get.SearchPath, index, config.Get.URLPrefix,
+			)
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageSearch, middleware)
+			},
+		}, stages...)
+	}
+	// Activate roots from the roots path.
+	if nil != roots {
+		middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithEndpoint(serve, config.Get.RootsPath, roots.Handler())
+		}
+		stages = append([]func(*handle.Pipeline) error{
+			func(pipeline *handle.Pipeline) error {
+				return pipeline.Replace(StageRoots, middleware)
+			},
+		}, stages...)
+	}
+	handler, err := selectHandler(storage, stats, settings.routes, stages...)
+	if nil != err {
+		return err
+	}
+	if nil != settings.hooks {
+		handler = handle.WithHooks(handler, *settings.hooks)
+	}
+	if err = watchStorage(ctx, storage, folder); nil != err {
+		return err
+	}
+	warmup(ctx, storage)
+	retain(ctx, folder)
 
-	// Serve files over HTTP or HTTPS based on paths to TLS files being
-	// provided.
-	listener := selectListener()
+	// Serve on the supplied listener until the context is done.
+	if nil != settings.listener {
+		ln := settings.listener
+		if nil != settings.tlsConfig {
+			ln = tls.NewListener(ln, settings.tlsConfig)
+		}
+		return handle.Serve(ctx, ln, handler, withProtocols(settings.configure, nil)...)
+	}
+
+	// Serve files over HTTP or HTTPS based on the TLS configuration or paths
+	// to TLS files being provided.
+	var listener handle.ListenerFunc
+	configure := withProtocols(settings.configure, nil)
+	switch {
+	case nil != settings.tlsConfig:
+		listener = handle.TLSConfigListening(
+			settings.tlsConfig, certFile, keyFile, configure...,
+		)
+	case 0 < len(configure):
+		listener = handle.ServerListening(configure...)
+	default:
+		listener = selectListener()
+	}
 
 	binding := fmt.Sprintf("%s:%d", config.Get.Host, config.Get.Port)
-	return listener(binding, handler)
+	if 0 == len(config.Get.Listeners) {
+		return listener(binding, handler)
+	}
+
+	// Serve each additional listener with only its paths, returning the first
+	// error of any listener.
+	errs := make(chan error, 1+len(config.Get.Listeners))
+	go func() {
+		errs <- listener(binding, handler)
+	}()
+	for _, extra := range config.Get.Listeners {
+		configure := withProtocols(settings.configure, extra.Protocols)
+		serve := handle.ServerListening(configure...)
+		if nil != settings.tlsConfig {
+			serve = handle.TLSConfigListening(
+				settings.tlsConfig, certFile, keyFile, configure...,
+			)
+		}
+		go func(serve handle.ListenerFunc, extra config.Listener) {
+			binding := fmt.Sprintf("%s:%d", extra.Host, extra.Port)
+			errs <- serve(binding, listenerHandler(handler, extra))
+		}(serve, extra)
+	}
+	return <-errs
 }
 
-// handlerSelector returns the appropriate request handler based on
-// configuration.
-func handlerSelector() (handler http.HandlerFunc) {
-	var serveFileHandler handle.FileServerFunc
-	serveFileHandler = http.ServeFile
+// folderStorage returns the storage of the configured folder, reading large
+// files through memory maps and keeping popular files open if enabled.
+func folderStorage() handle.Storage {
+	storage := dirStorage(config.Get.Folder)
+	if 0 < config.Get.OpenFileCacheSize {
+		storage = handle.NewFileCache(storage, config.Get.OpenFileCacheSize)
+	}
+	return storage
+}
+
+// dirStorage returns the storage of the folder, reading large files through
+// memory maps or in batches of preadv system calls if configured.
+func dirStorage(folder string) handle.Storage {
+	if 0 < config.Get.MmapMinSize {
+		return handle.MmapDir{
+			Dir:     handle.Dir(folder),
+			MinSize: int64(config.Get.MmapMinSize),
+		}
+	}
+	if 0 < config.Get.ReadvBatch && handle.ReadvSupported {
+		return handle.ReadvDir{Dir: handle.Dir(folder), Batch: config.Get.ReadvBatch}
+	}
+	return handle.Dir(folder)
+}
+
+// rootsStorage returns the roots serving the configured folder as the root
+// 'default' until one of the roots of ROOTS_FOLDERS is activated.
+func rootsStorage() (*handle.Roots, error) {
+	roots := handle.NewRoots("default", config.Get.Folder, dirStorage)
+	for _, root := range config.Get.RootsFolders {
+		parts := strings.SplitN(root, "=", 2)
+		if 2 != len(parts) {
+			return nil, fmt.Errorf("invalid root '%s': expected 'name=folder'", root)
+		}
+		if err := roots.Register(parts[0], parts[1]); nil != err {
+			return nil, err
+		}
+	}
+	return roots, nil
+}
+
+// withProtocols returns the server functions, stopping advertising HTTP/2 if
+// it is not among the protocols, or PROTOCOLS if none are listed, and serving
+// cleartext HTTP/2 if 'h2c' is.
+func withProtocols(
+	configure []handle.ServerFunc, protocols []string,
+) []handle.ServerFunc {
+	if 0 == len(protocols) {
+		protocols = config.Get.Protocols
+	}
+	if contains(protocols, "h2") && !contains(protocols, "h2c") {
+		return configure
+	}
+	return append(configure[:len(configure):len(configure)], handle.WithProtocols(protocols...))
+}
+
+// listenerHandler returns the handler serving only the paths of the
+// additional listener, hiding the administrative endpoints unless the listener
+// is for administration.
+func listenerHandler(handler http.HandlerFunc, listener config.Listener) http.HandlerFunc {
+	admin := adminPaths()
+	if !listener.Admin {
+		return handle.WithPaths(handler, listener.Prefixes, admin)
+	}
+	prefixes := listener.Prefixes
+	if 0 < len(prefixes) {
+		prefixes = append(append([]string(nil), prefixes...), admin...)
+	}
+	return handle.WithPaths(handle.WithAdminListener(handler), prefixes, nil)
+}
+
+// adminPaths returns the paths of the enabled administrative endpoints.
+func adminPaths() (paths []string) {
+	endpoints := []struct {
+		enabled bool
+		path    string
+	}{
+		{config.Get.Metrics, config.Get.MetricsPath},
+		{config.Get.Events, config.Get.EventsPath},
+		{0 < config.Get.LockoutThreshold, config.Get.LockoutPath},
+		{config.Get.Search, config.Get.SearchPath},
+		{config.Get.Stats, config.Get.StatsPath},
+		{config.Get.ConfigDump, config.Get.ConfigDumpPath},
+		{config.Get.Roots, config.Get.RootsPath},
+		{config.Get.Usage, config.Get.UsagePath},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.enabled {
+			paths = append(paths, endpoint.path)
+		}
+	}
+	return
+}
+
+// Names of the pipeline stages wrapping the file server, in the order requests
+// pass through them. Disabled stages pass requests through. Applications
+// embedding the server can insert stages relative to these with
+// WithStageBefore and WithStageAfter.
+const (
+	// StageTrace traces requests carrying TRACE_KEY.
+	StageTrace = "trace"
+	// StageServerHeader applies SERVER_HEADER to every response.
+	StageServerHeader = "server-header"
+	// StageProblems renders error responses as problem details when
+	// PROBLEM_DETAILS is enabled.
+	StageProblems = "problems"
+	// StageMetrics records metrics and serves them from METRICS_PATH.
+	StageMetrics = "metrics"
+	// StagePaths refuses or normalizes ambiguous URL paths as set by
+	// PATH_NORMALIZATION.
+	StagePaths = "paths"
+	// StageNotify notifies access events to NOTIFY_WEBHOOK.
+	StageNotify = "notify"
+	// StageAlerts counts the responses of later stages for ALERTS.
+	StageAlerts = "alerts"
+	// StageAudit records authentication and authorization decisions to
+	// AUDIT_LOG.
+	StageAudit = "audit"
+	// StageGeoIP resolves client countries and applies GEOIP_* rules.
+	StageGeoIP = "geoip"
+	// StageRateLimit limits clients to RATE_LIMIT requests per
+	// RATE_LIMIT_WINDOW.
+	StageRateLimit = "rate-limit"
+	// StageTransferLimit limits clients to TRANSFER_LIMIT and connections to
+	// TRANSFER_LIMIT_PER_CONNECTION simultaneous requests.
+	StageTransferLimit = "transfer-limit"
+	// StageVideo sends VIDEO_BURST bytes of each video stream at full speed,
+	// throttles the rest to VIDEO_RATE and records per-stream metrics.
+	StageVideo = "video"
+	// StageCORS applies CORS rules and answers preflight requests before they
+	// reach authentication.
+	StageCORS = "cors"
+	// StageWellKnown types, redirects and serves '/.well-known/' URIs before
+	// they reach authentication.
+	StageWellKnown = "well-known"
+	// StageLockout bans clients after LOCKOUT_THRESHOLD failed
+	// authentication attempts.
+	StageLockout = "lockout"
+	// StageTenants applies the auth and limits of each of the tenants and
+	// accounts their usage.
+	StageTenants = "tenants"
+	// StageAuth authenticates clients of AUTH_REALMS.
+	StageAuth = "auth"
+	// StagePolicy applies POLICY rules.
+	StagePolicy = "policy"
+	// StageScript applies the statements of SCRIPT.
+	StageScript = "script"
+	// StageAdmin serves administrative endpoints, such as LOCKOUT_PATH and
+	// STATS_PATH, to clients allowed by the earlier stages.
+	StageAdmin = "admin"
+	// StageRoots activates ROOTS from ROOTS_PATH for clients authenticated by
+	// the earlier stages or on an admin listener.
+	StageRoots = "roots"
+	// StageUsage accounts the usage of each host and USAGE_PREFIXES and
+	// serves it from USAGE_PATH.
+	StageUsage = "usage"
+	// StageEvents streams file changes from EVENTS_PATH.
+	StageEvents = "events"
+	// StageUserAgent applies USER_AGENT_* rules.
+	StageUserAgent = "user-agent"
+	// StageCanary serves CANARY_PERCENT of clients from CANARY_FOLDER through
+	// their own copy of the later stages.
+	StageCanary = "canary"
+	// StageHeaders applies HEADERS to responses.
+	StageHeaders = "headers"
+	// StageVideoPreset sets the content types, Cache-Control and CORS headers
+	// of HLS and DASH files when VIDEO_PRESET is enabled.
+	StageVideoPreset = "video-preset"
+	// StageContentTypes applies the CONTENT_TYPES of files.
+	StageContentTypes = "content-types"
+	// StageSurrogateKeys adds surrogate keys in SURROGATE_KEY_HEADER.
+	StageSurrogateKeys = "surrogate-keys"
+	// StageSnippets injects INJECT_HEAD and INJECT_BODY into HTML responses.
+	StageSnippets = "snippets"
+	// StageMinify minifies HTML, CSS and JavaScript responses.
+	StageMinify = "minify"
+	// StageResize serves images resized when IMAGE_RESIZE is enabled.
+	StageResize = "resize"
+	// StageGenerated serves generated robots.txt, security.txt and sitemap.
+	StageGenerated = "generated"
+	// StageNoise answers requests for missing NOISE_PATHS with NOISE.
+	StageNoise = "noise"
+	// StageTemplates renders template files with TEMPLATE_VARS.
+	StageTemplates = "templates"
+	// StageSearch serves search results from SEARCH_PATH.
+	StageSearch = "search"
+	// StageMetadata serves file metadata as JSON.
+	StageMetadata = "metadata"
+	// StageChecksums serves computed checksums.
+	StageChecksums = "checksums"
+	// StageCache keeps responses in memory.
+	StageCache = "cache"
+	// StageETag applies the ETAG strategy to files.
+	StageETag = "etag"
+	// StageIgnoreIndex hides folder listings and index files.
+	StageIgnoreIndex = "ignore-index"
+)
+
+// handlerSelector returns the appropriate request handler, serving files from
+// the storage, based on configuration. Requests passing through the pipeline
+// are routed by method, serving files to GET and HEAD requests unless the
+// routes replace them. The pipeline of stages is customized by each function
+// in order before wrapping the routes.
+func handlerSelector(
+	storage handle.Storage,
+	stats *handle.TransferStats,
+	routes handle.Routes,
+	customize ...func(*handle.Pipeline) error,
+) (handler http.HandlerFunc, err error) {
+	handle.SetCopyBufferSize(config.Get.CopyBufferSize)
+	if handler, err = filesHandler(storage, routes); nil != err {
+		return
+	}
+
+	var pipeline *handle.Pipeline
+	if pipeline, err = pipelineSelector(storage, stats); nil != err {
+		return
+	}
+	if 0 < len(config.Get.CanaryFolder) {
+		var canary http.HandlerFunc
+		if canary, err = canaryHandler(routes); nil != err {
+			return
+		}
+		split := handle.Canary{
+			Percent: config.Get.CanaryPercent,
+			Sticky:  config.Get.CanarySticky,
+		}
+		pipeline.Replace(StageCanary, func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithCanary(serve, canary, split)
+		})
+	}
+	if err = insertPlugins(pipeline); nil != err {
+		return
+	}
+	for _, fn := range customize {
+		if err = fn(pipeline); nil != err {
+			return
+		}
+	}
+	return pipeline.Then(handler), nil
+}
+
+// filesHandler returns the handler serving files from the storage, routed by
+// method.
+func filesHandler(
+	storage handle.Storage, routes handle.Routes,
+) (handler http.HandlerFunc, err error) {
+	serveFileHandler := handle.FileServer(storage)
+	// Redirect to presigned URLs of the objects rather than serving files.
+	if 0 < len(config.Get.PresignURL) {
+		serveFileHandler = handle.PresignedRedirect(handle.Presigner{
+			BaseURL:     config.Get.PresignURL,
+			Credentials: config.Get.PresignCredentials,
+			Region:      config.Get.PresignRegion,
+			Expires:     config.Get.PresignExpires,
+		})
+	}
 	if config.Get.Debug {
-		serveFileHandler = handle.WithLogging(serveFileHandler)
+		fields, err := handle.ParseLogFields(
+			config.Get.AccessLogFields, config.Get.AccessLogHashKey,
+		)
+		if nil != err {
+			return nil, err
+		}
+		if 1 < config.Get.AccessLogSample || 0 < len(config.Get.AccessLogExclude) ||
+			fields.Enabled() {
+			serveFileHandler = handle.WithLogFilter(serveFileHandler, handle.LogFilter{
+				SampleRate: config.Get.AccessLogSample,
+				Exclude:    config.Get.AccessLogExclude,
+				Fields:     fields,
+			})
+		} else {
+			serveFileHandler = handle.WithLogging(serveFileHandler)
+		}
 	}
 
 	// Choose and set the appropriate, optimized static file serving function.
 	if 0 == len(config.Get.URLPrefix) {
-		handler = handle.Basic(serveFileHandler, config.Get.Folder)
+		handler = handle.Basic(serveFileHandler, "")
 	} else {
-		handler = handle.Prefix(
-			serveFileHandler,
-			config.Get.Folder,
-			config.Get.URLPrefix,
+		handler = handle.Prefix(serveFileHandler, "", config.Get.URLPrefix)
+	}
+
+	methods := handle.FileRoutes(handler)
+	for method, route := range routes {
+		methods[method] = route
+	}
+	return methods.Handler(), nil
+}
+
+// canaryHandler returns the handler serving the files of the canary release
+// in CANARY_FOLDER through their own content stages. Stages inserted by
+// plugins and options apply to the stable release only.
+func canaryHandler(routes handle.Routes) (http.HandlerFunc, error) {
+	var storage handle.Storage = handle.Dir(config.Get.CanaryFolder)
+	if config.Get.StripMetadata {
+		storage = handle.NewMetadataStripper(storage)
+	}
+	files, err := filesHandler(storage, routes)
+	if nil != err {
+		return nil, err
+	}
+	stages, err := contentStages(storage)
+	if nil != err {
+		return nil, err
+	}
+	return handle.NewPipeline(stages...).Then(files), nil
+}
+
+// pipelineSelector returns the pipeline of stages with the middleware enabled
+// by configuration.
+func pipelineSelector(
+	storage handle.Storage, stats *handle.TransferStats,
+) (*handle.Pipeline, error) {
+	var stages []handle.Stage
+	add := func(name string, middleware handle.Middleware) {
+		stages = append(stages, handle.Stage{Name: name, Middleware: middleware})
+	}
+
+	// Trace requests carrying the trace key through the remaining stages.
+	var middleware handle.Middleware
+	if 0 < len(config.Get.TraceKey) {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithTrace(serve, config.Get.TraceKey)
+		}
+	}
+	add(StageTrace, middleware)
+
+	// Set or remove the identification of the server in every response.
+	middleware = nil
+	if 0 < len(config.Get.ServerHeader) {
+		value := config.Get.ServerHeader
+		if "-" == value {
+			value = ""
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithServerHeader(serve, value)
+		}
+	}
+	add(StageServerHeader, middleware)
+
+	// Describe errors of all later stages as problem details for JSON clients.
+	middleware = nil
+	if config.Get.ProblemDetails {
+		middleware = handle.WithProblems
+	}
+	add(StageProblems, middleware)
+
+	// Record metrics and transfer stats of all requests and serve the metrics
+	// from the metrics path.
+	middleware = nil
+	if (config.Get.Metrics || config.Get.Stats) && nil == stats {
+		stats = handle.NewTransferStats()
+	}
+	var accounting handle.MetricsRegistry
+	if config.Get.Metrics {
+		registry := metrics.New()
+		accounting = registry
+		stats.Register(registry)
+		updateRuntime := handle.RegisterRuntime(registry)
+		serveMetrics := registry.Handler()
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithEndpoint(
+				handle.WithMetrics(handle.WithTransferStats(serve, stats), registry),
+				config.Get.MetricsPath,
+				func(w http.ResponseWriter, r *http.Request) {
+					updateRuntime()
+					serveMetrics(w, r)
+				},
+			)
+		}
+	} else if config.Get.Stats {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithTransferStats(serve, stats)
+		}
+	}
+	add(StageMetrics, middleware)
+
+	// Close the gap between how proxies and this server resolve odd paths.
+	middleware = nil
+	if "off" != config.Get.PathNormalization {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithPathPolicy(serve, config.Get.PathNormalization)
+		}
+	}
+	add(StagePaths, middleware)
+
+	// Notify access events of all later stages. The notifier posts batches in
+	// the background, so it is only set by RunWith.
+	add(StageNotify, nil)
+
+	// Count responses of all later stages for alerts. The alerts are evaluated
+	// in the background, so they are only set by RunWith.
+	add(StageAlerts, nil)
+
+	// Record authentication and authorization decisions of later stages.
+	middleware = nil
+	if 0 < len(config.Get.AuditLog) {
+		out := os.Stdout
+		if "-" != config.Get.AuditLog {
+			var err error
+			out, err = os.OpenFile(
+				config.Get.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600,
+			)
+			if nil != err {
+				return nil, err
+			}
+		}
+		record := handle.AuditJSON(out)
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithAudit(serve, record)
+		}
+	}
+	add(StageAudit, middleware)
+
+	// Resolve client countries for logging and access rules.
+	middleware = nil
+	if 0 < len(config.Get.GeoIPFolder) {
+		db, err := geoip.Load(config.Get.GeoIPFolder)
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithGeoIP(
+				serve,
+				db.Country,
+				config.Get.GeoIPAllow,
+				config.Get.GeoIPDeny,
+			)
+		}
+	}
+	add(StageGeoIP, middleware)
+
+	// Limit the requests of each client.
+	middleware = nil
+	if 0 < config.Get.RateLimit {
+		limiter := handle.NewRateLimiter(
+			config.Get.RateLimit, config.Get.RateLimitWindow,
+		)
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithRateLimit(serve, limiter)
+		}
+	}
+	add(StageRateLimit, middleware)
+
+	// Limit the simultaneous transfers of each client and connection.
+	middleware = nil
+	if 0 < config.Get.TransferLimit || 0 < config.Get.TransferLimitPerConnection {
+		limiter := handle.NewTransferLimiter(
+			config.Get.TransferLimit, config.Get.TransferLimitPerConnection,
+		)
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithTransferLimit(serve, limiter)
+		}
+	}
+	add(StageTransferLimit, middleware)
+
+	// Pace video streams and count their seeks and bytes.
+	middleware = nil
+	if 0 < config.Get.VideoRate || nil != accounting {
+		videoConfig := handle.VideoConfig{
+			Rate:  int64(config.Get.VideoRate),
+			Burst: int64(config.Get.VideoBurst),
+		}
+		if nil != accounting {
+			videoConfig.Stats = handle.NewVideoStats(accounting)
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithVideo(serve, videoConfig)
+		}
+	}
+	add(StageVideo, middleware)
+
+	// Allow cross-origin requests by path. Preflight requests carry no
+	// credentials, so they are answered before authentication.
+	middleware = nil
+	if 0 < len(config.Get.CORS) {
+		rules, err := handle.ParseCORSRules(config.Get.CORS)
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithCORS(serve, rules)
+		}
+	}
+	add(StageCORS, middleware)
+
+	// Give well-known URIs the content types and access their clients expect.
+	wellKnownRedirects, err := handle.ParseWellKnownRedirects(config.Get.WellKnownRedirects)
+	if nil != err {
+		return nil, err
+	}
+	wellKnown := handle.WellKnown{
+		ACMEFolder:  config.Get.WellKnownACMEFolder,
+		Passthrough: config.Get.WellKnownPassthrough,
+		Redirects:   wellKnownRedirects,
+	}
+	middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+		return handle.WithWellKnown(serve, storage, wellKnown)
+	}
+	add(StageWellKnown, middleware)
+
+	// Ban clients repeatedly failing to authenticate.
+	middleware = nil
+	var lockout *handle.Lockout
+	if 0 < config.Get.LockoutThreshold {
+		lockout = handle.NewLockout(
+			config.Get.LockoutThreshold,
+			config.Get.LockoutWindow,
+			config.Get.LockoutBanTime,
 		)
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithLockout(serve, lockout)
+		}
+	}
+	add(StageLockout, middleware)
+
+	// Isolate the auth, limits and usage accounting of each tenant.
+	middleware = nil
+	if 0 < len(config.Get.Tenants) {
+		tenants, err := tenantsSelector(config.Get.Tenants)
+		if nil != err {
+			return nil, err
+		}
+		middleware = handle.WithTenants(tenants, accounting)
+	}
+	add(StageTenants, middleware)
+
+	// Require authentication for requests within each realm.
+	middleware = nil
+	if 0 < len(config.Get.AuthRealms) {
+		realms, err := handle.ParseAuthRealms(config.Get.AuthRealms)
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithAuth(serve, realms)
+		}
+	}
+	add(StageAuth, middleware)
+
+	// Allow or refuse requests by the first matching access policy rule.
+	middleware = nil
+	if 0 < len(config.Get.Policy) {
+		rules, err := handle.ParsePolicyRules(config.Get.Policy)
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithPolicy(serve, rules)
+		}
+	}
+	add(StagePolicy, middleware)
+
+	// Allow, refuse, redirect or rewrite requests by the statements of the
+	// script, once clients are authenticated.
+	middleware = nil
+	if 0 < len(config.Get.Script) {
+		source, err := ioutil.ReadFile(config.Get.Script)
+		if nil != err {
+			return nil, err
+		}
+		script, err := handle.ParseScript(string(source))
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithScript(serve, script)
+		}
+	}
+	add(StageScript, middleware)
+
+	// Serve the current bans, transfer stats and effective configuration to
+	// authenticated and authorized clients.
+	endpoints := make(map[string]http.HandlerFunc)
+	if nil != lockout {
+		endpoints[config.Get.LockoutPath] = lockout.Handler()
+	}
+	if config.Get.Stats {
+		endpoints[config.Get.StatsPath] = stats.Handler()
+	}
+	if config.Get.ConfigDump {
+		endpoints[config.Get.ConfigDumpPath] = configDumpHandler
+	}
+	middleware = nil
+	if 0 < len(endpoints) {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			for urlPath, endpoint := range endpoints {
+				serve = handle.WithEndpoint(serve, urlPath, endpoint)
+			}
+			return serve
+		}
 	}
+	add(StageAdmin, middleware)
+
+	// Switch the root files are served from. The roots replace the storage,
+	// so it is only set by RunWith.
+	add(StageRoots, nil)
+
+	// Account the requests and bytes served for each host and prefix, and
+	// serve the report to authenticated and authorized clients.
+	middleware = nil
+	if config.Get.Usage {
+		middleware = usageMiddleware(handle.NewUsage(config.Get.UsagePrefixes))
+	}
+	add(StageUsage, middleware)
+
+	// Stream file changes to authenticated and authorized clients. Changes
+	// are watched in the background, so it is only set by RunWith.
+	add(StageEvents, nil)
+
+	// Refuse or restrict clients based on their User-Agent.
+	middleware, err = withOverrides(func(o config.Override) (handle.Middleware, error) {
+		allow, deny := config.Get.UserAgentAllow, config.Get.UserAgentDeny
+		if nil != o.UserAgentAllow {
+			allow = o.UserAgentAllow
+		}
+		if nil != o.UserAgentDeny {
+			deny = o.UserAgentDeny
+		}
+		return userAgentMiddleware(allow, deny)
+	})
+	if nil != err {
+		return nil, err
+	}
+	add(StageUserAgent, middleware)
+
+	// Serve the canary percent of clients from CANARY_FOLDER, passing them
+	// through the content stages with the files of their release. The canary
+	// release is built by handlerSelector.
+	add(StageCanary, nil)
+
+	content, err := contentStages(storage)
+	if nil != err {
+		return nil, err
+	}
+	stages = append(stages, content...)
+
+	return handle.NewPipeline(stages...), nil
+}
+
+// contentStages returns the stages transforming and serving the files of the
+// storage, which follow the stages applying to every request.
+func contentStages(storage handle.Storage) ([]handle.Stage, error) {
+	var stages []handle.Stage
+	add := func(name string, middleware handle.Middleware) {
+		stages = append(stages, handle.Stage{Name: name, Middleware: middleware})
+	}
+
+	// Apply configured response headers after the security policies and
+	// global Cache-Control directives so they can be overridden by header
+	// rules. Cache-Control directives of overrides take priority over both.
+	middleware, err := withOverrides(func(o config.Override) (handle.Middleware, error) {
+		headers := config.Get.Headers
+		if nil != o.Headers {
+			headers = o.Headers
+		}
+		security, err := securityHeaders(o)
+		if nil != err {
+			return nil, err
+		}
+		directives, overridden := cacheDirectives(o)
+		cacheControl := directives.String()
+		if 0 < len(cacheControl) && !overridden {
+			security = append(security, "Cache-Control: "+cacheControl)
+		}
+		headers = append(security, headers...)
+		if overridden {
+			// An empty value removes any Cache-Control set by header rules.
+			headers = append(headers, "Cache-Control: "+cacheControl)
+		}
+		return headersMiddleware(headers)
+	})
+	if nil != err {
+		return nil, err
+	}
+	add(StageHeaders, middleware)
+
+	// Serve static HLS and DASH packaging output to players.
+	middleware = nil
+	if config.Get.VideoPreset {
+		streamingConfig := handle.StreamingConfig{
+			PlaylistMaxAge: config.Get.VideoPresetPlaylistMaxAge,
+			SegmentMaxAge:  config.Get.VideoPresetSegmentMaxAge,
+			CORSOrigin:     config.Get.VideoPresetCORSOrigin,
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithStreaming(serve, streamingConfig)
+		}
+	}
+	add(StageVideoPreset, middleware)
+
+	// Type files by name where extensions and sniffing get them wrong.
+	middleware = nil
+	if 0 < len(config.Get.ContentTypes) {
+		rules, err := handle.ParseContentTypeRules(config.Get.ContentTypes)
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithContentTypes(serve, rules)
+		}
+	}
+	add(StageContentTypes, middleware)
+
+	// Tag responses with surrogate keys for targeted CDN purges.
+	middleware = nil
+	if 0 < len(config.Get.SurrogateKeyHeader) {
+		manifest, err := surrogateKeyManifest()
+		if nil != err {
+			return nil, err
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithSurrogateKeys(
+				serve, config.Get.URLPrefix, config.Get.SurrogateKeyHeader, manifest,
+			)
+		}
+	}
+	add(StageSurrogateKeys, middleware)
+
+	// Inject snippets into HTML responses.
+	middleware = nil
+	if 0 < len(config.Get.InjectHead) || 0 < len(config.Get.InjectBody) {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithSnippets(serve, config.Get.InjectHead, config.Get.InjectBody)
+		}
+	}
+	add(StageSnippets, middleware)
+
+	// Minify text assets deployed unminified.
+	middleware = nil
+	if config.Get.Minify {
+		middleware = handle.WithMinify
+	}
+	add(StageMinify, middleware)
+
+	// Resize images for thumbnails and galleries.
+	middleware = nil
+	if config.Get.ImageResize {
+		if 0 < len(config.Get.ImageResizeCache) {
+			if err = os.MkdirAll(config.Get.ImageResizeCache, 0755); nil != err {
+				return nil, err
+			}
+		}
+		resize := handle.ResizeConfig{
+			MaxSize:      config.Get.ImageResizeMaxSize,
+			MaxPixels:    config.Get.ImageResizeMaxPixels,
+			CacheFolder:  config.Get.ImageResizeCache,
+			CacheMaxSize: config.Get.ImageResizeCacheMaxSize,
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithResize(serve, storage, config.Get.URLPrefix, resize)
+		}
+	}
+	add(StageResize, middleware)
+
+	// Generate crawler policies, security policies and sitemaps missing from
+	// the folder.
+	middleware, err = generatedFiles(storage, nil)
+	if nil != err {
+		return nil, err
+	}
+	add(StageGenerated, middleware)
+
+	// Quietly answer browsers asking for icons the folder does not have.
+	middleware = nil
+	if 0 < len(config.Get.Noise) {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithNoise(
+				serve,
+				storage,
+				config.Get.URLPrefix,
+				config.Get.NoisePaths,
+				config.Get.Noise,
+			)
+		}
+	}
+	add(StageNoise, middleware)
+
+	// Render template files with the configured variables.
+	middleware = nil
+	if config.Get.Templates {
+		vars := make(map[string]string, len(config.Get.TemplateVars))
+		for _, variable := range config.Get.TemplateVars {
+			parts := strings.SplitN(variable, "=", 2)
+			vars[parts[0]] = parts[1]
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithTemplates(serve, storage, config.Get.URLPrefix, vars)
+		}
+	}
+	add(StageTemplates, middleware)
+
+	// Search for files by name or contents.
+	middleware = nil
+	if config.Get.Search {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithSearch(
+				serve,
+				config.Get.SearchPath,
+				storage,
+				config.Get.URLPrefix,
+				config.Get.SearchContents,
+			)
+		}
+	}
+	add(StageSearch, middleware)
+
+	// Describe files as JSON when requested.
+	middleware = nil
+	if config.Get.Metadata {
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithMetadata(serve, storage, config.Get.URLPrefix)
+		}
+	}
+	add(StageMetadata, middleware)
+
+	// Serve checksums of files that lack a checksum file.
+	middleware = nil
+	if 0 < len(config.Get.Checksums) {
+		for _, algorithm := range config.Get.Checksums {
+			if !handle.ValidChecksumAlgorithm(algorithm) {
+				return nil, fmt.Errorf(
+					"unknown checksum algorithm '%s' in 'CHECKSUMS'", algorithm,
+				)
+			}
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithChecksums(
+				serve,
+				storage,
+				config.Get.URLPrefix,
+				config.Get.Checksums,
+			)
+		}
+	}
+	add(StageChecksums, middleware)
+
+	// Keep recently served responses in memory.
+	middleware = nil
+	if 0 < config.Get.CacheMaxSize {
+		cacheConfig := handle.CacheConfig{
+			MaxSize:      config.Get.CacheMaxSize,
+			MaxEntrySize: config.Get.CacheMaxEntrySize,
+			TTL:          config.Get.CacheTTL,
+			IgnoreQuery:  config.Get.CacheIgnoreQuery,
+		}
+		middleware = func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithCache(serve, cacheConfig)
+		}
+	}
+	add(StageCache, middleware)
+
+	// Give files ETags using the strategy of the mount.
+	var manifest map[string]string
+	if 0 < len(config.Get.ETagManifest) {
+		if manifest, err = handle.LoadETagManifest(config.Get.ETagManifest); nil != err {
+			return nil, err
+		}
+	}
+	middleware, err = withOverrides(func(o config.Override) (handle.Middleware, error) {
+		strategy := config.Get.ETag
+		if 0 < len(o.ETag) {
+			strategy = o.ETag
+		}
+		if !handle.ValidETagStrategy(strategy) {
+			return nil, fmt.Errorf("unknown ETag strategy '%s'", strategy)
+		}
+		if handle.ETagNone == strategy {
+			return nil, nil
+		}
+		return func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithETag(
+				serve, storage, config.Get.URLPrefix, strategy, manifest,
+			)
+		}, nil
+	})
+	if nil != err {
+		return nil, err
+	}
+	add(StageETag, middleware)
 
 	// Determine whether index files should hidden.
-	if !config.Get.ShowListing {
-		handler = handle.IgnoreIndex(handler)
+	middleware, _ = withOverrides(func(o config.Override) (handle.Middleware, error) {
+		showListing := config.Get.ShowListing
+		if nil != o.ShowListing {
+			showListing = *o.ShowListing
+		}
+		if showListing {
+			return nil, nil
+		}
+		return handle.IgnoreIndex, nil
+	})
+	add(StageIgnoreIndex, middleware)
+
+	return stages, nil
+}
+
+// withOverrides returns the middleware built for the global options, applied
+// to requests without an override, combined with the middleware built for each
+// configured override, applied to requests within its prefix. The build
+// function receives an empty override for the global options.
+func withOverrides(
+	build func(config.Override) (handle.Middleware, error),
+) (handle.Middleware, error) {
+	fallback, err := build(config.Override{})
+	if nil != err || 0 == len(config.Get.Overrides) {
+		return fallback, err
 	}
-	return
+
+	overrides := make([]handle.PrefixMiddleware, len(config.Get.Overrides))
+	for i, override := range config.Get.Overrides {
+		middleware, err := build(override)
+		if nil != err {
+			return nil, fmt.Errorf(
+				"for override of prefix '%s' got %v", override.Prefix, err,
+			)
+		}
+		overrides[i] = handle.PrefixMiddleware{
+			Prefix:     override.Prefix,
+			Middleware: middleware,
+		}
+	}
+	return handle.ByPrefix(fallback, overrides), nil
+}
+
+// tenantsSelector converts the configured tenants, loading the credentials of
+// their auth realms.
+func tenantsSelector(configured []config.Tenant) ([]handle.Tenant, error) {
+	tenants := make([]handle.Tenant, len(configured))
+	for i, tenant := range configured {
+		tenants[i] = handle.Tenant{Name: tenant.Name, Prefix: tenant.Prefix}
+		if 0 < len(tenant.Auth) {
+			realm, err := handle.ParseAuthRealm(tenant.Prefix + "=" + tenant.Auth)
+			if nil != err {
+				return nil, fmt.Errorf("for tenant '%s' got %v", tenant.Name, err)
+			}
+			tenants[i].Realm = &realm
+		}
+		if 0 < tenant.RateLimit {
+			window := tenant.RateLimitWindow
+			if 0 == window {
+				window = config.Get.RateLimitWindow
+			}
+			tenants[i].Limiter = handle.NewRateLimiter(tenant.RateLimit, window)
+		}
+		if 0 < tenant.Bandwidth {
+			tenants[i].Bandwidth = handle.NewBandwidth(tenant.Bandwidth)
+		}
+	}
+	return tenants, nil
+}
+
+// userAgentMiddleware returns middleware applying the User-Agent rules or nil
+// if there are none.
+func userAgentMiddleware(allowRules, denyRules []string) (handle.Middleware, error) {
+	if 0 == len(allowRules)+len(denyRules) {
+		return nil, nil
+	}
+	allow, err := handle.ParseUserAgentRules(allowRules)
+	if nil != err {
+		return nil, err
+	}
+	deny, err := handle.ParseUserAgentRules(denyRules)
+	if nil != err {
+		return nil, err
+	}
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		return handle.WithUserAgent(serve, allow, deny)
+	}, nil
+}
+
+// headersMiddleware returns middleware applying the header rules or nil if
+// there are none.
+func headersMiddleware(headers []string) (handle.Middleware, error) {
+	if 0 == len(headers) {
+		return nil, nil
+	}
+	rules, err := handle.ParseHeaderRules(headers)
+	if nil != err {
+		return nil, err
+	}
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		return handle.WithHeaders(serve, rules)
+	}, nil
+}
+
+// configDumpHandler serves the effective configuration with secrets masked.
+func configDumpHandler(w http.ResponseWriter, r *http.Request) {
+	contents, err := config.Dump()
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(contents)
+}
+
+// watchStorage starts watching the storage for changed files until the context
+// is done if any action is configured for them. If the storage is the folder
+// and the folder is a symbolic link, switching the link to a new target purges
+// the CDN of every file.
+func watchStorage(
+	ctx context.Context, storage handle.Storage, folder string,
+) error {
+	if 0 == len(config.Get.PurgeWebhook) && 0 == len(config.Get.CDNPurge) {
+		return nil
+	}
+	manifest, err := surrogateKeyManifest()
+	if nil != err {
+		return err
+	}
+
+	var actions []handle.WatchFunc
+	if 0 < len(config.Get.PurgeWebhook) {
+		actions = append(actions, handle.PurgeWebhook(
+			config.Get.PurgeWebhook, config.Get.URLPrefix, manifest,
+		))
+	}
+	if 0 < len(config.Get.CDNPurge) {
+		purger, err := handle.NewCDNPurger(
+			config.Get.CDNPurge,
+			config.Get.CDNPurgeID,
+			config.Get.CDNPurgeToken,
+			config.Get.CDNPurgeBaseURL,
+		)
+		if nil != err {
+			return err
+		}
+		actions = append(actions, handle.CDNPurge(
+			purger, config.Get.URLPrefix, manifest,
+		))
+
+		if info, err := os.Lstat(folder); nil == err &&
+			0 != info.Mode()&os.ModeSymlink {
+			go handle.WatchLink(ctx, folder, config.Get.WatchInterval, func(string) {
+				if err := purger.PurgeAll(); nil != err {
+					log.Printf("Error: while purging CDN got %v\n", err)
+				}
+			})
+		}
+	}
+
+	go handle.Watch(ctx, storage, config.Get.WatchInterval, func(names []string) {
+		for _, action := range actions {
+			action(names)
+		}
+	})
+	return nil
+}
+
+// checksumIndex returns the index of the checksums of the storage, loaded from
+// and persisted to the configured state file, precomputing them in the
+// background with the configured number of workers.
+func checksumIndex(
+	ctx context.Context, storage handle.Storage,
+) (*handle.ChecksumIndex, error) {
+	index := handle.NewChecksumIndex(storage, config.Get.Checksums)
+	if 0 < len(config.Get.ChecksumState) {
+		if err := index.Persist(config.Get.ChecksumState); nil != err {
+			return nil, err
+		}
+	}
+	if 0 < config.Get.ChecksumWorkers {
+		go func() {
+			start := time.Now()
+			files, err := index.Precompute(ctx, config.Get.ChecksumWorkers)
+			if nil != err {
+				log.Printf("Error: while computing checksums got %v\n", err)
+			}
+			log.Printf(
+				"Computed checksums of %d files in %v\n",
+				files, time.Since(start).Round(time.Millisecond),
+			)
+		}()
+	}
+	return index, nil
+}
+
+// usageSaveInterval is how often usage is saved to USAGE_STATE.
+var usageSaveInterval = time.Minute
+
+// usageMiddleware returns middleware accounting the usage and serving its
+// report from the usage path.
+func usageMiddleware(usage *handle.Usage) handle.Middleware {
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		return handle.WithEndpoint(
+			handle.WithUsage(serve, usage), config.Get.UsagePath, usage.Handler(),
+		)
+	}
+}
+
+// usageAccounting returns usage loaded from the configured state file, saved
+// to it in the background until the context is done and logged at the
+// configured report interval.
+func usageAccounting(ctx context.Context) (*handle.Usage, error) {
+	usage := handle.NewUsage(config.Get.UsagePrefixes)
+	if 0 < len(config.Get.UsageState) {
+		if err := usage.Persist(config.Get.UsageState); nil != err {
+			return nil, err
+		}
+	}
+	go func() {
+		save := time.NewTicker(usageSaveInterval)
+		defer save.Stop()
+		var report <-chan time.Time
+		if 0 < config.Get.UsageReportInterval {
+			ticker := time.NewTicker(config.Get.UsageReportInterval)
+			defer ticker.Stop()
+			report = ticker.C
+		}
+		for {
+			select {
+			case <-save.C:
+			case <-report:
+				usage.Log()
+				continue
+			case <-ctx.Done():
+			}
+			if err := usage.Save(); nil != err {
+				log.Printf("Error: while saving usage got %v\n", err)
+			}
+			if nil != ctx.Err() {
+				return
+			}
+		}
+	}()
+	return usage, nil
+}
+
+// warmup reads the configured files of the storage in the background, so
+// they are in the page cache before they are first requested.
+func warmup(ctx context.Context, storage handle.Storage) {
+	if 0 == len(config.Get.Warmup) && 0 == config.Get.WarmupRecent {
+		return
+	}
+	go func() {
+		start := time.Now()
+		files, bytes, err := handle.Warmup(
+			ctx, storage, config.Get.Warmup, config.Get.WarmupRecent,
+		)
+		if nil != err {
+			log.Printf("Error: while warming up got %v\n", err)
+		}
+		log.Printf(
+			"Warmed up %d files (%d bytes) in %v\n",
+			files, bytes, time.Since(start).Round(time.Millisecond),
+		)
+	}()
+}
+
+// retain removes the versions of artifacts in the folder not retained by the
+// RETENTION_* policy when started and every RETENTION_INTERVAL in the
+// background until the context is done, logging each version removed or, in a
+// dry run, each version that would be removed.
+func retain(ctx context.Context, folder string) {
+	if 0 == len(config.Get.RetentionPatterns) || 0 == len(folder) {
+		return
+	}
+	policy := handle.RetentionPolicy{
+		Patterns: config.Get.RetentionPatterns,
+		KeepLast: config.Get.RetentionKeep,
+		MaxAge:   config.Get.RetentionMaxAge,
+		DryRun:   config.Get.RetentionDryRun,
+	}
+	action := "removed"
+	if policy.DryRun {
+		action = "would remove"
+	}
+	go func() {
+		ticker := time.NewTicker(config.Get.RetentionInterval)
+		defer ticker.Stop()
+		for {
+			removed, err := handle.Retain(folder, policy, time.Now())
+			for _, name := range removed {
+				log.Printf("Retention %s '%s'\n", action, name)
+			}
+			if nil != err {
+				log.Printf("Error: while applying retention got %v\n", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// surrogateKeyManifest returns the configured surrogate key manifest or nil
+// if there is none.
+func surrogateKeyManifest() (map[string][]string, error) {
+	if 0 == len(config.Get.SurrogateKeyManifest) {
+		return nil, nil
+	}
+	return handle.LoadSurrogateKeyManifest(config.Get.SurrogateKeyManifest)
+}
+
+// cacheDirectives returns the Cache-Control directives of the override, using
+// global values for those it does not set, and true if the override sets any.
+func cacheDirectives(o config.Override) (handle.CacheDirectives, bool) {
+	directives := handle.CacheDirectives{
+		Browser:              config.Get.CacheControl,
+		SharedMaxAge:         config.Get.CacheControlSMaxAge,
+		StaleWhileRevalidate: config.Get.CacheControlStaleWhileRevalidate,
+		StaleIfError:         config.Get.CacheControlStaleIfError,
+	}
+	overridden := false
+	if 0 < len(o.CacheControl) {
+		directives.Browser, overridden = o.CacheControl, true
+	}
+	durations := []struct {
+		override *time.Duration
+		value    *time.Duration
+	}{
+		{o.CacheControlSMaxAge, &directives.SharedMaxAge},
+		{o.CacheControlStaleWhileRevalidate, &directives.StaleWhileRevalidate},
+		{o.CacheControlStaleIfError, &directives.StaleIfError},
+	}
+	for _, d := range durations {
+		if nil != d.override {
+			*d.value, overridden = *d.override, true
+		}
+	}
+	return directives, overridden
+}
+
+// securityHeaders returns header rules for the configured cross-origin and
+// permissions policies, using the permissions policy of the override if set.
+func securityHeaders(o config.Override) ([]string, error) {
+	directives := config.Get.PermissionsPolicy
+	if nil != o.PermissionsPolicy {
+		directives = o.PermissionsPolicy
+	}
+	permissions, err := handle.ParsePermissionsPolicy(directives)
+	if nil != err {
+		return nil, err
+	}
+
+	policies := []struct{ name, value string }{
+		{"Cross-Origin-Embedder-Policy", config.Get.CrossOriginEmbedderPolicy},
+		{"Cross-Origin-Opener-Policy", config.Get.CrossOriginOpenerPolicy},
+		{"Cross-Origin-Resource-Policy", config.Get.CrossOriginResourcePolicy},
+		{"Permissions-Policy", permissions},
+	}
+	var headers []string
+	for _, policy := range policies {
+		if 0 < len(policy.value) {
+			headers = append(headers, policy.name+": "+policy.value)
+		}
+	}
+	return headers, nil
+}
+
+// generatedFiles returns middleware serving each configured generated file or
+// nil if none are configured. The sitemap is generated by a new generator if
+// nil.
+func generatedFiles(
+	storage handle.Storage, sitemap *handle.Sitemap,
+) (handle.Middleware, error) {
+	// Stored files can only take priority over generated files when requests
+	// are served from the root of the storage.
+	filename := func(urlPath string) string {
+		if 0 < len(config.Get.URLPrefix) {
+			return ""
+		}
+		return urlPath
+	}
+	textType := "text/plain; charset=utf-8"
+	var wrappers []handle.Middleware
+
+	if 0 < len(config.Get.RobotsTxt) {
+		var generate handle.GeneratorFunc
+		switch config.Get.RobotsTxt {
+		case "allow":
+			generate = handle.RobotsAllowAll
+		case "deny":
+			generate = handle.RobotsDenyAll
+		default:
+			var err error
+			if generate, err = handle.Template(config.Get.RobotsTxt); nil != err {
+				return nil, err
+			}
+		}
+		urlPath := "/robots.txt"
+		wrappers = append(wrappers, func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithGenerated(
+				serve, storage, urlPath, filename(urlPath), textType, generate,
+			)
+		})
+	}
+
+	if 0 < len(config.Get.SecurityTxtContact) {
+		expires, err := time.Parse(time.RFC3339, config.Get.SecurityTxtExpires)
+		if nil != err {
+			return nil, err
+		}
+		fields := handle.SecurityTxt{
+			Contact:            config.Get.SecurityTxtContact,
+			Encryption:         config.Get.SecurityTxtEncryption,
+			Expires:            expires,
+			Policy:             config.Get.SecurityTxtPolicy,
+			PreferredLanguages: config.Get.SecurityTxtPreferredLanguages,
+		}
+		urlPath := "/.well-known/security.txt"
+		generate := handle.Static(fields.Generate())
+		wrappers = append(wrappers, func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithGenerated(
+				serve, storage, urlPath, filename(urlPath), textType, generate,
+			)
+		})
+	}
+
+	if config.Get.Sitemap {
+		urlPath := "/sitemap.xml"
+		if nil == sitemap {
+			sitemap = sitemapGenerator(storage)
+		}
+		generate := sitemap.Generate
+		wrappers = append(wrappers, func(serve http.HandlerFunc) http.HandlerFunc {
+			return handle.WithGenerated(
+				serve,
+				storage,
+				urlPath,
+				filename(urlPath),
+				"application/xml; charset=utf-8",
+				generate,
+			)
+		})
+	}
+
+	if 0 == len(wrappers) {
+		return nil, nil
+	}
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		for _, wrap := range wrappers {
+			serve = wrap(serve)
+		}
+		return serve
+	}, nil
+}
+
+// sitemapGenerator returns the generator of the sitemap of the storage.
+func sitemapGenerator(storage handle.Storage) *handle.Sitemap {
+	return handle.NewSitemap(storage, handle.SitemapOptions{
+		BaseURL:   config.Get.SitemapBaseURL,
+		URLPrefix: config.Get.URLPrefix,
+		Include:   config.Get.SitemapInclude,
+		Exclude:   config.Get.SitemapExclude,
+		Interval:  config.Get.SitemapInterval,
+	})
 }
 
 // listenerSelector returns the appropriate listener handler based on
@@ -72,3 +1693,32 @@ func listenerSelector() (listener handle.ListenerFunc) {
 	}
 	return
 }
+
+// selfSignedConfig returns a TLS configuration with a self-signed certificate
+// for HOST, if set, and the local host.
+func selfSignedConfig() (*tls.Config, error) {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host := config.Get.Host; 0 < len(host) && !contains(hosts, host) {
+		hosts = append([]string{host}, hosts...)
+	}
+	cert, err := handle.SelfSignedCertificate(hosts)
+	if nil != err {
+		return nil, err
+	}
+	fingerprint := sha256.Sum256(cert.Certificate[0])
+	log.Printf(
+		"Using a self-signed certificate for %s with SHA-256 fingerprint %X\n",
+		strings.Join(hosts, ", "), fingerprint,
+	)
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// contains returns true if the value is one of the values.
+func contains(values []string, value string) bool {
+	for _, existing := range values {
+		if value == existing {
+			return true
+		}
+	}
+	return false
+}
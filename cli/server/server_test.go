@@ -1,9 +1,20 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/halverneus/static-file-server/config"
 	"github.com/halverneus/static-file-server/handle"
@@ -28,6 +39,695 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRunWith(t *testing.T) {
+	var served bool
+	selectListener = func() handle.ListenerFunc {
+		return func(binding string, handler http.HandlerFunc) error {
+			handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			return nil
+		}
+	}
+	hooks := handle.Hooks{
+		OnRequest: func(*http.Request) { served = true },
+	}
+
+	config.Get.Debug = false
+	if err := RunWith(WithHooks(hooks)); nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	if !served {
+		t.Error("Expected the request hook to be called")
+	}
+}
+
+func TestRunWithListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	// Serving stops once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config.Get.Debug = false
+	if err = RunWith(WithContext(ctx), WithListener(ln)); nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+	err = RunWith(WithContext(ctx), WithListener(ln), WithTLSConfig(&tls.Config{}))
+	if nil != err {
+		t.Errorf("With TLS config expected no error but got %v", err)
+	}
+
+	var configured bool
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+	err = RunWith(
+		WithContext(ctx),
+		WithListener(ln),
+		WithServer(func(*http.Server) { configured = true }),
+		WithStorage(handle.Dir("/custom/folder")),
+		WithStageBefore(StageCache, "before", nil),
+		WithStageAfter(StageCache, "after", nil),
+	)
+	if nil != err {
+		t.Errorf("With server customization expected no error but got %v", err)
+	}
+	if !configured {
+		t.Error("Expected the server to be customized")
+	}
+}
+
+func TestRunWithNotify(t *testing.T) {
+	texts := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&batch)
+		texts <- batch.Text
+	}))
+	defer webhook.Close()
+	config.Get.NotifyWebhook = webhook.URL
+	config.Get.NotifyEvents = []string{handle.NotifyServerErrors}
+	config.Get.NotifyServerErrors = 1
+	defer func() {
+		config.Get.NotifyWebhook = ""
+		config.Get.NotifyEvents = nil
+		config.Get.NotifyServerErrors = 0
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	failing := func(http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- RunWith(
+			WithContext(ctx), WithListener(ln), WithStageAfter(StageCache, "failing", failing),
+		)
+	}()
+	resp, err := http.Get("http://" + ln.Addr().String() + "/file.txt")
+	if nil != err {
+		t.Fatalf("While requesting got %v", err)
+	}
+	resp.Body.Close()
+
+	// Pending notifications are posted once the context is done.
+	cancel()
+	if err = <-served; nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	select {
+	case text := <-texts:
+		if expected := "1 server errors within 1m0s, the latest 500 for /file.txt"; expected != text {
+			t.Errorf("Expected notification '%s' but got '%s'", expected, text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected a notification to be posted")
+	}
+}
+
+func TestRunWithAlerts(t *testing.T) {
+	texts := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&batch)
+		texts <- batch.Text
+	}))
+	defer webhook.Close()
+	config.Get.NotifyWebhook = webhook.URL
+	config.Get.NotifyEvents = []string{handle.NotifyAlerts}
+	config.Get.Alerts = []string{"5xx>50"}
+	config.Get.AlertWindow = 20 * time.Millisecond
+	config.Get.AlertMinRequests = 1
+	defer func() {
+		config.Get.NotifyWebhook = ""
+		config.Get.NotifyEvents = nil
+		config.Get.Alerts = nil
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	failing := func(http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- RunWith(
+			WithContext(ctx), WithListener(ln), WithStageAfter(StageCache, "failing", failing),
+		)
+	}()
+	resp, err := http.Get("http://" + ln.Addr().String() + "/file.txt")
+	if nil != err {
+		t.Fatalf("While requesting got %v", err)
+	}
+	resp.Body.Close()
+
+	// The alert is raised at the end of the window holding the request and
+	// posted once the context is done.
+	time.Sleep(10 * config.Get.AlertWindow)
+	cancel()
+	if err = <-served; nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	select {
+	case text := <-texts:
+		if expected := "Alert 5xx>50 raised: 5xx responses were 100.0% of 1 within 20ms"; expected != text {
+			t.Errorf("Expected notification '%s' but got '%s'", expected, text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected a notification to be posted")
+	}
+}
+
+func TestRunWithRoots(t *testing.T) {
+	blue, err := ioutil.TempDir("", "blue")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(blue)
+	green, err := ioutil.TempDir("", "green")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(green)
+	ioutil.WriteFile(filepath.Join(blue, "index.txt"), []byte("blue"), 0644)
+	ioutil.WriteFile(filepath.Join(green, "index.txt"), []byte("green"), 0644)
+
+	config.Get.Folder = blue
+	config.Get.Roots = true
+	config.Get.RootsFolders = []string{"green=" + green}
+	config.Get.RootsPath = "/__roots"
+	users := filepath.Join(blue, "users")
+	ioutil.WriteFile(users, []byte("admin:secret\n"), 0644)
+	config.Get.AuthRealms = []string{"/__roots=basic:" + users}
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.Roots = false
+		config.Get.RootsFolders = nil
+		config.Get.RootsPath = ""
+		config.Get.AuthRealms = nil
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- RunWith(WithContext(ctx), WithListener(ln))
+	}()
+	base := "http://" + ln.Addr().String()
+	serves := func(expected string) {
+		t.Helper()
+		resp, err := http.Get(base + "/index.txt")
+		if nil != err {
+			t.Fatalf("While requesting got %v", err)
+		}
+		defer resp.Body.Close()
+		if body, _ := ioutil.ReadAll(resp.Body); expected != string(body) {
+			t.Errorf("Expected root '%s' to be served but got '%s'", expected, body)
+		}
+	}
+
+	activate := func(user string, code int) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", base+"/__roots?activate=green", nil)
+		if 0 < len(user) {
+			req.SetBasicAuth(user, "secret")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if nil != err {
+			t.Fatalf("While activating got %v", err)
+		}
+		resp.Body.Close()
+		if code != resp.StatusCode {
+			t.Errorf("Expected status code %d but got %d", code, resp.StatusCode)
+		}
+	}
+
+	serves("blue")
+	activate("", http.StatusUnauthorized)
+	serves("blue")
+	activate("admin", http.StatusOK)
+	serves("green")
+
+	cancel()
+	if err = <-served; nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestRunWithInvalidRoots(t *testing.T) {
+	folder, err := ioutil.TempDir("", "roots")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+
+	config.Get.Folder = folder
+	config.Get.Roots = true
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.Roots = false
+		config.Get.RootsFolders = nil
+	}()
+	for _, root := range []string{"green=" + filepath.Join(folder, "missing"), "=" + folder, "default=" + folder} {
+		config.Get.RootsFolders = []string{root}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatalf("While listening got %v", err)
+		}
+		if err = RunWith(WithListener(ln)); nil == err {
+			t.Errorf("For root '%s' expected an error but got nil", root)
+		}
+		ln.Close()
+	}
+}
+
+func TestRunWithSitemap(t *testing.T) {
+	folder, err := ioutil.TempDir("", "sitemap")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	ioutil.WriteFile(filepath.Join(folder, "index.html"), []byte("index"), 0644)
+
+	config.Get.Folder = folder
+	config.Get.Sitemap = true
+	config.Get.SitemapBaseURL = "https://www.example.com"
+	config.Get.SitemapInclude = []string{"*.html"}
+	config.Get.SitemapInterval = 0
+	config.Get.WatchInterval = 10 * time.Millisecond
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.Sitemap = false
+		config.Get.SitemapBaseURL = ""
+		config.Get.SitemapInclude = nil
+		config.Get.WatchInterval = 0
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- RunWith(WithContext(ctx), WithListener(ln))
+	}()
+	sitemap := func() string {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/sitemap.xml")
+		if nil != err {
+			t.Fatalf("While requesting got %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	if contents := sitemap(); !strings.Contains(contents, "<loc>https://www.example.com/</loc>") {
+		t.Fatalf("Expected the index in the sitemap but got:\n%s", contents)
+	}
+
+	ioutil.WriteFile(filepath.Join(folder, "new.html"), []byte("new"), 0644)
+	expected := "<loc>https://www.example.com/new.html</loc>"
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(sitemap(), expected); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the changed folder to be walked again")
+		}
+	}
+
+	cancel()
+	if err = <-served; nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestRunWithSearchIndex(t *testing.T) {
+	folder, err := ioutil.TempDir("", "search")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	ioutil.WriteFile(filepath.Join(folder, "guide.md"), []byte("# Guide\nInstall it."), 0644)
+
+	config.Get.Folder = folder
+	config.Get.Search = true
+	config.Get.SearchIndex = true
+	config.Get.SearchPath = "/__search"
+	config.Get.WatchInterval = time.Hour
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.Search = false
+		config.Get.SearchIndex = false
+		config.Get.SearchPath = ""
+		config.Get.WatchInterval = 0
+	}()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- RunWith(WithContext(ctx), WithListener(ln))
+	}()
+	var results handle.SearchResults
+	for deadline := time.Now().Add(5 * time.Second); 0 == results.Total; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the indexed file to be found")
+		}
+		resp, err := http.Get("http://" + ln.Addr().String() + "/__search?q=install")
+		if nil != err {
+			t.Fatalf("While searching got %v", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&results)
+		resp.Body.Close()
+	}
+	if "/guide.md" != results.Results[0].Path || "Guide" != results.Results[0].Title {
+		t.Errorf("Expected the guide to be found but got %+v", results.Results)
+	}
+
+	cancel()
+	if err = <-served; nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestRunWithSelfSigned(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+	config.Get.Debug = false
+	config.Get.TLSSelfSigned = true
+	defer func() { config.Get.TLSSelfSigned = false }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunWith(WithContext(ctx), WithListener(ln)) }()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if nil != err {
+		t.Fatalf("While connecting got %v", err)
+	}
+	leaf := conn.ConnectionState().PeerCertificates[0]
+	conn.Close()
+	if err = leaf.VerifyHostname("localhost"); nil != err {
+		t.Errorf("Expected a certificate for localhost but got %v", err)
+	}
+
+	cancel()
+	if err = <-done; nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+}
+
+func TestHandlerSelectorPipeline(t *testing.T) {
+	storage := handle.Dir(config.Get.Folder)
+	expected := []string{
+		StageTrace, StageServerHeader, StageProblems, StageMetrics, StagePaths,
+		StageNotify, StageAlerts, StageAudit, StageGeoIP, StageRateLimit,
+		StageTransferLimit, StageVideo, StageCORS, StageWellKnown, StageLockout, StageTenants,
+		StageAuth, StagePolicy, StageScript, StageAdmin, StageRoots, StageUsage,
+		StageEvents, StageUserAgent, "custom", StageCanary, StageHeaders, StageVideoPreset,
+		StageContentTypes, StageSurrogateKeys, StageSnippets, StageMinify,
+		StageResize, StageGenerated, StageNoise, StageTemplates, StageSearch,
+		StageMetadata, StageChecksums, StageCache, StageETag, StageIgnoreIndex,
+	}
+	insert := func(pipeline *handle.Pipeline) error {
+		return pipeline.InsertAfter(StageUserAgent, "custom", nil)
+	}
+	verify := func(pipeline *handle.Pipeline) error {
+		names := pipeline.Names()
+		if len(expected) != len(names) {
+			t.Fatalf("Expected stages %v but got %v", expected, names)
+		}
+		for i := range expected {
+			if expected[i] != names[i] {
+				t.Errorf("Expected stages %v but got %v", expected, names)
+			}
+		}
+		return nil
+	}
+	if _, err := handlerSelector(storage, nil, nil, insert, verify); nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+
+	unknown := func(pipeline *handle.Pipeline) error {
+		return pipeline.InsertBefore("unknown", "custom", nil)
+	}
+	if _, err := handlerSelector(storage, nil, nil, unknown); nil == err {
+		t.Error("For an unknown stage expected an error but got nil")
+	}
+}
+
+func init() {
+	RegisterMiddleware("test-plugin", func(options map[string]string) (handle.Middleware, error) {
+		if 0 == len(options["header"]) {
+			return nil, errors.New("option 'header' must be set")
+		}
+		return func(serve http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(options["header"], "plugin")
+				serve(w, r)
+			}
+		}, nil
+	})
+}
+
+func TestHandlerSelectorPlugins(t *testing.T) {
+	storage := handle.Dir(config.Get.Folder)
+	options := map[string]string{"header": "X-Plugin"}
+	testCases := []struct {
+		name    string
+		plugin  config.Plugin
+		stages  []string
+		isError bool
+	}{
+		{"Before", config.Plugin{Name: "test-plugin", Before: StageCache, Options: options}, []string{StageChecksums, "test-plugin", StageCache}, false},
+		{"After", config.Plugin{Name: "test-plugin", After: StageAuth, Options: options}, []string{StageAuth, "test-plugin", StagePolicy}, false},
+		{"Last", config.Plugin{Name: "test-plugin", Options: options}, []string{StageIgnoreIndex, "test-plugin"}, false},
+		{"Unknown plugin", config.Plugin{Name: "missing"}, nil, true},
+		{"Unknown stage", config.Plugin{Name: "test-plugin", After: "missing", Options: options}, nil, true},
+		{"Bad options", config.Plugin{Name: "test-plugin"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.Plugins = []config.Plugin{tc.plugin}
+			defer func() { config.Get.Plugins = nil }()
+
+			var names []string
+			record := func(pipeline *handle.Pipeline) error {
+				names = pipeline.Names()
+				return nil
+			}
+			handler, err := handlerSelector(storage, nil, nil, record)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if tc.isError {
+				return
+			}
+			if !strings.Contains(strings.Join(names, " "), strings.Join(tc.stages, " ")) {
+				t.Errorf("Expected stages %v in %v", tc.stages, names)
+			}
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/", nil))
+			if "plugin" != w.Header().Get("X-Plugin") {
+				t.Errorf("Expected the plugin header but got %v", w.Header())
+			}
+		})
+	}
+
+	if expected := []string{"test-plugin"}; !reflect.DeepEqual(expected, Plugins()) {
+		t.Errorf("Expected plugins %v but got %v", expected, Plugins())
+	}
+}
+
+func TestHandlerSelectorPresign(t *testing.T) {
+	config.Get.PresignURL = "https://bucket.s3.amazonaws.com/prefix"
+	config.Get.PresignCredentials = "key:secret"
+	config.Get.PresignRegion = "us-east-1"
+	config.Get.PresignExpires = time.Minute
+	defer func() {
+		config.Get.PresignURL = ""
+		config.Get.PresignCredentials = ""
+	}()
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/sub/file.txt", nil))
+	expected := "https://bucket.s3.amazonaws.com/prefix/sub/file.txt?"
+	if location := w.Header().Get("Location"); http.StatusFound != w.Code ||
+		!strings.HasPrefix(location, expected) {
+		t.Errorf(
+			"Expected a redirect to '%s...' but got %d to '%s'",
+			expected, w.Code, location,
+		)
+	}
+}
+
+func TestHandlerSelectorTenants(t *testing.T) {
+	config.Get.Metrics = true
+	config.Get.Tenants = []config.Tenant{
+		{Name: "team", Prefix: "/sub", RateLimit: 1, Bandwidth: 1 << 20},
+	}
+	defer func() {
+		config.Get.Metrics = false
+		config.Get.Tenants = nil
+	}()
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	for _, limited := range []bool{false, true} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/sub/file.txt", nil))
+		if limited != (http.StatusTooManyRequests == w.Code) {
+			t.Errorf("Expected rate limited %t but got %d", limited, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, config.Get.MetricsPath, nil))
+	expected := `static_file_server_tenant_requests_total{tenant="team",code="429"} 1`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected metrics with '%s' but got %s", expected, w.Body.String())
+	}
+
+	config.Get.Tenants[0].Auth = "key:/missing/keys.txt"
+	if _, err = handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil == err {
+		t.Error("Expected an error for missing credentials but got none")
+	}
+}
+
+func TestHandlerSelectorRoutes(t *testing.T) {
+	var settings options
+	WithRoute(http.MethodPut, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})(&settings)
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, settings.routes)
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		method string
+		code   int
+		allow  string
+	}{
+		{http.MethodPut, http.StatusCreated, ""},
+		{http.MethodOptions, http.StatusNoContent, "GET, HEAD, OPTIONS, PUT"},
+		{http.MethodDelete, http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, PUT"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest(tc.method, "/file.txt", nil))
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if allow := w.Header().Get("Allow"); tc.allow != allow {
+				t.Errorf("Expected Allow '%s' but got '%s'", tc.allow, allow)
+			}
+		})
+	}
+}
+
+func TestHandlerSelectorOverrides(t *testing.T) {
+	folder, err := ioutil.TempDir("", "overrides")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	for _, name := range []string{"file.txt", "internal/file.txt"} {
+		filename := filepath.Join(folder, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0700)
+		if err = ioutil.WriteFile(filename, []byte(name), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+
+	hideListing := false
+	config.Get.Headers = []string{"Cache-Control: public"}
+	config.Get.PermissionsPolicy = []string{"camera="}
+	config.Get.ShowListing = true
+	config.Get.Overrides = []config.Override{{
+		Prefix:            "/internal",
+		CacheControl:      "no-store",
+		PermissionsPolicy: []string{"camera=self"},
+		ShowListing:       &hideListing,
+	}}
+	defer func() {
+		config.Get.Headers = nil
+		config.Get.PermissionsPolicy = nil
+		config.Get.Overrides = nil
+	}()
+	handler, err := handlerSelector(handle.Dir(folder), nil, nil)
+	if nil != err {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	testCases := []struct {
+		path         string
+		code         int
+		cacheControl string
+		permissions  string
+	}{
+		{"/file.txt", http.StatusOK, "public", "camera=()"},
+		{"/", http.StatusOK, "public", "camera=()"},
+		{"/internal/file.txt", http.StatusOK, "no-store", "camera=(self)"},
+		{"/internal/", http.StatusNotFound, "no-store", "camera=(self)"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", tc.path, nil))
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if cacheControl := w.Header().Get("Cache-Control"); tc.cacheControl != cacheControl {
+				t.Errorf("Expected Cache-Control '%s' but got '%s'", tc.cacheControl, cacheControl)
+			}
+			if permissions := w.Header().Get("Permissions-Policy"); tc.permissions != permissions {
+				t.Errorf("Expected Permissions-Policy '%s' but got '%s'", tc.permissions, permissions)
+			}
+		})
+	}
+
+	// Invalid overridden options are refused.
+	config.Get.Overrides[0].PermissionsPolicy = []string{"camera=other"}
+	if _, err = handlerSelector(handle.Dir(folder), nil, nil); nil == err {
+		t.Error("With an invalid permissions policy expected an error but got nil")
+	}
+	config.Get.Overrides[0].PermissionsPolicy = nil
+	config.Get.Overrides[0].Headers = []string{"no colon"}
+	if _, err = handlerSelector(handle.Dir(folder), nil, nil); nil == err {
+		t.Error("With an invalid override expected an error but got nil")
+	}
+}
+
 func TestHandlerSelector(t *testing.T) {
 	// This test only exercises function branches.
 	testFolder := "/web"
@@ -57,7 +757,456 @@ func TestHandlerSelector(t *testing.T) {
 			config.Get.ShowListing = tc.listing
 			config.Get.URLPrefix = tc.prefix
 
-			handlerSelector()
+			if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil != err {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandlerSelectorGeoIP(t *testing.T) {
+	config.Get.GeoIPFolder = "/this/folder/should/never/exist"
+	defer func() { config.Get.GeoIPFolder = "" }()
+
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil == err {
+		t.Error("With missing GeoIP database expected an error but got nil")
+	}
+
+	listenerCalled := false
+	selectListener = func() handle.ListenerFunc {
+		return func(string, http.HandlerFunc) error {
+			listenerCalled = true
+			return nil
+		}
+	}
+	if err := Run(); nil == err {
+		t.Error("Running with missing GeoIP database expected an error")
+	}
+	if listenerCalled {
+		t.Error("Running with missing GeoIP database should not listen")
+	}
+}
+
+func TestHandlerSelectorHeaders(t *testing.T) {
+	defer func() { config.Get.Headers = nil }()
+
+	config.Get.Headers = []string{"X-Frame-Options: DENY", "/assets=Server:"}
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil != err {
+		t.Errorf("With valid headers expected no error but got %v", err)
+	}
+	config.Get.Headers = []string{"X-Frame-Options DENY"}
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil == err {
+		t.Error("With bad header rule expected an error but got nil")
+	}
+}
+
+func TestHandlerSelectorLockout(t *testing.T) {
+	config.Get.LockoutThreshold = 3
+	defer func() { config.Get.LockoutThreshold = 0 }()
+
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("With lockout expected no error but got %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", config.Get.LockoutPath, nil))
+	if body := strings.TrimSpace(w.Body.String()); "[]" != body {
+		t.Errorf("Expected no bans but got '%s'", body)
+	}
+}
+
+func TestHandlerSelectorAccessLogFields(t *testing.T) {
+	config.Get.Debug = true
+	config.Get.AccessLogFields = []string{"ip=mask", "query=redact"}
+	defer func() {
+		config.Get.Debug = false
+		config.Get.AccessLogFields = nil
+	}()
+
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil != err {
+		t.Errorf("With valid fields expected no error but got %v", err)
+	}
+	config.Get.AccessLogFields = []string{"cookie=keep"}
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil == err {
+		t.Error("With an unknown field expected an error but got nil")
+	}
+}
+
+func TestHandlerSelectorStats(t *testing.T) {
+	config.Get.Metrics = true
+	config.Get.Stats = true
+	defer func() {
+		config.Get.Metrics = false
+		config.Get.Stats = false
+	}()
+
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("With stats expected no error but got %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", config.Get.StatsPath, nil))
+	if body := w.Body.String(); !strings.Contains(body, `"active_transfers":1`) {
+		t.Errorf("Expected the stats request to be active but got '%s'", body)
+	}
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", config.Get.MetricsPath, nil))
+	if body := w.Body.String(); !strings.Contains(body, "static_file_server_transfers_active") {
+		t.Errorf("Expected transfer metrics but got '%s'", body)
+	}
+}
+
+func TestHandlerSelectorConfigDump(t *testing.T) {
+	config.Get.ConfigDump = true
+	config.Get.TraceKey = "secret-key"
+	defer func() {
+		config.Get.ConfigDump = false
+		config.Get.TraceKey = ""
+	}()
+
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("With the config dump expected no error but got %v", err)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", config.Get.ConfigDumpPath, nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "config-dump: true\n") || strings.Contains(body, "secret-key") {
+		t.Errorf("Expected the configuration without secrets but got '%s'", body)
+	}
+}
+
+func TestHandlerSelectorCrossOrigin(t *testing.T) {
+	config.Get.CrossOriginEmbedderPolicy = "require-corp"
+	config.Get.CrossOriginOpenerPolicy = "same-origin"
+	config.Get.Headers = []string{"/assets=Cross-Origin-Embedder-Policy:"}
+	defer func() {
+		config.Get.CrossOriginEmbedderPolicy = ""
+		config.Get.CrossOriginOpenerPolicy = ""
+		config.Get.Headers = nil
+	}()
+
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("With cross-origin policies expected no error but got %v", err)
+	}
+	testCases := []struct {
+		path, embedder, opener string
+	}{
+		{"/", "require-corp", "same-origin"},
+		{"/assets/app.js", "", "same-origin"},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", tc.path, nil))
+		if embedder := w.Header().Get("Cross-Origin-Embedder-Policy"); tc.embedder != embedder {
+			t.Errorf("For %s expected embedder policy '%s' but got '%s'", tc.path, tc.embedder, embedder)
+		}
+		if opener := w.Header().Get("Cross-Origin-Opener-Policy"); tc.opener != opener {
+			t.Errorf("For %s expected opener policy '%s' but got '%s'", tc.path, tc.opener, opener)
+		}
+	}
+}
+
+func TestHandlerSelectorCacheControl(t *testing.T) {
+	noSharedCache := time.Duration(0)
+	config.Get.CacheControl = "public, max-age=60"
+	config.Get.CacheControlSMaxAge = time.Hour
+	config.Get.CacheControlStaleWhileRevalidate = time.Minute
+	config.Get.Headers = []string{"/api=Cache-Control: no-cache"}
+	config.Get.Overrides = []config.Override{
+		{Prefix: "/private", CacheControlSMaxAge: &noSharedCache, CacheControl: "private"},
+	}
+	defer func() {
+		config.Get.CacheControl = ""
+		config.Get.CacheControlSMaxAge = 0
+		config.Get.CacheControlStaleWhileRevalidate = 0
+		config.Get.Headers = nil
+		config.Get.Overrides = nil
+	}()
+
+	handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+	if nil != err {
+		t.Fatalf("With Cache-Control directives expected no error but got %v", err)
+	}
+	testCases := []struct {
+		path, expected string
+	}{
+		{"/", "public, max-age=60, s-maxage=3600, stale-while-revalidate=60"},
+		{"/api/data.json", "no-cache"},
+		{"/private/file.txt", "private, stale-while-revalidate=60"},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", tc.path, nil))
+		if cacheControl := w.Header().Get("Cache-Control"); tc.expected != cacheControl {
+			t.Errorf("For %s expected Cache-Control '%s' but got '%s'", tc.path, tc.expected, cacheControl)
+		}
+	}
+}
+
+func TestHandlerSelectorUserAgent(t *testing.T) {
+	testCases := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		isError bool
+	}{
+		{"Valid rules", []string{"/internal=^tool/"}, []string{"(?i)bot"}, false},
+		{"Bad allow rule", []string{"("}, nil, true},
+		{"Bad deny rule", nil, []string{"("}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.UserAgentAllow = tc.allow
+			config.Get.UserAgentDeny = tc.deny
+			defer func() {
+				config.Get.UserAgentAllow = nil
+				config.Get.UserAgentDeny = nil
+			}()
+
+			_, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+			if tc.isError && nil == err {
+				t.Error("Expected an error but got nil")
+			}
+			if !tc.isError && nil != err {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestHandlerSelectorScript(t *testing.T) {
+	folder, err := ioutil.TempDir("", "script")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	valid := filepath.Join(folder, "valid.script")
+	ioutil.WriteFile(valid, []byte(`deny 451 if path ^= "/blocked/"`), 0600)
+	invalid := filepath.Join(folder, "invalid.script")
+	ioutil.WriteFile(invalid, []byte(`deny if weather == "rain"`), 0600)
+
+	testCases := []struct {
+		name    string
+		script  string
+		isError bool
+	}{
+		{"Valid script", valid, false},
+		{"Invalid script", invalid, true},
+		{"Missing script", filepath.Join(folder, "missing.script"), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.Script = tc.script
+			defer func() { config.Get.Script = "" }()
+
+			handler, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if tc.isError {
+				return
+			}
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "/blocked/file.txt", nil))
+			if http.StatusUnavailableForLegalReasons != w.Code {
+				t.Errorf("Expected status code %d but got %d", http.StatusUnavailableForLegalReasons, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlerSelectorCanary(t *testing.T) {
+	stable, err := ioutil.TempDir("", "stable")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(stable)
+	canary, err := ioutil.TempDir("", "canary")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(canary)
+	ioutil.WriteFile(filepath.Join(stable, "index.txt"), []byte("stable"), 0644)
+	ioutil.WriteFile(filepath.Join(canary, "index.txt"), []byte("canary"), 0644)
+
+	config.Get.CanaryFolder = canary
+	config.Get.CanarySticky = handle.CanaryStickyCookie
+	config.Get.Headers = []string{"X-Release: any"}
+	config.Get.URLPrefix = ""
+	defer func() {
+		config.Get.CanaryFolder = ""
+		config.Get.CanaryPercent = 0
+		config.Get.CanarySticky = ""
+		config.Get.Headers = nil
+	}()
+
+	for percent, expected := range map[int]string{0: "stable", 100: "canary"} {
+		config.Get.CanaryPercent = percent
+		handler, err := handlerSelector(handle.Dir(stable), nil, nil)
+		if nil != err {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/index.txt", nil))
+		if expected != w.Body.String() {
+			t.Errorf("With %d percent expected '%s' but got '%s'", percent, expected, w.Body)
+		}
+		if "any" != w.Header().Get("X-Release") {
+			t.Errorf("With %d percent expected the content stages to apply", percent)
+		}
+	}
+}
+
+func TestHandlerSelectorFileInformation(t *testing.T) {
+	defer func() { config.Get.Checksums = nil }()
+
+	config.Get.Checksums = []string{"md5", "sha256"}
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil != err {
+		t.Errorf("With valid checksums expected no error but got %v", err)
+	}
+	config.Get.CacheMaxSize = 1 << 20
+	config.Get.Metadata = true
+	config.Get.Metrics = true
+	config.Get.Search = true
+	defer func() {
+		config.Get.CacheMaxSize = 0
+		config.Get.Metadata = false
+		config.Get.Metrics = false
+		config.Get.Search = false
+	}()
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil != err {
+		t.Errorf("With optional features expected no error but got %v", err)
+	}
+	config.Get.Checksums = []string{"crc32"}
+	if _, err := handlerSelector(handle.Dir(config.Get.Folder), nil, nil); nil == err {
+		t.Error("With unknown checksum expected an error but got nil")
+	}
+}
+
+func TestWithGeneratedFiles(t *testing.T) {
+	contact := []string{"mailto:security@apets.life"}
+	expires := "2030-01-01T00:00:00Z"
+
+	testCases := []struct {
+		name    string
+		robots  string
+		prefix  string
+		contact []string
+		expires string
+		isError bool
+	}{
+		{"Nothing", "", "", nil, "", false},
+		{"Robots allow", "allow", "", nil, "", false},
+		{"Robots deny w/prefix", "deny", "/url/prefix", nil, "", false},
+		{"Robots template", "server.go", "", nil, "", false},
+		{"Robots missing template", "should/never/exist.tmpl", "", nil, "", true},
+		{"Security", "", "", contact, expires, false},
+		{"Security bad expires", "", "", contact, "soon", true},
+	}
+
+	config.Get.Sitemap = true
+	defer func() { config.Get.Sitemap = false }()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.RobotsTxt = tc.robots
+			config.Get.URLPrefix = tc.prefix
+			config.Get.SecurityTxtContact = tc.contact
+			config.Get.SecurityTxtExpires = tc.expires
+			defer func() {
+				config.Get.RobotsTxt = ""
+				config.Get.URLPrefix = ""
+				config.Get.SecurityTxtContact = nil
+				config.Get.SecurityTxtExpires = ""
+			}()
+
+			_, err := generatedFiles(handle.Dir(config.Get.Folder), nil)
+			if tc.isError && nil == err {
+				t.Error("Expected an error but got nil")
+			}
+			if !tc.isError && nil != err {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestListenerHandler(t *testing.T) {
+	config.Get.Metrics = true
+	config.Get.Events, config.Get.EventsPath = true, "/__events"
+	config.Get.Search, config.Get.SearchPath = true, "/__search"
+	defer func() {
+		config.Get.Metrics = false
+		config.Get.Events = false
+		config.Get.Search = false
+	}()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	testCases := []struct {
+		name     string
+		listener config.Listener
+		path     string
+		code     int
+	}{
+		{"Public file", config.Listener{Prefixes: []string{"/pub"}}, "/pub/my.file", http.StatusOK},
+		{"Public outside prefix", config.Listener{Prefixes: []string{"/pub"}}, "/my.file", http.StatusNotFound},
+		{"Public metrics", config.Listener{}, config.Get.MetricsPath, http.StatusNotFound},
+		{"Public uncleaned metrics", config.Listener{}, "/" + config.Get.MetricsPath, http.StatusNotFound},
+		{"Public events", config.Listener{}, config.Get.EventsPath, http.StatusNotFound},
+		{"Public search", config.Listener{}, config.Get.SearchPath, http.StatusNotFound},
+		{"Internal file", config.Listener{Admin: true}, "/my.file", http.StatusOK},
+		{"Internal metrics", config.Listener{Admin: true}, config.Get.MetricsPath, http.StatusOK},
+		{"Internal prefixed metrics", config.Listener{Prefixes: []string{"/internal"}, Admin: true},
+			config.Get.MetricsPath, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			listenerHandler(ok, tc.listener)(w, httptest.NewRequest("GET", tc.path, nil))
+			if tc.code != w.Code {
+				t.Errorf("While retrieving %s expected %d but got %d", tc.path, tc.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestWithProtocols(t *testing.T) {
+	protocols := config.Get.Protocols
+	defer func() {
+		config.Get.Protocols = protocols
+	}()
+
+	testCases := []struct {
+		name      string
+		global    []string
+		listener  []string
+		disableH2 bool
+		cleartext bool
+	}{
+		{"Default", []string{"h2", "http/1.1"}, nil, false, false},
+		{"Global without HTTP/2", []string{"http/1.1"}, nil, true, false},
+		{"Listener without HTTP/2", []string{"h2", "http/1.1"}, []string{"http/1.1"}, true, false},
+		{"Listener with HTTP/2", []string{"http/1.1"}, []string{"h2", "http/1.1"}, false, false},
+		{"Global cleartext HTTP/2", []string{"h2", "h2c", "http/1.1"}, nil, false, true},
+		{"Listener cleartext HTTP/2", []string{"h2", "http/1.1"}, []string{"h2c", "http/1.1"}, true, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Get.Protocols = tc.global
+			server := &http.Server{}
+			for _, fn := range withProtocols(nil, tc.listener) {
+				fn(server)
+			}
+			if disabled := nil != server.TLSNextProto; tc.disableH2 != disabled {
+				t.Errorf("Expected HTTP/2 disabled %t but got %t", tc.disableH2, disabled)
+			}
+			if cleartext := nil != server.Handler; tc.cleartext != cleartext {
+				t.Errorf("Expected cleartext HTTP/2 %t but got %t", tc.cleartext, cleartext)
+			}
 		})
 	}
 }
@@ -84,3 +1233,172 @@ func TestListenerSelector(t *testing.T) {
 		})
 	}
 }
+
+func TestFolderStorage(t *testing.T) {
+	config.Get.Folder = "/my/folder"
+	defer func() {
+		config.Get.Folder = ""
+		config.Get.MmapMinSize = 0
+		config.Get.OpenFileCacheSize = 0
+		config.Get.ReadvBatch = 0
+	}()
+
+	if storage, ok := folderStorage().(handle.Dir); !ok || "/my/folder" != string(storage) {
+		t.Errorf("Expected the folder but got %v", storage)
+	}
+	// Batched reads are only used where supported.
+	config.Get.ReadvBatch = 8
+	var batched handle.Storage = handle.Dir("/my/folder")
+	if handle.ReadvSupported {
+		batched = handle.ReadvDir{Dir: handle.Dir("/my/folder"), Batch: 8}
+	}
+	if storage := folderStorage(); batched != storage {
+		t.Errorf("Expected %v but got %v", batched, storage)
+	}
+	config.Get.MmapMinSize = 1024
+	expected := handle.MmapDir{Dir: handle.Dir("/my/folder"), MinSize: 1024}
+	if storage := folderStorage(); expected != storage {
+		t.Errorf("Expected %v but got %v", expected, storage)
+	}
+	config.Get.OpenFileCacheSize = 16
+	if _, ok := folderStorage().(*handle.FileCache); !ok {
+		t.Error("Expected the open file cache")
+	}
+}
+
+func TestChecksumIndex(t *testing.T) {
+	folder, err := ioutil.TempDir("", "checksums")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	if err := ioutil.WriteFile(filepath.Join(folder, "file.txt"), []byte("file"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	state := filepath.Join(folder, "state", "checksums.json")
+	config.Get.Checksums = []string{"md5"}
+	config.Get.ChecksumState = state
+	defer func() {
+		config.Get.Checksums = nil
+		config.Get.ChecksumState = ""
+	}()
+
+	// The state file cannot be created in a missing folder.
+	if _, err := checksumIndex(context.Background(), handle.Dir(folder)); nil == err {
+		t.Error("Expected an error for a missing state folder")
+	}
+	if err := os.Mkdir(filepath.Dir(state), 0700); nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	index, err := checksumIndex(context.Background(), handle.Dir(folder))
+	if nil != err {
+		t.Fatalf("While creating index got %v", err)
+	}
+	defer index.Close()
+	if _, err := os.Stat(state); nil != err {
+		t.Errorf("Expected the state file to be created but got %v", err)
+	}
+
+	handler := handle.WithChecksumIndex(
+		handle.Basic(handle.FileServer(handle.Dir(folder)), ""), index, "",
+	)
+	req := httptest.NewRequest(http.MethodGet, "/file.txt.md5", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	contents, _ := ioutil.ReadFile(state)
+	if !strings.Contains(string(contents), `"name":"/file.txt"`) {
+		t.Errorf("Expected the served checksum to be persisted but got '%s'", contents)
+	}
+}
+
+func TestUsageAccounting(t *testing.T) {
+	folder, err := ioutil.TempDir("", "usage")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	state := filepath.Join(folder, "usage.json")
+	if err = ioutil.WriteFile(state, []byte("{"), 0600); nil != err {
+		t.Fatalf("While writing state got %v", err)
+	}
+	config.Get.Usage = true
+	config.Get.UsageState = state
+	defer func() {
+		config.Get.Usage = false
+		config.Get.UsageState = ""
+	}()
+
+	// A damaged state file is not replaced.
+	if _, err := usageAccounting(context.Background()); nil == err {
+		t.Error("Expected an error for a damaged state file")
+	}
+	os.Remove(state)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	usage, err := usageAccounting(ctx)
+	if nil != err {
+		t.Fatalf("While accounting usage got %v", err)
+	}
+	handler := usageMiddleware(usage)(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/file.txt", nil))
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, config.Get.UsagePath, nil))
+	if expected := `"requests":1,"bytes":7`; !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected report with '%s' but got '%s'", expected, w.Body.String())
+	}
+
+	// Usage is saved once the context is done.
+	cancel()
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(state); nil == err {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nil != err {
+		t.Errorf("Expected the state file to be saved but got %v", err)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	folder, err := ioutil.TempDir("", "retain")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"app-1.0.zip", "app-1.1.zip", "notes.txt"} {
+		filename := filepath.Join(folder, name)
+		ioutil.WriteFile(filename, []byte(name), 0644)
+		os.Chtimes(filename, old, old)
+	}
+	ioutil.WriteFile(filepath.Join(folder, "app-1.2.zip"), []byte("new"), 0644)
+
+	config.Get.RetentionPatterns = []string{"*.zip"}
+	config.Get.RetentionMaxAge = 24 * time.Hour
+	config.Get.RetentionInterval = time.Hour
+	defer func() {
+		config.Get.RetentionPatterns = nil
+		config.Get.RetentionMaxAge = 0
+		config.Get.RetentionInterval = 0
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	retain(ctx, folder)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(filepath.Join(folder, "app-1.1.zip")); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected old versions to be removed")
+		}
+	}
+	for _, name := range []string{"app-1.2.zip", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(folder, name)); nil != err {
+			t.Errorf("Expected %s to be kept but got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package starter
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+// Run print operation. The starter configuration is written to the file, which
+// must not exist, or printed if no file is given.
+func Run(filename string) error {
+	contents, err := config.Starter(".")
+	if nil != err {
+		return err
+	}
+	if 0 == len(filename) {
+		fmt.Print(string(contents))
+		return nil
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if nil != err {
+		return err
+	}
+	if _, err = file.Write(contents); nil != err {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); nil != err {
+		return err
+	}
+	fmt.Printf("Wrote starter configuration to %s\n", filename)
+	return nil
+}
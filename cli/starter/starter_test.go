@@ -0,0 +1,30 @@
+package starter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	if err := Run(""); nil != err {
+		t.Errorf("While printing got %v", err)
+	}
+
+	folder, err := ioutil.TempDir("", "starter")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	filename := filepath.Join(folder, "config.yml")
+	if err = Run(filename); nil != err {
+		t.Errorf("While writing got %v", err)
+	}
+	if _, err = os.Stat(filename); nil != err {
+		t.Errorf("Expected the file to be written but got %v", err)
+	}
+	if err = Run(filename); !os.IsExist(err) {
+		t.Errorf("Expected an existing file to be kept but got %v", err)
+	}
+}
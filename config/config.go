@@ -1,12 +1,20 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	yaml "gopkg.in/yaml.v2"
 )
@@ -14,53 +22,695 @@ import (
 var (
 	// Get the desired configuration value.
 	Get struct {
-		Debug       bool   `yaml:"debug"`
-		Folder      string `yaml:"folder"`
-		Host        string `yaml:"host"`
-		Port        uint16 `yaml:"port"`
-		ShowListing bool   `yaml:"show-listing"`
-		TLSCert     string `yaml:"tls-cert"`
-		TLSKey      string `yaml:"tls-key"`
-		URLPrefix   string `yaml:"url-prefix"`
+		AccessLogExclude                 []string      `yaml:"access-log-exclude"`
+		AccessLogFields                  []string      `yaml:"access-log-fields"`
+		AccessLogHashKey                 string        `yaml:"access-log-hash-key"`
+		AccessLogSample                  int           `yaml:"access-log-sample"`
+		AlertMinRequests                 int           `yaml:"alert-min-requests"`
+		AlertWindow                      time.Duration `yaml:"alert-window"`
+		Alerts                           []string      `yaml:"alerts"`
+		AuditLog                         string        `yaml:"audit-log"`
+		AuthRealms                       []string      `yaml:"auth-realms"`
+		CacheControl                     string        `yaml:"cache-control"`
+		CacheControlSMaxAge              time.Duration `yaml:"cache-control-s-maxage"`
+		CacheControlStaleIfError         time.Duration `yaml:"cache-control-stale-if-error"`
+		CacheControlStaleWhileRevalidate time.Duration `yaml:"cache-control-stale-while-revalidate"`
+		CacheIgnoreQuery                 []string      `yaml:"cache-ignore-query"`
+		CacheMaxEntrySize                int           `yaml:"cache-max-entry-size"`
+		CacheMaxSize                     int           `yaml:"cache-max-size"`
+		CacheTTL                         time.Duration `yaml:"cache-ttl"`
+		CanaryFolder                     string        `yaml:"canary-folder"`
+		CanaryPercent                    int           `yaml:"canary-percent"`
+		CanarySticky                     string        `yaml:"canary-sticky"`
+		CDNPurge                         string        `yaml:"cdn-purge"`
+		CDNPurgeBaseURL                  string        `yaml:"cdn-purge-base-url"`
+		CDNPurgeID                       string        `yaml:"cdn-purge-id"`
+		CDNPurgeToken                    string        `yaml:"cdn-purge-token"`
+		ChecksumState                    string        `yaml:"checksum-state"`
+		ChecksumWorkers                  int           `yaml:"checksum-workers"`
+		Checksums                        []string      `yaml:"checksums"`
+		ConfigDump                       bool          `yaml:"config-dump"`
+		ConfigDumpPath                   string        `yaml:"config-dump-path"`
+		ContentTypes                     []string      `yaml:"content-types"`
+		CopyBufferSize                   int           `yaml:"copy-buffer-size"`
+		CORS                             []string      `yaml:"cors"`
+		CrossOriginEmbedderPolicy        string        `yaml:"cross-origin-embedder-policy"`
+		CrossOriginOpenerPolicy          string        `yaml:"cross-origin-opener-policy"`
+		CrossOriginResourcePolicy        string        `yaml:"cross-origin-resource-policy"`
+		Debug                            bool          `yaml:"debug"`
+		ETag                             string        `yaml:"etag"`
+		ETagManifest                     string        `yaml:"etag-manifest"`
+		Events                           bool          `yaml:"events"`
+		EventsPath                       string        `yaml:"events-path"`
+		Folder                           string        `yaml:"folder"`
+		GeoIPAllow                       []string      `yaml:"geoip-allow"`
+		GeoIPDeny                        []string      `yaml:"geoip-deny"`
+		GeoIPFolder                      string        `yaml:"geoip-folder"`
+		Headers                          []string      `yaml:"headers"`
+		Host                             string        `yaml:"host"`
+		ImageResize                      bool          `yaml:"image-resize"`
+		ImageResizeCache                 string        `yaml:"image-resize-cache"`
+		ImageResizeCacheMaxSize          int           `yaml:"image-resize-cache-max-size"`
+		ImageResizeMaxPixels             int           `yaml:"image-resize-max-pixels"`
+		ImageResizeMaxSize               int           `yaml:"image-resize-max-size"`
+		Include                          []string      `yaml:"include"`
+		InjectBody                       string        `yaml:"inject-body"`
+		InjectHead                       string        `yaml:"inject-head"`
+		Listeners                        []Listener    `yaml:"listeners"`
+		LockoutBanTime                   time.Duration `yaml:"lockout-ban-time"`
+		LockoutPath                      string        `yaml:"lockout-path"`
+		LockoutThreshold                 int           `yaml:"lockout-threshold"`
+		LockoutWindow                    time.Duration `yaml:"lockout-window"`
+		LogOutput                        string        `yaml:"log-output"`
+		Metadata                         bool          `yaml:"metadata"`
+		Metrics                          bool          `yaml:"metrics"`
+		MetricsPath                      string        `yaml:"metrics-path"`
+		Minify                           bool          `yaml:"minify"`
+		MmapMinSize                      int           `yaml:"mmap-min-size"`
+		Noise                            string        `yaml:"noise"`
+		NoisePaths                       []string      `yaml:"noise-paths"`
+		NotifyAuthFailures               int           `yaml:"notify-auth-failures"`
+		NotifyEvents                     []string      `yaml:"notify-events"`
+		NotifyInterval                   time.Duration `yaml:"notify-interval"`
+		NotifyServerErrors               int           `yaml:"notify-server-errors"`
+		NotifyWebhook                    string        `yaml:"notify-webhook"`
+		NotifyWindow                     time.Duration `yaml:"notify-window"`
+		OpenFileCacheSize                int           `yaml:"open-file-cache-size"`
+		Overrides                        []Override    `yaml:"overrides"`
+		PathNormalization                string        `yaml:"path-normalization"`
+		PermissionsPolicy                []string      `yaml:"permissions-policy"`
+		Plugins                          []Plugin      `yaml:"plugins"`
+		Policy                           []string      `yaml:"policy"`
+		Port                             uint16        `yaml:"port"`
+		PresignCredentials               string        `yaml:"presign-credentials"`
+		PresignExpires                   time.Duration `yaml:"presign-expires"`
+		PresignRegion                    string        `yaml:"presign-region"`
+		PresignURL                       string        `yaml:"presign-url"`
+		ProblemDetails                   bool          `yaml:"problem-details"`
+		Protocols                        []string      `yaml:"protocols"`
+		PurgeWebhook                     string        `yaml:"purge-webhook"`
+		RateLimit                        int           `yaml:"rate-limit"`
+		RateLimitWindow                  time.Duration `yaml:"rate-limit-window"`
+		ReadvBatch                       int           `yaml:"readv-batch"`
+		RetentionDryRun                  bool          `yaml:"retention-dry-run"`
+		RetentionInterval                time.Duration `yaml:"retention-interval"`
+		RetentionKeep                    int           `yaml:"retention-keep"`
+		RetentionMaxAge                  time.Duration `yaml:"retention-max-age"`
+		RetentionPatterns                []string      `yaml:"retention-patterns"`
+		RobotsTxt                        string        `yaml:"robots-txt"`
+		Roots                            bool          `yaml:"roots"`
+		RootsFolders                     []string      `yaml:"roots-folders"`
+		RootsPath                        string        `yaml:"roots-path"`
+		Script                           string        `yaml:"script"`
+		Search                           bool          `yaml:"search"`
+		SearchContents                   bool          `yaml:"search-contents"`
+		SearchIndex                      bool          `yaml:"search-index"`
+		SearchPath                       string        `yaml:"search-path"`
+		SecurityTxtContact               []string      `yaml:"security-txt-contact"`
+		SecurityTxtEncryption            string        `yaml:"security-txt-encryption"`
+		SecurityTxtExpires               string        `yaml:"security-txt-expires"`
+		SecurityTxtPolicy                string        `yaml:"security-txt-policy"`
+		SecurityTxtPreferredLanguages    string        `yaml:"security-txt-preferred-languages"`
+		ServerHeader                     string        `yaml:"server-header"`
+		ShowListing                      bool          `yaml:"show-listing"`
+		Sitemap                          bool          `yaml:"sitemap"`
+		SitemapBaseURL                   string        `yaml:"sitemap-base-url"`
+		SitemapExclude                   []string      `yaml:"sitemap-exclude"`
+		SitemapInclude                   []string      `yaml:"sitemap-include"`
+		SitemapInterval                  time.Duration `yaml:"sitemap-interval"`
+		Stats                            bool          `yaml:"stats"`
+		StatsPath                        string        `yaml:"stats-path"`
+		StripMetadata                    bool          `yaml:"strip-metadata"`
+		SurrogateKeyHeader               string        `yaml:"surrogate-key-header"`
+		SurrogateKeyManifest             string        `yaml:"surrogate-key-manifest"`
+		TemplateVars                     []string      `yaml:"template-vars"`
+		Templates                        bool          `yaml:"templates"`
+		Tenants                          []Tenant      `yaml:"tenants"`
+		TLSCert                          string        `yaml:"tls-cert"`
+		TLSKey                           string        `yaml:"tls-key"`
+		TLSOCSPStapling                  bool          `yaml:"tls-ocsp-stapling"`
+		TLSReloadInterval                time.Duration `yaml:"tls-reload-interval"`
+		TLSSelfSigned                    bool          `yaml:"tls-self-signed"`
+		TLSVaultToken                    string        `yaml:"tls-vault-token"`
+		TLSVaultURL                      string        `yaml:"tls-vault-url"`
+		TraceKey                         string        `yaml:"trace-key"`
+		TransferLimit                    int           `yaml:"transfer-limit"`
+		TransferLimitPerConnection       int           `yaml:"transfer-limit-per-connection"`
+		URLPrefix                        string        `yaml:"url-prefix"`
+		Usage                            bool          `yaml:"usage"`
+		UsagePath                        string        `yaml:"usage-path"`
+		UsagePrefixes                    []string      `yaml:"usage-prefixes"`
+		UsageReportInterval              time.Duration `yaml:"usage-report-interval"`
+		UsageState                       string        `yaml:"usage-state"`
+		UserAgentAllow                   []string      `yaml:"user-agent-allow"`
+		UserAgentDeny                    []string      `yaml:"user-agent-deny"`
+		VideoBurst                       int           `yaml:"video-burst"`
+		VideoPreset                      bool          `yaml:"video-preset"`
+		VideoPresetCORSOrigin            string        `yaml:"video-preset-cors-origin"`
+		VideoPresetPlaylistMaxAge        time.Duration `yaml:"video-preset-playlist-max-age"`
+		VideoPresetSegmentMaxAge         time.Duration `yaml:"video-preset-segment-max-age"`
+		VideoRate                        int           `yaml:"video-rate"`
+		Warmup                           []string      `yaml:"warmup"`
+		WarmupRecent                     int           `yaml:"warmup-recent"`
+		WatchInterval                    time.Duration `yaml:"watch-interval"`
+		WellKnownACMEFolder              string        `yaml:"well-known-acme-folder"`
+		WellKnownPassthrough             []string      `yaml:"well-known-passthrough"`
+		WellKnownRedirects               []string      `yaml:"well-known-redirects"`
 	}
 )
 
+// Override replaces options for requests with URL paths starting with Prefix.
+// Unset options keep their global values. Only available in the configuration
+// file.
+type Override struct {
+	Prefix                           string         `yaml:"prefix"`
+	CacheControl                     string         `yaml:"cache-control"`
+	CacheControlSMaxAge              *time.Duration `yaml:"cache-control-s-maxage"`
+	CacheControlStaleIfError         *time.Duration `yaml:"cache-control-stale-if-error"`
+	CacheControlStaleWhileRevalidate *time.Duration `yaml:"cache-control-stale-while-revalidate"`
+	ETag                             string         `yaml:"etag"`
+	Headers                          []string       `yaml:"headers"`
+	PermissionsPolicy                []string       `yaml:"permissions-policy"`
+	ShowListing                      *bool          `yaml:"show-listing"`
+	UserAgentAllow                   []string       `yaml:"user-agent-allow"`
+	UserAgentDeny                    []string       `yaml:"user-agent-deny"`
+}
+
+// Listener is an additional host and port serving only the URL paths within
+// its prefixes, or all paths if none are listed. The administrative endpoints,
+// such as METRICS_PATH, are only served if Admin is true. Protocols are served
+// as for PROTOCOLS, which applies if unset.
+// Only available in the configuration file.
+type Listener struct {
+	Host      string   `yaml:"host"`
+	Port      uint16   `yaml:"port"`
+	Prefixes  []string `yaml:"prefixes"`
+	Admin     bool     `yaml:"admin"`
+	Protocols []string `yaml:"protocols"`
+}
+
+// Tenant isolates the requests with URL paths starting with Prefix for one of
+// many teams sharing the server, accounting its usage in metrics labelled by
+// Name. Auth is in the form 'scheme:filename' as for AUTH_REALMS, RateLimit
+// is the requests of each client per RateLimitWindow (RATE_LIMIT_WINDOW if
+// unset) and Bandwidth caps the bytes per second of all responses of the
+// tenant. Unset limits do not apply. Only available in the configuration file.
+type Tenant struct {
+	Name            string        `yaml:"name"`
+	Prefix          string        `yaml:"prefix"`
+	Auth            string        `yaml:"auth"`
+	RateLimit       int           `yaml:"rate-limit"`
+	RateLimitWindow time.Duration `yaml:"rate-limit-window"`
+	Bandwidth       int64         `yaml:"bandwidth"`
+}
+
+// Plugin places the middleware registered under Name by an application
+// embedding the server into the pipeline, receiving requests just Before or
+// After the named stage, or last if neither is set. Options are passed to the
+// registered factory. Only available in the configuration file.
+type Plugin struct {
+	Name    string            `yaml:"name"`
+	Before  string            `yaml:"before"`
+	After   string            `yaml:"after"`
+	Options map[string]string `yaml:"options"`
+}
+
 const (
-	debugKey       = "DEBUG"
-	folderKey      = "FOLDER"
-	hostKey        = "HOST"
-	portKey        = "PORT"
-	showListingKey = "SHOW_LISTING"
-	tlsCertKey     = "TLS_CERT"
-	tlsKeyKey      = "TLS_KEY"
-	urlPrefixKey   = "URL_PREFIX"
+	accessLogExcludeKey                 = "ACCESS_LOG_EXCLUDE"
+	accessLogFieldsKey                  = "ACCESS_LOG_FIELDS"
+	accessLogHashKeyKey                 = "ACCESS_LOG_HASH_KEY"
+	accessLogSampleKey                  = "ACCESS_LOG_SAMPLE"
+	alertMinRequestsKey                 = "ALERT_MIN_REQUESTS"
+	alertWindowKey                      = "ALERT_WINDOW"
+	alertsKey                           = "ALERTS"
+	auditLogKey                         = "AUDIT_LOG"
+	authRealmsKey                       = "AUTH_REALMS"
+	cacheControlKey                     = "CACHE_CONTROL"
+	cacheControlSMaxAgeKey              = "CACHE_CONTROL_S_MAXAGE"
+	cacheControlStaleIfErrorKey         = "CACHE_CONTROL_STALE_IF_ERROR"
+	cacheControlStaleWhileRevalidateKey = "CACHE_CONTROL_STALE_WHILE_REVALIDATE"
+	cacheIgnoreQueryKey                 = "CACHE_IGNORE_QUERY"
+	cacheMaxEntrySizeKey                = "CACHE_MAX_ENTRY_SIZE"
+	cacheMaxSizeKey                     = "CACHE_MAX_SIZE"
+	cacheTTLKey                         = "CACHE_TTL"
+	canaryFolderKey                     = "CANARY_FOLDER"
+	canaryPercentKey                    = "CANARY_PERCENT"
+	canaryStickyKey                     = "CANARY_STICKY"
+	cdnPurgeBaseURLKey                  = "CDN_PURGE_BASE_URL"
+	cdnPurgeIDKey                       = "CDN_PURGE_ID"
+	cdnPurgeKey                         = "CDN_PURGE"
+	cdnPurgeTokenKey                    = "CDN_PURGE_TOKEN"
+	checksumStateKey                    = "CHECKSUM_STATE"
+	checksumWorkersKey                  = "CHECKSUM_WORKERS"
+	checksumsKey                        = "CHECKSUMS"
+	configDumpKey                       = "CONFIG_DUMP"
+	configDumpPathKey                   = "CONFIG_DUMP_PATH"
+	contentTypesKey                     = "CONTENT_TYPES"
+	copyBufferSizeKey                   = "COPY_BUFFER_SIZE"
+	corsKey                             = "CORS"
+	crossOriginEmbedderPolicyKey        = "CROSS_ORIGIN_EMBEDDER_POLICY"
+	crossOriginOpenerPolicyKey          = "CROSS_ORIGIN_OPENER_POLICY"
+	crossOriginResourcePolicyKey        = "CROSS_ORIGIN_RESOURCE_POLICY"
+	debugKey                            = "DEBUG"
+	etagKey                             = "ETAG"
+	etagManifestKey                     = "ETAG_MANIFEST"
+	eventsKey                           = "EVENTS"
+	eventsPathKey                       = "EVENTS_PATH"
+	folderKey                           = "FOLDER"
+	geoIPAllowKey                       = "GEOIP_ALLOW"
+	geoIPDenyKey                        = "GEOIP_DENY"
+	geoIPFolderKey                      = "GEOIP_FOLDER"
+	headersKey                          = "HEADERS"
+	hostKey                             = "HOST"
+	imageResizeKey                      = "IMAGE_RESIZE"
+	imageResizeCacheKey                 = "IMAGE_RESIZE_CACHE"
+	imageResizeCacheMaxSizeKey          = "IMAGE_RESIZE_CACHE_MAX_SIZE"
+	imageResizeMaxPixelsKey             = "IMAGE_RESIZE_MAX_PIXELS"
+	imageResizeMaxSizeKey               = "IMAGE_RESIZE_MAX_SIZE"
+	injectBodyKey                       = "INJECT_BODY"
+	injectHeadKey                       = "INJECT_HEAD"
+	lockoutBanTimeKey                   = "LOCKOUT_BAN_TIME"
+	lockoutPathKey                      = "LOCKOUT_PATH"
+	lockoutThresholdKey                 = "LOCKOUT_THRESHOLD"
+	lockoutWindowKey                    = "LOCKOUT_WINDOW"
+	logOutputKey                        = "LOG_OUTPUT"
+	metadataKey                         = "METADATA"
+	metricsKey                          = "METRICS"
+	metricsPathKey                      = "METRICS_PATH"
+	minifyKey                           = "MINIFY"
+	mmapMinSizeKey                      = "MMAP_MIN_SIZE"
+	noiseKey                            = "NOISE"
+	noisePathsKey                       = "NOISE_PATHS"
+	notifyAuthFailuresKey               = "NOTIFY_AUTH_FAILURES"
+	notifyEventsKey                     = "NOTIFY_EVENTS"
+	notifyIntervalKey                   = "NOTIFY_INTERVAL"
+	notifyServerErrorsKey               = "NOTIFY_SERVER_ERRORS"
+	notifyWebhookKey                    = "NOTIFY_WEBHOOK"
+	notifyWindowKey                     = "NOTIFY_WINDOW"
+	openFileCacheSizeKey                = "OPEN_FILE_CACHE_SIZE"
+	pathNormalizationKey                = "PATH_NORMALIZATION"
+	permissionsPolicyKey                = "PERMISSIONS_POLICY"
+	policyKey                           = "POLICY"
+	portKey                             = "PORT"
+	presignCredentialsKey               = "PRESIGN_CREDENTIALS"
+	presignExpiresKey                   = "PRESIGN_EXPIRES"
+	presignRegionKey                    = "PRESIGN_REGION"
+	presignURLKey                       = "PRESIGN_URL"
+	problemDetailsKey                   = "PROBLEM_DETAILS"
+	protocolsKey                        = "PROTOCOLS"
+	purgeWebhookKey                     = "PURGE_WEBHOOK"
+	rateLimitKey                        = "RATE_LIMIT"
+	rateLimitWindowKey                  = "RATE_LIMIT_WINDOW"
+	readvBatchKey                       = "READV_BATCH"
+	retentionDryRunKey                  = "RETENTION_DRY_RUN"
+	retentionIntervalKey                = "RETENTION_INTERVAL"
+	retentionKeepKey                    = "RETENTION_KEEP"
+	retentionMaxAgeKey                  = "RETENTION_MAX_AGE"
+	retentionPatternsKey                = "RETENTION_PATTERNS"
+	robotsTxtKey                        = "ROBOTS_TXT"
+	rootsFoldersKey                     = "ROOTS_FOLDERS"
+	rootsKey                            = "ROOTS"
+	rootsPathKey                        = "ROOTS_PATH"
+	scriptKey                           = "SCRIPT"
+	searchContentsKey                   = "SEARCH_CONTENTS"
+	searchIndexKey                      = "SEARCH_INDEX"
+	searchKey                           = "SEARCH"
+	searchPathKey                       = "SEARCH_PATH"
+	securityTxtContactKey               = "SECURITY_TXT_CONTACT"
+	securityTxtEncryptionKey            = "SECURITY_TXT_ENCRYPTION"
+	securityTxtExpiresKey               = "SECURITY_TXT_EXPIRES"
+	securityTxtPolicyKey                = "SECURITY_TXT_POLICY"
+	securityTxtPreferredLanguagesKey    = "SECURITY_TXT_PREFERRED_LANGUAGES"
+	serverHeaderKey                     = "SERVER_HEADER"
+	showListingKey                      = "SHOW_LISTING"
+	sitemapBaseURLKey                   = "SITEMAP_BASE_URL"
+	sitemapExcludeKey                   = "SITEMAP_EXCLUDE"
+	sitemapIncludeKey                   = "SITEMAP_INCLUDE"
+	sitemapIntervalKey                  = "SITEMAP_INTERVAL"
+	sitemapKey                          = "SITEMAP"
+	statsKey                            = "STATS"
+	statsPathKey                        = "STATS_PATH"
+	stripMetadataKey                    = "STRIP_METADATA"
+	surrogateKeyHeaderKey               = "SURROGATE_KEY_HEADER"
+	surrogateKeyManifestKey             = "SURROGATE_KEY_MANIFEST"
+	templateVarsKey                     = "TEMPLATE_VARS"
+	templatesKey                        = "TEMPLATES"
+	tlsCertKey                          = "TLS_CERT"
+	tlsKeyKey                           = "TLS_KEY"
+	tlsOCSPStaplingKey                  = "TLS_OCSP_STAPLING"
+	tlsReloadIntervalKey                = "TLS_RELOAD_INTERVAL"
+	tlsSelfSignedKey                    = "TLS_SELF_SIGNED"
+	tlsVaultTokenKey                    = "TLS_VAULT_TOKEN"
+	tlsVaultURLKey                      = "TLS_VAULT_URL"
+	traceKeyKey                         = "TRACE_KEY"
+	transferLimitKey                    = "TRANSFER_LIMIT"
+	transferLimitPerConnectionKey       = "TRANSFER_LIMIT_PER_CONNECTION"
+	urlPrefixKey                        = "URL_PREFIX"
+	usageKey                            = "USAGE"
+	usagePathKey                        = "USAGE_PATH"
+	usagePrefixesKey                    = "USAGE_PREFIXES"
+	usageReportIntervalKey              = "USAGE_REPORT_INTERVAL"
+	usageStateKey                       = "USAGE_STATE"
+	userAgentAllowKey                   = "USER_AGENT_ALLOW"
+	userAgentDenyKey                    = "USER_AGENT_DENY"
+	videoBurstKey                       = "VIDEO_BURST"
+	videoPresetKey                      = "VIDEO_PRESET"
+	videoPresetCORSOriginKey            = "VIDEO_PRESET_CORS_ORIGIN"
+	videoPresetPlaylistMaxAgeKey        = "VIDEO_PRESET_PLAYLIST_MAX_AGE"
+	videoPresetSegmentMaxAgeKey         = "VIDEO_PRESET_SEGMENT_MAX_AGE"
+	videoRateKey                        = "VIDEO_RATE"
+	warmupKey                           = "WARMUP"
+	warmupRecentKey                     = "WARMUP_RECENT"
+	watchIntervalKey                    = "WATCH_INTERVAL"
+	wellKnownACMEFolderKey              = "WELL_KNOWN_ACME_FOLDER"
+	wellKnownPassthroughKey             = "WELL_KNOWN_PASSTHROUGH"
+	wellKnownRedirectsKey               = "WELL_KNOWN_REDIRECTS"
 )
 
 const (
-	defaultDebug       = false
-	defaultFolder      = "/web"
-	defaultHost        = ""
-	defaultPort        = uint16(8080)
-	defaultShowListing = true
-	defaultTLSCert     = ""
-	defaultTLSKey      = ""
-	defaultURLPrefix   = ""
+	defaultAccessLogHashKey                 = ""
+	defaultAccessLogSample                  = 1
+	defaultAlertMinRequests                 = 20
+	defaultAlertWindow                      = time.Minute
+	defaultAuditLog                         = ""
+	defaultCacheControl                     = ""
+	defaultCacheControlSMaxAge              = 0
+	defaultCacheControlStaleIfError         = 0
+	defaultCacheControlStaleWhileRevalidate = 0
+	defaultCacheMaxEntrySize                = 1 << 20
+	defaultCacheMaxSize                     = 0
+	defaultCacheTTL                         = time.Minute
+	defaultCanaryFolder                     = ""
+	defaultCanaryPercent                    = 0
+	defaultCanarySticky                     = "cookie"
+	defaultCDNPurge                         = ""
+	defaultCDNPurgeBaseURL                  = ""
+	defaultCDNPurgeID                       = ""
+	defaultCDNPurgeToken                    = ""
+	defaultChecksumState                    = ""
+	defaultChecksumWorkers                  = 0
+	defaultConfigDump                       = false
+	defaultConfigDumpPath                   = "/__config"
+	defaultCopyBufferSize                   = 32 * 1024
+	defaultCrossOriginEmbedderPolicy        = ""
+	defaultCrossOriginOpenerPolicy          = ""
+	defaultCrossOriginResourcePolicy        = ""
+	defaultDebug                            = false
+	defaultETag                             = "none"
+	defaultETagManifest                     = ""
+	defaultEvents                           = false
+	defaultEventsPath                       = "/__events"
+	defaultFolder                           = "/web"
+	defaultGeoIPFolder                      = ""
+	defaultHost                             = ""
+	defaultImageResize                      = false
+	defaultImageResizeCache                 = ""
+	defaultImageResizeCacheMaxSize          = 256 << 20
+	defaultImageResizeMaxPixels             = 40000000
+	defaultImageResizeMaxSize               = 2048
+	defaultInjectBody                       = ""
+	defaultInjectHead                       = ""
+	defaultLockoutBanTime                   = 15 * time.Minute
+	defaultLockoutPath                      = "/__lockout"
+	defaultLockoutThreshold                 = 0
+	defaultLockoutWindow                    = 5 * time.Minute
+	defaultLogOutput                        = ""
+	defaultMetadata                         = false
+	defaultMetrics                          = false
+	defaultMetricsPath                      = "/metrics"
+	defaultMinify                           = false
+	defaultMmapMinSize                      = 0
+	defaultNoise                            = ""
+	defaultNotifyAuthFailures               = 10
+	defaultNotifyInterval                   = 10 * time.Second
+	defaultNotifyServerErrors               = 10
+	defaultNotifyWebhook                    = ""
+	defaultNotifyWindow                     = time.Minute
+	defaultOpenFileCacheSize                = 0
+	defaultPathNormalization                = "off"
+	defaultPort                             = uint16(8080)
+	defaultPresignCredentials               = ""
+	defaultPresignExpires                   = 5 * time.Minute
+	defaultPresignRegion                    = "us-east-1"
+	defaultPresignURL                       = ""
+	defaultProblemDetails                   = false
+	defaultPurgeWebhook                     = ""
+	defaultRateLimit                        = 0
+	defaultRateLimitWindow                  = time.Minute
+	defaultReadvBatch                       = 0
+	defaultRetentionDryRun                  = false
+	defaultRetentionInterval                = time.Hour
+	defaultRetentionKeep                    = 0
+	defaultRetentionMaxAge                  = 0
+	defaultRobotsTxt                        = ""
+	defaultRoots                            = false
+	defaultRootsPath                        = "/__roots"
+	defaultScript                           = ""
+	defaultSearch                           = false
+	defaultSearchContents                   = false
+	defaultSearchIndex                      = false
+	defaultSearchPath                       = "/__search"
+	defaultSecurityTxtEncryption            = ""
+	defaultSecurityTxtExpires               = ""
+	defaultSecurityTxtPolicy                = ""
+	defaultSecurityTxtPreferredLanguages    = ""
+	defaultServerHeader                     = ""
+	defaultShowListing                      = true
+	defaultSitemap                          = false
+	defaultSitemapBaseURL                   = ""
+	defaultSitemapInterval                  = time.Hour
+	defaultStats                            = false
+	defaultStatsPath                        = "/__stats"
+	defaultStripMetadata                    = false
+	defaultSurrogateKeyHeader               = ""
+	defaultSurrogateKeyManifest             = ""
+	defaultTemplates                        = false
+	defaultTLSCert                          = ""
+	defaultTLSKey                           = ""
+	defaultTLSOCSPStapling                  = false
+	defaultTLSReloadInterval                = time.Minute
+	defaultTLSSelfSigned                    = false
+	defaultTLSVaultToken                    = ""
+	defaultTLSVaultURL                      = ""
+	defaultTraceKey                         = ""
+	defaultTransferLimit                    = 0
+	defaultTransferLimitPerConnection       = 0
+	defaultURLPrefix                        = ""
+	defaultUsage                            = false
+	defaultUsagePath                        = "/__usage"
+	defaultUsageReportInterval              = 0
+	defaultUsageState                       = ""
+	defaultVideoBurst                       = 0
+	defaultVideoPreset                      = false
+	defaultVideoPresetCORSOrigin            = ""
+	defaultVideoPresetPlaylistMaxAge        = time.Second
+	defaultVideoPresetSegmentMaxAge         = 24 * time.Hour
+	defaultVideoRate                        = 0
+	defaultWarmupRecent                     = 0
+	defaultWatchInterval                    = 10 * time.Second
+	defaultWellKnownACMEFolder              = ""
+)
+
+var (
+	defaultNoisePaths     = []string{"/favicon.ico", "/apple-touch-icon*.png"}
+	defaultNotifyEvents   = []string{"first-download", "auth-failures", "server-errors", "alerts"}
+	defaultProtocols      = []string{"h2", "http/1.1"}
+	defaultSitemapInclude = []string{"*.html", "*.htm"}
+)
+
+var (
+	// ErrConfigInvalid is matched by errors returned by Load when the
+	// configuration file cannot be parsed or a value fails validation.
+	ErrConfigInvalid = errors.New("invalid configuration")
 )
 
+// invalidError wraps the cause of the configuration being invalid, matching
+// ErrConfigInvalid.
+type invalidError struct {
+	cause error
+}
+
+// Error returns the message of the cause.
+func (err *invalidError) Error() string {
+	return err.cause.Error()
+}
+
+// Is reports whether the target is ErrConfigInvalid.
+func (err *invalidError) Is(target error) bool {
+	return ErrConfigInvalid == target
+}
+
+// Unwrap returns the cause.
+func (err *invalidError) Unwrap() error {
+	return err.cause
+}
+
 func init() {
 	// init calls setDefaults to better support testing.
 	setDefaults()
 }
 
 func setDefaults() {
+	Get.AccessLogExclude = nil
+	Get.AccessLogFields = nil
+	Get.AccessLogHashKey = defaultAccessLogHashKey
+	Get.AccessLogSample = defaultAccessLogSample
+	Get.AlertMinRequests = defaultAlertMinRequests
+	Get.AlertWindow = defaultAlertWindow
+	Get.Alerts = nil
+	Get.AuditLog = defaultAuditLog
+	Get.AuthRealms = nil
+	Get.CacheControl = defaultCacheControl
+	Get.CacheControlSMaxAge = defaultCacheControlSMaxAge
+	Get.CacheControlStaleIfError = defaultCacheControlStaleIfError
+	Get.CacheControlStaleWhileRevalidate = defaultCacheControlStaleWhileRevalidate
+	Get.CacheIgnoreQuery = nil
+	Get.CacheMaxEntrySize = defaultCacheMaxEntrySize
+	Get.CacheMaxSize = defaultCacheMaxSize
+	Get.CacheTTL = defaultCacheTTL
+	Get.CanaryFolder = defaultCanaryFolder
+	Get.CanaryPercent = defaultCanaryPercent
+	Get.CanarySticky = defaultCanarySticky
+	Get.CDNPurge = defaultCDNPurge
+	Get.CDNPurgeBaseURL = defaultCDNPurgeBaseURL
+	Get.CDNPurgeID = defaultCDNPurgeID
+	Get.CDNPurgeToken = defaultCDNPurgeToken
+	Get.ChecksumState = defaultChecksumState
+	Get.ChecksumWorkers = defaultChecksumWorkers
+	Get.Checksums = nil
+	Get.ConfigDump = defaultConfigDump
+	Get.ConfigDumpPath = defaultConfigDumpPath
+	Get.ContentTypes = nil
+	Get.CopyBufferSize = defaultCopyBufferSize
+	Get.CORS = nil
+	Get.CrossOriginEmbedderPolicy = defaultCrossOriginEmbedderPolicy
+	Get.CrossOriginOpenerPolicy = defaultCrossOriginOpenerPolicy
+	Get.CrossOriginResourcePolicy = defaultCrossOriginResourcePolicy
 	Get.Debug = defaultDebug
+	Get.ETag = defaultETag
+	Get.ETagManifest = defaultETagManifest
+	Get.Events = defaultEvents
+	Get.EventsPath = defaultEventsPath
 	Get.Folder = defaultFolder
+	Get.GeoIPAllow = nil
+	Get.GeoIPDeny = nil
+	Get.GeoIPFolder = defaultGeoIPFolder
+	Get.Headers = nil
 	Get.Host = defaultHost
+	Get.ImageResize = defaultImageResize
+	Get.ImageResizeCache = defaultImageResizeCache
+	Get.ImageResizeCacheMaxSize = defaultImageResizeCacheMaxSize
+	Get.ImageResizeMaxPixels = defaultImageResizeMaxPixels
+	Get.ImageResizeMaxSize = defaultImageResizeMaxSize
+	Get.Include = nil
+	Get.InjectBody = defaultInjectBody
+	Get.InjectHead = defaultInjectHead
+	Get.Listeners = nil
+	Get.LockoutBanTime = defaultLockoutBanTime
+	Get.LockoutPath = defaultLockoutPath
+	Get.LockoutThreshold = defaultLockoutThreshold
+	Get.LockoutWindow = defaultLockoutWindow
+	Get.LogOutput = defaultLogOutput
+	Get.Metadata = defaultMetadata
+	Get.Metrics = defaultMetrics
+	Get.MetricsPath = defaultMetricsPath
+	Get.Minify = defaultMinify
+	Get.MmapMinSize = defaultMmapMinSize
+	Get.Noise = defaultNoise
+	Get.NoisePaths = defaultNoisePaths
+	Get.NotifyAuthFailures = defaultNotifyAuthFailures
+	Get.NotifyEvents = defaultNotifyEvents
+	Get.NotifyInterval = defaultNotifyInterval
+	Get.NotifyServerErrors = defaultNotifyServerErrors
+	Get.NotifyWebhook = defaultNotifyWebhook
+	Get.NotifyWindow = defaultNotifyWindow
+	Get.OpenFileCacheSize = defaultOpenFileCacheSize
+	Get.Overrides = nil
+	Get.PathNormalization = defaultPathNormalization
+	Get.PermissionsPolicy = nil
+	Get.Plugins = nil
+	Get.Policy = nil
 	Get.Port = defaultPort
+	Get.PresignCredentials = defaultPresignCredentials
+	Get.PresignExpires = defaultPresignExpires
+	Get.PresignRegion = defaultPresignRegion
+	Get.PresignURL = defaultPresignURL
+	Get.ProblemDetails = defaultProblemDetails
+	Get.Protocols = defaultProtocols
+	Get.PurgeWebhook = defaultPurgeWebhook
+	Get.RateLimit = defaultRateLimit
+	Get.RateLimitWindow = defaultRateLimitWindow
+	Get.ReadvBatch = defaultReadvBatch
+	Get.RetentionDryRun = defaultRetentionDryRun
+	Get.RetentionInterval = defaultRetentionInterval
+	Get.RetentionKeep = defaultRetentionKeep
+	Get.RetentionMaxAge = defaultRetentionMaxAge
+	Get.RetentionPatterns = nil
+	Get.RobotsTxt = defaultRobotsTxt
+	Get.Roots = defaultRoots
+	Get.RootsFolders = nil
+	Get.RootsPath = defaultRootsPath
+	Get.Script = defaultScript
+	Get.Search = defaultSearch
+	Get.SearchContents = defaultSearchContents
+	Get.SearchIndex = defaultSearchIndex
+	Get.SearchPath = defaultSearchPath
+	Get.SecurityTxtContact = nil
+	Get.SecurityTxtEncryption = defaultSecurityTxtEncryption
+	Get.SecurityTxtExpires = defaultSecurityTxtExpires
+	Get.SecurityTxtPolicy = defaultSecurityTxtPolicy
+	Get.SecurityTxtPreferredLanguages = defaultSecurityTxtPreferredLanguages
+	Get.ServerHeader = defaultServerHeader
 	Get.ShowListing = defaultShowListing
+	Get.Sitemap = defaultSitemap
+	Get.SitemapBaseURL = defaultSitemapBaseURL
+	Get.SitemapExclude = nil
+	Get.SitemapInclude = defaultSitemapInclude
+	Get.SitemapInterval = defaultSitemapInterval
+	Get.Stats = defaultStats
+	Get.StatsPath = defaultStatsPath
+	Get.StripMetadata = defaultStripMetadata
+	Get.SurrogateKeyHeader = defaultSurrogateKeyHeader
+	Get.SurrogateKeyManifest = defaultSurrogateKeyManifest
+	Get.TemplateVars = nil
+	Get.Templates = defaultTemplates
+	Get.Tenants = nil
 	Get.TLSCert = defaultTLSCert
 	Get.TLSKey = defaultTLSKey
+	Get.TLSOCSPStapling = defaultTLSOCSPStapling
+	Get.TLSReloadInterval = defaultTLSReloadInterval
+	Get.TLSSelfSigned = defaultTLSSelfSigned
+	Get.TLSVaultToken = defaultTLSVaultToken
+	Get.TLSVaultURL = defaultTLSVaultURL
+	Get.TraceKey = defaultTraceKey
+	Get.TransferLimit = defaultTransferLimit
+	Get.TransferLimitPerConnection = defaultTransferLimitPerConnection
 	Get.URLPrefix = defaultURLPrefix
+	Get.Usage = defaultUsage
+	Get.UsagePath = defaultUsagePath
+	Get.UsagePrefixes = nil
+	Get.UsageReportInterval = defaultUsageReportInterval
+	Get.UsageState = defaultUsageState
+	Get.UserAgentAllow = nil
+	Get.UserAgentDeny = nil
+	Get.VideoBurst = defaultVideoBurst
+	Get.VideoPreset = defaultVideoPreset
+	Get.VideoPresetCORSOrigin = defaultVideoPresetCORSOrigin
+	Get.VideoPresetPlaylistMaxAge = defaultVideoPresetPlaylistMaxAge
+	Get.VideoPresetSegmentMaxAge = defaultVideoPresetSegmentMaxAge
+	Get.VideoRate = defaultVideoRate
+	Get.Warmup = nil
+	Get.WarmupRecent = defaultWarmupRecent
+	Get.WatchInterval = defaultWatchInterval
+	Get.WellKnownACMEFolder = defaultWellKnownACMEFolder
+	Get.WellKnownPassthrough = nil
+	Get.WellKnownRedirects = nil
+}
+
+// Reset the configuration to its defaults, discarding loaded files and
+// environment variables, such as between tests loading configurations.
+func Reset() {
+	setDefaults()
 }
 
 // Load the configuration file.
@@ -71,26 +721,172 @@ func Load(filename string) (err error) {
 		return
 	}
 
+	// Read the configuration file and the files it includes.
+	if err = loadFile(filename, 0); nil != err {
+		return
+	}
+
+	overrideWithEnvVars()
+	if err = validate(); nil != err {
+		return &invalidError{cause: err}
+	}
+	return
+}
+
+// maxIncludeDepth limits nested includes, stopping files including each other.
+const maxIncludeDepth = 8
+
+// loadFile parses the configuration file into 'Get', followed by each file it
+// includes, in order. Paths to included files are relative to the including
+// file and may be globs, such as 'conf.d/*.yml', matching files in name
+// order. Options set by included files replace earlier values, except
+// overrides which are appended.
+func loadFile(filename string, depth int) (err error) {
+	if maxIncludeDepth < depth {
+		return &invalidError{
+			cause: fmt.Errorf("includes of '%s' nested too deeply", filename),
+		}
+	}
+
 	// Read contents from configuration file.
 	var contents []byte
 	if contents, err = ioutil.ReadFile(filename); nil != err {
 		return
 	}
 
-	// Parse contents into 'Get' configuration.
-	if err = yaml.Unmarshal(contents, &Get); nil != err {
-		return
+	// Substitute environment variables, then parse contents into 'Get'
+	// configuration, refusing unknown and duplicate keys so that misspelled
+	// options are not silently ignored.
+	if contents, err = interpolate(contents); nil != err {
+		return &invalidError{cause: fmt.Errorf("%s: %v", filename, err)}
+	}
+	if contents, err = asYAML(filename, contents); nil != err {
+		return &invalidError{cause: fmt.Errorf("%s: %v", filename, err)}
 	}
+	overrides, plugins, tenants := Get.Overrides, Get.Plugins, Get.Tenants
+	includes := Get.Include
+	Get.Overrides, Get.Plugins, Get.Tenants, Get.Include = nil, nil, nil, nil
+	if err = yaml.UnmarshalStrict(contents, &Get); nil != err {
+		return &invalidError{cause: fmt.Errorf("%s: %v", filename, err)}
+	}
+	Get.Overrides = append(overrides, Get.Overrides...)
+	Get.Plugins = append(plugins, Get.Plugins...)
+	Get.Tenants = append(tenants, Get.Tenants...)
+	included := Get.Include
+	Get.Include = append(includes, included...)
 
-	overrideWithEnvVars()
-	return validate()
+	for _, pattern := range included {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if nil != err {
+			return &invalidError{cause: fmt.Errorf("include '%s': %v", pattern, err)}
+		}
+		// Paths without wildcards must exist.
+		if 0 == len(matches) && !strings.ContainsAny(pattern, "*?[") {
+			matches = []string{pattern}
+		}
+		for _, match := range matches {
+			if err = loadFile(match, depth+1); nil != err {
+				return err
+			}
+		}
+	}
+	return
+}
+
+// asYAML converts the contents of JSON ('.json') and TOML ('.toml') files to
+// YAML, so that all formats are parsed with the same rules. Files with other
+// extensions are YAML.
+func asYAML(filename string, contents []byte) ([]byte, error) {
+	var tree interface{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		if err := json.Unmarshal(contents, &tree); nil != err {
+			return nil, err
+		}
+	case ".toml":
+		table, err := parseTOML(contents)
+		if nil != err {
+			return nil, err
+		}
+		tree = table
+	default:
+		return contents, nil
+	}
+	return yaml.Marshal(tree)
+}
+
+// interpolation matches '${VAR}', '${VAR:-fallback}' and the escaped '$${'.
+var interpolation = regexp.MustCompile(
+	`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`,
+)
+
+// alertRule matches the rules of ALERTS, such as '5xx>5', capturing the
+// percent.
+var alertRule = regexp.MustCompile(`^[1-5]xx>([0-9]+(\.[0-9]+)?)$`)
+
+// interpolate replaces '${VAR}' in the contents with the value of the
+// environment variable, or with the fallback of '${VAR:-fallback}' if the
+// variable is unset or empty. Variables without a fallback must be set. Use
+// '$${' for a literal '${'.
+func interpolate(contents []byte) ([]byte, error) {
+	var err error
+	replaced := interpolation.ReplaceAllFunc(contents, func(match []byte) []byte {
+		groups := interpolation.FindSubmatch(match)
+		if nil == groups[1] {
+			return []byte("${")
+		}
+		value, set := os.LookupEnv(string(groups[1]))
+		if nil != groups[2] && 0 == len(value) {
+			return groups[3]
+		}
+		if !set && nil == err {
+			err = fmt.Errorf("environment variable '%s' is not set", groups[1])
+		}
+		return []byte(value)
+	})
+	return replaced, err
+}
+
+// secretKeys are the configuration file keys of options masked by Dump.
+var secretKeys = map[string]bool{
+	"access-log-hash-key": true,
+	"cdn-purge-token":     true,
+	"notify-webhook":      true,
+	"presign-credentials": true,
+	"purge-webhook":       true,
+	"tls-vault-token":     true,
+	"trace-key":           true,
+}
+
+// Dump returns the current configuration as YAML, after merging the
+// configuration file, its includes and environment variables and applying
+// defaults, with the values of secrets masked.
+func Dump() ([]byte, error) {
+	contents, err := yaml.Marshal(&Get)
+	if nil != err {
+		return nil, err
+	}
+	var options yaml.MapSlice
+	if err = yaml.Unmarshal(contents, &options); nil != err {
+		return nil, err
+	}
+	for i, option := range options {
+		if value, _ := option.Value.(string); secretKeys[option.Key.(string)] &&
+			0 < len(value) {
+			options[i].Value = "********"
+		}
+	}
+	return yaml.Marshal(options)
 }
 
 // Log the current configuration.
 func Log() {
 	// YAML marshalling should never error, but if it could, the result is that
 	// the contents of the configuration are not logged.
-	contents, _ := yaml.Marshal(&Get)
+	contents, _ := Dump()
 
 	// Log the configuration.
 	fmt.Println("Using the following configuration:")
@@ -100,14 +896,155 @@ func Log() {
 // overrideWithEnvVars the default values and the configuration file values.
 func overrideWithEnvVars() {
 	// Assign envvars, if set.
+	Get.AccessLogExclude = envAsStrSlice(accessLogExcludeKey, Get.AccessLogExclude)
+	Get.AccessLogFields = envAsStrSlice(accessLogFieldsKey, Get.AccessLogFields)
+	Get.AccessLogHashKey = envAsStr(accessLogHashKeyKey, Get.AccessLogHashKey)
+	Get.AccessLogSample = envAsInt(accessLogSampleKey, Get.AccessLogSample)
+	Get.AlertMinRequests = envAsInt(alertMinRequestsKey, Get.AlertMinRequests)
+	Get.AlertWindow = envAsDuration(alertWindowKey, Get.AlertWindow)
+	Get.Alerts = envAsStrSlice(alertsKey, Get.Alerts)
+	Get.AuditLog = envAsStr(auditLogKey, Get.AuditLog)
+	Get.AuthRealms = envAsLines(authRealmsKey, Get.AuthRealms)
+	Get.CacheControl = envAsStr(cacheControlKey, Get.CacheControl)
+	Get.CacheControlSMaxAge = envAsDuration(cacheControlSMaxAgeKey, Get.CacheControlSMaxAge)
+	Get.CacheControlStaleIfError = envAsDuration(cacheControlStaleIfErrorKey, Get.CacheControlStaleIfError)
+	Get.CacheControlStaleWhileRevalidate = envAsDuration(cacheControlStaleWhileRevalidateKey, Get.CacheControlStaleWhileRevalidate)
+	Get.CacheIgnoreQuery = envAsStrSlice(cacheIgnoreQueryKey, Get.CacheIgnoreQuery)
+	Get.CacheMaxEntrySize = envAsInt(cacheMaxEntrySizeKey, Get.CacheMaxEntrySize)
+	Get.CacheMaxSize = envAsInt(cacheMaxSizeKey, Get.CacheMaxSize)
+	Get.CacheTTL = envAsDuration(cacheTTLKey, Get.CacheTTL)
+	Get.CanaryFolder = envAsStr(canaryFolderKey, Get.CanaryFolder)
+	Get.CanaryPercent = envAsInt(canaryPercentKey, Get.CanaryPercent)
+	Get.CanarySticky = envAsStr(canaryStickyKey, Get.CanarySticky)
+	Get.CDNPurge = envAsStr(cdnPurgeKey, Get.CDNPurge)
+	Get.CDNPurgeBaseURL = envAsStr(cdnPurgeBaseURLKey, Get.CDNPurgeBaseURL)
+	Get.CDNPurgeID = envAsStr(cdnPurgeIDKey, Get.CDNPurgeID)
+	Get.CDNPurgeToken = envAsStr(cdnPurgeTokenKey, Get.CDNPurgeToken)
+	Get.ChecksumState = envAsStr(checksumStateKey, Get.ChecksumState)
+	Get.ChecksumWorkers = envAsInt(checksumWorkersKey, Get.ChecksumWorkers)
+	Get.Checksums = envAsStrSlice(checksumsKey, Get.Checksums)
+	Get.ConfigDump = envAsBool(configDumpKey, Get.ConfigDump)
+	Get.ConfigDumpPath = envAsStr(configDumpPathKey, Get.ConfigDumpPath)
+	Get.ContentTypes = envAsStrSlice(contentTypesKey, Get.ContentTypes)
+	Get.CopyBufferSize = envAsInt(copyBufferSizeKey, Get.CopyBufferSize)
+	Get.CORS = envAsStrSlice(corsKey, Get.CORS)
+	Get.CrossOriginEmbedderPolicy = envAsStr(crossOriginEmbedderPolicyKey, Get.CrossOriginEmbedderPolicy)
+	Get.CrossOriginOpenerPolicy = envAsStr(crossOriginOpenerPolicyKey, Get.CrossOriginOpenerPolicy)
+	Get.CrossOriginResourcePolicy = envAsStr(crossOriginResourcePolicyKey, Get.CrossOriginResourcePolicy)
 	Get.Debug = envAsBool(debugKey, Get.Debug)
+	Get.ETag = envAsStr(etagKey, Get.ETag)
+	Get.ETagManifest = envAsStr(etagManifestKey, Get.ETagManifest)
+	Get.Events = envAsBool(eventsKey, Get.Events)
+	Get.EventsPath = envAsStr(eventsPathKey, Get.EventsPath)
 	Get.Folder = envAsStr(folderKey, Get.Folder)
+	Get.GeoIPAllow = envAsStrSlice(geoIPAllowKey, Get.GeoIPAllow)
+	Get.GeoIPDeny = envAsStrSlice(geoIPDenyKey, Get.GeoIPDeny)
+	Get.GeoIPFolder = envAsStr(geoIPFolderKey, Get.GeoIPFolder)
+	Get.Headers = envAsLines(headersKey, Get.Headers)
 	Get.Host = envAsStr(hostKey, Get.Host)
+	Get.ImageResize = envAsBool(imageResizeKey, Get.ImageResize)
+	Get.ImageResizeCache = envAsStr(imageResizeCacheKey, Get.ImageResizeCache)
+	Get.ImageResizeCacheMaxSize = envAsInt(imageResizeCacheMaxSizeKey, Get.ImageResizeCacheMaxSize)
+	Get.ImageResizeMaxPixels = envAsInt(imageResizeMaxPixelsKey, Get.ImageResizeMaxPixels)
+	Get.ImageResizeMaxSize = envAsInt(imageResizeMaxSizeKey, Get.ImageResizeMaxSize)
+	Get.InjectBody = envAsStr(injectBodyKey, Get.InjectBody)
+	Get.InjectHead = envAsStr(injectHeadKey, Get.InjectHead)
+	Get.LockoutBanTime = envAsDuration(lockoutBanTimeKey, Get.LockoutBanTime)
+	Get.LockoutPath = envAsStr(lockoutPathKey, Get.LockoutPath)
+	Get.LockoutThreshold = envAsInt(lockoutThresholdKey, Get.LockoutThreshold)
+	Get.LockoutWindow = envAsDuration(lockoutWindowKey, Get.LockoutWindow)
+	Get.LogOutput = envAsStr(logOutputKey, Get.LogOutput)
+	Get.Metadata = envAsBool(metadataKey, Get.Metadata)
+	Get.Metrics = envAsBool(metricsKey, Get.Metrics)
+	Get.MetricsPath = envAsStr(metricsPathKey, Get.MetricsPath)
+	Get.Minify = envAsBool(minifyKey, Get.Minify)
+	Get.MmapMinSize = envAsInt(mmapMinSizeKey, Get.MmapMinSize)
+	Get.Noise = envAsStr(noiseKey, Get.Noise)
+	Get.NoisePaths = envAsStrSlice(noisePathsKey, Get.NoisePaths)
+	Get.NotifyAuthFailures = envAsInt(notifyAuthFailuresKey, Get.NotifyAuthFailures)
+	Get.NotifyEvents = envAsStrSlice(notifyEventsKey, Get.NotifyEvents)
+	Get.NotifyInterval = envAsDuration(notifyIntervalKey, Get.NotifyInterval)
+	Get.NotifyServerErrors = envAsInt(notifyServerErrorsKey, Get.NotifyServerErrors)
+	Get.NotifyWebhook = envAsStr(notifyWebhookKey, Get.NotifyWebhook)
+	Get.NotifyWindow = envAsDuration(notifyWindowKey, Get.NotifyWindow)
+	Get.OpenFileCacheSize = envAsInt(openFileCacheSizeKey, Get.OpenFileCacheSize)
+	Get.PathNormalization = envAsStr(pathNormalizationKey, Get.PathNormalization)
+	Get.PermissionsPolicy = envAsLines(permissionsPolicyKey, Get.PermissionsPolicy)
+	Get.Policy = envAsLines(policyKey, Get.Policy)
 	Get.Port = envAsUint16(portKey, Get.Port)
+	Get.PresignCredentials = envAsStr(presignCredentialsKey, Get.PresignCredentials)
+	Get.PresignExpires = envAsDuration(presignExpiresKey, Get.PresignExpires)
+	Get.PresignRegion = envAsStr(presignRegionKey, Get.PresignRegion)
+	Get.PresignURL = envAsStr(presignURLKey, Get.PresignURL)
+	Get.ProblemDetails = envAsBool(problemDetailsKey, Get.ProblemDetails)
+	Get.Protocols = envAsStrSlice(protocolsKey, Get.Protocols)
+	Get.PurgeWebhook = envAsStr(purgeWebhookKey, Get.PurgeWebhook)
+	Get.RateLimit = envAsInt(rateLimitKey, Get.RateLimit)
+	Get.RateLimitWindow = envAsDuration(rateLimitWindowKey, Get.RateLimitWindow)
+	Get.ReadvBatch = envAsInt(readvBatchKey, Get.ReadvBatch)
+	Get.RetentionDryRun = envAsBool(retentionDryRunKey, Get.RetentionDryRun)
+	Get.RetentionInterval = envAsDuration(retentionIntervalKey, Get.RetentionInterval)
+	Get.RetentionKeep = envAsInt(retentionKeepKey, Get.RetentionKeep)
+	Get.RetentionMaxAge = envAsDuration(retentionMaxAgeKey, Get.RetentionMaxAge)
+	Get.RetentionPatterns = envAsStrSlice(retentionPatternsKey, Get.RetentionPatterns)
+	Get.RobotsTxt = envAsStr(robotsTxtKey, Get.RobotsTxt)
+	Get.Roots = envAsBool(rootsKey, Get.Roots)
+	Get.RootsFolders = envAsStrSlice(rootsFoldersKey, Get.RootsFolders)
+	Get.RootsPath = envAsStr(rootsPathKey, Get.RootsPath)
+	Get.Script = envAsStr(scriptKey, Get.Script)
+	Get.Search = envAsBool(searchKey, Get.Search)
+	Get.SearchContents = envAsBool(searchContentsKey, Get.SearchContents)
+	Get.SearchIndex = envAsBool(searchIndexKey, Get.SearchIndex)
+	Get.SearchPath = envAsStr(searchPathKey, Get.SearchPath)
+	Get.SecurityTxtContact = envAsStrSlice(securityTxtContactKey, Get.SecurityTxtContact)
+	Get.SecurityTxtEncryption = envAsStr(securityTxtEncryptionKey, Get.SecurityTxtEncryption)
+	Get.SecurityTxtExpires = envAsStr(securityTxtExpiresKey, Get.SecurityTxtExpires)
+	Get.SecurityTxtPolicy = envAsStr(securityTxtPolicyKey, Get.SecurityTxtPolicy)
+	Get.SecurityTxtPreferredLanguages = envAsStr(securityTxtPreferredLanguagesKey, Get.SecurityTxtPreferredLanguages)
+	Get.ServerHeader = envAsStr(serverHeaderKey, Get.ServerHeader)
 	Get.ShowListing = envAsBool(showListingKey, Get.ShowListing)
+	Get.Sitemap = envAsBool(sitemapKey, Get.Sitemap)
+	Get.SitemapBaseURL = envAsStr(sitemapBaseURLKey, Get.SitemapBaseURL)
+	Get.SitemapExclude = envAsStrSlice(sitemapExcludeKey, Get.SitemapExclude)
+	Get.SitemapInclude = envAsStrSlice(sitemapIncludeKey, Get.SitemapInclude)
+	Get.SitemapInterval = envAsDuration(sitemapIntervalKey, Get.SitemapInterval)
+	Get.Stats = envAsBool(statsKey, Get.Stats)
+	Get.StatsPath = envAsStr(statsPathKey, Get.StatsPath)
+	Get.StripMetadata = envAsBool(stripMetadataKey, Get.StripMetadata)
+	Get.SurrogateKeyHeader = envAsStr(surrogateKeyHeaderKey, Get.SurrogateKeyHeader)
+	Get.SurrogateKeyManifest = envAsStr(surrogateKeyManifestKey, Get.SurrogateKeyManifest)
+	Get.TemplateVars = envAsLines(templateVarsKey, Get.TemplateVars)
+	Get.Templates = envAsBool(templatesKey, Get.Templates)
 	Get.TLSCert = envAsStr(tlsCertKey, Get.TLSCert)
 	Get.TLSKey = envAsStr(tlsKeyKey, Get.TLSKey)
+	Get.TLSOCSPStapling = envAsBool(tlsOCSPStaplingKey, Get.TLSOCSPStapling)
+	Get.TLSReloadInterval = envAsDuration(tlsReloadIntervalKey, Get.TLSReloadInterval)
+	Get.TLSSelfSigned = envAsBool(tlsSelfSignedKey, Get.TLSSelfSigned)
+	Get.TLSVaultToken = envAsStr(tlsVaultTokenKey, Get.TLSVaultToken)
+	Get.TLSVaultURL = envAsStr(tlsVaultURLKey, Get.TLSVaultURL)
+	Get.TraceKey = envAsStr(traceKeyKey, Get.TraceKey)
+	Get.TransferLimit = envAsInt(transferLimitKey, Get.TransferLimit)
+	Get.TransferLimitPerConnection = envAsInt(transferLimitPerConnectionKey, Get.TransferLimitPerConnection)
 	Get.URLPrefix = envAsStr(urlPrefixKey, Get.URLPrefix)
+	Get.Usage = envAsBool(usageKey, Get.Usage)
+	Get.UsagePath = envAsStr(usagePathKey, Get.UsagePath)
+	Get.UsagePrefixes = envAsStrSlice(usagePrefixesKey, Get.UsagePrefixes)
+	Get.UsageReportInterval = envAsDuration(usageReportIntervalKey, Get.UsageReportInterval)
+	Get.UsageState = envAsStr(usageStateKey, Get.UsageState)
+	Get.UserAgentAllow = envAsStrSlice(userAgentAllowKey, Get.UserAgentAllow)
+	Get.UserAgentDeny = envAsStrSlice(userAgentDenyKey, Get.UserAgentDeny)
+	Get.VideoBurst = envAsInt(videoBurstKey, Get.VideoBurst)
+	Get.VideoPreset = envAsBool(videoPresetKey, Get.VideoPreset)
+	Get.VideoPresetCORSOrigin = envAsStr(videoPresetCORSOriginKey, Get.VideoPresetCORSOrigin)
+	Get.VideoPresetPlaylistMaxAge = envAsDuration(videoPresetPlaylistMaxAgeKey, Get.VideoPresetPlaylistMaxAge)
+	Get.VideoPresetSegmentMaxAge = envAsDuration(videoPresetSegmentMaxAgeKey, Get.VideoPresetSegmentMaxAge)
+	Get.VideoRate = envAsInt(videoRateKey, Get.VideoRate)
+	Get.Warmup = envAsStrSlice(warmupKey, Get.Warmup)
+	Get.WarmupRecent = envAsInt(warmupRecentKey, Get.WarmupRecent)
+	Get.WatchInterval = envAsDuration(watchIntervalKey, Get.WatchInterval)
+	Get.WellKnownACMEFolder = envAsStr(wellKnownACMEFolderKey, Get.WellKnownACMEFolder)
+	Get.WellKnownPassthrough = envAsStrSlice(wellKnownPassthroughKey, Get.WellKnownPassthrough)
+	Get.WellKnownRedirects = envAsStrSlice(wellKnownRedirectsKey, Get.WellKnownRedirects)
 }
 
 // validate the configuration.
@@ -130,6 +1067,677 @@ func validate() error {
 		}
 	}
 
+	// If a self-signed certificate is generated, verify none is supplied.
+	if Get.TLSSelfSigned && 0 < len(Get.TLSCert) {
+		msg := "if value for 'TLS_SELF_SIGNED' is 'true' then the value for " +
+			"'TLS_CERT' must not be set (current value of '%s')"
+		return fmt.Errorf(msg, Get.TLSCert)
+	}
+
+	// If the certificate is kept in Vault, verify it is the only source and
+	// can be read.
+	if 0 < len(Get.TLSVaultURL) {
+		if Get.TLSSelfSigned || 0 < len(Get.TLSCert) {
+			msg := "if value for 'TLS_VAULT_URL' is set then 'TLS_CERT' and " +
+				"'TLS_SELF_SIGNED' must not be set"
+			return errors.New(msg)
+		}
+		if u, err := url.Parse(Get.TLSVaultURL); nil != err ||
+			("http" != u.Scheme && "https" != u.Scheme) || 0 == len(u.Host) {
+			msg := "value for 'TLS_VAULT_URL' must be an HTTP or HTTPS URL " +
+				"(current value of '%s')"
+			return fmt.Errorf(msg, Get.TLSVaultURL)
+		}
+		if 0 == len(Get.TLSVaultToken) {
+			msg := "if value for 'TLS_VAULT_URL' is set then the value for " +
+				"'TLS_VAULT_TOKEN' must also be set"
+			return errors.New(msg)
+		}
+	}
+
+	// If the certificate is reloaded, verify the interval is sensible.
+	if (0 < len(Get.TLSCert) || 0 < len(Get.TLSVaultURL)) && 0 >= Get.TLSReloadInterval {
+		msg := "if value for 'TLS_CERT' or 'TLS_VAULT_URL' is set then the " +
+			"value for 'TLS_RELOAD_INTERVAL' must be positive (current value of %s)"
+		return fmt.Errorf(msg, Get.TLSReloadInterval)
+	}
+
+	// OCSP responses are stapled to the certificate files or Vault secret.
+	if Get.TLSOCSPStapling && 0 == len(Get.TLSCert) && 0 == len(Get.TLSVaultURL) {
+		msg := "if value for 'TLS_OCSP_STAPLING' is 'true' then the value for " +
+			"either 'TLS_CERT' or 'TLS_VAULT_URL' must be set"
+		return errors.New(msg)
+	}
+
+	// Verify only supported protocols are advertised.
+	if err := validateProtocols("value for 'PROTOCOLS'", Get.Protocols); nil != err {
+		return err
+	}
+
+	// If countries are to be allowed or denied, verify a database is provided.
+	if 0 < len(Get.GeoIPAllow)+len(Get.GeoIPDeny) && 0 == len(Get.GeoIPFolder) {
+		msg := "if value for either 'GEOIP_ALLOW' or 'GEOIP_DENY' is set " +
+			"then value for 'GEOIP_FOLDER' must also be set"
+		return errors.New(msg)
+	}
+
+	// If cross-origin policies are set, verify they are known.
+	policies := []struct {
+		key, value string
+		allowed    []string
+	}{
+		{crossOriginEmbedderPolicyKey, Get.CrossOriginEmbedderPolicy, []string{
+			"unsafe-none", "require-corp", "credentialless",
+		}},
+		{crossOriginOpenerPolicyKey, Get.CrossOriginOpenerPolicy, []string{
+			"unsafe-none", "same-origin-allow-popups", "same-origin",
+			"noopener-allow-popups",
+		}},
+		{crossOriginResourcePolicyKey, Get.CrossOriginResourcePolicy, []string{
+			"same-site", "same-origin", "cross-origin",
+		}},
+	}
+	for _, policy := range policies {
+		if 0 == len(policy.value) {
+			continue
+		}
+		known := false
+		for _, allowed := range policy.allowed {
+			known = known || allowed == policy.value
+		}
+		if !known {
+			msg := "value of '%s' must be one of '%s' (current value of '%s')"
+			return fmt.Errorf(
+				msg, policy.key, strings.Join(policy.allowed, "', '"), policy.value,
+			)
+		}
+	}
+
+	// If ETags are to be generated, verify the strategies are known and the
+	// manifest is provided when needed.
+	strategies := []string{Get.ETag}
+	for _, override := range Get.Overrides {
+		strategies = append(strategies, override.ETag)
+	}
+	for i, strategy := range strategies {
+		if 0 < i && 0 == len(strategy) {
+			continue
+		}
+		switch strategy {
+		case "none", "weak", "strong":
+		case "manifest":
+			if 0 == len(Get.ETagManifest) {
+				msg := "if value for 'ETAG' is 'manifest' then the value for " +
+					"'ETAG_MANIFEST' must also be set"
+				return errors.New(msg)
+			}
+		default:
+			msg := "value of 'ETAG' must be 'none', 'weak', 'strong' or " +
+				"'manifest' (current value of '%s')"
+			return fmt.Errorf(msg, strategy)
+		}
+	}
+
+	// If a canary release is served, verify its folder, share and stickiness.
+	if 0 < len(Get.CanaryFolder) {
+		if info, err := os.Stat(Get.CanaryFolder); nil != err || !info.IsDir() {
+			msg := "value of 'CANARY_FOLDER' must be a folder but '%s' is not"
+			return fmt.Errorf(msg, Get.CanaryFolder)
+		}
+		if 0 > Get.CanaryPercent || 100 < Get.CanaryPercent {
+			msg := "value of 'CANARY_PERCENT' must be from 0 to 100 " +
+				"(current value of %d)"
+			return fmt.Errorf(msg, Get.CanaryPercent)
+		}
+		if "cookie" != Get.CanarySticky && "ip" != Get.CanarySticky {
+			msg := "value of 'CANARY_STICKY' must be 'cookie' or 'ip' " +
+				"(current value of '%s')"
+			return fmt.Errorf(msg, Get.CanarySticky)
+		}
+	}
+
+	// Verify the policy for ambiguous URL paths.
+	switch Get.PathNormalization {
+	case "reject", "normalize", "off":
+	default:
+		msg := "value of 'PATH_NORMALIZATION' must be 'reject', 'normalize' " +
+			"or 'off' (current value of '%s')"
+		return fmt.Errorf(msg, Get.PathNormalization)
+	}
+
+	// If noise requests are answered, verify the response and path patterns.
+	if 0 < len(Get.Noise) {
+		if "no-content" != Get.Noise && "synthesize" != Get.Noise {
+			msg := "value of 'NOISE' must be 'no-content' or 'synthesize' " +
+				"(current value of '%s')"
+			return fmt.Errorf(msg, Get.Noise)
+		}
+		for _, pattern := range Get.NoisePaths {
+			if _, err := path.Match(pattern, ""); nil != err {
+				msg := "values of 'NOISE_PATHS' must be valid patterns but " +
+					"'%s' returns %v"
+				return fmt.Errorf(msg, pattern, err)
+			}
+		}
+	}
+
+	// If robots.txt is to be generated, verify the policy or template exists.
+	if 0 < len(Get.RobotsTxt) && "allow" != Get.RobotsTxt && "deny" != Get.RobotsTxt {
+		if _, err := os.Stat(Get.RobotsTxt); nil != err {
+			msg := "value of 'ROBOTS_TXT' must be 'allow', 'deny' or the " +
+				"filename of a template but '%s' returns %v"
+			return fmt.Errorf(msg, Get.RobotsTxt, err)
+		}
+	}
+
+	// If artifacts are retained, verify the patterns and limits are sensible.
+	if 0 < len(Get.RetentionPatterns) {
+		for _, pattern := range Get.RetentionPatterns {
+			if _, err := path.Match(pattern, ""); nil != err {
+				msg := "values of 'RETENTION_PATTERNS' must be valid patterns " +
+					"but '%s' returns %v"
+				return fmt.Errorf(msg, pattern, err)
+			}
+		}
+		if 0 > Get.RetentionKeep || 0 > Get.RetentionMaxAge ||
+			0 >= Get.RetentionInterval {
+			msg := "if value for 'RETENTION_PATTERNS' is set then the values " +
+				"for 'RETENTION_KEEP' and 'RETENTION_MAX_AGE' must not be " +
+				"negative and the value for 'RETENTION_INTERVAL' must be " +
+				"positive (values are currently %d, %s and %s, respectively)"
+			return fmt.Errorf(
+				msg, Get.RetentionKeep, Get.RetentionMaxAge, Get.RetentionInterval,
+			)
+		}
+	}
+
+	// If roots are switched, verify each is a named folder.
+	if Get.Roots {
+		for _, root := range Get.RootsFolders {
+			index := strings.Index(root, "=")
+			if 0 >= index || "default" == root[:index] {
+				msg := "values of 'ROOTS_FOLDERS' must be in the form " +
+					"'name=folder' with a name other than 'default' (current " +
+					"value of '%s')"
+				return fmt.Errorf(msg, root)
+			}
+			folder := root[index+1:]
+			if info, err := os.Stat(folder); nil != err || !info.IsDir() {
+				msg := "values of 'ROOTS_FOLDERS' must name a folder but " +
+					"'%s' is not"
+				return fmt.Errorf(msg, folder)
+			}
+		}
+	}
+
+	// If templates are rendered, verify each variable is in the form
+	// 'name=value' with a name templates can reference.
+	for _, variable := range Get.TemplateVars {
+		index := strings.Index(variable, "=")
+		if 0 >= index || !validTemplateName(variable[:index]) {
+			msg := "values of 'TEMPLATE_VARS' must be in the form 'name=value' " +
+				"where the name is letters, digits and underscores not starting " +
+				"with a digit (current value of '%s')"
+			return fmt.Errorf(msg, variable)
+		}
+	}
+
+	// If images are resized, verify the limits are sensible.
+	if Get.ImageResize && (0 >= Get.ImageResizeMaxSize || 0 >= Get.ImageResizeMaxPixels) {
+		msg := "if 'IMAGE_RESIZE' is enabled then the values for " +
+			"'IMAGE_RESIZE_MAX_SIZE' and 'IMAGE_RESIZE_MAX_PIXELS' must be " +
+			"positive (values are currently %d and %d, respectively)"
+		return fmt.Errorf(msg, Get.ImageResizeMaxSize, Get.ImageResizeMaxPixels)
+	}
+	if Get.ImageResize && 0 < len(Get.ImageResizeCache) && 0 >= Get.ImageResizeCacheMaxSize {
+		msg := "if value for 'IMAGE_RESIZE_CACHE' is set then the value for " +
+			"'IMAGE_RESIZE_CACHE_MAX_SIZE' must be positive (current value of %d)"
+		return fmt.Errorf(msg, Get.ImageResizeCacheMaxSize)
+	}
+
+	// If requests are scripted, verify the script exists.
+	if 0 < len(Get.Script) {
+		if _, err := os.Stat(Get.Script); nil != err {
+			msg := "value of 'SCRIPT' must be the filename of a script but " +
+				"'%s' returns %v"
+			return fmt.Errorf(msg, Get.Script, err)
+		}
+	}
+
+	// If ACME challenges are served, verify their folder exists.
+	if 0 < len(Get.WellKnownACMEFolder) {
+		if info, err := os.Stat(Get.WellKnownACMEFolder); nil != err || !info.IsDir() {
+			msg := "value of 'WELL_KNOWN_ACME_FOLDER' must be a folder but " +
+				"'%s' is not"
+			return fmt.Errorf(msg, Get.WellKnownACMEFolder)
+		}
+	}
+
+	// If security.txt is to be generated, verify the required fields are set.
+	if 0 < len(Get.SecurityTxtContact) || 0 < len(Get.SecurityTxtExpires) ||
+		0 < len(Get.SecurityTxtEncryption) || 0 < len(Get.SecurityTxtPolicy) ||
+		0 < len(Get.SecurityTxtPreferredLanguages) {
+		if 0 == len(Get.SecurityTxtContact) || 0 == len(Get.SecurityTxtExpires) {
+			msg := "if any 'SECURITY_TXT_*' value is set then values for " +
+				"'SECURITY_TXT_CONTACT' and 'SECURITY_TXT_EXPIRES' must be set"
+			return errors.New(msg)
+		}
+		if _, err := time.Parse(time.RFC3339, Get.SecurityTxtExpires); nil != err {
+			msg := "value of 'SECURITY_TXT_EXPIRES' must be an RFC 3339 " +
+				"timestamp (e.g. '2030-01-01T00:00:00Z') but got %v"
+			return fmt.Errorf(msg, err)
+		}
+	}
+
+	// If options are overridden, verify each prefix is absolute and unique.
+	prefixes := make(map[string]struct{}, len(Get.Overrides))
+	for _, override := range Get.Overrides {
+		if !strings.HasPrefix(override.Prefix, "/") {
+			msg := "value of 'prefix' for each of 'overrides' must start " +
+				"with '/' (current value of '%s')"
+			return fmt.Errorf(msg, override.Prefix)
+		}
+		if _, found := prefixes[override.Prefix]; found {
+			msg := "value of 'prefix' for each of 'overrides' must be " +
+				"unique but '%s' is repeated"
+			return fmt.Errorf(msg, override.Prefix)
+		}
+		prefixes[override.Prefix] = struct{}{}
+	}
+
+	// If tenants are configured, verify each is named, has an absolute prefix
+	// and has no negative limits.
+	names := make(map[string]struct{}, len(Get.Tenants))
+	prefixes = make(map[string]struct{}, len(Get.Tenants))
+	for _, tenant := range Get.Tenants {
+		if 0 == len(tenant.Name) {
+			msg := "value of 'name' for each of 'tenants' must be set"
+			return errors.New(msg)
+		}
+		if _, found := names[tenant.Name]; found {
+			msg := "value of 'name' for each of 'tenants' must be unique but " +
+				"'%s' is repeated"
+			return fmt.Errorf(msg, tenant.Name)
+		}
+		names[tenant.Name] = struct{}{}
+		if !strings.HasPrefix(tenant.Prefix, "/") {
+			msg := "value of 'prefix' for each of 'tenants' must start with " +
+				"'/' (current value of '%s')"
+			return fmt.Errorf(msg, tenant.Prefix)
+		}
+		if _, found := prefixes[tenant.Prefix]; found {
+			msg := "value of 'prefix' for each of 'tenants' must be unique " +
+				"but '%s' is repeated"
+			return fmt.Errorf(msg, tenant.Prefix)
+		}
+		prefixes[tenant.Prefix] = struct{}{}
+		if 0 > tenant.RateLimit || 0 > tenant.RateLimitWindow || 0 > tenant.Bandwidth {
+			msg := "values of 'rate-limit', 'rate-limit-window' and " +
+				"'bandwidth' of tenant '%s' must not be negative"
+			return fmt.Errorf(msg, tenant.Name)
+		}
+	}
+
+	// If plugins are configured, verify each is named and placed relative to
+	// at most one stage. Names and stages are verified by the pipeline.
+	for _, plugin := range Get.Plugins {
+		if 0 == len(plugin.Name) {
+			msg := "value of 'name' for each of 'plugins' must be set"
+			return errors.New(msg)
+		}
+		if 0 < len(plugin.Before) && 0 < len(plugin.After) {
+			msg := "only one of 'before' and 'after' of plugin '%s' may be set"
+			return fmt.Errorf(msg, plugin.Name)
+		}
+	}
+
+	// If additional listeners are configured, verify each binds a distinct
+	// port and serves absolute prefixes.
+	bindings := map[string]struct{}{fmt.Sprintf("%s:%d", Get.Host, Get.Port): {}}
+	for _, listener := range Get.Listeners {
+		binding := fmt.Sprintf("%s:%d", listener.Host, listener.Port)
+		if 0 == listener.Port {
+			msg := "value of 'port' for each of 'listeners' must be set"
+			return errors.New(msg)
+		}
+		if _, found := bindings[binding]; found {
+			msg := "value of 'host' and 'port' for each of 'listeners' must be " +
+				"unique but '%s' is repeated"
+			return fmt.Errorf(msg, binding)
+		}
+		bindings[binding] = struct{}{}
+		for _, prefix := range listener.Prefixes {
+			if !strings.HasPrefix(prefix, "/") {
+				msg := "value of 'prefixes' for each of 'listeners' must start " +
+					"with '/' (current value of '%s')"
+				return fmt.Errorf(msg, prefix)
+			}
+		}
+		if 0 < len(listener.Protocols) {
+			name := "value of 'protocols' for each of 'listeners'"
+			if err := validateProtocols(name, listener.Protocols); nil != err {
+				return err
+			}
+		}
+	}
+
+	// If endpoints are enabled, verify their paths are absolute.
+	endpoints := []struct {
+		enabled      bool
+		key, pathKey string
+		endpointPath string
+	}{
+		{Get.Metrics, metricsKey, metricsPathKey, Get.MetricsPath},
+		{Get.Events, eventsKey, eventsPathKey, Get.EventsPath},
+		{0 < Get.LockoutThreshold, lockoutThresholdKey, lockoutPathKey, Get.LockoutPath},
+		{Get.Search, searchKey, searchPathKey, Get.SearchPath},
+		{Get.Stats, statsKey, statsPathKey, Get.StatsPath},
+		{Get.ConfigDump, configDumpKey, configDumpPathKey, Get.ConfigDumpPath},
+		{Get.Roots, rootsKey, rootsPathKey, Get.RootsPath},
+		{Get.Usage, usageKey, usagePathKey, Get.UsagePath},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.enabled && !strings.HasPrefix(endpoint.endpointPath, "/") {
+			msg := "if '%s' is enabled then the value for '%s' " +
+				"must start with '/' (current value of '%s')"
+			return fmt.Errorf(
+				msg, endpoint.key, endpoint.pathKey, endpoint.endpointPath,
+			)
+		}
+	}
+
+	// If lockout is enabled, verify the durations are sensible.
+	if 0 < Get.LockoutThreshold &&
+		(0 >= Get.LockoutWindow || 0 >= Get.LockoutBanTime) {
+		msg := "if value for 'LOCKOUT_THRESHOLD' is set then the values for " +
+			"'LOCKOUT_WINDOW' and 'LOCKOUT_BAN_TIME' must be positive (values " +
+			"are currently %s and %s, respectively)"
+		return fmt.Errorf(msg, Get.LockoutWindow, Get.LockoutBanTime)
+	}
+
+	// If rate limiting is enabled, verify the window is sensible.
+	if 0 < Get.RateLimit && 0 >= Get.RateLimitWindow {
+		msg := "if value for 'RATE_LIMIT' is set then the value for " +
+			"'RATE_LIMIT_WINDOW' must be positive (current value of %s)"
+		return fmt.Errorf(msg, Get.RateLimitWindow)
+	}
+
+	// If the log is shipped, verify the destination is supported.
+	if 0 < len(Get.LogOutput) {
+		supported := false
+		for _, prefix := range []string{
+			"gelf+udp://", "gelf+tcp://", "syslog+udp://", "syslog+tcp://",
+		} {
+			supported = supported || strings.HasPrefix(Get.LogOutput, prefix)
+		}
+		if !supported {
+			msg := "value of 'LOG_OUTPUT' must start with 'gelf+udp://', " +
+				"'gelf+tcp://', 'syslog+udp://' or 'syslog+tcp://' (current " +
+				"value of '%s')"
+			return fmt.Errorf(msg, Get.LogOutput)
+		}
+	}
+
+	// If the access log is sampled, verify the rate is sensible.
+	if 1 > Get.AccessLogSample {
+		msg := "value of 'ACCESS_LOG_SAMPLE' must be at least 1 (current " +
+			"value of %d)"
+		return fmt.Errorf(msg, Get.AccessLogSample)
+	}
+
+	// If alerts are raised, verify the rules, window and minimum requests.
+	for _, rule := range Get.Alerts {
+		match := alertRule.FindStringSubmatch(rule)
+		percent := 100.0
+		if nil != match {
+			percent, _ = strconv.ParseFloat(match[1], 64)
+		}
+		if 100 <= percent {
+			msg := "values of 'ALERTS' must be a status class and a percent " +
+				"below 100, such as '5xx>5' (current value of '%s')"
+			return fmt.Errorf(msg, rule)
+		}
+	}
+	if 0 < len(Get.Alerts) && (0 >= Get.AlertWindow || 1 > Get.AlertMinRequests) {
+		msg := "values for 'ALERT_WINDOW' and 'ALERT_MIN_REQUESTS' must be " +
+			"positive"
+		return errors.New(msg)
+	}
+
+	// If transfers are limited, verify the limits are not negative.
+	if 0 > Get.TransferLimit || 0 > Get.TransferLimitPerConnection {
+		msg := "values for 'TRANSFER_LIMIT' and 'TRANSFER_LIMIT_PER_CONNECTION' " +
+			"must not be negative (values are currently %d and %d, respectively)"
+		return fmt.Errorf(msg, Get.TransferLimit, Get.TransferLimitPerConnection)
+	}
+
+	// If videos are throttled, verify the burst and rate are not negative.
+	if 0 > Get.VideoBurst || 0 > Get.VideoRate {
+		msg := "values for 'VIDEO_BURST' and 'VIDEO_RATE' must not be " +
+			"negative (values are currently %d and %d, respectively)"
+		return fmt.Errorf(msg, Get.VideoBurst, Get.VideoRate)
+	}
+
+	// If the video preset is enabled, verify the durations and CORS origin.
+	if Get.VideoPreset {
+		if 0 > Get.VideoPresetPlaylistMaxAge || 0 > Get.VideoPresetSegmentMaxAge {
+			msg := "if 'VIDEO_PRESET' is enabled then the values for " +
+				"'VIDEO_PRESET_PLAYLIST_MAX_AGE' and " +
+				"'VIDEO_PRESET_SEGMENT_MAX_AGE' must not be negative (values " +
+				"are currently %s and %s, respectively)"
+			return fmt.Errorf(
+				msg, Get.VideoPresetPlaylistMaxAge, Get.VideoPresetSegmentMaxAge,
+			)
+		}
+		origin := Get.VideoPresetCORSOrigin
+		if 0 < len(origin) && "*" != origin &&
+			!strings.HasPrefix(origin, "http://") &&
+			!strings.HasPrefix(origin, "https://") {
+			msg := "value of 'VIDEO_PRESET_CORS_ORIGIN' must be '*' or an " +
+				"'http://' or 'https://' origin (current value of '%s')"
+			return fmt.Errorf(msg, origin)
+		}
+	}
+
+	// If Cache-Control directives are set, verify they are not negative.
+	if 0 > Get.CacheControlSMaxAge || 0 > Get.CacheControlStaleIfError ||
+		0 > Get.CacheControlStaleWhileRevalidate {
+		msg := "values for 'CACHE_CONTROL_S_MAXAGE', " +
+			"'CACHE_CONTROL_STALE_IF_ERROR' and " +
+			"'CACHE_CONTROL_STALE_WHILE_REVALIDATE' must not be negative " +
+			"(values are currently %s, %s and %s, respectively)"
+		return fmt.Errorf(
+			msg,
+			Get.CacheControlSMaxAge,
+			Get.CacheControlStaleIfError,
+			Get.CacheControlStaleWhileRevalidate,
+		)
+	}
+
+	// If changes are to be purged, verify the webhook and interval.
+	if 0 < len(Get.PurgeWebhook) {
+		if !strings.HasPrefix(Get.PurgeWebhook, "http://") &&
+			!strings.HasPrefix(Get.PurgeWebhook, "https://") {
+			msg := "value of 'PURGE_WEBHOOK' must be an 'http://' or " +
+				"'https://' URL (current value of '%s')"
+			return fmt.Errorf(msg, Get.PurgeWebhook)
+		}
+	}
+
+	// If access events are to be notified, verify the webhook, events and
+	// thresholds.
+	if 0 < len(Get.NotifyWebhook) {
+		if !strings.HasPrefix(Get.NotifyWebhook, "http://") &&
+			!strings.HasPrefix(Get.NotifyWebhook, "https://") {
+			msg := "value of 'NOTIFY_WEBHOOK' must be an 'http://' or " +
+				"'https://' URL (current value of '%s')"
+			return fmt.Errorf(msg, Get.NotifyWebhook)
+		}
+		for _, event := range Get.NotifyEvents {
+			switch event {
+			case "first-download", "auth-failures", "server-errors", "alerts":
+			default:
+				msg := "values of 'NOTIFY_EVENTS' must be 'first-download', " +
+					"'auth-failures', 'server-errors' or 'alerts' (current " +
+					"value of '%s')"
+				return fmt.Errorf(msg, event)
+			}
+			if "first-download" == event && 0 >= Get.WatchInterval {
+				msg := "if 'NOTIFY_EVENTS' includes 'first-download' then the " +
+					"value for 'WATCH_INTERVAL' must be positive (current " +
+					"value of %s)"
+				return fmt.Errorf(msg, Get.WatchInterval)
+			}
+		}
+		if 1 > Get.NotifyAuthFailures || 1 > Get.NotifyServerErrors ||
+			0 >= Get.NotifyInterval || 0 >= Get.NotifyWindow {
+			msg := "values for 'NOTIFY_AUTH_FAILURES', 'NOTIFY_SERVER_ERRORS', " +
+				"'NOTIFY_INTERVAL' and 'NOTIFY_WINDOW' must be positive"
+			return errors.New(msg)
+		}
+	}
+
+	// If changes are to be purged from a CDN, verify the provider and its
+	// credentials.
+	if 0 < len(Get.CDNPurge) {
+		switch Get.CDNPurge {
+		case "cloudflare", "cloudfront", "fastly":
+		default:
+			msg := "value of 'CDN_PURGE' must be 'cloudflare', 'cloudfront' or " +
+				"'fastly' (current value of '%s')"
+			return fmt.Errorf(msg, Get.CDNPurge)
+		}
+		if 0 == len(Get.CDNPurgeID) || 0 == len(Get.CDNPurgeToken) {
+			msg := "if value for 'CDN_PURGE' is set then the values for " +
+				"'CDN_PURGE_ID' and 'CDN_PURGE_TOKEN' must also be set"
+			return errors.New(msg)
+		}
+		if "cloudflare" == Get.CDNPurge && 0 == len(Get.CDNPurgeBaseURL) {
+			msg := "if value for 'CDN_PURGE' is 'cloudflare' then the value " +
+				"for 'CDN_PURGE_BASE_URL' must also be set"
+			return errors.New(msg)
+		}
+		if 0 < len(Get.CDNPurgeBaseURL) &&
+			!strings.HasPrefix(Get.CDNPurgeBaseURL, "http://") &&
+			!strings.HasPrefix(Get.CDNPurgeBaseURL, "https://") {
+			msg := "value of 'CDN_PURGE_BASE_URL' must be an 'http://' or " +
+				"'https://' URL (current value of '%s')"
+			return fmt.Errorf(msg, Get.CDNPurgeBaseURL)
+		}
+	}
+	// Locations of the sitemap must not depend on the 'Host' of requests, which
+	// clients choose, as the sitemap may be kept by caches.
+	if Get.Sitemap &&
+		!strings.HasPrefix(Get.SitemapBaseURL, "http://") &&
+		!strings.HasPrefix(Get.SitemapBaseURL, "https://") {
+		msg := "if 'SITEMAP' is enabled then the value of 'SITEMAP_BASE_URL' " +
+			"must be an 'http://' or 'https://' URL (current value of '%s')"
+		return fmt.Errorf(msg, Get.SitemapBaseURL)
+	}
+	if Get.Events && 0 >= Get.WatchInterval {
+		msg := "if 'EVENTS' is enabled then the value for 'WATCH_INTERVAL' " +
+			"must be positive (current value of %s)"
+		return fmt.Errorf(msg, Get.WatchInterval)
+	}
+	if Get.Search && Get.SearchIndex && 0 >= Get.WatchInterval {
+		msg := "if 'SEARCH_INDEX' is enabled then the value for " +
+			"'WATCH_INTERVAL' must be positive (current value of %s)"
+		return fmt.Errorf(msg, Get.WatchInterval)
+	}
+	if 0 < len(Get.PurgeWebhook)+len(Get.CDNPurge) && 0 >= Get.WatchInterval {
+		msg := "if value for 'PURGE_WEBHOOK' or 'CDN_PURGE' is set then the " +
+			"value for 'WATCH_INTERVAL' must be positive (current value of %s)"
+		return fmt.Errorf(msg, Get.WatchInterval)
+	}
+
+	// If caching is enabled, verify the sizes are sensible.
+	if 0 > Get.CacheMaxSize || 0 > Get.CacheMaxEntrySize {
+		msg := "values for 'CACHE_MAX_SIZE' and 'CACHE_MAX_ENTRY_SIZE' must " +
+			"not be negative (values are currently %d and %d, respectively)"
+		return fmt.Errorf(msg, Get.CacheMaxSize, Get.CacheMaxEntrySize)
+	}
+
+	if 0 >= Get.CopyBufferSize {
+		msg := "value for 'COPY_BUFFER_SIZE' must be positive (current " +
+			"value of %d)"
+		return fmt.Errorf(msg, Get.CopyBufferSize)
+	}
+	// If presigned redirects are enabled, verify the object store settings.
+	if 0 < len(Get.PresignURL) {
+		if !strings.HasPrefix(Get.PresignURL, "http://") &&
+			!strings.HasPrefix(Get.PresignURL, "https://") {
+			msg := "value of 'PRESIGN_URL' must be an 'http://' or 'https://' " +
+				"URL (current value of '%s')"
+			return fmt.Errorf(msg, Get.PresignURL)
+		}
+		if 2 > len(strings.SplitN(Get.PresignCredentials, ":", 3)) {
+			msg := "if value for 'PRESIGN_URL' is set then the value for " +
+				"'PRESIGN_CREDENTIALS' must be in the form " +
+				"'access-key-id:secret-access-key[:session-token]'"
+			return errors.New(msg)
+		}
+		if 0 == len(Get.PresignRegion) {
+			msg := "if value for 'PRESIGN_URL' is set then the value for " +
+				"'PRESIGN_REGION' must also be set"
+			return errors.New(msg)
+		}
+		if time.Second > Get.PresignExpires || 7*24*time.Hour < Get.PresignExpires {
+			msg := "value for 'PRESIGN_EXPIRES' must be between 1s and 168h " +
+				"(current value of %s)"
+			return fmt.Errorf(msg, Get.PresignExpires)
+		}
+	}
+
+	if 0 > Get.ChecksumWorkers {
+		msg := "value for 'CHECKSUM_WORKERS' must not be negative (current " +
+			"value of %d)"
+		return fmt.Errorf(msg, Get.ChecksumWorkers)
+	}
+	if 0 > Get.MmapMinSize {
+		msg := "value for 'MMAP_MIN_SIZE' must not be negative (current " +
+			"value of %d)"
+		return fmt.Errorf(msg, Get.MmapMinSize)
+	}
+	if 0 > Get.OpenFileCacheSize {
+		msg := "value for 'OPEN_FILE_CACHE_SIZE' must not be negative " +
+			"(current value of %d)"
+		return fmt.Errorf(msg, Get.OpenFileCacheSize)
+	}
+	if 0 > Get.ReadvBatch {
+		msg := "value for 'READV_BATCH' must not be negative (current " +
+			"value of %d)"
+		return fmt.Errorf(msg, Get.ReadvBatch)
+	}
+	if 0 > Get.WarmupRecent {
+		msg := "value for 'WARMUP_RECENT' must not be negative (current " +
+			"value of %d)"
+		return fmt.Errorf(msg, Get.WarmupRecent)
+	}
+	for _, name := range Get.Warmup {
+		if !strings.HasPrefix(name, "/") {
+			msg := "values of 'WARMUP' must start with '/' (current value of " +
+				"'%s')"
+			return fmt.Errorf(msg, name)
+		}
+	}
+	for _, prefix := range Get.UsagePrefixes {
+		if !strings.HasPrefix(prefix, "/") {
+			msg := "values of 'USAGE_PREFIXES' must start with '/' (current " +
+				"value of '%s')"
+			return fmt.Errorf(msg, prefix)
+		}
+	}
+	if 0 > Get.UsageReportInterval {
+		msg := "value for 'USAGE_REPORT_INTERVAL' must not be negative " +
+			"(current value of %s)"
+		return fmt.Errorf(msg, Get.UsageReportInterval)
+	}
+	if 0 < Get.OpenFileCacheSize && 0 >= Get.WatchInterval {
+		msg := "if value for 'OPEN_FILE_CACHE_SIZE' is positive then the " +
+			"value for 'WATCH_INTERVAL' must be positive (current value of %s)"
+		return fmt.Errorf(msg, Get.WatchInterval)
+	}
+
 	// If the URL path prefix is to be used, verify it is properly formatted.
 	if 0 < len(Get.URLPrefix) &&
 		(!strings.HasPrefix(Get.URLPrefix, "/") || strings.HasSuffix(Get.URLPrefix, "/")) {
@@ -150,6 +1758,117 @@ func envAsStr(key, fallback string) string {
 	return fallback
 }
 
+// envAsInt returns the value of the environment variable as an int if set.
+func envAsInt(key string, fallback int) int {
+	// Retrieve the string value of the environment variable. If not set,
+	// fallback is used.
+	valueStr := os.Getenv(key)
+	if "" == valueStr {
+		return fallback
+	}
+
+	// Parse the string into an int.
+	value, err := strconv.Atoi(valueStr)
+	if nil != err {
+		log.Printf(
+			"Invalid value for '%s': %v\nUsing fallback: %d",
+			key, err, fallback,
+		)
+		return fallback
+	}
+	return value
+}
+
+// envAsLines returns the value of the environment variable as a slice of
+// strings if set. Values are separated with newlines, allowing commas within
+// each value, and surrounding whitespace is removed.
+func envAsLines(key string, fallback []string) []string {
+	valueStr := os.Getenv(key)
+	if "" == valueStr {
+		return fallback
+	}
+	return splitAndTrim(valueStr, "\n")
+}
+
+// envAsStrSlice returns the value of the environment variable as a slice of
+// strings if set. Values are separated with commas and surrounding whitespace
+// is removed.
+func envAsStrSlice(key string, fallback []string) []string {
+	valueStr := os.Getenv(key)
+	if "" == valueStr {
+		return fallback
+	}
+
+	return splitAndTrim(valueStr, ",")
+}
+
+// validTemplateName returns true if templates can reference the name as a
+// field, such as '{{.API_URL}}'.
+func validTemplateName(name string) bool {
+	for i, c := range name {
+		if !('_' == c || unicode.IsLetter(c) || (0 < i && unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return 0 < len(name)
+}
+
+// validateProtocols verifies the protocols, named as in the error messages,
+// only list 'h2', 'h2c' and 'http/1.1'. HTTP/1.1 is always served, as clients
+// without ALPN expect it. HTTP/3 needs a QUIC implementation, so it is refused
+// rather than ignored.
+func validateProtocols(name string, protocols []string) error {
+	hasHTTP1 := false
+	for _, protocol := range protocols {
+		switch protocol {
+		case "http/1.1":
+			hasHTTP1 = true
+		case "h2", "h2c":
+		default:
+			msg := "%s may only list 'h2', 'h2c' and 'http/1.1' (current value of '%s')"
+			return fmt.Errorf(msg, name, protocol)
+		}
+	}
+	if !hasHTTP1 {
+		msg := "%s must list 'http/1.1' (current value of '%s')"
+		return fmt.Errorf(msg, name, strings.Join(protocols, ","))
+	}
+	return nil
+}
+
+// splitAndTrim the string by the separator, removing surrounding whitespace and
+// empty values.
+func splitAndTrim(value, separator string) (values []string) {
+	for _, item := range strings.Split(value, separator) {
+		if item = strings.TrimSpace(item); "" != item {
+			values = append(values, item)
+		}
+	}
+	return
+}
+
+// envAsDuration returns the value of the environment variable as a duration
+// (e.g. '90s', '1h30m') if set.
+func envAsDuration(key string, fallback time.Duration) time.Duration {
+	// Retrieve the string value of the environment variable. If not set,
+	// fallback is used.
+	valueStr := os.Getenv(key)
+	if "" == valueStr {
+		return fallback
+	}
+
+	// Parse the string into a duration.
+	value, err := time.ParseDuration(valueStr)
+	if nil != err {
+		log.Printf(
+			"Invalid value for '%s': %v\nUsing fallback: %v",
+			key, err, fallback,
+		)
+		return fallback
+	}
+	return value
+}
+
 // envAsUint16 returns the value of the environment variable as a uint16 if set.
 func envAsUint16(key string, fallback uint16) uint16 {
 	// Retrieve the string value of the environment variable. If not set,
@@ -1,11 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -28,8 +33,8 @@ func TestLoad(t *testing.T) {
 	}
 
 	// Verify error if file doesn't exist.
-	if err := Load("/this/file/should/never/exist"); nil == err {
-		t.Error("While loading non-existing file expected error but got nil")
+	if err := Load("/this/file/should/never/exist"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("While loading non-existing file expected %v but got %v", os.ErrNotExist, err)
 	}
 
 	// Verify bad YAML returns an error.
@@ -41,11 +46,41 @@ func TestLoad(t *testing.T) {
 		if err := ioutil.WriteFile(filename, contents, 0666); nil != err {
 			t.Errorf("Failed to save bad YAML file with: %v\n", err)
 		}
-		if err := Load(filename); nil == err {
-			t.Error("While loading bad YAML expected error but got nil")
+		if err := Load(filename); !errors.Is(err, ErrConfigInvalid) {
+			t.Errorf("While loading bad YAML expected %v but got %v", ErrConfigInvalid, err)
 		}
 	}(t)
 
+	// Verify unknown keys return an error.
+	func(t *testing.T) {
+		filename := "testing.tmp"
+		contents := []byte(`{"tls-certificate": "/cert.pem"}`)
+		defer os.Remove(filename)
+
+		if err := ioutil.WriteFile(filename, contents, 0666); nil != err {
+			t.Errorf("Failed to save misspelled YAML file with: %v\n", err)
+		}
+		if err := Load(filename); !errors.Is(err, ErrConfigInvalid) {
+			t.Errorf("While loading misspelled YAML expected %v but got %v", ErrConfigInvalid, err)
+		}
+		setDefaults()
+	}(t)
+
+	// Verify invalid values return an error.
+	func(t *testing.T) {
+		filename := "testing.tmp"
+		contents := []byte(`{"tls-cert": "/cert/without/key.pem"}`)
+		defer os.Remove(filename)
+
+		if err := ioutil.WriteFile(filename, contents, 0666); nil != err {
+			t.Errorf("Failed to save invalid YAML file with: %v\n", err)
+		}
+		if err := Load(filename); !errors.Is(err, ErrConfigInvalid) {
+			t.Errorf("While loading invalid YAML expected %v but got %v", ErrConfigInvalid, err)
+		}
+		setDefaults()
+	}(t)
+
 	// Verify good YAML returns no error and sets value.
 	func(t *testing.T) {
 		filename := "testing.tmp"
@@ -67,6 +102,160 @@ func TestLoad(t *testing.T) {
 	}(t)
 }
 
+func TestLoadIncludes(t *testing.T) {
+	folder, err := ioutil.TempDir("", "include")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	defer setDefaults()
+
+	files := map[string]string{
+		"config.yml": "folder: /web\nport: 8081\ninclude: [conf.d/*.yml, extra.yml]\n" +
+			"overrides: [{prefix: /main, etag: none}]\n",
+		"conf.d/a.yml":    "port: 8082\noverrides: [{prefix: /a, etag: none}]\n",
+		"conf.d/b.yml":    "overrides: [{prefix: /b, etag: none}]\n",
+		"extra.yml":       "host: localhost\n",
+		"loop.yml":        "include: [loop.yml]\n",
+		"missing.yml":     "include: [none.yml]\n",
+		"unknown.yml":     "include: [bad/unknown.yml]\n",
+		"bad/unknown.yml": "hots: localhost\n",
+	}
+	os.Mkdir(filepath.Join(folder, "conf.d"), 0755)
+	os.Mkdir(filepath.Join(folder, "bad"), 0755)
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(folder, name), []byte(contents), 0666); nil != err {
+			t.Fatalf("While writing %s got %v", name, err)
+		}
+	}
+
+	os.Unsetenv(folderKey)
+	setDefaults()
+	if err = Load(filepath.Join(folder, "config.yml")); nil != err {
+		t.Fatalf("While loading includes got %v", err)
+	}
+	if "/web" != Get.Folder || 8082 != Get.Port || "localhost" != Get.Host {
+		t.Errorf("Expected included values but got %s, %d and %s", Get.Folder, Get.Port, Get.Host)
+	}
+	var prefixes []string
+	for _, override := range Get.Overrides {
+		prefixes = append(prefixes, override.Prefix)
+	}
+	if expected := "/main /a /b"; expected != strings.Join(prefixes, " ") {
+		t.Errorf("Expected overrides %s but got %v", expected, prefixes)
+	}
+
+	testCases := []struct {
+		name     string
+		filename string
+		is       error
+	}{
+		{"Loop", "loop.yml", ErrConfigInvalid},
+		{"Missing", "missing.yml", os.ErrNotExist},
+		{"Unknown key", "unknown.yml", ErrConfigInvalid},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			if err := Load(filepath.Join(folder, tc.filename)); !errors.Is(err, tc.is) {
+				t.Errorf("Expected %v but got %v", tc.is, err)
+			}
+		})
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	folder, err := ioutil.TempDir("", "formats")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	defer setDefaults()
+	os.Unsetenv(folderKey)
+
+	testCases := []struct {
+		filename string
+		contents string
+		isError  bool
+	}{
+		{"config.yml", "folder: /web\nport: 8081\nwatch-interval: 1m\noverrides: [{prefix: /docs}]\n", false},
+		{"config.json", `{"folder": "/web", "port": 8081, "watch-interval": "1m", "overrides": [{"prefix": "/docs"}]}`, false},
+		{"config.toml", "folder = \"/web\"\nport = 8081\nwatch-interval = \"1m\"\n[[overrides]]\nprefix = \"/docs\"\n", false},
+		{"CONFIG.TOML", "folder = \"/web\"\nport = 8081\nwatch-interval = \"1m\"\n[[overrides]]\nprefix = \"/docs\"\n", false},
+		{"bad.json", `{"folder": "/web",}`, true},
+		{"bad.toml", "folder = /web\n", true},
+		{"unknown.json", `{"fodler": "/web"}`, true},
+		{"unknown.toml", "fodler = \"/web\"\n", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			filename := filepath.Join(folder, tc.filename)
+			if err := ioutil.WriteFile(filename, []byte(tc.contents), 0666); nil != err {
+				t.Fatalf("While writing %s got %v", tc.filename, err)
+			}
+			setDefaults()
+			err := Load(filename)
+			if tc.isError {
+				if !errors.Is(err, ErrConfigInvalid) {
+					t.Errorf("Expected %v but got %v", ErrConfigInvalid, err)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("While loading got %v", err)
+			}
+			if "/web" != Get.Folder || 8081 != Get.Port || time.Minute != Get.WatchInterval ||
+				1 != len(Get.Overrides) || "/docs" != Get.Overrides[0].Prefix {
+				t.Errorf("Expected the values of the file but got %s, %d, %v and %v",
+					Get.Folder, Get.Port, Get.WatchInterval, Get.Overrides)
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	Get.Port = 1
+	Get.Headers = []string{"X-Frame-Options: DENY"}
+	Reset()
+	if defaultPort != Get.Port || nil != Get.Headers {
+		t.Errorf("Expected the defaults but got port %d and headers %v", Get.Port, Get.Headers)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("SFS_TEST_KEY", "secret")
+	os.Setenv("SFS_TEST_EMPTY", "")
+	defer os.Unsetenv("SFS_TEST_KEY")
+	defer os.Unsetenv("SFS_TEST_EMPTY")
+
+	testCases := []struct {
+		name     string
+		contents string
+		expected string
+		isError  bool
+	}{
+		{"None", "folder: /web", "folder: /web", false},
+		{"Set", "key: ${SFS_TEST_KEY}", "key: secret", false},
+		{"Set with fallback", "key: ${SFS_TEST_KEY:-other}", "key: secret", false},
+		{"Empty with fallback", "key: ${SFS_TEST_EMPTY:-other}", "key: other", false},
+		{"Empty", "key: '${SFS_TEST_EMPTY}'", "key: ''", false},
+		{"Unset with fallback", "port: ${SFS_TEST_UNSET:-8080}", "port: 8080", false},
+		{"Unset", "key: ${SFS_TEST_UNSET}", "", true},
+		{"Escaped", "value: $${SFS_TEST_KEY}", "value: ${SFS_TEST_KEY}", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := interpolate([]byte(tc.contents))
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if !tc.isError && tc.expected != string(result) {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, result)
+			}
+		})
+	}
+}
+
 func TestLog(t *testing.T) {
 	// Test whether YAML marshalling works, as that is the only error case.
 	if _, err := yaml.Marshal(&Get); nil != err {
@@ -75,26 +264,334 @@ func TestLog(t *testing.T) {
 	Log()
 }
 
+func TestDump(t *testing.T) {
+	Get.CDNPurgeToken = "secret-token"
+	Get.Folder = "/web"
+	Get.NotifyWebhook = "https://hooks.slack.com/services/T0/B0/secret-webhook"
+	defer setDefaults()
+
+	contents, err := Dump()
+	if nil != err {
+		t.Fatalf("While dumping got %v", err)
+	}
+	dumped := string(contents)
+	for _, expected := range []string{
+		"cdn-purge-token: '********'\n",
+		"folder: /web\n",
+		"notify-webhook: '********'\n",
+		"trace-key: \"\"\n",
+	} {
+		if !strings.Contains(dumped, expected) {
+			t.Errorf("Expected '%s' in '%s'", expected, dumped)
+		}
+	}
+	if strings.Contains(dumped, "secret-token") || strings.Contains(dumped, "secret-webhook") {
+		t.Errorf("Expected the secrets to be masked in '%s'", dumped)
+	}
+}
+
 func TestOverrideWithEnvvars(t *testing.T) {
 	// Choose values that are different than defaults.
+	testAccessLogExclude := []string{"/healthz", "/favicon.ico"}
+	testAccessLogFields := []string{"ip=mask", "query=redact"}
+	testAccessLogHashKey := "secret"
+	testAccessLogSample := 100
+	testAlertMinRequests := 50
+	testAlertWindow := 5 * time.Minute
+	testAlerts := []string{"5xx>5", "4xx>25"}
+	testAuditLog := "/var/log/static-file-server/audit.log"
+	testAuthRealms := []string{"/private=basic:/etc/users", "/api=key:/etc/keys"}
+	testCacheControl := "public, max-age=60"
+	testCacheControlSMaxAge := time.Hour
+	testCacheControlStaleIfError := 24 * time.Hour
+	testCacheControlStaleWhileRevalidate := time.Minute
+	testCacheIgnoreQuery := []string{"v", "cb"}
+	testCacheMaxEntrySize := 4096
+	testCacheMaxSize := 1 << 24
+	testCacheTTL := time.Hour
+	testCanaryFolder := "."
+	testCanaryPercent := 10
+	testCanarySticky := "ip"
+	testCDNPurge := "fastly"
+	testCDNPurgeBaseURL := "https://www.example.com"
+	testCDNPurgeID := "SU1Z0isxPaozGVKXdv0eY"
+	testCDNPurgeToken := "token"
+	testChecksumState := "/var/lib/checksums.json"
+	testChecksumWorkers := 2
+	testChecksums := []string{"md5", "sha256"}
+	testConfigDump := true
+	testConfigDumpPath := "/config"
+	testContentTypes := []string{"Caddyfile=text/plain", "/LICENSE=text/plain; charset=utf-8"}
+	testCopyBufferSize := 1 << 16
+	testCORS := []string{"/fonts=open", "https://app.example.com"}
+	testCrossOriginEmbedderPolicy := "require-corp"
+	testCrossOriginOpenerPolicy := "same-origin"
+	testCrossOriginResourcePolicy := "same-site"
 	testDebug := true
+	testETag := "strong"
+	testETagManifest := "/etc/static-file-server/etags.json"
+	testEvents := true
+	testEventsPath := "/changes"
 	testFolder := "/my/directory"
+	testGeoIPAllow := []string{"US", "CA"}
+	testGeoIPDeny := []string{"DE"}
+	testGeoIPFolder := "/my/geoip"
+	testHeaders := []string{"X-Frame-Options: DENY", "/assets=Cache-Control: public, max-age=60"}
 	testHost := "apets.life"
+	testImageResize := true
+	testImageResizeCache := "/var/cache/images"
+	testImageResizeCacheMaxSize := 1 << 20
+	testImageResizeMaxPixels := 1000000
+	testImageResizeMaxSize := 800
+	testInjectBody := "<script src=\"/banner.js\"></script>"
+	testInjectHead := "<meta name=\"env\" content=\"staging\">"
+	testLockoutBanTime := time.Hour
+	testLockoutPath := "/admin/lockout"
+	testLockoutThreshold := 5
+	testLockoutWindow := 10 * time.Minute
+	testLogOutput := "gelf+udp://graylog:12201"
+	testMetadata := true
+	testMetrics := true
+	testMetricsPath := "/__metrics"
+	testMinify := true
+	testMmapMinSize := 1 << 20
+	testNoise := "synthesize"
+	testNoisePaths := []string{"/favicon.ico", "/browserconfig.xml"}
+	testNotifyAuthFailures := 5
+	testNotifyEvents := []string{"auth-failures"}
+	testNotifyInterval := time.Minute
+	testNotifyServerErrors := 20
+	testNotifyWebhook := "https://hooks.example.com/notify"
+	testNotifyWindow := 5 * time.Minute
+	testOpenFileCacheSize := 256
+	testPathNormalization := "normalize"
+	testPermissionsPolicy := []string{"camera=", "geolocation=self https://maps.example.com"}
+	testPolicy := []string{"deny * /private/**", "allow * /**"}
 	testPort := uint16(666)
+	testPresignCredentials := "key:secret"
+	testPresignExpires := time.Hour
+	testPresignRegion := "eu-west-1"
+	testPresignURL := "https://bucket.s3.eu-west-1.amazonaws.com"
+	testProblemDetails := true
+	testProtocols := []string{"http/1.1"}
+	testPurgeWebhook := "https://deploy.example.com/purge"
+	testRateLimit := 100
+	testRateLimitWindow := time.Hour
+	testReadvBatch := 8
+	testRetentionDryRun := true
+	testRetentionInterval := 10 * time.Minute
+	testRetentionKeep := 5
+	testRetentionMaxAge := 720 * time.Hour
+	testRetentionPatterns := []string{"*.tar.gz", "/releases/v*"}
+	testRobotsTxt := "deny"
+	testRoots := true
+	testRootsFolders := []string{"blue=.", "green=."}
+	testRootsPath := "/roots"
+	testScript := "config.go"
+	testSearch := true
+	testSearchContents := true
+	testSearchIndex := true
+	testSearchPath := "/find"
+	testSecurityTxtContact := []string{"mailto:security@apets.life"}
+	testSecurityTxtEncryption := "https://apets.life/pgp.txt"
+	testSecurityTxtExpires := "2030-01-01T00:00:00Z"
+	testSecurityTxtPolicy := "https://apets.life/policy"
+	testSecurityTxtPreferredLanguages := "en, de"
+	testServerHeader := "static"
 	testShowListing := false
+	testSitemap := true
+	testSitemapBaseURL := "https://apets.life"
+	testSitemapExclude := []string{"drafts/*"}
+	testSitemapInclude := []string{"*.html", "*.txt"}
+	testSitemapInterval := 5 * time.Minute
+	testStats := true
+	testStatsPath := "/admin/stats"
+	testStripMetadata := true
+	testSurrogateKeyHeader := "Cache-Tag"
+	testSurrogateKeyManifest := "/etc/static-file-server/keys.json"
+	testTemplateVars := []string{"API_URL=https://api.example.com", "ANALYTICS_ID=UA-1"}
+	testTemplates := true
 	testTLSCert := "my.pem"
 	testTLSKey := "my.key"
+	testTLSOCSPStapling := true
+	testTLSReloadInterval := 5 * time.Minute
+	testTLSSelfSigned := true
+	testTLSVaultToken := "vault-token"
+	testTLSVaultURL := "https://vault:8200/v1/secret/data/web"
+	testTraceKey := "trace-key"
+	testTransferLimit := 4
+	testTransferLimitPerConnection := 2
 	testURLPrefix := "/url/prefix"
+	testUsage := true
+	testUsagePath := "/usage/report"
+	testUsagePrefixes := []string{"/team-a", "/team-b"}
+	testUsageReportInterval := 24 * time.Hour
+	testUsageState := "/var/lib/usage.json"
+	testUserAgentAllow := []string{"/internal=^tool/"}
+	testUserAgentDeny := []string{"(?i)bot", "curl"}
+	testVideoBurst := 4000000
+	testVideoPreset := true
+	testVideoPresetCORSOrigin := "https://player.example.com"
+	testVideoPresetPlaylistMaxAge := 2 * time.Second
+	testVideoPresetSegmentMaxAge := time.Hour
+	testVideoRate := 500000
+	testWarmup := []string{"/index.html", "/assets"}
+	testWarmupRecent := 100
+	testWatchInterval := time.Minute
+	testWellKnownACMEFolder := "."
+	testWellKnownPassthrough := []string{"apple-app-site-association", "assetlinks.json"}
+	testWellKnownRedirects := []string{"caldav=/dav/", "carddav=/dav/"}
 
 	// Set all environment variables with test values.
+	os.Setenv(accessLogExcludeKey, strings.Join(testAccessLogExclude, ","))
+	os.Setenv(accessLogFieldsKey, strings.Join(testAccessLogFields, ","))
+	os.Setenv(accessLogHashKeyKey, testAccessLogHashKey)
+	os.Setenv(accessLogSampleKey, strconv.Itoa(testAccessLogSample))
+	os.Setenv(alertMinRequestsKey, strconv.Itoa(testAlertMinRequests))
+	os.Setenv(alertWindowKey, testAlertWindow.String())
+	os.Setenv(alertsKey, strings.Join(testAlerts, ","))
+	os.Setenv(auditLogKey, testAuditLog)
+	os.Setenv(authRealmsKey, strings.Join(testAuthRealms, "\n"))
+	os.Setenv(cacheControlKey, testCacheControl)
+	os.Setenv(cacheControlSMaxAgeKey, testCacheControlSMaxAge.String())
+	os.Setenv(cacheControlStaleIfErrorKey, testCacheControlStaleIfError.String())
+	os.Setenv(cacheControlStaleWhileRevalidateKey, testCacheControlStaleWhileRevalidate.String())
+	os.Setenv(cacheIgnoreQueryKey, strings.Join(testCacheIgnoreQuery, ","))
+	os.Setenv(cacheMaxEntrySizeKey, strconv.Itoa(testCacheMaxEntrySize))
+	os.Setenv(cacheMaxSizeKey, strconv.Itoa(testCacheMaxSize))
+	os.Setenv(cacheTTLKey, testCacheTTL.String())
+	os.Setenv(canaryFolderKey, testCanaryFolder)
+	os.Setenv(canaryPercentKey, strconv.Itoa(testCanaryPercent))
+	os.Setenv(canaryStickyKey, testCanarySticky)
+	os.Setenv(cdnPurgeKey, testCDNPurge)
+	os.Setenv(cdnPurgeBaseURLKey, testCDNPurgeBaseURL)
+	os.Setenv(cdnPurgeIDKey, testCDNPurgeID)
+	os.Setenv(cdnPurgeTokenKey, testCDNPurgeToken)
+	os.Setenv(checksumStateKey, testChecksumState)
+	os.Setenv(checksumWorkersKey, strconv.Itoa(testChecksumWorkers))
+	os.Setenv(checksumsKey, strings.Join(testChecksums, ","))
+	os.Setenv(configDumpKey, fmt.Sprintf("%t", testConfigDump))
+	os.Setenv(configDumpPathKey, testConfigDumpPath)
+	os.Setenv(contentTypesKey, strings.Join(testContentTypes, ","))
+	os.Setenv(copyBufferSizeKey, strconv.Itoa(testCopyBufferSize))
+	os.Setenv(corsKey, strings.Join(testCORS, ","))
+	os.Setenv(crossOriginEmbedderPolicyKey, testCrossOriginEmbedderPolicy)
+	os.Setenv(crossOriginOpenerPolicyKey, testCrossOriginOpenerPolicy)
+	os.Setenv(crossOriginResourcePolicyKey, testCrossOriginResourcePolicy)
 	os.Setenv(debugKey, fmt.Sprintf("%t", testDebug))
+	os.Setenv(etagKey, testETag)
+	os.Setenv(etagManifestKey, testETagManifest)
+	os.Setenv(eventsKey, fmt.Sprintf("%t", testEvents))
+	os.Setenv(eventsPathKey, testEventsPath)
 	os.Setenv(folderKey, testFolder)
+	os.Setenv(geoIPAllowKey, "US, CA")
+	os.Setenv(geoIPDenyKey, "DE")
+	os.Setenv(geoIPFolderKey, testGeoIPFolder)
+	os.Setenv(headersKey, strings.Join(testHeaders, "\n"))
 	os.Setenv(hostKey, testHost)
+	os.Setenv(imageResizeKey, fmt.Sprintf("%t", testImageResize))
+	os.Setenv(imageResizeCacheKey, testImageResizeCache)
+	os.Setenv(imageResizeCacheMaxSizeKey, strconv.Itoa(testImageResizeCacheMaxSize))
+	os.Setenv(imageResizeMaxPixelsKey, strconv.Itoa(testImageResizeMaxPixels))
+	os.Setenv(imageResizeMaxSizeKey, strconv.Itoa(testImageResizeMaxSize))
+	os.Setenv(injectBodyKey, testInjectBody)
+	os.Setenv(injectHeadKey, testInjectHead)
+	os.Setenv(lockoutBanTimeKey, testLockoutBanTime.String())
+	os.Setenv(lockoutPathKey, testLockoutPath)
+	os.Setenv(lockoutThresholdKey, strconv.Itoa(testLockoutThreshold))
+	os.Setenv(lockoutWindowKey, testLockoutWindow.String())
+	os.Setenv(logOutputKey, testLogOutput)
+	os.Setenv(metadataKey, fmt.Sprintf("%t", testMetadata))
+	os.Setenv(metricsKey, fmt.Sprintf("%t", testMetrics))
+	os.Setenv(metricsPathKey, testMetricsPath)
+	os.Setenv(minifyKey, fmt.Sprintf("%t", testMinify))
+	os.Setenv(mmapMinSizeKey, strconv.Itoa(testMmapMinSize))
+	os.Setenv(noiseKey, testNoise)
+	os.Setenv(noisePathsKey, strings.Join(testNoisePaths, ","))
+	os.Setenv(notifyAuthFailuresKey, strconv.Itoa(testNotifyAuthFailures))
+	os.Setenv(notifyEventsKey, strings.Join(testNotifyEvents, ","))
+	os.Setenv(notifyIntervalKey, testNotifyInterval.String())
+	os.Setenv(notifyServerErrorsKey, strconv.Itoa(testNotifyServerErrors))
+	os.Setenv(notifyWebhookKey, testNotifyWebhook)
+	os.Setenv(notifyWindowKey, testNotifyWindow.String())
+	os.Setenv(openFileCacheSizeKey, strconv.Itoa(testOpenFileCacheSize))
+	os.Setenv(pathNormalizationKey, testPathNormalization)
+	os.Setenv(permissionsPolicyKey, strings.Join(testPermissionsPolicy, "\n"))
+	os.Setenv(policyKey, strings.Join(testPolicy, "\n"))
 	os.Setenv(portKey, strconv.Itoa(int(testPort)))
+	os.Setenv(presignCredentialsKey, testPresignCredentials)
+	os.Setenv(presignExpiresKey, testPresignExpires.String())
+	os.Setenv(presignRegionKey, testPresignRegion)
+	os.Setenv(presignURLKey, testPresignURL)
+	os.Setenv(problemDetailsKey, fmt.Sprintf("%t", testProblemDetails))
+	os.Setenv(protocolsKey, strings.Join(testProtocols, ","))
+	os.Setenv(purgeWebhookKey, testPurgeWebhook)
+	os.Setenv(rateLimitKey, strconv.Itoa(testRateLimit))
+	os.Setenv(rateLimitWindowKey, testRateLimitWindow.String())
+	os.Setenv(readvBatchKey, strconv.Itoa(testReadvBatch))
+	os.Setenv(retentionDryRunKey, fmt.Sprintf("%t", testRetentionDryRun))
+	os.Setenv(retentionIntervalKey, testRetentionInterval.String())
+	os.Setenv(retentionKeepKey, strconv.Itoa(testRetentionKeep))
+	os.Setenv(retentionMaxAgeKey, testRetentionMaxAge.String())
+	os.Setenv(retentionPatternsKey, strings.Join(testRetentionPatterns, ","))
+	os.Setenv(robotsTxtKey, testRobotsTxt)
+	os.Setenv(rootsKey, fmt.Sprintf("%t", testRoots))
+	os.Setenv(rootsFoldersKey, strings.Join(testRootsFolders, ","))
+	os.Setenv(rootsPathKey, testRootsPath)
+	os.Setenv(scriptKey, testScript)
+	os.Setenv(searchKey, fmt.Sprintf("%t", testSearch))
+	os.Setenv(searchContentsKey, fmt.Sprintf("%t", testSearchContents))
+	os.Setenv(searchIndexKey, fmt.Sprintf("%t", testSearchIndex))
+	os.Setenv(searchPathKey, testSearchPath)
+	os.Setenv(securityTxtContactKey, strings.Join(testSecurityTxtContact, ","))
+	os.Setenv(securityTxtEncryptionKey, testSecurityTxtEncryption)
+	os.Setenv(securityTxtExpiresKey, testSecurityTxtExpires)
+	os.Setenv(securityTxtPolicyKey, testSecurityTxtPolicy)
+	os.Setenv(securityTxtPreferredLanguagesKey, testSecurityTxtPreferredLanguages)
+	os.Setenv(serverHeaderKey, testServerHeader)
 	os.Setenv(showListingKey, fmt.Sprintf("%t", testShowListing))
+	os.Setenv(sitemapKey, fmt.Sprintf("%t", testSitemap))
+	os.Setenv(sitemapBaseURLKey, testSitemapBaseURL)
+	os.Setenv(sitemapExcludeKey, strings.Join(testSitemapExclude, ","))
+	os.Setenv(sitemapIncludeKey, strings.Join(testSitemapInclude, ","))
+	os.Setenv(sitemapIntervalKey, testSitemapInterval.String())
+	os.Setenv(statsKey, fmt.Sprintf("%t", testStats))
+	os.Setenv(statsPathKey, testStatsPath)
+	os.Setenv(stripMetadataKey, fmt.Sprintf("%t", testStripMetadata))
+	os.Setenv(surrogateKeyHeaderKey, testSurrogateKeyHeader)
+	os.Setenv(surrogateKeyManifestKey, testSurrogateKeyManifest)
+	os.Setenv(templateVarsKey, strings.Join(testTemplateVars, "\n"))
+	os.Setenv(templatesKey, fmt.Sprintf("%t", testTemplates))
 	os.Setenv(tlsCertKey, testTLSCert)
 	os.Setenv(tlsKeyKey, testTLSKey)
+	os.Setenv(tlsOCSPStaplingKey, fmt.Sprintf("%t", testTLSOCSPStapling))
+	os.Setenv(tlsReloadIntervalKey, testTLSReloadInterval.String())
+	os.Setenv(tlsSelfSignedKey, fmt.Sprintf("%t", testTLSSelfSigned))
+	os.Setenv(tlsVaultTokenKey, testTLSVaultToken)
+	os.Setenv(tlsVaultURLKey, testTLSVaultURL)
+	os.Setenv(traceKeyKey, testTraceKey)
+	os.Setenv(transferLimitKey, strconv.Itoa(testTransferLimit))
+	os.Setenv(transferLimitPerConnectionKey, strconv.Itoa(testTransferLimitPerConnection))
 	os.Setenv(urlPrefixKey, testURLPrefix)
+	os.Setenv(usageKey, fmt.Sprintf("%t", testUsage))
+	os.Setenv(usagePathKey, testUsagePath)
+	os.Setenv(usagePrefixesKey, strings.Join(testUsagePrefixes, ","))
+	os.Setenv(usageReportIntervalKey, testUsageReportInterval.String())
+	os.Setenv(usageStateKey, testUsageState)
+	os.Setenv(userAgentAllowKey, strings.Join(testUserAgentAllow, ","))
+	os.Setenv(userAgentDenyKey, strings.Join(testUserAgentDeny, ","))
+	os.Setenv(videoBurstKey, strconv.Itoa(testVideoBurst))
+	os.Setenv(videoPresetKey, fmt.Sprintf("%t", testVideoPreset))
+	os.Setenv(videoPresetCORSOriginKey, testVideoPresetCORSOrigin)
+	os.Setenv(videoPresetPlaylistMaxAgeKey, testVideoPresetPlaylistMaxAge.String())
+	os.Setenv(videoPresetSegmentMaxAgeKey, testVideoPresetSegmentMaxAge.String())
+	os.Setenv(videoRateKey, strconv.Itoa(testVideoRate))
+	os.Setenv(warmupKey, strings.Join(testWarmup, ","))
+	os.Setenv(warmupRecentKey, strconv.Itoa(testWarmupRecent))
+	os.Setenv(watchIntervalKey, testWatchInterval.String())
+	os.Setenv(wellKnownACMEFolderKey, testWellKnownACMEFolder)
+	os.Setenv(wellKnownPassthroughKey, strings.Join(testWellKnownPassthrough, ","))
+	os.Setenv(wellKnownRedirectsKey, strings.Join(testWellKnownRedirects, ","))
 
 	// Verification functions.
 	equalStrings := func(t *testing.T, name, key, expected, result string) {
@@ -105,6 +602,14 @@ func TestOverrideWithEnvvars(t *testing.T) {
 			)
 		}
 	}
+	equalStrSlices := func(t *testing.T, name, key string, expected, result []string) {
+		if !reflect.DeepEqual(expected, result) {
+			t.Errorf(
+				"While checking %s for '%s' expected %v but got %v",
+				name, key, expected, result,
+			)
+		}
+	}
 	equalUint16 := func(t *testing.T, name, key string, expected, result uint16) {
 		if expected != result {
 			t.Errorf(
@@ -113,6 +618,22 @@ func TestOverrideWithEnvvars(t *testing.T) {
 			)
 		}
 	}
+	equalInt := func(t *testing.T, name, key string, expected, result int) {
+		if expected != result {
+			t.Errorf(
+				"While checking %s for '%s' expected %d but got %d",
+				name, key, expected, result,
+			)
+		}
+	}
+	equalDuration := func(t *testing.T, name, key string, expected, result time.Duration) {
+		if expected != result {
+			t.Errorf(
+				"While checking %s for '%s' expected %v but got %v",
+				name, key, expected, result,
+			)
+		}
+	}
 	equalBool := func(t *testing.T, name, key string, expected, result bool) {
 		if expected != result {
 			t.Errorf(
@@ -122,66 +643,1725 @@ func TestOverrideWithEnvvars(t *testing.T) {
 		}
 	}
 
-	// Verify defaults.
-	setDefaults()
-	phase := "defaults"
-	equalBool(t, phase, debugKey, defaultDebug, Get.Debug)
-	equalStrings(t, phase, folderKey, defaultFolder, Get.Folder)
-	equalStrings(t, phase, hostKey, defaultHost, Get.Host)
-	equalUint16(t, phase, portKey, defaultPort, Get.Port)
-	equalBool(t, phase, showListingKey, defaultShowListing, Get.ShowListing)
-	equalStrings(t, phase, tlsCertKey, defaultTLSCert, Get.TLSCert)
-	equalStrings(t, phase, tlsKeyKey, defaultTLSKey, Get.TLSKey)
-	equalStrings(t, phase, urlPrefixKey, defaultURLPrefix, Get.URLPrefix)
+	// Verify defaults.
+	setDefaults()
+	phase := "defaults"
+	equalStrSlices(t, phase, accessLogExcludeKey, nil, Get.AccessLogExclude)
+	equalStrSlices(t, phase, accessLogFieldsKey, nil, Get.AccessLogFields)
+	equalStrings(t, phase, accessLogHashKeyKey, defaultAccessLogHashKey, Get.AccessLogHashKey)
+	equalInt(t, phase, accessLogSampleKey, defaultAccessLogSample, Get.AccessLogSample)
+	equalInt(t, phase, alertMinRequestsKey, defaultAlertMinRequests, Get.AlertMinRequests)
+	equalDuration(t, phase, alertWindowKey, defaultAlertWindow, Get.AlertWindow)
+	equalStrSlices(t, phase, alertsKey, nil, Get.Alerts)
+	equalStrings(t, phase, auditLogKey, defaultAuditLog, Get.AuditLog)
+	equalStrSlices(t, phase, authRealmsKey, nil, Get.AuthRealms)
+	equalStrings(t, phase, cacheControlKey, defaultCacheControl, Get.CacheControl)
+	equalDuration(t, phase, cacheControlSMaxAgeKey, defaultCacheControlSMaxAge, Get.CacheControlSMaxAge)
+	equalDuration(t, phase, cacheControlStaleIfErrorKey, defaultCacheControlStaleIfError, Get.CacheControlStaleIfError)
+	equalDuration(t, phase, cacheControlStaleWhileRevalidateKey, defaultCacheControlStaleWhileRevalidate, Get.CacheControlStaleWhileRevalidate)
+	equalStrSlices(t, phase, cacheIgnoreQueryKey, nil, Get.CacheIgnoreQuery)
+	equalInt(t, phase, cacheMaxEntrySizeKey, defaultCacheMaxEntrySize, Get.CacheMaxEntrySize)
+	equalInt(t, phase, cacheMaxSizeKey, defaultCacheMaxSize, Get.CacheMaxSize)
+	equalDuration(t, phase, cacheTTLKey, defaultCacheTTL, Get.CacheTTL)
+	equalStrings(t, phase, canaryFolderKey, defaultCanaryFolder, Get.CanaryFolder)
+	equalInt(t, phase, canaryPercentKey, defaultCanaryPercent, Get.CanaryPercent)
+	equalStrings(t, phase, canaryStickyKey, defaultCanarySticky, Get.CanarySticky)
+	equalStrings(t, phase, cdnPurgeKey, defaultCDNPurge, Get.CDNPurge)
+	equalStrings(t, phase, cdnPurgeBaseURLKey, defaultCDNPurgeBaseURL, Get.CDNPurgeBaseURL)
+	equalStrings(t, phase, cdnPurgeIDKey, defaultCDNPurgeID, Get.CDNPurgeID)
+	equalStrings(t, phase, cdnPurgeTokenKey, defaultCDNPurgeToken, Get.CDNPurgeToken)
+	equalStrings(t, phase, checksumStateKey, defaultChecksumState, Get.ChecksumState)
+	equalInt(t, phase, checksumWorkersKey, defaultChecksumWorkers, Get.ChecksumWorkers)
+	equalStrSlices(t, phase, checksumsKey, nil, Get.Checksums)
+	equalBool(t, phase, configDumpKey, defaultConfigDump, Get.ConfigDump)
+	equalStrings(t, phase, configDumpPathKey, defaultConfigDumpPath, Get.ConfigDumpPath)
+	equalStrSlices(t, phase, contentTypesKey, nil, Get.ContentTypes)
+	equalInt(t, phase, copyBufferSizeKey, defaultCopyBufferSize, Get.CopyBufferSize)
+	equalStrSlices(t, phase, corsKey, nil, Get.CORS)
+	equalStrings(t, phase, crossOriginEmbedderPolicyKey, defaultCrossOriginEmbedderPolicy, Get.CrossOriginEmbedderPolicy)
+	equalStrings(t, phase, crossOriginOpenerPolicyKey, defaultCrossOriginOpenerPolicy, Get.CrossOriginOpenerPolicy)
+	equalStrings(t, phase, crossOriginResourcePolicyKey, defaultCrossOriginResourcePolicy, Get.CrossOriginResourcePolicy)
+	equalBool(t, phase, debugKey, defaultDebug, Get.Debug)
+	equalStrings(t, phase, etagKey, defaultETag, Get.ETag)
+	equalStrings(t, phase, etagManifestKey, defaultETagManifest, Get.ETagManifest)
+	equalBool(t, phase, eventsKey, defaultEvents, Get.Events)
+	equalStrings(t, phase, eventsPathKey, defaultEventsPath, Get.EventsPath)
+	equalStrings(t, phase, folderKey, defaultFolder, Get.Folder)
+	equalStrSlices(t, phase, geoIPAllowKey, nil, Get.GeoIPAllow)
+	equalStrSlices(t, phase, geoIPDenyKey, nil, Get.GeoIPDeny)
+	equalStrings(t, phase, geoIPFolderKey, defaultGeoIPFolder, Get.GeoIPFolder)
+	equalStrSlices(t, phase, headersKey, nil, Get.Headers)
+	equalStrings(t, phase, hostKey, defaultHost, Get.Host)
+	equalBool(t, phase, imageResizeKey, defaultImageResize, Get.ImageResize)
+	equalStrings(t, phase, imageResizeCacheKey, defaultImageResizeCache, Get.ImageResizeCache)
+	equalInt(t, phase, imageResizeCacheMaxSizeKey, defaultImageResizeCacheMaxSize, Get.ImageResizeCacheMaxSize)
+	equalInt(t, phase, imageResizeMaxPixelsKey, defaultImageResizeMaxPixels, Get.ImageResizeMaxPixels)
+	equalInt(t, phase, imageResizeMaxSizeKey, defaultImageResizeMaxSize, Get.ImageResizeMaxSize)
+	equalStrings(t, phase, injectBodyKey, defaultInjectBody, Get.InjectBody)
+	equalStrings(t, phase, injectHeadKey, defaultInjectHead, Get.InjectHead)
+	equalDuration(t, phase, lockoutBanTimeKey, defaultLockoutBanTime, Get.LockoutBanTime)
+	equalStrings(t, phase, lockoutPathKey, defaultLockoutPath, Get.LockoutPath)
+	equalInt(t, phase, lockoutThresholdKey, defaultLockoutThreshold, Get.LockoutThreshold)
+	equalDuration(t, phase, lockoutWindowKey, defaultLockoutWindow, Get.LockoutWindow)
+	equalStrings(t, phase, logOutputKey, defaultLogOutput, Get.LogOutput)
+	equalBool(t, phase, metadataKey, defaultMetadata, Get.Metadata)
+	equalBool(t, phase, metricsKey, defaultMetrics, Get.Metrics)
+	equalStrings(t, phase, metricsPathKey, defaultMetricsPath, Get.MetricsPath)
+	equalBool(t, phase, minifyKey, defaultMinify, Get.Minify)
+	equalInt(t, phase, mmapMinSizeKey, defaultMmapMinSize, Get.MmapMinSize)
+	equalStrings(t, phase, noiseKey, defaultNoise, Get.Noise)
+	equalStrSlices(t, phase, noisePathsKey, defaultNoisePaths, Get.NoisePaths)
+	equalInt(t, phase, notifyAuthFailuresKey, defaultNotifyAuthFailures, Get.NotifyAuthFailures)
+	equalStrSlices(t, phase, notifyEventsKey, defaultNotifyEvents, Get.NotifyEvents)
+	equalDuration(t, phase, notifyIntervalKey, defaultNotifyInterval, Get.NotifyInterval)
+	equalInt(t, phase, notifyServerErrorsKey, defaultNotifyServerErrors, Get.NotifyServerErrors)
+	equalStrings(t, phase, notifyWebhookKey, defaultNotifyWebhook, Get.NotifyWebhook)
+	equalDuration(t, phase, notifyWindowKey, defaultNotifyWindow, Get.NotifyWindow)
+	equalInt(t, phase, openFileCacheSizeKey, defaultOpenFileCacheSize, Get.OpenFileCacheSize)
+	equalStrings(t, phase, pathNormalizationKey, defaultPathNormalization, Get.PathNormalization)
+	equalStrSlices(t, phase, permissionsPolicyKey, nil, Get.PermissionsPolicy)
+	equalStrSlices(t, phase, policyKey, nil, Get.Policy)
+	equalUint16(t, phase, portKey, defaultPort, Get.Port)
+	equalStrings(t, phase, presignCredentialsKey, defaultPresignCredentials, Get.PresignCredentials)
+	equalDuration(t, phase, presignExpiresKey, defaultPresignExpires, Get.PresignExpires)
+	equalStrings(t, phase, presignRegionKey, defaultPresignRegion, Get.PresignRegion)
+	equalStrings(t, phase, presignURLKey, defaultPresignURL, Get.PresignURL)
+	equalBool(t, phase, problemDetailsKey, defaultProblemDetails, Get.ProblemDetails)
+	equalStrSlices(t, phase, protocolsKey, defaultProtocols, Get.Protocols)
+	equalStrings(t, phase, purgeWebhookKey, defaultPurgeWebhook, Get.PurgeWebhook)
+	equalInt(t, phase, rateLimitKey, defaultRateLimit, Get.RateLimit)
+	equalDuration(t, phase, rateLimitWindowKey, defaultRateLimitWindow, Get.RateLimitWindow)
+	equalInt(t, phase, readvBatchKey, defaultReadvBatch, Get.ReadvBatch)
+	equalBool(t, phase, retentionDryRunKey, defaultRetentionDryRun, Get.RetentionDryRun)
+	equalDuration(t, phase, retentionIntervalKey, defaultRetentionInterval, Get.RetentionInterval)
+	equalInt(t, phase, retentionKeepKey, defaultRetentionKeep, Get.RetentionKeep)
+	equalDuration(t, phase, retentionMaxAgeKey, defaultRetentionMaxAge, Get.RetentionMaxAge)
+	equalStrSlices(t, phase, retentionPatternsKey, nil, Get.RetentionPatterns)
+	equalStrings(t, phase, robotsTxtKey, defaultRobotsTxt, Get.RobotsTxt)
+	equalBool(t, phase, rootsKey, defaultRoots, Get.Roots)
+	equalStrSlices(t, phase, rootsFoldersKey, nil, Get.RootsFolders)
+	equalStrings(t, phase, rootsPathKey, defaultRootsPath, Get.RootsPath)
+	equalStrings(t, phase, scriptKey, defaultScript, Get.Script)
+	equalBool(t, phase, searchKey, defaultSearch, Get.Search)
+	equalBool(t, phase, searchContentsKey, defaultSearchContents, Get.SearchContents)
+	equalBool(t, phase, searchIndexKey, defaultSearchIndex, Get.SearchIndex)
+	equalStrings(t, phase, searchPathKey, defaultSearchPath, Get.SearchPath)
+	equalStrSlices(t, phase, securityTxtContactKey, nil, Get.SecurityTxtContact)
+	equalStrings(t, phase, securityTxtEncryptionKey, defaultSecurityTxtEncryption, Get.SecurityTxtEncryption)
+	equalStrings(t, phase, securityTxtExpiresKey, defaultSecurityTxtExpires, Get.SecurityTxtExpires)
+	equalStrings(t, phase, securityTxtPolicyKey, defaultSecurityTxtPolicy, Get.SecurityTxtPolicy)
+	equalStrings(t, phase, securityTxtPreferredLanguagesKey, defaultSecurityTxtPreferredLanguages, Get.SecurityTxtPreferredLanguages)
+	equalStrings(t, phase, serverHeaderKey, defaultServerHeader, Get.ServerHeader)
+	equalBool(t, phase, showListingKey, defaultShowListing, Get.ShowListing)
+	equalBool(t, phase, sitemapKey, defaultSitemap, Get.Sitemap)
+	equalStrings(t, phase, sitemapBaseURLKey, defaultSitemapBaseURL, Get.SitemapBaseURL)
+	equalStrSlices(t, phase, sitemapExcludeKey, nil, Get.SitemapExclude)
+	equalStrSlices(t, phase, sitemapIncludeKey, defaultSitemapInclude, Get.SitemapInclude)
+	equalDuration(t, phase, sitemapIntervalKey, defaultSitemapInterval, Get.SitemapInterval)
+	equalBool(t, phase, statsKey, defaultStats, Get.Stats)
+	equalStrings(t, phase, statsPathKey, defaultStatsPath, Get.StatsPath)
+	equalBool(t, phase, stripMetadataKey, defaultStripMetadata, Get.StripMetadata)
+	equalStrings(t, phase, surrogateKeyHeaderKey, defaultSurrogateKeyHeader, Get.SurrogateKeyHeader)
+	equalStrings(t, phase, surrogateKeyManifestKey, defaultSurrogateKeyManifest, Get.SurrogateKeyManifest)
+	equalStrSlices(t, phase, templateVarsKey, nil, Get.TemplateVars)
+	equalBool(t, phase, templatesKey, defaultTemplates, Get.Templates)
+	equalStrings(t, phase, tlsCertKey, defaultTLSCert, Get.TLSCert)
+	equalStrings(t, phase, tlsKeyKey, defaultTLSKey, Get.TLSKey)
+	equalBool(t, phase, tlsOCSPStaplingKey, defaultTLSOCSPStapling, Get.TLSOCSPStapling)
+	equalDuration(t, phase, tlsReloadIntervalKey, defaultTLSReloadInterval, Get.TLSReloadInterval)
+	equalBool(t, phase, tlsSelfSignedKey, defaultTLSSelfSigned, Get.TLSSelfSigned)
+	equalStrings(t, phase, tlsVaultTokenKey, defaultTLSVaultToken, Get.TLSVaultToken)
+	equalStrings(t, phase, tlsVaultURLKey, defaultTLSVaultURL, Get.TLSVaultURL)
+	equalStrings(t, phase, traceKeyKey, defaultTraceKey, Get.TraceKey)
+	equalInt(t, phase, transferLimitKey, defaultTransferLimit, Get.TransferLimit)
+	equalInt(t, phase, transferLimitPerConnectionKey, defaultTransferLimitPerConnection, Get.TransferLimitPerConnection)
+	equalStrings(t, phase, urlPrefixKey, defaultURLPrefix, Get.URLPrefix)
+	equalBool(t, phase, usageKey, defaultUsage, Get.Usage)
+	equalStrings(t, phase, usagePathKey, defaultUsagePath, Get.UsagePath)
+	equalStrSlices(t, phase, usagePrefixesKey, nil, Get.UsagePrefixes)
+	equalDuration(t, phase, usageReportIntervalKey, defaultUsageReportInterval, Get.UsageReportInterval)
+	equalStrings(t, phase, usageStateKey, defaultUsageState, Get.UsageState)
+	equalStrSlices(t, phase, userAgentAllowKey, nil, Get.UserAgentAllow)
+	equalStrSlices(t, phase, userAgentDenyKey, nil, Get.UserAgentDeny)
+	equalInt(t, phase, videoBurstKey, defaultVideoBurst, Get.VideoBurst)
+	equalBool(t, phase, videoPresetKey, defaultVideoPreset, Get.VideoPreset)
+	equalStrings(t, phase, videoPresetCORSOriginKey, defaultVideoPresetCORSOrigin, Get.VideoPresetCORSOrigin)
+	equalDuration(t, phase, videoPresetPlaylistMaxAgeKey, defaultVideoPresetPlaylistMaxAge, Get.VideoPresetPlaylistMaxAge)
+	equalDuration(t, phase, videoPresetSegmentMaxAgeKey, defaultVideoPresetSegmentMaxAge, Get.VideoPresetSegmentMaxAge)
+	equalInt(t, phase, videoRateKey, defaultVideoRate, Get.VideoRate)
+	equalStrSlices(t, phase, warmupKey, nil, Get.Warmup)
+	equalInt(t, phase, warmupRecentKey, defaultWarmupRecent, Get.WarmupRecent)
+	equalDuration(t, phase, watchIntervalKey, defaultWatchInterval, Get.WatchInterval)
+	equalStrings(t, phase, wellKnownACMEFolderKey, defaultWellKnownACMEFolder, Get.WellKnownACMEFolder)
+	equalStrSlices(t, phase, wellKnownPassthroughKey, nil, Get.WellKnownPassthrough)
+	equalStrSlices(t, phase, wellKnownRedirectsKey, nil, Get.WellKnownRedirects)
+
+	// Apply overrides.
+	overrideWithEnvVars()
+
+	// Verify overrides.
+	phase = "overrides"
+	equalStrSlices(t, phase, accessLogExcludeKey, testAccessLogExclude, Get.AccessLogExclude)
+	equalStrSlices(t, phase, accessLogFieldsKey, testAccessLogFields, Get.AccessLogFields)
+	equalStrings(t, phase, accessLogHashKeyKey, testAccessLogHashKey, Get.AccessLogHashKey)
+	equalInt(t, phase, accessLogSampleKey, testAccessLogSample, Get.AccessLogSample)
+	equalInt(t, phase, alertMinRequestsKey, testAlertMinRequests, Get.AlertMinRequests)
+	equalDuration(t, phase, alertWindowKey, testAlertWindow, Get.AlertWindow)
+	equalStrSlices(t, phase, alertsKey, testAlerts, Get.Alerts)
+	equalStrings(t, phase, auditLogKey, testAuditLog, Get.AuditLog)
+	equalStrSlices(t, phase, authRealmsKey, testAuthRealms, Get.AuthRealms)
+	equalStrings(t, phase, cacheControlKey, testCacheControl, Get.CacheControl)
+	equalDuration(t, phase, cacheControlSMaxAgeKey, testCacheControlSMaxAge, Get.CacheControlSMaxAge)
+	equalDuration(t, phase, cacheControlStaleIfErrorKey, testCacheControlStaleIfError, Get.CacheControlStaleIfError)
+	equalDuration(t, phase, cacheControlStaleWhileRevalidateKey, testCacheControlStaleWhileRevalidate, Get.CacheControlStaleWhileRevalidate)
+	equalStrSlices(t, phase, cacheIgnoreQueryKey, testCacheIgnoreQuery, Get.CacheIgnoreQuery)
+	equalInt(t, phase, cacheMaxEntrySizeKey, testCacheMaxEntrySize, Get.CacheMaxEntrySize)
+	equalInt(t, phase, cacheMaxSizeKey, testCacheMaxSize, Get.CacheMaxSize)
+	equalDuration(t, phase, cacheTTLKey, testCacheTTL, Get.CacheTTL)
+	equalStrings(t, phase, canaryFolderKey, testCanaryFolder, Get.CanaryFolder)
+	equalInt(t, phase, canaryPercentKey, testCanaryPercent, Get.CanaryPercent)
+	equalStrings(t, phase, canaryStickyKey, testCanarySticky, Get.CanarySticky)
+	equalStrings(t, phase, cdnPurgeKey, testCDNPurge, Get.CDNPurge)
+	equalStrings(t, phase, cdnPurgeBaseURLKey, testCDNPurgeBaseURL, Get.CDNPurgeBaseURL)
+	equalStrings(t, phase, cdnPurgeIDKey, testCDNPurgeID, Get.CDNPurgeID)
+	equalStrings(t, phase, cdnPurgeTokenKey, testCDNPurgeToken, Get.CDNPurgeToken)
+	equalStrings(t, phase, checksumStateKey, testChecksumState, Get.ChecksumState)
+	equalInt(t, phase, checksumWorkersKey, testChecksumWorkers, Get.ChecksumWorkers)
+	equalStrSlices(t, phase, checksumsKey, testChecksums, Get.Checksums)
+	equalBool(t, phase, configDumpKey, testConfigDump, Get.ConfigDump)
+	equalStrings(t, phase, configDumpPathKey, testConfigDumpPath, Get.ConfigDumpPath)
+	equalStrSlices(t, phase, contentTypesKey, testContentTypes, Get.ContentTypes)
+	equalInt(t, phase, copyBufferSizeKey, testCopyBufferSize, Get.CopyBufferSize)
+	equalStrSlices(t, phase, corsKey, testCORS, Get.CORS)
+	equalStrings(t, phase, crossOriginEmbedderPolicyKey, testCrossOriginEmbedderPolicy, Get.CrossOriginEmbedderPolicy)
+	equalStrings(t, phase, crossOriginOpenerPolicyKey, testCrossOriginOpenerPolicy, Get.CrossOriginOpenerPolicy)
+	equalStrings(t, phase, crossOriginResourcePolicyKey, testCrossOriginResourcePolicy, Get.CrossOriginResourcePolicy)
+	equalBool(t, phase, debugKey, testDebug, Get.Debug)
+	equalStrings(t, phase, etagKey, testETag, Get.ETag)
+	equalStrings(t, phase, etagManifestKey, testETagManifest, Get.ETagManifest)
+	equalBool(t, phase, eventsKey, testEvents, Get.Events)
+	equalStrings(t, phase, eventsPathKey, testEventsPath, Get.EventsPath)
+	equalStrings(t, phase, folderKey, testFolder, Get.Folder)
+	equalStrSlices(t, phase, geoIPAllowKey, testGeoIPAllow, Get.GeoIPAllow)
+	equalStrSlices(t, phase, geoIPDenyKey, testGeoIPDeny, Get.GeoIPDeny)
+	equalStrings(t, phase, geoIPFolderKey, testGeoIPFolder, Get.GeoIPFolder)
+	equalStrSlices(t, phase, headersKey, testHeaders, Get.Headers)
+	equalStrings(t, phase, hostKey, testHost, Get.Host)
+	equalBool(t, phase, imageResizeKey, testImageResize, Get.ImageResize)
+	equalStrings(t, phase, imageResizeCacheKey, testImageResizeCache, Get.ImageResizeCache)
+	equalInt(t, phase, imageResizeCacheMaxSizeKey, testImageResizeCacheMaxSize, Get.ImageResizeCacheMaxSize)
+	equalInt(t, phase, imageResizeMaxPixelsKey, testImageResizeMaxPixels, Get.ImageResizeMaxPixels)
+	equalInt(t, phase, imageResizeMaxSizeKey, testImageResizeMaxSize, Get.ImageResizeMaxSize)
+	equalStrings(t, phase, injectBodyKey, testInjectBody, Get.InjectBody)
+	equalStrings(t, phase, injectHeadKey, testInjectHead, Get.InjectHead)
+	equalDuration(t, phase, lockoutBanTimeKey, testLockoutBanTime, Get.LockoutBanTime)
+	equalStrings(t, phase, lockoutPathKey, testLockoutPath, Get.LockoutPath)
+	equalInt(t, phase, lockoutThresholdKey, testLockoutThreshold, Get.LockoutThreshold)
+	equalDuration(t, phase, lockoutWindowKey, testLockoutWindow, Get.LockoutWindow)
+	equalStrings(t, phase, logOutputKey, testLogOutput, Get.LogOutput)
+	equalBool(t, phase, metadataKey, testMetadata, Get.Metadata)
+	equalBool(t, phase, metricsKey, testMetrics, Get.Metrics)
+	equalStrings(t, phase, metricsPathKey, testMetricsPath, Get.MetricsPath)
+	equalBool(t, phase, minifyKey, testMinify, Get.Minify)
+	equalInt(t, phase, mmapMinSizeKey, testMmapMinSize, Get.MmapMinSize)
+	equalStrings(t, phase, noiseKey, testNoise, Get.Noise)
+	equalStrSlices(t, phase, noisePathsKey, testNoisePaths, Get.NoisePaths)
+	equalInt(t, phase, notifyAuthFailuresKey, testNotifyAuthFailures, Get.NotifyAuthFailures)
+	equalStrSlices(t, phase, notifyEventsKey, testNotifyEvents, Get.NotifyEvents)
+	equalDuration(t, phase, notifyIntervalKey, testNotifyInterval, Get.NotifyInterval)
+	equalInt(t, phase, notifyServerErrorsKey, testNotifyServerErrors, Get.NotifyServerErrors)
+	equalStrings(t, phase, notifyWebhookKey, testNotifyWebhook, Get.NotifyWebhook)
+	equalDuration(t, phase, notifyWindowKey, testNotifyWindow, Get.NotifyWindow)
+	equalInt(t, phase, openFileCacheSizeKey, testOpenFileCacheSize, Get.OpenFileCacheSize)
+	equalStrings(t, phase, pathNormalizationKey, testPathNormalization, Get.PathNormalization)
+	equalStrSlices(t, phase, permissionsPolicyKey, testPermissionsPolicy, Get.PermissionsPolicy)
+	equalStrSlices(t, phase, policyKey, testPolicy, Get.Policy)
+	equalUint16(t, phase, portKey, testPort, Get.Port)
+	equalStrings(t, phase, presignCredentialsKey, testPresignCredentials, Get.PresignCredentials)
+	equalDuration(t, phase, presignExpiresKey, testPresignExpires, Get.PresignExpires)
+	equalStrings(t, phase, presignRegionKey, testPresignRegion, Get.PresignRegion)
+	equalStrings(t, phase, presignURLKey, testPresignURL, Get.PresignURL)
+	equalBool(t, phase, problemDetailsKey, testProblemDetails, Get.ProblemDetails)
+	equalStrSlices(t, phase, protocolsKey, testProtocols, Get.Protocols)
+	equalStrings(t, phase, purgeWebhookKey, testPurgeWebhook, Get.PurgeWebhook)
+	equalInt(t, phase, rateLimitKey, testRateLimit, Get.RateLimit)
+	equalDuration(t, phase, rateLimitWindowKey, testRateLimitWindow, Get.RateLimitWindow)
+	equalInt(t, phase, readvBatchKey, testReadvBatch, Get.ReadvBatch)
+	equalBool(t, phase, retentionDryRunKey, testRetentionDryRun, Get.RetentionDryRun)
+	equalDuration(t, phase, retentionIntervalKey, testRetentionInterval, Get.RetentionInterval)
+	equalInt(t, phase, retentionKeepKey, testRetentionKeep, Get.RetentionKeep)
+	equalDuration(t, phase, retentionMaxAgeKey, testRetentionMaxAge, Get.RetentionMaxAge)
+	equalStrSlices(t, phase, retentionPatternsKey, testRetentionPatterns, Get.RetentionPatterns)
+	equalStrings(t, phase, robotsTxtKey, testRobotsTxt, Get.RobotsTxt)
+	equalBool(t, phase, rootsKey, testRoots, Get.Roots)
+	equalStrSlices(t, phase, rootsFoldersKey, testRootsFolders, Get.RootsFolders)
+	equalStrings(t, phase, rootsPathKey, testRootsPath, Get.RootsPath)
+	equalStrings(t, phase, scriptKey, testScript, Get.Script)
+	equalBool(t, phase, searchKey, testSearch, Get.Search)
+	equalBool(t, phase, searchContentsKey, testSearchContents, Get.SearchContents)
+	equalBool(t, phase, searchIndexKey, testSearchIndex, Get.SearchIndex)
+	equalStrings(t, phase, searchPathKey, testSearchPath, Get.SearchPath)
+	equalStrSlices(t, phase, securityTxtContactKey, testSecurityTxtContact, Get.SecurityTxtContact)
+	equalStrings(t, phase, securityTxtEncryptionKey, testSecurityTxtEncryption, Get.SecurityTxtEncryption)
+	equalStrings(t, phase, securityTxtExpiresKey, testSecurityTxtExpires, Get.SecurityTxtExpires)
+	equalStrings(t, phase, securityTxtPolicyKey, testSecurityTxtPolicy, Get.SecurityTxtPolicy)
+	equalStrings(t, phase, securityTxtPreferredLanguagesKey, testSecurityTxtPreferredLanguages, Get.SecurityTxtPreferredLanguages)
+	equalStrings(t, phase, serverHeaderKey, testServerHeader, Get.ServerHeader)
+	equalBool(t, phase, showListingKey, testShowListing, Get.ShowListing)
+	equalBool(t, phase, sitemapKey, testSitemap, Get.Sitemap)
+	equalStrings(t, phase, sitemapBaseURLKey, testSitemapBaseURL, Get.SitemapBaseURL)
+	equalStrSlices(t, phase, sitemapExcludeKey, testSitemapExclude, Get.SitemapExclude)
+	equalStrSlices(t, phase, sitemapIncludeKey, testSitemapInclude, Get.SitemapInclude)
+	equalDuration(t, phase, sitemapIntervalKey, testSitemapInterval, Get.SitemapInterval)
+	equalBool(t, phase, statsKey, testStats, Get.Stats)
+	equalStrings(t, phase, statsPathKey, testStatsPath, Get.StatsPath)
+	equalBool(t, phase, stripMetadataKey, testStripMetadata, Get.StripMetadata)
+	equalStrings(t, phase, surrogateKeyHeaderKey, testSurrogateKeyHeader, Get.SurrogateKeyHeader)
+	equalStrings(t, phase, surrogateKeyManifestKey, testSurrogateKeyManifest, Get.SurrogateKeyManifest)
+	equalStrSlices(t, phase, templateVarsKey, testTemplateVars, Get.TemplateVars)
+	equalBool(t, phase, templatesKey, testTemplates, Get.Templates)
+	equalStrings(t, phase, tlsCertKey, testTLSCert, Get.TLSCert)
+	equalStrings(t, phase, tlsKeyKey, testTLSKey, Get.TLSKey)
+	equalBool(t, phase, tlsOCSPStaplingKey, testTLSOCSPStapling, Get.TLSOCSPStapling)
+	equalDuration(t, phase, tlsReloadIntervalKey, testTLSReloadInterval, Get.TLSReloadInterval)
+	equalBool(t, phase, tlsSelfSignedKey, testTLSSelfSigned, Get.TLSSelfSigned)
+	equalStrings(t, phase, tlsVaultTokenKey, testTLSVaultToken, Get.TLSVaultToken)
+	equalStrings(t, phase, tlsVaultURLKey, testTLSVaultURL, Get.TLSVaultURL)
+	equalStrings(t, phase, traceKeyKey, testTraceKey, Get.TraceKey)
+	equalInt(t, phase, transferLimitKey, testTransferLimit, Get.TransferLimit)
+	equalInt(t, phase, transferLimitPerConnectionKey, testTransferLimitPerConnection, Get.TransferLimitPerConnection)
+	equalStrings(t, phase, urlPrefixKey, testURLPrefix, Get.URLPrefix)
+	equalBool(t, phase, usageKey, testUsage, Get.Usage)
+	equalStrings(t, phase, usagePathKey, testUsagePath, Get.UsagePath)
+	equalStrSlices(t, phase, usagePrefixesKey, testUsagePrefixes, Get.UsagePrefixes)
+	equalDuration(t, phase, usageReportIntervalKey, testUsageReportInterval, Get.UsageReportInterval)
+	equalStrings(t, phase, usageStateKey, testUsageState, Get.UsageState)
+	equalStrSlices(t, phase, userAgentAllowKey, testUserAgentAllow, Get.UserAgentAllow)
+	equalStrSlices(t, phase, userAgentDenyKey, testUserAgentDeny, Get.UserAgentDeny)
+	equalInt(t, phase, videoBurstKey, testVideoBurst, Get.VideoBurst)
+	equalBool(t, phase, videoPresetKey, testVideoPreset, Get.VideoPreset)
+	equalStrings(t, phase, videoPresetCORSOriginKey, testVideoPresetCORSOrigin, Get.VideoPresetCORSOrigin)
+	equalDuration(t, phase, videoPresetPlaylistMaxAgeKey, testVideoPresetPlaylistMaxAge, Get.VideoPresetPlaylistMaxAge)
+	equalDuration(t, phase, videoPresetSegmentMaxAgeKey, testVideoPresetSegmentMaxAge, Get.VideoPresetSegmentMaxAge)
+	equalInt(t, phase, videoRateKey, testVideoRate, Get.VideoRate)
+	equalStrSlices(t, phase, warmupKey, testWarmup, Get.Warmup)
+	equalInt(t, phase, warmupRecentKey, testWarmupRecent, Get.WarmupRecent)
+	equalDuration(t, phase, watchIntervalKey, testWatchInterval, Get.WatchInterval)
+	equalStrings(t, phase, wellKnownACMEFolderKey, testWellKnownACMEFolder, Get.WellKnownACMEFolder)
+	equalStrSlices(t, phase, wellKnownPassthroughKey, testWellKnownPassthrough, Get.WellKnownPassthrough)
+	equalStrSlices(t, phase, wellKnownRedirectsKey, testWellKnownRedirects, Get.WellKnownRedirects)
+}
+
+func TestValidate(t *testing.T) {
+	setDefaults()
+	validPath := "config.go"
+	invalidPath := "should/never/exist.txt"
+	empty := ""
+	prefix := "/my/prefix"
+
+	testCases := []struct {
+		name    string
+		cert    string
+		key     string
+		prefix  string
+		isError bool
+	}{
+		{"Valid paths w/prefix", validPath, validPath, prefix, false},
+		{"Valid paths wo/prefix", validPath, validPath, empty, false},
+		{"Empty paths w/prefix", empty, empty, prefix, false},
+		{"Empty paths wo/prefix", empty, empty, empty, false},
+		{"Mixed paths w/prefix", empty, validPath, prefix, true},
+		{"Alt mixed paths w/prefix", validPath, empty, prefix, true},
+		{"Mixed paths wo/prefix", empty, validPath, empty, true},
+		{"Alt mixed paths wo/prefix", validPath, empty, empty, true},
+		{"Invalid cert w/prefix", invalidPath, validPath, prefix, true},
+		{"Invalid key w/prefix", validPath, invalidPath, prefix, true},
+		{"Invalid cert & key w/prefix", invalidPath, invalidPath, prefix, true},
+		{"Prefix missing leading /", empty, empty, "my/prefix", true},
+		{"Prefix with trailing /", empty, empty, "/my/prefix/", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			Get.TLSCert = tc.cert
+			Get.TLSKey = tc.key
+			Get.URLPrefix = tc.prefix
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateTLSSelfSigned(t *testing.T) {
+	setDefaults()
+	defer setDefaults()
+
+	Get.TLSSelfSigned = true
+	if err := validate(); nil != err {
+		t.Errorf("Expected no error but got %v", err)
+	}
+	Get.TLSCert, Get.TLSKey = "config.go", "config.go"
+	if err := validate(); nil == err {
+		t.Error("With a certificate expected an error but got nil")
+	}
+}
+
+func TestValidateTLSVault(t *testing.T) {
+	testCases := []struct {
+		name     string
+		url      string
+		token    string
+		cert     string
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", "", "", "", defaultTLSReloadInterval, false},
+		{"Valid", "https://vault:8200/v1/secret/data/web", "token", "", defaultTLSReloadInterval, false},
+		{"Not HTTP", "vault:8200/v1/secret/data/web", "token", "", defaultTLSReloadInterval, true},
+		{"Without token", "https://vault:8200/v1/secret/data/web", "", "", defaultTLSReloadInterval, true},
+		{"With certificate", "https://vault:8200/v1/secret/data/web", "token", "config.go", defaultTLSReloadInterval, true},
+		{"No interval", "https://vault:8200/v1/secret/data/web", "token", "", 0, true},
+		{"Files without interval", "", "", "config.go", 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.TLSVaultURL, Get.TLSVaultToken = tc.url, tc.token
+			Get.TLSCert, Get.TLSKey = tc.cert, tc.cert
+			Get.TLSReloadInterval = tc.interval
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateTLSOCSPStapling(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cert    string
+		url     string
+		isError bool
+	}{
+		{"Certificate files", "config.go", "", false},
+		{"Vault secret", "", "https://vault:8200/v1/secret/data/web", false},
+		{"Without certificate", "", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.TLSOCSPStapling = true
+			Get.TLSCert, Get.TLSKey = tc.cert, tc.cert
+			Get.TLSVaultURL, Get.TLSVaultToken = tc.url, "token"
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateProtocols(t *testing.T) {
+	testCases := []struct {
+		name      string
+		protocols []string
+		isError   bool
+	}{
+		{"Default", defaultProtocols, false},
+		{"Without HTTP/2", []string{"http/1.1"}, false},
+		{"Without HTTP/1.1", []string{"h2"}, true},
+		{"Cleartext HTTP/2", []string{"h2", "h2c", "http/1.1"}, false},
+		{"HTTP/3", []string{"h3", "http/1.1"}, true},
+		{"None", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Protocols = tc.protocols
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateGeoIP(t *testing.T) {
+	codes := []string{"US"}
+	folder := "/my/geoip"
+
+	testCases := []struct {
+		name    string
+		allow   []string
+		deny    []string
+		folder  string
+		isError bool
+	}{
+		{"Nothing set", nil, nil, "", false},
+		{"Folder only", nil, nil, folder, false},
+		{"Allow with folder", codes, nil, folder, false},
+		{"Deny with folder", nil, codes, folder, false},
+		{"Allow without folder", codes, nil, "", true},
+		{"Deny without folder", nil, codes, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.GeoIPAllow = tc.allow
+			Get.GeoIPDeny = tc.deny
+			Get.GeoIPFolder = tc.folder
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateGeneratedFiles(t *testing.T) {
+	contact := []string{"mailto:security@apets.life"}
+	expires := "2030-01-01T00:00:00Z"
+
+	testCases := []struct {
+		name    string
+		robots  string
+		contact []string
+		expires string
+		policy  string
+		isError bool
+	}{
+		{"Nothing set", "", nil, "", "", false},
+		{"Robots allow", "allow", nil, "", "", false},
+		{"Robots deny", "deny", nil, "", "", false},
+		{"Robots template", "config.go", nil, "", "", false},
+		{"Robots missing template", "should/never/exist.txt", nil, "", "", true},
+		{"Security required fields", "", contact, expires, "", false},
+		{"Security all fields", "", contact, expires, "policy", false},
+		{"Security missing contact", "", nil, expires, "", true},
+		{"Security missing expires", "", contact, "", "", true},
+		{"Security only policy", "", nil, "", "policy", true},
+		{"Security bad expires", "", contact, "2030-01-01", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.RobotsTxt = tc.robots
+			Get.SecurityTxtContact = tc.contact
+			Get.SecurityTxtExpires = tc.expires
+			Get.SecurityTxtPolicy = tc.policy
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateTemplateVars(t *testing.T) {
+	testCases := []struct {
+		name    string
+		vars    []string
+		isError bool
+	}{
+		{"None", nil, false},
+		{"Valid", []string{"API_URL=https://api.example.com", "_id2=", "Empty="}, false},
+		{"Value with equals", []string{"QUERY=a=b"}, false},
+		{"Without value", []string{"API_URL"}, true},
+		{"Without name", []string{"=value"}, true},
+		{"Leading digit", []string{"1ST=value"}, true},
+		{"Dash", []string{"API-URL=value"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.TemplateVars = tc.vars
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateImageResize(t *testing.T) {
+	testCases := []struct {
+		name         string
+		enabled      bool
+		maxSize      int
+		maxPixels    int
+		cache        string
+		cacheMaxSize int
+		isError      bool
+	}{
+		{"Disabled", false, 0, 0, "", 0, false},
+		{"Enabled", true, 2048, 40000000, "", 0, false},
+		{"No max size", true, 0, 40000000, "", 0, true},
+		{"No max pixels", true, 2048, 0, "", 0, true},
+		{"Cached", true, 2048, 40000000, "/var/cache/images", 1 << 20, false},
+		{"Cached without limit", true, 2048, 40000000, "/var/cache/images", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.ImageResize = tc.enabled
+			Get.ImageResizeMaxSize = tc.maxSize
+			Get.ImageResizeMaxPixels = tc.maxPixels
+			Get.ImageResizeCache = tc.cache
+			Get.ImageResizeCacheMaxSize = tc.cacheMaxSize
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateCanary(t *testing.T) {
+	testCases := []struct {
+		name    string
+		folder  string
+		percent int
+		sticky  string
+		isError bool
+	}{
+		{"Disabled", "", 200, "", false},
+		{"Cookie", ".", 10, "cookie", false},
+		{"IP", ".", 100, "ip", false},
+		{"Missing folder", "missing", 10, "cookie", true},
+		{"File", "config.go", 10, "cookie", true},
+		{"Negative", ".", -1, "cookie", true},
+		{"Too many", ".", 101, "cookie", true},
+		{"Unknown sticky", ".", 10, "header", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.CanaryFolder = tc.folder
+			Get.CanaryPercent = tc.percent
+			Get.CanarySticky = tc.sticky
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	testCases := []struct {
+		name     string
+		patterns []string
+		keep     int
+		maxAge   time.Duration
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", nil, -1, -time.Hour, 0, false},
+		{"Keep", []string{"*.zip"}, 3, 0, time.Hour, false},
+		{"Max age", []string{"*.zip"}, 0, time.Hour, time.Hour, false},
+		{"Bad pattern", []string{"["}, 3, 0, time.Hour, true},
+		{"Negative keep", []string{"*.zip"}, -1, 0, time.Hour, true},
+		{"Negative max age", []string{"*.zip"}, 0, -time.Hour, time.Hour, true},
+		{"No interval", []string{"*.zip"}, 3, 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.RetentionPatterns = tc.patterns
+			Get.RetentionKeep = tc.keep
+			Get.RetentionMaxAge = tc.maxAge
+			Get.RetentionInterval = tc.interval
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateRoots(t *testing.T) {
+	testCases := []struct {
+		name    string
+		roots   bool
+		folders []string
+		path    string
+		isError bool
+	}{
+		{"Disabled", false, []string{"blue"}, "roots", false},
+		{"No folders", true, nil, "/__roots", false},
+		{"Folders", true, []string{"blue=.", "green=.."}, "/__roots", false},
+		{"Missing name", true, []string{"=."}, "/__roots", true},
+		{"Default name", true, []string{"default=."}, "/__roots", true},
+		{"Missing folder", true, []string{"blue=missing"}, "/__roots", true},
+		{"File", true, []string{"blue=config.go"}, "/__roots", true},
+		{"Relative path", true, nil, "roots", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Roots = tc.roots
+			Get.RootsFolders = tc.folders
+			Get.RootsPath = tc.path
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidatePathNormalization(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  string
+		isError bool
+	}{
+		{"Reject", "reject", false},
+		{"Normalize", "normalize", false},
+		{"Off", "off", false},
+		{"Empty", "", true},
+		{"Unknown", "redirect", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.PathNormalization = tc.policy
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateNoise(t *testing.T) {
+	testCases := []struct {
+		name    string
+		noise   string
+		paths   []string
+		isError bool
+	}{
+		{"Disabled", "", []string{"["}, false},
+		{"No content", "no-content", defaultNoisePaths, false},
+		{"Synthesize", "synthesize", defaultNoisePaths, false},
+		{"Bad response", "not-found", defaultNoisePaths, true},
+		{"Bad pattern", "no-content", []string{"/favicon[.ico"}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Noise = tc.noise
+			Get.NoisePaths = tc.paths
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateScript(t *testing.T) {
+	testCases := []struct {
+		name    string
+		script  string
+		isError bool
+	}{
+		{"Disabled", "", false},
+		{"Script", "config.go", false},
+		{"Missing script", "should/never/exist.script", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Script = tc.script
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateWellKnownACMEFolder(t *testing.T) {
+	testCases := []struct {
+		name    string
+		folder  string
+		isError bool
+	}{
+		{"Disabled", "", false},
+		{"Folder", ".", false},
+		{"File", "config.go", true},
+		{"Missing folder", "should/never/exist", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.WellKnownACMEFolder = tc.folder
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateChecksumWorkers(t *testing.T) {
+	testCases := []struct {
+		name    string
+		workers int
+		isError bool
+	}{
+		{"Disabled", 0, false},
+		{"Enabled", 4, false},
+		{"Negative workers", -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.ChecksumWorkers = tc.workers
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidatePresign(t *testing.T) {
+	testCases := []struct {
+		name        string
+		url         string
+		credentials string
+		region      string
+		expires     time.Duration
+		isError     bool
+	}{
+		{"Disabled", "", "", "us-east-1", time.Minute, false},
+		{"Enabled", "https://bucket.s3.amazonaws.com", "key:secret", "us-east-1", time.Minute, false},
+		{"Session token", "https://bucket.s3.amazonaws.com", "key:secret:token", "us-east-1", time.Minute, false},
+		{"Not a URL", "bucket", "key:secret", "us-east-1", time.Minute, true},
+		{"No secret", "https://bucket.s3.amazonaws.com", "key", "us-east-1", time.Minute, true},
+		{"No region", "https://bucket.s3.amazonaws.com", "key:secret", "", time.Minute, true},
+		{"Too short", "https://bucket.s3.amazonaws.com", "key:secret", "us-east-1", time.Millisecond, true},
+		{"Too long", "https://bucket.s3.amazonaws.com", "key:secret", "us-east-1", 8 * 24 * time.Hour, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.PresignURL = tc.url
+			Get.PresignCredentials = tc.credentials
+			Get.PresignRegion = tc.region
+			Get.PresignExpires = tc.expires
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateMmap(t *testing.T) {
+	testCases := []struct {
+		name    string
+		size    int
+		isError bool
+	}{
+		{"Disabled", 0, false},
+		{"Enabled", 1 << 20, false},
+		{"Negative size", -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.MmapMinSize = tc.size
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateOpenFileCache(t *testing.T) {
+	testCases := []struct {
+		name     string
+		size     int
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", 0, 0, false},
+		{"Enabled", 256, time.Second, false},
+		{"Negative size", -1, time.Second, true},
+		{"Without watching", 256, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.OpenFileCacheSize = tc.size
+			Get.WatchInterval = tc.interval
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateReadv(t *testing.T) {
+	testCases := []struct {
+		name    string
+		batch   int
+		isError bool
+	}{
+		{"Disabled", 0, false},
+		{"Enabled", 8, false},
+		{"Negative batch", -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.ReadvBatch = tc.batch
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateWarmup(t *testing.T) {
+	testCases := []struct {
+		name    string
+		names   []string
+		recent  int
+		isError bool
+	}{
+		{"Disabled", nil, 0, false},
+		{"Names", []string{"/index.html", "/assets"}, 0, false},
+		{"Recent", nil, 100, false},
+		{"Relative name", []string{"index.html"}, 0, true},
+		{"Negative recent", nil, -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Warmup = tc.names
+			Get.WarmupRecent = tc.recent
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateNotify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		webhook  string
+		events   []string
+		watch    time.Duration
+		failures int
+		isError  bool
+	}{
+		{"Disabled", "", nil, 0, 0, false},
+		{"Defaults", "https://hooks.example.com", defaultNotifyEvents, defaultWatchInterval, defaultNotifyAuthFailures, false},
+		{"Not a URL", "hooks.example.com", defaultNotifyEvents, defaultWatchInterval, defaultNotifyAuthFailures, true},
+		{"Unknown event", "https://hooks.example.com", []string{"download"}, defaultWatchInterval, defaultNotifyAuthFailures, true},
+		{"Downloads without watch", "https://hooks.example.com", []string{"first-download"}, 0, defaultNotifyAuthFailures, true},
+		{"Errors without watch", "https://hooks.example.com", []string{"server-errors"}, 0, defaultNotifyAuthFailures, false},
+		{"Zero threshold", "https://hooks.example.com", defaultNotifyEvents, defaultWatchInterval, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.NotifyWebhook = tc.webhook
+			Get.NotifyEvents = tc.events
+			Get.WatchInterval = tc.watch
+			Get.NotifyAuthFailures = tc.failures
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateUsage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prefixes []string
+		interval time.Duration
+		isError  bool
+	}{
+		{"Defaults", nil, 0, false},
+		{"Prefixes", []string{"/team-a", "/team-b"}, 24 * time.Hour, false},
+		{"Relative prefix", []string{"team-a"}, 0, true},
+		{"Negative interval", nil, -time.Hour, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Usage = true
+			Get.UsagePrefixes = tc.prefixes
+			Get.UsageReportInterval = tc.interval
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateCopyBufferSize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		size    int
+		isError bool
+	}{
+		{"Default", defaultCopyBufferSize, false},
+		{"Zero", 0, true},
+		{"Negative", -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.CopyBufferSize = tc.size
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateCache(t *testing.T) {
+	testCases := []struct {
+		name    string
+		size    int
+		entry   int
+		isError bool
+	}{
+		{"Disabled", 0, 0, false},
+		{"Enabled", 1 << 20, 1 << 10, false},
+		{"Negative size", -1, 1 << 10, true},
+		{"Negative entry size", 1 << 20, -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.CacheMaxSize = tc.size
+			Get.CacheMaxEntrySize = tc.entry
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateLockout(t *testing.T) {
+	testCases := []struct {
+		name      string
+		threshold int
+		window    time.Duration
+		banTime   time.Duration
+		isError   bool
+	}{
+		{"Disabled", 0, 0, 0, false},
+		{"Enabled", 5, time.Minute, time.Hour, false},
+		{"No window", 5, 0, time.Hour, true},
+		{"No ban time", 5, time.Minute, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.LockoutThreshold = tc.threshold
+			Get.LockoutWindow = tc.window
+			Get.LockoutBanTime = tc.banTime
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	testCases := []struct {
+		name    string
+		limit   int
+		window  time.Duration
+		isError bool
+	}{
+		{"Disabled", 0, 0, false},
+		{"Enabled", 100, time.Minute, false},
+		{"No window", 100, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.RateLimit = tc.limit
+			Get.RateLimitWindow = tc.window
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateAccessLogSample(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sample  int
+		isError bool
+	}{
+		{"Every request", 1, false},
+		{"Sampled", 100, false},
+		{"Zero", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.AccessLogSample = tc.sample
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateAlerts(t *testing.T) {
+	testCases := []struct {
+		name        string
+		alerts      []string
+		window      time.Duration
+		minRequests int
+		isError     bool
+	}{
+		{"No alerts", nil, 0, 0, false},
+		{"Rules", []string{"5xx>5", "4xx>12.5"}, time.Minute, 20, false},
+		{"Unknown class", []string{"6xx>5"}, time.Minute, 20, true},
+		{"Missing percent", []string{"5xx"}, time.Minute, 20, true},
+		{"Full percent", []string{"5xx>100"}, time.Minute, 20, true},
+		{"No window", []string{"5xx>5"}, 0, 20, true},
+		{"No minimum requests", []string{"5xx>5"}, time.Minute, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Alerts = tc.alerts
+			Get.AlertWindow = tc.window
+			Get.AlertMinRequests = tc.minRequests
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateLogOutput(t *testing.T) {
+	testCases := []struct {
+		name    string
+		output  string
+		isError bool
+	}{
+		{"Standard error", "", false},
+		{"GELF", "gelf+udp://graylog:12201", false},
+		{"Syslog", "syslog+tcp://rsyslog:514", false},
+		{"Unknown", "fluent://fluentd:24224", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.LogOutput = tc.output
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateTransferLimit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		perIP         int
+		perConnection int
+		isError       bool
+	}{
+		{"Disabled", 0, 0, false},
+		{"Enabled", 4, 2, false},
+		{"Negative per IP", -1, 0, true},
+		{"Negative per connection", 0, -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.TransferLimit = tc.perIP
+			Get.TransferLimitPerConnection = tc.perConnection
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateVideo(t *testing.T) {
+	testCases := []struct {
+		name    string
+		burst   int
+		rate    int
+		isError bool
+	}{
+		{"Disabled", 0, 0, false},
+		{"Enabled", 4000000, 500000, false},
+		{"Negative burst", -1, 500000, true},
+		{"Negative rate", 0, -1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.VideoBurst = tc.burst
+			Get.VideoRate = tc.rate
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateVideoPreset(t *testing.T) {
+	testCases := []struct {
+		name       string
+		preset     bool
+		origin     string
+		segmentAge time.Duration
+		isError    bool
+	}{
+		{"Disabled", false, "player", -time.Second, false},
+		{"Enabled", true, "", time.Hour, false},
+		{"Any origin", true, "*", time.Hour, false},
+		{"Origin", true, "https://player.example.com", 0, false},
+		{"Bad origin", true, "player.example.com", time.Hour, true},
+		{"Negative max age", true, "*", -time.Second, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.VideoPreset = tc.preset
+			Get.VideoPresetCORSOrigin = tc.origin
+			Get.VideoPresetSegmentMaxAge = tc.segmentAge
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateCrossOrigin(t *testing.T) {
+	testCases := []struct {
+		name     string
+		embedder string
+		opener   string
+		resource string
+		isError  bool
+	}{
+		{"Disabled", "", "", "", false},
+		{"Isolated", "require-corp", "same-origin", "same-site", false},
+		{"Bad embedder", "same-origin", "", "", true},
+		{"Bad opener", "", "require-corp", "", true},
+		{"Bad resource", "", "", "same-origin-allow-popups", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.CrossOriginEmbedderPolicy = tc.embedder
+			Get.CrossOriginOpenerPolicy = tc.opener
+			Get.CrossOriginResourcePolicy = tc.resource
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateETag(t *testing.T) {
+	testCases := []struct {
+		name     string
+		etag     string
+		manifest string
+		override string
+		isError  bool
+	}{
+		{"Default", "none", "", "", false},
+		{"Strong", "strong", "", "weak", false},
+		{"Manifest", "manifest", "/etc/etags.json", "", false},
+		{"Manifest override", "weak", "/etc/etags.json", "manifest", false},
+		{"Missing manifest", "manifest", "", "", true},
+		{"Missing override manifest", "weak", "", "manifest", true},
+		{"Unknown", "hash", "", "", true},
+		{"Unknown override", "weak", "", "hash", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.ETag = tc.etag
+			Get.ETagManifest = tc.manifest
+			Get.Overrides = []Override{{Prefix: "/assets", ETag: tc.override}}
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateCacheControl(t *testing.T) {
+	testCases := []struct {
+		name                       string
+		sMaxAge, staleIfError, swr time.Duration
+		isError                    bool
+	}{
+		{"Disabled", 0, 0, 0, false},
+		{"Enabled", time.Hour, time.Hour, time.Minute, false},
+		{"Negative s-maxage", -time.Hour, 0, 0, true},
+		{"Negative stale-if-error", 0, -time.Hour, 0, true},
+		{"Negative stale-while-revalidate", 0, 0, -time.Minute, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.CacheControlSMaxAge = tc.sMaxAge
+			Get.CacheControlStaleIfError = tc.staleIfError
+			Get.CacheControlStaleWhileRevalidate = tc.swr
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidatePurgeWebhook(t *testing.T) {
+	testCases := []struct {
+		name     string
+		webhook  string
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", "", 0, false},
+		{"Enabled", "https://deploy.example.com/purge", time.Minute, false},
+		{"Not a URL", "deploy.example.com/purge", time.Minute, true},
+		{"No interval", "https://deploy.example.com/purge", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.PurgeWebhook = tc.webhook
+			Get.WatchInterval = tc.interval
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
+
+func TestValidateOverrides(t *testing.T) {
+	testCases := []struct {
+		name      string
+		overrides []Override
+		isError   bool
+	}{
+		{"None", nil, false},
+		{"Single", []Override{{Prefix: "/public"}}, false},
+		{"Multiple", []Override{{Prefix: "/public"}, {Prefix: "/internal"}}, false},
+		{"Relative prefix", []Override{{Prefix: "public"}}, true},
+		{"Repeated prefix", []Override{{Prefix: "/public"}, {Prefix: "/public"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Overrides = tc.overrides
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+	setDefaults()
+}
+
+func TestValidateTenants(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tenants []Tenant
+		isError bool
+	}{
+		{"None", nil, false},
+		{"Multiple", []Tenant{
+			{Name: "web", Prefix: "/web", Auth: "key:keys.txt", RateLimit: 100},
+			{Name: "ci", Prefix: "/ci", Bandwidth: 1 << 20},
+		}, false},
+		{"Without name", []Tenant{{Prefix: "/web"}}, true},
+		{"Repeated name", []Tenant{{Name: "web", Prefix: "/a"}, {Name: "web", Prefix: "/b"}}, true},
+		{"Relative prefix", []Tenant{{Name: "web", Prefix: "web"}}, true},
+		{"Repeated prefix", []Tenant{{Name: "a", Prefix: "/web"}, {Name: "b", Prefix: "/web"}}, true},
+		{"Negative rate limit", []Tenant{{Name: "web", Prefix: "/web", RateLimit: -1}}, true},
+		{"Negative window", []Tenant{{Name: "web", Prefix: "/web", RateLimitWindow: -time.Second}}, true},
+		{"Negative bandwidth", []Tenant{{Name: "web", Prefix: "/web", Bandwidth: -1}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Tenants = tc.tenants
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidatePlugins(t *testing.T) {
+	testCases := []struct {
+		name    string
+		plugins []Plugin
+		isError bool
+	}{
+		{"None", nil, false},
+		{"Placed", []Plugin{
+			{Name: "sso", After: "auth", Options: map[string]string{"issuer": "https://sso"}},
+			{Name: "rewrite", Before: "cache"},
+			{Name: "last"},
+		}, false},
+		{"Without name", []Plugin{{After: "auth"}}, true},
+		{"Before and after", []Plugin{{Name: "sso", Before: "auth", After: "auth"}}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Plugins = tc.plugins
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
 
-	// Apply overrides.
-	overrideWithEnvVars()
+func TestValidateListeners(t *testing.T) {
+	testCases := []struct {
+		name      string
+		listeners []Listener
+		isError   bool
+	}{
+		{"None", nil, false},
+		{"Public and internal", []Listener{
+			{Port: 8081, Prefixes: []string{"/pub"}},
+			{Host: "127.0.0.1", Port: 9090, Admin: true},
+		}, false},
+		{"Without port", []Listener{{Prefixes: []string{"/pub"}}}, true},
+		{"Main port", []Listener{{Port: defaultPort}}, true},
+		{"Repeated port", []Listener{{Port: 8081}, {Port: 8081}}, true},
+		{"Relative prefix", []Listener{{Port: 8081, Prefixes: []string{"pub"}}}, true},
+		{"Without HTTP/2", []Listener{{Port: 8081, Protocols: []string{"http/1.1"}}}, false},
+		{"Cleartext HTTP/2", []Listener{{Port: 8081, Protocols: []string{"h2c", "http/1.1"}}}, false},
+		{"HTTP/3", []Listener{{Port: 8081, Protocols: []string{"h3", "http/1.1"}}}, true},
+		{"Without HTTP/1.1", []Listener{{Port: 8081, Protocols: []string{"h2"}}}, true},
+	}
 
-	// Verify overrides.
-	phase = "overrides"
-	equalBool(t, phase, debugKey, testDebug, Get.Debug)
-	equalStrings(t, phase, folderKey, testFolder, Get.Folder)
-	equalStrings(t, phase, hostKey, testHost, Get.Host)
-	equalUint16(t, phase, portKey, testPort, Get.Port)
-	equalBool(t, phase, showListingKey, testShowListing, Get.ShowListing)
-	equalStrings(t, phase, tlsCertKey, testTLSCert, Get.TLSCert)
-	equalStrings(t, phase, tlsKeyKey, testTLSKey, Get.TLSKey)
-	equalStrings(t, phase, urlPrefixKey, testURLPrefix, Get.URLPrefix)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Listeners = tc.listeners
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
 }
 
-func TestValidate(t *testing.T) {
-	validPath := "config.go"
-	invalidPath := "should/never/exist.txt"
-	empty := ""
-	prefix := "/my/prefix"
+func TestValidateEvents(t *testing.T) {
+	testCases := []struct {
+		name     string
+		enabled  bool
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", false, 0, false},
+		{"Enabled", true, defaultWatchInterval, false},
+		{"Enabled without watch", true, 0, true},
+	}
 
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Events = tc.enabled
+			Get.WatchInterval = tc.interval
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateSitemap(t *testing.T) {
 	testCases := []struct {
 		name    string
-		cert    string
-		key     string
-		prefix  string
+		enabled bool
+		baseURL string
 		isError bool
 	}{
-		{"Valid paths w/prefix", validPath, validPath, prefix, false},
-		{"Valid paths wo/prefix", validPath, validPath, empty, false},
-		{"Empty paths w/prefix", empty, empty, prefix, false},
-		{"Empty paths wo/prefix", empty, empty, empty, false},
-		{"Mixed paths w/prefix", empty, validPath, prefix, true},
-		{"Alt mixed paths w/prefix", validPath, empty, prefix, true},
-		{"Mixed paths wo/prefix", empty, validPath, empty, true},
-		{"Alt mixed paths wo/prefix", validPath, empty, empty, true},
-		{"Invalid cert w/prefix", invalidPath, validPath, prefix, true},
-		{"Invalid key w/prefix", validPath, invalidPath, prefix, true},
-		{"Invalid cert & key w/prefix", invalidPath, invalidPath, prefix, true},
-		{"Prefix missing leading /", empty, empty, "my/prefix", true},
-		{"Prefix with trailing /", empty, empty, "/my/prefix/", true},
+		{"Disabled", false, "", false},
+		{"Enabled", true, "https://www.example.com", false},
+		{"Enabled without base URL", true, "", true},
+		{"Base URL not a URL", true, "www.example.com", true},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			Get.TLSCert = tc.cert
-			Get.TLSKey = tc.key
-			Get.URLPrefix = tc.prefix
+			setDefaults()
+			defer setDefaults()
+			Get.Sitemap = tc.enabled
+			Get.SitemapBaseURL = tc.baseURL
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateSearchIndex(t *testing.T) {
+	testCases := []struct {
+		name     string
+		search   bool
+		index    bool
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", false, false, 0, false},
+		{"Index without search", false, true, 0, false},
+		{"Enabled", true, true, defaultWatchInterval, false},
+		{"Enabled without watch", true, true, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			defer setDefaults()
+			Get.Search = tc.search
+			Get.SearchIndex = tc.index
+			Get.WatchInterval = tc.interval
+			if err := validate(); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	testCases := []struct {
+		name    string
+		enabled bool
+		path    string
+		isError bool
+	}{
+		{"Disabled", false, "", false},
+		{"Enabled", true, "/__endpoint", false},
+		{"Enabled without leading /", true, "__endpoint", true},
+		{"Enabled without path", true, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run("Metrics "+tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Metrics = tc.enabled
+			Get.MetricsPath = tc.path
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+		t.Run("Events "+tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Events = tc.enabled
+			Get.EventsPath = tc.path
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+		t.Run("Lockout "+tc.name, func(t *testing.T) {
+			setDefaults()
+			if tc.enabled {
+				Get.LockoutThreshold = 5
+			}
+			Get.LockoutPath = tc.path
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+		t.Run("Search "+tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Search = tc.enabled
+			Get.SearchPath = tc.path
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+		t.Run("Stats "+tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Stats = tc.enabled
+			Get.StatsPath = tc.path
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+		t.Run("Usage "+tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.Usage = tc.enabled
+			Get.UsagePath = tc.path
 			err := validate()
 			hasError := nil != err
 			if hasError && !tc.isError {
@@ -245,6 +2425,112 @@ func TestEnvAsStr(t *testing.T) {
 	}
 }
 
+func TestEnvAsStrSlice(t *testing.T) {
+	lv := "LIST_VALUE"
+	sv := "SINGLE_VALUE"
+	ev := "EMPTY_ITEMS_VALUE"
+	uv := "UNSET_VALUE"
+
+	fbr := []string{"fallback"} // Fallback result
+
+	os.Setenv(lv, "one, two ,three")
+	os.Setenv(sv, "one")
+	os.Setenv(ev, ",one,,")
+
+	testCases := []struct {
+		name     string
+		key      string
+		fallback []string
+		result   []string
+	}{
+		{"List", lv, fbr, []string{"one", "two", "three"}},
+		{"Single", sv, fbr, []string{"one"}},
+		{"Empty items", ev, fbr, []string{"one"}},
+		{"Unset", uv, fbr, fbr},
+		{"Unset with nil fallback", uv, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := envAsStrSlice(tc.key, tc.fallback)
+			if !reflect.DeepEqual(tc.result, result) {
+				t.Errorf(
+					"For %s with a %v fallback expected %v but got %v",
+					tc.key, tc.fallback, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
+func TestEnvAsInt(t *testing.T) {
+	iv := "INT_VALUE"
+	nv := "NEGATIVE_VALUE"
+	fv := "FLOAT_VALUE"
+	uv := "UNSET_VALUE"
+
+	fbr := 666 // Fallback result
+
+	os.Setenv(iv, "1048576")
+	os.Setenv(nv, "-1")
+	os.Setenv(fv, "1.5")
+
+	testCases := []struct {
+		name     string
+		key      string
+		fallback int
+		result   int
+	}{
+		{"Int", iv, fbr, 1048576},
+		{"Negative", nv, fbr, -1},
+		{"Float", fv, fbr, fbr},
+		{"Unset", uv, fbr, fbr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := envAsInt(tc.key, tc.fallback)
+			if tc.result != result {
+				t.Errorf(
+					"For %s with a %d fallback expected %d but got %d",
+					tc.key, tc.fallback, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
+func TestEnvAsLines(t *testing.T) {
+	lv := "LINES_VALUE"
+	uv := "UNSET_VALUE"
+
+	fbr := []string{"fallback"} // Fallback result
+
+	os.Setenv(lv, "A: one, two\n\n  B: three  \r\n")
+
+	testCases := []struct {
+		name     string
+		key      string
+		fallback []string
+		result   []string
+	}{
+		{"Lines", lv, fbr, []string{"A: one, two", "B: three"}},
+		{"Unset", uv, fbr, fbr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := envAsLines(tc.key, tc.fallback)
+			if !reflect.DeepEqual(tc.result, result) {
+				t.Errorf(
+					"For %s with a %v fallback expected %v but got %v",
+					tc.key, tc.fallback, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
 func TestEnvAsUint16(t *testing.T) {
 	ubv := "UPPER_BOUNDS_VALUE"
 	lbv := "LOWER_BOUNDS_VALUE"
@@ -293,6 +2579,43 @@ func TestEnvAsUint16(t *testing.T) {
 	}
 }
 
+func TestEnvAsDuration(t *testing.T) {
+	dv := "DURATION_VALUE"
+	iv := "INT_VALUE"
+	sv := "STRING_VALUE"
+	uv := "UNSET_VALUE"
+
+	fbr := 5 * time.Second // Fallback result
+
+	os.Setenv(dv, "1h30m")
+	os.Setenv(iv, "90")
+	os.Setenv(sv, "Cheese")
+
+	testCases := []struct {
+		name     string
+		key      string
+		fallback time.Duration
+		result   time.Duration
+	}{
+		{"Duration", dv, fbr, 90 * time.Minute},
+		{"Int without unit", iv, fbr, fbr},
+		{"String", sv, fbr, fbr},
+		{"Unset", uv, fbr, fbr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := envAsDuration(tc.key, tc.fallback)
+			if tc.result != result {
+				t.Errorf(
+					"For %s with a %v fallback expected %v but got %v",
+					tc.key, tc.fallback, tc.result, result,
+				)
+			}
+		})
+	}
+}
+
 func TestEnvAsBool(t *testing.T) {
 	tv := "TRUE_VALUE"
 	fv := "FALSE_VALUE"
@@ -369,3 +2692,44 @@ func TestStrAsBool(t *testing.T) {
 
 	}
 }
+
+func TestValidateCDNPurge(t *testing.T) {
+	testCases := []struct {
+		name     string
+		provider string
+		id       string
+		token    string
+		baseURL  string
+		interval time.Duration
+		isError  bool
+	}{
+		{"Disabled", "", "", "", "", 0, false},
+		{"Fastly", "fastly", "service", "token", "", time.Minute, false},
+		{"Cloudflare", "cloudflare", "zone", "token", "https://www.example.com", time.Minute, false},
+		{"Unknown provider", "akamai", "id", "token", "", time.Minute, true},
+		{"Missing id", "fastly", "", "token", "", time.Minute, true},
+		{"Missing token", "cloudfront", "distribution", "", "", time.Minute, true},
+		{"Cloudflare without URL", "cloudflare", "zone", "token", "", time.Minute, true},
+		{"Base URL not a URL", "fastly", "service", "token", "www.example.com", time.Minute, true},
+		{"No interval", "fastly", "service", "token", "", 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setDefaults()
+			Get.CDNPurge = tc.provider
+			Get.CDNPurgeID = tc.id
+			Get.CDNPurgeToken = tc.token
+			Get.CDNPurgeBaseURL = tc.baseURL
+			Get.WatchInterval = tc.interval
+			err := validate()
+			hasError := nil != err
+			if hasError && !tc.isError {
+				t.Errorf("Expected no error but got %v", err)
+			}
+			if !hasError && tc.isError {
+				t.Error("Expected an error but got no error")
+			}
+		})
+	}
+}
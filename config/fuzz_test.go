@@ -0,0 +1,91 @@
+//go:build go1.18
+// +build go1.18
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func FuzzParseTOML(f *testing.F) {
+	seeds := []string{
+		"folder = \"/web\"\nport = 8080\n",
+		"[[overrides]]\nprefix = '/a'\nheaders = [\"X: y\"]\n",
+		"a = { b = \"\"\"multi\nline\"\"\" }\n",
+		"[a.b]\nc = '''x'''\n",
+		"a = \"\\u00e9\\n\"",
+		"[",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		parseTOML(contents)
+	})
+}
+
+func FuzzInterpolate(f *testing.F) {
+	seeds := []string{
+		"folder: ${HOME}",
+		"folder: ${UNSET_VARIABLE:-/web}",
+		"folder: $${HOME}",
+		"folder: ${",
+		"folder: /web",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		replaced, err := interpolate(contents)
+		if nil == err && !strings.Contains(string(contents), "${") &&
+			string(contents) != string(replaced) {
+			t.Errorf("Expected '%s' unchanged but got '%s'", contents, replaced)
+		}
+	})
+}
+
+func FuzzLoadFile(f *testing.F) {
+	seeds := []struct {
+		ext      string
+		contents string
+	}{
+		{".yml", "folder: /web\nport: 8080\n"},
+		{".yml", "overrides:\n  - prefix: /a\n    etag: weak\n"},
+		{".json", `{"folder": "/web", "port": 8080}`},
+		{".toml", "folder = \"/web\"\nport = 8080\n"},
+		{".yml", "port: -1\n"},
+		{".yml", "cache-ttl: 1x\n"},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.ext, []byte(seed.contents))
+	}
+	folder, err := ioutil.TempDir("", "fuzz")
+	if nil != err {
+		f.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	defer setDefaults()
+
+	exts := map[string]bool{".yml": true, ".json": true, ".toml": true}
+	f.Fuzz(func(t *testing.T, ext string, contents []byte) {
+		if !exts[ext] {
+			return
+		}
+		filename := filepath.Join(folder, "config"+ext)
+		if err := ioutil.WriteFile(filename, contents, 0600); nil != err {
+			t.Fatalf("While writing a file got %v", err)
+		}
+		// Parse and validate from the defaults each time, without following
+		// includes out of the folder.
+		reflect.ValueOf(&Get).Elem().Set(reflect.Zero(reflect.TypeOf(Get)))
+		setDefaults()
+		if err := loadFile(filename, maxIncludeDepth); nil == err {
+			validate()
+		}
+	})
+}
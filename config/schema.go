@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// durationType is the type of duration options, written as strings such as
+// '1m30s' or as integers of nanoseconds.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Schema returns a JSON Schema of the configuration file, allowing editors and
+// CI to validate configuration files before they are loaded. Unknown keys are
+// invalid, as they are for Load, and the default value of each option is
+// included.
+func Schema() ([]byte, error) {
+	current := Get
+	setDefaults()
+	defaults := reflect.ValueOf(Get)
+	Get = current
+
+	schema := objectSchema(defaults.Type(), defaults)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "static-file-server configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// objectSchema returns the schema of a struct of options, using the values of
+// the fields as defaults if valid.
+func objectSchema(t reflect.Type, defaults reflect.Value) map[string]interface{} {
+	properties := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if 0 == len(name) || "-" == name {
+			continue
+		}
+		property := typeSchema(field.Type)
+		if defaults.IsValid() {
+			if value, ok := defaultValue(defaults.Field(i)); ok {
+				property["default"] = value
+			}
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema returns the schema of values of the type.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	if durationType == t {
+		return map[string]interface{}{
+			"type":    []string{"string", "integer"},
+			"pattern": `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`,
+		}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Uint16:
+		return map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 65535}
+	case reflect.Int, reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		}
+	case reflect.Struct:
+		return objectSchema(t, reflect.Value{})
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// defaultValue returns the default of the option as written in the
+// configuration file, if it has one.
+func defaultValue(value reflect.Value) (interface{}, bool) {
+	switch {
+	case reflect.Slice == value.Kind() && value.IsNil():
+		return nil, false
+	case durationType == value.Type():
+		return time.Duration(value.Int()).String(), true
+	}
+	return value.Interface(), true
+}
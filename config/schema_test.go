@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	Get.Port = 9090
+	defer setDefaults()
+
+	contents, err := Schema()
+	if nil != err {
+		t.Fatalf("While exporting the schema got %v", err)
+	}
+	if 9090 != Get.Port {
+		t.Errorf("Expected the configuration to be kept but got port %d", Get.Port)
+	}
+
+	var schema struct {
+		AdditionalProperties bool `json:"additionalProperties"`
+		Properties           map[string]struct {
+			Type    interface{} `json:"type"`
+			Default interface{} `json:"default"`
+			Items   struct {
+				Properties map[string]struct {
+					Type interface{} `json:"type"`
+				} `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err = json.Unmarshal(contents, &schema); nil != err {
+		t.Fatalf("While parsing the schema got %v", err)
+	}
+	if schema.AdditionalProperties {
+		t.Error("Expected unknown keys to be refused")
+	}
+
+	testCases := []struct {
+		key          string
+		expectedType string
+		expected     interface{}
+	}{
+		{"port", "integer", float64(defaultPort)},
+		{"show-listing", "boolean", defaultShowListing},
+		{"folder", "string", defaultFolder},
+		{"watch-interval", "[string integer]", defaultWatchInterval.String()},
+		{"headers", "array", nil},
+	}
+	for _, tc := range testCases {
+		property, ok := schema.Properties[tc.key]
+		if !ok {
+			t.Errorf("Expected property '%s'", tc.key)
+			continue
+		}
+		if typeName := fmt.Sprint(property.Type); tc.expectedType != typeName {
+			t.Errorf("For '%s' expected type %s but got %s", tc.key, tc.expectedType, typeName)
+		}
+		if tc.expected != property.Default {
+			t.Errorf("For '%s' expected default %v but got %v", tc.key, tc.expected, property.Default)
+		}
+	}
+	override := schema.Properties["overrides"].Items.Properties
+	if "boolean" != override["show-listing"].Type {
+		t.Errorf("Expected override properties but got %v", override)
+	}
+	plugin := schema.Properties["plugins"].Items.Properties
+	if "object" != plugin["options"].Type {
+		t.Errorf("Expected plugin options to be an object but got %v", plugin)
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	// starterFolders are folders commonly holding a built site, in order of
+	// preference.
+	starterFolders = []string{"public", "dist", "build", "_site", "site", "www", "html"}
+
+	// starterCertificates are common names of certificate and key files.
+	starterCertificates = [][2]string{
+		{"fullchain.pem", "privkey.pem"},
+		{"cert.pem", "key.pem"},
+		{"server.crt", "server.key"},
+		{"tls.crt", "tls.key"},
+	}
+)
+
+// Starter returns a commented starter configuration file for a server run
+// from the directory. The folder is the first common site folder found within
+// the directory, such as 'public' or 'dist', or the directory itself, and TLS
+// is enabled if a certificate and key with common names, such as 'cert.pem'
+// and 'key.pem', are found. The remaining options are commented out with their
+// default values.
+func Starter(dir string) ([]byte, error) {
+	absolute, err := filepath.Abs(dir)
+	if nil != err {
+		return nil, err
+	}
+
+	detected := yaml.MapSlice{{Key: "folder", Value: absolute}}
+	for _, name := range starterFolders {
+		folder := filepath.Join(absolute, name)
+		if info, err := os.Stat(folder); nil == err && info.IsDir() {
+			detected[0].Value = folder
+			break
+		}
+	}
+	for _, pair := range starterCertificates {
+		cert, key := filepath.Join(absolute, pair[0]), filepath.Join(absolute, pair[1])
+		if fileExists(cert) && fileExists(key) {
+			detected = append(detected,
+				yaml.MapSlice{{Key: "tls-cert", Value: cert}, {Key: "tls-key", Value: key}}...,
+			)
+			break
+		}
+	}
+
+	current := Get
+	setDefaults()
+	defaults, err := yaml.Marshal(&Get)
+	Get = current
+	if nil != err {
+		return nil, err
+	}
+	values, err := yaml.Marshal(detected)
+	if nil != err {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "# Starter configuration of static-file-server, generated by 'config init'.")
+	fmt.Fprintln(&out, "# Environment variables override the values of this file. Run 'help' for")
+	fmt.Fprintln(&out, "# a description of each option.")
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "# Detected from the current directory.")
+	out.Write(values)
+	fmt.Fprintln(&out)
+	fmt.Fprintln(&out, "# Default values of the remaining options.")
+	for _, line := range strings.Split(strings.TrimSuffix(string(defaults), "\n"), "\n") {
+		key := strings.SplitN(line, ":", 2)[0]
+		isDetected := false
+		for _, item := range detected {
+			isDetected = isDetected || key == item.Key
+		}
+		if !isDetected {
+			fmt.Fprintf(&out, "# %s\n", line)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// fileExists returns true if the path is a regular file.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return nil == err && info.Mode().IsRegular()
+}
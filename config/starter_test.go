@@ -0,0 +1,60 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStarter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "starter")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setDefaults()
+	for _, key := range []string{
+		folderKey, tlsCertKey, tlsKeyKey, tlsSelfSignedKey, tlsVaultURLKey,
+	} {
+		os.Unsetenv(key)
+	}
+
+	contents, err := Starter(dir)
+	if nil != err {
+		t.Fatalf("Without a site folder got %v", err)
+	}
+	if !strings.Contains(string(contents), "\nfolder: "+dir+"\n") ||
+		strings.Contains(string(contents), "\ntls-cert:") {
+		t.Errorf("Expected the directory to be served over HTTP but got '%s'", contents)
+	}
+
+	os.Mkdir(filepath.Join(dir, "dist"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "cert.pem"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "key.pem"), nil, 0644)
+	if contents, err = Starter(dir); nil != err {
+		t.Fatalf("With a site folder got %v", err)
+	}
+	for _, expected := range []string{
+		"\nfolder: " + filepath.Join(dir, "dist") + "\n",
+		"\ntls-cert: " + filepath.Join(dir, "cert.pem") + "\n",
+		"\ntls-key: " + filepath.Join(dir, "key.pem") + "\n",
+		"\n# port: 8080\n",
+	} {
+		if !strings.Contains(string(contents), expected) {
+			t.Errorf("Expected '%s' in '%s'", expected, contents)
+		}
+	}
+
+	// The starter configuration is a valid configuration file.
+	filename := filepath.Join(dir, "config.yml")
+	ioutil.WriteFile(filename, contents, 0644)
+	setDefaults()
+	if err = Load(filename); nil != err {
+		t.Fatalf("While loading the starter configuration got %v", err)
+	}
+	if filepath.Join(dir, "dist") != Get.Folder || filepath.Join(dir, "cert.pem") != Get.TLSCert {
+		t.Errorf("Expected the detected values but got %s and %s", Get.Folder, Get.TLSCert)
+	}
+}
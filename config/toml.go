@@ -0,0 +1,438 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses TOML configuration files into a tree of tables, arrays and
+// values. Tables, arrays of tables, dotted keys, inline tables, arrays,
+// strings, integers, floats and booleans are supported. Dates and times are
+// not, as no option uses them; durations are written as strings such as '1m'.
+func parseTOML(contents []byte) (map[string]interface{}, error) {
+	p := &tomlParser{input: string(contents), line: 1}
+	root := make(map[string]interface{})
+	table := root
+	for {
+		p.skipBlank()
+		if p.done() {
+			return root, nil
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(p.rest(), "[["):
+			p.pos += 2
+			table, err = p.tableHeader(root, "]]", true)
+		case '[' == p.peek():
+			p.pos++
+			table, err = p.tableHeader(root, "]", false)
+		default:
+			err = p.keyValue(table)
+		}
+		if nil == err {
+			err = p.endOfLine()
+		}
+		if nil != err {
+			return nil, fmt.Errorf("TOML line %d: %v", p.line, err)
+		}
+	}
+}
+
+// tomlParser holds the position within the input.
+type tomlParser struct {
+	input string
+	pos   int
+	line  int
+}
+
+func (p *tomlParser) done() bool {
+	return len(p.input) <= p.pos
+}
+
+func (p *tomlParser) rest() string {
+	return p.input[p.pos:]
+}
+
+func (p *tomlParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for c := p.peek(); ' ' == c || '\t' == c; c = p.peek() {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments.
+func (p *tomlParser) skipBlank() {
+	for !p.done() {
+		switch c := p.peek(); {
+		case ' ' == c || '\t' == c || '\r' == c:
+			p.pos++
+		case '\n' == c:
+			p.pos++
+			p.line++
+		case '#' == c:
+			for !p.done() && '\n' != p.peek() {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine expects only a comment before the end of the line.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if '#' == p.peek() {
+		for !p.done() && '\n' != p.peek() {
+			p.pos++
+		}
+	}
+	if '\r' == p.peek() {
+		p.pos++
+	}
+	if !p.done() && '\n' != p.peek() {
+		return fmt.Errorf("unexpected '%s' after value", p.token())
+	}
+	return nil
+}
+
+// token returns the remainder of the line for error messages.
+func (p *tomlParser) token() string {
+	rest := p.rest()
+	if end := strings.IndexAny(rest, "\r\n"); 0 <= end {
+		rest = rest[:end]
+	}
+	return rest
+}
+
+// tableHeader parses the key of a table or array of tables, up to the
+// closing brackets, and returns the table that following keys belong to.
+func (p *tomlParser) tableHeader(
+	root map[string]interface{}, closing string, array bool,
+) (map[string]interface{}, error) {
+	keys, err := p.key()
+	if nil != err {
+		return nil, err
+	}
+	p.skipSpace()
+	if !strings.HasPrefix(p.rest(), closing) {
+		return nil, fmt.Errorf("expected '%s' but got '%s'", closing, p.token())
+	}
+	p.pos += len(closing)
+
+	parent, err := p.descend(root, keys[:len(keys)-1])
+	if nil != err {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	table := make(map[string]interface{})
+	switch existing := parent[last].(type) {
+	case nil:
+		if array {
+			parent[last] = []interface{}{table}
+		} else {
+			parent[last] = table
+		}
+	case []interface{}:
+		if !array {
+			return nil, fmt.Errorf("'%s' is already an array", strings.Join(keys, "."))
+		}
+		parent[last] = append(existing, table)
+	default:
+		return nil, fmt.Errorf("'%s' is already defined", strings.Join(keys, "."))
+	}
+	return table, nil
+}
+
+// descend returns the table at the keys within the table, creating missing
+// tables and using the last table of arrays of tables.
+func (p *tomlParser) descend(
+	table map[string]interface{}, keys []string,
+) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch existing := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = existing
+		case []interface{}:
+			child, ok := existing[len(existing)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("'%s' is not a table", key)
+			}
+			table = child
+		default:
+			return nil, fmt.Errorf("'%s' is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// keyValue parses 'key = value' into the table.
+func (p *tomlParser) keyValue(table map[string]interface{}) error {
+	keys, err := p.key()
+	if nil != err {
+		return err
+	}
+	p.skipSpace()
+	if '=' != p.peek() {
+		return fmt.Errorf("expected '=' after key but got '%s'", p.token())
+	}
+	p.pos++
+	p.skipSpace()
+	value, err := p.value()
+	if nil != err {
+		return err
+	}
+	if table, err = p.descend(table, keys[:len(keys)-1]); nil != err {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return fmt.Errorf("'%s' is already defined", strings.Join(keys, "."))
+	}
+	table[last] = value
+	return nil
+}
+
+// key parses a bare, quoted or dotted key.
+func (p *tomlParser) key() (keys []string, err error) {
+	for {
+		p.skipSpace()
+		var key string
+		switch c := p.peek(); {
+		case '"' == c:
+			key, err = p.basicString()
+		case '\'' == c:
+			key, err = p.literalString()
+		default:
+			start := p.pos
+			for c = p.peek(); isBareKey(c); c = p.peek() {
+				p.pos++
+			}
+			if key = p.input[start:p.pos]; 0 == len(key) {
+				err = fmt.Errorf("expected a key but got '%s'", p.token())
+			}
+		}
+		if nil != err {
+			return nil, err
+		}
+		keys = append(keys, key)
+		p.skipSpace()
+		if '.' != p.peek() {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKey(c byte) bool {
+	return ('a' <= c && 'z' >= c) || ('A' <= c && 'Z' >= c) ||
+		('0' <= c && '9' >= c) || '_' == c || '-' == c
+}
+
+// value parses a string, number, boolean, array or inline table.
+func (p *tomlParser) value() (interface{}, error) {
+	rest := p.rest()
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.multiLineString(`"""`, true)
+	case strings.HasPrefix(rest, "'''"):
+		return p.multiLineString("'''", false)
+	case strings.HasPrefix(rest, `"`):
+		return p.basicString()
+	case strings.HasPrefix(rest, "'"):
+		return p.literalString()
+	case strings.HasPrefix(rest, "["):
+		return p.array()
+	case strings.HasPrefix(rest, "{"):
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for c := p.peek(); isBareKey(c) || '+' == c || '.' == c || ':' == c; c = p.peek() {
+		p.pos++
+	}
+	literal := p.input[start:p.pos]
+	switch literal {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, fmt.Errorf("expected a value but got '%s'", p.token())
+	}
+	number := strings.ReplaceAll(literal, "_", "")
+	if integer, err := strconv.ParseInt(number, 0, 64); nil == err {
+		return integer, nil
+	}
+	if float, err := strconv.ParseFloat(number, 64); nil == err {
+		return float, nil
+	}
+	return nil, fmt.Errorf("unsupported value '%s'", literal)
+}
+
+// array parses values within brackets, which may span lines.
+func (p *tomlParser) array() ([]interface{}, error) {
+	p.pos++
+	values := []interface{}{}
+	for {
+		p.skipBlank()
+		if ']' == p.peek() {
+			p.pos++
+			return values, nil
+		}
+		value, err := p.value()
+		if nil != err {
+			return nil, err
+		}
+		values = append(values, value)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in array but got '%s'", p.token())
+		}
+	}
+}
+
+// inlineTable parses key/value pairs within braces.
+func (p *tomlParser) inlineTable() (map[string]interface{}, error) {
+	p.pos++
+	table := make(map[string]interface{})
+	p.skipSpace()
+	if '}' == p.peek() {
+		p.pos++
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); nil != err {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in inline table but got '%s'", p.token())
+		}
+	}
+}
+
+// literalString parses a single quoted string without escapes.
+func (p *tomlParser) literalString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.rest(), "'\n")
+	if 0 > end || '\'' != p.input[p.pos+end] {
+		return "", fmt.Errorf("unterminated string")
+	}
+	value := p.input[p.pos : p.pos+end]
+	p.pos += end + 1
+	return value, nil
+}
+
+// basicString parses a double quoted string with escapes.
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var value strings.Builder
+	for {
+		if p.done() || '\n' == p.peek() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		switch c {
+		case '"':
+			return value.String(), nil
+		case '\\':
+			if err := p.escape(&value); nil != err {
+				return "", err
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+}
+
+// multiLineString parses a string within triple quotes. A newline directly
+// after the opening quotes is removed. Basic strings process escapes, where
+// a backslash at the end of a line removes the following whitespace.
+func (p *tomlParser) multiLineString(quotes string, basic bool) (string, error) {
+	p.pos += len(quotes)
+	if strings.HasPrefix(p.rest(), "\r\n") {
+		p.pos += 2
+		p.line++
+	} else if '\n' == p.peek() {
+		p.pos++
+		p.line++
+	}
+	var value strings.Builder
+	for {
+		if p.done() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.rest(), quotes) {
+			p.pos += len(quotes)
+			return value.String(), nil
+		}
+		c := p.peek()
+		p.pos++
+		switch {
+		case '\n' == c:
+			p.line++
+			value.WriteByte(c)
+		case basic && '\\' == c:
+			if trimmed := strings.TrimLeft(p.rest(), " \t\r"); strings.HasPrefix(trimmed, "\n") {
+				p.pos = len(p.input) - len(trimmed)
+				p.skipBlank()
+				continue
+			}
+			if err := p.escape(&value); nil != err {
+				return "", err
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+}
+
+// escape writes the character of the escape sequence following a backslash.
+func (p *tomlParser) escape(value *strings.Builder) error {
+	escapes := map[byte]string{
+		'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", '"': `"`, '\\': `\`,
+	}
+	c := p.peek()
+	p.pos++
+	if replacement, ok := escapes[c]; ok {
+		value.WriteString(replacement)
+		return nil
+	}
+	size := map[byte]int{'u': 4, 'U': 8}[c]
+	if 0 == size || len(p.input) < p.pos+size {
+		return fmt.Errorf("invalid escape '\\%c'", c)
+	}
+	code, err := strconv.ParseUint(p.input[p.pos:p.pos+size], 16, 32)
+	if nil != err || !utf8.ValidRune(rune(code)) {
+		return fmt.Errorf("invalid escape '\\%c%s'", c, p.input[p.pos:p.pos+size])
+	}
+	p.pos += size
+	value.WriteRune(rune(code))
+	return nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		contents string
+		expected map[string]interface{}
+		isError  bool
+	}{
+		{"Empty", "# Nothing\n\n", map[string]interface{}{}, false},
+		{"Values", `
+folder = "/web"   # comment
+port = 8_080
+debug = true
+ratio = 1.5
+literal = 'C:\path'
+"quoted key" = "tab\there \u00e9"
+`, map[string]interface{}{
+			"folder": "/web", "port": int64(8080), "debug": true, "ratio": 1.5,
+			"literal": `C:\path`, "quoted key": "tab\there \u00e9",
+		}, false},
+		{"Arrays", `
+headers = [
+  "X-Frame-Options: DENY", # first
+  "X-Robots-Tag: none",
+]
+empty = []
+`, map[string]interface{}{
+			"headers": []interface{}{"X-Frame-Options: DENY", "X-Robots-Tag: none"},
+			"empty":   []interface{}{},
+		}, false},
+		{"Multi-line strings", `
+robots = """
+User-agent: *
+Disallow: /\
+    private
+"""
+raw = '''
+C:\path'''
+`, map[string]interface{}{
+			"robots": "User-agent: *\nDisallow: /private\n",
+			"raw":    `C:\path`,
+		}, false},
+		{"Tables", `
+port = 8080
+
+[[overrides]]
+prefix = "/assets"
+etag = "strong"
+
+[[overrides]]
+prefix = "/docs"
+show-listing = true
+
+[site]
+name.first = "a"
+inline = { x = 1, y = "z" }
+`, map[string]interface{}{
+			"port": int64(8080),
+			"overrides": []interface{}{
+				map[string]interface{}{"prefix": "/assets", "etag": "strong"},
+				map[string]interface{}{"prefix": "/docs", "show-listing": true},
+			},
+			"site": map[string]interface{}{
+				"name":   map[string]interface{}{"first": "a"},
+				"inline": map[string]interface{}{"x": int64(1), "y": "z"},
+			},
+		}, false},
+		{"Duplicate key", "port = 1\nport = 2\n", nil, true},
+		{"Duplicate table", "[a]\n[a]\n", nil, true},
+		{"Missing equals", "port 8080\n", nil, true},
+		{"Unterminated string", "folder = \"/web\n", nil, true},
+		{"Trailing content", "port = 8080 8081\n", nil, true},
+		{"Date", "expires = 2027-01-01T00:00:00Z\n", nil, true},
+		{"Bad escape", `folder = "\q"`, nil, true},
+		{"Unclosed array", "headers = [\"a\"\n", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := parseTOML([]byte(tc.contents))
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if !tc.isError && !reflect.DeepEqual(tc.expected, result) {
+				t.Errorf("Expected %v but got %v", tc.expected, result)
+			}
+		})
+	}
+}
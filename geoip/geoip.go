@@ -0,0 +1,184 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// Filenames used by the MaxMind GeoLite2 Country CSV distribution.
+	locationsFile = "GeoLite2-Country-Locations-en.csv"
+	ipv4BlockFile = "GeoLite2-Country-Blocks-IPv4.csv"
+	ipv6BlockFile = "GeoLite2-Country-Blocks-IPv6.csv"
+)
+
+// block is a contiguous range of addresses assigned to a single country.
+type block struct {
+	first   net.IP
+	last    net.IP
+	country string
+}
+
+// Database of address ranges used to resolve country codes.
+type Database struct {
+	blocks []block
+}
+
+// Load the GeoLite2 Country CSV files from the passed folder. The locations
+// file must exist along with at least one of the IPv4 or IPv6 block files.
+func Load(folder string) (db *Database, err error) {
+	var countries map[string]string
+	if countries, err = loadLocations(
+		filepath.Join(folder, locationsFile),
+	); nil != err {
+		return
+	}
+
+	db = &Database{}
+	found := 0
+	for _, name := range []string{ipv4BlockFile, ipv6BlockFile} {
+		filename := filepath.Join(folder, name)
+		if _, statErr := os.Stat(filename); os.IsNotExist(statErr) {
+			continue
+		}
+		if err = db.loadBlocks(filename, countries); nil != err {
+			return nil, err
+		}
+		found++
+	}
+	if 0 == found {
+		return nil, fmt.Errorf(
+			"no GeoIP block files (%s, %s) found in '%s'",
+			ipv4BlockFile, ipv6BlockFile, folder,
+		)
+	}
+
+	sort.Slice(db.blocks, func(i, j int) bool {
+		return 0 > bytes.Compare(db.blocks[i].first, db.blocks[j].first)
+	})
+	return
+}
+
+// Country returns the ISO 3166-1 alpha-2 country code for the passed IP
+// address or an empty string if the address is unknown.
+func (db *Database) Country(ip net.IP) string {
+	if nil == db || nil == ip {
+		return ""
+	}
+	ip = ip.To16()
+
+	// Find the first block starting beyond the address, then step back to the
+	// block that may contain it.
+	index := sort.Search(len(db.blocks), func(i int) bool {
+		return 0 < bytes.Compare(db.blocks[i].first, ip)
+	}) - 1
+	if 0 > index {
+		return ""
+	}
+	if candidate := db.blocks[index]; 0 >= bytes.Compare(ip, candidate.last) {
+		return candidate.country
+	}
+	return ""
+}
+
+// loadLocations maps each geoname ID to a country code.
+func loadLocations(filename string) (countries map[string]string, err error) {
+	countries = make(map[string]string)
+	err = readCSV(filename, []string{"geoname_id", "country_iso_code"},
+		func(fields []string) error {
+			if 0 < len(fields[1]) {
+				countries[fields[0]] = strings.ToUpper(fields[1])
+			}
+			return nil
+		},
+	)
+	return
+}
+
+// loadBlocks appends each network in the file to the database.
+func (db *Database) loadBlocks(
+	filename string, countries map[string]string,
+) error {
+	columns := []string{"network", "geoname_id", "registered_country_geoname_id"}
+	return readCSV(filename, columns, func(fields []string) error {
+		_, network, err := net.ParseCIDR(fields[0])
+		if nil != err {
+			return err
+		}
+
+		// Fall back to the registered country when no physical location is
+		// known for the network.
+		country, ok := countries[fields[1]]
+		if !ok {
+			if country, ok = countries[fields[2]]; !ok {
+				return nil
+			}
+		}
+
+		first := network.IP.To16()
+		last := make(net.IP, len(first))
+		mask := network.Mask
+		if net.IPv4len == len(mask) {
+			mask = append(net.CIDRMask(96, 128)[:12], mask...)
+		}
+		for i := range first {
+			last[i] = first[i] | ^mask[i]
+		}
+		db.blocks = append(db.blocks, block{first, last, country})
+		return nil
+	})
+}
+
+// readCSV calls the handler with the requested columns for each row of the
+// file, in the order the columns were requested.
+func readCSV(
+	filename string, columns []string, handler func([]string) error,
+) (err error) {
+	var file *os.File
+	if file, err = os.Open(filename); nil != err {
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	var header []string
+	if header, err = reader.Read(); nil != err {
+		return fmt.Errorf("while reading header of '%s' got %v", filename, err)
+	}
+	positions := make([]int, len(columns))
+	for i, column := range columns {
+		positions[i] = -1
+		for j, name := range header {
+			if column == name {
+				positions[i] = j
+			}
+		}
+		if 0 > positions[i] {
+			return fmt.Errorf("column '%s' missing from '%s'", column, filename)
+		}
+	}
+
+	fields := make([]string, len(columns))
+	for {
+		record, readErr := reader.Read()
+		if io.EOF == readErr {
+			return nil
+		}
+		if nil != readErr {
+			return readErr
+		}
+		for i, position := range positions {
+			fields[i] = record[position]
+		}
+		if err = handler(fields); nil != err {
+			return fmt.Errorf("while reading '%s' got %v", filename, err)
+		}
+	}
+}
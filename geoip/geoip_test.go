@@ -0,0 +1,131 @@
+package geoip
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testLocations = `geoname_id,locale_code,continent_code,continent_name,country_iso_code,country_name,is_in_european_union
+2921044,en,EU,Europe,DE,Germany,1
+6252001,en,NA,"North America",US,"United States",0
+6255148,en,EU,Europe,,,0
+`
+	testIPv4Blocks = `network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider
+1.0.0.0/24,6252001,6252001,,0,0
+2.0.0.0/16,,2921044,,0,0
+3.0.0.0/8,6255148,6255148,,0,0
+`
+	testIPv6Blocks = `network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider
+2001:db8::/32,2921044,2921044,,0,0
+`
+)
+
+func writeFixture(t *testing.T, files map[string]string) string {
+	folder, err := ioutil.TempDir("", "geoip")
+	if nil != err {
+		t.Fatalf("While creating temporary folder got %v", err)
+	}
+	for name, contents := range files {
+		filename := filepath.Join(folder, name)
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing %s got %v", filename, err)
+		}
+	}
+	return folder
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name    string
+		files   map[string]string
+		isError bool
+	}{
+		{"All files", map[string]string{
+			locationsFile: testLocations,
+			ipv4BlockFile: testIPv4Blocks,
+			ipv6BlockFile: testIPv6Blocks,
+		}, false},
+		{"IPv4 only", map[string]string{
+			locationsFile: testLocations,
+			ipv4BlockFile: testIPv4Blocks,
+		}, false},
+		{"Missing locations", map[string]string{
+			ipv4BlockFile: testIPv4Blocks,
+		}, true},
+		{"Missing blocks", map[string]string{
+			locationsFile: testLocations,
+		}, true},
+		{"Missing column", map[string]string{
+			locationsFile: "geoname_id\n1\n",
+			ipv4BlockFile: testIPv4Blocks,
+		}, true},
+		{"Bad network", map[string]string{
+			locationsFile: testLocations,
+			ipv4BlockFile: "network,geoname_id,registered_country_geoname_id\nbad,1,1\n",
+		}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			folder := writeFixture(t, tc.files)
+			defer os.RemoveAll(folder)
+
+			_, err := Load(folder)
+			if tc.isError && nil == err {
+				t.Error("Expected an error but got no error")
+			}
+			if !tc.isError && nil != err {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestCountry(t *testing.T) {
+	folder := writeFixture(t, map[string]string{
+		locationsFile: testLocations,
+		ipv4BlockFile: testIPv4Blocks,
+		ipv6BlockFile: testIPv6Blocks,
+	})
+	defer os.RemoveAll(folder)
+
+	db, err := Load(folder)
+	if nil != err {
+		t.Fatalf("While loading database got %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		ip      string
+		country string
+	}{
+		{"Start of block", "1.0.0.0", "US"},
+		{"End of block", "1.0.0.255", "US"},
+		{"Past end of block", "1.0.1.0", ""},
+		{"Registered country fallback", "2.0.200.1", "DE"},
+		{"Location without country", "3.1.2.3", ""},
+		{"Before first block", "0.1.2.3", ""},
+		{"IPv6", "2001:db8::1", "DE"},
+		{"Unknown IPv6", "2001:db9::1", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := db.Country(net.ParseIP(tc.ip)); tc.country != result {
+				t.Errorf(
+					"For %s expected country '%s' but got '%s'",
+					tc.ip, tc.country, result,
+				)
+			}
+		})
+	}
+
+	var empty *Database
+	if result := empty.Country(net.ParseIP("1.0.0.1")); "" != result {
+		t.Errorf("For nil database expected no country but got '%s'", result)
+	}
+}
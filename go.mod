@@ -1,7 +1,14 @@
 module github.com/halverneus/static-file-server
 
+go 1.18
+
+require (
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v2 v2.2.2
+)
+
 require (
 	github.com/kr/pretty v0.1.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
-	gopkg.in/yaml.v2 v2.2.2
 )
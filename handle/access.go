@@ -0,0 +1,45 @@
+package handle
+
+import (
+	"context"
+	"net/http"
+)
+
+// accessChecksKey is the request context key holding the access checks the
+// request passed.
+type accessChecksKey struct{}
+
+// accessCheck returns the request as it would continue past a check, or false
+// if the check would refuse it. Checks do not log, audit or respond.
+type accessCheck func(r *http.Request) (*http.Request, bool)
+
+// withAccessCheck returns a copy of the request with the check added to the
+// checks it passed, in order.
+func withAccessCheck(r *http.Request, check accessCheck) *http.Request {
+	checks, _ := r.Context().Value(accessChecksKey{}).([]accessCheck)
+	checks = append(checks[:len(checks):len(checks)], check)
+	return r.WithContext(context.WithValue(r.Context(), accessChecksKey{}, checks))
+}
+
+// Allowed returns true if a GET request for the URL path, made with the same
+// credentials and from the same client as the request, would pass the auth
+// realms and policy rules the request passed through. Endpoints listing files,
+// such as WithSearch, use it to leave out files the client could not read.
+func Allowed(r *http.Request, urlPath string) bool {
+	checks, _ := r.Context().Value(accessChecksKey{}).([]accessCheck)
+	if 0 == len(checks) {
+		return true
+	}
+	target := *r.URL
+	target.Path, target.RawPath = urlPath, ""
+	clone := r.WithContext(r.Context())
+	clone.Method, clone.URL = http.MethodGet, &target
+
+	var ok bool
+	for _, check := range checks {
+		if clone, ok = check(clone); !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	realms := []AuthRealm{
+		{Prefix: "/users", Scheme: AuthBasic, Credentials: map[string]string{"alice": "plain"}},
+		{Prefix: "/ci", Scheme: AuthKey, Credentials: map[string]string{"ci": "key-one"}},
+	}
+	rules, err := ParsePolicyRules([]string{
+		"deny * /users/secret/**",
+		"require-auth * /internal/**",
+	})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+
+	var allowed map[string]bool
+	paths := []string{"/file.txt", "/users/a", "/users/secret/a", "/ci/a", "/internal/a"}
+	handler := WithAuth(WithPolicy(func(w http.ResponseWriter, r *http.Request) {
+		allowed = make(map[string]bool)
+		for _, urlPath := range paths {
+			allowed[urlPath] = Allowed(r, urlPath)
+		}
+	}, rules), realms)
+
+	testCases := []struct {
+		name     string
+		path     string
+		setup    func(*http.Request)
+		expected []string
+	}{
+		{"Anonymous", "/", nil, []string{"/file.txt"}},
+		{"Basic", "/users/", func(r *http.Request) {
+			r.SetBasicAuth("alice", "plain")
+		}, []string{"/file.txt", "/users/a"}},
+		// The subject of one realm is not carried to paths outside of it.
+		{"Key", "/ci/", func(r *http.Request) {
+			r.Header.Set("X-Access-Key", "key-one")
+		}, []string{"/file.txt", "/ci/a"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			if nil != tc.setup {
+				tc.setup(req)
+			}
+			handler(httptest.NewRecorder(), req)
+			expected := make(map[string]bool)
+			for _, urlPath := range tc.expected {
+				expected[urlPath] = true
+			}
+			for _, urlPath := range paths {
+				if expected[urlPath] != allowed[urlPath] {
+					t.Errorf("For %s expected %t but got %t", urlPath, expected[urlPath], allowed[urlPath])
+				}
+			}
+		})
+	}
+
+	// Requests that passed no checks are allowed everything.
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	if !Allowed(req, "/users/secret/a") {
+		t.Error("Without checks expected allowed but got refused")
+	}
+}
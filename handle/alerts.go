@@ -0,0 +1,149 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertRule raises an alert while the responses of a status class are more
+// than a share of all responses.
+type AlertRule struct {
+	// Class of the status codes, such as 5 for '5xx'.
+	Class int
+	// Percent of all responses that the class must exceed.
+	Percent float64
+}
+
+// ParseAlertRule returns the rule in the form 'class>percent', such as
+// '5xx>5' for more than 5% server errors.
+func ParseAlertRule(rule string) (AlertRule, error) {
+	parts := strings.SplitN(rule, ">", 2)
+	invalid := fmt.Errorf("invalid alert rule '%s': expected a form such as '5xx>5'", rule)
+	if 2 != len(parts) || 3 != len(parts[0]) || !strings.HasSuffix(parts[0], "xx") ||
+		'1' > parts[0][0] || '5' < parts[0][0] {
+		return AlertRule{}, invalid
+	}
+	percent, err := strconv.ParseFloat(parts[1], 64)
+	if nil != err || 0 > percent || 100 <= percent {
+		return AlertRule{}, invalid
+	}
+	return AlertRule{Class: int(parts[0][0] - '0'), Percent: percent}, nil
+}
+
+// String returns the rule in the form parsed by ParseAlertRule.
+func (rule AlertRule) String() string {
+	return fmt.Sprintf("%dxx>%g", rule.Class, rule.Percent)
+}
+
+// Alerts counts responses by status class within fixed windows, giving basic
+// alerting without a monitoring stack. At the end of each window with enough
+// responses, an alert is raised for each rule exceeded and resolved for each
+// raised rule that is not. Raised alerts are logged as errors and resolved
+// ones as information, annotated with 'alert=<class>', and both are notified
+// as NotifyAlerts if a notifier is set. Safe for concurrent use.
+type Alerts struct {
+	rules       []AlertRule
+	window      time.Duration
+	minRequests int
+	notifier    *Notifier
+
+	mutex  sync.Mutex
+	counts [6]int
+	total  int
+	raised []bool
+}
+
+// NewAlerts returns alerts for the rules, evaluated over responses within the
+// window once at least minRequests were served. The notifier may be nil.
+func NewAlerts(
+	rules []AlertRule, window time.Duration, minRequests int, notifier *Notifier,
+) *Alerts {
+	return &Alerts{
+		rules:       rules,
+		window:      window,
+		minRequests: minRequests,
+		notifier:    notifier,
+		raised:      make([]bool, len(rules)),
+	}
+}
+
+// Run evaluates the rules at the end of every window until the context is
+// done.
+func (alerts *Alerts) Run(ctx context.Context) {
+	ticker := time.NewTicker(alerts.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			alerts.evaluate(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// evaluate the rules against the responses of the window ending at the time,
+// then start the next window. Windows with too few responses change nothing.
+func (alerts *Alerts) evaluate(now time.Time) {
+	alerts.mutex.Lock()
+	defer alerts.mutex.Unlock()
+	counts, total := alerts.counts, alerts.total
+	alerts.counts, alerts.total = [6]int{}, 0
+	if 0 == total || alerts.minRequests > total {
+		return
+	}
+
+	for index, rule := range alerts.rules {
+		count := counts[rule.Class]
+		percent := 100 * float64(count) / float64(total)
+		exceeded := percent > rule.Percent
+		if exceeded == alerts.raised[index] {
+			continue
+		}
+		alerts.raised[index] = exceeded
+
+		state, level := "resolved", ""
+		if exceeded {
+			state, level = "raised", "Error: "
+		}
+		message := fmt.Sprintf(
+			"Alert %s %s: %dxx responses were %.1f%% of %d within %v",
+			rule, state, rule.Class, percent, total, alerts.window,
+		)
+		log.Printf("%s%s alert=%dxx\n", level, message, rule.Class)
+		if nil != alerts.notifier {
+			alerts.notifier.Notify(Notification{
+				Time:    now.UTC(),
+				Event:   NotifyAlerts,
+				Count:   count,
+				Message: message,
+			})
+		}
+	}
+}
+
+// observe the status code of a response.
+func (alerts *Alerts) observe(code int) {
+	alerts.mutex.Lock()
+	if class := code / 100; 1 <= class && class < len(alerts.counts) {
+		alerts.counts[class]++
+	}
+	alerts.total++
+	alerts.mutex.Unlock()
+}
+
+// WithAlerts wraps an HTTP request, counting its response for the alerts.
+func WithAlerts(serve http.HandlerFunc, alerts *Alerts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := newStatusWriter(w)
+		serve(recorder, r)
+		alerts.observe(recorder.Status())
+		recorder.release()
+	}
+}
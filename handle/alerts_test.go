@@ -0,0 +1,97 @@
+package handle
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAlertRule(t *testing.T) {
+	testCases := []struct {
+		rule     string
+		expected AlertRule
+		isError  bool
+	}{
+		{"5xx>5", AlertRule{Class: 5, Percent: 5}, false},
+		{"4xx>12.5", AlertRule{Class: 4, Percent: 12.5}, false},
+		{"5xx>0", AlertRule{Class: 5}, false},
+		{"6xx>5", AlertRule{}, true},
+		{"5xx", AlertRule{}, true},
+		{"5xx>100", AlertRule{}, true},
+		{"500>5", AlertRule{}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.rule, func(t *testing.T) {
+			rule, err := ParseAlertRule(tc.rule)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if tc.expected != rule {
+				t.Errorf("Expected %+v but got %+v", tc.expected, rule)
+			}
+			if !tc.isError && tc.rule != rule.String() {
+				t.Errorf("Expected '%s' but got '%s'", tc.rule, rule)
+			}
+		})
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	notifier := NewNotifier("", NotifyRules{Events: []string{NotifyAlerts}})
+	alerts := NewAlerts([]AlertRule{{5, 10}, {4, 50}}, time.Minute, 10, notifier)
+	status := http.StatusOK
+	handler := WithAlerts(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}, alerts)
+	serve := func(code, count int) {
+		status = code
+		for i := 0; i < count; i++ {
+			handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+	}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Too few responses change nothing.
+	serve(http.StatusInternalServerError, 5)
+	alerts.evaluate(now)
+	if 0 != logged.Len() {
+		t.Errorf("Expected nothing logged but got '%s'", logged.String())
+	}
+
+	// Exceeding the share raises the alert once.
+	serve(ok, 16)
+	serve(http.StatusServiceUnavailable, 4)
+	alerts.evaluate(now)
+	serve(ok, 8)
+	serve(http.StatusBadGateway, 2)
+	alerts.evaluate(now)
+	expected := "Error: Alert 5xx>10 raised: 5xx responses were 20.0% of 20 within 1m0s alert=5xx"
+	if lines := strings.Split(strings.TrimSpace(logged.String()), "\n"); 1 != len(lines) ||
+		!strings.HasSuffix(lines[0], expected) {
+		t.Errorf("Expected only '%s' logged but got '%s'", expected, logged.String())
+	}
+	logged.Reset()
+
+	// Falling below the share resolves the alert.
+	serve(ok, 19)
+	serve(http.StatusNotFound, 1)
+	alerts.evaluate(now)
+	expected = "Alert 5xx>10 resolved: 5xx responses were 0.0% of 20 within 1m0s alert=5xx"
+	if !strings.HasSuffix(strings.TrimSpace(logged.String()), expected) {
+		t.Errorf("Expected '%s' logged but got '%s'", expected, logged.String())
+	}
+
+	if 2 != len(notifier.pending) || NotifyAlerts != notifier.pending[0].Event ||
+		4 != notifier.pending[0].Count {
+		t.Errorf("Expected the raised and resolved alerts notified but got %v", notifier.pending)
+	}
+}
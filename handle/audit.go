@@ -0,0 +1,93 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Audit events recorded by WithAudit.
+const (
+	// AuditAuthSuccess is recorded when a client authenticates with a realm.
+	AuditAuthSuccess = "auth-success"
+	// AuditAuthFailure is recorded when a client fails to authenticate with a
+	// realm.
+	AuditAuthFailure = "auth-failure"
+	// AuditPolicyDeny is recorded when a policy rule refuses a request.
+	AuditPolicyDeny = "policy-deny"
+	// AuditScriptDeny is recorded when a script statement refuses a request.
+	AuditScriptDeny = "script-deny"
+	// AuditUserAgentDeny is recorded when a User-Agent rule refuses a request.
+	AuditUserAgentDeny = "user-agent-deny"
+	// AuditGeoIPDeny is recorded when the client country refuses a request.
+	AuditGeoIPDeny = "geoip-deny"
+	// AuditLockoutBan is recorded when a client is banned after repeated
+	// authentication failures.
+	AuditLockoutBan = "lockout-ban"
+	// AuditLockoutDeny is recorded when a request from a banned client is
+	// refused.
+	AuditLockoutDeny = "lockout-deny"
+)
+
+// AuditEvent describing an authentication or authorization decision.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Subject string    `json:"subject,omitempty"`
+	IP      string    `json:"ip"`
+	Country string    `json:"country,omitempty"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Realm   string    `json:"realm,omitempty"`
+	Rule    string    `json:"rule,omitempty"`
+}
+
+// AuditFunc receives each audit event.
+type AuditFunc func(AuditEvent)
+
+// auditKey is the request context key holding the AuditFunc.
+type auditKey struct{}
+
+// WithAudit wraps an HTTP request. Authentication successes and failures and
+// denials by WithAuth, WithLockout, WithPolicy, WithScript, WithUserAgent and
+// WithGeoIP further down the pipeline are passed to record.
+func WithAudit(serve http.HandlerFunc, record AuditFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r.WithContext(context.WithValue(r.Context(), auditKey{}, record)))
+	}
+}
+
+// AuditJSON returns an AuditFunc writing each event as a line of JSON, suitable
+// for shipping to a SIEM. Safe for concurrent use.
+func AuditJSON(w io.Writer) AuditFunc {
+	var mutex sync.Mutex
+	encoder := json.NewEncoder(w)
+	return func(event AuditEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		encoder.Encode(event)
+	}
+}
+
+// audit records the event for the request if WithAudit is in use, completing
+// the fields describing the request.
+func audit(r *http.Request, event AuditEvent) {
+	record, _ := r.Context().Value(auditKey{}).(AuditFunc)
+	if nil == record {
+		return
+	}
+	event.Time = time.Now().UTC()
+	if ip := clientIP(r); nil != ip {
+		event.IP = ip.String()
+	}
+	if 0 == len(event.Subject) {
+		event.Subject = Subject(r)
+	}
+	event.Country = Country(r)
+	event.Method = r.Method
+	event.Path = r.URL.Path
+	record(event)
+}
@@ -0,0 +1,79 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestWithAudit(t *testing.T) {
+	users := writeCredentials(t, "users.txt", testUsers)
+	defer os.Remove(users)
+
+	realms, err := ParseAuthRealms([]string{"/sub=basic:" + users})
+	if nil != err {
+		t.Fatalf("While parsing realms got %v", err)
+	}
+	rules, err := ParsePolicyRules([]string{"deny * /sub/secret.txt"})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	var out bytes.Buffer
+	serve := func(http.ResponseWriter, *http.Request) {}
+	handler := WithAudit(WithAuth(WithPolicy(serve, rules), realms), AuditJSON(&out))
+
+	testCases := []struct {
+		name  string
+		path  string
+		user  string
+		event AuditEvent
+	}{
+		{"Anonymous", "/file.txt", "", AuditEvent{}},
+		{"Success", "/sub/file.txt", "alice", AuditEvent{
+			Event: AuditAuthSuccess, Subject: "alice", IP: "192.0.2.1",
+			Method: "GET", Path: "/sub/file.txt", Realm: "/sub",
+		}},
+		{"Failure", "/sub/file.txt", "carol", AuditEvent{
+			Event: AuditAuthFailure, IP: "192.0.2.1",
+			Method: "GET", Path: "/sub/file.txt", Realm: "/sub",
+		}},
+		{"Policy", "/sub/secret.txt", "alice", AuditEvent{
+			Event: AuditPolicyDeny, Subject: "alice", IP: "192.0.2.1",
+			Method: "GET", Path: "/sub/secret.txt", Rule: "deny * /sub/secret.txt",
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			if 0 < len(tc.user) {
+				req.SetBasicAuth(tc.user, "plain")
+			}
+			handler(httptest.NewRecorder(), req)
+
+			if 0 == len(tc.event.Event) {
+				if 0 < out.Len() {
+					t.Errorf("Expected no audit event but got %s", out.String())
+				}
+				return
+			}
+			// The deciding event is the last line.
+			lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+			var event AuditEvent
+			if err := json.Unmarshal(lines[len(lines)-1], &event); nil != err {
+				t.Fatalf("While decoding '%s' got %v", out.String(), err)
+			}
+			if event.Time.IsZero() {
+				t.Error("Expected the event time but got zero")
+			}
+			event.Time = tc.event.Time
+			if tc.event != event {
+				t.Errorf("Expected %+v but got %+v", tc.event, event)
+			}
+		})
+	}
+}
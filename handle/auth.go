@@ -0,0 +1,238 @@
+package handle
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Schemes of an AuthRealm.
+const (
+	// AuthBasic authenticates users with HTTP basic authentication.
+	AuthBasic = "basic"
+	// AuthKey authenticates clients with access keys sent as a bearer token
+	// or in the 'X-Access-Key' header.
+	AuthKey = "key"
+)
+
+// AuthRealm requires authentication for requests with paths within Prefix.
+// For the basic scheme, Credentials maps user names to passwords. For the key
+// scheme, Credentials maps subjects to access keys. Passwords and keys are
+// either plain text, '{SHA}' followed by the base64 encoded SHA-1 hash (as
+// produced by 'htpasswd -s') or '{SHA256}' followed by the hex encoded SHA-256
+// hash.
+type AuthRealm struct {
+	Prefix      string
+	Scheme      string
+	Credentials map[string]string
+}
+
+// ParseAuthRealm converts a realm in the form '/path/prefix=scheme:filename'
+// into an AuthRealm, loading the credentials from the file. Each line of the
+// file is in the form 'name:secret'. Empty lines and lines starting with '#'
+// are ignored.
+func ParseAuthRealm(realm string) (parsed AuthRealm, err error) {
+	index := strings.Index(realm, "=")
+	if !strings.HasPrefix(realm, "/") || 0 > index {
+		err = fmt.Errorf(
+			"invalid auth realm '%s': expected '/path/prefix=scheme:filename'",
+			realm,
+		)
+		return
+	}
+	parsed.Prefix = realm[:index]
+	definition := strings.SplitN(realm[index+1:], ":", 2)
+	if 2 != len(definition) {
+		err = fmt.Errorf(
+			"invalid auth realm '%s': expected 'scheme:filename'", realm,
+		)
+		return
+	}
+	switch parsed.Scheme = definition[0]; parsed.Scheme {
+	case AuthBasic, AuthKey:
+	default:
+		err = fmt.Errorf(
+			"invalid auth realm '%s': unknown scheme '%s'", realm, definition[0],
+		)
+		return
+	}
+	if parsed.Credentials, err = loadCredentials(definition[1]); nil != err {
+		err = fmt.Errorf("invalid auth realm '%s': %v", realm, err)
+	}
+	return
+}
+
+// ParseAuthRealms converts each realm using ParseAuthRealm.
+func ParseAuthRealms(realms []string) ([]AuthRealm, error) {
+	parsed := make([]AuthRealm, 0, len(realms))
+	for _, realm := range realms {
+		result, err := ParseAuthRealm(realm)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// Authenticate returns the subject authenticated by the request or an empty
+// string if the request lacks valid credentials for the realm.
+func (realm AuthRealm) Authenticate(r *http.Request) string {
+	switch realm.Scheme {
+	case AuthBasic:
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			return ""
+		}
+		if secret, found := realm.Credentials[user]; found &&
+			matchesSecret(secret, password) {
+			return user
+		}
+	case AuthKey:
+		key := accessKey(r)
+		if 0 == len(key) {
+			return ""
+		}
+		for subject, secret := range realm.Credentials {
+			if matchesSecret(secret, key) {
+				return subject
+			}
+		}
+	}
+	return ""
+}
+
+// WithAuth wraps an HTTP request. Requests with paths within the prefix of a
+// realm, using the longest matching prefix, are only served if authenticated
+// by that realm. Other requests are served anonymously. The authenticated
+// subject is added to the access log and is available from Subject. Later
+// stages check other paths against the realms with Allowed.
+func WithAuth(serve http.HandlerFunc, realms []AuthRealm) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Other paths are checked with the subject the request arrived with.
+		arrived := Subject(r)
+		r = withAccessCheck(r, func(r *http.Request) (*http.Request, bool) {
+			match := matchRealm(realms, r.URL.Path)
+			if 0 > match {
+				return WithSubject(r, arrived), true
+			}
+			authenticated := realms[match].Authenticate(r)
+			return WithSubject(r, authenticated), 0 < len(authenticated)
+		})
+
+		match := matchRealm(realms, r.URL.Path)
+		if 0 > match {
+			serve(w, r)
+			return
+		}
+
+		realm := realms[match]
+		subject := realm.Authenticate(r)
+		if 0 == len(subject) {
+			audit(r, AuditEvent{Event: AuditAuthFailure, Realm: realm.Prefix})
+			refuseAuth(w, r, realm)
+			return
+		}
+		r = WithSubject(annotate(r, "subject", subject), subject)
+		audit(r, AuditEvent{Event: AuditAuthSuccess, Realm: realm.Prefix})
+		serve(w, r)
+	}
+}
+
+// matchRealm returns the index of the realm with the longest prefix the URL
+// path is within, or -1 if there is none.
+func matchRealm(realms []AuthRealm, urlPath string) int {
+	match := -1
+	for i, realm := range realms {
+		if withinPrefix(urlPath, realm.Prefix) &&
+			(0 > match || len(realms[match].Prefix) < len(realm.Prefix)) {
+			match = i
+		}
+	}
+	return match
+}
+
+// accessKey returns the access key sent as a bearer token or in the
+// 'X-Access-Key' header, or an empty string if there is none.
+func accessKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-Access-Key")
+}
+
+// refuseAuth logs and returns 'UNAUTHORIZED' with a challenge for the realm.
+func refuseAuth(w http.ResponseWriter, r *http.Request, realm AuthRealm) {
+	log.Printf(
+		"DENY: %s %s %s%s unauthenticated for realm %s%s\n",
+		r.Method,
+		r.Proto,
+		r.Host,
+		r.URL.Path,
+		realm.Prefix,
+		annotations(r),
+	)
+	challenge := "Basic"
+	if AuthKey == realm.Scheme {
+		challenge = "Bearer"
+	}
+	w.Header().Set(
+		"WWW-Authenticate", fmt.Sprintf("%s realm=\"%s\"", challenge, realm.Prefix),
+	)
+	http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+}
+
+// loadCredentials reads 'name:secret' lines from the file.
+func loadCredentials(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+
+	credentials := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if 0 == len(text) || strings.HasPrefix(text, "#") {
+			continue
+		}
+		index := strings.Index(text, ":")
+		if 0 >= index || len(text)-1 == index {
+			return nil, fmt.Errorf(
+				"line %d of '%s' is not in the form 'name:secret'", line, filename,
+			)
+		}
+		credentials[text[:index]] = text[index+1:]
+	}
+	return credentials, scanner.Err()
+}
+
+// matchesSecret returns true if the supplied value matches the stored secret
+// in constant time.
+func matchesSecret(secret, supplied string) bool {
+	var expected, actual []byte
+	switch {
+	case strings.HasPrefix(secret, "{SHA}"):
+		sum := sha1.Sum([]byte(supplied))
+		expected = []byte(strings.TrimPrefix(secret, "{SHA}"))
+		actual = []byte(base64.StdEncoding.EncodeToString(sum[:]))
+	case strings.HasPrefix(secret, "{SHA256}"):
+		sum := sha256.Sum256([]byte(supplied))
+		expected = []byte(strings.ToLower(strings.TrimPrefix(secret, "{SHA256}")))
+		actual = []byte(hex.EncodeToString(sum[:]))
+	default:
+		expectedSum := sha256.Sum256([]byte(secret))
+		actualSum := sha256.Sum256([]byte(supplied))
+		expected, actual = expectedSum[:], actualSum[:]
+	}
+	return 1 == subtle.ConstantTimeCompare(expected, actual)
+}
@@ -0,0 +1,144 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const (
+	testUsers = "# Users of the private realm.\n" +
+		"alice:plain\n" +
+		"\n" +
+		"bob:{SHA}YxhVOJnarilBcYwCUIru6TivGhw=\n"
+	testKeys = "ci:key-one\n" +
+		"deploy:{SHA256}c8df51469c308a59bfbd48a3e0bdd228ca922d6032035f5ef6e4ad45f473a9f3\n"
+)
+
+// writeCredentials saves the contents into a file in the test folder and
+// returns its name.
+func writeCredentials(t *testing.T, name, contents string) string {
+	filename := baseDir + name
+	if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+		t.Fatalf("While writing credentials got %v", err)
+	}
+	return filename
+}
+
+func TestParseAuthRealm(t *testing.T) {
+	users := writeCredentials(t, "users.txt", testUsers)
+	defer os.Remove(users)
+	bad := writeCredentials(t, "bad.txt", "no separator\n")
+	defer os.Remove(bad)
+
+	testCases := []struct {
+		name    string
+		realm   string
+		count   int
+		isError bool
+	}{
+		{"Basic", "/private=basic:" + users, 2, false},
+		{"Key", "/api=key:" + users, 2, false},
+		{"Missing prefix", "basic:" + users, 0, true},
+		{"Missing filename", "/private=basic", 0, true},
+		{"Unknown scheme", "/private=digest:" + users, 0, true},
+		{"Missing file", "/private=basic:" + baseDir + "missing.txt", 0, true},
+		{"Bad file", "/private=basic:" + bad, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			realm, err := ParseAuthRealm(tc.realm)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if tc.count != len(realm.Credentials) {
+				t.Errorf("Expected %d credentials but got %d", tc.count, len(realm.Credentials))
+			}
+		})
+	}
+
+	if _, err := ParseAuthRealms([]string{"/private=basic:" + users, "bad"}); nil == err {
+		t.Error("With a bad realm expected an error but got nil")
+	}
+}
+
+func TestWithAuth(t *testing.T) {
+	users := writeCredentials(t, "users.txt", testUsers)
+	defer os.Remove(users)
+	keys := writeCredentials(t, "keys.txt", testKeys)
+	defer os.Remove(keys)
+
+	realms, err := ParseAuthRealms([]string{
+		"/sub=basic:" + users,
+		"/sub/deep=key:" + keys,
+	})
+	if nil != err {
+		t.Fatalf("While parsing realms got %v", err)
+	}
+	var subject string
+	handler := WithAuth(func(w http.ResponseWriter, r *http.Request) {
+		subject = Subject(r)
+	}, realms)
+
+	testCases := []struct {
+		name      string
+		path      string
+		setup     func(*http.Request)
+		code      int
+		subject   string
+		challenge string
+	}{
+		{"Anonymous", "/file.txt", nil, ok, "", ""},
+		{"Outside prefix", "/subscriptions", nil, ok, "", ""},
+		{"Basic missing", "/sub/file.txt", nil, http.StatusUnauthorized, "", `Basic realm="/sub"`},
+		{"Basic plain", "/sub/file.txt", func(r *http.Request) {
+			r.SetBasicAuth("alice", "plain")
+		}, ok, "alice", ""},
+		{"Basic hashed", "/sub", func(r *http.Request) {
+			r.SetBasicAuth("bob", "hashed")
+		}, ok, "bob", ""},
+		{"Basic wrong password", "/sub/file.txt", func(r *http.Request) {
+			r.SetBasicAuth("alice", "wrong")
+		}, http.StatusUnauthorized, "", `Basic realm="/sub"`},
+		{"Basic unknown user", "/sub/file.txt", func(r *http.Request) {
+			r.SetBasicAuth("carol", "plain")
+		}, http.StatusUnauthorized, "", `Basic realm="/sub"`},
+		{"Key missing", "/sub/deep/file.txt", func(r *http.Request) {
+			r.SetBasicAuth("alice", "plain")
+		}, http.StatusUnauthorized, "", `Bearer realm="/sub/deep"`},
+		{"Key header", "/sub/deep/file.txt", func(r *http.Request) {
+			r.Header.Set("X-Access-Key", "key-one")
+		}, ok, "ci", ""},
+		{"Key bearer hashed", "/sub/deep/file.txt", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer key-two")
+		}, ok, "deploy", ""},
+		{"Key wrong", "/sub/deep/file.txt", func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer key-three")
+		}, http.StatusUnauthorized, "", `Bearer realm="/sub/deep"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			subject = ""
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			if nil != tc.setup {
+				tc.setup(req)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if tc.subject != subject {
+				t.Errorf("Expected subject '%s' but got '%s'", tc.subject, subject)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); tc.challenge != challenge {
+				t.Errorf("Expected challenge '%s' but got '%s'", tc.challenge, challenge)
+			}
+		})
+	}
+}
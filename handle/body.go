@@ -0,0 +1,165 @@
+package handle
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxBodySize limits the responses buffered to change their body. Larger
+// responses are served unchanged.
+const maxBodySize = 8 << 20
+
+// mediaType returns the media type of a Content-Type value, such as
+// 'text/html' for 'text/html; charset=utf-8', or an empty string if invalid.
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if nil != err {
+		return ""
+	}
+	return parsed
+}
+
+// serveChanged serves the request, changing the body of successful responses
+// that are not encoded and have an accepted media type. Requests for folders
+// and files with the accepted media types are served whole, ignoring 'Range',
+// as ranges of the original file would not match. HEAD requests for them are
+// served as GET requests without writing the body, so their headers, such as
+// 'Content-Length', match those of the changed body.
+func serveChanged(
+	serve http.HandlerFunc,
+	w http.ResponseWriter,
+	r *http.Request,
+	accept func(mediaType string) bool,
+	change func(header http.Header, body []byte) []byte,
+) {
+	head := false
+	if strings.HasSuffix(r.URL.Path, "/") ||
+		accept(mediaType(mime.TypeByExtension(path.Ext(r.URL.Path)))) {
+		r.Header.Del("Range")
+		if http.MethodHead == r.Method {
+			r = r.Clone(r.Context())
+			r.Method, head = http.MethodGet, true
+		}
+	}
+	writer := &bodyWriter{
+		ResponseWriter: w,
+		r:              r,
+		head:           head,
+		accept:         accept,
+		change:         change,
+	}
+	serve(writer, r)
+	writer.finish()
+}
+
+// bodyWriter buffers successful responses, that are not encoded and have an
+// accepted media type, to change their body before writing it. The body of
+// responses to HEAD requests is left unchanged, unless they are served as GET
+// requests with head set, in which case no body is written. The 'ETag' of
+// changed responses is weakened, as the same validator cannot be sent for
+// different bytes.
+type bodyWriter struct {
+	http.ResponseWriter
+	r         *http.Request
+	head      bool
+	accept    func(mediaType string) bool
+	change    func(header http.Header, body []byte) []byte
+	written   bool
+	buffering bool
+	status    int
+	buffer    bytes.Buffer
+}
+
+// WriteHeader starts buffering accepted responses.
+func (w *bodyWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+	w.written = true
+	header := w.Header()
+	if http.StatusOK != code || 0 < len(header.Get("Content-Encoding")) ||
+		!w.accept(mediaType(header.Get("Content-Type"))) {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.buffering = true
+	w.status = code
+	header.Del("Content-Length")
+}
+
+// Write buffers the body of accepted responses, serving the response
+// unchanged if it grows past maxBodySize.
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		if w.head {
+			return len(b), nil
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	if maxBodySize < w.buffer.Len()+len(b) {
+		w.overflow()
+		return w.Write(b)
+	}
+	return w.buffer.Write(b)
+}
+
+// ReadFrom buffers the body of accepted responses.
+func (w *bodyWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering && !w.head {
+		return readFrom(w.ResponseWriter, src)
+	}
+	return copyBuffer(writerOnly{w}, src)
+}
+
+// Flush flushes the response unless it is buffered.
+func (w *bodyWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		flush(w.ResponseWriter)
+	}
+}
+
+// overflow stops buffering, writing the buffered body unchanged.
+func (w *bodyWriter) overflow() {
+	w.buffering = false
+	w.ResponseWriter.WriteHeader(w.status)
+	if !w.head {
+		w.ResponseWriter.Write(w.buffer.Bytes())
+	}
+	w.buffer.Reset()
+}
+
+// finish changes the buffered body and writes the response.
+func (w *bodyWriter) finish() {
+	if !w.buffering {
+		return
+	}
+	body := w.buffer.Bytes()
+	if http.MethodHead != w.r.Method {
+		original := body
+		body = w.change(w.Header(), body)
+		header := w.Header()
+		if etag := header.Get("ETag"); !bytes.Equal(original, body) &&
+			0 < len(etag) && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if !w.head {
+		w.ResponseWriter.Write(body)
+	}
+}
@@ -0,0 +1,73 @@
+package handle
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCopyBufferSize is the size of the pooled buffers used when copying
+// files through user space.
+const DefaultCopyBufferSize = 32 * 1024
+
+// bufferPool of copy buffers of one size.
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+// newBufferPool returns a pool of buffers of the size.
+func newBufferPool(size int) *bufferPool {
+	buffers := &bufferPool{size: size}
+	buffers.pool.New = func() interface{} {
+		b := make([]byte, size)
+		return &b
+	}
+	return buffers
+}
+
+// copyBuffers is the pool used by every streaming path, such as responses
+// copied to writers without sendfile, recorded cache entries, checksums and
+// content searches, so buffers are reused rather than allocated per request.
+var copyBuffers atomic.Value
+
+func init() {
+	copyBuffers.Store(newBufferPool(DefaultCopyBufferSize))
+}
+
+// SetCopyBufferSize sets the size of the pooled buffers used when copying
+// files through user space for every server in the process. Larger buffers
+// need fewer system calls for large files at the cost of memory for each
+// concurrent copy. Sizes below 1 restore DefaultCopyBufferSize.
+func SetCopyBufferSize(size int) {
+	if 1 > size {
+		size = DefaultCopyBufferSize
+	}
+	if size == copyBuffers.Load().(*bufferPool).size {
+		return
+	}
+	copyBuffers.Store(newBufferPool(size))
+}
+
+// withBuffer calls fn with a pooled buffer, returning it to the pool after.
+func withBuffer(fn func([]byte)) {
+	buffers := copyBuffers.Load().(*bufferPool)
+	b := buffers.pool.Get().(*[]byte)
+	defer buffers.pool.Put(b)
+	fn(*b)
+}
+
+// copyBuffer copies the reader to the writer through a pooled buffer. Any
+// io.WriterTo of the reader is hidden so that it cannot allocate a buffer of
+// its own, while any io.ReaderFrom of the writer is still used.
+func copyBuffer(dst io.Writer, src io.Reader) (n int64, err error) {
+	withBuffer(func(b []byte) {
+		n, err = io.CopyBuffer(dst, readerOnly{src}, b)
+	})
+	return
+}
+
+// readerOnly hides any io.WriterTo of the reader from io.CopyBuffer.
+type readerOnly struct {
+	io.Reader
+}
@@ -0,0 +1,53 @@
+package handle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCopyBuffer(t *testing.T) {
+	defer SetCopyBufferSize(0)
+
+	testCases := []struct {
+		name     string
+		size     int
+		expected int
+	}{
+		{"Default", 0, DefaultCopyBufferSize},
+		{"Small", 4, 4},
+		{"Large", 1 << 20, 1 << 20},
+		{"Negative", -1, DefaultCopyBufferSize},
+	}
+	contents := strings.Repeat("These are the voyages of the starship Enterprise.", 100)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			SetCopyBufferSize(tc.size)
+			withBuffer(func(b []byte) {
+				if tc.expected != len(b) {
+					t.Errorf("Expected a buffer of %d bytes but got %d", tc.expected, len(b))
+				}
+			})
+
+			// Contents are copied whole with any buffer size.
+			var out bytes.Buffer
+			n, err := copyBuffer(&out, bytes.NewReader([]byte(contents)))
+			if nil != err || int64(len(contents)) != n || contents != out.String() {
+				t.Errorf("Expected %d bytes copied but got %d and %v", len(contents), n, err)
+			}
+		})
+	}
+}
+
+func BenchmarkCopyBuffer(b *testing.B) {
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 1<<12)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(contents)))
+	b.RunParallel(func(pb *testing.PB) {
+		var out bytes.Buffer
+		for pb.Next() {
+			out.Reset()
+			copyBuffer(&out, bytes.NewReader(contents))
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package handle
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheConfig controls the memory used by WithCache.
+type CacheConfig struct {
+	// MaxSize in bytes of all cached response bodies.
+	MaxSize int
+
+	// MaxEntrySize in bytes of a single cached response body. Larger responses
+	// are never cached.
+	MaxEntrySize int
+
+	// TTL of each cached response. If zero, responses remain cached until
+	// evicted to make room for other responses.
+	TTL time.Duration
+
+	// IgnoreQuery parameters, such as cache busting 'v' or 'cb' parameters,
+	// are removed from the URL before looking up cached responses, so
+	// versioned URLs of the same file share a single cached response.
+	IgnoreQuery []string
+
+	// Stats, if set, are updated as the cache is used.
+	Stats *CacheStats
+}
+
+// CacheStats of a cache created by WithCache. Values are safe to read while the
+// cache is in use.
+type CacheStats struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	entries   int64
+	bytes     int64
+}
+
+// cacheEntry for a single response.
+type cacheEntry struct {
+	key     string
+	header  http.Header
+	body    []byte
+	modTime time.Time
+	expires time.Time
+	vary    map[string]string
+}
+
+// memoryCache of responses with least-recently-used eviction.
+type memoryCache struct {
+	config CacheConfig
+	mutex  sync.Mutex
+	order  *list.List
+	items  map[string]*list.Element
+	size   int
+}
+
+// WithCache wraps an HTTP request. Complete, successful responses to GET
+// requests are kept in memory and replayed for later GET and HEAD requests of
+// the same URL, including Range and conditional requests. Responses with a
+// 'Vary' header are only replayed for requests with the same values of the
+// listed request headers. Responses marked 'Cache-Control: no-store', setting
+// cookies or varying on '*' are never cached.
+func WithCache(serve http.HandlerFunc, config CacheConfig) http.HandlerFunc {
+	if nil == config.Stats {
+		config.Stats = &CacheStats{}
+	}
+	cache := &memoryCache{
+		config: config,
+		order:  list.New(),
+		items:  make(map[string]*list.Element),
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet != r.Method && http.MethodHead != r.Method {
+			serve(w, r)
+			return
+		}
+		key := cacheKey(r.URL, config.IgnoreQuery)
+		if entry := cache.get(key, r); nil != entry {
+			atomic.AddUint64(&config.Stats.hits, 1)
+			Tracef(r, "cache hit of '%s'", key)
+			header := w.Header()
+			for name, values := range entry.header {
+				header[name] = values
+			}
+			header.Del("Content-Length")
+			http.ServeContent(
+				w, r, r.URL.Path, entry.modTime, bytes.NewReader(entry.body),
+			)
+			return
+		}
+		atomic.AddUint64(&config.Stats.misses, 1)
+
+		// Only complete responses are recorded.
+		if http.MethodGet != r.Method || "" != r.Header.Get("Range") ||
+			"" != r.Header.Get("If-None-Match") ||
+			"" != r.Header.Get("If-Modified-Since") {
+			Tracef(r, "cache miss of '%s', not recorded as incomplete", key)
+			serve(w, r)
+			return
+		}
+		Tracef(r, "cache miss of '%s'", key)
+		recorder := &cacheWriter{ResponseWriter: w, max: config.MaxEntrySize}
+		serve(recorder, r)
+		cache.store(key, r, recorder)
+	}
+}
+
+// cacheKey returns the request URI without the ignored query parameters.
+func cacheKey(u *url.URL, ignoreQuery []string) string {
+	if 0 == len(ignoreQuery) || 0 == len(u.RawQuery) {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	for _, name := range ignoreQuery {
+		query.Del(name)
+	}
+	stripped := *u
+	stripped.RawQuery = query.Encode()
+	return stripped.RequestURI()
+}
+
+// Hits returns the number of requests answered from the cache.
+func (stats *CacheStats) Hits() uint64 {
+	return atomic.LoadUint64(&stats.hits)
+}
+
+// Misses returns the number of requests not answered from the cache.
+func (stats *CacheStats) Misses() uint64 {
+	return atomic.LoadUint64(&stats.misses)
+}
+
+// Evictions returns the number of responses removed to make room for others
+// or because they expired.
+func (stats *CacheStats) Evictions() uint64 {
+	return atomic.LoadUint64(&stats.evictions)
+}
+
+// Entries returns the number of responses currently cached.
+func (stats *CacheStats) Entries() int64 {
+	return atomic.LoadInt64(&stats.entries)
+}
+
+// Bytes returns the size of all response bodies currently cached.
+func (stats *CacheStats) Bytes() int64 {
+	return atomic.LoadInt64(&stats.bytes)
+}
+
+// get the unexpired entry for the key matching the varying request headers, or
+// nil if none exists.
+func (cache *memoryCache) get(key string, r *http.Request) *cacheEntry {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, found := cache.items[key]
+	if !found {
+		return nil
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		cache.remove(element, true)
+		return nil
+	}
+	for field, value := range entry.vary {
+		if value != strings.Join(r.Header.Values(field), ", ") {
+			return nil
+		}
+	}
+	cache.order.MoveToFront(element)
+	return entry
+}
+
+// store the recorded response if it is cacheable, evicting the least recently
+// used entries to make room.
+func (cache *memoryCache) store(
+	key string, r *http.Request, recorder *cacheWriter,
+) {
+	header := recorder.Header()
+	fields := varyFields(header)
+	if http.StatusOK != recorder.status || recorder.overflow || recorder.failed ||
+		cache.config.MaxSize < recorder.body.Len() ||
+		strings.Contains(header.Get("Cache-Control"), "no-store") ||
+		"" != header.Get("Set-Cookie") || containsString(fields, "*") {
+		return
+	}
+	// Bodies cut short, such as by handlers stopping early, are incomplete.
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if nil == err && length != recorder.body.Len() {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:    key,
+		header: make(http.Header, len(header)),
+		body:   recorder.body.Bytes(),
+	}
+	for name, values := range header {
+		entry.header[name] = append([]string(nil), values...)
+	}
+	if 0 < len(fields) {
+		entry.vary = make(map[string]string, len(fields))
+		for _, field := range fields {
+			entry.vary[field] = strings.Join(r.Header.Values(field), ", ")
+		}
+	}
+	if modTime, err := http.ParseTime(header.Get("Last-Modified")); nil == err {
+		entry.modTime = modTime
+	}
+	if 0 < cache.config.TTL {
+		entry.expires = time.Now().Add(cache.config.TTL)
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if existing, found := cache.items[key]; found {
+		cache.remove(existing, false)
+	}
+	for cache.config.MaxSize < cache.size+len(entry.body) {
+		cache.remove(cache.order.Back(), true)
+	}
+	cache.items[key] = cache.order.PushFront(entry)
+	cache.size += len(entry.body)
+	atomic.AddInt64(&cache.config.Stats.entries, 1)
+	atomic.AddInt64(&cache.config.Stats.bytes, int64(len(entry.body)))
+}
+
+// remove the element from the cache, counting it as an eviction if evicted is
+// true. The mutex must be held.
+func (cache *memoryCache) remove(element *list.Element, evicted bool) {
+	entry := cache.order.Remove(element).(*cacheEntry)
+	delete(cache.items, entry.key)
+	cache.size -= len(entry.body)
+	if evicted {
+		atomic.AddUint64(&cache.config.Stats.evictions, 1)
+	}
+	atomic.AddInt64(&cache.config.Stats.entries, -1)
+	atomic.AddInt64(&cache.config.Stats.bytes, -int64(len(entry.body)))
+}
+
+// cacheWriter passes the response through while recording the status and, up
+// to max bytes, the body written to the client. Failed writes, such as to
+// disconnected clients, leave the recorded body incomplete.
+type cacheWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	max      int
+	overflow bool
+	failed   bool
+}
+
+// WriteHeader records the status code.
+func (w *cacheWriter) WriteHeader(code int) {
+	if 0 == w.status {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the bytes written to the client until the body exceeds the
+// maximum size.
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	if nil != err {
+		w.failed = true
+	}
+	if !w.overflow {
+		if w.max < w.body.Len()+n {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b[:n])
+		}
+	}
+	return n, err
+}
+
+// ReadFrom records the body copied from the reader, unless its declared
+// 'Content-Length' exceeds the maximum size, in which case it is passed
+// through without being recorded.
+func (w *cacheWriter) ReadFrom(src io.Reader) (int64, error) {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	length, err := strconv.Atoi(w.Header().Get("Content-Length"))
+	if !w.overflow && (nil != err || w.max >= w.body.Len()+length) {
+		return copyBuffer(writerOnly{w}, src)
+	}
+	w.overflow = true
+	w.body = bytes.Buffer{}
+	return readFrom(w.ResponseWriter, src)
+}
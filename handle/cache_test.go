@@ -0,0 +1,231 @@
+package handle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithCache(t *testing.T) {
+	calls := 0
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/cookie":
+			w.Header().Set("Set-Cookie", "a=b")
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		case "/large":
+			w.Write([]byte(strings.Repeat("x", 64)))
+			return
+		case "/short":
+			w.Header().Set("Content-Length", "20")
+			w.Write([]byte("cut short"))
+			return
+		}
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("contents of " + r.URL.Path))
+	}
+
+	testCases := []struct {
+		name   string
+		path   string
+		cached bool
+	}{
+		{"Cacheable", "/file.txt", true},
+		{"Cacheable with query", "/file.txt?v=1", true},
+		{"No store", "/no-store", false},
+		{"Cookie", "/cookie", false},
+		{"Missing", "/missing", false},
+		{"Too large", "/large", false},
+		{"Shorter than its length", "/short", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := &CacheStats{}
+			handler := WithCache(serve, CacheConfig{
+				MaxSize: 1024, MaxEntrySize: 32, Stats: stats,
+			})
+			calls = 0
+			var bodies []string
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+				w := httptest.NewRecorder()
+				handler(w, req)
+				bodies = append(bodies, w.Body.String())
+			}
+
+			expectedCalls := 2
+			if tc.cached {
+				expectedCalls = 1
+			}
+			if expectedCalls != calls {
+				t.Errorf("Expected %d calls but got %d", expectedCalls, calls)
+			}
+			if bodies[0] != bodies[1] {
+				t.Errorf("Expected identical bodies but got %v", bodies)
+			}
+			if tc.cached && (1 != stats.Hits() || 1 != stats.Misses() || 1 != stats.Entries()) {
+				t.Errorf(
+					"Expected 1 hit, miss and entry but got %d, %d and %d",
+					stats.Hits(), stats.Misses(), stats.Entries(),
+				)
+			}
+		})
+	}
+}
+
+// failingWriter fails writes to the client once the limit is reached.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+// Write up to the limit, failing once it is reached.
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.limit < len(b) {
+		n, _ := w.ResponseRecorder.Write(b[:w.limit])
+		w.limit = 0
+		return n, errors.New("connection reset")
+	}
+	w.limit -= len(b)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestWithCacheFailedWrite(t *testing.T) {
+	contents := strings.Repeat("x", 100)
+	calls := 0
+	handler := WithCache(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(contents))
+	}, CacheConfig{MaxSize: 1024, MaxEntrySize: 1024})
+
+	req := httptest.NewRequest("GET", "http://localhost/file.txt", nil)
+	handler(&failingWriter{httptest.NewRecorder(), 32}, req)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if 2 != calls || contents != w.Body.String() {
+		t.Errorf("Expected 2 calls and the full body but got %d and %d bytes", calls, w.Body.Len())
+	}
+}
+
+func TestWithCacheReplay(t *testing.T) {
+	handler := WithCache(Basic(http.ServeFile, baseDir), CacheConfig{
+		MaxSize: 1024, MaxEntrySize: 1024,
+	})
+	fullpath := "http://localhost/" + tmpFileName
+
+	// Prime the cache.
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", fullpath, nil))
+
+	req := httptest.NewRequest("GET", fullpath, nil)
+	req.Header.Set("Range", "bytes=0-4")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if http.StatusPartialContent != w.Code || tmpFile[:5] != w.Body.String() {
+		t.Errorf("For range expected %d '%s' but got %d '%s'",
+			http.StatusPartialContent, tmpFile[:5], w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", fullpath, nil)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if http.StatusNotModified != w.Code {
+		t.Errorf("For conditional expected %d but got %d", http.StatusNotModified, w.Code)
+	}
+
+	req = httptest.NewRequest("HEAD", fullpath, nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if ok != w.Code || 0 != w.Body.Len() {
+		t.Errorf("For HEAD expected %d without body but got %d '%s'", ok, w.Code, w.Body.String())
+	}
+	if "text/plain; charset=utf-8" != w.Header().Get("Content-Type") {
+		t.Errorf("For HEAD expected cached content type but got '%s'", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestWithCacheIgnoreQuery(t *testing.T) {
+	calls := 0
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("contents"))
+	}
+	handler := WithCache(serve, CacheConfig{
+		MaxSize: 1024, MaxEntrySize: 1024, IgnoreQuery: []string{"v", "cb"},
+	})
+
+	testCases := []struct {
+		path  string
+		calls int
+	}{
+		{"/app.js?v=1", 1},
+		{"/app.js?v=2", 1},
+		{"/app.js?cb=123&v=3", 1},
+		{"/app.js", 1},
+		{"/app.js?lang=en&v=1", 2},
+		{"/app.js?v=2&lang=en", 2},
+	}
+	for _, tc := range testCases {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost"+tc.path, nil))
+		if tc.calls != calls {
+			t.Errorf("After %s expected %d calls but got %d", tc.path, tc.calls, calls)
+		}
+	}
+}
+
+func TestWithCacheEviction(t *testing.T) {
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 10)))
+	}
+
+	// Room for two entries.
+	stats := &CacheStats{}
+	handler := WithCache(serve, CacheConfig{
+		MaxSize: 25, MaxEntrySize: 25, Stats: stats,
+	})
+	for _, path := range []string{"/a", "/b", "/a", "/c"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost"+path, nil))
+	}
+	if 1 != stats.Evictions() || 2 != stats.Entries() || 20 != stats.Bytes() {
+		t.Errorf(
+			"Expected 1 eviction, 2 entries and 20 bytes but got %d, %d and %d",
+			stats.Evictions(), stats.Entries(), stats.Bytes(),
+		)
+	}
+
+	// '/b' was least recently used.
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/a", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/b", nil))
+	if 2 != stats.Hits() {
+		t.Errorf("Expected 2 hits but got %d", stats.Hits())
+	}
+
+	// Expired entries are evicted.
+	stats = &CacheStats{}
+	handler = WithCache(serve, CacheConfig{
+		MaxSize: 25, MaxEntrySize: 25, TTL: time.Nanosecond, Stats: stats,
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/a", nil))
+	time.Sleep(time.Millisecond)
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/a", nil))
+	if 0 != stats.Hits() || 1 != stats.Evictions() {
+		t.Errorf("Expected expiry eviction without hits but got %d hits and %d evictions",
+			stats.Hits(), stats.Evictions())
+	}
+
+	// Non-GET requests pass through.
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", "http://localhost/a", nil))
+	if 2 != stats.Misses() {
+		t.Errorf("Expected POST to bypass the cache but got %d misses", stats.Misses())
+	}
+}
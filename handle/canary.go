@@ -0,0 +1,82 @@
+package handle
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+)
+
+// Ways clients stick to the release they were first served, accepted by
+// WithCanary.
+const (
+	// CanaryStickyCookie remembers the release of each client in a cookie.
+	CanaryStickyCookie = "cookie"
+	// CanaryStickyIP chooses the release of each client by its IP address.
+	CanaryStickyIP = "ip"
+)
+
+const (
+	// CanaryCookie is the name of the cookie holding the release of a client:
+	// '1' for the canary and '0' for the stable release.
+	CanaryCookie = "canary"
+
+	// canaryCookieMaxAge in seconds, keeping returning clients on one release.
+	canaryCookieMaxAge = 86400
+)
+
+// Canary splits requests between the stable and canary releases of a site.
+type Canary struct {
+	// Percent of clients served the canary release.
+	Percent int
+	// Sticky is CanaryStickyCookie or CanaryStickyIP.
+	Sticky string
+}
+
+// WithCanary wraps an HTTP request, serving the canary percent of clients
+// with the canary handler and all others with serve. Clients stick to their
+// release: with cookies the release is chosen at random on the first request
+// and kept in the CanaryCookie, which testers may also set to pick a release;
+// by IP address the release is chosen from a hash of the address, so caches in
+// front of the server must not share responses between clients.
+func WithCanary(serve, canary http.HandlerFunc, split Canary) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var chosen bool
+		if CanaryStickyIP == split.Sticky {
+			chosen = canaryBucket(clientIP(r).String()) < split.Percent
+		} else {
+			AddVary(w.Header(), "Cookie")
+			if cookie, err := r.Cookie(CanaryCookie); nil == err &&
+				("0" == cookie.Value || "1" == cookie.Value) {
+				chosen = "1" == cookie.Value
+			} else {
+				chosen = rand.Intn(100) < split.Percent
+				value := "0"
+				if chosen {
+					value = "1"
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:     CanaryCookie,
+					Value:    value,
+					Path:     "/",
+					MaxAge:   canaryCookieMaxAge,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+		}
+		if chosen {
+			Tracef(r, "serving the canary release")
+			canary(w, r)
+			return
+		}
+		Tracef(r, "serving the stable release")
+		serve(w, r)
+	}
+}
+
+// canaryBucket returns the bucket from 0 to 99 of the client.
+func canaryBucket(client string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(client))
+	return int(hash.Sum32() % 100)
+}
@@ -0,0 +1,85 @@
+package handle
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithCanary(t *testing.T) {
+	stable := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable"))
+	}
+	canary := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("canary"))
+	}
+
+	testCases := []struct {
+		name     string
+		split    Canary
+		cookie   string
+		expected string
+		setting  string
+	}{
+		{"None", Canary{Percent: 0}, "", "stable", "canary=0"},
+		{"All", Canary{Percent: 100}, "", "canary", "canary=1"},
+		{"Sticky stable", Canary{Percent: 100}, "0", "stable", ""},
+		{"Sticky canary", Canary{Percent: 0}, "1", "canary", ""},
+		{"Invalid cookie", Canary{Percent: 100}, "yes", "canary", "canary=1"},
+		{"IP none", Canary{Percent: 0, Sticky: CanaryStickyIP}, "1", "stable", ""},
+		{"IP all", Canary{Percent: 100, Sticky: CanaryStickyIP}, "", "canary", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithCanary(stable, canary, tc.split)
+			req := httptest.NewRequest("GET", "http://localhost/index.html", nil)
+			if 0 < len(tc.cookie) {
+				req.AddCookie(&http.Cookie{Name: CanaryCookie, Value: tc.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if tc.expected != w.Body.String() {
+				t.Errorf("Expected the %s release but got %s", tc.expected, w.Body)
+			}
+			cookie := w.Header().Get("Set-Cookie")
+			if 0 == len(tc.setting) && 0 < len(cookie) {
+				t.Errorf("Expected no cookie but got '%s'", cookie)
+			}
+			if 0 < len(tc.setting) && tc.setting != cookie[:len(tc.setting)] {
+				t.Errorf("Expected cookie '%s' but got '%s'", tc.setting, cookie)
+			}
+			vary := w.Header().Get("Vary")
+			if (CanaryStickyIP == tc.split.Sticky) == ("Cookie" == vary) {
+				t.Errorf("Expected Vary to match stickiness but got '%s'", vary)
+			}
+		})
+	}
+
+	// Clients are split by IP address in roughly the percent, each always
+	// served the same release.
+	handler := WithCanary(stable, canary, Canary{Percent: 25, Sticky: CanaryStickyIP})
+	served := 0
+	for i := 0; i < 1000; i++ {
+		remoteAddr := fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+		var releases []string
+		for j := 0; j < 2; j++ {
+			req := httptest.NewRequest("GET", "http://localhost/index.html", nil)
+			req.RemoteAddr = remoteAddr
+			w := httptest.NewRecorder()
+			handler(w, req)
+			releases = append(releases, w.Body.String())
+		}
+		if releases[0] != releases[1] {
+			t.Fatalf("Expected %s to be served one release but got %v", remoteAddr, releases)
+		}
+		if "canary" == releases[0] {
+			served++
+		}
+	}
+	if served < 150 || 350 < served {
+		t.Errorf("Expected about 250 of 1000 clients served the canary but got %d", served)
+	}
+}
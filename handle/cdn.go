@@ -0,0 +1,322 @@
+package handle
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CDN providers of a CDNPurger.
+const (
+	// CDNCloudflare purges files of a Cloudflare zone.
+	CDNCloudflare = "cloudflare"
+	// CDNCloudFront invalidates paths of a CloudFront distribution.
+	CDNCloudFront = "cloudfront"
+	// CDNFastly purges surrogate keys and URLs of a Fastly service.
+	CDNFastly = "fastly"
+)
+
+// Default API endpoints of the CDN providers.
+var cdnEndpoints = map[string]string{
+	CDNCloudflare: "https://api.cloudflare.com/client/v4",
+	CDNCloudFront: "https://cloudfront.amazonaws.com",
+	CDNFastly:     "https://api.fastly.com",
+}
+
+// CDNPurger removes changed files from the edge caches of a CDN using the API
+// of the provider.
+type CDNPurger struct {
+	provider string
+	id       string
+	token    string
+	baseURL  string
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewCDNPurger returns a purger for the provider. The id is the Cloudflare
+// zone, the CloudFront distribution or the Fastly service. The token is the
+// Cloudflare or Fastly API token or, for CloudFront, the AWS credentials in the
+// form 'access-key-id:secret-access-key[:session-token]'. Files are purged by
+// URL, made of baseURL and the path, which is required for Cloudflare and
+// optional for Fastly. Fastly also purges the surrogate keys of the files.
+func NewCDNPurger(provider, id, token, baseURL string) (*CDNPurger, error) {
+	endpoint, found := cdnEndpoints[provider]
+	if !found {
+		return nil, fmt.Errorf("unknown CDN provider '%s'", provider)
+	}
+	if 0 == len(id) || 0 == len(token) {
+		return nil, fmt.Errorf("CDN provider '%s' requires an id and token", provider)
+	}
+	if CDNCloudflare == provider && 0 == len(baseURL) {
+		return nil, fmt.Errorf("CDN provider '%s' requires a base URL", provider)
+	}
+	if CDNCloudFront == provider && 2 > len(strings.Split(token, ":")) {
+		return nil, fmt.Errorf(
+			"CDN provider '%s' requires a token in the form "+
+				"'access-key-id:secret-access-key[:session-token]'",
+			provider,
+		)
+	}
+	return &CDNPurger{
+		provider: provider,
+		id:       id,
+		token:    token,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+// Purge the paths and surrogate keys from the CDN. Large purges are split into
+// batches within the limits of the provider.
+func (purger *CDNPurger) Purge(purge Purge) error {
+	switch purger.provider {
+	case CDNCloudflare:
+		for _, files := range batches(purger.urls(purge.Paths), 30) {
+			err := purger.cloudflare(map[string]interface{}{"files": files})
+			if nil != err {
+				return err
+			}
+		}
+	case CDNCloudFront:
+		for _, paths := range batches(purge.Paths, 3000) {
+			if err := purger.cloudfront(paths); nil != err {
+				return err
+			}
+		}
+	case CDNFastly:
+		for _, keys := range batches(purge.Keys, 256) {
+			body, err := json.Marshal(map[string][]string{"surrogate_keys": keys})
+			if nil != err {
+				return err
+			}
+			if err = purger.fastly("/service/"+purger.id+"/purge", body); nil != err {
+				return err
+			}
+		}
+		if 0 < len(purger.baseURL) {
+			for _, cached := range purger.urls(purge.Paths) {
+				cached = cached[strings.Index(cached, "://")+3:]
+				if err := purger.fastly("/purge/"+cached, nil); nil != err {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeAll removes every file from the CDN, such as after the folder being
+// served is switched to a new release.
+func (purger *CDNPurger) PurgeAll() error {
+	switch purger.provider {
+	case CDNCloudflare:
+		return purger.cloudflare(map[string]interface{}{"purge_everything": true})
+	case CDNCloudFront:
+		return purger.cloudfront([]string{"/*"})
+	case CDNFastly:
+		return purger.fastly("/service/"+purger.id+"/purge_all", nil)
+	}
+	return nil
+}
+
+// CDNPurge returns a WatchFunc purging the Purge of changed files from the
+// CDN. Failures are logged.
+func CDNPurge(
+	purger *CDNPurger, urlPrefix string, manifest map[string][]string,
+) WatchFunc {
+	return func(names []string) {
+		if err := purger.Purge(NewPurge(names, urlPrefix, manifest)); nil != err {
+			log.Printf("Error: while purging CDN got %v\n", err)
+		}
+	}
+}
+
+// urls of the paths on the CDN.
+func (purger *CDNPurger) urls(paths []string) []string {
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		urls[i] = purger.baseURL + (&url.URL{Path: path}).EscapedPath()
+	}
+	return urls
+}
+
+// cloudflare posts the purge request to the zone.
+func (purger *CDNPurger) cloudflare(request map[string]interface{}) error {
+	body, err := json.Marshal(request)
+	if nil != err {
+		return err
+	}
+	req, err := http.NewRequest(
+		"POST",
+		purger.endpoint+"/zones/"+purger.id+"/purge_cache",
+		bytes.NewReader(body),
+	)
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+purger.token)
+	req.Header.Set("Content-Type", "application/json")
+	return purger.do(req)
+}
+
+// fastly posts to the API path.
+func (purger *CDNPurger) fastly(path string, body []byte) error {
+	req, err := http.NewRequest("POST", purger.endpoint+path, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Fastly-Key", purger.token)
+	if nil != body {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return purger.do(req)
+}
+
+// cloudfrontInvalidation is the body of a CloudFront invalidation request.
+type cloudfrontInvalidation struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	CallerReference string   `xml:"CallerReference"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Paths           []string `xml:"Paths>Items>Path"`
+}
+
+// cloudfront creates an invalidation of the paths in the distribution.
+func (purger *CDNPurger) cloudfront(paths []string) error {
+	now := purger.now().UTC()
+	escaped := make([]string, len(paths))
+	for i, path := range paths {
+		escaped[i] = (&url.URL{Path: path}).EscapedPath()
+	}
+	body, err := xml.Marshal(cloudfrontInvalidation{
+		CallerReference: strconv.FormatInt(now.UnixNano(), 10),
+		Quantity:        len(escaped),
+		Paths:           escaped,
+	})
+	if nil != err {
+		return err
+	}
+	body = append([]byte(xml.Header), body...)
+	req, err := http.NewRequest(
+		"POST",
+		purger.endpoint+"/2020-05-31/distribution/"+purger.id+"/invalidation",
+		bytes.NewReader(body),
+	)
+	if nil != err {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	credentials := strings.SplitN(purger.token, ":", 3)
+	if 3 == len(credentials) {
+		req.Header.Set("X-Amz-Security-Token", credentials[2])
+	}
+	signAWS(req, body, credentials[0], credentials[1], "us-east-1", "cloudfront", now)
+	return purger.do(req)
+}
+
+// do sends the request, returning an error unless it succeeds.
+func (purger *CDNPurger) do(req *http.Request) error {
+	resp, err := purger.client.Do(req)
+	if nil != err {
+		return err
+	}
+	resp.Body.Close()
+	if 300 <= resp.StatusCode {
+		return fmt.Errorf("%s purge returned %s", purger.provider, resp.Status)
+	}
+	return nil
+}
+
+// signAWS adds an AWS Signature Version 4 'Authorization' header to the
+// request, signing the host, the body and every 'X-Amz-*' header.
+func signAWS(
+	req *http.Request,
+	body []byte,
+	key, secret, region, service string,
+	now time.Time,
+) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if 0 == len(path) {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hashHex([]byte(canonical))
+	signingKey := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		key, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, toSign)),
+	))
+}
+
+// hashHex returns the hex encoded SHA-256 hash of the data.
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// batches splits the values into slices of at most size values.
+func batches(values []string, size int) [][]string {
+	var split [][]string
+	for size < len(values) {
+		split = append(split, values[:size])
+		values = values[size:]
+	}
+	if 0 < len(values) {
+		split = append(split, values)
+	}
+	return split
+}
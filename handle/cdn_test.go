@@ -0,0 +1,146 @@
+package handle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCDN returns a purger for the provider sending requests to a test server
+// recording them as 'METHOD path body' and a function closing the server.
+func testCDN(
+	t *testing.T, provider, token, baseURL string, requests *[]string,
+) (*CDNPurger, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*requests = append(*requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, body))
+		if strings.Contains(r.URL.Path, "fail") {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	purger, err := NewCDNPurger(provider, "id", token, baseURL)
+	if nil != err {
+		t.Fatalf("While creating purger got %v", err)
+	}
+	purger.endpoint = server.URL
+	purger.now = func() time.Time { return time.Unix(1600000000, 0) }
+	return purger, server.Close
+}
+
+func TestNewCDNPurger(t *testing.T) {
+	testCases := []struct {
+		name     string
+		provider string
+		id       string
+		token    string
+		baseURL  string
+		isError  bool
+	}{
+		{"Cloudflare", CDNCloudflare, "zone", "token", "https://example.com", false},
+		{"CloudFront", CDNCloudFront, "distribution", "key:secret", "", false},
+		{"Fastly", CDNFastly, "service", "token", "", false},
+		{"Unknown", "akamai", "id", "token", "", true},
+		{"Missing id", CDNFastly, "", "token", "", true},
+		{"Cloudflare without URL", CDNCloudflare, "zone", "token", "", true},
+		{"CloudFront bad token", CDNCloudFront, "distribution", "key", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewCDNPurger(tc.provider, tc.id, tc.token, tc.baseURL)
+			if tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestCDNPurgerCloudflare(t *testing.T) {
+	var requests []string
+	purger, done := testCDN(t, CDNCloudflare, "token", "https://example.com/", &requests)
+	defer done()
+
+	paths := make([]string, 31)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/file %d.txt", i)
+	}
+	if err := purger.Purge(Purge{Paths: paths}); nil != err {
+		t.Fatalf("While purging got %v", err)
+	}
+	if err := purger.PurgeAll(); nil != err {
+		t.Fatalf("While purging all got %v", err)
+	}
+	if 3 != len(requests) {
+		t.Fatalf("Expected 3 requests but got %v", requests)
+	}
+	if !strings.HasPrefix(requests[0], `POST /zones/id/purge_cache {"files":["https://example.com/file%200.txt",`) {
+		t.Errorf("Expected a batch of files but got %s", requests[0])
+	}
+	if expected := `POST /zones/id/purge_cache {"files":["https://example.com/file%2030.txt"]}`; expected != requests[1] {
+		t.Errorf("Expected '%s' but got '%s'", expected, requests[1])
+	}
+	if expected := `POST /zones/id/purge_cache {"purge_everything":true}`; expected != requests[2] {
+		t.Errorf("Expected '%s' but got '%s'", expected, requests[2])
+	}
+}
+
+func TestCDNPurgerFastly(t *testing.T) {
+	var requests []string
+	purger, done := testCDN(t, CDNFastly, "token", "https://example.com", &requests)
+	defer done()
+
+	CDNPurge(purger, "/static", nil)([]string{"/js/app.js"})
+	expected := []string{
+		`POST /service/id/purge {"surrogate_keys":["js"]}`,
+		`POST /purge/example.com/static/js/app.js `,
+	}
+	if strings.Join(expected, "\n") != strings.Join(requests, "\n") {
+		t.Errorf("Expected %v but got %v", expected, requests)
+	}
+
+	purger.id = "fail"
+	if err := purger.PurgeAll(); nil == err {
+		t.Error("With a failed purge expected an error but got nil")
+	}
+}
+
+func TestCDNPurgerCloudFront(t *testing.T) {
+	var requests []string
+	purger, done := testCDN(t, CDNCloudFront, "key:secret", "", &requests)
+	defer done()
+
+	if err := purger.Purge(Purge{Paths: []string{"/index.html"}}); nil != err {
+		t.Fatalf("While purging got %v", err)
+	}
+	expected := "POST /2020-05-31/distribution/id/invalidation " + xmlHeader +
+		`<InvalidationBatch xmlns="http://cloudfront.amazonaws.com/doc/2020-05-31/">` +
+		`<CallerReference>1600000000000000000</CallerReference>` +
+		`<Paths><Quantity>1</Quantity><Items><Path>/index.html</Path></Items></Paths>` +
+		`</InvalidationBatch>`
+	if 1 != len(requests) || expected != requests[0] {
+		t.Errorf("Expected '%s' but got %v", expected, requests)
+	}
+}
+
+// xmlHeader of CloudFront invalidation requests.
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+func TestSignAWS(t *testing.T) {
+	// The 'get-vanilla' case of the AWS Signature Version 4 test suite.
+	req := httptest.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signAWS(
+		req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		"us-east-1", "service", now,
+	)
+	expected := "AWS4-HMAC-SHA256 " +
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if auth := req.Header.Get("Authorization"); expected != auth {
+		t.Errorf("Expected '%s' but got '%s'", expected, auth)
+	}
+}
@@ -0,0 +1,161 @@
+package handle
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CertificateSource returns a certificate chain and its private key, both PEM
+// encoded.
+type CertificateSource func() (certPEM, keyPEM []byte, err error)
+
+// CertificateFiles returns a source reading the certificate and key files,
+// such as those of a mounted Kubernetes TLS secret.
+func CertificateFiles(certFile, keyFile string) CertificateSource {
+	return func() (certPEM, keyPEM []byte, err error) {
+		if certPEM, err = ioutil.ReadFile(certFile); nil != err {
+			return
+		}
+		keyPEM, err = ioutil.ReadFile(keyFile)
+		return
+	}
+}
+
+// VaultCertificate returns a source reading the certificate and key from a
+// HashiCorp Vault secret, such as 'https://vault:8200/v1/secret/data/web' of
+// a KV version 2 engine, authenticated by the token. The secret holds the
+// certificate and key as 'certificate' and 'private_key', as issued by the
+// PKI engine, or as 'tls.crt' and 'tls.key'.
+func VaultCertificate(url, token string) CertificateSource {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return func() (certPEM, keyPEM []byte, err error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if nil != err {
+			return
+		}
+		req.Header.Set("X-Vault-Token", token)
+		resp, err := client.Do(req)
+		if nil != err {
+			return
+		}
+		defer resp.Body.Close()
+		if http.StatusOK != resp.StatusCode {
+			err = fmt.Errorf("Vault secret '%s' returned %s", url, resp.Status)
+			return
+		}
+
+		var secret struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&secret); nil != err {
+			return
+		}
+		// KV version 2 engines nest the secret within its metadata.
+		fields := secret.Data
+		if nested, ok := fields["data"].(map[string]interface{}); ok {
+			fields = nested
+		}
+		for _, names := range [][2]string{{"certificate", "private_key"}, {"tls.crt", "tls.key"}} {
+			cert, _ := fields[names[0]].(string)
+			key, _ := fields[names[1]].(string)
+			if 0 < len(cert) && 0 < len(key) {
+				return []byte(cert), []byte(key), nil
+			}
+		}
+		err = fmt.Errorf(
+			"Vault secret '%s' has neither 'certificate' and 'private_key' "+
+				"nor 'tls.crt' and 'tls.key'", url,
+		)
+		return
+	}
+}
+
+// CertificateReloader serves the certificate of a source, reloading it when
+// the source changes so that rotated certificates are used without a restart.
+type CertificateReloader struct {
+	source CertificateSource
+	mutex  sync.RWMutex
+	cert   *tls.Certificate
+	digest [sha256.Size]byte
+
+	// changed is signalled when the certificate is reloaded.
+	changed chan struct{}
+}
+
+// NewCertificateReloader returns a reloader serving the current certificate
+// of the source.
+func NewCertificateReloader(source CertificateSource) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{source: source, changed: make(chan struct{}, 1)}
+	if _, err := reloader.Reload(); nil != err {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload the certificate from the source, returning true if it changed. The
+// current certificate is kept if the source fails or returns an invalid
+// certificate, such as while the certificate and key are being replaced.
+func (reloader *CertificateReloader) Reload() (bool, error) {
+	certPEM, keyPEM, err := reloader.source()
+	if nil != err {
+		return false, err
+	}
+	digest := sha256.Sum256(append(append([]byte(nil), certPEM...), keyPEM...))
+
+	reloader.mutex.RLock()
+	unchanged := nil != reloader.cert && digest == reloader.digest
+	reloader.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if nil != err {
+		return false, err
+	}
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.cert, reloader.digest = &cert, digest
+	select {
+	case reloader.changed <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// GetCertificate returns the current certificate, for the GetCertificate
+// field of a tls.Config.
+func (reloader *CertificateReloader) GetCertificate(
+	*tls.ClientHelloInfo,
+) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	return reloader.cert, nil
+}
+
+// Watch reloads the certificate every interval until the context is done.
+func (reloader *CertificateReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := reloader.Reload()
+		if nil != err {
+			log.Printf("Error: while reloading the TLS certificate got %v\n", err)
+		} else if changed {
+			log.Printf("Reloaded the TLS certificate\n")
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handle
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testCertificatePEM returns a PEM encoded self-signed certificate and key for
+// the host.
+func testCertificatePEM(t *testing.T, host string) (certPEM, keyPEM []byte) {
+	cert, err := SelfSignedCertificate([]string{host})
+	if nil != err {
+		t.Fatalf("While generating a certificate got %v", err)
+	}
+	der, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if nil != err {
+		t.Fatalf("While encoding the key got %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	return
+}
+
+// servedHost returns the common name of the certificate served by the reloader.
+func servedHost(t *testing.T, reloader *CertificateReloader) string {
+	cert, _ := reloader.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if nil != err {
+		t.Fatalf("While parsing the certificate got %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertificateReloaderFiles(t *testing.T) {
+	folder, err := ioutil.TempDir("", "certs")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	certFile, keyFile := filepath.Join(folder, "tls.crt"), filepath.Join(folder, "tls.key")
+	write := func(certPEM, keyPEM []byte) {
+		ioutil.WriteFile(certFile, certPEM, 0644)
+		ioutil.WriteFile(keyFile, keyPEM, 0600)
+	}
+
+	if _, err = NewCertificateReloader(CertificateFiles(certFile, keyFile)); nil == err {
+		t.Error("Without files expected an error but got nil")
+	}
+	firstCert, firstKey := testCertificatePEM(t, "first.test")
+	write(firstCert, firstKey)
+	reloader, err := NewCertificateReloader(CertificateFiles(certFile, keyFile))
+	if nil != err {
+		t.Fatalf("While loading got %v", err)
+	}
+	if host := servedHost(t, reloader); "first.test" != host {
+		t.Errorf("Expected first.test but got %s", host)
+	}
+
+	if changed, err := reloader.Reload(); changed || nil != err {
+		t.Errorf("Expected no change but got %t and %v", changed, err)
+	}
+
+	// A certificate without its key is refused, keeping the current one.
+	secondCert, secondKey := testCertificatePEM(t, "second.test")
+	write(secondCert, firstKey)
+	if changed, err := reloader.Reload(); changed || nil == err {
+		t.Errorf("With a mismatched key expected an error but got %t and %v", changed, err)
+	}
+	if host := servedHost(t, reloader); "first.test" != host {
+		t.Errorf("Expected first.test to be kept but got %s", host)
+	}
+
+	write(secondCert, secondKey)
+	if changed, err := reloader.Reload(); !changed || nil != err {
+		t.Errorf("Expected a change but got %t and %v", changed, err)
+	}
+	if host := servedHost(t, reloader); "second.test" != host {
+		t.Errorf("Expected second.test but got %s", host)
+	}
+}
+
+func TestVaultCertificate(t *testing.T) {
+	certPEM, keyPEM := testCertificatePEM(t, "vault.test")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "vault-token" != r.Header.Get("X-Vault-Token") {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		fields := map[string]string{"certificate": string(certPEM), "private_key": string(keyPEM)}
+		var secret interface{}
+		switch r.URL.Path {
+		case "/v1/secret/data/web":
+			secret = map[string]interface{}{"data": map[string]interface{}{"data": fields}}
+		case "/v1/kv/web":
+			secret = map[string]interface{}{"data": map[string]string{
+				"tls.crt": string(certPEM), "tls.key": string(keyPEM),
+			}}
+		default:
+			secret = map[string]interface{}{"data": map[string]string{"other": "value"}}
+		}
+		json.NewEncoder(w).Encode(secret)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		path    string
+		token   string
+		isError bool
+	}{
+		{"KV version 2", "/v1/secret/data/web", "vault-token", false},
+		{"KV version 1", "/v1/kv/web", "vault-token", false},
+		{"Wrong token", "/v1/secret/data/web", "guess", true},
+		{"Missing fields", "/v1/kv/other", "vault-token", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reloader, err := NewCertificateReloader(VaultCertificate(server.URL+tc.path, tc.token))
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if !tc.isError && "vault.test" != servedHost(t, reloader) {
+				t.Errorf("Expected vault.test but got %s", servedHost(t, reloader))
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// checksumAlgorithms supported by WithChecksums, keyed by file extension.
+	checksumAlgorithms = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// checksumEntry caches the checksums of a file while it remains unchanged.
+type checksumEntry struct {
+	size    int64
+	modTime time.Time
+	sums    map[string]string
+}
+
+// checksumCache of computed checksums keyed by name, appending each computed
+// checksum to the state file if there is one.
+type checksumCache struct {
+	mutex      sync.Mutex
+	entries    map[string]checksumEntry
+	stateMutex sync.Mutex
+	state      *os.File
+	encoder    *json.Encoder
+}
+
+// checksumRecord of a computed checksum in a state file.
+type checksumRecord struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Algorithm string    `json:"algorithm"`
+	Sum       string    `json:"sum"`
+}
+
+// ChecksumIndex of the checksums of the files of a storage for the enabled
+// algorithms. Checksums are computed when first requested, or ahead of time by
+// Precompute, and kept until the file changes.
+type ChecksumIndex struct {
+	storage    Storage
+	algorithms []string
+	enabled    map[string]struct{}
+	cache      *checksumCache
+}
+
+// ValidChecksumAlgorithm returns true if the algorithm is supported by
+// WithChecksums.
+func ValidChecksumAlgorithm(algorithm string) bool {
+	_, ok := checksumAlgorithms[algorithm]
+	return ok
+}
+
+// NewChecksumIndex returns an empty index of the checksums of the files of the
+// storage. Unsupported algorithms are ignored.
+func NewChecksumIndex(storage Storage, algorithms []string) *ChecksumIndex {
+	index := &ChecksumIndex{
+		storage: storage,
+		enabled: make(map[string]struct{}, len(algorithms)),
+		cache:   newChecksumCache(),
+	}
+	for _, algorithm := range algorithms {
+		if _, found := index.enabled[algorithm]; !found &&
+			ValidChecksumAlgorithm(algorithm) {
+			index.enabled[algorithm] = struct{}{}
+			index.algorithms = append(index.algorithms, algorithm)
+		}
+	}
+	return index
+}
+
+// Persist the computed checksums to the state file, first loading those it
+// already holds. Checksums are appended as they are computed, so an
+// interrupted Precompute resumes where it stopped after a restart. Checksums
+// of files changed since they were persisted are computed again when needed.
+func (index *ChecksumIndex) Persist(filename string) error {
+	return index.cache.persist(filename)
+}
+
+// Close the state file, if any.
+func (index *ChecksumIndex) Close() error {
+	cache := index.cache
+	cache.stateMutex.Lock()
+	defer cache.stateMutex.Unlock()
+	if nil == cache.state {
+		return nil
+	}
+	err := cache.state.Close()
+	cache.state, cache.encoder = nil, nil
+	return err
+}
+
+// Precompute the checksums of every file in the storage with the number of
+// workers, so a large storage is hashed without using every CPU, until done
+// or the context is done. Checksums already computed for unchanged files are
+// kept. It returns the number of files indexed and the first error computing
+// a checksum, continuing with the other files.
+func (index *ChecksumIndex) Precompute(ctx context.Context, workers int) (int, error) {
+	if 1 > workers {
+		workers = 1
+	}
+	type file struct {
+		name string
+		info os.FileInfo
+	}
+	files := make(chan file)
+	var mutex sync.Mutex
+	var indexed int
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				var err error
+				for _, algorithm := range index.algorithms {
+					if _, err = index.cache.get(
+						index.storage, f.name, f.info, algorithm,
+					); nil != err {
+						break
+					}
+				}
+				mutex.Lock()
+				if nil == err {
+					indexed++
+				} else if nil == firstErr {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	walkStorage(index.storage, "/", func(name string, info os.FileInfo, err error) error {
+		if nil != err || info.IsDir() {
+			return ctx.Err()
+		}
+		select {
+		case files <- file{name, info}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(files)
+	wg.Wait()
+	return indexed, firstErr
+}
+
+// WithChecksums wraps an HTTP request. Requests for '/path/file.ext.<alg>',
+// where alg is one of the passed algorithms, return the checksum of
+// '/path/file.ext' in the format produced by tools like 'sha256sum'. Checksum
+// files existing in the storage are served as-is. Computed checksums are cached
+// until the file changes. Requests are resolved to files in the storage by
+// removing urlPrefix in the same way as Prefix.
+func WithChecksums(
+	serve http.HandlerFunc,
+	storage Storage,
+	urlPrefix string,
+	algorithms []string,
+) http.HandlerFunc {
+	return WithChecksumIndex(serve, NewChecksumIndex(storage, algorithms), urlPrefix)
+}
+
+// WithChecksumIndex wraps an HTTP request in the same way as WithChecksums,
+// serving checksums from the index.
+func WithChecksumIndex(
+	serve http.HandlerFunc, index *ChecksumIndex, urlPrefix string,
+) http.HandlerFunc {
+	storage, cache := index.storage, index.cache
+	return func(w http.ResponseWriter, r *http.Request) {
+		extension := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+		_, ok := index.enabled[extension]
+		if !ok || !strings.HasPrefix(r.URL.Path, urlPrefix) {
+			serve(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, urlPrefix)
+		if _, err := storage.Stat(name); nil == err {
+			serve(w, r)
+			return
+		}
+
+		// The checksum file does not exist so the checksum of the
+		// corresponding file is computed.
+		target := strings.TrimSuffix(name, "."+extension)
+		info, err := storage.Stat(target)
+		if nil != err || info.IsDir() {
+			serve(w, r)
+			return
+		}
+
+		sum, err := cache.get(storage, target, info, extension)
+		if nil != err {
+			log.Printf("Error: while computing checksum of %s got %v\n", target, err)
+			http.Error(
+				w,
+				"500 internal server error",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+
+		contents := fmt.Sprintf("%s  %s\n", sum, path.Base(target))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeContent(
+			w, r, r.URL.Path, info.ModTime(), bytes.NewReader([]byte(contents)),
+		)
+	}
+}
+
+// newChecksumCache returns an empty cache.
+func newChecksumCache() *checksumCache {
+	return &checksumCache{entries: make(map[string]checksumEntry)}
+}
+
+// get the checksum of the file in the storage using the algorithm, computing it
+// if the file has changed since it was last computed.
+func (cache *checksumCache) get(
+	storage Storage, name string, info os.FileInfo, algorithm string,
+) (sum string, err error) {
+	// Cached checksums are discarded once the file changes.
+	cache.mutex.Lock()
+	entry, found := cache.entries[name]
+	if !found || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		entry = checksumEntry{info.Size(), info.ModTime(), map[string]string{}}
+		cache.entries[name] = entry
+	}
+	sum, found = entry.sums[algorithm]
+	cache.mutex.Unlock()
+	if found {
+		return
+	}
+
+	sum, err = checksum(storage, name, checksumAlgorithms[algorithm]())
+	if nil != err {
+		return
+	}
+	cache.mutex.Lock()
+	entry.sums[algorithm] = sum
+	cache.mutex.Unlock()
+	cache.record(checksumRecord{name, entry.size, entry.modTime, algorithm, sum})
+	return
+}
+
+// persist computed checksums to the state file. Checksums in the file are
+// loaded and the file is rewritten without superseded records, so it does not
+// grow without bound across restarts. Reading stops at a damaged record, such
+// as one partly written when the server stopped.
+func (cache *checksumCache) persist(filename string) error {
+	var records []checksumRecord
+	if file, err := os.Open(filename); nil == err {
+		decoder := json.NewDecoder(file)
+		for {
+			var record checksumRecord
+			if err := decoder.Decode(&record); nil != err {
+				break
+			}
+			records = append(records, record)
+		}
+		file.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	cache.mutex.Lock()
+	for _, record := range records {
+		if !ValidChecksumAlgorithm(record.Algorithm) {
+			continue
+		}
+		entry, found := cache.entries[record.Name]
+		if !found || entry.size != record.Size || !entry.modTime.Equal(record.ModTime) {
+			entry = checksumEntry{record.Size, record.ModTime, map[string]string{}}
+			cache.entries[record.Name] = entry
+		}
+		entry.sums[record.Algorithm] = record.Sum
+	}
+	records = records[:0]
+	for name, entry := range cache.entries {
+		for algorithm, sum := range entry.sums {
+			records = append(records, checksumRecord{
+				name, entry.size, entry.modTime, algorithm, sum,
+			})
+		}
+	}
+	cache.mutex.Unlock()
+
+	// Replace the file with the current records and append to it after.
+	temporary := filename + ".tmp"
+	file, err := os.OpenFile(temporary, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if nil != err {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, record := range records {
+		if err = encoder.Encode(record); nil != err {
+			break
+		}
+	}
+	if nil == err {
+		err = os.Rename(temporary, filename)
+	}
+	if nil != err {
+		file.Close()
+		os.Remove(temporary)
+		return err
+	}
+
+	cache.stateMutex.Lock()
+	defer cache.stateMutex.Unlock()
+	if nil != cache.state {
+		cache.state.Close()
+	}
+	cache.state, cache.encoder = file, encoder
+	return nil
+}
+
+// record the computed checksum in the state file, if there is one.
+func (cache *checksumCache) record(record checksumRecord) {
+	cache.stateMutex.Lock()
+	defer cache.stateMutex.Unlock()
+	if nil == cache.encoder {
+		return
+	}
+	if err := cache.encoder.Encode(record); nil != err {
+		log.Printf("Error: while persisting checksum of %s got %v\n", record.Name, err)
+	}
+}
+
+// checksum returns the hex-encoded hash of the file contents.
+func checksum(storage Storage, name string, h hash.Hash) (string, error) {
+	file, err := storage.Open(name)
+	if nil != err {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err = copyBuffer(h, file); nil != err {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
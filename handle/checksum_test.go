@@ -0,0 +1,197 @@
+package handle
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithChecksums(t *testing.T) {
+	// Known checksums of the contents of tmpFile.
+	md5Sum := "afb0ad22a461854f267df2b86b9d2e1d"
+	sha256Sum := "8308ebec1877060358a1062ae1c08f8c139e55b32a86bc3d7290bc6604a54d52"
+
+	existingName := baseDir + tmpFileName + ".sha1"
+	existing := "existing checksum file\n"
+	if err := ioutil.WriteFile(existingName, []byte(existing), 0600); nil != err {
+		t.Fatalf("While writing checksum file got %v", err)
+	}
+	defer os.Remove(existingName)
+
+	prefix := "/my/prefix"
+	algorithms := []string{"md5", "sha1", "sha256", "unknown"}
+
+	testCases := []struct {
+		name     string
+		path     string
+		code     int
+		contents string
+	}{
+		{"MD5", "/" + tmpFileName + ".md5", ok, md5Sum + "  file.txt\n"},
+		{"SHA256", "/" + tmpFileName + ".sha256", ok, sha256Sum + "  file.txt\n"},
+		{"SHA256 cached", "/" + tmpFileName + ".sha256", ok, sha256Sum + "  file.txt\n"},
+		{"Not enabled", "/" + tmpFileName + ".sha512", missing, notFound},
+		{"Existing file", "/" + tmpFileName + ".sha1", ok, existing},
+		{"Missing file", "/" + tmpBadName + ".sha256", missing, notFound},
+		{"Directory", "/sub.sha256", missing, notFound},
+		{"Plain file", "/" + tmpFileName, ok, tmpFile},
+	}
+
+	for _, usePrefix := range []bool{false, true} {
+		handler := Basic(http.ServeFile, baseDir)
+		urlPrefix := ""
+		if usePrefix {
+			handler = Prefix(http.ServeFile, baseDir, prefix)
+			urlPrefix = prefix
+		}
+		handler = WithChecksums(handler, Dir(baseDir), urlPrefix, algorithms)
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				fullpath := "http://localhost" + urlPrefix + tc.path
+				req := httptest.NewRequest("GET", fullpath, nil)
+				w := httptest.NewRecorder()
+
+				handler(w, req)
+
+				if tc.code != w.Code {
+					t.Errorf(
+						"While retrieving %s expected status code of %d but got %d",
+						fullpath, tc.code, w.Code,
+					)
+				}
+				if contents := w.Body.String(); tc.contents != contents {
+					t.Errorf(
+						"While retrieving %s expected contents '%s' but got '%s'",
+						fullpath, tc.contents, contents,
+					)
+				}
+			})
+		}
+	}
+}
+
+func TestWithChecksumsChangedFile(t *testing.T) {
+	name := baseDir + "changing.txt"
+	if err := ioutil.WriteFile(name, []byte("first"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	defer os.Remove(name)
+
+	handler := WithChecksums(
+		Basic(http.ServeFile, baseDir), Dir(baseDir), "", []string{"md5"},
+	)
+	retrieve := func() string {
+		req := httptest.NewRequest("GET", "http://localhost/changing.txt.md5", nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Body.String()
+	}
+
+	first := retrieve()
+	if err := ioutil.WriteFile(name, []byte("second"), 0600); nil != err {
+		t.Fatalf("While rewriting file got %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(name, later, later); nil != err {
+		t.Fatalf("While changing file time got %v", err)
+	}
+	if second := retrieve(); first == second {
+		t.Errorf("Expected checksum to change but got '%s' both times", first)
+	}
+}
+
+func TestValidChecksumAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"md5", "sha1", "sha256", "sha512"} {
+		if !ValidChecksumAlgorithm(algorithm) {
+			t.Errorf("Expected %s to be valid", algorithm)
+		}
+	}
+	if ValidChecksumAlgorithm("crc32") {
+		t.Error("Expected crc32 to be invalid")
+	}
+}
+
+func TestChecksumIndexPrecompute(t *testing.T) {
+	folder, err := ioutil.TempDir("", "checksums")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	files := folder + "/files"
+	if err := os.MkdirAll(files+"/sub", 0700); nil != err {
+		t.Fatalf("While creating folders got %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "sub/c.txt"} {
+		if err := ioutil.WriteFile(files+"/"+name, []byte(name), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+	state := folder + "/checksums.json"
+	algorithms := []string{"md5", "sha256", "md5", "unknown"}
+
+	index := NewChecksumIndex(Dir(files), algorithms)
+	if err := index.Persist(state); nil != err {
+		t.Fatalf("While persisting got %v", err)
+	}
+	indexed, err := index.Precompute(context.Background(), 2)
+	if 3 != indexed || nil != err {
+		t.Errorf("Expected 3 files indexed without error but got %d and %v", indexed, err)
+	}
+	if err := index.Close(); nil != err {
+		t.Errorf("While closing got %v", err)
+	}
+
+	// A damaged last record, as when stopped while writing, is ignored.
+	file, err := os.OpenFile(state, os.O_WRONLY|os.O_APPEND, 0600)
+	if nil != err {
+		t.Fatalf("While opening state got %v", err)
+	}
+	file.WriteString(`{"name":"/a.t`)
+	file.Close()
+
+	// Persisted checksums are loaded and the state is rewritten without
+	// damaged or superseded records.
+	restarted := NewChecksumIndex(Dir(files), algorithms)
+	if err := restarted.Persist(state); nil != err {
+		t.Fatalf("While loading persisted checksums got %v", err)
+	}
+	defer restarted.Close()
+	if 3 != len(restarted.cache.entries) {
+		t.Errorf("Expected 3 loaded files but got %d", len(restarted.cache.entries))
+	}
+	for name, entry := range restarted.cache.entries {
+		if 2 != len(entry.sums) {
+			t.Errorf("Expected 2 checksums of %s but got %v", name, entry.sums)
+		}
+	}
+	contents, err := ioutil.ReadFile(state)
+	if nil != err {
+		t.Fatalf("While reading state got %v", err)
+	}
+	if lines := strings.Count(string(contents), "\n"); 6 != lines {
+		t.Errorf("Expected 6 records but got %d", lines)
+	}
+
+	// Served checksums come from the index.
+	handler := WithChecksumIndex(Basic(http.ServeFile, files), restarted, "")
+	req := httptest.NewRequest("GET", "http://localhost/sub/c.txt.md5", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	expected := restarted.cache.entries["/sub/c.txt"].sums["md5"] + "  c.txt\n"
+	if expected != w.Body.String() {
+		t.Errorf("Expected '%s' but got '%s'", expected, w.Body.String())
+	}
+
+	// Nothing is indexed once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if indexed, _ := NewChecksumIndex(Dir(files), algorithms).Precompute(ctx, 1); 0 != indexed {
+		t.Errorf("Expected nothing indexed but got %d", indexed)
+	}
+}
@@ -0,0 +1,92 @@
+package handle
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ContentTypeRule sets the 'Content-Type' of files matching Pattern, either a
+// URL path such as '/.well-known/apple-app-site-association' or, if it does
+// not begin with '/', the name of files in any folder such as 'Caddyfile'.
+type ContentTypeRule struct {
+	Pattern     string
+	ContentType string
+}
+
+// ParseContentTypeRule converts a rule in the form 'pattern=type' into a
+// ContentTypeRule, where type is a media type such as
+// 'text/plain; charset=utf-8'.
+func ParseContentTypeRule(rule string) (parsed ContentTypeRule, err error) {
+	index := strings.Index(rule, "=")
+	if 0 >= index {
+		err = fmt.Errorf("invalid content type rule '%s', expected 'pattern=type'", rule)
+		return
+	}
+	parsed.Pattern = strings.TrimSpace(rule[:index])
+	parsed.ContentType = strings.TrimSpace(rule[index+1:])
+	if strings.HasSuffix(parsed.Pattern, "/") {
+		err = fmt.Errorf("invalid pattern '%s' in content type rule '%s'", parsed.Pattern, rule)
+		return
+	}
+	if _, _, typeErr := mime.ParseMediaType(parsed.ContentType); nil != typeErr {
+		err = fmt.Errorf("invalid content type in rule '%s': %v", rule, typeErr)
+	}
+	return
+}
+
+// ParseContentTypeRules converts each rule using ParseContentTypeRule.
+func ParseContentTypeRules(rules []string) ([]ContentTypeRule, error) {
+	parsed := make([]ContentTypeRule, 0, len(rules))
+	for _, rule := range rules {
+		result, err := ParseContentTypeRule(rule)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// String representation of the rule in the form accepted by
+// ParseContentTypeRule.
+func (rule ContentTypeRule) String() string {
+	return fmt.Sprintf("%s=%s", rule.Pattern, rule.ContentType)
+}
+
+// WithContentTypes wraps an HTTP request. GET and HEAD requests for files
+// matching a rule are served with its content type rather than one guessed
+// from the extension or sniffed from the contents, which is often wrong for
+// files without extensions. Rules for URL paths take priority over rules for
+// names and later rules over earlier rules. All other requests are passed
+// through.
+func WithContentTypes(serve http.HandlerFunc, rules []ContentTypeRule) http.HandlerFunc {
+	// Header values are shared by every response, as with WithHeaders.
+	byPath := make(map[string][]string)
+	byName := make(map[string][]string)
+	for _, rule := range rules {
+		if strings.HasPrefix(rule.Pattern, "/") {
+			byPath[rule.Pattern] = []string{rule.ContentType}
+		} else {
+			byName[rule.Pattern] = []string{rule.ContentType}
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet != r.Method && http.MethodHead != r.Method ||
+			strings.HasSuffix(r.URL.Path, "/") {
+			serve(w, r)
+			return
+		}
+		values, ok := byPath[r.URL.Path]
+		if !ok {
+			values, ok = byName[path.Base(r.URL.Path)]
+		}
+		if ok {
+			Tracef(r, "content type set to '%s'", values[0])
+			w.Header()["Content-Type"] = values
+		}
+		serve(w, r)
+	}
+}
@@ -0,0 +1,96 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseContentTypeRule(t *testing.T) {
+	testCases := []struct {
+		name        string
+		rule        string
+		pattern     string
+		contentType string
+		isError     bool
+	}{
+		{"Name", "Caddyfile=text/plain; charset=utf-8", "Caddyfile", "text/plain; charset=utf-8", false},
+		{"Path", "/.well-known/apple-app-site-association = application/json",
+			"/.well-known/apple-app-site-association", "application/json", false},
+		{"No pattern", "=text/plain", "", "", true},
+		{"Folder", "/docs/=text/plain", "", "", true},
+		{"Bad type", "Caddyfile=text plain", "", "", true},
+		{"No type", "Caddyfile=", "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseContentTypeRule(tc.rule)
+			if tc.isError {
+				if nil == err {
+					t.Errorf("For '%s' expected an error but got nil", tc.rule)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("For '%s' expected no error but got %v", tc.rule, err)
+			}
+			if tc.pattern != rule.Pattern || tc.contentType != rule.ContentType {
+				t.Errorf(
+					"For '%s' expected '%s' as '%s' but got '%s' as '%s'",
+					tc.rule, tc.pattern, tc.contentType, rule.Pattern, rule.ContentType,
+				)
+			}
+		})
+	}
+
+	if _, err := ParseContentTypeRules([]string{"LICENSE=text/plain", "="}); nil == err {
+		t.Error("For a list with a bad rule expected an error but got nil")
+	}
+}
+
+func TestWithContentTypes(t *testing.T) {
+	rules, err := ParseContentTypeRules([]string{
+		"Caddyfile=text/caddyfile",
+		"LICENSE=text/plain",
+		"LICENSE=text/plain; charset=utf-8",
+		"/docs/LICENSE=text/markdown",
+	})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		if "" == w.Header().Get("Content-Type") {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.Write([]byte("served"))
+	}
+	handler := WithContentTypes(serve, rules)
+
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+	}{
+		{"Name", "GET", "/config/Caddyfile", "text/caddyfile"},
+		{"Later rule", "HEAD", "/LICENSE", "text/plain; charset=utf-8"},
+		{"Path over name", "GET", "/docs/LICENSE", "text/markdown"},
+		{"Other file", "GET", "/config/Makefile", "application/octet-stream"},
+		{"Folder", "GET", "/Caddyfile/", "application/octet-stream"},
+		{"Other method", "POST", "/config/Caddyfile", "application/octet-stream"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if contentType := w.Header().Get("Content-Type"); tc.contentType != contentType {
+				t.Errorf("For %s expected type '%s' but got '%s'", tc.path, tc.contentType, contentType)
+			}
+		})
+	}
+}
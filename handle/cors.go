@@ -0,0 +1,145 @@
+package handle
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CORS presets accepted by ParseCORSRule in place of a list of origins.
+const (
+	// CORSOpen allows requests from any origin.
+	CORSOpen = "open"
+	// CORSNone sets no CORS headers, so browsers refuse cross-origin requests.
+	CORSNone = "none"
+)
+
+// CORSRule is the CORS policy of requests for paths beginning with Prefix.
+// Requests from the Origins are allowed, from any origin if Origins is '*' or
+// from no other origin if Origins is empty.
+type CORSRule struct {
+	Prefix  string
+	Origins []string
+}
+
+// ParseCORSRule converts a rule in the form '[/path/prefix=]policy' into a
+// CORSRule, where policy is 'open', 'none' or space-separated 'http://' and
+// 'https://' origins. If no prefix is provided then the rule applies to all
+// paths.
+func ParseCORSRule(rule string) (parsed CORSRule, err error) {
+	parsed.Prefix = "/"
+	policy := rule
+	if strings.HasPrefix(rule, "/") {
+		if index := strings.Index(rule, "="); 0 < index {
+			parsed.Prefix = rule[:index]
+			policy = rule[index+1:]
+		}
+	}
+
+	origins := strings.Fields(policy)
+	switch {
+	case 0 == len(origins):
+		err = fmt.Errorf(
+			"invalid CORS rule '%s', expected '[/path/prefix=]policy'", rule,
+		)
+	case 1 == len(origins) && (CORSOpen == origins[0] || "*" == origins[0]):
+		parsed.Origins = []string{"*"}
+	case 1 == len(origins) && CORSNone == origins[0]:
+	default:
+		for _, origin := range origins {
+			if !strings.HasPrefix(origin, "http://") &&
+				!strings.HasPrefix(origin, "https://") {
+				err = fmt.Errorf("invalid origin '%s' in CORS rule '%s'", origin, rule)
+				return
+			}
+			parsed.Origins = append(parsed.Origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return
+}
+
+// ParseCORSRules converts each rule using ParseCORSRule.
+func ParseCORSRules(rules []string) ([]CORSRule, error) {
+	parsed := make([]CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		result, err := ParseCORSRule(rule)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// String representation of the rule in the form accepted by ParseCORSRule.
+func (rule CORSRule) String() string {
+	policy := strings.Join(rule.Origins, " ")
+	switch policy {
+	case "":
+		policy = CORSNone
+	case "*":
+		policy = CORSOpen
+	}
+	return fmt.Sprintf("%s=%s", rule.Prefix, policy)
+}
+
+// allows returns the value of the 'Access-Control-Allow-Origin' header for
+// requests from the origin, or an empty string if the origin is not allowed.
+func (rule CORSRule) allows(origin string) string {
+	for _, allowed := range rule.Origins {
+		if "*" == allowed {
+			return allowed
+		}
+		if allowed == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+// WithCORS wraps an HTTP request. The rule with the longest prefix of the
+// requested path decides whether the origin of the request may read the
+// response, so permissive policies for fonts or WebAssembly can sit beside
+// locked down policies for pages. CORS preflight requests from allowed origins
+// are answered for GET and HEAD requests with any headers. Requests without an
+// applicable rule are served unchanged.
+func WithCORS(serve http.HandlerFunc, rules []CORSRule) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rule *CORSRule
+		for i := range rules {
+			if strings.HasPrefix(r.URL.Path, rules[i].Prefix) &&
+				(nil == rule || len(rule.Prefix) < len(rules[i].Prefix)) {
+				rule = &rules[i]
+			}
+		}
+		if nil == rule || 0 == len(rule.Origins) {
+			serve(w, r)
+			return
+		}
+
+		header := w.Header()
+		if "*" != rule.Origins[0] {
+			header.Add("Vary", "Origin")
+		}
+		origin := r.Header.Get("Origin")
+		allowed := rule.allows(origin)
+		if 0 == len(origin) || 0 == len(allowed) {
+			serve(w, r)
+			return
+		}
+		header.Set("Access-Control-Allow-Origin", allowed)
+		if http.MethodOptions == r.Method &&
+			0 < len(r.Header.Get("Access-Control-Request-Method")) {
+			Tracef(r, "CORS preflight from '%s' allowed by rule '%s'", origin, rule)
+			header.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			if requested := r.Header.Get("Access-Control-Request-Headers"); 0 < len(requested) {
+				header.Set("Access-Control-Allow-Headers", requested)
+			}
+			header.Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		header.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, ETag")
+		serve(w, r)
+	}
+}
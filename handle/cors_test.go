@@ -0,0 +1,122 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCORSRule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    string
+		parsed  string
+		isError bool
+	}{
+		{"Open", "open", "/=open", false},
+		{"Any origin", "/fonts=*", "/fonts=open", false},
+		{"None", "/admin=none", "/admin=none", false},
+		{"Origins", "/app=https://a.example.com https://b.example.com/",
+			"/app=https://a.example.com https://b.example.com", false},
+		{"Empty policy", "/app=", "", true},
+		{"Bad origin", "/app=a.example.com", "", true},
+		{"Mixed preset", "/app=open https://a.example.com", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseCORSRule(tc.rule)
+			if tc.isError {
+				if nil == err {
+					t.Errorf("For '%s' expected an error but got nil", tc.rule)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("For '%s' expected no error but got %v", tc.rule, err)
+			}
+			if tc.parsed != rule.String() {
+				t.Errorf("For '%s' expected '%s' but got '%s'", tc.rule, tc.parsed, rule)
+			}
+		})
+	}
+
+	if _, err := ParseCORSRules([]string{"open", "/app="}); nil == err {
+		t.Error("For a list with a bad rule expected an error but got nil")
+	}
+}
+
+func TestWithCORS(t *testing.T) {
+	rules, err := ParseCORSRules([]string{
+		"https://app.example.com",
+		"/fonts=open",
+		"/cdn=open",
+		"/cdn/private=none",
+	})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	served := false
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		served = true
+		w.Write([]byte("served"))
+	}
+	handler := WithCORS(serve, rules)
+
+	testCases := []struct {
+		name    string
+		method  string
+		path    string
+		origin  string
+		code    int
+		allowed string
+		vary    string
+		served  bool
+	}{
+		{"Open font", "GET", "/fonts/a.woff2", "https://other.example.com", ok, "*", "", true},
+		{"Open CDN", "GET", "/cdn/app.wasm", "https://other.example.com", ok, "*", "", true},
+		{"Locked down prefix", "GET", "/cdn/private/a.js", "https://app.example.com", ok, "", "", true},
+		{"Allowed origin", "GET", "/index.html", "https://app.example.com", ok,
+			"https://app.example.com", "Origin", true},
+		{"Other origin", "GET", "/index.html", "https://other.example.com", ok, "", "Origin", true},
+		{"No origin", "GET", "/index.html", "", ok, "", "Origin", true},
+		{"Preflight", "OPTIONS", "/fonts/a.woff2", "https://other.example.com",
+			http.StatusNoContent, "*", "", false},
+		{"Refused preflight", "OPTIONS", "/index.html", "https://other.example.com",
+			ok, "", "Origin", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			served = false
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			if 0 < len(tc.origin) {
+				req.Header.Set("Origin", tc.origin)
+			}
+			if http.MethodOptions == tc.method {
+				req.Header.Set("Access-Control-Request-Method", "GET")
+				req.Header.Set("Access-Control-Request-Headers", "range")
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("For %s expected status code %d but got %d", tc.path, tc.code, w.Code)
+			}
+			if allowed := w.Header().Get("Access-Control-Allow-Origin"); tc.allowed != allowed {
+				t.Errorf("For %s expected allowed origin '%s' but got '%s'", tc.path, tc.allowed, allowed)
+			}
+			if vary := w.Header().Get("Vary"); tc.vary != vary {
+				t.Errorf("For %s expected Vary '%s' but got '%s'", tc.path, tc.vary, vary)
+			}
+			if tc.served != served {
+				t.Errorf("For %s expected served to be %t", tc.path, tc.served)
+			}
+			if http.StatusNoContent == tc.code &&
+				"range" != w.Header().Get("Access-Control-Allow-Headers") {
+				t.Errorf("For %s expected the requested headers to be allowed", tc.path)
+			}
+		})
+	}
+}
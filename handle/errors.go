@@ -0,0 +1,73 @@
+package handle
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+var (
+	// ErrNotFound is matched by errors for 'NOT FOUND' and 'GONE' responses.
+	ErrNotFound = errors.New("not found")
+
+	// ErrForbidden is matched by errors for 'UNAUTHORIZED' and 'FORBIDDEN'
+	// responses.
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrListenerClosed is returned when serving stops because the listener
+	// or server was closed.
+	ErrListenerClosed = errors.New("listener closed")
+)
+
+// StatusError is the error of a client or server error response.
+type StatusError struct {
+	Status int
+}
+
+// Error returns the status code and text.
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("%d %s", err.Status, http.StatusText(err.Status))
+}
+
+// Is reports whether the status matches the target sentinel error.
+func (err *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return http.StatusNotFound == err.Status ||
+			http.StatusGone == err.Status
+	case ErrForbidden:
+		return http.StatusUnauthorized == err.Status ||
+			http.StatusForbidden == err.Status
+	}
+	return false
+}
+
+// closedError wraps the cause of serving stopping, matching ErrListenerClosed.
+type closedError struct {
+	cause error
+}
+
+// Error returns the message of the cause.
+func (err *closedError) Error() string {
+	return ErrListenerClosed.Error() + ": " + err.cause.Error()
+}
+
+// Is reports whether the target is ErrListenerClosed.
+func (err *closedError) Is(target error) bool {
+	return ErrListenerClosed == target
+}
+
+// Unwrap returns the cause.
+func (err *closedError) Unwrap() error {
+	return err.cause
+}
+
+// listenerError wraps errors caused by the listener or server being closed so
+// that they match ErrListenerClosed, leaving other errors unchanged.
+func listenerError(err error) error {
+	if errors.Is(err, http.ErrServerClosed) || errors.Is(err, net.ErrClosed) {
+		return &closedError{cause: err}
+	}
+	return err
+}
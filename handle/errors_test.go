@@ -0,0 +1,63 @@
+package handle
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	testCases := []struct {
+		status    int
+		message   string
+		notFound  bool
+		forbidden bool
+	}{
+		{http.StatusNotFound, "404 Not Found", true, false},
+		{http.StatusGone, "410 Gone", true, false},
+		{http.StatusUnauthorized, "401 Unauthorized", false, true},
+		{http.StatusForbidden, "403 Forbidden", false, true},
+		{http.StatusInternalServerError, "500 Internal Server Error", false, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.message, func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &StatusError{Status: tc.status})
+			if msg := err.Error(); "wrapped: "+tc.message != msg {
+				t.Errorf("Expected message 'wrapped: %s' but got '%s'", tc.message, msg)
+			}
+			if notFound := errors.Is(err, ErrNotFound); tc.notFound != notFound {
+				t.Errorf("Expected not found %t but got %t", tc.notFound, notFound)
+			}
+			if forbidden := errors.Is(err, ErrForbidden); tc.forbidden != forbidden {
+				t.Errorf("Expected forbidden %t but got %t", tc.forbidden, forbidden)
+			}
+		})
+	}
+}
+
+func TestListenerError(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		closed bool
+	}{
+		{"Server closed", http.ErrServerClosed, true},
+		{"Listener closed", &net.OpError{Op: "accept", Err: net.ErrClosed}, true},
+		{"Other", errors.New("random problem"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := listenerError(tc.err)
+			if closed := errors.Is(err, ErrListenerClosed); tc.closed != closed {
+				t.Errorf("Expected closed %t but got %t", tc.closed, closed)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected %v to be wrapped but got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Strategies for generating ETags with WithETag.
+const (
+	// ETagNone sends no ETag.
+	ETagNone = "none"
+	// ETagWeak derives a weak ETag from the modification time and size of the
+	// file, which is cheap but changes whenever a deploy touches the file.
+	ETagWeak = "weak"
+	// ETagStrong uses the SHA-256 hash of the contents of the file, which is
+	// stable across deploys that rewrite unchanged files.
+	ETagStrong = "strong"
+	// ETagManifest uses the ETags listed in a manifest produced by the deploy
+	// pipeline.
+	ETagManifest = "manifest"
+)
+
+// ValidETagStrategy returns true if the strategy is supported by WithETag.
+func ValidETagStrategy(strategy string) bool {
+	switch strategy {
+	case ETagNone, ETagWeak, ETagStrong, ETagManifest:
+		return true
+	}
+	return false
+}
+
+// LoadETagManifest reads a JSON object mapping file paths, such as
+// '/js/app.js', to their ETags.
+func LoadETagManifest(filename string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if nil != err {
+		return nil, err
+	}
+	manifest := make(map[string]string)
+	if err = json.Unmarshal(contents, &manifest); nil != err {
+		return nil, fmt.Errorf("invalid ETag manifest '%s': %v", filename, err)
+	}
+	return manifest, nil
+}
+
+// WithETag wraps an HTTP request. Responses for files are given an ETag using
+// the strategy, so conditional and Range requests are answered by comparing
+// them. With the manifest strategy, files missing from the manifest have no
+// ETag. Requests are resolved to files in the storage by removing urlPrefix in
+// the same way as Prefix.
+func WithETag(
+	serve http.HandlerFunc,
+	storage Storage,
+	urlPrefix string,
+	strategy string,
+	manifest map[string]string,
+) http.HandlerFunc {
+	cache := newChecksumCache()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ETagNone == strategy ||
+			(http.MethodGet != r.Method && http.MethodHead != r.Method) ||
+			!strings.HasPrefix(r.URL.Path, urlPrefix) {
+			serve(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, urlPrefix)
+		info, err := storage.Stat(name)
+		if nil != err || info.IsDir() {
+			serve(w, r)
+			return
+		}
+
+		var etag string
+		switch strategy {
+		case ETagWeak:
+			etag = fmt.Sprintf(
+				`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size(),
+			)
+		case ETagStrong:
+			if sum, err := cache.get(storage, name, info, "sha256"); nil == err {
+				etag = `"` + sum + `"`
+			}
+		case ETagManifest:
+			if etag = manifest[name]; 0 < len(etag) &&
+				!strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+				etag = `"` + etag + `"`
+			}
+		}
+		if 0 < len(etag) {
+			w.Header().Set("ETag", etag)
+		}
+		serve(w, r)
+	}
+}
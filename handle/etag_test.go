@@ -0,0 +1,80 @@
+package handle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithETag(t *testing.T) {
+	sum := sha256.Sum256([]byte(tmpFile))
+	strong := `"` + hex.EncodeToString(sum[:]) + `"`
+	manifest := map[string]string{
+		"/" + tmpFileName:    "deploy-1",
+		"/" + tmpSubFileName: `W/"deploy-2"`,
+	}
+
+	testCases := []struct {
+		name     string
+		strategy string
+		path     string
+		expected string
+	}{
+		{"None", ETagNone, tmpFileName, ""},
+		{"Weak", ETagWeak, tmpFileName, `W/"`},
+		{"Strong", ETagStrong, tmpFileName, strong},
+		{"Manifest quoted", ETagManifest, tmpFileName, `"deploy-1"`},
+		{"Manifest weak", ETagManifest, tmpSubFileName, `W/"deploy-2"`},
+		{"Manifest missing", ETagManifest, tmpIndexName, ""},
+		{"Folder", ETagStrong, "sub/", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := Dir(baseDir)
+			handler := WithETag(
+				Basic(FileServer(storage), ""), storage, "", tc.strategy, manifest,
+			)
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "http://localhost/"+tc.path, nil))
+			etag := w.Header().Get("ETag")
+			if !strings.HasPrefix(etag, tc.expected) || (0 == len(tc.expected)) != (0 == len(etag)) {
+				t.Fatalf("Expected ETag '%s' but got '%s'", tc.expected, etag)
+			}
+			if 0 == len(etag) {
+				return
+			}
+
+			// The ETag answers conditional requests.
+			req := httptest.NewRequest("GET", "http://localhost/"+tc.path, nil)
+			req.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			handler(w, req)
+			if http.StatusNotModified != w.Code {
+				t.Errorf("With matching ETag expected %d but got %d", http.StatusNotModified, w.Code)
+			}
+		})
+	}
+}
+
+func TestLoadETagManifest(t *testing.T) {
+	good := writeCredentials(t, "etags.json", `{"/file.txt": "abc"}`)
+	defer os.Remove(good)
+	bad := writeCredentials(t, "bad.json", `["/file.txt"]`)
+	defer os.Remove(bad)
+
+	manifest, err := LoadETagManifest(good)
+	if nil != err || "abc" != manifest["/file.txt"] {
+		t.Errorf("Expected the manifest but got %v and %v", manifest, err)
+	}
+	if _, err = LoadETagManifest(bad); nil == err {
+		t.Error("With an invalid manifest expected an error but got nil")
+	}
+	if _, err = LoadETagManifest(baseDir + "missing.json"); nil == err {
+		t.Error("With a missing manifest expected an error but got nil")
+	}
+}
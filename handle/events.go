@@ -0,0 +1,177 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+// Types of the changes streamed by ChangeEvents.
+const (
+	// ChangeCreate is streamed when a file appears.
+	ChangeCreate = "create"
+	// ChangeModify is streamed when the size or modification time of a file
+	// changes.
+	ChangeModify = "modify"
+	// ChangeDelete is streamed when a file disappears.
+	ChangeDelete = "delete"
+)
+
+// eventBacklog limits the events queued for each subscriber. Subscribers
+// falling further behind are disconnected, and expected to reconnect.
+const eventBacklog = 64
+
+// ChangeEvent of a file, identified by its URL path.
+type ChangeEvent struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+// ChangeEvents streams the files created, modified and deleted in a storage to
+// subscribers as Server-Sent Events, so dashboards and build tools react to
+// new files without polling. Safe for concurrent use.
+type ChangeEvents struct {
+	storage   Storage
+	urlPrefix string
+	keepAlive time.Duration
+
+	mutex       sync.Mutex
+	known       map[string]struct{}
+	id          int64
+	subscribers map[chan ChangeEvent]struct{}
+}
+
+// NewChangeEvents returns the change events of the files in the storage,
+// served under the URL prefix.
+func NewChangeEvents(storage Storage, urlPrefix string) *ChangeEvents {
+	known := make(map[string]struct{})
+	for name := range snapshot(storage) {
+		known[name] = struct{}{}
+	}
+	return &ChangeEvents{
+		storage:     storage,
+		urlPrefix:   urlPrefix,
+		keepAlive:   30 * time.Second,
+		known:       known,
+		subscribers: make(map[chan ChangeEvent]struct{}),
+	}
+}
+
+// Changed is a WatchFunc streaming an event for each of the files to the
+// subscribers.
+func (events *ChangeEvents) Changed(names []string) {
+	exists := make([]bool, len(names))
+	for i, name := range names {
+		info, err := events.storage.Stat(name)
+		exists[i] = nil == err && !info.IsDir()
+	}
+
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	for i, name := range names {
+		_, known := events.known[name]
+		event := ChangeEvent{Path: path.Join("/", events.urlPrefix, name)}
+		switch {
+		case exists[i] && known:
+			event.Type = ChangeModify
+		case exists[i]:
+			event.Type = ChangeCreate
+			events.known[name] = struct{}{}
+		case known:
+			event.Type = ChangeDelete
+			delete(events.known, name)
+		default:
+			continue
+		}
+		events.id++
+		event.ID = events.id
+		for subscriber := range events.subscribers {
+			select {
+			case subscriber <- event:
+			default:
+				delete(events.subscribers, subscriber)
+				close(subscriber)
+			}
+		}
+	}
+}
+
+// subscribe returns a channel receiving the events until unsubscribed.
+func (events *ChangeEvents) subscribe() chan ChangeEvent {
+	subscriber := make(chan ChangeEvent, eventBacklog)
+	events.mutex.Lock()
+	events.subscribers[subscriber] = struct{}{}
+	events.mutex.Unlock()
+	return subscriber
+}
+
+// unsubscribe the channel, unless it was already dropped.
+func (events *ChangeEvents) unsubscribe(subscriber chan ChangeEvent) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	if _, found := events.subscribers[subscriber]; found {
+		delete(events.subscribers, subscriber)
+		close(subscriber)
+	}
+}
+
+// Handler streams the events of files within the 'prefix' query parameter, or
+// all files without one, until the client goes away. Events of files the
+// client could not read past the auth realms and policy rules the request
+// passed through are left out. Comments are sent periodically to keep idle
+// connections open through proxies.
+func (events *ChangeEvents) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix := path.Clean("/" + r.URL.Query().Get("prefix"))
+		subscriber := events.subscribe()
+		defer events.unsubscribe(subscriber)
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-store")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, ": watching %q\n\n", prefix)
+		flush(w)
+
+		keepAlive := time.NewTicker(events.keepAlive)
+		defer keepAlive.Stop()
+		for {
+			var err error
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			case event, open := <-subscriber:
+				if !open {
+					return
+				}
+				if !withinPrefix(event.Path, prefix) || !Allowed(r, event.Path) {
+					continue
+				}
+				data, _ := json.Marshal(event)
+				_, err = fmt.Fprintf(
+					w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data,
+				)
+			}
+			if nil != err {
+				return
+			}
+			flush(w)
+		}
+	}
+}
+
+// flush the response to the client if the writer supports it. Response writer
+// wrappers implement http.Flusher with flush so that streamed responses reach
+// clients through every stage.
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,149 @@
+package handle
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangeEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "builds"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "builds", "old.zip"), []byte("old"), 0644)
+
+	events := NewChangeEvents(Dir(dir), "/files")
+	server := httptest.NewServer(WithServerHeader(events.Handler(), "test"))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/?prefix=/files/builds")
+	if nil != err {
+		t.Fatalf("While subscribing got %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); "text/event-stream" != contentType {
+		t.Errorf("Expected an event stream but got '%s'", contentType)
+	}
+	lines := bufio.NewReader(resp.Body)
+	if comment, _ := lines.ReadString('\n'); ": watching \"/files/builds\"\n" != comment {
+		t.Errorf("Expected the watched prefix but got '%s'", comment)
+	}
+	lines.ReadString('\n')
+
+	ioutil.WriteFile(filepath.Join(dir, "builds", "new.zip"), []byte("new"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0644)
+	os.Remove(filepath.Join(dir, "builds", "old.zip"))
+	events.Changed([]string{"/builds/new.zip", "/builds/old.zip", "/other.txt"})
+	events.Changed([]string{"/builds/new.zip", "/missing.txt"})
+
+	var received []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for 12 > len(received) {
+			line, err := lines.ReadString('\n')
+			if nil != err {
+				return
+			}
+			received = append(received, strings.TrimSuffix(line, "\n"))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the events to be streamed")
+	}
+	expected := []string{
+		"id: 1", "event: create",
+		`data: {"id":1,"type":"create","path":"/files/builds/new.zip"}`, "",
+		"id: 2", "event: delete",
+		`data: {"id":2,"type":"delete","path":"/files/builds/old.zip"}`, "",
+		"id: 4", "event: modify",
+		`data: {"id":4,"type":"modify","path":"/files/builds/new.zip"}`, "",
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Expected events %q but got %q", expected, received)
+	}
+}
+
+func TestChangeEventsAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "private"), 0755)
+
+	realms := []AuthRealm{{
+		Prefix:      "/private",
+		Scheme:      AuthKey,
+		Credentials: map[string]string{"ci": "secret"},
+	}}
+	events := NewChangeEvents(Dir(dir), "")
+	server := httptest.NewServer(WithAuth(events.Handler(), realms))
+	defer server.Close()
+	injected, err := http.Get(server.URL + "/?prefix=/%0Adata:%20injected")
+	if nil != err {
+		t.Fatalf("While subscribing got %v", err)
+	}
+	comment, _ := bufio.NewReader(injected.Body).ReadString('\n')
+	injected.Body.Close()
+	if ": watching \"/\\ndata: injected\"\n" != comment {
+		t.Errorf("Expected the quoted prefix but got '%s'", comment)
+	}
+
+	resp, err := http.Get(server.URL + "/")
+	if nil != err {
+		t.Fatalf("While subscribing got %v", err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewReader(resp.Body)
+	lines.ReadString('\n')
+	lines.ReadString('\n')
+
+	ioutil.WriteFile(filepath.Join(dir, "private", "secret.txt"), []byte("secret"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "public.txt"), []byte("public"), 0644)
+	events.Changed([]string{"/private/secret.txt", "/public.txt"})
+
+	received := make(chan string, 1)
+	go func() {
+		lines.ReadString('\n')
+		lines.ReadString('\n')
+		line, _ := lines.ReadString('\n')
+		received <- line
+	}()
+	select {
+	case line := <-received:
+		expected := `data: {"id":2,"type":"create","path":"/public.txt"}` + "\n"
+		if expected != line {
+			t.Errorf("Expected '%s' but got '%s'", expected, line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the public event to be streamed")
+	}
+}
+
+func TestChangeEventsBacklog(t *testing.T) {
+	events := NewChangeEvents(Dir(baseDir), "")
+	subscriber := events.subscribe()
+	for i := 0; i <= eventBacklog; i++ {
+		events.Changed([]string{"/" + tmpFileName})
+	}
+	received := 0
+	for range subscriber {
+		received++
+	}
+	if eventBacklog != received {
+		t.Errorf("Expected %d events before being dropped but got %d", eventBacklog, received)
+	}
+	events.unsubscribe(subscriber)
+}
@@ -0,0 +1,179 @@
+package handle
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// FileCache is Storage keeping up to Size regular files of another Storage
+// open, so repeated requests for popular files do not open and close them.
+// Cached files are shared by concurrent requests, each reading its own
+// section with positioned reads, so they are copied to clients through user
+// space rather than with sendfile. Least-recently-used files are closed to make
+// room for others, once no request is reading them. Files changed or removed
+// on disk keep being served from the open file until invalidated, such as by
+// passing Invalidate to Watch.
+type FileCache struct {
+	storage Storage
+	size    int
+	mutex   sync.Mutex
+	order   *list.List
+	items   map[string]*list.Element
+}
+
+// openFile shared by requests for the file.
+type openFile struct {
+	name    string
+	file    http.File
+	reader  io.ReaderAt
+	info    os.FileInfo
+	readers int
+	evicted bool
+}
+
+// NewFileCache returns a cache keeping up to size files of the storage open.
+func NewFileCache(storage Storage, size int) *FileCache {
+	return &FileCache{
+		storage: storage,
+		size:    size,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Open the named file or folder for reading. Regular files supporting
+// positioned reads are kept open for later requests.
+func (cache *FileCache) Open(name string) (http.File, error) {
+	cache.mutex.Lock()
+	if element, found := cache.items[name]; found {
+		cache.order.MoveToFront(element)
+		open := element.Value.(*openFile)
+		open.readers++
+		cache.mutex.Unlock()
+		return open.section(cache), nil
+	}
+	cache.mutex.Unlock()
+
+	file, err := cache.storage.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	reader, ok := file.(io.ReaderAt)
+	if !ok || 0 >= cache.size {
+		return file, nil
+	}
+	info, err := file.Stat()
+	if nil != err || !info.Mode().IsRegular() {
+		return file, nil
+	}
+
+	open := &openFile{name: name, file: file, reader: reader, info: info, readers: 1}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, found := cache.items[name]; found {
+		// Another request opened the file first.
+		file.Close()
+		cache.order.MoveToFront(element)
+		open = element.Value.(*openFile)
+		open.readers++
+		return open.section(cache), nil
+	}
+	cache.items[name] = cache.order.PushFront(open)
+	for len(cache.items) > cache.size {
+		cache.remove(cache.order.Back())
+	}
+	return open.section(cache), nil
+}
+
+// Stat returns information describing the named file or folder.
+func (cache *FileCache) Stat(name string) (os.FileInfo, error) {
+	return cache.storage.Stat(name)
+}
+
+// ReadDir returns information describing the contents of the named folder,
+// sorted by name.
+func (cache *FileCache) ReadDir(name string) ([]os.FileInfo, error) {
+	return cache.storage.ReadDir(name)
+}
+
+// Invalidate the open files of the names, so they are opened again by later
+// requests. It is a WatchFunc.
+func (cache *FileCache) Invalidate(names []string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, name := range names {
+		if element, found := cache.items[name]; found {
+			cache.remove(element)
+		}
+	}
+}
+
+// Len returns the number of open files.
+func (cache *FileCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return len(cache.items)
+}
+
+// remove the file from the cache, closing it if no request is reading it. The
+// mutex must be held.
+func (cache *FileCache) remove(element *list.Element) {
+	open := cache.order.Remove(element).(*openFile)
+	delete(cache.items, open.name)
+	open.evicted = true
+	if 0 == open.readers {
+		open.file.Close()
+	}
+}
+
+// release a reader of the file, closing it if it has been removed from the
+// cache and was the last reader.
+func (cache *FileCache) release(open *openFile) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	open.readers--
+	if open.evicted && 0 == open.readers {
+		open.file.Close()
+	}
+}
+
+// section returns a reader of the whole file for a single request.
+func (open *openFile) section(cache *FileCache) http.File {
+	return &cachedFile{
+		SectionReader: io.NewSectionReader(open.reader, 0, open.info.Size()),
+		cache:         cache,
+		open:          open,
+	}
+}
+
+// cachedFile reads a file kept open by a FileCache.
+type cachedFile struct {
+	*io.SectionReader
+	cache  *FileCache
+	open   *openFile
+	closed bool
+}
+
+// Close releases the file to the cache.
+func (f *cachedFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	f.cache.release(f.open)
+	return nil
+}
+
+// Readdir of a file returns an error.
+func (f *cachedFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, errors.New("not a folder")
+}
+
+// Stat returns information describing the file when it was opened.
+func (f *cachedFile) Stat() (os.FileInfo, error) {
+	return f.open.info, nil
+}
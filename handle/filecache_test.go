@@ -0,0 +1,132 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCache(t *testing.T) {
+	cache := NewFileCache(Dir(baseDir), 2)
+
+	// Only regular files are kept open.
+	testCases := []struct {
+		name   string
+		cached bool
+	}{
+		{"/" + tmpFileName, true},
+		{"/" + subDir, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				file, err := cache.Open(tc.name)
+				if nil != err {
+					t.Fatalf("While opening got %v", err)
+				}
+				_, cached := file.(*cachedFile)
+				if tc.cached != cached {
+					t.Errorf("Expected cached %t but got %t", tc.cached, cached)
+				}
+				file.Close()
+			}
+		})
+	}
+	if 1 != cache.Len() {
+		t.Errorf("Expected 1 open file but got %d", cache.Len())
+	}
+	if _, err := cache.Open("/" + tmpBadName); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing file but got %v", err)
+	}
+
+	// Cached files are served in the same way as files opened for each request.
+	expected := Basic(FileServer(Dir(baseDir)), "")
+	handler := Basic(FileServer(cache), "")
+	ranges := []string{"", "bytes=0-4", "bytes=-6"}
+	for _, name := range []string{"/" + tmpFileName, "/" + tmpSubFileName, "/" + subDir} {
+		for _, byteRange := range ranges {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+name, nil)
+			req.Header.Set("Range", byteRange)
+			want, got := httptest.NewRecorder(), httptest.NewRecorder()
+			expected(want, req)
+			handler(got, req)
+			if want.Code != got.Code || want.Body.String() != got.Body.String() {
+				t.Errorf(
+					"For %s %s expected %d '%s' but got %d '%s'",
+					name, byteRange, want.Code, want.Body, got.Code, got.Body,
+				)
+			}
+		}
+	}
+}
+
+func TestFileCacheEviction(t *testing.T) {
+	folder, err := ioutil.TempDir("", "filecache")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		filename := filepath.Join(folder, name)
+		if err := ioutil.WriteFile(filename, []byte(name), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+	cache := NewFileCache(Dir(folder), 1)
+	read := func(file http.File) string {
+		contents, err := ioutil.ReadAll(file)
+		if nil != err {
+			t.Fatalf("While reading got %v", err)
+		}
+		return string(contents)
+	}
+
+	// A file being read when evicted remains readable until closed.
+	a, err := cache.Open("/a.txt")
+	if nil != err {
+		t.Fatalf("While opening got %v", err)
+	}
+	b, err := cache.Open("/b.txt")
+	if nil != err {
+		t.Fatalf("While opening got %v", err)
+	}
+	if 1 != cache.Len() {
+		t.Errorf("Expected 1 open file but got %d", cache.Len())
+	}
+	if contents := read(a); "a.txt" != contents {
+		t.Errorf("Expected evicted file to read 'a.txt' but got '%s'", contents)
+	}
+	if nil != a.Close() {
+		t.Error("Expected closing the evicted file to succeed")
+	}
+	if nil == a.Close() {
+		t.Error("Expected closing the file twice to fail")
+	}
+	b.Close()
+
+	// Changed files are served from the open file until invalidated.
+	filename := filepath.Join(folder, "b.txt")
+	if err := ioutil.WriteFile(filename+".new", []byte("changed"), 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	if err := os.Rename(filename+".new", filename); nil != err {
+		t.Fatalf("While replacing file got %v", err)
+	}
+	b, _ = cache.Open("/b.txt")
+	if contents := read(b); "b.txt" != contents {
+		t.Errorf("Expected cached contents 'b.txt' but got '%s'", contents)
+	}
+	b.Close()
+	cache.Invalidate([]string{"/b.txt", "/missing.txt"})
+	if 0 != cache.Len() {
+		t.Errorf("Expected no open files but got %d", cache.Len())
+	}
+	b, _ = cache.Open("/b.txt")
+	if contents := read(b); "changed" != contents {
+		t.Errorf("Expected changed contents but got '%s'", contents)
+	}
+	b.Close()
+}
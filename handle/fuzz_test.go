@@ -0,0 +1,106 @@
+//go:build go1.18
+// +build go1.18
+
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fuzzPaths seed the fuzzers of request paths with traversal attempts.
+var fuzzPaths = []string{
+	"/",
+	"/" + tmpFileName,
+	"/" + tmpSubDeepFileName,
+	"/../secret.txt",
+	"/sub/../../secret.txt",
+	"/..\\secret.txt",
+	"/sub/..%2f..%2fsecret.txt",
+	"//secret.txt",
+	"/./../secret.txt",
+	"/prefix",
+	"/prefix/../secret.txt",
+	"",
+}
+
+func FuzzDirResolve(f *testing.F) {
+	for _, urlPath := range fuzzPaths {
+		f.Add(urlPath)
+	}
+	folder := filepath.FromSlash("/srv/www")
+	f.Fuzz(func(t *testing.T, name string) {
+		rel, err := filepath.Rel(folder, Dir(folder).resolve(name))
+		if nil != err || ".." == rel || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Errorf("Name '%s' escaped the folder to '%s'", name, rel)
+		}
+	})
+}
+
+func FuzzFileServer(f *testing.F) {
+	for _, urlPath := range fuzzPaths {
+		f.Add(urlPath)
+	}
+	root, err := ioutil.TempDir("", "fuzz")
+	if nil != err {
+		f.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(root)
+	secret := "The secret outside of the folder"
+	folder := filepath.Join(root, "public")
+	if err = os.Mkdir(folder, 0700); nil != err {
+		f.Fatalf("While creating a folder got %v", err)
+	}
+	if err = ioutil.WriteFile(
+		filepath.Join(root, "secret.txt"), []byte(secret), 0600,
+	); nil != err {
+		f.Fatalf("While writing a file got %v", err)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"basic":  Basic(FileServer(Dir(folder)), ""),
+		"prefix": Prefix(FileServer(Dir(folder)), "", "/prefix"),
+	}
+	f.Fuzz(func(t *testing.T, urlPath string) {
+		for name, handler := range handlers {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = urlPath
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if strings.Contains(w.Body.String(), secret) {
+				t.Errorf("Handler %s served the secret for '%s'", name, urlPath)
+			}
+		}
+	})
+}
+
+func FuzzPrefix(f *testing.F) {
+	for _, urlPath := range fuzzPaths {
+		f.Add(urlPath, "/prefix")
+	}
+	f.Fuzz(func(t *testing.T, urlPath, urlPrefix string) {
+		served := false
+		handler := Prefix(func(w http.ResponseWriter, r *http.Request, name string) {
+			served = true
+			if !strings.HasPrefix(urlPath, urlPrefix) {
+				t.Errorf("Served '%s' outside of prefix '%s'", urlPath, urlPrefix)
+			}
+			if expected := "folder" + strings.TrimPrefix(urlPath, urlPrefix); expected != name {
+				t.Errorf("Expected name '%s' but got '%s'", expected, name)
+			}
+		}, "folder", urlPrefix)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = urlPath
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if !served && http.StatusNotFound != w.Code {
+			t.Errorf("Expected status code %d but got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package handle
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// GeneratorFunc produces the contents of a generated file for the request.
+type GeneratorFunc func(*http.Request) ([]byte, error)
+
+// SecurityTxt fields used to generate '/.well-known/security.txt' as described
+// by RFC 9116.
+type SecurityTxt struct {
+	Contact            []string
+	Encryption         string
+	Expires            time.Time
+	Policy             string
+	PreferredLanguages string
+}
+
+var (
+	// RobotsAllowAll generates a 'robots.txt' permitting all crawlers.
+	RobotsAllowAll = Static([]byte("User-agent: *\nDisallow:\n"))
+
+	// RobotsDenyAll generates a 'robots.txt' refusing all crawlers.
+	RobotsDenyAll = Static([]byte("User-agent: *\nDisallow: /\n"))
+)
+
+// WithGenerated wraps an HTTP request. Requests for urlPath are answered with
+// the contents produced by generate when name does not exist in the storage.
+// An empty name indicates the file can never be served from the storage. All
+// other requests are passed through.
+func WithGenerated(
+	serve http.HandlerFunc,
+	storage Storage,
+	urlPath, name, contentType string,
+	generate GeneratorFunc,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if urlPath != r.URL.Path {
+			serve(w, r)
+			return
+		}
+		if 0 < len(name) {
+			if info, err := storage.Stat(name); nil == err && !info.IsDir() {
+				serve(w, r)
+				return
+			}
+		}
+
+		contents, err := generate(r)
+		if nil != err {
+			log.Printf("Error: while generating %s got %v\n", urlPath, err)
+			http.Error(
+				w,
+				"500 internal server error",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		http.ServeContent(w, r, urlPath, time.Time{}, bytes.NewReader(contents))
+	}
+}
+
+// Static generator always producing the passed contents.
+func Static(contents []byte) GeneratorFunc {
+	return func(*http.Request) ([]byte, error) {
+		return contents, nil
+	}
+}
+
+// Template generator executing the text template in the passed file for each
+// request. The template can reference '.Host' and '.Scheme' of the request.
+func Template(filename string) (GeneratorFunc, error) {
+	tmpl, err := template.ParseFiles(filename)
+	if nil != err {
+		return nil, err
+	}
+	return func(r *http.Request) ([]byte, error) {
+		scheme := "http"
+		if nil != r.TLS {
+			scheme = "https"
+		}
+		data := struct {
+			Host   string
+			Scheme string
+		}{r.Host, scheme}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); nil != err {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}, nil
+}
+
+// Generate 'security.txt' contents from the passed fields.
+func (fields SecurityTxt) Generate() []byte {
+	var buf bytes.Buffer
+	for _, contact := range fields.Contact {
+		fmt.Fprintf(&buf, "Contact: %s\n", contact)
+	}
+	fmt.Fprintf(&buf, "Expires: %s\n", fields.Expires.UTC().Format(time.RFC3339))
+	optional := []struct{ name, value string }{
+		{"Encryption", fields.Encryption},
+		{"Policy", fields.Policy},
+		{"Preferred-Languages", fields.PreferredLanguages},
+	}
+	for _, field := range optional {
+		if value := strings.TrimSpace(field.value); 0 < len(value) {
+			fmt.Fprintf(&buf, "%s: %s\n", field.name, value)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,106 @@
+package handle
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithGenerated(t *testing.T) {
+	generated := "generated contents"
+	served := "served contents"
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(served))
+	}
+	generate := Static([]byte(generated))
+	failing := func(*http.Request) ([]byte, error) {
+		return nil, errors.New("failure")
+	}
+
+	testCases := []struct {
+		name     string
+		path     string
+		filename string
+		generate GeneratorFunc
+		code     int
+		contents string
+	}{
+		{"Other path", "/other.txt", "", generate, ok, served},
+		{"Never on disk", "/gen.txt", "", generate, ok, generated},
+		{"Missing on disk", "/gen.txt", "/" + tmpBadName, generate, ok, generated},
+		{"Directory on disk", "/gen.txt", "/" + subDir, generate, ok, generated},
+		{"Exists on disk", "/gen.txt", "/" + tmpFileName, generate, ok, served},
+		{"Generator failure", "/gen.txt", "", failing, http.StatusInternalServerError, "500 internal server error\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithGenerated(
+				serve, Dir(baseDir), "/gen.txt", tc.filename, "text/plain", tc.generate,
+			)
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"For %s expected status code of %d but got %d",
+					tc.path, tc.code, w.Code,
+				)
+			}
+			if contents := w.Body.String(); tc.contents != contents {
+				t.Errorf(
+					"For %s expected contents '%s' but got '%s'",
+					tc.path, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	filename := baseDir + "robots.tmpl"
+	contents := "Sitemap: {{.Scheme}}://{{.Host}}/sitemap.xml\n"
+	if err := ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+		t.Fatalf("While writing template got %v", err)
+	}
+	defer os.Remove(filename)
+
+	generate, err := Template(filename)
+	if nil != err {
+		t.Fatalf("While parsing template got %v", err)
+	}
+	req := httptest.NewRequest("GET", "http://my.machine/robots.txt", nil)
+	result, err := generate(req)
+	if nil != err {
+		t.Fatalf("While executing template got %v", err)
+	}
+	expected := "Sitemap: http://my.machine/sitemap.xml\n"
+	if expected != string(result) {
+		t.Errorf("Expected '%s' but got '%s'", expected, result)
+	}
+
+	if _, err := Template(baseDir + tmpBadName); nil == err {
+		t.Error("For missing template expected an error but got nil")
+	}
+}
+
+func TestSecurityTxtGenerate(t *testing.T) {
+	fields := SecurityTxt{
+		Contact: []string{"mailto:security@my.machine", "https://my.machine/"},
+		Expires: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		Policy:  "https://my.machine/policy",
+	}
+	expected := "Contact: mailto:security@my.machine\n" +
+		"Contact: https://my.machine/\n" +
+		"Expires: 2030-01-02T03:04:05Z\n" +
+		"Policy: https://my.machine/policy\n"
+	if result := string(fields.Generate()); expected != result {
+		t.Errorf("Expected '%s' but got '%s'", expected, result)
+	}
+}
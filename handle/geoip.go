@@ -0,0 +1,51 @@
+package handle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// CountryFunc resolves the ISO 3166-1 alpha-2 country code of an IP address,
+// returning an empty string if the country is unknown.
+type CountryFunc func(net.IP) string
+
+// WithGeoIP wraps an HTTP request. The country of the client is resolved,
+// added to the access log and made available from Country. If allow is
+// non-empty, only clients from the listed countries are served. Clients from
+// countries listed in deny are never served. Refused requests return
+// 'FORBIDDEN'.
+func WithGeoIP(
+	serve http.HandlerFunc, country CountryFunc, allow, deny []string,
+) http.HandlerFunc {
+	allowed := countrySet(allow)
+	denied := countrySet(deny)
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := country(clientIP(r))
+		if 0 < len(code) {
+			r = annotate(r, "country", code)
+			r = r.WithContext(context.WithValue(r.Context(), countryKey{}, code))
+		}
+		if _, found := denied[code]; found && 0 < len(code) {
+			audit(r, AuditEvent{Event: AuditGeoIPDeny, Rule: "deny"})
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+		if _, found := allowed[code]; 0 < len(allowed) && !found {
+			audit(r, AuditEvent{Event: AuditGeoIPDeny, Rule: "allow"})
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+		serve(w, r)
+	}
+}
+
+// countrySet converts a list of country codes into a case-normalized set.
+func countrySet(codes []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		set[strings.ToUpper(strings.TrimSpace(code))] = struct{}{}
+	}
+	return set
+}
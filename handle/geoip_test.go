@@ -0,0 +1,76 @@
+package handle
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithGeoIP(t *testing.T) {
+	countries := map[string]string{
+		"1.1.1.1": "US",
+		"2.2.2.2": "DE",
+		"3.3.3.3": "FR",
+	}
+	country := func(ip net.IP) string {
+		return countries[ip.String()]
+	}
+
+	testCases := []struct {
+		name   string
+		remote string
+		allow  []string
+		deny   []string
+		code   int
+	}{
+		{"No rules", "1.1.1.1:1234", nil, nil, ok},
+		{"No rules unknown", "9.9.9.9:1234", nil, nil, ok},
+		{"Allowed", "1.1.1.1:1234", []string{"us", "DE"}, nil, ok},
+		{"Not allowed", "3.3.3.3:1234", []string{"US", "DE"}, nil, http.StatusForbidden},
+		{"Unknown not allowed", "9.9.9.9:1234", []string{"US"}, nil, http.StatusForbidden},
+		{"Denied", "2.2.2.2:1234", nil, []string{"DE"}, http.StatusForbidden},
+		{"Not denied", "3.3.3.3:1234", nil, []string{"DE"}, ok},
+		{"Unknown not denied", "9.9.9.9:1234", nil, []string{"DE"}, ok},
+		{"Deny wins", "2.2.2.2:1234", []string{"DE"}, []string{"DE"}, http.StatusForbidden},
+		{"Remote without port", "1.1.1.1", []string{"US"}, nil, ok},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithGeoIP(
+				func(w http.ResponseWriter, r *http.Request) {},
+				country, tc.allow, tc.deny,
+			)
+			req := httptest.NewRequest("GET", "http://localhost/", nil)
+			req.RemoteAddr = tc.remote
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"From %s expected status code of %d but got %d",
+					tc.remote, tc.code, w.Code,
+				)
+			}
+		})
+	}
+}
+
+func TestWithGeoIPAnnotation(t *testing.T) {
+	country := func(net.IP) string { return "US" }
+	result := ""
+	handler := WithGeoIP(
+		func(w http.ResponseWriter, r *http.Request) {
+			result = annotations(r)
+		},
+		country, nil, nil,
+	)
+	req := httptest.NewRequest("GET", "http://localhost/", nil)
+	handler(httptest.NewRecorder(), req)
+
+	if expected := " country=US"; expected != result {
+		t.Errorf("Expected annotation '%s' but got '%s'", expected, result)
+	}
+}
@@ -1,27 +1,43 @@
 package handle
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"path"
+	"regexp"
 	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
 	// These assignments are for unit testing.
-	listenAndServe    = http.ListenAndServe
-	listenAndServeTLS = http.ListenAndServeTLS
-	setHandler        = http.HandleFunc
+	serve = func(server *http.Server) error {
+		return server.ListenAndServe()
+	}
+	serveTLS = func(server *http.Server, tlsCert, tlsKey string) error {
+		return server.ListenAndServeTLS(tlsCert, tlsKey)
+	}
 )
 
-var (
-	server http.Server
-)
+// annotationKey is the request context key holding access log annotations.
+type annotationKey struct{}
 
 // ListenerFunc accepts the {hostname:port} binding string required by HTTP
 // listeners and the handler (router) function and returns any errors that
 // occur.
 type ListenerFunc func(string, http.HandlerFunc) error
 
+// ServerFunc customizes an HTTP server before it starts serving, such as
+// setting ConnState hooks, BaseContext, ErrorLog or protocol options.
+type ServerFunc func(*http.Server)
+
 // FileServerFunc is used to serve the file from the local file system to the
 // requesting client.
 type FileServerFunc func(http.ResponseWriter, *http.Request, string)
@@ -31,21 +47,141 @@ type FileServerFunc func(http.ResponseWriter, *http.Request, string)
 func WithLogging(serveFile FileServerFunc) FileServerFunc {
 	return func(w http.ResponseWriter, r *http.Request, name string) {
 		log.Printf(
-			"REQ: %s %s %s%s -> %s\n",
+			"REQ: %s %s %s%s -> %s%s\n",
 			r.Method,
 			r.Proto,
 			r.Host,
 			r.URL.Path,
 			name,
+			annotations(r),
 		)
 		serveFile(w, r, name)
 	}
 }
 
+// LogFilter limits the requests logged by WithLogFilter. Successful responses
+// (with a status code below 400) are logged once per SampleRate, so a rate of
+// 100 logs 1 in 100 of them, while errors are always logged. Requests with URL
+// paths matching an Exclude glob, such as '/healthz' or '/favicon.ico', are
+// never logged. In the globs '**' matches any characters and '*' matches any
+// characters other than '/'. Fields are added to each logged request.
+type LogFilter struct {
+	SampleRate int
+	Exclude    []string
+	Fields     LogFields
+}
+
+// WithLogFilter returns a function that logs information about the request,
+// as for WithLogging, after serving the requested file if allowed by the
+// filter. The status code of the response is added to the log.
+func WithLogFilter(serveFile FileServerFunc, filter LogFilter) FileServerFunc {
+	exclude := make([]*regexp.Regexp, len(filter.Exclude))
+	for i, glob := range filter.Exclude {
+		exclude[i] = globExpression(glob)
+	}
+	var successes uint64
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		for _, expression := range exclude {
+			if expression.MatchString(r.URL.Path) {
+				serveFile(w, r, name)
+				return
+			}
+		}
+		recorder := newStatusWriter(w)
+		serveFile(recorder, r, name)
+		status := recorder.Status()
+		recorder.release()
+
+		if http.StatusBadRequest > status && 1 < filter.SampleRate &&
+			0 != (atomic.AddUint64(&successes, 1)-1)%uint64(filter.SampleRate) {
+			return
+		}
+		log.Printf(
+			"REQ: %s %s %s%s -> %s%s\n",
+			r.Method,
+			r.Proto,
+			r.Host,
+			r.URL.Path,
+			name,
+			annotations(annotate(filter.Fields.annotate(r), "status", statusCode(status))),
+		)
+	}
+}
+
+// annotate returns a copy of the request carrying an additional key/value pair
+// to be included in the access log.
+func annotate(r *http.Request, key, value string) *http.Request {
+	existing, _ := r.Context().Value(annotationKey{}).([]string)
+	updated := make([]string, len(existing), len(existing)+1)
+	copy(updated, existing)
+	updated = append(updated, fmt.Sprintf("%s=%s", key, value))
+	return r.WithContext(
+		context.WithValue(r.Context(), annotationKey{}, updated),
+	)
+}
+
+// annotations returns the access log annotations of the request, each
+// preceded by a space, or an empty string if there are none.
+func annotations(r *http.Request) string {
+	existing, _ := r.Context().Value(annotationKey{}).([]string)
+	if 0 == len(existing) {
+		return ""
+	}
+	return " " + strings.Join(existing, " ")
+}
+
+// clientIP returns the IP address of the remote end of the request or nil if
+// it cannot be determined.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if nil != err {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// tlsVersion returns the name of the TLS version, such as 'TLS1.3'.
+func tlsVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS1.0"
+	case tls.VersionTLS11:
+		return "TLS1.1"
+	case tls.VersionTLS12:
+		return "TLS1.2"
+	case tls.VersionTLS13:
+		return "TLS1.3"
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// cipherSuites holds the names of the cipher suites implemented, so naming the
+// cipher suite of a request does not allocate.
+var cipherSuites = func() map[uint16]string {
+	names := make(map[uint16]string)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		names[suite.ID] = suite.Name
+	}
+	return names
+}()
+
+// cipherSuite returns the name of the cipher suite, such as
+// 'TLS_AES_128_GCM_SHA256'.
+func cipherSuite(id uint16) string {
+	if name, found := cipherSuites[id]; found {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
 // Basic file handler servers files from the passed folder.
 func Basic(serveFile FileServerFunc, folder string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		serveFile(w, r, folder+r.URL.Path)
+		name := folder + r.URL.Path
+		if traced(r) {
+			Tracef(r, "resolved '%s' to '%s'", r.URL.Path, name)
+		}
+		serveFile(w, r, name)
 	}
 }
 
@@ -55,13 +191,112 @@ func Basic(serveFile FileServerFunc, folder string) http.HandlerFunc {
 func Prefix(serveFile FileServerFunc, folder, urlPrefix string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.Path, urlPrefix) {
+			if traced(r) {
+				Tracef(r, "not found as outside of prefix '%s'", urlPrefix)
+			}
+			http.NotFound(w, r)
+			return
+		}
+		name := folder + strings.TrimPrefix(r.URL.Path, urlPrefix)
+		if traced(r) {
+			Tracef(r, "resolved '%s' to '%s'", r.URL.Path, name)
+		}
+		serveFile(w, r, name)
+	}
+}
+
+// WithEndpoint wraps an HTTP request. Requests for urlPath are served by
+// endpoint while all other requests are passed through.
+func WithEndpoint(
+	serve http.HandlerFunc, urlPath string, endpoint http.HandlerFunc,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if urlPath == r.URL.Path {
+			endpoint(w, r)
+			return
+		}
+		serve(w, r)
+	}
+}
+
+// WithPaths wraps an HTTP request. Requests for paths within the prefixes, or
+// any path if there are none, are passed through unless the path is hidden,
+// while all other requests return 'NOT FOUND'. Prefixes match whole path
+// segments, so '/pub' matches '/pub/my.file' but not '/public'. Paths are
+// matched once cleaned, so '//metrics' is hidden like '/metrics'.
+func WithPaths(serve http.HandlerFunc, prefixes, hidden []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cleaned := cleanPath(r.URL.Path)
+		for _, urlPath := range hidden {
+			if urlPath == cleaned {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		for _, prefix := range prefixes {
+			prefix = strings.TrimSuffix(prefix, "/")
+			if prefix == cleaned || strings.HasPrefix(cleaned, prefix+"/") {
+				serve(w, r)
+				return
+			}
+		}
+		if 0 < len(prefixes) {
 			http.NotFound(w, r)
 			return
 		}
-		serveFile(w, r, folder+strings.TrimPrefix(r.URL.Path, urlPrefix))
+		serve(w, r)
 	}
 }
 
+// adminListenerKey is the request context key marking requests received by an
+// administrative listener.
+type adminListenerKey struct{}
+
+// WithAdminListener wraps an HTTP request received by a listener only
+// reachable by administrators, such as one bound to a private address, so that
+// endpoints such as Roots.Handler serve it without authentication.
+func WithAdminListener(serve http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r.WithContext(context.WithValue(r.Context(), adminListenerKey{}, true)))
+	}
+}
+
+// AdminListener returns true if the request was received by an administrative
+// listener marked by WithAdminListener.
+func AdminListener(r *http.Request) bool {
+	admin, _ := r.Context().Value(adminListenerKey{}).(bool)
+	return admin
+}
+
+// cleanPath returns the URL path without dot or empty segments, keeping any
+// trailing slash, as http.ServeMux cleans paths.
+func cleanPath(urlPath string) string {
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	cleaned := path.Clean(urlPath)
+	if strings.HasSuffix(urlPath, "/") && "/" != cleaned {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// withCleanPaths wraps the handler of a server. Requests for paths with dot or
+// empty segments are permanently redirected to the cleaned path, as by
+// http.ServeMux, so prefixes and realms are only matched against clean paths.
+func withCleanPaths(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cleaned := cleanPath(r.URL.Path); http.MethodConnect != r.Method &&
+			cleaned != r.URL.Path {
+			location := *r.URL
+			location.Path, location.RawPath = cleaned, ""
+			http.Redirect(w, r, location.String(), http.StatusMovedPermanently)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
 // IgnoreIndex wraps an HTTP request. In the event of a folder root request,
 // this function will automatically return 'NOT FOUND' as opposed to default
 // behavior where the index file for that directory is retrieved.
@@ -75,18 +310,106 @@ func IgnoreIndex(serve http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-// Listening function for serving the handler function.
-func Listening() ListenerFunc {
-	return func(binding string, handler http.HandlerFunc) error {
-		setHandler("/", handler)
-		return listenAndServe(binding, nil)
+// Serve the handler on the listener until the context is done, at which point
+// the server is gracefully shut down. Any listener can be supplied, such as an
+// in-memory listener for testing. Returns nil once shut down or an error
+// matching ErrListenerClosed if the listener is closed first. Each call uses
+// its own HTTP server and handlers keep their state, such as caches, to
+// themselves, so servers with different storages and options can run in one
+// process.
+func Serve(
+	ctx context.Context,
+	ln net.Listener,
+	handler http.Handler,
+	configure ...ServerFunc,
+) error {
+	server := newServer("", handler, configure)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-errs:
+		return listenerError(err)
+	case <-ctx.Done():
+		err := server.Shutdown(context.Background())
+		<-errs
+		return err
+	}
+}
+
+// newServer returns an HTTP server for the binding and handler customized by
+// each of the configure functions in order.
+func newServer(
+	binding string, handler http.Handler, configure []ServerFunc,
+) *http.Server {
+	server := &http.Server{Addr: binding, Handler: withCleanPaths(handler)}
+	for _, fn := range configure {
+		fn(server)
 	}
+	return server
+}
+
+// Listening function for serving the handler function. Each call serves the
+// handler with its own HTTP server, so that any number of servers can run in
+// one process.
+func Listening() ListenerFunc {
+	return ServerListening()
 }
 
 // TLSListening function for serving the handler function with encryption.
 func TLSListening(tlsCert, tlsKey string) ListenerFunc {
+	return TLSConfigListening(nil, tlsCert, tlsKey)
+}
+
+// ServerListening function for serving the handler function with an HTTP
+// server customized by each of the configure functions in order.
+func ServerListening(configure ...ServerFunc) ListenerFunc {
+	return func(binding string, handler http.HandlerFunc) error {
+		return listenerError(serve(newServer(binding, handler, configure)))
+	}
+}
+
+// TLSConfigListening function for serving the handler function with
+// encryption configured by the TLS configuration, allowing custom certificate
+// retrieval, client authentication and protocols. The certificate and key
+// files are optional if the configuration provides certificates. The HTTP
+// server is customized by each of the configure functions in order.
+func TLSConfigListening(
+	tlsConfig *tls.Config, tlsCert, tlsKey string, configure ...ServerFunc,
+) ListenerFunc {
 	return func(binding string, handler http.HandlerFunc) error {
-		setHandler("/", handler)
-		return listenAndServeTLS(binding, tlsCert, tlsKey, nil)
+		server := newServer(binding, handler, configure)
+		if nil != tlsConfig {
+			server.TLSConfig = tlsConfig
+		}
+		return listenerError(serveTLS(server, tlsCert, tlsKey))
+	}
+}
+
+// WithProtocols returns a ServerFunc serving only the protocols, of "h2",
+// "h2c" and "http/1.1", such as to disable HTTP/2 while debugging clients or
+// proxies that mishandle it. HTTP/1.1 is always served. "h2" negotiates
+// HTTP/2 over TLS and "h2c" serves cleartext HTTP/2, to clients upgrading or
+// connecting with prior knowledge, such as proxies and gRPC clients.
+func WithProtocols(protocols ...string) ServerFunc {
+	return func(server *http.Server) {
+		tlsHTTP2, cleartextHTTP2 := false, false
+		for _, protocol := range protocols {
+			switch protocol {
+			case "h2":
+				tlsHTTP2 = true
+			case "h2c":
+				cleartextHTTP2 = true
+			}
+		}
+		if !tlsHTTP2 {
+			// A non-nil, empty map disables HTTP/2.
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		if cleartextHTTP2 {
+			server.Handler = h2c.NewHandler(server.Handler, &http2.Server{})
+		}
 	}
 }
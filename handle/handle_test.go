@@ -1,14 +1,24 @@
 package handle
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
 )
 
 var (
@@ -133,6 +143,40 @@ func TestBasicWithAndWithoutLogging(t *testing.T) {
 	}
 }
 
+func TestWithLogFilter(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	serveFile := WithLogFilter(http.ServeFile, LogFilter{
+		SampleRate: 2,
+		Exclude:    []string{"/healthz", "/**.ico"},
+	})
+	paths := []string{
+		"/file.txt", "/file.txt", "/file.txt", "/missing.txt",
+		"/healthz", "/icons/favicon.ico",
+	}
+	for _, urlPath := range paths {
+		req := httptest.NewRequest("GET", "http://localhost"+urlPath, nil)
+		serveFile(httptest.NewRecorder(), req, baseDir+strings.TrimPrefix(urlPath, "/"))
+	}
+
+	logged := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		"localhost/file.txt -> " + baseDir + "file.txt status=200",
+		"localhost/file.txt -> " + baseDir + "file.txt status=200",
+		"localhost/missing.txt -> " + baseDir + "missing.txt status=404",
+	}
+	if len(expected) != len(logged) {
+		t.Fatalf("Expected %d lines but got %q", len(expected), logged)
+	}
+	for i, line := range expected {
+		if !strings.HasSuffix(logged[i], line) {
+			t.Errorf("Expected line ending '%s' but got '%s'", line, logged[i])
+		}
+	}
+}
+
 func TestPrefix(t *testing.T) {
 	prefix := "/my/prefix/path/"
 
@@ -234,6 +278,139 @@ func TestIgnoreIndex(t *testing.T) {
 	}
 }
 
+func TestWithEndpoint(t *testing.T) {
+	endpoint := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("endpoint"))
+	}
+	handler := WithEndpoint(Basic(http.ServeFile, baseDir), "/endpoint", endpoint)
+
+	testCases := []struct {
+		name     string
+		path     string
+		contents string
+	}{
+		{"Endpoint", "/endpoint", "endpoint"},
+		{"Endpoint subpath", "/endpoint/" + tmpFileName, notFound},
+		{"File", "/" + tmpFileName, tmpFile},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if contents := w.Body.String(); tc.contents != contents {
+				t.Errorf(
+					"While retrieving %s expected contents '%s' but got '%s'",
+					tc.path, tc.contents, contents,
+				)
+			}
+		})
+	}
+}
+
+func TestWithPaths(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	testCases := []struct {
+		name     string
+		prefixes []string
+		hidden   []string
+		path     string
+		code     int
+	}{
+		{"Any path", nil, nil, "/my.file", http.StatusOK},
+		{"Within prefix", []string{"/pub"}, nil, "/pub/my.file", http.StatusOK},
+		{"Prefix itself", []string{"/pub/"}, nil, "/pub", http.StatusOK},
+		{"Partial segment", []string{"/pub"}, nil, "/public/my.file", http.StatusNotFound},
+		{"Outside prefix", []string{"/pub"}, nil, "/my.file", http.StatusNotFound},
+		{"Hidden", nil, []string{"/metrics"}, "/metrics", http.StatusNotFound},
+		{"Hidden within prefix", []string{"/"}, []string{"/metrics"}, "/metrics", http.StatusNotFound},
+		{"Hidden uncleaned", nil, []string{"/metrics"}, "//metrics", http.StatusNotFound},
+		{"Hidden with dot segments", nil, []string{"/metrics"}, "/pub/../metrics", http.StatusNotFound},
+		{"Outside prefix uncleaned", []string{"/pub"}, nil, "/pub/../my.file", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+			WithPaths(ok, tc.prefixes, tc.hidden)(w, req)
+			if tc.code != w.Code {
+				t.Errorf("While retrieving %s expected %d but got %d", tc.path, tc.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestWithCleanPaths(t *testing.T) {
+	handler := withCleanPaths(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testCases := []struct {
+		name     string
+		path     string
+		code     int
+		location string
+	}{
+		{"Clean", "/private/secret.txt", ok, ""},
+		{"Folder", "/private/", ok, ""},
+		{"Empty segment", "//private/secret.txt", http.StatusMovedPermanently, "/private/secret.txt"},
+		{"Dot segments", "/pub/../private/./", http.StatusMovedPermanently, "/private/"},
+		{"With query", "/a//b?c=d", http.StatusMovedPermanently, "/a/b?c=d"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+			if tc.code != w.Code || tc.location != w.Header().Get("Location") {
+				t.Errorf(
+					"Expected %d to '%s' but got %d to '%s'",
+					tc.code, tc.location, w.Code, w.Header().Get("Location"),
+				)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, ln, Basic(http.ServeFile, baseDir))
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/" + tmpFileName)
+	if nil != err {
+		t.Fatalf("While requesting file got %v", err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if nil != err {
+		t.Fatalf("While reading body got %v", err)
+	}
+	if tmpFile != string(body) {
+		t.Errorf("Expected body '%s' but got '%s'", tmpFile, body)
+	}
+
+	cancel()
+	if err = <-served; nil != err {
+		t.Errorf("After cancelling expected no error but got %v", err)
+	}
+
+	// Serving on a closed listener returns the listener error.
+	err = Serve(context.Background(), ln, http.NotFoundHandler())
+	if !errors.Is(err, ErrListenerClosed) {
+		t.Errorf("With a closed listener expected %v but got %v", ErrListenerClosed, err)
+	}
+}
+
 func TestListening(t *testing.T) {
 	// Choose values for testing.
 	called := false
@@ -243,21 +420,18 @@ func TestListening(t *testing.T) {
 	// Create an empty placeholder router function.
 	handler := func(http.ResponseWriter, *http.Request) {}
 
-	// Override setHandler so that multiple calls to 'http.HandleFunc' doesn't
-	// panic.
-	setHandler = func(string, func(http.ResponseWriter, *http.Request)) {}
-
-	// Override listenAndServe with a function with more introspection and
-	// control than 'http.ListenAndServe'.
-	listenAndServe = func(
-		binding string, handler http.Handler,
-	) error {
-		if testBinding != binding {
+	// Override serve with a function with more introspection and control than
+	// 'http.Server.ListenAndServe'.
+	serve = func(server *http.Server) error {
+		if testBinding != server.Addr {
 			t.Errorf(
 				"While serving expected binding of %s but got %s",
-				testBinding, binding,
+				testBinding, server.Addr,
 			)
 		}
+		if nil == server.Handler {
+			t.Error("While serving expected the handler instead of the default mux")
+		}
 		called = !called
 		if called {
 			return nil
@@ -288,21 +462,18 @@ func TestTLSListening(t *testing.T) {
 	// Create an empty placeholder router function.
 	handler := func(http.ResponseWriter, *http.Request) {}
 
-	// Override setHandler so that multiple calls to 'http.HandleFunc' doesn't
-	// panic.
-	setHandler = func(string, func(http.ResponseWriter, *http.Request)) {}
-
-	// Override listenAndServeTLS with a function with more introspection and
-	// control than 'http.ListenAndServeTLS'.
-	listenAndServeTLS = func(
-		binding, tlsCert, tlsKey string, handler http.Handler,
-	) error {
-		if testBinding != binding {
+	// Override serveTLS with a function with more introspection and control
+	// than 'http.Server.ListenAndServeTLS'.
+	serveTLS = func(server *http.Server, tlsCert, tlsKey string) error {
+		if testBinding != server.Addr {
 			t.Errorf(
 				"While serving TLS expected binding of %s but got %s",
-				testBinding, binding,
+				testBinding, server.Addr,
 			)
 		}
+		if nil == server.Handler {
+			t.Error("While serving TLS expected the handler instead of the default mux")
+		}
 		if testTLSCert != tlsCert {
 			t.Errorf(
 				"While serving TLS expected TLS cert of %s but got %s",
@@ -333,3 +504,381 @@ func TestTLSListening(t *testing.T) {
 		)
 	}
 }
+
+func TestServeInstances(t *testing.T) {
+	// Each instance serves the same file name from its own folder with its
+	// own options.
+	type instance struct {
+		folder, urlPrefix, contents string
+		handler                     http.HandlerFunc
+		addr                        string
+	}
+	instances := []*instance{
+		{urlPrefix: "", contents: "first"},
+		{urlPrefix: "/second", contents: "second"},
+	}
+	for _, inst := range instances {
+		folder, err := ioutil.TempDir("", "instance")
+		if nil != err {
+			t.Fatalf("While creating a folder got %v", err)
+		}
+		defer os.RemoveAll(folder)
+		if err = ioutil.WriteFile(
+			filepath.Join(folder, "my.file"), []byte(inst.contents), 0600,
+		); nil != err {
+			t.Fatalf("While writing a file got %v", err)
+		}
+		inst.folder = folder
+	}
+	instances[0].handler = WithCache(
+		Basic(FileServer(Dir(instances[0].folder)), ""), CacheConfig{MaxSize: 1024},
+	)
+	instances[1].handler = WithETag(
+		Prefix(FileServer(Dir(instances[1].folder)), "", instances[1].urlPrefix),
+		Dir(instances[1].folder), instances[1].urlPrefix, ETagStrong, nil,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, len(instances))
+	for _, inst := range instances {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if nil != err {
+			t.Fatalf("While listening got %v", err)
+		}
+		inst.addr = ln.Addr().String()
+		go func(ln net.Listener, handler http.HandlerFunc) {
+			served <- Serve(ctx, ln, handler)
+		}(ln, inst.handler)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, inst := range instances {
+			wg.Add(1)
+			go func(inst *instance) {
+				defer wg.Done()
+				resp, err := http.Get("http://" + inst.addr + inst.urlPrefix + "/my.file")
+				if nil != err {
+					t.Errorf("While requesting file got %v", err)
+					return
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if inst.contents != string(body) {
+					t.Errorf("Expected body '%s' but got '%s'", inst.contents, body)
+				}
+			}(inst)
+		}
+	}
+	wg.Wait()
+
+	cancel()
+	for range instances {
+		if err := <-served; nil != err {
+			t.Errorf("After cancelling expected no error but got %v", err)
+		}
+	}
+}
+
+func TestTLSConfigListening(t *testing.T) {
+	testBinding := "host:port"
+	testTLSConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	testError := errors.New("random problem")
+	handler := func(http.ResponseWriter, *http.Request) {}
+
+	serveTLS = func(server *http.Server, tlsCert, tlsKey string) error {
+		if testBinding != server.Addr {
+			t.Errorf(
+				"While serving TLS expected binding of %s but got %s",
+				testBinding, server.Addr,
+			)
+		}
+		if testTLSConfig != server.TLSConfig {
+			t.Error("While serving TLS expected the supplied TLS config")
+		}
+		if nil == server.Handler {
+			t.Error("While serving TLS expected a handler")
+		}
+		if 0 < len(tlsCert) || 0 < len(tlsKey) {
+			t.Errorf(
+				"While serving TLS expected no files but got '%s' and '%s'",
+				tlsCert, tlsKey,
+			)
+		}
+		return testError
+	}
+
+	listener := TLSConfigListening(testTLSConfig, "", "")
+	if err := listener(testBinding, handler); testError != err {
+		t.Errorf("While serving TLS expected %v but got %v", testError, err)
+	}
+}
+
+func TestServerListening(t *testing.T) {
+	testBinding := "host:port"
+	testError := errors.New("random problem")
+	handler := func(http.ResponseWriter, *http.Request) {}
+	configure := func(server *http.Server) {
+		server.ReadTimeout = time.Minute
+	}
+
+	serve = func(server *http.Server) error {
+		if testBinding != server.Addr {
+			t.Errorf(
+				"While serving expected binding of %s but got %s",
+				testBinding, server.Addr,
+			)
+		}
+		if time.Minute != server.ReadTimeout {
+			t.Errorf("While serving expected the server to be customized")
+		}
+		return testError
+	}
+
+	listener := ServerListening(configure)
+	if err := listener(testBinding, handler); testError != err {
+		t.Errorf("While serving expected %v but got %v", testError, err)
+	}
+
+	serveTLS = func(server *http.Server, tlsCert, tlsKey string) error {
+		if time.Minute != server.ReadTimeout {
+			t.Errorf("While serving TLS expected the server to be customized")
+		}
+		return testError
+	}
+
+	listener = TLSConfigListening(nil, "test/file.pem", "test/file.key", configure)
+	if err := listener(testBinding, handler); testError != err {
+		t.Errorf("While serving TLS expected %v but got %v", testError, err)
+	}
+}
+
+func TestWithProtocols(t *testing.T) {
+	cert, err := SelfSignedCertificate([]string{"127.0.0.1"})
+	if nil != err {
+		t.Fatalf("While generating a certificate got %v", err)
+	}
+	testCases := []struct {
+		name       string
+		protocols  []string
+		negotiated string
+	}{
+		{"HTTP/2", []string{"h2", "http/1.1"}, "h2"},
+		{"HTTP/1.1 only", []string{"http/1.1"}, "http/1.1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if nil != err {
+				t.Fatalf("While listening got %v", err)
+			}
+			server := newServer(
+				"", http.NotFoundHandler(), []ServerFunc{WithProtocols(tc.protocols...)},
+			)
+			server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+			server.ErrorLog = log.New(ioutil.Discard, "", 0)
+			go server.ServeTLS(ln, "", "")
+			defer server.Close()
+
+			conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+				InsecureSkipVerify: true,
+				NextProtos:         []string{"h2", "http/1.1"},
+			})
+			if nil != err {
+				t.Fatalf("While connecting got %v", err)
+			}
+			defer conn.Close()
+			if negotiated := conn.ConnectionState().NegotiatedProtocol; tc.negotiated != negotiated {
+				t.Errorf("Expected %s but got %s", tc.negotiated, negotiated)
+			}
+		})
+	}
+}
+
+func TestWithProtocolsCleartext(t *testing.T) {
+	testCases := []struct {
+		name      string
+		protocols []string
+		isError   bool
+	}{
+		{"Cleartext HTTP/2", []string{"h2c", "http/1.1"}, false},
+		{"Without cleartext HTTP/2", []string{"h2", "http/1.1"}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if nil != err {
+				t.Fatalf("While listening got %v", err)
+			}
+			server := newServer(
+				"", http.NotFoundHandler(), []ServerFunc{WithProtocols(tc.protocols...)},
+			)
+			server.ErrorLog = log.New(ioutil.Discard, "", 0)
+			go server.Serve(ln)
+			defer server.Close()
+
+			// Connect with prior knowledge, as proxies and gRPC clients do.
+			client := &http.Client{Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+					return net.Dial(network, addr)
+				},
+			}}
+			resp, err := client.Get("http://" + ln.Addr().String() + "/")
+			if tc.isError {
+				if nil == err {
+					resp.Body.Close()
+					t.Errorf("Expected an error but got %s", resp.Proto)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("While requesting got %v", err)
+			}
+			defer resp.Body.Close()
+			if 2 != resp.ProtoMajor {
+				t.Errorf("Expected HTTP/2 but got %s", resp.Proto)
+			}
+		})
+	}
+}
+
+// benchmarkServe serves GET requests for the URL path with the file server of
+// the folder, failing unless each response has the status code.
+func benchmarkServe(b *testing.B, folder, urlPath string, code int) {
+	handler := Basic(FileServer(Dir(folder)), "")
+	req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if code != w.Code {
+			b.Fatalf("Expected status code %d but got %d", code, w.Code)
+		}
+	}
+}
+
+func BenchmarkSmallFile(b *testing.B) {
+	benchmarkServe(b, baseDir, "/"+tmpFileName, ok)
+}
+
+func BenchmarkLargeFile(b *testing.B) {
+	folder, err := ioutil.TempDir("", "bench")
+	if nil != err {
+		b.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	contents := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	if err = ioutil.WriteFile(
+		filepath.Join(folder, "large.bin"), contents, 0600,
+	); nil != err {
+		b.Fatalf("While writing a file got %v", err)
+	}
+	b.SetBytes(int64(len(contents)))
+	benchmarkServe(b, folder, "/large.bin", ok)
+}
+
+func BenchmarkDeepPath(b *testing.B) {
+	benchmarkServe(b, baseDir, "/"+tmpSubDeepFileName, ok)
+}
+
+func BenchmarkNotFound(b *testing.B) {
+	benchmarkServe(b, baseDir, "/"+tmpSubDeepBadName, missing)
+}
+
+func BenchmarkConcurrentClients(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		b.Fatalf("While listening got %v", err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, ln, Basic(FileServer(Dir(baseDir)), ""))
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	url := "http://" + ln.Addr().String() + "/" + tmpFileName
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 64}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := client.Get(url)
+			if nil != err {
+				b.Errorf("While requesting file got %v", err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if ok != resp.StatusCode {
+				b.Errorf("Expected status code %d but got %d", ok, resp.StatusCode)
+				return
+			}
+		}
+	})
+}
+
+// nopResponseWriter discards the response without allocating.
+type nopResponseWriter struct {
+	header http.Header
+}
+
+func (w *nopResponseWriter) Header() http.Header         { return w.header }
+func (w *nopResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *nopResponseWriter) WriteHeader(code int)        {}
+
+func TestHotPathAllocations(t *testing.T) {
+	serveFile := func(w http.ResponseWriter, r *http.Request, name string) {
+		w.WriteHeader(ok)
+	}
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(ok)
+	}
+	rules := []HeaderRule{
+		{Prefix: "/", Name: "cache-control", Value: "no-cache"},
+		{Prefix: "/other/", Name: "X-Other", Value: "other"},
+	}
+	filter := LogFilter{Exclude: []string{"/file.txt"}}
+	middleware := func(serve http.HandlerFunc) http.HandlerFunc {
+		return WithHeaders(serve, rules)
+	}
+
+	// Resolving the file name from the folder and path is the only allocation.
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		allocs  float64
+	}{
+		{"Basic", Basic(serveFile, baseDir), 1},
+		{"Basic without folder", Basic(serveFile, ""), 0},
+		{"Prefix", Prefix(serveFile, baseDir, "/"), 1},
+		{"Headers", WithHeaders(serve, rules), 0},
+		{"Excluded from log", Basic(WithLogFilter(serveFile, filter), ""), 0},
+		{"Server header", WithServerHeader(serve, "static-file-server"), 0},
+		{"Routes", FileRoutes(serve).Handler(), 0},
+		{"By prefix", ByPrefix(nil, []PrefixMiddleware{
+			{Prefix: "/", Middleware: middleware},
+		})(serve), 0},
+		{"Pipeline", NewPipeline(
+			Stage{Name: "headers", Middleware: middleware},
+		).Then(serve), 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &nopResponseWriter{header: make(http.Header)}
+			r := httptest.NewRequest(http.MethodGet, "/file.txt", nil)
+			allocs := testing.AllocsPerRun(100, func() {
+				tc.handler(w, r)
+			})
+			if tc.allocs != allocs {
+				t.Errorf("Expected %v allocations but got %v", tc.allocs, allocs)
+			}
+		})
+	}
+}
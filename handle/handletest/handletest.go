@@ -0,0 +1,137 @@
+// Package handletest provides helpers for integration testing configurations
+// of the static file server, serving fixture folders on local ports in the
+// same way as the server itself.
+package handletest
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/halverneus/static-file-server/cli/server"
+	"github.com/halverneus/static-file-server/config"
+)
+
+// Folder writes the files, keyed by slash-separated path within the folder, to
+// a temporary folder removed once the test ends, returning the folder.
+func Folder(t testing.TB, files map[string]string) string {
+	t.Helper()
+	folder, err := ioutil.TempDir("", "handletest")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(folder) })
+	for name, contents := range files {
+		filename := filepath.Join(folder, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(filename), 0700); nil != err {
+			t.Fatalf("While creating a folder got %v", err)
+		}
+		if err = ioutil.WriteFile(filename, []byte(contents), 0600); nil != err {
+			t.Fatalf("While writing a file got %v", err)
+		}
+	}
+	return folder
+}
+
+// Server serving a fixture folder with a configuration on a local port.
+type Server struct {
+	// URL of the server, such as 'http://127.0.0.1:43210', without a trailing
+	// slash.
+	URL string
+	// Folder of the fixture files served.
+	Folder string
+	// Client for requests to the server, trusting its certificate when served
+	// over HTTPS.
+	Client *http.Client
+}
+
+// NewServer loads the configuration file, or only environment variables if
+// the file name is empty, over the defaults and serves the files, as written by
+// Folder, with it until the test ends, when the previous configuration is
+// restored. The options customize the server in the same way as for
+// applications embedding it. The configuration is global, so tests using
+// servers cannot run in parallel.
+func NewServer(
+	t testing.TB, configFile string, files map[string]string, opts ...server.Option,
+) *Server {
+	t.Helper()
+	previous := config.Get
+	t.Cleanup(func() { config.Get = previous })
+	config.Reset()
+	if err := config.Load(configFile); nil != err {
+		t.Fatalf("While loading configuration got %v", err)
+	}
+	config.Get.Folder = Folder(t, files)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	done := make(chan error, 1)
+	opts = append(
+		opts,
+		server.WithContext(ctx),
+		server.WithListener(ln),
+		server.WithServer(func(*http.Server) { close(ready) }),
+	)
+	go func() {
+		done <- server.RunWith(opts...)
+	}()
+
+	// Fail early if the configuration cannot be served.
+	select {
+	case <-ready:
+	case err = <-done:
+		cancel()
+		ln.Close()
+		t.Fatalf("While serving got %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; nil != err {
+			t.Errorf("While shutting down got %v", err)
+		}
+	})
+
+	scheme := "http"
+	if 0 < len(config.Get.TLSCert) || 0 < len(config.Get.TLSVaultURL) ||
+		config.Get.TLSSelfSigned {
+		scheme = "https"
+	}
+	return &Server{
+		URL:    scheme + "://" + ln.Addr().String(),
+		Folder: config.Get.Folder,
+		Client: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			// Redirects are returned so that they can be checked.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Get requests the URL path, such as '/file.txt', returning the response and
+// its body.
+func (s *Server) Get(t testing.TB, urlPath string) (*http.Response, string) {
+	t.Helper()
+	resp, err := s.Client.Get(s.URL + urlPath)
+	if nil != err {
+		t.Fatalf("While requesting '%s' got %v", urlPath, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		t.Fatalf("While reading '%s' got %v", urlPath, err)
+	}
+	return resp, string(body)
+}
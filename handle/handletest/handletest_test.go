@@ -0,0 +1,81 @@
+package handletest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/halverneus/static-file-server/config"
+)
+
+func TestNewServer(t *testing.T) {
+	folder, err := ioutil.TempDir("", "config")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	configFile := filepath.Join(folder, "config.yml")
+	contents := "headers:\n  - 'X-Frame-Options: DENY'\n"
+	if err = ioutil.WriteFile(configFile, []byte(contents), 0600); nil != err {
+		t.Fatalf("While writing a file got %v", err)
+	}
+	srv := NewServer(t, configFile, map[string]string{
+		"index.html":   "index",
+		"sub/file.txt": "file",
+	})
+
+	testCases := []struct {
+		name    string
+		urlPath string
+		code    int
+		body    string
+	}{
+		{"Index", "/", http.StatusOK, "index"},
+		{"File", "/sub/file.txt", http.StatusOK, "file"},
+		{"Folder", "/sub", http.StatusMovedPermanently, ""},
+		{"Missing", "/missing.txt", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := srv.Get(t, tc.urlPath)
+			if tc.code != resp.StatusCode {
+				t.Errorf("Expected status code %d but got %d", tc.code, resp.StatusCode)
+			}
+			if tc.body != body {
+				t.Errorf("Expected body '%s' but got '%s'", tc.body, body)
+			}
+			if value := resp.Header.Get("X-Frame-Options"); "DENY" != value {
+				t.Errorf("Expected header 'DENY' but got '%s'", value)
+			}
+		})
+	}
+}
+
+func TestNewServerRestoresConfig(t *testing.T) {
+	config.Get.Headers = []string{"X-Frame-Options: DENY"}
+	defer func() { config.Get.Headers = nil }()
+
+	// Servers start from the defaults rather than the current configuration.
+	t.Run("Defaults", func(t *testing.T) {
+		srv := NewServer(t, "", map[string]string{"index.html": "index"})
+		if resp, _ := srv.Get(t, "/"); "" != resp.Header.Get("X-Frame-Options") {
+			t.Errorf("Expected no header but got '%s'", resp.Header.Get("X-Frame-Options"))
+		}
+	})
+	if 1 != len(config.Get.Headers) {
+		t.Errorf("Expected the previous configuration restored but got %v", config.Get.Headers)
+	}
+}
+
+func TestFolder(t *testing.T) {
+	folder := Folder(t, map[string]string{"a/b/c.txt": "c"})
+	contents, err := ioutil.ReadFile(filepath.Join(folder, "a", "b", "c.txt"))
+	if nil != err {
+		t.Fatalf("While reading a file got %v", err)
+	}
+	if "c" != string(contents) {
+		t.Errorf("Expected contents 'c' but got '%s'", contents)
+	}
+}
@@ -0,0 +1,252 @@
+package handle
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderRule sets, or if Value is empty removes, the response header Name for
+// requests with paths beginning with Prefix.
+type HeaderRule struct {
+	Prefix string
+	Name   string
+	Value  string
+}
+
+// ParseHeaderRule converts a rule in the form '[/path/prefix=]Name: value' into
+// a HeaderRule. If no prefix is provided then the rule applies to all paths.
+// If value is empty then the header is removed.
+func ParseHeaderRule(rule string) (parsed HeaderRule, err error) {
+	parsed.Prefix = "/"
+	header := rule
+	if strings.HasPrefix(rule, "/") {
+		if index := strings.Index(rule, "="); 0 < index {
+			parsed.Prefix = rule[:index]
+			header = rule[index+1:]
+		}
+	}
+
+	index := strings.Index(header, ":")
+	if 0 >= index {
+		err = fmt.Errorf(
+			"invalid header rule '%s', expected '[/path/prefix=]Name: value'",
+			rule,
+		)
+		return
+	}
+	name := strings.TrimSpace(header[:index])
+	if 0 == len(name) || strings.ContainsAny(name, " \t") {
+		err = fmt.Errorf("invalid header name '%s' in rule '%s'", name, rule)
+		return
+	}
+	parsed.Name = http.CanonicalHeaderKey(name)
+	parsed.Value = strings.TrimSpace(header[index+1:])
+	return
+}
+
+// ParseHeaderRules converts each rule using ParseHeaderRule.
+func ParseHeaderRules(rules []string) ([]HeaderRule, error) {
+	parsed := make([]HeaderRule, 0, len(rules))
+	for _, rule := range rules {
+		result, err := ParseHeaderRule(rule)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// String representation of the rule in the form accepted by ParseHeaderRule.
+func (rule HeaderRule) String() string {
+	return fmt.Sprintf("%s=%s: %s", rule.Prefix, rule.Name, rule.Value)
+}
+
+// ParsePermissionsPolicy converts directives in the form
+// 'feature=origin origin...' into the value of a 'Permissions-Policy' header.
+// Each origin is 'self', '*' or an 'http://' or 'https://' origin. A directive
+// without origins, such as 'camera=', disables the feature.
+func ParsePermissionsPolicy(directives []string) (string, error) {
+	policy := make([]string, 0, len(directives))
+	for _, directive := range directives {
+		index := strings.Index(directive, "=")
+		if 0 >= index {
+			return "", fmt.Errorf(
+				"invalid permissions policy '%s', expected 'feature=origin ...'",
+				directive,
+			)
+		}
+		feature := strings.TrimSpace(directive[:index])
+		if 0 == len(feature) ||
+			0 < len(strings.Trim(feature, "abcdefghijklmnopqrstuvwxyz0123456789-")) {
+			return "", fmt.Errorf(
+				"invalid feature '%s' in permissions policy '%s'", feature, directive,
+			)
+		}
+		allowlist := make([]string, 0)
+		for _, origin := range strings.Fields(directive[index+1:]) {
+			switch {
+			case "*" == origin, "self" == origin:
+				allowlist = append(allowlist, origin)
+			case strings.HasPrefix(origin, "https://"),
+				strings.HasPrefix(origin, "http://"):
+				allowlist = append(allowlist, `"`+origin+`"`)
+			default:
+				return "", fmt.Errorf(
+					"invalid origin '%s' in permissions policy '%s'",
+					origin, directive,
+				)
+			}
+		}
+		value := "(" + strings.Join(allowlist, " ") + ")"
+		if containsString(allowlist, "*") {
+			value = "*"
+		}
+		policy = append(policy, feature+"="+value)
+	}
+	return strings.Join(policy, ", "), nil
+}
+
+// CacheDirectives of a 'Cache-Control' header, separating the directives for
+// browsers from those for shared caches such as CDNs. Durations of zero are
+// omitted.
+type CacheDirectives struct {
+	// Browser directives, such as 'public, max-age=60'.
+	Browser string
+
+	// SharedMaxAge of responses in shared caches ('s-maxage').
+	SharedMaxAge time.Duration
+
+	// StaleWhileRevalidate allows stale responses to be served while they are
+	// revalidated in the background ('stale-while-revalidate').
+	StaleWhileRevalidate time.Duration
+
+	// StaleIfError allows stale responses to be served when revalidating
+	// fails ('stale-if-error').
+	StaleIfError time.Duration
+}
+
+// String value of the 'Cache-Control' header, or an empty string if there are
+// no directives.
+func (directives CacheDirectives) String() string {
+	var values []string
+	if browser := strings.TrimSpace(directives.Browser); 0 < len(browser) {
+		values = append(values, browser)
+	}
+	durations := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"s-maxage", directives.SharedMaxAge},
+		{"stale-while-revalidate", directives.StaleWhileRevalidate},
+		{"stale-if-error", directives.StaleIfError},
+	}
+	for _, d := range durations {
+		if 0 < d.duration {
+			values = append(values, fmt.Sprintf("%s=%d", d.name, int64(d.duration/time.Second)))
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// WithHeaders wraps an HTTP request. Each rule applying to the requested path
+// is applied to the response headers in order, so later rules take priority
+// over earlier rules for the same header.
+func WithHeaders(serve http.HandlerFunc, rules []HeaderRule) http.HandlerFunc {
+	// Header values are shared by every response rather than allocated for
+	// each. Their capacity is their length, so adding a value to a header
+	// copies it rather than changing the shared values.
+	names := make([]string, len(rules))
+	values := make([][]string, len(rules))
+	for i, rule := range rules {
+		names[i] = http.CanonicalHeaderKey(rule.Name)
+		values[i] = []string{rule.Value}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		for i, rule := range rules {
+			if !strings.HasPrefix(r.URL.Path, rule.Prefix) {
+				continue
+			}
+			if 0 == len(rule.Value) {
+				delete(header, names[i])
+			} else {
+				header[names[i]] = values[i]
+			}
+		}
+		serve(w, r)
+	}
+}
+
+// WithServerHeader wraps an HTTP request. Every response carries the 'Server'
+// header with the value, replacing any value set while serving. If the value
+// is empty then the header is removed from every response, including any set
+// by other stages or handlers.
+func WithServerHeader(serve http.HandlerFunc, value string) http.HandlerFunc {
+	// The header value is shared by every response, as with WithHeaders.
+	var values []string
+	if 0 < len(value) {
+		values = []string{value}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		writer := serverHeaderWriters.Get().(*serverHeaderWriter)
+		writer.ResponseWriter = w
+		writer.values = values
+		serve(writer, r)
+		*writer = serverHeaderWriter{}
+		serverHeaderWriters.Put(writer)
+	}
+}
+
+// serverHeaderWriter applies the 'Server' header as the response is written.
+type serverHeaderWriter struct {
+	http.ResponseWriter
+	values  []string
+	written bool
+}
+
+// serverHeaderWriters reuses the writers of requests that have been served.
+var serverHeaderWriters = sync.Pool{
+	New: func() interface{} { return new(serverHeaderWriter) },
+}
+
+// WriteHeader applies the 'Server' header before writing the status code.
+func (w *serverHeaderWriter) WriteHeader(code int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write applies the 'Server' header before the first write.
+func (w *serverHeaderWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom applies the 'Server' header before copying from the reader.
+func (w *serverHeaderWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.apply()
+	return readFrom(w.ResponseWriter, src)
+}
+
+// Flush applies the 'Server' header before flushing the response.
+func (w *serverHeaderWriter) Flush() {
+	w.apply()
+	flush(w.ResponseWriter)
+}
+
+// apply the 'Server' header once.
+func (w *serverHeaderWriter) apply() {
+	if w.written {
+		return
+	}
+	w.written = true
+	if nil == w.values {
+		w.Header().Del("Server")
+		return
+	}
+	w.Header()["Server"] = w.values
+}
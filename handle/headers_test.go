@@ -0,0 +1,183 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseHeaderRule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    string
+		result  HeaderRule
+		isError bool
+	}{
+		{"Header only", "X-Frame-Options: DENY",
+			HeaderRule{"/", "X-Frame-Options", "DENY"}, false},
+		{"Prefix and header", "/assets=Cache-Control: public, max-age=60",
+			HeaderRule{"/assets", "Cache-Control", "public, max-age=60"}, false},
+		{"Canonical name", "x-custom:value", HeaderRule{"/", "X-Custom", "value"}, false},
+		{"Removal", "/=Server:", HeaderRule{"/", "Server", ""}, false},
+		{"Missing colon", "X-Frame-Options DENY", HeaderRule{}, true},
+		{"Missing name", "/assets=: value", HeaderRule{}, true},
+		{"Name with space", "Bad Name: value", HeaderRule{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ParseHeaderRule(tc.rule)
+			if tc.isError {
+				if nil == err {
+					t.Errorf("For '%s' expected an error but got nil", tc.rule)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("For '%s' expected no error but got %v", tc.rule, err)
+			}
+			if tc.result != result {
+				t.Errorf("For '%s' expected %+v but got %+v", tc.rule, tc.result, result)
+			}
+		})
+	}
+
+	if _, err := ParseHeaderRules([]string{"A: b", "bad"}); nil == err {
+		t.Error("For a list with a bad rule expected an error but got nil")
+	}
+}
+
+func TestParsePermissionsPolicy(t *testing.T) {
+	testCases := []struct {
+		name       string
+		directives []string
+		expected   string
+		isError    bool
+	}{
+		{"Empty", nil, "", false},
+		{"Disabled", []string{"camera="}, "camera=()", false},
+		{"Origins", []string{
+			"camera=",
+			"geolocation=self https://maps.example.com",
+		}, `camera=(), geolocation=(self "https://maps.example.com")`, false},
+		{"Any origin", []string{"fullscreen=*"}, "fullscreen=*", false},
+		{"Missing separator", []string{"camera"}, "", true},
+		{"Bad feature", []string{"Camera=self"}, "", true},
+		{"Bad origin", []string{"camera=maps.example.com"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ParsePermissionsPolicy(tc.directives)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if tc.expected != result {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestCacheDirectives(t *testing.T) {
+	testCases := []struct {
+		name       string
+		directives CacheDirectives
+		expected   string
+	}{
+		{"Empty", CacheDirectives{}, ""},
+		{"Browser", CacheDirectives{Browser: " public, max-age=60 "}, "public, max-age=60"},
+		{"Shared", CacheDirectives{
+			Browser:              "public, max-age=60",
+			SharedMaxAge:         time.Hour,
+			StaleWhileRevalidate: time.Minute,
+			StaleIfError:         24 * time.Hour,
+		}, "public, max-age=60, s-maxage=3600, stale-while-revalidate=60, stale-if-error=86400"},
+		{"Shared only", CacheDirectives{SharedMaxAge: 90 * time.Second}, "s-maxage=90"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := tc.directives.String(); tc.expected != result {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	rules, err := ParseHeaderRules([]string{
+		"X-Frame-Options: DENY",
+		"Cache-Control: no-cache",
+		"/sub/=Cache-Control: public, max-age=60",
+		"/sub/=X-Frame-Options:",
+	})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	handler := WithHeaders(Basic(http.ServeFile, baseDir), rules)
+
+	testCases := []struct {
+		name    string
+		path    string
+		headers map[string]string
+	}{
+		{"Global rules", "/" + tmpFileName, map[string]string{
+			"X-Frame-Options": "DENY",
+			"Cache-Control":   "no-cache",
+		}},
+		{"Prefix rules", "/" + tmpSubFileName, map[string]string{
+			"X-Frame-Options": "",
+			"Cache-Control":   "public, max-age=60",
+		}},
+		{"Missing file", "/" + tmpBadName, map[string]string{
+			"X-Frame-Options": "DENY",
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			for name, expected := range tc.headers {
+				if result := w.Header().Get(name); expected != result {
+					t.Errorf(
+						"For %s expected header %s of '%s' but got '%s'",
+						tc.path, name, expected, result,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestWithServerHeader(t *testing.T) {
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "handler")
+		w.Write([]byte("body"))
+	}
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"Replaced", "static", []string{"static"}},
+		{"Removed", "", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WithServerHeader(serve, tc.value)(w, httptest.NewRequest("GET", "/", nil))
+			if result := w.Result().Header["Server"]; len(tc.expected) != len(result) ||
+				(0 < len(result) && tc.expected[0] != result[0]) {
+				t.Errorf("Expected Server header %v but got %v", tc.expected, result)
+			}
+		})
+	}
+}
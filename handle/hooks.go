@@ -0,0 +1,43 @@
+package handle
+
+import (
+	"net/http"
+)
+
+// Hooks are optional functions called while serving a request, allowing
+// embedders to add auditing, quota accounting or alerting. Unset hooks are
+// skipped.
+type Hooks struct {
+	// OnRequest is called before the request is served.
+	OnRequest func(r *http.Request)
+
+	// OnResponse is called after the request is served with the status code
+	// and number of body bytes written.
+	OnResponse func(r *http.Request, status int, bytes int64)
+
+	// OnError is called after the request is served if the status code is a
+	// client or server error (400 and above), before OnResponse. The error is
+	// a *StatusError, matching ErrNotFound or ErrForbidden where applicable.
+	OnError func(r *http.Request, err error)
+}
+
+// WithHooks wraps an HTTP request, calling the hooks around serving it.
+func WithHooks(serve http.HandlerFunc, hooks Hooks) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if nil != hooks.OnRequest {
+			hooks.OnRequest(r)
+		}
+
+		recorder := newStatusWriter(w)
+		defer recorder.release()
+		serve(recorder, r)
+		status := recorder.Status()
+
+		if nil != hooks.OnError && http.StatusBadRequest <= status {
+			hooks.OnError(r, &StatusError{Status: status})
+		}
+		if nil != hooks.OnResponse {
+			hooks.OnResponse(r, status, recorder.bytes)
+		}
+	}
+}
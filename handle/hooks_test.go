@@ -0,0 +1,76 @@
+package handle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithHooks(t *testing.T) {
+	testCases := []struct {
+		name    string
+		path    string
+		status  int
+		bytes   int64
+		isError bool
+	}{
+		{"Good file", "/" + tmpFileName, http.StatusOK, int64(len(tmpFile)), false},
+		{"Bad file", "/" + tmpBadName, http.StatusNotFound, int64(len(notFound)), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			var status int
+			var bytes int64
+			hooks := Hooks{
+				OnRequest: func(r *http.Request) {
+					calls = append(calls, "request")
+				},
+				OnResponse: func(r *http.Request, s int, b int64) {
+					calls = append(calls, "response")
+					status, bytes = s, b
+				},
+				OnError: func(r *http.Request, err error) {
+					calls = append(calls, "error")
+					if !errors.Is(err, ErrNotFound) {
+						t.Errorf("Expected %v but got %v", ErrNotFound, err)
+					}
+				},
+			}
+			handler := WithHooks(Basic(http.ServeFile, baseDir), hooks)
+
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			handler(httptest.NewRecorder(), req)
+
+			expected := []string{"request", "response"}
+			if tc.isError {
+				expected = []string{"request", "error", "response"}
+			}
+			if len(expected) != len(calls) {
+				t.Fatalf("Expected hooks %v but got %v", expected, calls)
+			}
+			for i := range expected {
+				if expected[i] != calls[i] {
+					t.Errorf("Expected hooks %v but got %v", expected, calls)
+				}
+			}
+			if tc.status != status {
+				t.Errorf("Expected status %d but got %d", tc.status, status)
+			}
+			if tc.bytes != bytes {
+				t.Errorf("Expected %d bytes but got %d", tc.bytes, bytes)
+			}
+		})
+	}
+
+	// Unset hooks are skipped.
+	handler := WithHooks(Basic(http.ServeFile, baseDir), Hooks{})
+	req := httptest.NewRequest("GET", "http://localhost/"+tmpFileName, nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if tmpFile != w.Body.String() {
+		t.Errorf("Expected body '%s' but got '%s'", tmpFile, w.Body.String())
+	}
+}
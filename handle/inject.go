@@ -0,0 +1,56 @@
+package handle
+
+import (
+	"bytes"
+	"net/http"
+)
+
+var (
+	closeHead = []byte("</head>")
+	closeBody = []byte("</body>")
+)
+
+// WithSnippets wraps an HTTP request. The head snippet is inserted before the
+// last '</head>' and the body snippet before the last '</body>' of successful
+// HTML responses that are not encoded, so the same files can be deployed with
+// different analytics or cookie banners. Snippets are inserted as is and
+// skipped if their tag is missing. Requests for HTML files and folders are
+// served whole, ignoring 'Range', as ranges of the original file would not
+// match, and HEAD requests for them are answered with the length of the
+// changed body. The 'ETag' of changed responses is weakened.
+func WithSnippets(serve http.HandlerFunc, head, body string) http.HandlerFunc {
+	isHTML := func(mediaType string) bool {
+		return "text/html" == mediaType
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet != r.Method && http.MethodHead != r.Method {
+			serve(w, r)
+			return
+		}
+		serveChanged(serve, w, r, isHTML, func(_ http.Header, content []byte) []byte {
+			content = insertBefore(content, closeHead, []byte(head))
+			content = insertBefore(content, closeBody, []byte(body))
+			Tracef(r, "injected snippets into HTML response")
+			return content
+		})
+	}
+}
+
+// insertBefore returns the content with the snippet inserted before the last
+// occurrence of the tag, ignoring case, or unchanged if the tag is missing.
+func insertBefore(content, tag, snippet []byte) []byte {
+	if 0 == len(snippet) {
+		return content
+	}
+	index := len(content) - len(tag)
+	for 0 <= index && !bytes.EqualFold(content[index:index+len(tag)], tag) {
+		index--
+	}
+	if 0 > index {
+		return content
+	}
+	inserted := make([]byte, 0, len(content)+len(snippet))
+	inserted = append(inserted, content[:index]...)
+	inserted = append(inserted, snippet...)
+	return append(inserted, content[index:]...)
+}
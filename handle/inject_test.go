@@ -0,0 +1,113 @@
+package handle
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithSnippets(t *testing.T) {
+	head := `<script src="/analytics.js"></script>`
+	body := `<div id="banner"></div>`
+	page := "<html><HEAD><title>t</title></HEAD><body><p>hi</p></BODY></html>"
+	injected := "<html><HEAD><title>t</title>" + head + "</HEAD><body><p>hi</p>" +
+		body + "</BODY></html>"
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		ctype    string
+		encoding string
+		code     int
+		contents string
+		expected string
+	}{
+		{"HTML", "GET", "/index.html", "text/html; charset=utf-8", "", ok, page, injected},
+		{"Folder", "GET", "/", "text/html; charset=utf-8", "", ok, page, injected},
+		{"Missing tags", "GET", "/a.html", "text/html", "", ok, "<p>hi</p>", "<p>hi</p>"},
+		{"Other type", "GET", "/a.txt", "text/plain", "", ok, page, page},
+		{"Encoded", "GET", "/a.html", "text/html", "gzip", ok, page, page},
+		{"Not found", "GET", "/a.html", "text/html", "", http.StatusNotFound, page, page},
+		{"Other method", "POST", "/a.html", "text/html", "", ok, page, page},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			serve := func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.ctype)
+				if 0 < len(tc.encoding) {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(tc.contents)))
+				w.WriteHeader(tc.code)
+				w.Write([]byte(tc.contents))
+			}
+			handler := WithSnippets(serve, head, body)
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("For %s expected status code %d but got %d", tc.name, tc.code, w.Code)
+			}
+			if contents := w.Body.String(); tc.expected != contents {
+				t.Errorf("For %s expected '%s' but got '%s'", tc.name, tc.expected, contents)
+			}
+			length := strconv.Itoa(len(tc.expected))
+			if actual := w.Header().Get("Content-Length"); length != actual {
+				t.Errorf("For %s expected length %s but got %s", tc.name, length, actual)
+			}
+		})
+	}
+}
+
+func TestWithSnippetsServeContent(t *testing.T) {
+	page := "<html><head></head><body></body></html>"
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "index.html", time.Time{}, strings.NewReader(page))
+	}
+	handler := WithSnippets(serve, "<meta>", "")
+
+	req := httptest.NewRequest("GET", "http://localhost/index.html", nil)
+	req.Header.Set("Range", "bytes=0-5")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	expected := "<html><head><meta></head><body></body></html>"
+	if ok != w.Code || expected != w.Body.String() {
+		t.Errorf("Expected %d '%s' but got %d '%s'", ok, expected, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("HEAD", "http://localhost/index.html", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if ok != w.Code || 0 != w.Body.Len() {
+		t.Errorf("Expected %d with no body but got %d '%s'", ok, w.Code, w.Body.String())
+	}
+	if length := w.Header().Get("Content-Length"); strconv.Itoa(len(expected)) != length {
+		t.Errorf("Expected the length of the changed page for HEAD but got %s", length)
+	}
+}
+
+func TestWithSnippetsOverflow(t *testing.T) {
+	page := append(bytes.Repeat([]byte("a"), maxBodySize), "</body>"...)
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(page[:maxBodySize])
+		w.Write(page[maxBodySize:])
+	}
+	handler := WithSnippets(serve, "", "<p>")
+	req := httptest.NewRequest("GET", "http://localhost/index.html", nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if !bytes.Equal(page, w.Body.Bytes()) {
+		t.Errorf("Expected large response unchanged but got %d bytes", w.Body.Len())
+	}
+}
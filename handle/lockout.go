@@ -0,0 +1,174 @@
+package handle
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lockout tracks failed authentication attempts per client IP address and
+// bans clients exceeding a threshold of failures within a window. Safe for
+// concurrent use.
+type Lockout struct {
+	threshold int
+	window    time.Duration
+	banTime   time.Duration
+	now       func() time.Time
+
+	mutex   sync.Mutex
+	clients map[string]*lockoutClient
+	swept   time.Time
+}
+
+// lockoutClient holds the recent failures and ban of a client.
+type lockoutClient struct {
+	failures []time.Time
+	until    time.Time
+}
+
+// Ban of a client IP address.
+type Ban struct {
+	IP    string    `json:"ip"`
+	Until time.Time `json:"until"`
+}
+
+// NewLockout returns a lockout banning clients for the ban time after the
+// threshold of failed attempts within the window.
+func NewLockout(threshold int, window, banTime time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		window:    window,
+		banTime:   banTime,
+		now:       time.Now,
+		clients:   make(map[string]*lockoutClient),
+	}
+}
+
+// Fail records a failed attempt by the client, returning true if the client is
+// now banned.
+func (lockout *Lockout) Fail(ip string) bool {
+	lockout.mutex.Lock()
+	defer lockout.mutex.Unlock()
+
+	now := lockout.now()
+	lockout.sweep(now)
+	client, found := lockout.clients[ip]
+	if !found {
+		client = &lockoutClient{}
+		lockout.clients[ip] = client
+	}
+	client.failures = append(recent(client.failures, now.Add(-lockout.window)), now)
+	if lockout.threshold <= len(client.failures) {
+		client.failures = nil
+		client.until = now.Add(lockout.banTime)
+	}
+	return now.Before(client.until)
+}
+
+// Banned returns the end of the ban of the client and true if it is banned.
+func (lockout *Lockout) Banned(ip string) (time.Time, bool) {
+	lockout.mutex.Lock()
+	defer lockout.mutex.Unlock()
+
+	client, found := lockout.clients[ip]
+	if !found || !lockout.now().Before(client.until) {
+		return time.Time{}, false
+	}
+	return client.until, true
+}
+
+// Bans of all currently banned clients, ordered by IP address.
+func (lockout *Lockout) Bans() []Ban {
+	lockout.mutex.Lock()
+	defer lockout.mutex.Unlock()
+
+	now := lockout.now()
+	bans := make([]Ban, 0)
+	for ip, client := range lockout.clients {
+		if now.Before(client.until) {
+			bans = append(bans, Ban{IP: ip, Until: client.until})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return bans
+}
+
+// Handler serving the current bans as JSON.
+func (lockout *Lockout) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lockout.Bans())
+	}
+}
+
+// sweep forgets clients without recent failures or a ban, at most once per
+// window.
+func (lockout *Lockout) sweep(now time.Time) {
+	if now.Sub(lockout.swept) < lockout.window {
+		return
+	}
+	lockout.swept = now
+	since := now.Add(-lockout.window)
+	for ip, client := range lockout.clients {
+		client.failures = recent(client.failures, since)
+		if 0 == len(client.failures) && !now.Before(client.until) {
+			delete(lockout.clients, ip)
+		}
+	}
+}
+
+// recent returns the failures after the time.
+func recent(failures []time.Time, since time.Time) []time.Time {
+	for 0 < len(failures) && !failures[0].After(since) {
+		failures = failures[1:]
+	}
+	return failures
+}
+
+// WithLockout wraps an HTTP request. Requests supplying credentials that are
+// answered with 'UNAUTHORIZED' by later stages count as failed attempts of the
+// client. Requests from banned clients are refused with 'TOO MANY REQUESTS'
+// until the ban ends.
+func WithLockout(serve http.HandlerFunc, lockout *Lockout) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if nil == ip {
+			serve(w, r)
+			return
+		}
+		key := ip.String()
+		if until, banned := lockout.Banned(key); banned {
+			audit(r, AuditEvent{Event: AuditLockoutDeny})
+			log.Printf(
+				"DENY: %s %s %s%s locked out until %s%s\n",
+				r.Method,
+				r.Proto,
+				r.Host,
+				r.URL.Path,
+				until.UTC().Format(time.RFC3339),
+				annotations(r),
+			)
+			retry := retrySeconds(lockout.now(), until)
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			http.Error(w, "429 too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		recorder := &statusWriter{ResponseWriter: w}
+		serve(recorder, r)
+		if http.StatusUnauthorized == recorder.Status() && hasCredentials(r) &&
+			lockout.Fail(key) {
+			audit(r, AuditEvent{Event: AuditLockoutBan})
+		}
+	}
+}
+
+// hasCredentials returns true if the request supplies credentials.
+func hasCredentials(r *http.Request) bool {
+	return 0 < len(r.Header.Get("Authorization")) ||
+		0 < len(r.Header.Get("X-Access-Key"))
+}
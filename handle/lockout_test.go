@@ -0,0 +1,87 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lockout := NewLockout(3, time.Minute, time.Hour)
+	lockout.now = func() time.Time { return now }
+
+	if lockout.Fail("192.0.2.1") || lockout.Fail("192.0.2.1") {
+		t.Fatal("Expected no ban before the threshold")
+	}
+	// Failures outside the window are forgotten.
+	now = now.Add(2 * time.Minute)
+	if lockout.Fail("192.0.2.1") || lockout.Fail("192.0.2.1") {
+		t.Fatal("Expected no ban after the window passed")
+	}
+	if !lockout.Fail("192.0.2.1") {
+		t.Fatal("Expected a ban at the threshold")
+	}
+	if _, banned := lockout.Banned("192.0.2.2"); banned {
+		t.Error("Expected other clients not to be banned")
+	}
+	until, banned := lockout.Banned("192.0.2.1")
+	if !banned || !until.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected a ban until %v but got %v (%t)", now.Add(time.Hour), until, banned)
+	}
+	if bans := lockout.Bans(); 1 != len(bans) || "192.0.2.1" != bans[0].IP {
+		t.Errorf("Expected a single ban but got %v", bans)
+	}
+
+	now = now.Add(time.Hour)
+	if _, banned := lockout.Banned("192.0.2.1"); banned {
+		t.Error("Expected the ban to end")
+	}
+	if bans := lockout.Bans(); 0 != len(bans) {
+		t.Errorf("Expected no bans but got %v", bans)
+	}
+}
+
+func TestWithLockout(t *testing.T) {
+	lockout := NewLockout(2, time.Minute, time.Hour)
+	handler := WithLockout(func(w http.ResponseWriter, r *http.Request) {
+		if "secret" != r.Header.Get("X-Access-Key") {
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+		}
+	}, lockout)
+
+	testCases := []struct {
+		name string
+		key  string
+		code int
+	}{
+		{"Anonymous", "", http.StatusUnauthorized},
+		{"Anonymous again", "", http.StatusUnauthorized},
+		{"First failure", "wrong", http.StatusUnauthorized},
+		{"Success", "secret", ok},
+		{"Second failure", "wrong", http.StatusUnauthorized},
+		{"Banned", "secret", http.StatusTooManyRequests},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/file.txt", nil)
+			if 0 < len(tc.key) {
+				req.Header.Set("X-Access-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	lockout.Handler()(w, httptest.NewRequest("GET", "/__lockout", nil))
+	if body := w.Body.String(); !strings.Contains(body, `"ip":"192.0.2.1"`) {
+		t.Errorf("Expected the ban to be listed but got '%s'", body)
+	}
+}
@@ -0,0 +1,87 @@
+package handle
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Metadata describing a file without its contents.
+type Metadata struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	Modified    time.Time `json:"modified"`
+	ContentType string    `json:"content_type"`
+	SHA256      string    `json:"sha256"`
+}
+
+// WithMetadata wraps an HTTP request. Requests for a file with the 'meta' query
+// parameter set (e.g. '/my.file?meta=1') return the Metadata of the file as
+// JSON instead of its contents. The SHA-256 hash is cached until the file
+// changes. Requests are resolved to files in the storage by removing urlPrefix
+// in the same way as Prefix.
+func WithMetadata(
+	serve http.HandlerFunc, storage Storage, urlPrefix string,
+) http.HandlerFunc {
+	cache := newChecksumCache()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if 0 == len(r.URL.Query().Get("meta")) ||
+			!strings.HasPrefix(r.URL.Path, urlPrefix) {
+			serve(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, urlPrefix)
+		info, err := storage.Stat(name)
+		if nil != err || info.IsDir() {
+			serve(w, r)
+			return
+		}
+
+		metadata := Metadata{
+			Name:     path.Base(r.URL.Path),
+			Size:     info.Size(),
+			Modified: info.ModTime().UTC(),
+		}
+		if metadata.ContentType, err = contentType(storage, name); nil == err {
+			metadata.SHA256, err = cache.get(storage, name, info, "sha256")
+		}
+		if nil != err {
+			log.Printf("Error: while reading metadata of %s got %v\n", name, err)
+			http.Error(
+				w,
+				"500 internal server error",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metadata)
+	}
+}
+
+// contentType returns the content type of the file based on its extension or,
+// if unknown, its contents in the same way as http.ServeFile.
+func contentType(storage Storage, name string) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(name)); "" != ctype {
+		return ctype, nil
+	}
+
+	file, err := storage.Open(name)
+	if nil != err {
+		return "", err
+	}
+	defer file.Close()
+
+	var buf [512]byte
+	n, err := io.ReadFull(file, buf[:])
+	if nil != err && io.ErrUnexpectedEOF != err && io.EOF != err {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,109 @@
+package handle
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithMetadata(t *testing.T) {
+	sha256Sum := "8308ebec1877060358a1062ae1c08f8c139e55b32a86bc3d7290bc6604a54d52"
+	prefix := "/my/prefix"
+
+	for _, urlPrefix := range []string{"", prefix} {
+		handler := Basic(http.ServeFile, baseDir)
+		if 0 < len(urlPrefix) {
+			handler = Prefix(http.ServeFile, baseDir, urlPrefix)
+		}
+		handler = WithMetadata(handler, Dir(baseDir), urlPrefix)
+
+		t.Run("File metadata "+urlPrefix, func(t *testing.T) {
+			fullpath := "http://localhost" + urlPrefix + "/" + tmpFileName + "?meta=1"
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if ok != w.Code {
+				t.Fatalf("While retrieving %s expected %d but got %d", fullpath, ok, w.Code)
+			}
+			var metadata Metadata
+			if err := json.NewDecoder(w.Body).Decode(&metadata); nil != err {
+				t.Fatalf("While decoding metadata got %v", err)
+			}
+			expected := Metadata{
+				Name:        tmpFileName,
+				Size:        int64(len(tmpFile)),
+				ContentType: "text/plain; charset=utf-8",
+				SHA256:      sha256Sum,
+				Modified:    metadata.Modified,
+			}
+			if expected != metadata {
+				t.Errorf("Expected metadata %+v but got %+v", expected, metadata)
+			}
+			if metadata.Modified.IsZero() {
+				t.Error("Expected modification time but got none")
+			}
+		})
+
+		testCases := []struct {
+			name     string
+			path     string
+			code     int
+			contents string
+		}{
+			{"Without meta", "/" + tmpFileName, ok, tmpFile},
+			{"Missing file", "/" + tmpBadName + "?meta=1", missing, notFound},
+			{"Directory", "/sub/?meta=1", ok, tmpSubIndex},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name+" "+urlPrefix, func(t *testing.T) {
+				fullpath := "http://localhost" + urlPrefix + tc.path
+				req := httptest.NewRequest("GET", fullpath, nil)
+				w := httptest.NewRecorder()
+
+				handler(w, req)
+
+				if tc.code != w.Code {
+					t.Errorf(
+						"While retrieving %s expected status code of %d but got %d",
+						fullpath, tc.code, w.Code,
+					)
+				}
+				if contents := w.Body.String(); tc.contents != contents {
+					t.Errorf(
+						"While retrieving %s expected contents '%s' but got '%s'",
+						fullpath, tc.contents, contents,
+					)
+				}
+			})
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		storage  Storage
+		filename string
+		ctype    string
+		isError  bool
+	}{
+		{"By extension", Dir(baseDir), "/" + tmpIndexName, "text/html; charset=utf-8", false},
+		{"By contents", Dir(".."), "/LICENSE", "text/plain; charset=utf-8", false},
+		{"Missing", Dir(baseDir), "/missing", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctype, err := contentType(tc.storage, tc.filename)
+			if tc.ctype != ctype {
+				t.Errorf("Expected '%s' but got '%s'", tc.ctype, ctype)
+			}
+			if tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package handle
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultDurationBuckets in seconds used for request durations.
+	DefaultDurationBuckets = []float64{
+		.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+	}
+)
+
+// MetricsRegistry creates the metrics used by WithMetrics. Implementations can
+// adapt an existing metrics library, such as the Prometheus client, so that
+// metrics are registered wherever the embedding application wants. Requesting
+// an already registered name returns the existing metric.
+type MetricsRegistry interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+// Counter accumulates values for each combination of label values.
+type Counter interface {
+	Add(value float64, labelValues ...string)
+}
+
+// Gauge holds values that can rise and fall for each combination of label
+// values.
+type Gauge interface {
+	Add(value float64, labelValues ...string)
+	Set(value float64, labelValues ...string)
+}
+
+// Histogram counts observations into buckets for each combination of label
+// values.
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// ExemplarHistogram is a Histogram that can keep the trace ID of observations
+// as exemplars, so a dashboard can jump from a bucket, such as a latency
+// spike, to the trace of a request in it.
+type ExemplarHistogram interface {
+	Histogram
+	ObserveWithTraceID(value float64, traceID string, labelValues ...string)
+}
+
+// WithMetrics wraps an HTTP request. The number of requests, bytes written and
+// request durations (labelled by method and status code), the number of
+// requests in progress and the number of HTTPS requests (labelled by TLS
+// version and cipher suite) are recorded in metrics created from the registry. If
+// the duration histogram is an ExemplarHistogram, the trace ID of requests with
+// a W3C 'traceparent' header is kept as exemplar.
+func WithMetrics(serve http.HandlerFunc, registry MetricsRegistry) http.HandlerFunc {
+	requests := registry.Counter(
+		"static_file_server_requests_total",
+		"Number of HTTP requests served.",
+		"method", "code",
+	)
+	written := registry.Counter(
+		"static_file_server_response_bytes_total",
+		"Number of body bytes written in HTTP responses.",
+		"method", "code",
+	)
+	durations := registry.Histogram(
+		"static_file_server_request_duration_seconds",
+		"Duration of HTTP requests.",
+		DefaultDurationBuckets,
+		"method", "code",
+	)
+	inFlight := registry.Gauge(
+		"static_file_server_requests_in_flight",
+		"Number of HTTP requests currently being served.",
+	)
+	secured := registry.Counter(
+		"static_file_server_tls_requests_total",
+		"Number of HTTPS requests served.",
+		"version", "cipher",
+	)
+	exemplars, _ := durations.(ExemplarHistogram)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		start := time.Now()
+		recorder := newStatusWriter(w)
+
+		serve(recorder, r)
+
+		labels := []string{metricMethod(r.Method), statusCode(recorder.Status())}
+		requests.Add(1, labels...)
+		if nil != r.TLS {
+			secured.Add(1, tlsVersion(r.TLS.Version), cipherSuite(r.TLS.CipherSuite))
+		}
+		written.Add(float64(recorder.bytes), labels...)
+		elapsed := time.Since(start).Seconds()
+		if id := traceID(r); nil != exemplars && "" != id {
+			exemplars.ObserveWithTraceID(elapsed, id, labels...)
+		} else {
+			durations.Observe(elapsed, labels...)
+		}
+		inFlight.Add(-1)
+		recorder.release()
+	}
+}
+
+// traceID returns the trace ID of the W3C 'traceparent' request header (e.g.
+// '00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'), or an empty
+// string if it is missing or invalid.
+func traceID(r *http.Request) string {
+	parent := r.Header.Get("Traceparent")
+	if 55 > len(parent) || '-' != parent[2] || '-' != parent[35] || '-' != parent[52] {
+		return ""
+	}
+	id := parent[3:35]
+	zero := true
+	for i := 0; i < len(id); i++ {
+		if !isHex(id[i]) {
+			return ""
+		}
+		zero = zero && '0' == id[i]
+	}
+	if zero {
+		return ""
+	}
+	return id
+}
+
+// statusCodes holds the text of each valid status code, so labelling metrics
+// with the status code does not allocate.
+var statusCodes = func() (codes [600]string) {
+	for code := 100; code < len(codes); code++ {
+		codes[code] = strconv.Itoa(code)
+	}
+	return
+}()
+
+// statusCode returns the text of the status code.
+func statusCode(code int) string {
+	if 100 <= code && code < len(statusCodes) {
+		return statusCodes[code]
+	}
+	return strconv.Itoa(code)
+}
+
+// metricMethod limits the method label to known methods, preventing clients
+// from creating unbounded label values.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// statusWriter passes the response through while recording the status code
+// and number of body bytes written.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// statusWriters reuses the status writers of requests that have been served.
+var statusWriters = sync.Pool{
+	New: func() interface{} { return new(statusWriter) },
+}
+
+// newStatusWriter returns a status writer for the response from the pool.
+// The writer must be released once the request has been served.
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	recorder := statusWriters.Get().(*statusWriter)
+	recorder.ResponseWriter = w
+	return recorder
+}
+
+// release the status writer back to the pool.
+func (w *statusWriter) release() {
+	*w = statusWriter{}
+	statusWriters.Put(w)
+}
+
+// WriteHeader records the status code.
+func (w *statusWriter) WriteHeader(code int) {
+	if 0 == w.status {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the number of bytes written.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom records the number of bytes copied from the reader.
+func (w *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	n, err := readFrom(w.ResponseWriter, src)
+	w.bytes += n
+	return n, err
+}
+
+// Flush records the status code and flushes the response.
+func (w *statusWriter) Flush() {
+	if 0 == w.status {
+		w.status = http.StatusOK
+	}
+	flush(w.ResponseWriter)
+}
+
+// Status returns the recorded status code, which is 'OK' if nothing was
+// written.
+func (w *statusWriter) Status() int {
+	if 0 == w.status {
+		return http.StatusOK
+	}
+	return w.status
+}
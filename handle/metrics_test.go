@@ -0,0 +1,147 @@
+package handle
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// testRegistry records every measurement for inspection.
+type testRegistry struct {
+	values map[string]float64
+}
+
+type testMetric struct {
+	name     string
+	registry *testRegistry
+}
+
+func (registry *testRegistry) Counter(name, help string, labels ...string) Counter {
+	return &testMetric{name, registry}
+}
+
+func (registry *testRegistry) Gauge(name, help string, labels ...string) Gauge {
+	return &testMetric{name, registry}
+}
+
+func (registry *testRegistry) Histogram(
+	name, help string, buckets []float64, labels ...string,
+) Histogram {
+	return &testMetric{name, registry}
+}
+
+func (metric *testMetric) key(labelValues []string) string {
+	key := metric.name
+	for _, value := range labelValues {
+		key += " " + value
+	}
+	return key
+}
+
+func (metric *testMetric) Add(value float64, labelValues ...string) {
+	metric.registry.values[metric.key(labelValues)] += value
+}
+
+func (metric *testMetric) Set(value float64, labelValues ...string) {
+	metric.registry.values[metric.key(labelValues)] = value
+}
+
+func (metric *testMetric) Observe(value float64, labelValues ...string) {
+	metric.registry.values[metric.key(labelValues)+" count"]++
+}
+
+func (metric *testMetric) ObserveWithTraceID(
+	value float64, traceID string, labelValues ...string,
+) {
+	metric.Observe(value, labelValues...)
+	metric.registry.values[metric.key(labelValues)+" "+traceID]++
+}
+
+func TestWithMetrics(t *testing.T) {
+	registry := &testRegistry{values: make(map[string]float64)}
+	handler := WithMetrics(Basic(http.ServeFile, baseDir), registry)
+
+	requests := []struct {
+		method string
+		path   string
+		parent string
+	}{
+		{"GET", "/" + tmpFileName, ""},
+		{"GET", "/" + tmpFileName, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{"GET", "/" + tmpBadName, ""},
+		{"BREW", "/" + tmpFileName, ""},
+	}
+	for _, request := range requests {
+		req := httptest.NewRequest(request.method, "http://localhost"+request.path, nil)
+		if "" != request.parent {
+			req.Header.Set("Traceparent", request.parent)
+		}
+		handler(httptest.NewRecorder(), req)
+	}
+
+	expected := map[string]float64{
+		"static_file_server_requests_total GET 200":                                            2,
+		"static_file_server_requests_total GET 404":                                            1,
+		"static_file_server_requests_total OTHER 200":                                          1,
+		"static_file_server_response_bytes_total GET 200":                                      float64(2 * len(tmpFile)),
+		"static_file_server_response_bytes_total GET 404":                                      float64(len(notFound)),
+		"static_file_server_response_bytes_total OTHER 200":                                    float64(len(tmpFile)),
+		"static_file_server_request_duration_seconds GET 200 count":                            2,
+		"static_file_server_request_duration_seconds GET 200 4bf92f3577b34da6a3ce929d0e0e4736": 1,
+		"static_file_server_request_duration_seconds GET 404 count":                            1,
+		"static_file_server_request_duration_seconds OTHER 200 count":                          1,
+		"static_file_server_requests_in_flight":                                                0,
+	}
+	if !reflect.DeepEqual(expected, registry.values) {
+		t.Errorf("Expected metrics %v but got %v", expected, registry.values)
+	}
+
+	// HTTPS requests are counted by TLS version and cipher suite.
+	req := httptest.NewRequest("GET", "https://localhost/"+tmpFileName, nil)
+	req.TLS.Version, req.TLS.CipherSuite = tls.VersionTLS13, tls.TLS_AES_128_GCM_SHA256
+	handler(httptest.NewRecorder(), req)
+	key := "static_file_server_tls_requests_total TLS1.3 TLS_AES_128_GCM_SHA256"
+	if 1 != registry.values[key] {
+		t.Errorf("Expected 1 for '%s' but got %v", key, registry.values[key])
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	testCases := []struct {
+		name   string
+		parent string
+		id     string
+	}{
+		{"Valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"Future version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"Missing", "", ""},
+		{"Short", "00-4bf92f3577b34da6a3ce929d0e0e4736-01", ""},
+		{"Not hexadecimal", "00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01", ""},
+		{"All zeros", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://localhost/", nil)
+			r.Header.Set("Traceparent", tc.parent)
+			if id := traceID(r); tc.id != id {
+				t.Errorf("Expected '%s' but got '%s'", tc.id, id)
+			}
+		})
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	w := &statusWriter{ResponseWriter: httptest.NewRecorder()}
+	if ok != w.Status() {
+		t.Errorf("Expected default status %d but got %d", ok, w.Status())
+	}
+	w.WriteHeader(http.StatusTeapot)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("abc"))
+	if http.StatusTeapot != w.Status() || 3 != w.bytes {
+		t.Errorf("Expected status %d with 3 bytes but got %d with %d",
+			http.StatusTeapot, w.Status(), w.bytes)
+	}
+}
@@ -0,0 +1,481 @@
+package handle
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxMinifiedEntries limits the minified responses kept by WithMinify. The
+// entries are dropped together when the limit is reached.
+const maxMinifiedEntries = 1024
+
+// minifiers by the media type of the responses they minify.
+var minifiers = map[string]func([]byte) []byte{
+	"application/javascript": minifyJS,
+	"text/css":               minifyCSS,
+	"text/html":              minifyHTML,
+	"text/javascript":        minifyJS,
+}
+
+// minified responses, keyed by path, validators and length of the original.
+type minified struct {
+	mutex   sync.Mutex
+	entries map[string][]byte
+}
+
+// minify returns the minified body, kept while the 'ETag' or 'Last-Modified'
+// validators of the response do not change.
+func (cache *minified) minify(urlPath string, header http.Header, body []byte) []byte {
+	minifier := minifiers[mediaType(header.Get("Content-Type"))]
+	validators := header.Get("ETag") + "\x00" + header.Get("Last-Modified")
+	if "\x00" == validators {
+		return minifier(body)
+	}
+	key := urlPath + "\x00" + validators + "\x00" + strconv.Itoa(len(body))
+
+	cache.mutex.Lock()
+	result, found := cache.entries[key]
+	cache.mutex.Unlock()
+	if found {
+		return result
+	}
+	result = minifier(body)
+	cache.mutex.Lock()
+	if maxMinifiedEntries <= len(cache.entries) {
+		cache.entries = make(map[string][]byte)
+	}
+	cache.entries[key] = result
+	cache.mutex.Unlock()
+	return result
+}
+
+// WithMinify wraps an HTTP request. Successful HTML, CSS and JavaScript
+// responses that are not encoded are minified, removing comments and
+// collapsing whitespace, and kept in memory while their 'ETag' or
+// 'Last-Modified' validators do not change. The minification is conservative:
+// whitespace is collapsed rather than removed where it may be significant,
+// such as line breaks in JavaScript, and the contents of 'pre' and 'textarea'
+// elements are unchanged. Requests for these files and folders are served
+// whole, ignoring 'Range', as ranges of the original file would not match, and
+// HEAD requests for them are answered with the length of the minified body.
+// The 'ETag' of minified responses is weakened.
+func WithMinify(serve http.HandlerFunc) http.HandlerFunc {
+	cache := &minified{entries: make(map[string][]byte)}
+	minifiable := func(mediaType string) bool {
+		_, found := minifiers[mediaType]
+		return found
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet != r.Method && http.MethodHead != r.Method {
+			serve(w, r)
+			return
+		}
+		serveChanged(serve, w, r, minifiable, func(header http.Header, body []byte) []byte {
+			minified := cache.minify(r.URL.Path, header, body)
+			Tracef(r, "minified %d bytes to %d", len(body), len(minified))
+			return minified
+		})
+	}
+}
+
+// isSpace returns true for the whitespace of HTML, CSS and JavaScript sources.
+func isSpace(c byte) bool {
+	return ' ' == c || '\t' == c || '\n' == c || '\r' == c || '\f' == c || '\v' == c
+}
+
+// isIdentifier returns true for characters of JavaScript identifiers, numbers
+// and keywords, including all non-ASCII bytes.
+func isIdentifier(c byte) bool {
+	return 'a' <= c && 'z' >= c || 'A' <= c && 'Z' >= c || '0' <= c && '9' >= c ||
+		'_' == c || '$' == c || '\\' == c || 0x80 <= c
+}
+
+// skipSpace returns the index of the first byte at or after i that is not
+// whitespace and whether a line break was skipped.
+func skipSpace(src []byte, i int) (int, bool) {
+	newline := false
+	for ; i < len(src) && isSpace(src[i]); i++ {
+		newline = newline || '\n' == src[i] || '\r' == src[i]
+	}
+	return i, newline
+}
+
+// quoted returns the index after the string starting with the quote at i,
+// skipping escaped characters, or the end of the source if it is unterminated.
+func quoted(src []byte, i int) int {
+	quote := src[i]
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// lastByte returns the last byte written to the buffer or 0 if it is empty.
+func lastByte(out *bytes.Buffer) byte {
+	if 0 == out.Len() {
+		return 0
+	}
+	return out.Bytes()[out.Len()-1]
+}
+
+// minifyCSS removes comments, other than '/*!' comments, and whitespace that
+// is not needed around braces, semicolons, commas, colons and combinators, and
+// the last semicolon of each block.
+func minifyCSS(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src))
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case '"' == c || '\'' == c:
+			end := quoted(src, i)
+			out.Write(src[i:end])
+			i = end
+		case '/' == c && i+1 < len(src) && '*' == src[i+1]:
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if 0 > end {
+				end = len(src)
+			} else {
+				end += i + 4
+			}
+			if i+2 < len(src) && '!' == src[i+2] {
+				out.Write(src[i:end])
+			}
+			i = end
+		case isSpace(c):
+			next, _ := skipSpace(src, i)
+			i = next
+			if 0 == out.Len() || len(src) == next ||
+				bytes.IndexByte([]byte("{};,>~:"), lastByte(&out)) >= 0 ||
+				bytes.IndexByte([]byte("{};,>~)!"), src[next]) >= 0 {
+				continue
+			}
+			out.WriteByte(' ')
+		case '}' == c && ';' == lastByte(&out):
+			out.Truncate(out.Len() - 1)
+			out.WriteByte(c)
+			i++
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
+
+// regexpFollows lists the characters after which a slash in JavaScript starts
+// a regular expression rather than a division.
+const regexpFollows = "(,=:[!&|?{};+-*%<>~^"
+
+// regexpKeywords are the keywords after which a slash in JavaScript starts a
+// regular expression.
+var regexpKeywords = [][]byte{
+	[]byte("return"), []byte("typeof"), []byte("case"), []byte("do"),
+	[]byte("else"), []byte("in"), []byte("instanceof"), []byte("new"),
+	[]byte("throw"), []byte("void"), []byte("delete"), []byte("yield"),
+	[]byte("await"),
+}
+
+// startsRegexp returns true if a slash following the minified output starts a
+// regular expression.
+func startsRegexp(out []byte) bool {
+	if 0 == len(out) {
+		return true
+	}
+	last := out[len(out)-1]
+	if 0 <= bytes.IndexByte([]byte(regexpFollows), last) || '\n' == last {
+		return true
+	}
+	start := len(out)
+	for 0 < start && isIdentifier(out[start-1]) {
+		start--
+	}
+	for _, keyword := range regexpKeywords {
+		if bytes.Equal(out[start:], keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexpEnd returns the index after the regular expression, including its
+// flags, starting with the slash at i.
+func regexpEnd(src []byte, i int) int {
+	class := false
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			class = true
+		case ']':
+			class = false
+		case '\n':
+			return i
+		case '/':
+			if !class {
+				for i++; i < len(src) && isIdentifier(src[i]); i++ {
+				}
+				return i
+			}
+		}
+	}
+	return len(src)
+}
+
+// minifyJS removes comments and collapses whitespace, keeping a line break
+// where one was removed unless it follows or precedes punctuation that cannot
+// end or continue a statement, so automatic semicolon insertion is unchanged.
+// Strings, template literals and regular expressions are unchanged. Sources
+// with a slash following a closing parenthesis are returned unchanged.
+func minifyJS(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src))
+	// Brace depths of the template literal substitutions being minified.
+	var templates []int
+	depth := 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case '"' == c || '\'' == c:
+			end := quoted(src, i)
+			out.Write(src[i:end])
+			i = end
+		case '`' == c || ('}' == c && 0 < len(templates) && templates[len(templates)-1] == depth):
+			if '}' == c {
+				templates = templates[:len(templates)-1]
+			}
+			end := i + 1
+			for ; end < len(src) && '`' != src[end]; end++ {
+				if '\\' == src[end] {
+					end++
+				} else if '$' == src[end] && end+1 < len(src) && '{' == src[end+1] {
+					end++
+					templates = append(templates, depth)
+					break
+				}
+			}
+			if end < len(src) {
+				end++
+			}
+			out.Write(src[i:end])
+			i = end
+		case isSpace(c) || bytes.HasPrefix(src[i:], []byte("//")) ||
+			bytes.HasPrefix(src[i:], []byte("/*")):
+			next, newline := skipJSSpace(src, i)
+			i = next
+			writeSpace(&out, src, next, newline)
+		case '/' == c && ')' == lastByte(&out):
+			// A slash after a parenthesis divides, as in '(a + b) / 2', or
+			// starts a regular expression, as in 'if (a) /b  c/.test(s)',
+			// which cannot be told apart without parsing.
+			return src
+		case '/' == c && startsRegexp(bytes.TrimRight(out.Bytes(), " ")):
+			end := regexpEnd(src, i)
+			out.Write(src[i:end])
+			i = end
+		default:
+			if '{' == c {
+				depth++
+			} else if '}' == c {
+				depth--
+			}
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
+
+// skipJSSpace returns the index of the first byte at or after i that is not
+// whitespace or part of a comment and whether a line break was skipped.
+func skipJSSpace(src []byte, i int) (int, bool) {
+	newline := false
+	for i < len(src) {
+		var skipped bool
+		switch {
+		case isSpace(src[i]):
+			i, skipped = skipSpace(src, i)
+		case bytes.HasPrefix(src[i:], []byte("//")):
+			end := bytes.IndexByte(src[i:], '\n')
+			if 0 > end {
+				return len(src), newline
+			}
+			i += end
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if 0 > end {
+				return len(src), newline
+			}
+			skipped = 0 <= bytes.IndexByte(src[i:i+end+2], '\n')
+			i += end + 4
+		default:
+			return i, newline
+		}
+		newline = newline || skipped
+	}
+	return i, newline
+}
+
+// writeSpace writes the whitespace needed between the minified output and the
+// source at next, a line break if one was skipped and may end a statement.
+func writeSpace(out *bytes.Buffer, src []byte, next int, newline bool) {
+	last := lastByte(out)
+	if 0 == last || len(src) == next || ' ' == last || '\n' == last {
+		return
+	}
+	following := src[next]
+	if newline && 0 > bytes.IndexByte([]byte("{;,(["), last) &&
+		0 > bytes.IndexByte([]byte("}),;]"), following) {
+		out.WriteByte('\n')
+		return
+	}
+	if isIdentifier(last) && isIdentifier(following) ||
+		('+' == last || '-' == last) && ('+' == following || '-' == following) ||
+		'/' == last && ('/' == following || '*' == following) {
+		out.WriteByte(' ')
+	}
+}
+
+// minifyHTML removes comments, other than conditional comments, and collapses
+// whitespace to a single space, outside of quoted attribute values and the
+// contents of 'pre' and 'textarea' elements. The contents of 'style' elements
+// are minified as CSS and of 'script' elements as JavaScript, unless their
+// type is not JavaScript.
+func minifyHTML(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src))
+	lower := asciiLower(src)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if 0 > end {
+				end = len(src)
+			} else {
+				end += i + 7
+			}
+			if bytes.HasPrefix(src[i:], []byte("<!--[if")) ||
+				bytes.HasPrefix(src[i:], []byte("<!--<![endif]")) {
+				out.Write(src[i:end])
+			}
+			i = end
+		case '<' == c:
+			end := tagEnd(src, i)
+			tag := src[i:end]
+			writeTag(&out, tag)
+			i = end
+			name := tagName(lower[i-len(tag) : i])
+			switch name {
+			case "pre", "textarea", "script", "style":
+				closing := bytes.Index(lower[i:], []byte("</"+name))
+				if 0 > closing {
+					closing = len(src)
+				} else {
+					closing += i
+				}
+				contents := src[i:closing]
+				switch {
+				case "style" == name:
+					contents = minifyCSS(contents)
+				case "script" == name && isJavaScript(lower[i-len(tag):i]):
+					contents = minifyJS(contents)
+				}
+				out.Write(contents)
+				i = closing
+			}
+		case isSpace(c):
+			next, _ := skipSpace(src, i)
+			out.WriteByte(' ')
+			i = next
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return bytes.TrimSpace(out.Bytes())
+}
+
+// tagEnd returns the index after the tag starting at i, skipping quoted
+// attribute values.
+func tagEnd(src []byte, i int) int {
+	for i++; i < len(src); i++ {
+		switch src[i] {
+		case '"', '\'':
+			i = quoted(src, i) - 1
+		case '>':
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// writeTag writes the tag with whitespace outside of quoted attribute values
+// collapsed to a single space, and removed before the end of the tag.
+func writeTag(out *bytes.Buffer, tag []byte) {
+	for i := 0; i < len(tag); {
+		c := tag[i]
+		switch {
+		case '"' == c || '\'' == c:
+			end := quoted(tag, i)
+			out.Write(tag[i:end])
+			i = end
+		case isSpace(c):
+			next, _ := skipSpace(tag, i)
+			i = next
+			if next < len(tag) && '>' != tag[next] &&
+				!('/' == tag[next] && next+1 < len(tag) && '>' == tag[next+1]) {
+				out.WriteByte(' ')
+			}
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+}
+
+// tagName returns the lower case name of an opening tag or an empty string for
+// closing tags and declarations.
+func tagName(tag []byte) string {
+	end := 1
+	for end < len(tag) && ('a' <= tag[end] && 'z' >= tag[end] || '0' <= tag[end] && '9' >= tag[end]) {
+		end++
+	}
+	return string(tag[1:end])
+}
+
+// isJavaScript returns true if the lower case script tag has no type or a
+// JavaScript type.
+func isJavaScript(tag []byte) bool {
+	for _, attribute := range bytes.Fields(bytes.TrimSuffix(tag, []byte(">"))) {
+		if bytes.HasPrefix(attribute, []byte("type=")) {
+			switch string(bytes.Trim(attribute[len("type="):], `"'`)) {
+			case "", "module", "text/javascript", "application/javascript":
+				return true
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// asciiLower returns a copy of the source with ASCII letters in lower case,
+// keeping the indexes of other bytes.
+func asciiLower(src []byte) []byte {
+	lower := make([]byte, len(src))
+	for i, c := range src {
+		if 'A' <= c && 'Z' >= c {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	return lower
+}
@@ -0,0 +1,171 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMinifyCSS(t *testing.T) {
+	testCases := []struct {
+		name     string
+		css      string
+		expected string
+	}{
+		{"Rule", "a , b > c {\n  color: red ;\n  margin: 0 auto;\n}\n", "a,b>c{color:red;margin:0 auto}"},
+		{"Comments", "/* one */a{b:c}/*! license */", "a{b:c}/*! license */"},
+		{"Strings", `a::after { content: "x  ;  y" }`, `a::after{content:"x  ;  y"}`},
+		{"Descendant pseudo", "a :hover{b:c}", "a :hover{b:c}"},
+		{"Calc", "a{width:calc(1px + 2px) !important}", "a{width:calc(1px + 2px)!important}"},
+		{"Media", "@media screen and (max-width: 10px) { a { b: c; } }",
+			"@media screen and (max-width:10px){a{b:c}}"},
+	}
+	for _, tc := range testCases {
+		if minified := string(minifyCSS([]byte(tc.css))); tc.expected != minified {
+			t.Errorf("For %s expected '%s' but got '%s'", tc.name, tc.expected, minified)
+		}
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	testCases := []struct {
+		name     string
+		js       string
+		expected string
+	}{
+		{"Statements", "var a = 1 ;\nvar b = a + 2;\n", "var a=1;var b=a+2;"},
+		{"Line breaks kept", "var a = b\n(c)\nreturn\nx", "var a=b\n(c)\nreturn\nx"},
+		{"Blocks", "function f ( a ) {\n  return a;\n}\n", "function f(a){return a;}"},
+		{"Comments", "a = 1; // one\n/* two\n */ b = 2 /* three */ + c",
+			"a=1;b=2+c"},
+		{"Increments", "a = b + +c - -d", "a=b+ +c- -d"},
+		{"Strings", `s = "a  // b" + 'c /* d */'`, `s="a  // b"+'c /* d */'`},
+		{"Template", "s = `a  ${ b + `c  ${ d }` }  e` ;", "s=`a  ${b+`c  ${d}`}  e`;"},
+		{"Regexp", "r = / a  b /g . test(s)", "r=/ a  b /g.test(s)"},
+		{"Regexp after keyword", "return /a  b/.test(s)", "return/a  b/.test(s)"},
+		{"Division", "x = a / b / c", "x=a/b/c"},
+		{"Regexp after parenthesis", "if (a) /b  c/.test(s) ;", "if (a) /b  c/.test(s) ;"},
+		{"Division after parenthesis", "x = (a) / 2 ;", "x = (a) / 2 ;"},
+	}
+	for _, tc := range testCases {
+		if minified := string(minifyJS([]byte(tc.js))); tc.expected != minified {
+			t.Errorf("For %s expected '%s' but got '%s'", tc.name, tc.expected, minified)
+		}
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{"Whitespace", "<p>\n  Hello   <b>world</b>\n</p>\n", "<p> Hello <b>world</b> </p>"},
+		{"Comments", "<p>a<!-- note -->b</p><!--[if IE]>x<![endif]-->",
+			"<p>ab</p><!--[if IE]>x<![endif]-->"},
+		{"Attributes", "<a  href=\"a  b\"\n  class='c' >x</a><br />",
+			"<a href=\"a  b\" class='c'>x</a><br/>"},
+		{"Pre", "<PRE>  a\n   b </PRE> <textarea> c  </textarea>",
+			"<PRE>  a\n   b </PRE> <textarea> c  </textarea>"},
+		{"Style", "<style>\n a { b: c; }\n</style>", "<style>a{b:c}</style>"},
+		{"Script", "<script>\n var a = 1;\n</script>", "<script>var a=1;</script>"},
+		{"Other script", "<script type=\"text/template\">\n  <p>  x</p>\n</script>",
+			"<script type=\"text/template\">\n  <p>  x</p>\n</script>"},
+	}
+	for _, tc := range testCases {
+		if minified := string(minifyHTML([]byte(tc.html))); tc.expected != minified {
+			t.Errorf("For %s expected '%s' but got '%s'", tc.name, tc.expected, minified)
+		}
+	}
+}
+
+func TestWithMinify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		method   string
+		ctype    string
+		contents string
+		expected string
+	}{
+		{"CSS", "GET", "text/css; charset=utf-8", "a {\n  b: c;\n}\n", "a{b:c}"},
+		{"JavaScript", "GET", "text/javascript", "var a = 1 ;\n", "var a=1;"},
+		{"HTML", "GET", "text/html", "<p>\n  a\n</p>\n", "<p> a </p>"},
+		{"Other type", "GET", "text/plain", "a {\n  b: c;\n}\n", "a {\n  b: c;\n}\n"},
+		{"Head", "HEAD", "text/css", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			serve := func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Content-Type", tc.ctype)
+				w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				w.Header().Set("Content-Length", strconv.Itoa(len(tc.contents)))
+				w.Write([]byte(tc.contents))
+			}
+			handler := WithMinify(serve)
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(tc.method, "http://localhost/file", nil)
+				w := httptest.NewRecorder()
+
+				handler(w, req)
+
+				if ok != w.Code {
+					t.Errorf("For %s expected status code %d but got %d", tc.name, ok, w.Code)
+				}
+				if contents := w.Body.String(); tc.expected != contents {
+					t.Errorf("For %s expected '%s' but got '%s'", tc.name, tc.expected, contents)
+				}
+				if http.MethodGet != tc.method {
+					continue
+				}
+				length := strconv.Itoa(len(tc.expected))
+				if actual := w.Header().Get("Content-Length"); length != actual {
+					t.Errorf("For %s expected length %s but got %s", tc.name, length, actual)
+				}
+			}
+			if 2 != calls {
+				t.Errorf("For %s expected the file served each time but got %d", tc.name, calls)
+			}
+		})
+	}
+}
+
+func TestWithMinifyValidators(t *testing.T) {
+	style := "a {\n  b: c;\n}\n"
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"original"`)
+		http.ServeContent(w, r, "style.css", time.Time{}, strings.NewReader(style))
+	}
+	handler := WithMinify(serve)
+
+	get := httptest.NewRecorder()
+	handler(get, httptest.NewRequest("GET", "http://localhost/style.css", nil))
+	head := httptest.NewRecorder()
+	handler(head, httptest.NewRequest("HEAD", "http://localhost/style.css", nil))
+
+	if "a{b:c}" != get.Body.String() || 0 != head.Body.Len() {
+		t.Errorf("Expected the minified body for GET only but got '%s' and '%s'", get.Body, head.Body)
+	}
+	for _, w := range []*httptest.ResponseRecorder{get, head} {
+		if length := w.Header().Get("Content-Length"); "6" != length {
+			t.Errorf("Expected the minified length but got '%s'", length)
+		}
+		if etag := w.Header().Get("ETag"); `W/"original"` != etag {
+			t.Errorf("Expected a weak ETag but got '%s'", etag)
+		}
+	}
+
+	// Weak validators still match conditional requests.
+	req := httptest.NewRequest("GET", "http://localhost/style.css", nil)
+	req.Header.Set("If-None-Match", `W/"original"`)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if http.StatusNotModified != w.Code {
+		t.Errorf("Expected status code %d but got %d", http.StatusNotModified, w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package handle
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+)
+
+// MmapDir is the Storage of a folder on the local file system, like Dir,
+// reading regular files of at least MinSize bytes through read-only memory
+// maps instead of read system calls. Concurrent downloads of a popular file
+// share its pages in the page cache. Mapped files are copied to clients
+// through user space rather than with sendfile, and files must be replaced,
+// such as by renaming, rather than truncated while they are served. Files are
+// read normally where memory maps are not supported or mapping fails.
+type MmapDir struct {
+	Dir     Dir
+	MinSize int64
+}
+
+// Open the named file or folder for reading.
+func (dir MmapDir) Open(name string) (http.File, error) {
+	file, err := os.Open(dir.Dir.resolve(name))
+	if nil != err {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if nil != err || !info.Mode().IsRegular() ||
+		0 == info.Size() || dir.MinSize > info.Size() {
+		return file, nil
+	}
+	data, err := mmap(file, info.Size())
+	if nil != err {
+		return file, nil
+	}
+	return &mappedFile{Reader: bytes.NewReader(data), file: file, data: data}, nil
+}
+
+// Stat returns information describing the named file or folder.
+func (dir MmapDir) Stat(name string) (os.FileInfo, error) {
+	return dir.Dir.Stat(name)
+}
+
+// ReadDir returns information describing the contents of the named folder,
+// sorted by name.
+func (dir MmapDir) ReadDir(name string) ([]os.FileInfo, error) {
+	return dir.Dir.ReadDir(name)
+}
+
+// mappedFile reads the memory map of an open file.
+type mappedFile struct {
+	*bytes.Reader
+	file *os.File
+	data []byte
+}
+
+// Close removes the memory map and closes the file.
+func (f *mappedFile) Close() error {
+	err := munmap(f.data)
+	if closeErr := f.file.Close(); nil == err {
+		err = closeErr
+	}
+	return err
+}
+
+// Readdir of a file returns an error.
+func (f *mappedFile) Readdir(count int) ([]os.FileInfo, error) {
+	return f.file.Readdir(count)
+}
+
+// Stat returns information describing the file.
+func (f *mappedFile) Stat() (os.FileInfo, error) {
+	return f.file.Stat()
+}
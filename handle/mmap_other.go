@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package handle
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not supported, so files are read normally.
+func mmap(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("memory maps are not supported")
+}
+
+// munmap has nothing to remove.
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestMmapDir(t *testing.T) {
+	storage := MmapDir{Dir: Dir(baseDir), MinSize: int64(len(tmpSubFile))}
+
+	// Only regular files of at least the minimum size are mapped.
+	testCases := []struct {
+		name   string
+		mapped bool
+	}{
+		{"/" + tmpFileName, true},
+		{"/" + tmpSubFileName, true},
+		{"/" + tmpSubIndexName, false},
+		{"/" + subDir, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := storage.Open(tc.name)
+			if nil != err {
+				t.Fatalf("While opening got %v", err)
+			}
+			defer file.Close()
+			_, mapped := file.(*mappedFile)
+			if "windows" == runtime.GOOS || "plan9" == runtime.GOOS {
+				tc.mapped = false
+			}
+			if tc.mapped != mapped {
+				t.Errorf("Expected mapped %t but got %t", tc.mapped, mapped)
+			}
+		})
+	}
+	if _, err := storage.Open("/" + tmpBadName); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing file but got %v", err)
+	}
+
+	// Mapped files are served in the same way as files read normally.
+	expected := Basic(FileServer(Dir(baseDir)), "")
+	handler := Basic(FileServer(storage), "")
+	ranges := []string{"", "bytes=0-4", "bytes=-6"}
+	for _, name := range []string{"/" + tmpFileName, "/" + subDir} {
+		for _, byteRange := range ranges {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+name, nil)
+			req.Header.Set("Range", byteRange)
+			want, got := httptest.NewRecorder(), httptest.NewRecorder()
+			expected(want, req)
+			handler(got, req)
+			if want.Code != got.Code || want.Body.String() != got.Body.String() {
+				t.Errorf(
+					"For %s %s expected %d '%s' but got %d '%s'",
+					name, byteRange, want.Code, want.Body, got.Code, got.Body,
+				)
+			}
+		}
+	}
+}
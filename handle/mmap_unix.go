@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package handle
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of the file into memory for reading.
+func mmap(file *os.File, size int64) ([]byte, error) {
+	if int64(int(size)) != size {
+		return nil, errors.New("file too large to map")
+	}
+	return syscall.Mmap(
+		int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED,
+	)
+}
+
+// munmap removes the memory map.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,103 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Responses to noise requests accepted by WithNoise.
+const (
+	// NoiseNoContent answers noise requests with '204 No Content'.
+	NoiseNoContent = "no-content"
+	// NoiseSynthesize answers requests for icons with a transparent image and
+	// other noise requests with '204 No Content'.
+	NoiseSynthesize = "synthesize"
+)
+
+// noiseMaxAge of noise responses in caches, so browsers stop asking.
+const noiseMaxAge = "public, max-age=86400"
+
+var (
+	// transparentPNG is a transparent 1x1 PNG image.
+	transparentPNG = encodeTransparentPNG()
+
+	// transparentICO is a transparent 1x1 icon holding transparentPNG.
+	transparentICO = encodeTransparentICO(transparentPNG)
+)
+
+// encodeTransparentPNG returns a transparent 1x1 PNG image.
+func encodeTransparentPNG() []byte {
+	var encoded bytes.Buffer
+	png.Encode(&encoded, image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	return encoded.Bytes()
+}
+
+// encodeTransparentICO returns an icon with the PNG image as its only entry.
+func encodeTransparentICO(contents []byte) []byte {
+	header := make([]byte, 22)
+	binary.LittleEndian.PutUint16(header[2:], 1)   // Icon type.
+	binary.LittleEndian.PutUint16(header[4:], 1)   // Number of images.
+	header[6], header[7] = 1, 1                    // Width and height.
+	binary.LittleEndian.PutUint16(header[10:], 1)  // Color planes.
+	binary.LittleEndian.PutUint16(header[12:], 32) // Bits per pixel.
+	binary.LittleEndian.PutUint32(header[14:], uint32(len(contents)))
+	binary.LittleEndian.PutUint32(header[18:], uint32(len(header)))
+	return append(header, contents...)
+}
+
+// WithNoise wraps an HTTP request. GET and HEAD requests for URL paths matching
+// any of the patterns, such as '/favicon.ico' or '/apple-touch-icon*.png',
+// that are not files in the storage are answered with the response rather
+// than 'NOT FOUND', so browsers asking for icons a site does not have do not
+// fill the logs and metrics with errors. Files within the URL prefix are
+// served as usual. The patterns are in the form accepted by path.Match and
+// match the URL path or, without a leading '/', the name in any folder. All
+// other requests are passed through.
+func WithNoise(
+	serve http.HandlerFunc,
+	storage Storage,
+	urlPrefix string,
+	patterns []string,
+	response string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet != r.Method && http.MethodHead != r.Method ||
+			!matchesAny(patterns, r.URL.Path) {
+			serve(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, urlPrefix) {
+			name := strings.TrimPrefix(r.URL.Path, urlPrefix)
+			if info, err := storage.Stat(name); nil == err && !info.IsDir() {
+				serve(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Cache-Control", noiseMaxAge)
+		var contents []byte
+		if NoiseSynthesize == response {
+			switch strings.ToLower(path.Ext(r.URL.Path)) {
+			case ".ico":
+				w.Header().Set("Content-Type", "image/x-icon")
+				contents = transparentICO
+			case ".png":
+				w.Header().Set("Content-Type", "image/png")
+				contents = transparentPNG
+			}
+		}
+		if nil == contents {
+			Tracef(r, "answered noise request with no content")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		Tracef(r, "answered noise request with a transparent image")
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(contents))
+	}
+}
@@ -0,0 +1,95 @@
+package handle
+
+import (
+	"bytes"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithNoise(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noise")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "apple-touch-icon.png"), []byte("icon"), 0644)
+
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}
+	patterns := []string{"/favicon.ico", "/apple-touch-icon*.png", "browserconfig.xml"}
+
+	testCases := []struct {
+		name        string
+		response    string
+		method      string
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"No content icon", NoiseNoContent, "GET", "/favicon.ico", http.StatusNoContent, "", ""},
+		{"Synthesized icon", NoiseSynthesize, "GET", "/favicon.ico", ok, "image/x-icon", ""},
+		{"Synthesized image", NoiseSynthesize, "GET", "/apple-touch-icon-120x120-precomposed.png",
+			ok, "image/png", ""},
+		{"Synthesized other", NoiseSynthesize, "GET", "/docs/browserconfig.xml",
+			http.StatusNoContent, "", ""},
+		{"Head", NoiseNoContent, "HEAD", "/favicon.ico", http.StatusNoContent, "", ""},
+		{"Stored file", NoiseSynthesize, "GET", "/apple-touch-icon.png", ok, "", "served"},
+		{"Other method", NoiseNoContent, "POST", "/favicon.ico", ok, "", "served"},
+		{"Other file", NoiseNoContent, "GET", "/index.html", ok, "", "served"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithNoise(serve, Dir(dir), "", patterns, tc.response)
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Fatalf("For %s expected status code %d but got %d", tc.path, tc.code, w.Code)
+			}
+			if 0 < len(tc.body) {
+				if tc.body != w.Body.String() {
+					t.Errorf("For %s expected body '%s' but got '%s'", tc.path, tc.body, w.Body)
+				}
+				return
+			}
+			if noiseMaxAge != w.Header().Get("Cache-Control") {
+				t.Errorf("For %s expected the response to be cached", tc.path)
+			}
+			if contentType := w.Header().Get("Content-Type"); tc.contentType != contentType {
+				t.Errorf("For %s expected type '%s' but got '%s'", tc.path, tc.contentType, contentType)
+			}
+		})
+	}
+
+	// Synthesized images decode, and the icon holds the same image.
+	if _, err := png.Decode(bytes.NewReader(transparentPNG)); nil != err {
+		t.Errorf("While decoding the transparent image got %v", err)
+	}
+	if !bytes.Equal(transparentPNG, transparentICO[22:]) || 1 != transparentICO[4] {
+		t.Error("Expected the icon to hold only the transparent image")
+	}
+
+	// Files within the URL prefix are found by their name in the storage.
+	handler := WithNoise(serve, Dir(dir), "/prefix", []string{"*.png"}, NoiseNoContent)
+	for urlPath, code := range map[string]int{
+		"/prefix/apple-touch-icon.png": ok,
+		"/apple-touch-icon.png":        http.StatusNoContent,
+	} {
+		req := httptest.NewRequest("GET", "http://localhost"+urlPath, nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if code != w.Code {
+			t.Errorf("For %s expected status code %d but got %d", urlPath, code, w.Code)
+		}
+	}
+}
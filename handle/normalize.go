@@ -0,0 +1,121 @@
+package handle
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Policies for URL paths that proxies and CDNs may normalize differently,
+// accepted by WithPathPolicy.
+const (
+	// PathsReject refuses ambiguous paths with 'BAD REQUEST'.
+	PathsReject = "reject"
+	// PathsNormalize redirects ambiguous paths to their normalized form.
+	PathsNormalize = "normalize"
+)
+
+// maxPathDecodes limits how many times an encoded path is decoded while being
+// normalized.
+const maxPathDecodes = 3
+
+// WithPathPolicy wraps an HTTP request. Requests for ambiguous paths, which a
+// proxy or CDN in front of the server may resolve to a different file than
+// the server does, are refused or, if the policy is 'normalize', permanently
+// redirected to the normalized path. Paths are ambiguous if, once decoded,
+// they contain backslashes, percent-encoded bytes (from double encoding such
+// as '%252e'), dot or empty segments or control characters, or if they were
+// requested with an encoded slash ('%2f'). Paths that cannot be normalized,
+// such as those with control characters, are always refused. All other
+// requests are passed through.
+func WithPathPolicy(serve http.HandlerFunc, policy string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		problem := pathProblem(r.URL.Path, r.URL.RawPath)
+		if 0 == len(problem) {
+			serve(w, r)
+			return
+		}
+		if PathsNormalize == policy {
+			normalized := normalizePath(r.URL.Path)
+			if 0 == len(pathProblem(normalized, "")) {
+				Tracef(r, "redirected path with %s to '%s'", problem, normalized)
+				location := &url.URL{Path: normalized, RawQuery: r.URL.RawQuery}
+				code := http.StatusPermanentRedirect
+				if http.MethodGet == r.Method || http.MethodHead == r.Method {
+					code = http.StatusMovedPermanently
+				}
+				http.Redirect(w, r, location.String(), code)
+				return
+			}
+		}
+		Tracef(r, "refused path with %s", problem)
+		http.Error(w, "400 bad request", http.StatusBadRequest)
+	}
+}
+
+// pathProblem describes why the decoded URL path, requested as the raw path,
+// is ambiguous or returns an empty string if it is not.
+func pathProblem(decoded, raw string) string {
+	switch {
+	case strings.Contains(decoded, "\\"):
+		return "a backslash"
+	case strings.Contains(strings.ToLower(raw), "%2f"):
+		return "an encoded slash"
+	case hasEncoding(decoded):
+		return "an encoded byte"
+	case hasControl(decoded):
+		return "a control character"
+	case strings.Contains(decoded, "//"):
+		return "an empty segment"
+	}
+	for _, segment := range strings.Split(decoded, "/") {
+		if "." == segment || ".." == segment {
+			return "a dot segment"
+		}
+	}
+	return ""
+}
+
+// normalizePath decodes the URL path, replaces backslashes with slashes and
+// removes dot and empty segments, keeping any trailing slash.
+func normalizePath(urlPath string) string {
+	for i := 0; i < maxPathDecodes && hasEncoding(urlPath); i++ {
+		decoded, err := url.PathUnescape(urlPath)
+		if nil != err {
+			break
+		}
+		urlPath = decoded
+	}
+	urlPath = strings.ReplaceAll(urlPath, "\\", "/")
+	cleaned := path.Clean("/" + urlPath)
+	if strings.HasSuffix(urlPath, "/") && "/" != cleaned {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// hasEncoding returns true if the string contains a percent-encoded byte.
+func hasEncoding(s string) bool {
+	for i := 0; i+2 < len(s); i++ {
+		if '%' == s[i] && isHex(s[i+1]) && isHex(s[i+2]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHex returns true for hexadecimal digits.
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// hasControl returns true if the string contains an ASCII control character.
+func hasControl(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if 0x20 > s[i] || 0x7f == s[i] {
+			return true
+		}
+	}
+	return false
+}
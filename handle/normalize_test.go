@@ -0,0 +1,81 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithPathPolicy(t *testing.T) {
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}
+	reject := WithPathPolicy(serve, PathsReject)
+	normalize := WithPathPolicy(serve, PathsNormalize)
+
+	testCases := []struct {
+		name     string
+		method   string
+		target   string
+		rejected int
+		code     int
+		location string
+	}{
+		{"Plain", "GET", "/docs/file.txt", ok, ok, ""},
+		{"Folder", "GET", "/docs/", ok, ok, ""},
+		{"Encoded name", "GET", "/docs/my%20file.txt", ok, ok, ""},
+		{"Encoded dot in name", "GET", "/docs/file%2etxt", ok, ok, ""},
+		{"Query", "GET", "/docs/file.txt?a=%2e%2e", ok, ok, ""},
+		{"Encoded traversal", "GET", "/docs/%2e%2e/%2e%2e/etc/passwd",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/etc/passwd"},
+		{"Mixed case traversal", "GET", "/docs/%2E./secret",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/secret"},
+		{"Double encoded traversal", "GET", "/docs/%252e%252e/secret",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/secret"},
+		{"Triple encoded traversal", "GET", "/docs/%25252e%25252e/secret",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/secret"},
+		{"Encoded backslash", "GET", "/docs%5c..%5csecret",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/secret"},
+		{"Double encoded backslash", "GET", "/docs%255csecret",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/docs/secret"},
+		{"Mixed separators", "GET", "/docs\\sub/file.txt",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/docs/sub/file.txt"},
+		{"Encoded slash", "GET", "/docs%2fsecret",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/docs/secret"},
+		{"Dot segment", "GET", "/docs/./file.txt",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/docs/file.txt"},
+		{"Empty segment", "GET", "/docs//file.txt?v=1",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/docs/file.txt?v=1"},
+		{"Trailing slash kept", "GET", "/docs/sub/../",
+			http.StatusBadRequest, http.StatusMovedPermanently, "/docs/"},
+		{"Other method", "PUT", "/docs//file.txt",
+			http.StatusBadRequest, http.StatusPermanentRedirect, "/docs/file.txt"},
+		{"Encoded null", "GET", "/docs/file.txt%00.png",
+			http.StatusBadRequest, http.StatusBadRequest, ""},
+		{"Encoded newline", "GET", "/docs/%0d%0aSet-Cookie:a",
+			http.StatusBadRequest, http.StatusBadRequest, ""},
+		{"Double encoded null", "GET", "/docs/file.txt%2500.png",
+			http.StatusBadRequest, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.target, nil)
+			w := httptest.NewRecorder()
+			reject(w, req)
+			if tc.rejected != w.Code {
+				t.Errorf("For %s rejecting expected status code %d but got %d", tc.target, tc.rejected, w.Code)
+			}
+
+			req = httptest.NewRequest(tc.method, "http://localhost"+tc.target, nil)
+			w = httptest.NewRecorder()
+			normalize(w, req)
+			if tc.code != w.Code {
+				t.Errorf("For %s normalizing expected status code %d but got %d", tc.target, tc.code, w.Code)
+			}
+			if location := w.Header().Get("Location"); tc.location != location {
+				t.Errorf("For %s expected location '%s' but got '%s'", tc.target, tc.location, location)
+			}
+		})
+	}
+}
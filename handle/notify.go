@@ -0,0 +1,243 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events notified by a Notifier.
+const (
+	// NotifyFirstDownload is notified when a file added or changed since the
+	// server started is first downloaded.
+	NotifyFirstDownload = "first-download"
+	// NotifyAuthFailures is notified when the authentication failures within
+	// a window reach the threshold.
+	NotifyAuthFailures = "auth-failures"
+	// NotifyServerErrors is notified when the server error responses within
+	// a window reach the threshold.
+	NotifyServerErrors = "server-errors"
+	// NotifyAlerts is notified when Alerts are raised or resolved.
+	NotifyAlerts = "alerts"
+)
+
+// ValidNotifyEvent returns true if the event is notified by a Notifier.
+func ValidNotifyEvent(event string) bool {
+	switch event {
+	case NotifyFirstDownload, NotifyAuthFailures, NotifyServerErrors, NotifyAlerts:
+		return true
+	}
+	return false
+}
+
+// Notification of an event.
+type Notification struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Path    string    `json:"path,omitempty"`
+	Count   int       `json:"count,omitempty"`
+	Message string    `json:"message"`
+}
+
+// NotifyRules select the events notified and the thresholds of the counted
+// events. AuthFailures and ServerErrors are the responses within Window
+// needed for a notification.
+type NotifyRules struct {
+	Events       []string
+	AuthFailures int
+	ServerErrors int
+	Window       time.Duration
+}
+
+// Notifier posts notifications of access events to a webhook in batches, so
+// teams are alerted without a monitoring stack. The JSON body of each batch
+// holds a 'text' summary, as expected by Slack and compatible chat webhooks,
+// and the 'notifications'. Safe for concurrent use.
+type Notifier struct {
+	url    string
+	rules  NotifyRules
+	events map[string]bool
+	client *http.Client
+	now    func() time.Time
+
+	mutex        sync.Mutex
+	pending      []Notification
+	added        map[string]struct{}
+	authFailures windowCount
+	serverErrors windowCount
+}
+
+// windowCount counts events within fixed windows.
+type windowCount struct {
+	start time.Time
+	count int
+}
+
+// add an event at the time, returning the count within the current window.
+func (counter *windowCount) add(now time.Time, window time.Duration) int {
+	if !now.Before(counter.start.Add(window)) {
+		counter.start, counter.count = now, 0
+	}
+	counter.count++
+	return counter.count
+}
+
+// NewNotifier returns a notifier posting the events selected by the rules to
+// the URL.
+func NewNotifier(url string, rules NotifyRules) *Notifier {
+	events := make(map[string]bool, len(rules.Events))
+	for _, event := range rules.Events {
+		events[event] = true
+	}
+	return &Notifier{
+		url:    url,
+		rules:  rules,
+		events: events,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+		added:  make(map[string]struct{}),
+	}
+}
+
+// Changed is a WatchFunc remembering the files added or changed, so their
+// first download is notified.
+func (notifier *Notifier) Changed(names []string) {
+	if !notifier.events[NotifyFirstDownload] {
+		return
+	}
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	for _, name := range names {
+		notifier.added[name] = struct{}{}
+	}
+}
+
+// Run posts the pending notifications every interval until the context is
+// done, posting any remaining notifications before returning. Failures are
+// logged and the notifications dropped.
+func (notifier *Notifier) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+		if err := notifier.Flush(); nil != err {
+			log.Printf("Error: while calling notify webhook got %v\n", err)
+		}
+		if nil != ctx.Err() {
+			return
+		}
+	}
+}
+
+// Flush posts the pending notifications, if any, as one batch.
+func (notifier *Notifier) Flush() error {
+	notifier.mutex.Lock()
+	pending := notifier.pending
+	notifier.pending = nil
+	notifier.mutex.Unlock()
+	if 0 == len(pending) {
+		return nil
+	}
+
+	lines := make([]string, len(pending))
+	for i, notification := range pending {
+		lines[i] = notification.Message
+	}
+	body, err := json.Marshal(struct {
+		Text          string         `json:"text"`
+		Notifications []Notification `json:"notifications"`
+	}{strings.Join(lines, "\n"), pending})
+	if nil != err {
+		return err
+	}
+	resp, err := notifier.client.Post(notifier.url, "application/json", bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	resp.Body.Close()
+	if 300 <= resp.StatusCode {
+		return fmt.Errorf("notify webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Notify queues the notification if its event is selected.
+func (notifier *Notifier) Notify(notification Notification) {
+	if !notifier.events[notification.Event] {
+		return
+	}
+	notifier.mutex.Lock()
+	notifier.pending = append(notifier.pending, notification)
+	notifier.mutex.Unlock()
+}
+
+// observe the response to the request for the file of the name, queuing any
+// notification it triggers.
+func (notifier *Notifier) observe(r *http.Request, name string, code int) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	now := notifier.now()
+
+	switch {
+	case http.StatusUnauthorized == code && notifier.events[NotifyAuthFailures]:
+		count := notifier.authFailures.add(now, notifier.rules.Window)
+		if notifier.rules.AuthFailures == count {
+			notifier.pending = append(notifier.pending, Notification{
+				Time:  now.UTC(),
+				Event: NotifyAuthFailures,
+				Count: count,
+				Message: fmt.Sprintf(
+					"%d authentication failures within %v, the latest for %s",
+					count, notifier.rules.Window, r.URL.Path,
+				),
+			})
+		}
+	case 500 <= code && notifier.events[NotifyServerErrors]:
+		count := notifier.serverErrors.add(now, notifier.rules.Window)
+		if notifier.rules.ServerErrors == count {
+			notifier.pending = append(notifier.pending, Notification{
+				Time:  now.UTC(),
+				Event: NotifyServerErrors,
+				Count: count,
+				Message: fmt.Sprintf(
+					"%d server errors within %v, the latest %d for %s",
+					count, notifier.rules.Window, code, r.URL.Path,
+				),
+			})
+		}
+	case http.MethodGet == r.Method && (http.StatusOK == code ||
+		http.StatusPartialContent == code):
+		if _, found := notifier.added[name]; !found {
+			return
+		}
+		delete(notifier.added, name)
+		notifier.pending = append(notifier.pending, Notification{
+			Time:    now.UTC(),
+			Event:   NotifyFirstDownload,
+			Path:    r.URL.Path,
+			Message: fmt.Sprintf("First download of %s", r.URL.Path),
+		})
+	}
+}
+
+// WithNotifier wraps an HTTP request, passing its response to the notifier.
+// The URL prefix is removed from request paths to find the names of files.
+func WithNotifier(
+	serve http.HandlerFunc, notifier *Notifier, urlPrefix string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := newStatusWriter(w)
+		serve(recorder, r)
+		notifier.observe(r, strings.TrimPrefix(r.URL.Path, urlPrefix), recorder.Status())
+		recorder.release()
+	}
+}
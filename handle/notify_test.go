@@ -0,0 +1,122 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithNotifier(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	notifier := NewNotifier("", NotifyRules{
+		Events:       []string{NotifyFirstDownload, NotifyAuthFailures, NotifyServerErrors},
+		AuthFailures: 2,
+		ServerErrors: 3,
+		Window:       time.Minute,
+	})
+	notifier.now = func() time.Time { return now }
+	notifier.Changed([]string{"/new.zip"})
+	codes := map[string]int{"/new.zip": ok, "/old.zip": ok, "/secret": 401, "/broken": 500}
+	handler := WithNotifier(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(codes[r.URL.Path[len("/prefix"):]])
+	}, notifier, "/prefix")
+
+	requests := []struct {
+		method  string
+		path    string
+		advance time.Duration
+	}{
+		{"HEAD", "/new.zip", 0},
+		{"GET", "/old.zip", 0},
+		{"GET", "/new.zip", 0},
+		{"GET", "/new.zip", 0},
+		{"GET", "/secret", 0},
+		{"GET", "/secret", 0},
+		{"GET", "/secret", 0},
+		{"GET", "/broken", 0},
+		{"GET", "/broken", 0},
+		{"GET", "/broken", time.Minute},
+		{"GET", "/broken", 0},
+		{"GET", "/broken", 0},
+	}
+	for _, request := range requests {
+		now = now.Add(request.advance)
+		handler(httptest.NewRecorder(), httptest.NewRequest(request.method, "/prefix"+request.path, nil))
+	}
+
+	var events []string
+	for _, notification := range notifier.pending {
+		events = append(events, notification.Event+" "+notification.Path)
+	}
+	expected := []string{
+		NotifyFirstDownload + " /prefix/new.zip",
+		NotifyAuthFailures + " ",
+		NotifyServerErrors + " ",
+	}
+	if !reflect.DeepEqual(expected, events) {
+		t.Errorf("Expected notifications %v but got %v", expected, events)
+	}
+}
+
+func TestNotifierEvents(t *testing.T) {
+	notifier := NewNotifier("", NotifyRules{
+		Events: []string{NotifyServerErrors}, ServerErrors: 1, Window: time.Minute,
+	})
+	notifier.Changed([]string{"/new.zip"})
+	for _, code := range []int{ok, 401, 503} {
+		notifier.observe(httptest.NewRequest("GET", "/new.zip", nil), "/new.zip", code)
+	}
+	if 1 != len(notifier.pending) || NotifyServerErrors != notifier.pending[0].Event {
+		t.Errorf("Expected only a server errors notification but got %v", notifier.pending)
+	}
+}
+
+func TestNotifierRun(t *testing.T) {
+	type batch struct {
+		Text          string         `json:"text"`
+		Notifications []Notification `json:"notifications"`
+	}
+	batches := make(chan batch, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received batch
+		json.NewDecoder(r.Body).Decode(&received)
+		batches <- received
+	}))
+	defer server.Close()
+
+	notifier := NewNotifier(server.URL, NotifyRules{Events: []string{NotifyFirstDownload}})
+	notifier.Changed([]string{"/a.zip", "/b.zip"})
+	for _, name := range []string{"/a.zip", "/b.zip"} {
+		notifier.observe(httptest.NewRequest("GET", name, nil), name, ok)
+	}
+
+	// Remaining notifications are posted once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	notifier.Run(ctx, time.Hour)
+	select {
+	case received := <-batches:
+		expected := "First download of /a.zip\nFirst download of /b.zip"
+		if expected != received.Text || 2 != len(received.Notifications) {
+			t.Errorf("Expected a batch of 2 with '%s' but got %v", expected, received)
+		}
+	default:
+		t.Fatal("Expected a batch to be posted")
+	}
+
+	// Nothing is posted without notifications.
+	if err := notifier.Flush(); nil != err || 0 != len(batches) {
+		t.Errorf("Expected nothing posted but got %v with %d batches", err, len(batches))
+	}
+
+	failing := NewNotifier(server.URL+"/missing", NotifyRules{})
+	failing.pending = []Notification{{Message: "message"}}
+	server.Config.Handler = http.NotFoundHandler()
+	if err := failing.Flush(); nil == err {
+		t.Error("Expected an error from a failing webhook")
+	}
+}
@@ -0,0 +1,318 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const (
+	// ocspRetry is how long to wait before fetching a failed OCSP response
+	// again.
+	ocspRetry = 5 * time.Minute
+
+	// ocspMinRefresh and ocspMaxRefresh bound how long a stapled OCSP response
+	// is served before it is refreshed.
+	ocspMinRefresh = time.Minute
+	ocspMaxRefresh = 24 * time.Hour
+)
+
+var (
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasic     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidSignatureAlgs = []struct {
+		oid       asn1.ObjectIdentifier
+		algorithm x509.SignatureAlgorithm
+	}{
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+		{asn1.ObjectIdentifier{1, 3, 101, 112}, x509.PureEd25519},
+	}
+)
+
+// The ASN.1 structures of RFC 6960 used to request and verify OCSP responses.
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequestEntry struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	RequestList []ocspRequestEntry
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspResponseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// ocspCertIDOf returns the SHA-1 identifier of the certificate issued by the
+// issuer.
+func ocspCertIDOf(leaf, issuer *x509.Certificate) (ocspCertID, error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); nil != err {
+		return ocspCertID{}, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(publicKeyInfo.PublicKey.RightAlign())
+	return ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      nameHash[:],
+		IssuerKeyHash: keyHash[:],
+		SerialNumber:  leaf.SerialNumber,
+	}, nil
+}
+
+// ocspStatus is a verified OCSP response of a good certificate.
+type ocspStatus struct {
+	thisUpdate time.Time
+	nextUpdate time.Time
+}
+
+// parseOCSPResponse verifies the DER encoded OCSP response is signed by the
+// issuer, or by a responder the issuer delegated to, and reports the
+// certificate as good.
+func parseOCSPResponse(der []byte, leaf, issuer *x509.Certificate) (ocspStatus, error) {
+	var response ocspResponse
+	if rest, err := asn1.Unmarshal(der, &response); nil != err {
+		return ocspStatus{}, err
+	} else if 0 < len(rest) {
+		return ocspStatus{}, errors.New("trailing data after the OCSP response")
+	}
+	if 0 != response.Status {
+		return ocspStatus{}, fmt.Errorf("OCSP responder returned status %d", response.Status)
+	}
+	if !response.Response.ResponseType.Equal(oidOCSPBasic) {
+		return ocspStatus{}, errors.New("OCSP response is not a basic response")
+	}
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(response.Response.Response, &basic); nil != err {
+		return ocspStatus{}, err
+	}
+
+	// Responses are signed by the issuer or by a certificate it issued for
+	// signing OCSP responses.
+	signer := issuer
+	if 0 < len(basic.Certificates) {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if nil != err {
+			return ocspStatus{}, err
+		}
+		if !bytes.Equal(responder.Raw, issuer.Raw) {
+			if err = responder.CheckSignatureFrom(issuer); nil != err {
+				return ocspStatus{}, fmt.Errorf("OCSP responder is not delegated by the issuer: %v", err)
+			}
+			isDelegated := false
+			for _, usage := range responder.ExtKeyUsage {
+				isDelegated = isDelegated || x509.ExtKeyUsageOCSPSigning == usage
+			}
+			if !isDelegated {
+				return ocspStatus{}, errors.New("OCSP responder is not allowed to sign responses")
+			}
+		}
+		signer = responder
+	}
+	algorithm := x509.UnknownSignatureAlgorithm
+	for _, known := range oidSignatureAlgs {
+		if known.oid.Equal(basic.SignatureAlgorithm.Algorithm) {
+			algorithm = known.algorithm
+		}
+	}
+	if err := signer.CheckSignature(
+		algorithm, basic.TBSResponseData.Raw, basic.Signature.RightAlign(),
+	); nil != err {
+		return ocspStatus{}, fmt.Errorf("OCSP response signature is invalid: %v", err)
+	}
+
+	for _, single := range basic.TBSResponseData.Responses {
+		if 0 != leaf.SerialNumber.Cmp(single.CertID.SerialNumber) {
+			continue
+		}
+		switch {
+		case bool(single.Good):
+		case bool(single.Unknown):
+			return ocspStatus{}, errors.New("OCSP responder does not know the certificate")
+		default:
+			return ocspStatus{}, fmt.Errorf(
+				"certificate was revoked at %s", single.Revoked.RevocationTime,
+			)
+		}
+		if now := time.Now(); !single.NextUpdate.IsZero() && now.After(single.NextUpdate) {
+			return ocspStatus{}, errors.New("OCSP response has expired")
+		}
+		return ocspStatus{thisUpdate: single.ThisUpdate, nextUpdate: single.NextUpdate}, nil
+	}
+	return ocspStatus{}, errors.New("OCSP response does not cover the certificate")
+}
+
+// fetchOCSP requests the OCSP response of the certificate from the first
+// responder it names, returning the DER encoded response once verified.
+func fetchOCSP(
+	client *http.Client, leaf, issuer *x509.Certificate,
+) ([]byte, ocspStatus, error) {
+	if 0 == len(leaf.OCSPServer) {
+		return nil, ocspStatus{}, errors.New("certificate names no OCSP responder")
+	}
+	id, err := ocspCertIDOf(leaf, issuer)
+	if nil != err {
+		return nil, ocspStatus{}, err
+	}
+	request, err := asn1.Marshal(ocspRequest{
+		TBSRequest: ocspTBSRequest{RequestList: []ocspRequestEntry{{Cert: id}}},
+	})
+	if nil != err {
+		return nil, ocspStatus{}, err
+	}
+	resp, err := client.Post(
+		leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(request),
+	)
+	if nil != err {
+		return nil, ocspStatus{}, err
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		return nil, ocspStatus{}, fmt.Errorf(
+			"OCSP responder '%s' returned %s", leaf.OCSPServer[0], resp.Status,
+		)
+	}
+	der, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return nil, ocspStatus{}, err
+	}
+	status, err := parseOCSPResponse(der, leaf, issuer)
+	return der, status, err
+}
+
+// Staple fetches the OCSP response of the current certificate and staples it
+// to the certificate, returning how long to wait before refreshing it. The
+// response is refreshed halfway through its validity. Certificates without an
+// issuer in their chain or an OCSP responder are served without a staple.
+func (reloader *CertificateReloader) Staple(client *http.Client) (time.Duration, error) {
+	reloader.mutex.RLock()
+	cert := reloader.cert
+	reloader.mutex.RUnlock()
+	if 2 > len(cert.Certificate) {
+		return ocspMaxRefresh, errors.New("certificate chain has no issuer to staple OCSP for")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if nil != err {
+		return ocspRetry, err
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if nil != err {
+		return ocspRetry, err
+	}
+	if 0 == len(leaf.OCSPServer) {
+		return ocspMaxRefresh, errors.New("certificate names no OCSP responder")
+	}
+	der, status, err := fetchOCSP(client, leaf, issuer)
+	if nil != err {
+		return ocspRetry, err
+	}
+
+	stapled := *cert
+	stapled.OCSPStaple = der
+	reloader.mutex.Lock()
+	// Keep a certificate reloaded while the response was fetched.
+	if reloader.cert == cert {
+		reloader.cert = &stapled
+	}
+	reloader.mutex.Unlock()
+
+	refresh := ocspMaxRefresh
+	if !status.nextUpdate.IsZero() {
+		refresh = time.Until(status.thisUpdate.Add(status.nextUpdate.Sub(status.thisUpdate) / 2))
+	}
+	if ocspMinRefresh > refresh {
+		refresh = ocspMinRefresh
+	} else if ocspMaxRefresh < refresh {
+		refresh = ocspMaxRefresh
+	}
+	return refresh, nil
+}
+
+// StapleOCSP staples the OCSP response of the certificate until the context
+// is done, refreshing it before it expires and whenever the certificate is
+// reloaded, so clients need not reach the OCSP responder of the CA.
+func (reloader *CertificateReloader) StapleOCSP(ctx context.Context) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for {
+		refresh, err := reloader.Staple(client)
+		if nil != err {
+			log.Printf("Error: while stapling the OCSP response got %v\n", err)
+		}
+		timer := time.NewTimer(refresh)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-reloader.changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
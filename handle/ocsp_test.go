@@ -0,0 +1,169 @@
+package handle
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testIssuer returns a CA certificate and its key.
+func testIssuer(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatalf("While generating a key got %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if nil != err {
+		t.Fatalf("While creating the CA got %v", err)
+	}
+	issuer, err := x509.ParseCertificate(der)
+	if nil != err {
+		t.Fatalf("While parsing the CA got %v", err)
+	}
+	return issuer, key
+}
+
+// testOCSPResponse returns an OCSP response for the serial, signed by the key.
+func testOCSPResponse(
+	t *testing.T, serial *big.Int, issuer *x509.Certificate, key *ecdsa.PrivateKey, revoked bool,
+) []byte {
+	leaf := &x509.Certificate{SerialNumber: serial}
+	id, err := ocspCertIDOf(leaf, issuer)
+	if nil != err {
+		t.Fatalf("While identifying the certificate got %v", err)
+	}
+	single := ocspSingleResponse{
+		CertID:     id,
+		Good:       asn1.Flag(!revoked),
+		ThisUpdate: time.Now().Add(-time.Hour).UTC().Truncate(time.Second),
+		NextUpdate: time.Now().Add(3 * time.Hour).UTC().Truncate(time.Second),
+	}
+	if revoked {
+		single.Revoked = ocspRevokedInfo{RevocationTime: single.ThisUpdate}
+	}
+	tbs, err := asn1.Marshal(ocspResponseData{
+		ResponderID: asn1.RawValue{Class: 2, Tag: 1, IsCompound: true, Bytes: issuer.RawSubject},
+		ProducedAt:  time.Now().UTC().Truncate(time.Second),
+		Responses:   []ocspSingleResponse{single},
+	})
+	if nil != err {
+		t.Fatalf("While encoding the response data got %v", err)
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if nil != err {
+		t.Fatalf("While signing the response got %v", err)
+	}
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    ocspResponseData{Raw: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSignatureAlgs[5].oid},
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if nil != err {
+		t.Fatalf("While encoding the basic response got %v", err)
+	}
+	der, err := asn1.Marshal(ocspResponse{
+		Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic},
+	})
+	if nil != err {
+		t.Fatalf("While encoding the response got %v", err)
+	}
+	return der
+}
+
+func TestStaple(t *testing.T) {
+	issuer, issuerKey := testIssuer(t)
+	_, otherKey := testIssuer(t)
+	var signer *ecdsa.PrivateKey
+	revoked := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request ocspRequest
+		if _, err := asn1.Unmarshal(body, &request); nil != err {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serial := request.TBSRequest.RequestList[0].Cert.SerialNumber
+		w.Write(testOCSPResponse(t, serial, issuer, signer, revoked))
+	}))
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if nil != err {
+		t.Fatalf("While generating a key got %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "ocsp.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{server.URL},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if nil != err {
+		t.Fatalf("While creating the certificate got %v", err)
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der, issuer.Raw}, PrivateKey: key}
+
+	testCases := []struct {
+		name    string
+		signer  *ecdsa.PrivateKey
+		revoked bool
+		isError bool
+	}{
+		{"Good", issuerKey, false, false},
+		{"Revoked", issuerKey, true, true},
+		{"Wrong signer", otherKey, false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			signer, revoked = tc.signer, tc.revoked
+			reloader := &CertificateReloader{cert: cert}
+			refresh, err := reloader.Staple(server.Client())
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			stapled, _ := reloader.GetCertificate(nil)
+			if tc.isError {
+				if 0 < len(stapled.OCSPStaple) || ocspRetry != refresh {
+					t.Errorf("Expected no staple and a retry but got %d bytes and %s",
+						len(stapled.OCSPStaple), refresh)
+				}
+				return
+			}
+			if 0 == len(stapled.OCSPStaple) {
+				t.Error("Expected a staple but got none")
+			}
+			// Refreshed halfway between the updates, an hour from now.
+			if refresh < 59*time.Minute || refresh > time.Hour {
+				t.Errorf("Expected a refresh in an hour but got %s", refresh)
+			}
+		})
+	}
+
+	reloader := &CertificateReloader{cert: &tls.Certificate{Certificate: [][]byte{der}}}
+	if _, err := reloader.Staple(server.Client()); nil == err {
+		t.Error("Without an issuer expected an error but got nil")
+	}
+}
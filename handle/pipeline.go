@@ -0,0 +1,173 @@
+package handle
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Middleware wraps an HTTP request handler, such as WithHeaders or WithCache
+// with their options applied.
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Stage is a named position in a Pipeline. A Stage without a Middleware passes
+// requests through, keeping its position available for inserting stages even
+// when it is disabled.
+type Stage struct {
+	Name       string
+	Middleware Middleware
+}
+
+// Pipeline of stages wrapping a handler in a deterministic order. Requests pass
+// through the stages in order, so the first stage receives each request first
+// and the last stage passes it to the handler.
+type Pipeline struct {
+	stages []Stage
+}
+
+// NewPipeline returns a pipeline of the stages, in order.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: append([]Stage(nil), stages...)}
+}
+
+// Append the stage after all other stages.
+func (pipeline *Pipeline) Append(name string, middleware Middleware) error {
+	return pipeline.insert(len(pipeline.stages), name, middleware)
+}
+
+// InsertBefore adds the stage so that it receives requests before the named
+// stage.
+func (pipeline *Pipeline) InsertBefore(
+	stage, name string, middleware Middleware,
+) error {
+	index, err := pipeline.index(stage)
+	if nil != err {
+		return err
+	}
+	return pipeline.insert(index, name, middleware)
+}
+
+// InsertAfter adds the stage so that it receives requests after the named
+// stage.
+func (pipeline *Pipeline) InsertAfter(
+	stage, name string, middleware Middleware,
+) error {
+	index, err := pipeline.index(stage)
+	if nil != err {
+		return err
+	}
+	return pipeline.insert(index+1, name, middleware)
+}
+
+// Replace the middleware of the named stage. A nil middleware disables the
+// stage.
+func (pipeline *Pipeline) Replace(stage string, middleware Middleware) error {
+	index, err := pipeline.index(stage)
+	if nil != err {
+		return err
+	}
+	pipeline.stages[index].Middleware = middleware
+	return nil
+}
+
+// Names of the stages, in order.
+func (pipeline *Pipeline) Names() []string {
+	names := make([]string, len(pipeline.stages))
+	for i, stage := range pipeline.stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// Then returns the handler wrapped by each enabled stage. Traced requests
+// record each stage they reach.
+func (pipeline *Pipeline) Then(handler http.HandlerFunc) http.HandlerFunc {
+	for i := len(pipeline.stages) - 1; 0 <= i; i-- {
+		if middleware := pipeline.stages[i].Middleware; nil != middleware {
+			handler = traceStage(pipeline.stages[i].Name, middleware(handler))
+		}
+	}
+	return handler
+}
+
+// index of the named stage.
+func (pipeline *Pipeline) index(stage string) (int, error) {
+	for i := range pipeline.stages {
+		if stage == pipeline.stages[i].Name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown pipeline stage '%s'", stage)
+}
+
+// insert the stage at the index, refusing duplicate names.
+func (pipeline *Pipeline) insert(
+	index int, name string, middleware Middleware,
+) error {
+	if _, err := pipeline.index(name); nil == err {
+		return fmt.Errorf("pipeline stage '%s' already exists", name)
+	}
+	pipeline.stages = append(pipeline.stages, Stage{})
+	copy(pipeline.stages[index+1:], pipeline.stages[index:])
+	pipeline.stages[index] = Stage{Name: name, Middleware: middleware}
+	return nil
+}
+
+// PrefixMiddleware applies the middleware to requests with URL paths within
+// the prefix.
+type PrefixMiddleware struct {
+	Prefix     string
+	Middleware Middleware
+}
+
+// ByPrefix returns middleware applying the middleware of the longest prefix
+// containing the request path, or fallback if there is none. Prefixes match
+// whole path segments, so '/public' contains '/public' and '/public/file.txt'
+// but not '/publications'. A nil middleware passes requests through.
+func ByPrefix(fallback Middleware, overrides []PrefixMiddleware) Middleware {
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		wrap := func(middleware Middleware) http.HandlerFunc {
+			if nil == middleware {
+				return serve
+			}
+			return middleware(serve)
+		}
+		defaultHandler := wrap(fallback)
+
+		prefixes := make([]string, len(overrides))
+		handlers := make([]http.HandlerFunc, len(overrides))
+		for i, override := range overrides {
+			prefixes[i] = override.Prefix
+			handlers[i] = wrap(override.Middleware)
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			match := -1
+			for i, prefix := range prefixes {
+				if withinPrefix(r.URL.Path, prefix) &&
+					(0 > match || len(prefixes[match]) < len(prefix)) {
+					match = i
+				}
+			}
+			if 0 > match {
+				defaultHandler(w, r)
+				return
+			}
+			if traced(r) {
+				Tracef(r, "override of prefix '%s'", prefixes[match])
+			}
+			handlers[match](w, r)
+		}
+	}
+}
+
+// withinPrefix returns true if the path is the prefix or within it, matching
+// whole path segments.
+func withinPrefix(urlPath, prefix string) bool {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return false
+	}
+	return len(urlPath) == len(prefix) ||
+		strings.HasSuffix(prefix, "/") ||
+		'/' == urlPath[len(prefix)]
+}
@@ -0,0 +1,102 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testStage returns middleware appending the name to the response body.
+func testStage(name string) Middleware {
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " "))
+			serve(w, r)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("handler"))
+	}
+	pipeline := NewPipeline(
+		Stage{"first", testStage("first")},
+		Stage{"disabled", nil},
+		Stage{"last", testStage("last")},
+	)
+
+	if err := pipeline.InsertBefore("first", "before", testStage("before")); nil != err {
+		t.Fatalf("While inserting before expected no error but got %v", err)
+	}
+	if err := pipeline.InsertAfter("disabled", "after", testStage("after")); nil != err {
+		t.Fatalf("While inserting after expected no error but got %v", err)
+	}
+	if err := pipeline.Append("appended", testStage("appended")); nil != err {
+		t.Fatalf("While appending expected no error but got %v", err)
+	}
+	if err := pipeline.Replace("last", testStage("replaced")); nil != err {
+		t.Fatalf("While replacing expected no error but got %v", err)
+	}
+
+	expectedNames := "before first disabled after last appended"
+	if names := strings.Join(pipeline.Names(), " "); expectedNames != names {
+		t.Errorf("Expected stages '%s' but got '%s'", expectedNames, names)
+	}
+
+	w := httptest.NewRecorder()
+	pipeline.Then(handler)(w, httptest.NewRequest("GET", "/", nil))
+	expected := "before first after replaced appended handler"
+	if body := w.Body.String(); expected != body {
+		t.Errorf("Expected order '%s' but got '%s'", expected, body)
+	}
+
+	// Stages must be unique and referenced stages must exist.
+	if err := pipeline.Append("first", nil); nil == err {
+		t.Error("While appending a duplicate expected an error but got nil")
+	}
+	if err := pipeline.InsertBefore("unknown", "new", nil); nil == err {
+		t.Error("While inserting before unknown expected an error but got nil")
+	}
+	if err := pipeline.InsertAfter("unknown", "new", nil); nil == err {
+		t.Error("While inserting after unknown expected an error but got nil")
+	}
+	if err := pipeline.Replace("unknown", nil); nil == err {
+		t.Error("While replacing unknown expected an error but got nil")
+	}
+}
+
+func TestByPrefix(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("handler"))
+	}
+	middleware := ByPrefix(testStage("default"), []PrefixMiddleware{
+		{"/public", testStage("public")},
+		{"/public/deep/", testStage("deep")},
+		{"/open", nil},
+	})(handler)
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "default handler"},
+		{"/public", "public handler"},
+		{"/public/file.txt", "public handler"},
+		{"/publications", "default handler"},
+		{"/public/deep/file.txt", "deep handler"},
+		{"/public/deep", "public handler"},
+		{"/open/file.txt", "handler"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			middleware(w, httptest.NewRequest("GET", tc.path, nil))
+			if body := w.Body.String(); tc.expected != body {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package handle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Outcomes of a PolicyRule.
+const (
+	// PolicyAllow serves the request.
+	PolicyAllow = "allow"
+	// PolicyDeny refuses the request with 'FORBIDDEN'.
+	PolicyDeny = "deny"
+	// PolicyRequireAuth serves the request only if the client is
+	// authenticated, otherwise returning 'UNAUTHORIZED'.
+	PolicyRequireAuth = "require-auth"
+)
+
+// countryKey is the request context key holding the client country.
+type countryKey struct{}
+
+// subjectKey is the request context key holding the authenticated subject.
+type subjectKey struct{}
+
+// PolicyRule matches requests by method, path and client attributes. Empty
+// lists match any value.
+type PolicyRule struct {
+	Outcome   string
+	Methods   []string
+	Path      *regexp.Regexp
+	Networks  []*net.IPNet
+	Countries []string
+	Subjects  []string
+	rule      string
+}
+
+// ParsePolicyRule converts a rule in the form
+// 'outcome methods glob [ip=cidr,...] [country=code,...] [subject=name,...]'
+// into a PolicyRule. The outcome is 'allow', 'deny' or 'require-auth'. Methods
+// are comma-separated or '*' for any method. In the path glob '**' matches any
+// characters, '*' matches any characters other than '/' and '?' matches a
+// single character other than '/'.
+func ParsePolicyRule(rule string) (parsed PolicyRule, err error) {
+	fields := strings.Fields(rule)
+	if 3 > len(fields) {
+		err = fmt.Errorf(
+			"invalid policy rule '%s': expected 'outcome methods glob'", rule,
+		)
+		return
+	}
+
+	parsed.rule = strings.Join(fields, " ")
+	switch parsed.Outcome = fields[0]; parsed.Outcome {
+	case PolicyAllow, PolicyDeny, PolicyRequireAuth:
+	default:
+		err = fmt.Errorf(
+			"invalid policy rule '%s': unknown outcome '%s'", rule, fields[0],
+		)
+		return
+	}
+	if "*" != fields[1] {
+		parsed.Methods = strings.Split(strings.ToUpper(fields[1]), ",")
+	}
+	parsed.Path = globExpression(fields[2])
+
+	for _, field := range fields[3:] {
+		index := strings.Index(field, "=")
+		if 0 > index {
+			err = fmt.Errorf(
+				"invalid policy rule '%s': expected 'name=value' but got '%s'",
+				rule, field,
+			)
+			return
+		}
+		values := strings.Split(field[index+1:], ",")
+		switch field[:index] {
+		case "ip":
+			for _, value := range values {
+				network, err := parseNetwork(value)
+				if nil != err {
+					return parsed, fmt.Errorf(
+						"invalid policy rule '%s': %v", rule, err,
+					)
+				}
+				parsed.Networks = append(parsed.Networks, network)
+			}
+		case "country":
+			for _, value := range values {
+				parsed.Countries = append(parsed.Countries, strings.ToUpper(value))
+			}
+		case "subject":
+			parsed.Subjects = append(parsed.Subjects, values...)
+		default:
+			err = fmt.Errorf(
+				"invalid policy rule '%s': unknown attribute '%s'",
+				rule, field[:index],
+			)
+			return
+		}
+	}
+	return
+}
+
+// ParsePolicyRules converts each rule using ParsePolicyRule.
+func ParsePolicyRules(rules []string) ([]PolicyRule, error) {
+	parsed := make([]PolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		result, err := ParsePolicyRule(rule)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// String representation of the rule in the form accepted by ParsePolicyRule.
+func (rule PolicyRule) String() string {
+	return rule.rule
+}
+
+// Matches returns true if the rule applies to the request.
+func (rule PolicyRule) Matches(r *http.Request) bool {
+	if 0 < len(rule.Methods) && !containsString(rule.Methods, r.Method) {
+		return false
+	}
+	if nil != rule.Path && !rule.Path.MatchString(r.URL.Path) {
+		return false
+	}
+	if 0 < len(rule.Networks) {
+		ip := clientIP(r)
+		matched := false
+		for _, network := range rule.Networks {
+			if nil != ip && network.Contains(ip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if 0 < len(rule.Countries) && !containsString(rule.Countries, Country(r)) {
+		return false
+	}
+	if 0 < len(rule.Subjects) && !containsString(rule.Subjects, Subject(r)) {
+		return false
+	}
+	return true
+}
+
+// WithPolicy wraps an HTTP request. The outcome of the first rule matching the
+// request decides whether it is served. Requests matching no rule are served.
+// Refused requests are logged and the deciding rule is added to the access
+// log. Later stages check other paths against the rules with Allowed.
+func WithPolicy(serve http.HandlerFunc, rules []PolicyRule) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = withAccessCheck(r, func(r *http.Request) (*http.Request, bool) {
+			for _, rule := range rules {
+				if rule.Matches(r) {
+					return r, PolicyAllow == rule.Outcome ||
+						(PolicyRequireAuth == rule.Outcome && 0 < len(Subject(r)))
+				}
+			}
+			return r, true
+		})
+		for _, rule := range rules {
+			if !rule.Matches(r) {
+				continue
+			}
+			r = annotate(r, "policy-rule", "'"+rule.String()+"'")
+			switch rule.Outcome {
+			case PolicyDeny:
+				audit(r, AuditEvent{Event: AuditPolicyDeny, Rule: rule.String()})
+				refusePolicy(w, r, http.StatusForbidden, "403 forbidden")
+				return
+			case PolicyRequireAuth:
+				if 0 == len(Subject(r)) {
+					audit(r, AuditEvent{Event: AuditPolicyDeny, Rule: rule.String()})
+					refusePolicy(w, r, http.StatusUnauthorized, "401 unauthorized")
+					return
+				}
+			}
+			break
+		}
+		serve(w, r)
+	}
+}
+
+// Country returns the client country resolved by WithGeoIP or an empty string
+// if unknown.
+func Country(r *http.Request) string {
+	country, _ := r.Context().Value(countryKey{}).(string)
+	return country
+}
+
+// Subject returns the authenticated subject of the request or an empty string
+// if the client is not authenticated.
+func Subject(r *http.Request) string {
+	subject, _ := r.Context().Value(subjectKey{}).(string)
+	return subject
+}
+
+// WithSubject returns a copy of the request authenticated as the subject,
+// allowing custom authentication ahead of WithPolicy.
+func WithSubject(r *http.Request, subject string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), subjectKey{}, subject))
+}
+
+// refusePolicy logs and returns the error status for the request.
+func refusePolicy(w http.ResponseWriter, r *http.Request, code int, msg string) {
+	log.Printf(
+		"DENY: %s %s %s%s policy %d%s\n",
+		r.Method,
+		r.Proto,
+		r.Host,
+		r.URL.Path,
+		code,
+		annotations(r),
+	)
+	http.Error(w, msg, code)
+}
+
+// globExpression converts the path glob into an anchored regular expression.
+// Wildcards match any character, including newlines decoded from '%0A'.
+func globExpression(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "**")
+	for i, part := range parts {
+		quoted := regexp.QuoteMeta(part)
+		quoted = strings.ReplaceAll(quoted, `\*`, "[^/]*")
+		parts[i] = strings.ReplaceAll(quoted, `\?`, "[^/]")
+	}
+	return regexp.MustCompile("(?s)^" + strings.Join(parts, ".*") + "$")
+}
+
+// parseNetwork converts a CIDR or single IP address into a network.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if nil == ip {
+			return nil, fmt.Errorf("invalid IP address '%s'", value)
+		}
+		bits := 8 * net.IPv6len
+		if nil != ip.To4() {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// containsString returns true if the value is in the list.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package handle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePolicyRule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    string
+		isError bool
+	}{
+		{"Minimal", "allow * /**", false},
+		{"Attributes", "deny GET,HEAD /private/* ip=10.0.0.0/8,::1 country=us subject=alice", false},
+		{"Require auth", "require-auth * /internal/**", false},
+		{"Missing glob", "allow *", true},
+		{"Unknown outcome", "permit * /**", true},
+		{"Bad attribute", "allow * /** country", true},
+		{"Unknown attribute", "allow * /** weather=rain", true},
+		{"Bad address", "allow * /** ip=10.0.0", true},
+		{"Bad network", "allow * /** ip=10.0.0.0/33", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParsePolicyRule(tc.rule)
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if !tc.isError && tc.rule != rule.String() {
+				t.Errorf("Expected '%s' but got '%s'", tc.rule, rule.String())
+			}
+		})
+	}
+
+	if _, err := ParsePolicyRules([]string{"allow * /**", "bad"}); nil == err {
+		t.Error("With a bad rule expected an error but got nil")
+	}
+}
+
+func TestPolicyRuleMatches(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rule     string
+		method   string
+		path     string
+		remote   string
+		country  string
+		subject  string
+		expected bool
+	}{
+		{"Any", "allow * /**", "GET", "/sub/file.txt", "1.2.3.4:80", "", "", true},
+		{"Method", "allow POST /**", "GET", "/file.txt", "1.2.3.4:80", "", "", false},
+		{"Single segment", "allow * /*.txt", "GET", "/sub/file.txt", "1.2.3.4:80", "", "", false},
+		{"Single character", "allow * /file.tx?", "GET", "/file.txt", "1.2.3.4:80", "", "", true},
+		{"Literal dot", "allow * /file.txt", "GET", "/filextxt", "1.2.3.4:80", "", "", false},
+		{"Newline", "deny * /secret/**", "GET", "/secret/a%0Ab", "1.2.3.4:80", "", "", true},
+		{"Newline in segment", "deny * /secret/*", "GET", "/secret/a%0Ab", "1.2.3.4:80", "", "", true},
+		{"Network", "allow * /** ip=10.0.0.0/8", "GET", "/", "10.1.2.3:80", "", "", true},
+		{"Outside network", "allow * /** ip=10.0.0.0/8", "GET", "/", "11.1.2.3:80", "", "", false},
+		{"Single address", "allow * /** ip=::1", "GET", "/", "[::1]:80", "", "", true},
+		{"Country", "allow * /** country=us", "GET", "/", "1.2.3.4:80", "US", "", true},
+		{"Other country", "allow * /** country=us", "GET", "/", "1.2.3.4:80", "CA", "", false},
+		{"Subject", "allow * /** subject=alice,bob", "GET", "/", "1.2.3.4:80", "", "bob", true},
+		{"Anonymous", "allow * /** subject=alice", "GET", "/", "1.2.3.4:80", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParsePolicyRule(tc.rule)
+			if nil != err {
+				t.Fatalf("While parsing rule got %v", err)
+			}
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			req.RemoteAddr = tc.remote
+			if 0 < len(tc.country) {
+				req = req.WithContext(
+					context.WithValue(req.Context(), countryKey{}, tc.country),
+				)
+			}
+			if 0 < len(tc.subject) {
+				req = WithSubject(req, tc.subject)
+			}
+			if matched := rule.Matches(req); tc.expected != matched {
+				t.Errorf("Expected match %t but got %t", tc.expected, matched)
+			}
+		})
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	rules, err := ParsePolicyRules([]string{
+		"allow * /public/**",
+		"deny * /** ip=192.0.2.0/24",
+		"require-auth * /internal/**",
+		"deny POST /**",
+	})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	handler := WithPolicy(Basic(http.ServeFile, baseDir), rules)
+
+	testCases := []struct {
+		name    string
+		method  string
+		path    string
+		remote  string
+		subject string
+		code    int
+	}{
+		{"No rule", "GET", "/" + tmpFileName, "1.2.3.4:80", "", ok},
+		{"Allowed before denied", "GET", "/public/missing", "192.0.2.1:80", "", missing},
+		{"Denied network", "GET", "/" + tmpFileName, "192.0.2.1:80", "", http.StatusForbidden},
+		{"Anonymous", "GET", "/internal/missing", "1.2.3.4:80", "", http.StatusUnauthorized},
+		{"Authenticated", "GET", "/internal/missing", "1.2.3.4:80", "alice", missing},
+		{"Authenticated denied later", "POST", "/internal/missing", "1.2.3.4:80", "alice", missing},
+		{"Denied method", "POST", "/" + tmpFileName, "1.2.3.4:80", "", http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			req.RemoteAddr = tc.remote
+			if 0 < len(tc.subject) {
+				req = WithSubject(req, tc.subject)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestCountry(t *testing.T) {
+	country := func(net.IP) string { return "CA" }
+	var resolved string
+	handler := WithGeoIP(func(w http.ResponseWriter, r *http.Request) {
+		resolved = Country(r)
+	}, country, nil, nil)
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if "CA" != resolved {
+		t.Errorf("Expected country 'CA' but got '%s'", resolved)
+	}
+}
@@ -0,0 +1,131 @@
+package handle
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Presigner signs URLs granting temporary access to the objects of an S3
+// bucket, or another object store accepting AWS Signature Version 4, such as
+// Google Cloud Storage with HMAC keys.
+type Presigner struct {
+	// BaseURL of the objects, such as 'https://bucket.s3.us-east-1.amazonaws.com'
+	// or 'https://storage.googleapis.com/bucket/prefix'. Object keys are
+	// appended to its path.
+	BaseURL string
+
+	// Credentials in the form 'access-key-id:secret-access-key[:session-token]'.
+	Credentials string
+
+	// Region of the bucket, such as 'us-east-1' or, for Google Cloud Storage,
+	// 'auto'.
+	Region string
+
+	// Expires is how long signed URLs remain valid.
+	Expires time.Duration
+}
+
+// Presign returns the URL granting the method access to the object with the
+// key until Expires after now.
+func (presigner Presigner) Presign(method, key string, now time.Time) (string, error) {
+	base, err := url.Parse(presigner.BaseURL)
+	if nil != err {
+		return "", err
+	}
+	credentials := strings.SplitN(presigner.Credentials, ":", 3)
+	if 2 > len(credentials) {
+		return "", fmt.Errorf(
+			"presigning requires credentials in the form " +
+				"'access-key-id:secret-access-key[:session-token]'",
+		)
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	scope := date + "/" + presigner.Region + "/s3/aws4_request"
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", credentials[0]+"/"+scope)
+	query.Set("X-Amz-Date", stamp)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(presigner.Expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if 3 == len(credentials) {
+		query.Set("X-Amz-Security-Token", credentials[2])
+	}
+	// Spaces are encoded as '%20' rather than '+' in canonical queries.
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	path := awsEscape(
+		strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(key, "/"),
+	)
+	canonical := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		"host:" + base.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hashHex([]byte(canonical))
+	signingKey := []byte("AWS4" + credentials[1])
+	for _, part := range []string{date, presigner.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, toSign))
+
+	return base.Scheme + "://" + base.Host + path + "?" + canonicalQuery +
+		"&X-Amz-Signature=" + signature, nil
+}
+
+// awsEscape percent-encodes every byte of the path other than unreserved
+// characters and '/', as required of canonical URIs by AWS.
+func awsEscape(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			'-' == c || '_' == c || '.' == c || '~' == c || '/' == c {
+			escaped.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&escaped, "%%%02X", c)
+	}
+	return escaped.String()
+}
+
+// PresignedRedirect returns a function answering requests for files with a
+// 'FOUND' redirect to a presigned URL of the object with the same name,
+// rather than serving the file, so clients download objects directly from
+// the object store while authorization and logging stay with the server.
+// Folders redirect to their 'index.html' object. Redirects are not cached as
+// the URLs expire.
+func PresignedRedirect(presigner Presigner) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		if containsDotDot(r.URL.Path) {
+			http.Error(w, "invalid URL path", http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(name, "/") || 0 == len(name) {
+			name += "index.html"
+		}
+		method := http.MethodGet
+		if http.MethodHead == r.Method {
+			method = http.MethodHead
+		}
+		location, err := presigner.Presign(method, name, time.Now())
+		if nil != err {
+			Tracef(r, "failed to presign '%s': %v", name, err)
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		Tracef(r, "redirected to presigned URL of '%s'", name)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+	}
+}
@@ -0,0 +1,166 @@
+package handle
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Problem details of an error response as defined by RFC 7807.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"request_id"`
+}
+
+// WithProblems wraps an HTTP request. Client and server error responses (400
+// and above) are replaced by RFC 7807 'application/problem+json' documents
+// with the status, title, path and request ID when the client prefers JSON to
+// HTML, keeping the response headers. The request ID is taken from the
+// 'X-Request-Id' request header, or generated if missing, and returned in the
+// same header. Error responses vary by 'Accept' for caches.
+func WithProblems(serve http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(&problemWriter{
+			ResponseWriter: w,
+			r:              r,
+			json:           prefersJSON(r.Header.Get("Accept")),
+		}, r)
+	}
+}
+
+// problemWriter replaces error responses with problem details.
+type problemWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	json     bool
+	written  bool
+	replaced bool
+}
+
+// WriteHeader writes problem details instead of the error response.
+func (w *problemWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+	w.written = true
+	if http.StatusBadRequest > code {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	header := w.Header()
+	AddVary(header, "Accept")
+	if !w.json {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.replaced = true
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(code),
+		Status:    code,
+		Instance:  w.r.URL.Path,
+		RequestID: requestID(w.r),
+	}
+	body, _ := json.Marshal(problem)
+	header.Set("X-Request-Id", problem.RequestID)
+	header.Set("Content-Type", "application/problem+json")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Del("Content-Encoding")
+	header.Del("Content-Range")
+	Tracef(w.r, "replaced %d response with problem details", code)
+	w.ResponseWriter.WriteHeader(code)
+	w.ResponseWriter.Write(body)
+}
+
+// Write discards the body of replaced error responses.
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom discards the body of replaced error responses.
+func (w *problemWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return io.Copy(ioutil.Discard, src)
+	}
+	return readFrom(w.ResponseWriter, src)
+}
+
+// Flush flushes the response unless it was replaced.
+func (w *problemWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.replaced {
+		flush(w.ResponseWriter)
+	}
+}
+
+// prefersJSON returns true if the 'Accept' header value ranks JSON, including
+// problem details, above HTML and plain text.
+func prefersJSON(accept string) bool {
+	var jsonQuality, textQuality float64
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if nil != err {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); nil != err {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json", "application/problem+json":
+			if quality > jsonQuality {
+				jsonQuality = quality
+			}
+		case "text/html", "text/plain", "text/*", "*/*":
+			if quality > textQuality {
+				textQuality = quality
+			}
+		}
+	}
+	return jsonQuality > textQuality
+}
+
+// maxRequestIDLength limits request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// requestID returns the 'X-Request-Id' of the request if it is printable and
+// not too long, or a new random ID.
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-Id")
+	valid := 0 < len(id) && maxRequestIDLength >= len(id)
+	for _, c := range id {
+		if '!' > c || '~' < c {
+			valid = false
+			break
+		}
+	}
+	if valid {
+		return id
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+package handle
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithProblems(t *testing.T) {
+	handler := WithProblems(Basic(FileServer(Dir(baseDir)), ""))
+
+	testCases := []struct {
+		name        string
+		path        string
+		accept      string
+		id          string
+		code        int
+		contentType string
+		problem     bool
+	}{
+		{"File", "/" + tmpFileName, "application/json", "", ok, "text/plain; charset=utf-8", false},
+		{"HTML", "/" + tmpBadName, "text/html,application/json;q=0.9", "", missing, "text/plain; charset=utf-8", false},
+		{"No accept", "/" + tmpBadName, "", "", missing, "text/plain; charset=utf-8", false},
+		{"JSON", "/" + tmpBadName, "application/json", "", missing, "application/problem+json", true},
+		{"Problem", "/" + tmpBadName, "application/problem+json, */*;q=0.1", "abc-123", missing, "application/problem+json", true},
+		{"Invalid ID", "/" + tmpBadName, "application/json", "bad id", missing, "application/problem+json", true},
+		{"Traversal", "/../" + tmpFileName, "application/json", "", http.StatusBadRequest, "application/problem+json", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = tc.path
+			req.Header.Set("Accept", tc.accept)
+			req.Header.Set("X-Request-Id", tc.id)
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if value := w.Header().Get("Content-Type"); tc.contentType != value {
+				t.Errorf("Expected content type '%s' but got '%s'", tc.contentType, value)
+			}
+			vary := ""
+			if http.StatusBadRequest <= tc.code {
+				vary = "Accept"
+			}
+			if value := w.Header().Get("Vary"); vary != value {
+				t.Errorf("Expected Vary '%s' but got '%s'", vary, value)
+			}
+			if !tc.problem {
+				return
+			}
+
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); nil != err {
+				t.Fatalf("While decoding '%s' got %v", w.Body.String(), err)
+			}
+			expected := Problem{
+				Type:      "about:blank",
+				Title:     http.StatusText(tc.code),
+				Status:    tc.code,
+				Instance:  tc.path,
+				RequestID: tc.id,
+			}
+			if "abc-123" != tc.id {
+				if 32 != len(problem.RequestID) {
+					t.Errorf("Expected a generated request ID but got '%s'", problem.RequestID)
+				}
+				expected.RequestID = problem.RequestID
+			}
+			if expected != problem {
+				t.Errorf("Expected %+v but got %+v", expected, problem)
+			}
+			if value := w.Header().Get("X-Request-Id"); problem.RequestID != value {
+				t.Errorf("Expected request ID header '%s' but got '%s'", problem.RequestID, value)
+			}
+		})
+	}
+}
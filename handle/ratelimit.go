@@ -0,0 +1,116 @@
+package handle
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the number of requests of each client IP address within
+// fixed windows. Safe for concurrent use.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mutex   sync.Mutex
+	clients map[string]*rateClient
+	swept   time.Time
+}
+
+// rateClient holds the requests of a client in the current window.
+type rateClient struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter returns a limiter allowing each client the limit of requests
+// per window.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		clients: make(map[string]*rateClient),
+	}
+}
+
+// Take a request of the client from its allowance, returning the remaining
+// allowance, the time the allowance resets and true if the request is within
+// the limit.
+func (limiter *RateLimiter) Take(ip string) (int, time.Time, bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+	client, found := limiter.clients[ip]
+	if !found || !now.Before(client.start.Add(limiter.window)) {
+		client = &rateClient{start: now}
+		limiter.clients[ip] = client
+	}
+	reset := client.start.Add(limiter.window)
+	if limiter.limit <= client.count {
+		return 0, reset, false
+	}
+	client.count++
+	return limiter.limit - client.count, reset, true
+}
+
+// sweep forgets clients whose window ended, at most once per window.
+func (limiter *RateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.swept) < limiter.window {
+		return
+	}
+	limiter.swept = now
+	for ip, client := range limiter.clients {
+		if !now.Before(client.start.Add(limiter.window)) {
+			delete(limiter.clients, ip)
+		}
+	}
+}
+
+// WithRateLimit wraps an HTTP request. Each response carries the
+// 'RateLimit-Limit', 'RateLimit-Remaining' and 'RateLimit-Reset' headers of
+// the client. Requests beyond the limit are refused with 'TOO MANY REQUESTS'
+// and a 'Retry-After' header so well-behaved clients back off.
+func WithRateLimit(serve http.HandlerFunc, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if nil == ip {
+			serve(w, r)
+			return
+		}
+		remaining, reset, allowed := limiter.Take(ip.String())
+		seconds := strconv.Itoa(retrySeconds(limiter.now(), reset))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limiter.limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", seconds)
+		if !allowed {
+			log.Printf(
+				"DENY: %s %s %s%s rate limited%s\n",
+				r.Method,
+				r.Proto,
+				r.Host,
+				r.URL.Path,
+				annotations(r),
+			)
+			w.Header().Set("Retry-After", seconds)
+			http.Error(w, "429 too many requests", http.StatusTooManyRequests)
+			return
+		}
+		serve(w, r)
+	}
+}
+
+// retrySeconds returns the whole number of seconds from now until the time,
+// rounded up and at least one.
+func retrySeconds(now, until time.Time) int {
+	seconds := int((until.Sub(now) + time.Second - 1) / time.Second)
+	if 1 > seconds {
+		return 1
+	}
+	return seconds
+}
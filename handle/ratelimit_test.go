@@ -0,0 +1,52 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+	handler := WithRateLimit(func(http.ResponseWriter, *http.Request) {}, limiter)
+
+	testCases := []struct {
+		name      string
+		advance   time.Duration
+		code      int
+		remaining string
+		reset     string
+		retry     string
+	}{
+		{"First", 0, ok, "1", "60", ""},
+		{"Second", 30 * time.Second, ok, "0", "30", ""},
+		{"Limited", 500 * time.Millisecond, http.StatusTooManyRequests, "0", "30", "30"},
+		{"Next window", 30 * time.Second, ok, "1", "60", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "http://localhost/file.txt", nil))
+
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			headers := []struct{ name, expected string }{
+				{"RateLimit-Limit", "2"},
+				{"RateLimit-Remaining", tc.remaining},
+				{"RateLimit-Reset", tc.reset},
+				{"Retry-After", tc.retry},
+			}
+			for _, header := range headers {
+				if value := w.Header().Get(header.name); header.expected != value {
+					t.Errorf("Expected %s '%s' but got '%s'", header.name, header.expected, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux && readv
+// +build linux,readv
+
+package handle
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ReadvSupported is true if ReadvDir reads batches with preadv.
+const ReadvSupported = true
+
+// preadv fills the buffers in order from the file at the offset with a single
+// system call, returning the number of bytes read.
+func preadv(file *os.File, buffers [][]byte, offset int64) (int, error) {
+	iovecs := make([]syscall.Iovec, len(buffers))
+	for index, buffer := range buffers {
+		iovecs[index].Base = &buffer[0]
+		iovecs[index].SetLen(len(buffer))
+	}
+	conn, err := file.SyscallConn()
+	if nil != err {
+		return 0, err
+	}
+	// The offset is split into the low and high words the kernel expects,
+	// where the high word is ignored by 64-bit kernels.
+	const longBits = 8 * unsafe.Sizeof(uintptr(0))
+	low, high := uintptr(offset), uintptr(uint64(offset)>>(longBits-1)>>1)
+	var n uintptr
+	var errno syscall.Errno
+	err = conn.Read(func(fd uintptr) bool {
+		for {
+			n, _, errno = syscall.Syscall6(
+				syscall.SYS_PREADV, fd, uintptr(unsafe.Pointer(&iovecs[0])),
+				uintptr(len(iovecs)), low, high, 0,
+			)
+			if syscall.EINTR != errno {
+				return true
+			}
+		}
+	})
+	if nil != err {
+		return 0, err
+	}
+	if 0 != errno {
+		return 0, &os.PathError{Op: "preadv", Path: file.Name(), Err: errno}
+	}
+	return int(n), nil
+}
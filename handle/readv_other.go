@@ -0,0 +1,28 @@
+//go:build !linux || !readv
+// +build !linux !readv
+
+package handle
+
+import (
+	"io"
+	"os"
+)
+
+// ReadvSupported is true if ReadvDir reads batches with preadv.
+const ReadvSupported = false
+
+// preadv fills the buffers in order from the file at the offset with a read
+// for each buffer, returning the number of bytes read.
+func preadv(file *os.File, buffers [][]byte, offset int64) (total int, err error) {
+	for _, buffer := range buffers {
+		n, err := file.ReadAt(buffer, offset+int64(total))
+		total += n
+		if io.EOF == err {
+			return total, nil
+		}
+		if nil != err {
+			return total, err
+		}
+	}
+	return total, nil
+}
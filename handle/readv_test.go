@@ -0,0 +1,109 @@
+package handle
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadvDir(t *testing.T) {
+	storage := ReadvDir{Dir: Dir(baseDir), Batch: 4}
+
+	file, err := storage.Open("/" + tmpFileName)
+	if nil != err {
+		t.Fatalf("While opening got %v", err)
+	}
+	if _, batched := file.(*batchedFile); ReadvSupported != batched {
+		t.Errorf("Expected batched %t but got %t", ReadvSupported, batched)
+	}
+	file.Close()
+	if _, err := storage.Open("/" + tmpBadName); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing file but got %v", err)
+	}
+
+	// Batched files are served in the same way as files read normally.
+	expected := Basic(FileServer(Dir(baseDir)), "")
+	handler := Basic(FileServer(storage), "")
+	ranges := []string{"", "bytes=0-4", "bytes=-6", "bytes=10-"}
+	for _, name := range []string{"/" + tmpFileName, "/" + subDir} {
+		for _, byteRange := range ranges {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+name, nil)
+			req.Header.Set("Range", byteRange)
+			want, got := httptest.NewRecorder(), httptest.NewRecorder()
+			expected(want, req)
+			handler(got, req)
+			if want.Code != got.Code || want.Body.String() != got.Body.String() {
+				t.Errorf(
+					"For %s %s expected %d '%s' but got %d '%s'",
+					name, byteRange, want.Code, want.Body, got.Code, got.Body,
+				)
+			}
+		}
+	}
+}
+
+func TestBatchedFile(t *testing.T) {
+	// Batches of 3 buffers of 4 bytes span several batches of the file.
+	SetCopyBufferSize(4)
+	defer SetCopyBufferSize(0)
+	dir, err := ioutil.TempDir("", "readv")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	contents := "0123456789abcdefghijklmnopqrstuvwxyz"
+	filename := filepath.Join(dir, "file.txt")
+	ioutil.WriteFile(filename, []byte(contents), 0644)
+
+	open := func() *batchedFile {
+		t.Helper()
+		file, err := os.Open(filename)
+		if nil != err {
+			t.Fatalf("While opening got %v", err)
+		}
+		return newBatchedFile(file, 3)
+	}
+	file := open()
+	if all, err := ioutil.ReadAll(file); nil != err || contents != string(all) {
+		t.Errorf("Expected '%s' but got '%s' and %v", contents, all, err)
+	}
+	file.Close()
+
+	file = open()
+	defer file.Close()
+	testCases := []struct {
+		name     string
+		offset   int64
+		whence   int
+		expected string
+	}{
+		{"From start", 10, io.SeekStart, "abcdefgh"},
+		{"Within batch", -6, io.SeekCurrent, "cdefghij"},
+		{"From end", -5, io.SeekEnd, "vwxyz"},
+		{"Back to start", 0, io.SeekStart, "01234567"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := file.Seek(tc.offset, tc.whence); nil != err {
+				t.Fatalf("While seeking got %v", err)
+			}
+			b := make([]byte, len(tc.expected))
+			if _, err := io.ReadFull(file, b); nil != err || tc.expected != string(b) {
+				t.Errorf("Expected '%s' but got '%s' and %v", tc.expected, b, err)
+			}
+		})
+	}
+	if _, err := file.Seek(-1, io.SeekStart); nil == err {
+		t.Error("Expected an error seeking before the start but got nil")
+	}
+	if _, err := file.Seek(100, io.SeekStart); nil != err {
+		t.Fatalf("While seeking got %v", err)
+	}
+	if _, err := file.Read(make([]byte, 4)); io.EOF != err {
+		t.Errorf("Expected end of file but got %v", err)
+	}
+}
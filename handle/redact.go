@@ -0,0 +1,163 @@
+package handle
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Treatments of LogFields.
+const (
+	// LogKeep logs the value as is.
+	LogKeep = "keep"
+	// LogHash logs a keyed hash of the value, allowing requests with the same
+	// value to be correlated without revealing it.
+	LogHash = "hash"
+	// LogMask logs client IP addresses with the host part removed, keeping the
+	// first 24 bits of IPv4 and 48 bits of IPv6 addresses.
+	LogMask = "mask"
+	// LogRedact logs that a value was present without logging it. Query
+	// parameter names are kept.
+	LogRedact = "redact"
+)
+
+// LogFields chooses the treatment of potentially personal or secret values
+// added to the access log: the client IP address, the query string, the
+// access key and the TLS details of the request. The TLS version, cipher suite
+// and server name (SNI) are always kept, while the treatment applies to the
+// subject of the client certificate. Empty treatments leave the value out of
+// the log. Hashes are keyed by HashKey so they cannot be reversed by hashing
+// every possible value.
+type LogFields struct {
+	IP        string
+	Query     string
+	AccessKey string
+	TLS       string
+	HashKey   []byte
+}
+
+// ParseLogFields converts fields in the form 'field=treatment', where the
+// field is 'ip', 'query', 'access-key' or 'tls' and the treatment is 'keep',
+// 'hash', 'redact' or, for 'ip', 'mask', into LogFields. If the hash key is
+// empty then a random key is used, so hashes only correlate requests until
+// the server restarts.
+func ParseLogFields(fields []string, hashKey string) (parsed LogFields, err error) {
+	for _, definition := range fields {
+		parts := strings.SplitN(definition, "=", 2)
+		if 2 != len(parts) {
+			err = fmt.Errorf(
+				"invalid log field '%s': expected 'field=treatment'", definition,
+			)
+			return
+		}
+		switch parts[1] {
+		case LogKeep, LogHash, LogRedact:
+		case LogMask:
+			if "ip" == parts[0] {
+				break
+			}
+			fallthrough
+		default:
+			err = fmt.Errorf(
+				"invalid log field '%s': unknown treatment '%s'", definition, parts[1],
+			)
+			return
+		}
+		switch parts[0] {
+		case "ip":
+			parsed.IP = parts[1]
+		case "query":
+			parsed.Query = parts[1]
+		case "access-key":
+			parsed.AccessKey = parts[1]
+		case "tls":
+			parsed.TLS = parts[1]
+		default:
+			err = fmt.Errorf(
+				"invalid log field '%s': unknown field '%s'", definition, parts[0],
+			)
+			return
+		}
+	}
+
+	parsed.HashKey = []byte(hashKey)
+	if 0 == len(parsed.HashKey) {
+		parsed.HashKey = make([]byte, 32)
+		_, err = rand.Read(parsed.HashKey)
+	}
+	return
+}
+
+// Enabled returns true if any value is added to the access log.
+func (fields LogFields) Enabled() bool {
+	return 0 < len(fields.IP) || 0 < len(fields.Query) || 0 < len(fields.AccessKey) ||
+		0 < len(fields.TLS)
+}
+
+// annotate returns a copy of the request annotated with the values of the
+// fields, after applying their treatments.
+func (fields LogFields) annotate(r *http.Request) *http.Request {
+	annotated := r
+	if ip := clientIP(r); 0 < len(fields.IP) && nil != ip {
+		value := ip.String()
+		if LogMask == fields.IP {
+			bits := 48
+			if nil != ip.To4() {
+				ip, bits = ip.To4(), 24
+			}
+			value = ip.Mask(net.CIDRMask(bits, 8*len(ip))).String()
+		}
+		annotated = annotate(annotated, "ip", fields.treat(fields.IP, value))
+	}
+	if query := r.URL.RawQuery; 0 < len(fields.Query) && 0 < len(query) {
+		value := query
+		if LogRedact == fields.Query {
+			redacted := make(url.Values)
+			for name := range r.URL.Query() {
+				redacted.Set(name, "REDACTED")
+			}
+			value = redacted.Encode()
+		} else {
+			value = fields.treat(fields.Query, value)
+		}
+		annotated = annotate(annotated, "query", value)
+	}
+	if key := accessKey(r); 0 < len(fields.AccessKey) && 0 < len(key) {
+		annotated = annotate(annotated, "access-key", fields.treat(fields.AccessKey, key))
+	}
+	if state := r.TLS; 0 < len(fields.TLS) && nil != state {
+		annotated = annotate(annotated, "tls-version", tlsVersion(state.Version))
+		annotated = annotate(annotated, "tls-cipher", cipherSuite(state.CipherSuite))
+		if 0 < len(state.ServerName) {
+			annotated = annotate(annotated, "tls-sni", state.ServerName)
+		}
+		if 0 < len(state.PeerCertificates) {
+			subject := logEscaper.Replace(state.PeerCertificates[0].Subject.String())
+			annotated = annotate(annotated, "tls-client", fields.treat(fields.TLS, subject))
+		}
+	}
+	return annotated
+}
+
+// logEscaper escapes spaces in logged values, such as certificate subjects, so
+// each annotation remains a single word.
+var logEscaper = strings.NewReplacer("%", "%25", " ", "%20")
+
+// treat the value as chosen, returning it as is for 'keep' and 'mask'.
+func (fields LogFields) treat(treatment, value string) string {
+	switch treatment {
+	case LogHash:
+		mac := hmac.New(sha256.New, fields.HashKey)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	case LogRedact:
+		return "REDACTED"
+	}
+	return value
+}
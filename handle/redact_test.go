@@ -0,0 +1,111 @@
+package handle
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLogFields(t *testing.T) {
+	testCases := []struct {
+		name    string
+		fields  []string
+		isError bool
+	}{
+		{"None", nil, false},
+		{"All", []string{"ip=mask", "query=redact", "access-key=hash"}, false},
+		{"Missing treatment", []string{"ip"}, true},
+		{"Unknown field", []string{"cookie=hash"}, true},
+		{"Unknown treatment", []string{"ip=drop"}, true},
+		{"TLS", []string{"tls=keep"}, false},
+		{"Mask of query", []string{"query=mask"}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, err := ParseLogFields(tc.fields, "")
+			if tc.isError != (nil != err) {
+				t.Fatalf("Expected error %t but got %v", tc.isError, err)
+			}
+			if !tc.isError && 32 != len(fields.HashKey) {
+				t.Errorf("Expected a random hash key but got %d bytes", len(fields.HashKey))
+			}
+		})
+	}
+}
+
+func TestLogFieldsAnnotate(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fields     []string
+		remoteAddr string
+		expected   string
+	}{
+		{"Omitted", nil, "192.0.2.10:1234", ""},
+		{"Kept", []string{"ip=keep", "query=keep", "access-key=keep"}, "192.0.2.10:1234",
+			" ip=192.0.2.10 query=token=secret&v=2 access-key=key-one"},
+		{"Masked IPv4", []string{"ip=mask"}, "192.0.2.10:1234", " ip=192.0.2.0"},
+		{"Masked IPv6", []string{"ip=mask"}, "[2001:db8:1:2::10]:1234", " ip=2001:db8:1::"},
+		{"Redacted", []string{"ip=redact", "query=redact", "access-key=redact"}, "192.0.2.10:1234",
+			" ip=REDACTED query=token=REDACTED&v=REDACTED access-key=REDACTED"},
+		{"Hashed", []string{"ip=hash", "query=hash", "access-key=hash"}, "192.0.2.10:1234",
+			" ip=9bbcc808d690a214 query=a6299688b7030d3b access-key=c9e64af33ba25e53"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, err := ParseLogFields(tc.fields, "test-key")
+			if nil != err {
+				t.Fatalf("While parsing got %v", err)
+			}
+			req := httptest.NewRequest("GET", "/file.txt?token=secret&v=2", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("X-Access-Key", "key-one")
+			if logged := annotations(fields.annotate(req)); tc.expected != logged {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, logged)
+			}
+		})
+	}
+}
+
+func TestLogFieldsTLS(t *testing.T) {
+	client := &x509.Certificate{Subject: pkix.Name{
+		CommonName: "alice", Organization: []string{"Example Corp"},
+	}}
+	testCases := []struct {
+		name         string
+		fields       []string
+		target       string
+		certificates []*x509.Certificate
+		expected     string
+	}{
+		{"Omitted", nil, "https://example.com/file.txt", nil, ""},
+		{"Plain HTTP", []string{"tls=keep"}, "http://example.com/file.txt", nil, ""},
+		{"Server certificate only", []string{"tls=keep"}, "https://example.com/file.txt", nil,
+			" tls-version=TLS1.3 tls-cipher=TLS_AES_128_GCM_SHA256 tls-sni=example.com"},
+		{"Client certificate", []string{"tls=keep"}, "https://example.com/file.txt",
+			[]*x509.Certificate{client},
+			" tls-version=TLS1.3 tls-cipher=TLS_AES_128_GCM_SHA256 tls-sni=example.com" +
+				" tls-client=CN=alice,O=Example%20Corp"},
+		{"Redacted client", []string{"tls=redact"}, "https://example.com/file.txt",
+			[]*x509.Certificate{client},
+			" tls-version=TLS1.3 tls-cipher=TLS_AES_128_GCM_SHA256 tls-sni=example.com" +
+				" tls-client=REDACTED"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fields, err := ParseLogFields(tc.fields, "test-key")
+			if nil != err {
+				t.Fatalf("While parsing got %v", err)
+			}
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if nil != req.TLS {
+				req.TLS.Version, req.TLS.CipherSuite = tls.VersionTLS13, tls.TLS_AES_128_GCM_SHA256
+				req.TLS.PeerCertificates = tc.certificates
+			}
+			if logged := annotations(fields.annotate(req)); tc.expected != logged {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, logged)
+			}
+		})
+	}
+}
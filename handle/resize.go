@@ -0,0 +1,432 @@
+package handle
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Ways a resized image fits the requested width and height.
+const (
+	// FitContain scales the image to fit within the width and height, keeping
+	// its aspect ratio.
+	FitContain = "contain"
+	// FitCover scales the image to cover the width and height, keeping its
+	// aspect ratio, and crops the center.
+	FitCover = "cover"
+	// FitFill scales the image to the width and height, ignoring its aspect
+	// ratio.
+	FitFill = "fill"
+)
+
+// jpegQuality of resized JPEG images.
+const jpegQuality = 85
+
+// ResizeConfig limits the images transformed by WithResize.
+type ResizeConfig struct {
+	// MaxSize of the requested width and height in pixels.
+	MaxSize int
+
+	// MaxPixels of the original images, refusing larger images before they
+	// are decoded.
+	MaxPixels int
+
+	// CacheFolder keeps resized images on disk, named by the original file,
+	// its size and modification time and the requested transformation. If
+	// empty, images are resized for each request.
+	CacheFolder string
+
+	// CacheMaxSize in bytes of the files in CacheFolder. The least recently
+	// used images are removed to make room for others. If not positive,
+	// images are resized for each request.
+	CacheMaxSize int
+}
+
+// resizeRequest is a requested transformation of an image.
+type resizeRequest struct {
+	width, height int
+	fit           string
+}
+
+// WithResize wraps an HTTP request. GET and HEAD requests for JPEG, PNG and
+// GIF images with a 'w' or 'h' query parameter are served the image resized
+// to that width or height in pixels, fitting both as set by the 'fit'
+// parameter: 'contain' (default), 'cover' or 'fill'. Images are not enlarged
+// unless the fit is 'fill'. Requests with invalid parameters are refused with
+// '400 Bad Request' and images over the pixel limit with '422 Unprocessable
+// Entity'. Images are resized by at most one request per CPU at a time.
+// Requests are resolved to files in the storage by removing urlPrefix in the
+// same way as Prefix.
+func WithResize(
+	serve http.HandlerFunc, storage Storage, urlPrefix string, config ResizeConfig,
+) http.HandlerFunc {
+	slots := make(chan struct{}, runtime.NumCPU())
+	var cache *resizeCache
+	if 0 < len(config.CacheFolder) && 0 < config.CacheMaxSize {
+		cache = newResizeCache(config.CacheFolder, config.CacheMaxSize)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if (http.MethodGet != r.Method && http.MethodHead != r.Method) ||
+			!strings.HasPrefix(r.URL.Path, urlPrefix) ||
+			(0 == len(query.Get("w")) && 0 == len(query.Get("h"))) {
+			serve(w, r)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, urlPrefix)
+		ext := strings.ToLower(path.Ext(name))
+		if ".jpg" != ext && ".jpeg" != ext && ".png" != ext && ".gif" != ext {
+			serve(w, r)
+			return
+		}
+		request, err := parseResize(query, config.MaxSize)
+		if nil != err {
+			http.Error(w, "400 bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		info, err := storage.Stat(name)
+		if nil != err || info.IsDir() {
+			serve(w, r)
+			return
+		}
+
+		var cached string
+		if nil != cache {
+			key := sha256.Sum256([]byte(fmt.Sprintf(
+				"%s\x00%d\x00%d\x00%d\x00%d\x00%s", name, info.Size(),
+				info.ModTime().UnixNano(), request.width, request.height, request.fit,
+			)))
+			cached = hex.EncodeToString(key[:]) + ext
+			if file, err := cache.open(cached); nil == err {
+				defer file.Close()
+				Tracef(r, "serving resized image %s from cache", name)
+				w.Header().Set("Content-Type", mime.TypeByExtension(ext))
+				http.ServeContent(w, r, name, info.ModTime(), file)
+				return
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		case <-r.Context().Done():
+			return
+		}
+		resized, err := resizeFile(storage, name, ext, request, config.MaxPixels)
+		if errTooManyPixels == err {
+			http.Error(
+				w,
+				"422 unprocessable entity: image too large to resize",
+				http.StatusUnprocessableEntity,
+			)
+			return
+		}
+		if nil != err {
+			log.Printf("Error: while resizing image %s got %v\n", name, err)
+			http.Error(
+				w,
+				"500 internal server error",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+		Tracef(r, "resized image %s for %s", name, r.URL.RawQuery)
+		if 0 < len(cached) {
+			if err = cache.store(cached, resized); nil != err {
+				log.Printf("Error: while caching resized image %s got %v\n", name, err)
+			}
+		}
+		w.Header().Set("Content-Type", mime.TypeByExtension(ext))
+		http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(resized))
+	}
+}
+
+// resizeCache of resized images in a folder, removing the least recently used
+// files once their total size exceeds maxSize. Files already in the folder are
+// counted as last used when they were modified. Safe for concurrent use.
+type resizeCache struct {
+	folder  string
+	maxSize int
+
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// resizeEntry is a file of the resize cache.
+type resizeEntry struct {
+	name string
+	size int
+}
+
+// newResizeCache returns the cache of the files in the folder, removing the
+// files beyond maxSize.
+func newResizeCache(folder string, maxSize int) *resizeCache {
+	cache := &resizeCache{
+		folder:  folder,
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+	infos, err := ioutil.ReadDir(folder)
+	if nil != err {
+		log.Printf("Error: while reading resize cache %s got %v\n", folder, err)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			cache.add(info.Name(), int(info.Size()))
+		}
+	}
+	return cache
+}
+
+// open the cached file with the name, marking it as the most recently used.
+func (cache *resizeCache) open(name string) (*os.File, error) {
+	cache.mutex.Lock()
+	if element, found := cache.entries[name]; found {
+		cache.order.MoveToFront(element)
+	}
+	cache.mutex.Unlock()
+	return os.Open(filepath.Join(cache.folder, name))
+}
+
+// store the contents as the cached file with the name. Contents larger than
+// the cache are not stored.
+func (cache *resizeCache) store(name string, contents []byte) error {
+	if cache.maxSize < len(contents) {
+		return nil
+	}
+	if err := writeAtomically(filepath.Join(cache.folder, name), contents); nil != err {
+		return err
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.add(name, len(contents))
+	return nil
+}
+
+// add the file as the most recently used, removing the least recently used
+// files beyond the size of the cache. The caller holds the mutex.
+func (cache *resizeCache) add(name string, size int) {
+	if element, found := cache.entries[name]; found {
+		cache.size -= element.Value.(resizeEntry).size
+		cache.order.Remove(element)
+	}
+	cache.entries[name] = cache.order.PushFront(resizeEntry{name, size})
+	cache.size += size
+	for cache.maxSize < cache.size {
+		entry := cache.order.Remove(cache.order.Back()).(resizeEntry)
+		delete(cache.entries, entry.name)
+		cache.size -= entry.size
+		err := os.Remove(filepath.Join(cache.folder, entry.name))
+		if nil != err && !os.IsNotExist(err) {
+			log.Printf("Error: while removing resized image %s got %v\n", entry.name, err)
+		}
+	}
+}
+
+// errTooManyPixels is returned for images over the pixel limit.
+var errTooManyPixels = errors.New("image exceeds the pixel limit")
+
+// parseResize returns the transformation requested by the 'w', 'h' and 'fit'
+// query parameters.
+func parseResize(query map[string][]string, maxSize int) (resizeRequest, error) {
+	var request resizeRequest
+	for _, param := range []struct {
+		key   string
+		value *int
+	}{{"w", &request.width}, {"h", &request.height}} {
+		values := query[param.key]
+		if 0 == len(values) || 0 == len(values[0]) {
+			continue
+		}
+		size, err := strconv.Atoi(values[0])
+		if nil != err || 0 >= size || maxSize < size {
+			return request, fmt.Errorf(
+				"'%s' must be a number of pixels from 1 to %d", param.key, maxSize,
+			)
+		}
+		*param.value = size
+	}
+	request.fit = FitContain
+	if values := query["fit"]; 0 < len(values) && 0 < len(values[0]) {
+		request.fit = values[0]
+	}
+	switch request.fit {
+	case FitContain, FitCover, FitFill:
+	default:
+		return request, errors.New("'fit' must be 'contain', 'cover' or 'fill'")
+	}
+	return request, nil
+}
+
+// resizeFile returns the encoded image of the file transformed as requested.
+// The dimensions of the image are checked against maxPixels before decoding.
+func resizeFile(
+	storage Storage, name, ext string, request resizeRequest, maxPixels int,
+) ([]byte, error) {
+	file, err := storage.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if nil != err {
+		return nil, err
+	}
+	if int64(maxPixels) < int64(config.Width)*int64(config.Height) {
+		return nil, errTooManyPixels
+	}
+	if 0 == config.Width || 0 == config.Height {
+		return nil, errors.New("image is empty")
+	}
+	if _, err = file.Seek(0, io.SeekStart); nil != err {
+		return nil, err
+	}
+	src, _, err := image.Decode(file)
+	if nil != err {
+		return nil, err
+	}
+
+	crop, width, height := resizeGeometry(src.Bounds(), request)
+	resized := scaleImage(src, crop, width, height)
+	var out bytes.Buffer
+	switch ext {
+	case ".png":
+		err = png.Encode(&out, resized)
+	case ".gif":
+		err = gif.Encode(&out, resized, nil)
+	default:
+		err = jpeg.Encode(&out, resized, &jpeg.Options{Quality: jpegQuality})
+	}
+	return out.Bytes(), err
+}
+
+// resizeGeometry returns the part of the image to scale and the size it is
+// scaled to for the request.
+func resizeGeometry(bounds image.Rectangle, request resizeRequest) (image.Rectangle, int, int) {
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := request.width, request.height
+	if FitContain == request.fit || 0 == width || 0 == height {
+		// Scale by the smaller factor of the requested sides.
+		scale := 1.0
+		if 0 < width && float64(width)/float64(srcWidth) < scale {
+			scale = float64(width) / float64(srcWidth)
+		}
+		if 0 < height && float64(height)/float64(srcHeight) < scale {
+			scale = float64(height) / float64(srcHeight)
+		}
+		return bounds, scaled(srcWidth, scale), scaled(srcHeight, scale)
+	}
+	if FitFill == request.fit {
+		return bounds, width, height
+	}
+
+	// Crop the center to the requested aspect ratio, then scale it down.
+	crop := bounds
+	if srcWidth*height > srcHeight*width {
+		cropWidth := srcHeight * width / height
+		crop.Min.X += (srcWidth - cropWidth) / 2
+		crop.Max.X = crop.Min.X + cropWidth
+	} else {
+		cropHeight := srcWidth * height / width
+		crop.Min.Y += (srcHeight - cropHeight) / 2
+		crop.Max.Y = crop.Min.Y + cropHeight
+	}
+	scale := 1.0
+	if crop.Dx() < width {
+		scale = float64(crop.Dx()) / float64(width)
+	}
+	return crop, scaled(width, scale), scaled(height, scale)
+}
+
+// scaled returns the size multiplied by the scale, rounded and at least 1.
+func scaled(size int, scale float64) int {
+	result := int(float64(size)*scale + 0.5)
+	if 1 > result {
+		return 1
+	}
+	return result
+}
+
+// scaleImage returns the part of the image scaled to the width and height,
+// averaging the pixels covered by each pixel of the result.
+func scaleImage(src image.Image, crop image.Rectangle, width, height int) *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, crop.Min, draw.Src)
+	srcWidth, srcHeight := crop.Dx(), crop.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, (y+1)*srcHeight/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, (x+1)*srcWidth/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[offset+i] = uint8(sum[i] / count)
+			}
+		}
+	}
+	return dst
+}
+
+// writeAtomically writes the data to a temporary file in the same folder and
+// renames it to the filename, so readers never see a partial file.
+func writeAtomically(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".resize-*")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); nil != err {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
@@ -0,0 +1,199 @@
+package handle
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithResize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resize")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	os.Mkdir(cacheDir, 0755)
+
+	// A 400x200 image, red on the left half and blue on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if 200 <= x {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	var encoded bytes.Buffer
+	png.Encode(&encoded, src)
+	ioutil.WriteFile(filepath.Join(dir, "photo.png"), encoded.Bytes(), 0644)
+	encoded.Reset()
+	jpeg.Encode(&encoded, src, nil)
+	ioutil.WriteFile(filepath.Join(dir, "photo.jpg"), encoded.Bytes(), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "broken.png"), []byte("not an image"), 0644)
+
+	served := "served"
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(served))
+	}
+	config := ResizeConfig{
+		MaxSize:      1000,
+		MaxPixels:    100000,
+		CacheFolder:  cacheDir,
+		CacheMaxSize: 1 << 20,
+	}
+	handler := WithResize(serve, Dir(dir), "/prefix", config)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		code   int
+		width  int
+		height int
+	}{
+		{"Width", "GET", "/prefix/photo.png?w=100", ok, 100, 50},
+		{"Height", "GET", "/prefix/photo.png?h=100", ok, 200, 100},
+		{"Contain", "GET", "/prefix/photo.png?w=100&h=100", ok, 100, 50},
+		{"Cover", "GET", "/prefix/photo.png?w=100&h=100&fit=cover", ok, 100, 100},
+		{"Cover not enlarged", "GET", "/prefix/photo.png?w=400&h=400&fit=cover", ok, 200, 200},
+		{"Fill", "GET", "/prefix/photo.png?w=100&h=100&fit=fill", ok, 100, 100},
+		{"Not enlarged", "GET", "/prefix/photo.png?w=800", ok, 400, 200},
+		{"JPEG", "GET", "/prefix/photo.jpg?w=100", ok, 100, 50},
+		{"Head", "HEAD", "/prefix/photo.png?w=100", ok, 0, 0},
+		{"No parameters", "GET", "/prefix/photo.png", ok, 0, 0},
+		{"Not an image", "GET", "/prefix/file.txt?w=100", ok, 0, 0},
+		{"Missing", "GET", "/prefix/missing.png?w=100", ok, 0, 0},
+		{"Outside prefix", "GET", "/photo.png?w=100", ok, 0, 0},
+		{"Too wide", "GET", "/prefix/photo.png?w=1001", http.StatusBadRequest, 0, 0},
+		{"Invalid width", "GET", "/prefix/photo.png?w=abc", http.StatusBadRequest, 0, 0},
+		{"Invalid fit", "GET", "/prefix/photo.png?w=10&fit=stretch", http.StatusBadRequest, 0, 0},
+		{"Broken", "GET", "/prefix/broken.png?w=10", http.StatusInternalServerError, 0, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Fatalf("For %s expected status code %d but got %d", tc.path, tc.code, w.Code)
+			}
+			if 0 == tc.width {
+				return
+			}
+			resized, _, err := image.Decode(w.Body)
+			if nil != err {
+				t.Fatalf("For %s got %v", tc.path, err)
+			}
+			bounds := resized.Bounds()
+			if tc.width != bounds.Dx() || tc.height != bounds.Dy() {
+				t.Errorf(
+					"For %s expected %dx%d but got %dx%d",
+					tc.path, tc.width, tc.height, bounds.Dx(), bounds.Dy(),
+				)
+			}
+		})
+	}
+
+	// The cover is cropped from the center, keeping both colors.
+	req := httptest.NewRequest("GET", "http://localhost/prefix/photo.png?w=20&h=20&fit=cover", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	cover, err := png.Decode(w.Body)
+	if nil != err {
+		t.Fatalf("While decoding cover got %v", err)
+	}
+	if r, _, _, _ := cover.At(0, 10).RGBA(); 0xffff != r {
+		t.Errorf("Expected red on the left of the cover but got %v", cover.At(0, 10))
+	}
+	if _, _, b, _ := cover.At(19, 10).RGBA(); 0xffff != b {
+		t.Errorf("Expected blue on the right of the cover but got %v", cover.At(19, 10))
+	}
+
+	// Resized images are served from the cache.
+	cached, _ := ioutil.ReadDir(cacheDir)
+	if 0 == len(cached) {
+		t.Fatal("Expected resized images in the cache but got none")
+	}
+	for _, info := range cached {
+		ioutil.WriteFile(filepath.Join(cacheDir, info.Name()), []byte("cached"), 0644)
+	}
+	req = httptest.NewRequest("GET", "http://localhost/prefix/photo.png?w=100", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if "cached" != w.Body.String() {
+		t.Errorf("Expected the cached image but got %d bytes", w.Body.Len())
+	}
+
+	// Images over the pixel limit are refused.
+	config.MaxPixels = 1000
+	config.CacheFolder = ""
+	handler = WithResize(serve, Dir(dir), "/prefix", config)
+	req = httptest.NewRequest("GET", "http://localhost/prefix/photo.png?w=100", nil)
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if http.StatusUnprocessableEntity != w.Code {
+		t.Errorf("Expected %d over the pixel limit but got %d", http.StatusUnprocessableEntity, w.Code)
+	}
+}
+
+func TestWithResizeCacheLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resize")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	os.Mkdir(cacheDir, 0755)
+	ioutil.WriteFile(filepath.Join(cacheDir, "stale.png"), make([]byte, 4000), 0644)
+
+	src := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	var encoded bytes.Buffer
+	png.Encode(&encoded, src)
+	ioutil.WriteFile(filepath.Join(dir, "photo.png"), encoded.Bytes(), 0644)
+
+	const maxSize = 1000
+	handler := WithResize(http.NotFound, Dir(dir), "", ResizeConfig{
+		MaxSize:      1000,
+		MaxPixels:    100000,
+		CacheFolder:  cacheDir,
+		CacheMaxSize: maxSize,
+	})
+	for width := 1; width <= 50; width++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("http://localhost/photo.png?w=%d", width), nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if ok != w.Code {
+			t.Fatalf("For width %d expected status code %d but got %d", width, ok, w.Code)
+		}
+
+		cached, _ := ioutil.ReadDir(cacheDir)
+		size := 0
+		for _, info := range cached {
+			size += int(info.Size())
+		}
+		if maxSize < size {
+			t.Fatalf("After width %d expected at most %d cached bytes but got %d", width, maxSize, size)
+		}
+	}
+	if cached, _ := ioutil.ReadDir(cacheDir); 0 == len(cached) {
+		t.Error("Expected resized images in the cache but got none")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "stale.png")); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale file beyond the limit to be removed but got %v", err)
+	}
+}
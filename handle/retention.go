@@ -0,0 +1,80 @@
+package handle
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy selects the versions of artifacts, such as uploaded release
+// archives or release folders, removed by Retain.
+type RetentionPolicy struct {
+	// Patterns of the versions, in the form accepted by path.Match, matching
+	// the name or, with a leading '/', the path of a file or folder. Only
+	// matching files and folders are ever removed.
+	Patterns []string
+	// KeepLast versions in each folder by modification time, removing the
+	// older ones. Unlimited if 0.
+	KeepLast int
+	// MaxAge of versions since their modification, removing older ones even
+	// if they are among the last kept. Unlimited if 0.
+	MaxAge time.Duration
+	// DryRun reports the versions that would be removed without removing
+	// them.
+	DryRun bool
+}
+
+// Retain removes the versions in each folder within the root that the policy
+// does not retain at the time, returning their slash-separated paths from the
+// root (e.g. '/releases/app-1.0.tar.gz'). Folders matching the patterns are
+// removed with their contents and are not searched for versions. If the policy
+// is a dry run, nothing is removed.
+func Retain(root string, policy RetentionPolicy, now time.Time) ([]string, error) {
+	var removed []string
+	err := retainIn(root, "/", policy, now, &removed)
+	return removed, err
+}
+
+// retainIn applies the policy to the named folder within the root and the
+// folders within it, adding the removed versions to removed.
+func retainIn(
+	root, name string, policy RetentionPolicy, now time.Time, removed *[]string,
+) error {
+	infos, err := ioutil.ReadDir(filepath.Join(root, filepath.FromSlash(name)))
+	if nil != err {
+		return err
+	}
+	var versions []os.FileInfo
+	for _, info := range infos {
+		child := path.Join(name, info.Name())
+		if matchesAny(policy.Patterns, child) {
+			versions = append(versions, info)
+		} else if info.IsDir() {
+			if err = retainIn(root, child, policy, now, removed); nil != err {
+				return err
+			}
+		}
+	}
+
+	// Newest first, so the versions beyond KeepLast are the oldest.
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].ModTime().After(versions[j].ModTime())
+	})
+	for i, info := range versions {
+		expired := 0 < policy.MaxAge && policy.MaxAge < now.Sub(info.ModTime())
+		if !expired && (0 == policy.KeepLast || i < policy.KeepLast) {
+			continue
+		}
+		child := path.Join(name, info.Name())
+		if !policy.DryRun {
+			if err = os.RemoveAll(filepath.Join(root, filepath.FromSlash(child))); nil != err {
+				return err
+			}
+		}
+		*removed = append(*removed, child)
+	}
+	return nil
+}
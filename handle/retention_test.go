@@ -0,0 +1,109 @@
+package handle
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetain(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	files := map[string]time.Duration{
+		"app/app-1.0.tar.gz":     5 * 24 * time.Hour,
+		"app/app-1.1.tar.gz":     4 * 24 * time.Hour,
+		"app/app-1.2.tar.gz":     3 * 24 * time.Hour,
+		"app/app-1.3.tar.gz":     2 * 24 * time.Hour,
+		"app/README.md":          30 * 24 * time.Hour,
+		"lib/lib-2.0.tar.gz":     40 * 24 * time.Hour,
+		"site/v1/index.html":     time.Hour,
+		"site/v2/index.html":     time.Hour,
+		"site/current/index.txt": 50 * 24 * time.Hour,
+	}
+	folders := map[string]time.Duration{
+		"site/v1": 3 * time.Hour,
+		"site/v2": 2 * time.Hour,
+	}
+
+	setup := func() string {
+		t.Helper()
+		root, err := ioutil.TempDir("", "retention")
+		if nil != err {
+			t.Fatalf("While creating folder got %v", err)
+		}
+		for name, age := range files {
+			filename := filepath.Join(root, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(filename), 0755)
+			ioutil.WriteFile(filename, []byte(name), 0644)
+			os.Chtimes(filename, now.Add(-age), now.Add(-age))
+		}
+		for name, age := range folders {
+			filename := filepath.Join(root, filepath.FromSlash(name))
+			os.Chtimes(filename, now.Add(-age), now.Add(-age))
+		}
+		return root
+	}
+
+	testCases := []struct {
+		name     string
+		policy   RetentionPolicy
+		expected []string
+	}{
+		{"Keep last", RetentionPolicy{
+			Patterns: []string{"*.tar.gz", "/site/v*"},
+			KeepLast: 1,
+		}, []string{
+			"/app/app-1.2.tar.gz", "/app/app-1.1.tar.gz", "/app/app-1.0.tar.gz",
+			"/site/v1",
+		}},
+		{"Max age", RetentionPolicy{
+			Patterns: []string{"*.tar.gz"},
+			MaxAge:   72 * time.Hour,
+		}, []string{
+			"/app/app-1.1.tar.gz", "/app/app-1.0.tar.gz", "/lib/lib-2.0.tar.gz",
+		}},
+		{"Both", RetentionPolicy{
+			Patterns: []string{"*.tar.gz"},
+			KeepLast: 3,
+			MaxAge:   96*time.Hour + time.Minute,
+		}, []string{
+			"/app/app-1.0.tar.gz", "/lib/lib-2.0.tar.gz",
+		}},
+		{"Unlimited", RetentionPolicy{Patterns: []string{"*.tar.gz"}}, nil},
+		{"No patterns", RetentionPolicy{KeepLast: 1, MaxAge: time.Hour}, nil},
+	}
+
+	for _, tc := range testCases {
+		for _, dryRun := range []bool{true, false} {
+			t.Run(tc.name, func(t *testing.T) {
+				root := setup()
+				defer os.RemoveAll(root)
+				policy := tc.policy
+				policy.DryRun = dryRun
+
+				removed, err := Retain(root, policy, now)
+				if nil != err {
+					t.Fatalf("Expected no error but got %v", err)
+				}
+				if !reflect.DeepEqual(tc.expected, removed) {
+					t.Errorf("Expected %v removed but got %v", tc.expected, removed)
+				}
+				for _, name := range tc.expected {
+					_, err := os.Stat(filepath.Join(root, filepath.FromSlash(name)))
+					if dryRun == os.IsNotExist(err) {
+						t.Errorf("With dry run %t expected %s to exist %t", dryRun, name, dryRun)
+					}
+				}
+				if _, err := os.Stat(filepath.Join(root, "app", "README.md")); nil != err {
+					t.Errorf("Expected files not matching to be kept but got %v", err)
+				}
+			})
+		}
+	}
+
+	if _, err := Retain("/this/folder/should/never/exist", RetentionPolicy{}, now); nil == err {
+		t.Error("With missing folder expected an error but got nil")
+	}
+}
@@ -0,0 +1,92 @@
+package handle
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// RetryStorage is Storage reading the files of another Storage, such as a
+// remote object store, that resumes reads failing part way through a file.
+// The file is opened again and read from where the failed read started, which
+// backends reading ranges after a seek turn into a ranged request, so a
+// transient failure of the backend does not fail the download of the client.
+// Reads are retried up to Attempts times for each failure, waiting Backoff,
+// doubled after each attempt, between them. Files are copied to clients
+// through user space rather than with sendfile.
+type RetryStorage struct {
+	Storage  Storage
+	Attempts int
+	Backoff  time.Duration
+}
+
+// Open the named file or folder for reading.
+func (storage RetryStorage) Open(name string) (http.File, error) {
+	file, err := storage.Storage.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	return &retryFile{File: file, storage: storage, name: name}, nil
+}
+
+// Stat returns information describing the named file or folder.
+func (storage RetryStorage) Stat(name string) (os.FileInfo, error) {
+	return storage.Storage.Stat(name)
+}
+
+// ReadDir returns information describing the contents of the named folder,
+// sorted by name.
+func (storage RetryStorage) ReadDir(name string) ([]os.FileInfo, error) {
+	return storage.Storage.ReadDir(name)
+}
+
+// retryFile resumes failed reads of a file.
+type retryFile struct {
+	http.File
+	storage RetryStorage
+	name    string
+	offset  int64
+}
+
+// Read from the file, opening it again at the current offset if the read
+// fails.
+func (f *retryFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	backoff := f.storage.Backoff
+	for attempt := 0; nil != err && io.EOF != err && 0 == n &&
+		attempt < f.storage.Attempts; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		if resumeErr := f.resume(); nil != resumeErr {
+			continue
+		}
+		n, err = f.File.Read(b)
+	}
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset of the next read.
+func (f *retryFile) Seek(offset int64, whence int) (int64, error) {
+	offset, err := f.File.Seek(offset, whence)
+	if nil == err {
+		f.offset = offset
+	}
+	return offset, err
+}
+
+// resume reading by opening the file again at the current offset.
+func (f *retryFile) resume() error {
+	file, err := f.storage.Storage.Open(f.name)
+	if nil != err {
+		return err
+	}
+	if _, err = file.Seek(f.offset, io.SeekStart); nil != err {
+		file.Close()
+		return err
+	}
+	f.File.Close()
+	f.File = file
+	return nil
+}
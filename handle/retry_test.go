@@ -0,0 +1,99 @@
+package handle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// flakyStorage fails reads of opened files at offsets, as many times as
+// given for each offset.
+type flakyStorage struct {
+	Storage
+	failures map[int64]int
+	opened   int
+}
+
+func (storage *flakyStorage) Open(name string) (http.File, error) {
+	file, err := storage.Storage.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	storage.opened++
+	return &flakyFile{File: file, storage: storage}, nil
+}
+
+// flakyFile fails reads for its flakyStorage.
+type flakyFile struct {
+	http.File
+	storage *flakyStorage
+	offset  int64
+}
+
+func (f *flakyFile) Read(b []byte) (int, error) {
+	for at, failures := range f.storage.failures {
+		if 0 == failures || at < f.offset || f.offset+int64(len(b)) <= at {
+			continue
+		}
+		if f.offset == at {
+			f.storage.failures[at]--
+			return 0, errors.New("connection reset")
+		}
+		b = b[:at-f.offset]
+	}
+	n, err := f.File.Read(b)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *flakyFile) Seek(offset int64, whence int) (int64, error) {
+	offset, err := f.File.Seek(offset, whence)
+	f.offset = offset
+	return offset, err
+}
+
+func TestRetryStorage(t *testing.T) {
+	partial := http.StatusPartialContent
+	testCases := []struct {
+		name       string
+		failures   map[int64]int
+		attempts   int
+		byteRange  string
+		code       int
+		body       string
+		reopenings int
+	}{
+		{"No failures", nil, 2, "", ok, tmpFile, 0},
+		{"Failure at start", map[int64]int{0: 1}, 2, "", ok, tmpFile, 1},
+		{"Failures part way", map[int64]int{3: 1, 6: 1}, 1, "", ok, tmpFile, 2},
+		{"Repeated failure", map[int64]int{3: 2}, 2, "", ok, tmpFile, 2},
+		{"Range", map[int64]int{4: 1}, 1, "bytes=2-7", partial, tmpFile[2:8], 1},
+		{"Too many failures", map[int64]int{3: 3}, 2, "", ok, tmpFile[:3], 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flaky := &flakyStorage{
+				Storage:  Dir(baseDir),
+				failures: tc.failures,
+			}
+			storage := RetryStorage{Storage: flaky, Attempts: tc.attempts}
+			handler := Basic(FileServer(storage), "")
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/"+tmpFileName, nil)
+			if 0 < len(tc.byteRange) {
+				req.Header.Set("Range", tc.byteRange)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if tc.body != w.Body.String() {
+				t.Errorf("Expected body '%s' but got '%s'", tc.body, w.Body.String())
+			}
+			if reopenings := flaky.opened - 1; tc.reopenings != reopenings {
+				t.Errorf("Expected %d reopenings but got %d", tc.reopenings, reopenings)
+			}
+		})
+	}
+}
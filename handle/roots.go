@@ -0,0 +1,204 @@
+package handle
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// Roots is a Storage serving the files of one of several named folders, the
+// active root, which is switched at runtime to release a new version of a
+// site or roll back to the previous one, such as between blue and green
+// deployments. Safe for concurrent use.
+type Roots struct {
+	open func(folder string) Storage
+
+	mutex    sync.RWMutex
+	folders  map[string]string
+	storages map[string]Storage
+	active   string
+	previous string
+}
+
+// RootsState reports the registered roots by name and the active root.
+type RootsState struct {
+	Active   string            `json:"active"`
+	Previous string            `json:"previous,omitempty"`
+	Roots    map[string]string `json:"roots"`
+}
+
+// NewRoots returns roots serving the folder, registered with the name, until
+// another root is activated. Each root is read from the storage returned by
+// open for its folder.
+func NewRoots(name, folder string, open func(folder string) Storage) *Roots {
+	return &Roots{
+		open:     open,
+		folders:  map[string]string{name: folder},
+		storages: map[string]Storage{name: open(folder)},
+		active:   name,
+	}
+}
+
+// Register the folder as the root with the name. The folder must exist and
+// the active root cannot be replaced.
+func (roots *Roots) Register(name, folder string) error {
+	if 0 == len(name) {
+		return fmt.Errorf("name of root for '%s' must not be empty", folder)
+	}
+	if info, err := os.Stat(folder); nil != err || !info.IsDir() {
+		return fmt.Errorf("folder of root '%s' must be a folder but '%s' is not", name, folder)
+	}
+	roots.mutex.Lock()
+	defer roots.mutex.Unlock()
+	if name == roots.active {
+		return fmt.Errorf("active root '%s' cannot be replaced", name)
+	}
+	roots.folders[name] = folder
+	roots.storages[name] = roots.open(folder)
+	return nil
+}
+
+// Activate the root with the name, remembering the root it replaces for
+// Rollback.
+func (roots *Roots) Activate(name string) error {
+	roots.mutex.Lock()
+	defer roots.mutex.Unlock()
+	if _, ok := roots.storages[name]; !ok {
+		return fmt.Errorf("unknown root '%s'", name)
+	}
+	if name != roots.active {
+		roots.previous, roots.active = roots.active, name
+	}
+	return nil
+}
+
+// Rollback activates the root that was active before the current one.
+func (roots *Roots) Rollback() error {
+	roots.mutex.Lock()
+	defer roots.mutex.Unlock()
+	if 0 == len(roots.previous) {
+		return fmt.Errorf("no root to roll back to from '%s'", roots.active)
+	}
+	roots.previous, roots.active = roots.active, roots.previous
+	return nil
+}
+
+// State of the roots.
+func (roots *Roots) State() RootsState {
+	roots.mutex.RLock()
+	defer roots.mutex.RUnlock()
+	folders := make(map[string]string, len(roots.folders))
+	for name, folder := range roots.folders {
+		folders[name] = folder
+	}
+	return RootsState{
+		Active:   roots.active,
+		Previous: roots.previous,
+		Roots:    folders,
+	}
+}
+
+// Open the named file or folder of the active root for reading.
+func (roots *Roots) Open(name string) (http.File, error) {
+	return roots.current().Open(name)
+}
+
+// Stat returns information describing the named file or folder of the active
+// root.
+func (roots *Roots) Stat(name string) (os.FileInfo, error) {
+	return roots.current().Stat(name)
+}
+
+// ReadDir returns information describing the contents of the named folder of
+// the active root, sorted by name.
+func (roots *Roots) ReadDir(name string) ([]os.FileInfo, error) {
+	return roots.current().ReadDir(name)
+}
+
+// current storage of the active root.
+func (roots *Roots) current() Storage {
+	roots.mutex.RLock()
+	defer roots.mutex.RUnlock()
+	return roots.storages[roots.active]
+}
+
+// Handler serves the state of the roots as JSON to clients authenticated by a
+// realm or on an administrative listener (see WithAdminListener), refusing
+// all others with 'FORBIDDEN'. POST requests change the roots first, with form
+// values 'activate' activating the named root and 'rollback' activating the
+// previous root. Roots are only registered by the application, never over
+// HTTP. POST requests from another origin, such as cross-site forms, are
+// refused with 'FORBIDDEN' and changes that cannot be made are answered with
+// 'BAD REQUEST'.
+func (roots *Roots) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if 0 == len(Subject(r)) && !AdminListener(r) {
+			refuseRoots(w, r, "unauthenticated")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			if !sameOrigin(r) {
+				refuseRoots(w, r, "cross-origin")
+				return
+			}
+			var err error
+			switch {
+			case "" != r.FormValue("activate"):
+				err = roots.Activate(r.FormValue("activate"))
+			case "" != r.FormValue("rollback"):
+				err = roots.Rollback()
+			default:
+				err = fmt.Errorf("one of 'activate' or 'rollback' must be set")
+			}
+			if nil != err {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			Tracef(r, "changed roots, '%s' is active", roots.State().Active)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(
+				w,
+				http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed,
+			)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roots.State())
+	}
+}
+
+// sameOrigin returns true if the request was sent from the origin of the
+// server, or without an 'Origin' header by clients other than browsers.
+func sameOrigin(r *http.Request) bool {
+	if "cross-site" == r.Header.Get("Sec-Fetch-Site") {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if 0 == len(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return nil == err && 0 < len(u.Host) && r.Host == u.Host
+}
+
+// refuseRoots logs and refuses a request for the roots with 'FORBIDDEN'.
+func refuseRoots(w http.ResponseWriter, r *http.Request, reason string) {
+	log.Printf(
+		"DENY: %s %s %s%s roots %s%s\n",
+		r.Method,
+		r.Proto,
+		r.Host,
+		r.URL.Path,
+		reason,
+		annotations(r),
+	)
+	http.Error(w, "403 forbidden", http.StatusForbidden)
+}
@@ -0,0 +1,155 @@
+package handle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roots")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	blue, green := filepath.Join(dir, "blue"), filepath.Join(dir, "green")
+	for _, folder := range []string{blue, green} {
+		os.Mkdir(folder, 0755)
+		ioutil.WriteFile(filepath.Join(folder, "index.txt"), []byte(filepath.Base(folder)), 0644)
+	}
+
+	roots := NewRoots("blue", blue, func(folder string) Storage { return Dir(folder) })
+	files := Basic(FileServer(roots), "")
+	admin := roots.Handler()
+
+	serves := func(expected string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		files(w, httptest.NewRequest("GET", "http://localhost/index.txt", nil))
+		if expected != w.Body.String() {
+			t.Errorf("Expected root '%s' to be served but got '%s'", expected, w.Body)
+		}
+	}
+	change := func(query string, code int) RootsState {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://localhost/__roots?"+query, nil)
+		admin(w, WithSubject(req, "admin"))
+		if code != w.Code {
+			t.Fatalf("For '%s' expected status code %d but got %d", query, code, w.Code)
+		}
+		var state RootsState
+		if ok == code {
+			if err := json.NewDecoder(w.Body).Decode(&state); nil != err {
+				t.Fatalf("For '%s' got %v", query, err)
+			}
+		}
+		return state
+	}
+
+	serves("blue")
+	change("rollback=1", http.StatusBadRequest)
+	change("activate=green", http.StatusBadRequest)
+	change("", http.StatusBadRequest)
+	if err = roots.Register("green", filepath.Join(dir, "missing")); nil == err {
+		t.Error("Expected a missing folder to be refused but got no error")
+	}
+	if err = roots.Register("blue", green); nil == err {
+		t.Error("Expected a registered name to be refused but got no error")
+	}
+
+	// Folders are never registered over HTTP.
+	change("name=green&folder="+green, http.StatusBadRequest)
+	if err = roots.Register("green", green); nil != err {
+		t.Fatalf("While registering got %v", err)
+	}
+	serves("blue")
+
+	state := change("activate=green", ok)
+	if "green" != state.Active || "blue" != state.Previous {
+		t.Errorf("Expected green active after blue but got %v", state)
+	}
+	serves("green")
+
+	state = change("rollback=1", ok)
+	if "blue" != state.Active || "green" != state.Previous {
+		t.Errorf("Expected blue active after green but got %v", state)
+	}
+	serves("blue")
+
+	w := httptest.NewRecorder()
+	admin(w, WithSubject(httptest.NewRequest("GET", "http://localhost/__roots", nil), "admin"))
+	if ok != w.Code || "application/json" != w.Header().Get("Content-Type") {
+		t.Errorf("Expected the state as JSON but got %d %s", w.Code, w.Header())
+	}
+	w = httptest.NewRecorder()
+	admin(w, WithSubject(httptest.NewRequest("DELETE", "http://localhost/__roots", nil), "admin"))
+	if http.StatusMethodNotAllowed != w.Code {
+		t.Errorf("Expected status code %d but got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestRootsAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roots")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	roots := NewRoots("blue", dir, func(folder string) Storage { return Dir(folder) })
+	if err = roots.Register("green", dir); nil != err {
+		t.Fatalf("While registering got %v", err)
+	}
+	admin := roots.Handler()
+
+	testCases := []struct {
+		name   string
+		method string
+		setup  func(*http.Request) *http.Request
+		code   int
+	}{
+		{"Anonymous", "GET", nil, http.StatusForbidden},
+		{"AnonymousChange", "POST", nil, http.StatusForbidden},
+		{"Authenticated", "POST", func(r *http.Request) *http.Request {
+			return WithSubject(r, "admin")
+		}, ok},
+		{"AdminListener", "POST", func(r *http.Request) (admitted *http.Request) {
+			WithAdminListener(func(w http.ResponseWriter, r *http.Request) {
+				admitted = r
+			})(nil, r)
+			return
+		}, ok},
+		{"SameOrigin", "POST", func(r *http.Request) *http.Request {
+			r.Header.Set("Origin", "http://localhost")
+			return WithSubject(r, "admin")
+		}, ok},
+		{"CrossOrigin", "POST", func(r *http.Request) *http.Request {
+			r.Header.Set("Origin", "http://example.com")
+			return WithSubject(r, "admin")
+		}, http.StatusForbidden},
+		{"NullOrigin", "POST", func(r *http.Request) *http.Request {
+			r.Header.Set("Origin", "null")
+			return WithSubject(r, "admin")
+		}, http.StatusForbidden},
+		{"CrossSite", "POST", func(r *http.Request) *http.Request {
+			r.Header.Set("Sec-Fetch-Site", "cross-site")
+			return WithSubject(r, "admin")
+		}, http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost/__roots?activate=green", nil)
+			if nil != tc.setup {
+				req = tc.setup(req)
+			}
+			w := httptest.NewRecorder()
+			admin(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handle
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Routes of request methods to their handlers, such as GET and HEAD to the
+// file server, WebDAV verbs to a WebDAV handler or PUT to uploads, so that
+// features for a method are added to the table rather than by checking the
+// method in other handlers.
+type Routes map[string]http.HandlerFunc
+
+// FileRoutes returns routes serving GET and HEAD requests with the handler,
+// such as one returned by Basic or Prefix.
+func FileRoutes(serve http.HandlerFunc) Routes {
+	return Routes{
+		http.MethodGet:  serve,
+		http.MethodHead: serve,
+	}
+}
+
+// Handler returns a handler passing each request to the route of its method.
+// Without a route, OPTIONS requests are answered with the methods allowed in
+// the 'Allow' header and requests for other methods are refused with '405
+// METHOD NOT ALLOWED'.
+func (routes Routes) Handler() http.HandlerFunc {
+	methods := make([]string, 0, len(routes)+1)
+	for method := range routes {
+		methods = append(methods, method)
+	}
+	if _, ok := routes[http.MethodOptions]; !ok {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	allow := strings.Join(methods, ", ")
+
+	table := make(Routes, len(routes))
+	for method, serve := range routes {
+		table[method] = serve
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if serve, ok := table[r.Method]; ok {
+			serve(w, r)
+			return
+		}
+		w.Header().Set("Allow", allow)
+		if http.MethodOptions == r.Method {
+			Tracef(r, "answered with allowed methods '%s'", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		Tracef(r, "method '%s' not allowed", r.Method)
+		http.Error(
+			w,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed,
+		)
+	}
+}
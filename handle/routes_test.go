@@ -0,0 +1,59 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	routes := FileRoutes(Basic(FileServer(Dir(baseDir)), ""))
+	routes["PROPFIND"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	handler := routes.Handler()
+	allow := "GET, HEAD, OPTIONS, PROPFIND"
+
+	testCases := []struct {
+		name     string
+		method   string
+		code     int
+		allow    string
+		contents string
+	}{
+		{"Get", http.MethodGet, ok, "", tmpFile},
+		{"Head", http.MethodHead, ok, "", ""},
+		{"Options", http.MethodOptions, http.StatusNoContent, allow, ""},
+		{"WebDAV", "PROPFIND", http.StatusMultiStatus, "", ""},
+		{"Post", http.MethodPost, http.StatusMethodNotAllowed, allow, "Method Not Allowed\n"},
+		{"Unknown", "BREW", http.StatusMethodNotAllowed, allow, "Method Not Allowed\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost/"+tmpFileName, nil)
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if value := w.Header().Get("Allow"); tc.allow != value {
+				t.Errorf("Expected Allow '%s' but got '%s'", tc.allow, value)
+			}
+			if http.MethodHead != tc.method && tc.contents != w.Body.String() {
+				t.Errorf("Expected body '%s' but got '%s'", tc.contents, w.Body.String())
+			}
+		})
+	}
+
+	// Routes for OPTIONS replace the description of the methods allowed.
+	routes[http.MethodOptions] = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("DAV", "1")
+	}
+	w := httptest.NewRecorder()
+	routes.Handler()(w, httptest.NewRequest(http.MethodOptions, "http://localhost/", nil))
+	if "1" != w.Header().Get("DAV") || "" != w.Header().Get("Allow") {
+		t.Errorf("Expected the OPTIONS route but got headers %v", w.Header())
+	}
+}
@@ -0,0 +1,53 @@
+package handle
+
+import (
+	"runtime"
+	"sync"
+)
+
+// RegisterRuntime registers metrics of memory allocations, garbage
+// collection and goroutines created from the registry. The returned function
+// updates them from the runtime and should be called before the metrics are
+// served, as reading the runtime memory statistics briefly stops the world.
+func RegisterRuntime(registry MetricsRegistry) func() {
+	allocations := registry.Counter(
+		"static_file_server_allocations_total",
+		"Number of heap objects allocated.",
+	)
+	allocated := registry.Counter(
+		"static_file_server_allocated_bytes_total",
+		"Number of bytes allocated for heap objects.",
+	)
+	gcCycles := registry.Counter(
+		"static_file_server_gc_cycles_total",
+		"Number of completed garbage collection cycles.",
+	)
+	gcPauses := registry.Counter(
+		"static_file_server_gc_pause_seconds_total",
+		"Time the program was stopped for garbage collection.",
+	)
+	heap := registry.Gauge(
+		"static_file_server_heap_bytes",
+		"Number of bytes of allocated heap objects.",
+	)
+	goroutines := registry.Gauge(
+		"static_file_server_goroutines",
+		"Number of goroutines.",
+	)
+
+	var mutex sync.Mutex
+	var last runtime.MemStats
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		allocations.Add(float64(stats.Mallocs - last.Mallocs))
+		allocated.Add(float64(stats.TotalAlloc - last.TotalAlloc))
+		gcCycles.Add(float64(stats.NumGC - last.NumGC))
+		gcPauses.Add(float64(stats.PauseTotalNs-last.PauseTotalNs) / 1e9)
+		heap.Set(float64(stats.HeapAlloc))
+		goroutines.Set(float64(runtime.NumGoroutine()))
+		last = stats
+	}
+}
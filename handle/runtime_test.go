@@ -0,0 +1,41 @@
+package handle
+
+import (
+	"testing"
+)
+
+func TestRegisterRuntime(t *testing.T) {
+	registry := &testRegistry{values: make(map[string]float64)}
+	update := RegisterRuntime(registry)
+
+	update()
+	allocations := registry.values["static_file_server_allocations_total"]
+	if 0 >= allocations {
+		t.Errorf("Expected allocations to be counted but got %v", allocations)
+	}
+	for _, name := range []string{
+		"static_file_server_allocated_bytes_total",
+		"static_file_server_heap_bytes",
+		"static_file_server_goroutines",
+	} {
+		if 0 >= registry.values[name] {
+			t.Errorf("Expected %s to be positive but got %v", name, registry.values[name])
+		}
+	}
+
+	// Counters only increase by the change since the last update.
+	garbage := make([][]byte, 100)
+	for i := range garbage {
+		garbage[i] = make([]byte, 1024)
+	}
+	update()
+	if registry.values["static_file_server_allocations_total"] < allocations+100 {
+		t.Errorf(
+			"Expected at least %v allocations but got %v",
+			allocations+100, registry.values["static_file_server_allocations_total"],
+		)
+	}
+	if 0 == len(garbage) {
+		t.Error("Expected garbage to be kept")
+	}
+}
@@ -0,0 +1,479 @@
+package handle
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Actions of script statements.
+const (
+	scriptAllow    = "allow"
+	scriptDeny     = "deny"
+	scriptRedirect = "redirect"
+	scriptRewrite  = "rewrite"
+	scriptHeader   = "header"
+)
+
+// scriptOperators recognized in conditions, longest first.
+var scriptOperators = []string{
+	"==", "!=", "^=", "!~", "&&", "||", "~", "!", "(", ")",
+}
+
+// Script of statements deciding how requests are served, for edge cases the
+// declarative rules do not cover. Each line holds a statement in the form
+// 'action [arguments] [if condition]'. Statements are applied in order, those
+// with a condition only if it holds:
+//
+//	allow                  serves the request, skipping later statements
+//	deny [code]            refuses the request, 'FORBIDDEN' by default
+//	redirect [code] "url"  redirects the request, 'FOUND' by default
+//	rewrite "path"         serves the path, with an optional '?query', instead
+//	header Name "value"    sets the response header, removing it if empty
+//
+// Conditions compare request attributes, being method, path, query, host, ip,
+// country, subject, header.Name, query.name and cookie.name, with strings
+// using '==', '!=', '^=' (starts with), '~' (matches the regular expression)
+// and '!~', combined with '&&', '||', '!' and parentheses. An attribute on its
+// own holds if it is not empty. Arguments may refer to the groups of the
+// regular expression matched last as $1 or ${name}. Strings are double-quoted
+// with Go escapes or back-quoted without, and '#' starts a comment.
+type Script struct {
+	statements []scriptStatement
+}
+
+// scriptStatement is an action applied if its condition, if any, holds.
+type scriptStatement struct {
+	source    string
+	action    string
+	code      int
+	name      string
+	value     string
+	condition scriptExpr
+}
+
+// scriptExpr is a condition of a statement.
+type scriptExpr interface {
+	eval(env *scriptEnv) bool
+}
+
+// scriptEnv is the request a statement is applied to and the groups of the
+// regular expression matched last.
+type scriptEnv struct {
+	r       *http.Request
+	pattern *regexp.Regexp
+	source  string
+	match   []int
+}
+
+// ParseScript converts the source into a Script, returning an error naming
+// the line of the first invalid statement.
+func ParseScript(source string) (*Script, error) {
+	script := &Script{}
+	for i, line := range strings.Split(source, "\n") {
+		tokens, err := scanScript(line)
+		if nil == err && 0 < len(tokens) {
+			var statement scriptStatement
+			parser := &scriptParser{tokens: tokens}
+			if statement, err = parser.statement(); nil == err {
+				statement.source = strings.TrimSpace(line)
+				script.statements = append(script.statements, statement)
+			}
+		}
+		if nil != err {
+			return nil, fmt.Errorf("invalid script line %d: %v", i+1, err)
+		}
+	}
+	return script, nil
+}
+
+// WithScript wraps an HTTP request, applying the statements of the script.
+// Requests refused or redirected are logged and the deciding statement is
+// added to the access log.
+func WithScript(serve http.HandlerFunc, script *Script) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		env := &scriptEnv{r: r}
+		for _, statement := range script.statements {
+			env.pattern = nil
+			if nil != statement.condition && !statement.condition.eval(env) {
+				continue
+			}
+			switch statement.action {
+			case scriptAllow:
+				serve(w, annotate(env.r, "script-rule", "'"+statement.source+"'"))
+				return
+			case scriptDeny:
+				r = annotate(env.r, "script-rule", "'"+statement.source+"'")
+				audit(r, AuditEvent{Event: AuditScriptDeny, Rule: statement.source})
+				log.Printf(
+					"DENY: %s %s %s%s script %d%s\n",
+					r.Method, r.Proto, r.Host, r.URL.Path, statement.code, annotations(r),
+				)
+				http.Error(w, fmt.Sprintf(
+					"%d %s", statement.code, strings.ToLower(http.StatusText(statement.code)),
+				), statement.code)
+				return
+			case scriptRedirect:
+				r = annotate(env.r, "script-rule", "'"+statement.source+"'")
+				http.Redirect(w, r, env.expand(statement.value), statement.code)
+				return
+			case scriptRewrite:
+				rewritten := *env.r.URL
+				rewritten.Path, rewritten.RawPath = env.expand(statement.value), ""
+				if index := strings.Index(rewritten.Path, "?"); 0 <= index {
+					rewritten.Path, rewritten.RawQuery =
+						rewritten.Path[:index], rewritten.Path[index+1:]
+				}
+				r = env.r.WithContext(env.r.Context())
+				r.URL = &rewritten
+				env.r = r
+			case scriptHeader:
+				if value := env.expand(statement.value); 0 < len(value) {
+					w.Header().Set(statement.name, value)
+				} else {
+					w.Header().Del(statement.name)
+				}
+			}
+		}
+		serve(w, env.r)
+	}
+}
+
+// expand the groups of the regular expression matched last in the template.
+func (env *scriptEnv) expand(template string) string {
+	if nil == env.pattern {
+		return template
+	}
+	return string(env.pattern.ExpandString(nil, template, env.source, env.match))
+}
+
+// attribute returns the value of the named attribute of the request.
+func (env *scriptEnv) attribute(name string) string {
+	r := env.r
+	switch name {
+	case "method":
+		return r.Method
+	case "path":
+		return r.URL.Path
+	case "query":
+		return r.URL.RawQuery
+	case "host":
+		return r.Host
+	case "ip":
+		if ip := clientIP(r); nil != ip {
+			return ip.String()
+		}
+		return ""
+	case "country":
+		return Country(r)
+	case "subject":
+		return Subject(r)
+	}
+	switch {
+	case strings.HasPrefix(name, "header."):
+		return r.Header.Get(strings.TrimPrefix(name, "header."))
+	case strings.HasPrefix(name, "query."):
+		return r.URL.Query().Get(strings.TrimPrefix(name, "query."))
+	case strings.HasPrefix(name, "cookie."):
+		if cookie, err := r.Cookie(strings.TrimPrefix(name, "cookie.")); nil == err {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// validScriptAttribute returns true if the attribute is known.
+func validScriptAttribute(name string) bool {
+	switch name {
+	case "method", "path", "query", "host", "ip", "country", "subject":
+		return true
+	}
+	for _, prefix := range []string{"header.", "query.", "cookie."} {
+		if strings.HasPrefix(name, prefix) && len(prefix) < len(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptCompare compares an attribute with a value. Without an operator the
+// attribute must not be empty.
+type scriptCompare struct {
+	attribute string
+	operator  string
+	value     string
+	pattern   *regexp.Regexp
+}
+
+func (compare scriptCompare) eval(env *scriptEnv) bool {
+	actual := env.attribute(compare.attribute)
+	switch compare.operator {
+	case "==":
+		return compare.value == actual
+	case "!=":
+		return compare.value != actual
+	case "^=":
+		return strings.HasPrefix(actual, compare.value)
+	case "~":
+		match := compare.pattern.FindStringSubmatchIndex(actual)
+		if nil == match {
+			return false
+		}
+		env.pattern, env.source, env.match = compare.pattern, actual, match
+		return true
+	case "!~":
+		return !compare.pattern.MatchString(actual)
+	}
+	return 0 < len(actual)
+}
+
+// scriptNot negates a condition.
+type scriptNot struct {
+	expr scriptExpr
+}
+
+func (not scriptNot) eval(env *scriptEnv) bool {
+	return !not.expr.eval(env)
+}
+
+// scriptLogic combines two conditions with '&&' or '||'.
+type scriptLogic struct {
+	and         bool
+	left, right scriptExpr
+}
+
+func (logic scriptLogic) eval(env *scriptEnv) bool {
+	if logic.and {
+		return logic.left.eval(env) && logic.right.eval(env)
+	}
+	return logic.left.eval(env) || logic.right.eval(env)
+}
+
+// Kinds of script tokens.
+const (
+	scriptWord = iota + 1
+	scriptString
+	scriptOperator
+)
+
+// scriptToken of a statement.
+type scriptToken struct {
+	kind int
+	text string
+}
+
+// scanScript splits the line into tokens, ignoring any comment.
+func scanScript(line string) (tokens []scriptToken, err error) {
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case ' ' == c || '\t' == c || '\r' == c:
+			i++
+		case '#' == c:
+			return
+		case '"' == c || '`' == c:
+			end := i + 1
+			for ; end < len(line) && c != line[end]; end++ {
+				if '\\' == line[end] && '"' == c {
+					end++
+				}
+			}
+			if len(line) <= end {
+				return nil, errors.New("unterminated string")
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if nil != err {
+				return nil, fmt.Errorf("invalid string %s", line[i:end+1])
+			}
+			tokens = append(tokens, scriptToken{scriptString, value})
+			i = end + 1
+		case isScriptWord(c):
+			end := i
+			for end < len(line) && isScriptWord(line[end]) {
+				end++
+			}
+			tokens = append(tokens, scriptToken{scriptWord, line[i:end]})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range scriptOperators {
+				if strings.HasPrefix(line[i:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if 0 == len(operator) {
+				return nil, fmt.Errorf("unexpected '%c'", c)
+			}
+			tokens = append(tokens, scriptToken{scriptOperator, operator})
+			i += len(operator)
+		}
+	}
+	return
+}
+
+// isScriptWord returns true if the byte belongs in actions, attributes and
+// codes.
+func isScriptWord(c byte) bool {
+	return 'a' <= c && 'z' >= c || 'A' <= c && 'Z' >= c || '0' <= c && '9' >= c ||
+		'.' == c || '-' == c || '_' == c
+}
+
+// scriptParser parses the tokens of a statement.
+type scriptParser struct {
+	tokens []scriptToken
+	next   int
+}
+
+// peek returns the next token, which is empty at the end of the statement.
+func (parser *scriptParser) peek() scriptToken {
+	if parser.next < len(parser.tokens) {
+		return parser.tokens[parser.next]
+	}
+	return scriptToken{}
+}
+
+// take returns the next token, moving past it.
+func (parser *scriptParser) take() scriptToken {
+	token := parser.peek()
+	if parser.next < len(parser.tokens) {
+		parser.next++
+	}
+	return token
+}
+
+// expect returns the text of the next token if it is of the kind.
+func (parser *scriptParser) expect(kind int, what string) (string, error) {
+	token := parser.take()
+	if kind != token.kind {
+		return "", fmt.Errorf("expected %s but got '%s'", what, token.text)
+	}
+	return token.text, nil
+}
+
+// code parses an optional status code, returning the fallback without one.
+func (parser *scriptParser) code(fallback, min, max int) (int, error) {
+	if token := parser.peek(); scriptWord != token.kind || "if" == token.text {
+		return fallback, nil
+	}
+	text := parser.take().text
+	code, err := strconv.Atoi(text)
+	if nil != err || min > code || max < code {
+		return 0, fmt.Errorf("invalid status code '%s'", text)
+	}
+	return code, nil
+}
+
+// statement parses 'action [arguments] [if condition]'.
+func (parser *scriptParser) statement() (statement scriptStatement, err error) {
+	if statement.action, err = parser.expect(scriptWord, "an action"); nil != err {
+		return
+	}
+	switch statement.action {
+	case scriptAllow:
+	case scriptDeny:
+		statement.code, err = parser.code(http.StatusForbidden, 400, 599)
+	case scriptRedirect:
+		if statement.code, err = parser.code(http.StatusFound, 300, 399); nil == err {
+			statement.value, err = parser.expect(scriptString, "a quoted URL")
+		}
+	case scriptRewrite:
+		statement.value, err = parser.expect(scriptString, "a quoted path")
+		if nil == err && !strings.HasPrefix(statement.value, "/") {
+			err = fmt.Errorf("path '%s' must start with '/'", statement.value)
+		}
+	case scriptHeader:
+		if statement.name, err = parser.expect(scriptWord, "a header name"); nil == err {
+			statement.value, err = parser.expect(scriptString, "a quoted value")
+		}
+	default:
+		err = fmt.Errorf("unknown action '%s'", statement.action)
+	}
+	if nil != err {
+		return
+	}
+
+	if (scriptToken{scriptWord, "if"}) == parser.peek() {
+		parser.take()
+		if statement.condition, err = parser.or(); nil != err {
+			return
+		}
+	}
+	if token := parser.take(); 0 != token.kind {
+		err = fmt.Errorf("unexpected '%s'", token.text)
+	}
+	return
+}
+
+// or parses conditions separated by '||'.
+func (parser *scriptParser) or() (scriptExpr, error) {
+	left, err := parser.and()
+	for nil == err && (scriptToken{scriptOperator, "||"}) == parser.peek() {
+		parser.take()
+		var right scriptExpr
+		if right, err = parser.and(); nil == err {
+			left = scriptLogic{false, left, right}
+		}
+	}
+	return left, err
+}
+
+// and parses conditions separated by '&&'.
+func (parser *scriptParser) and() (scriptExpr, error) {
+	left, err := parser.unary()
+	for nil == err && (scriptToken{scriptOperator, "&&"}) == parser.peek() {
+		parser.take()
+		var right scriptExpr
+		if right, err = parser.unary(); nil == err {
+			left = scriptLogic{true, left, right}
+		}
+	}
+	return left, err
+}
+
+// unary parses a negated or parenthesized condition, or a comparison.
+func (parser *scriptParser) unary() (scriptExpr, error) {
+	token := parser.take()
+	switch {
+	case (scriptToken{scriptOperator, "!"}) == token:
+		expr, err := parser.unary()
+		return scriptNot{expr}, err
+	case (scriptToken{scriptOperator, "("}) == token:
+		expr, err := parser.or()
+		if nil == err {
+			if closing := parser.take(); (scriptToken{scriptOperator, ")"}) != closing {
+				err = fmt.Errorf("expected ')' but got '%s'", closing.text)
+			}
+		}
+		return expr, err
+	case scriptWord != token.kind:
+		return nil, fmt.Errorf("expected an attribute but got '%s'", token.text)
+	case !validScriptAttribute(token.text):
+		return nil, fmt.Errorf("unknown attribute '%s'", token.text)
+	}
+
+	compare := scriptCompare{attribute: token.text}
+	switch next := parser.peek(); next.text {
+	case "==", "!=", "^=", "~", "!~":
+		if scriptOperator != next.kind {
+			return compare, nil
+		}
+		compare.operator = parser.take().text
+	default:
+		return compare, nil
+	}
+	var err error
+	if compare.value, err = parser.expect(scriptString, "a quoted value"); nil != err {
+		return nil, err
+	}
+	if "~" == compare.operator || "!~" == compare.operator {
+		if compare.pattern, err = regexp.Compile(compare.value); nil != err {
+			return nil, err
+		}
+	}
+	return compare, nil
+}
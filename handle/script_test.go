@@ -0,0 +1,102 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	testCases := []struct {
+		name    string
+		source  string
+		isError bool
+	}{
+		{"Empty", "\n  # only a comment\n", false},
+		{"Actions", "allow if subject\ndeny 451 if country == \"XX\"\nredirect 301 \"https://example.com\"\nrewrite \"/v2/$1\" if path ~ `^/v1/(.*)$`\nheader X-Env \"test\" # trailing comment", false},
+		{"Logic", "deny if !(method == \"GET\" || method == \"HEAD\") && header.X-Token != \"secret\"", false},
+		{"Unknown action", "permit", true},
+		{"Unknown attribute", "deny if weather == \"rain\"", true},
+		{"Bad code", "deny 200", true},
+		{"Bad redirect code", "redirect 404 \"/\"", true},
+		{"Missing URL", "redirect 301", true},
+		{"Relative rewrite", "rewrite \"v2\"", true},
+		{"Unterminated string", "header X-Env \"test", true},
+		{"Unquoted value", "deny if path == /private", true},
+		{"Bad expression", "deny if path ~ \"(\"", true},
+		{"Unbalanced", "deny if (path ^= \"/a\"", true},
+		{"Trailing tokens", "allow now", true},
+		{"Missing condition", "allow if", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseScript(tc.source); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestWithScript(t *testing.T) {
+	script, err := ParseScript(`
+# Staff skip the rules below.
+allow if cookie.role == "staff"
+deny if header.User-Agent ~ "(?i)scanner" || query.debug
+redirect 301 "https://new.example.com/$1" if host == "old.example.com" && path ~ "^/(.*)$"
+rewrite "/v2/${rest}?from=v1" if path ~ "^/v1/(?P<rest>.*)$"
+header Cache-Control "no-store" if path ^= "/v2/"
+deny 404 if path == "/v2/hidden.txt"
+`)
+	if nil != err {
+		t.Fatalf("While parsing got %v", err)
+	}
+	handler := WithScript(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI()))
+	}, script)
+
+	testCases := []struct {
+		name     string
+		url      string
+		agent    string
+		cookie   string
+		code     int
+		body     string
+		location string
+		cache    string
+	}{
+		{"Served", "http://localhost/file.txt", "", "", ok, "/file.txt", "", ""},
+		{"Denied agent", "http://localhost/file.txt", "Scanner/1.0", "", http.StatusForbidden, "403 forbidden\n", "", ""},
+		{"Denied query", "http://localhost/file.txt?debug=1", "", "", http.StatusForbidden, "403 forbidden\n", "", ""},
+		{"Allowed staff", "http://localhost/file.txt?debug=1", "", "staff", ok, "/file.txt?debug=1", "", ""},
+		{"Redirected", "http://old.example.com/a/b.txt", "", "", http.StatusMovedPermanently, "", "https://new.example.com/a/b.txt", ""},
+		{"Rewritten", "http://localhost/v1/app.js", "", "", ok, "/v2/app.js?from=v1", "", "no-store"},
+		{"Rewritten and denied", "http://localhost/v1/hidden.txt", "", "", http.StatusNotFound, "404 not found\n", "", "no-store"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			if 0 < len(tc.agent) {
+				req.Header.Set("User-Agent", tc.agent)
+			}
+			if 0 < len(tc.cookie) {
+				req.AddCookie(&http.Cookie{Name: "role", Value: tc.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if 0 < len(tc.body) && tc.body != w.Body.String() {
+				t.Errorf("Expected body '%s' but got '%s'", tc.body, w.Body.String())
+			}
+			if location := w.Header().Get("Location"); tc.location != location {
+				t.Errorf("Expected location '%s' but got '%s'", tc.location, location)
+			}
+			if cache := w.Header().Get("Cache-Control"); tc.cache != cache {
+				t.Errorf("Expected Cache-Control '%s' but got '%s'", tc.cache, cache)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package handle
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Defaults and limits for search pagination.
+	defaultSearchLimit = 50
+	maxSearchLimit     = 1000
+
+	// maxSearchFileSize of files whose contents are searched.
+	maxSearchFileSize = 10 << 20
+)
+
+// SearchResult for a single matching file.
+type SearchResult struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Title    string    `json:"title,omitempty"`
+	Score    float64   `json:"score,omitempty"`
+}
+
+// SearchResults for a page of matching files.
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Path    string         `json:"path"`
+	Page    int            `json:"page"`
+	Limit   int            `json:"limit"`
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+// WithSearch wraps an HTTP request. Requests for searchPath are answered with
+// SearchResults as JSON for files in the folder. The following query
+// parameters are accepted:
+//
+//	q         Glob pattern (if it contains any of '*?[') matched against
+//	          file names, otherwise a case-insensitive substring.
+//	path      URL path of the folder to limit the search to (default '/').
+//	contents  If set and allowContents is true, substrings are also matched
+//	          against the contents of text files.
+//	page      Page number starting at 1.
+//	limit     Results per page (default 50, maximum 1000).
+//
+// Result paths include urlPrefix. Files the client could not read, such as
+// within auth realms it is not authenticated for, are left out before their
+// contents are searched (see Allowed). All other requests are passed through.
+func WithSearch(
+	serve http.HandlerFunc,
+	searchPath string,
+	storage Storage,
+	urlPrefix string,
+	allowContents bool,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if searchPath != r.URL.Path {
+			serve(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		results := SearchResults{
+			Query:   query.Get("q"),
+			Path:    path.Clean("/" + query.Get("path")),
+			Page:    queryInt(query.Get("page"), 1, 1, int(^uint(0)>>1)),
+			Limit:   queryInt(query.Get("limit"), defaultSearchLimit, 1, maxSearchLimit),
+			Results: []SearchResult{},
+		}
+		if 0 == len(results.Query) {
+			http.Error(w, "400 missing query", http.StatusBadRequest)
+			return
+		}
+		if _, err := path.Match(results.Query, ""); nil != err {
+			http.Error(w, "400 bad query pattern", http.StatusBadRequest)
+			return
+		}
+		matcher := searchMatcher(
+			storage,
+			results.Query,
+			allowContents && 0 < len(query.Get("contents")),
+		)
+
+		first := (results.Page - 1) * results.Limit
+		walkStorage(storage, results.Path, func(name string, info os.FileInfo, err error) error {
+			if nil != err || info.IsDir() || !Allowed(r, urlPrefix+name) ||
+				!matcher(name, info) {
+				return nil
+			}
+			if first <= results.Total && len(results.Results) < results.Limit {
+				results.Results = append(results.Results, SearchResult{
+					Path:     urlPrefix + name,
+					Size:     info.Size(),
+					Modified: info.ModTime().UTC(),
+				})
+			}
+			results.Total++
+			return nil
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
+
+// searchMatcher returns a function reporting whether a file matches the query.
+func searchMatcher(
+	storage Storage, query string, contents bool,
+) func(string, os.FileInfo) bool {
+	if strings.ContainsAny(query, "*?[") {
+		return func(name string, info os.FileInfo) bool {
+			matched, _ := path.Match(query, info.Name())
+			return matched
+		}
+	}
+
+	lower := strings.ToLower(query)
+	return func(name string, info os.FileInfo) bool {
+		if strings.Contains(strings.ToLower(info.Name()), lower) {
+			return true
+		}
+		return contents && maxSearchFileSize >= info.Size() &&
+			containsText(storage, name, []byte(lower))
+	}
+}
+
+// containsText returns true if the file has a text content type and contains
+// the lower-case substring (ignoring case), line by line.
+func containsText(storage Storage, name string, lower []byte) bool {
+	ctype, err := contentType(storage, name)
+	if nil != err || !isText(ctype) {
+		return false
+	}
+	file, err := storage.Open(name)
+	if nil != err {
+		return false
+	}
+	defer file.Close()
+
+	found := false
+	withBuffer(func(b []byte) {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(b, maxSearchFileSize)
+		for scanner.Scan() {
+			if bytes.Contains(bytes.ToLower(scanner.Bytes()), lower) {
+				found = true
+				return
+			}
+		}
+	})
+	return found
+}
+
+// isText returns true for content types containing human-readable text.
+func isText(ctype string) bool {
+	ctype = strings.TrimSpace(strings.Split(ctype, ";")[0])
+	if strings.HasPrefix(ctype, "text/") {
+		return true
+	}
+	switch ctype {
+	case "application/json", "application/xml", "application/javascript":
+		return true
+	}
+	return strings.HasSuffix(ctype, "+xml") || strings.HasSuffix(ctype, "+json")
+}
+
+// queryInt parses the query parameter as an integer clamped between min and
+// max, or returns fallback if not set or invalid.
+func queryInt(value string, fallback, min, max int) int {
+	result, err := strconv.Atoi(value)
+	if nil != err {
+		return fallback
+	}
+	if result < min {
+		return min
+	}
+	if result > max {
+		return max
+	}
+	return result
+}
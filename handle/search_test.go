@@ -0,0 +1,165 @@
+package handle
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestWithSearch(t *testing.T) {
+	served := "served"
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(served))
+	}
+
+	testCases := []struct {
+		name     string
+		query    url.Values
+		prefix   string
+		contents bool
+		paths    []string
+		total    int
+	}{
+		{"Glob", url.Values{"q": {"*.txt"}}, "", false,
+			[]string{"/file.txt", "/sub/deep/file.txt", "/sub/file.txt"}, 3},
+		{"Substring", url.Values{"q": {"INDEX"}}, "", false,
+			[]string{"/index.html", "/sub/deep/index.html", "/sub/index.html"}, 3},
+		{"Scoped", url.Values{"q": {"*.txt"}, "path": {"/sub/deep"}}, "", false,
+			[]string{"/sub/deep/file.txt"}, 1},
+		{"Scope traversal", url.Values{"q": {"*.txt"}, "path": {"../../.."}}, "", false,
+			[]string{"/file.txt", "/sub/deep/file.txt", "/sub/file.txt"}, 3},
+		{"With prefix", url.Values{"q": {"*.txt"}, "path": {"/sub/deep"}}, "/my/prefix", false,
+			[]string{"/my/prefix/sub/deep/file.txt"}, 1},
+		{"First page", url.Values{"q": {"*.txt"}, "limit": {"2"}}, "", false,
+			[]string{"/file.txt", "/sub/deep/file.txt"}, 3},
+		{"Second page", url.Values{"q": {"*.txt"}, "limit": {"2"}, "page": {"2"}}, "", false,
+			[]string{"/sub/file.txt"}, 3},
+		{"Past last page", url.Values{"q": {"*.txt"}, "page": {"9"}}, "", false,
+			[]string{}, 3},
+		{"Contents disallowed", url.Values{"q": {"starship"}, "contents": {"1"}}, "", false,
+			[]string{}, 0},
+		{"Contents not requested", url.Values{"q": {"starship"}}, "", true,
+			[]string{}, 0},
+		{"Contents", url.Values{"q": {"STARSHIP"}, "contents": {"1"}}, "", true,
+			[]string{"/file.txt"}, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := WithSearch(serve, "/__search", Dir(baseDir), tc.prefix, tc.contents)
+			fullpath := "http://localhost/__search?" + tc.query.Encode()
+			req := httptest.NewRequest("GET", fullpath, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if ok != w.Code {
+				t.Fatalf("For %s expected %d but got %d", fullpath, ok, w.Code)
+			}
+			var results SearchResults
+			if err := json.NewDecoder(w.Body).Decode(&results); nil != err {
+				t.Fatalf("While decoding results got %v", err)
+			}
+			paths := []string{}
+			for _, result := range results.Results {
+				paths = append(paths, result.Path)
+			}
+			if !reflect.DeepEqual(tc.paths, paths) {
+				t.Errorf("For %s expected %v but got %v", fullpath, tc.paths, paths)
+			}
+			if tc.total != results.Total {
+				t.Errorf("For %s expected total %d but got %d", fullpath, tc.total, results.Total)
+			}
+		})
+	}
+
+	handler := WithSearch(serve, "/__search", Dir(baseDir), "", false)
+	badRequests := []string{"/__search", "/__search?q=[", "/__search?q="}
+	for _, badRequest := range badRequests {
+		req := httptest.NewRequest("GET", "http://localhost"+badRequest, nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if http.StatusBadRequest != w.Code {
+			t.Errorf("For %s expected %d but got %d", badRequest, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "http://localhost/other", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if served != w.Body.String() {
+		t.Errorf("For other path expected '%s' but got '%s'", served, w.Body.String())
+	}
+}
+
+func TestWithSearchAccess(t *testing.T) {
+	realms := []AuthRealm{{
+		Prefix:      "/sub",
+		Scheme:      AuthBasic,
+		Credentials: map[string]string{"alice": "plain"},
+	}}
+	rules, err := ParsePolicyRules([]string{"deny * /sub/deep/**"})
+	if nil != err {
+		t.Fatalf("While parsing rules got %v", err)
+	}
+	handler := WithAuth(WithPolicy(
+		WithSearch(http.NotFound, "/__search", Dir(baseDir), "", true), rules,
+	), realms)
+
+	testCases := []struct {
+		name  string
+		query url.Values
+		user  string
+		paths []string
+	}{
+		{"Anonymous", url.Values{"q": {"*.txt"}}, "", []string{"/file.txt"}},
+		{"Authenticated", url.Values{"q": {"*.txt"}}, "alice",
+			[]string{"/file.txt", "/sub/file.txt"}},
+		{"Anonymous contents", url.Values{"q": {"worlds"}, "contents": {"1"}}, "", []string{}},
+		{"Authenticated contents", url.Values{"q": {"worlds"}, "contents": {"1"}}, "alice",
+			[]string{"/sub/file.txt"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/__search?"+tc.query.Encode(), nil)
+			if 0 < len(tc.user) {
+				req.SetBasicAuth(tc.user, "plain")
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			var results SearchResults
+			if err := json.NewDecoder(w.Body).Decode(&results); nil != err {
+				t.Fatalf("While decoding results got %v", err)
+			}
+			paths := []string{}
+			for _, result := range results.Results {
+				paths = append(paths, result.Path)
+			}
+			if !reflect.DeepEqual(tc.paths, paths) || len(tc.paths) != results.Total {
+				t.Errorf("Expected %v but got %v of %d", tc.paths, paths, results.Total)
+			}
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	testCases := []struct {
+		ctype  string
+		result bool
+	}{
+		{"text/plain; charset=utf-8", true},
+		{"application/json", true},
+		{"image/svg+xml", true},
+		{"application/octet-stream", false},
+		{"image/png", false},
+	}
+	for _, tc := range testCases {
+		if result := isText(tc.ctype); tc.result != result {
+			t.Errorf("For %s expected %t but got %t", tc.ctype, tc.result, result)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SearchIndex is a full-text index of the text files in a storage, such as
+// HTML, Markdown and plain text, so a documentation site is searched by its
+// words rather than file names. The index is built in the background and kept
+// current with Changed. Safe for concurrent use.
+type SearchIndex struct {
+	storage Storage
+
+	mutex     sync.RWMutex
+	documents map[string]indexedDocument
+	postings  map[string]map[string]int
+}
+
+// indexedDocument is a file in the SearchIndex.
+type indexedDocument struct {
+	title string
+	info  os.FileInfo
+	terms []string
+}
+
+// NewSearchIndex returns an empty index of the files in the storage.
+func NewSearchIndex(storage Storage) *SearchIndex {
+	return &SearchIndex{
+		storage:   storage,
+		documents: make(map[string]indexedDocument),
+		postings:  make(map[string]map[string]int),
+	}
+}
+
+// Build indexes every file in the storage, stopping early if the context is
+// done.
+func (index *SearchIndex) Build(ctx context.Context) error {
+	return walkStorage(index.storage, "/", func(name string, info os.FileInfo, err error) error {
+		if nil != ctx.Err() {
+			return ctx.Err()
+		}
+		if nil == err && !info.IsDir() {
+			index.update(name)
+		}
+		return nil
+	})
+}
+
+// Changed indexes the named files again, forgetting the ones that no longer
+// exist, such as the names passed by Watch.
+func (index *SearchIndex) Changed(names []string) {
+	for _, name := range names {
+		index.update(name)
+	}
+}
+
+// Len returns the number of files in the index.
+func (index *SearchIndex) Len() int {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return len(index.documents)
+}
+
+// Search returns the files within the folder containing every word of the
+// query, best matches first. Files are scored by how often they contain each
+// word, weighted by how rare the word is across all files.
+func (index *SearchIndex) Search(query, folder string) []SearchResult {
+	words := searchTerms(query)
+	if 0 == len(words) {
+		return nil
+	}
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	// Only files containing every word so far remain scored.
+	var scores map[string]float64
+	for i, word := range words {
+		postings := index.postings[word]
+		weight := math.Log(1 + float64(len(index.documents))/float64(1+len(postings)))
+		next := make(map[string]float64)
+		for name, count := range postings {
+			score, ok := scores[name]
+			if (0 < i && !ok) || !withinFolder(name, folder) {
+				continue
+			}
+			next[name] = score + (1+math.Log(float64(count)))*weight
+		}
+		scores = next
+	}
+
+	results := make([]SearchResult, 0, len(scores))
+	for name, score := range scores {
+		document := index.documents[name]
+		results = append(results, SearchResult{
+			Path:     name,
+			Size:     document.info.Size(),
+			Modified: document.info.ModTime().UTC(),
+			Title:    document.title,
+			Score:    math.Round(score*1000) / 1000,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	return results
+}
+
+// update the named file in the index, removing it if it is no longer a text
+// file in the storage.
+func (index *SearchIndex) update(name string) {
+	var title string
+	var counts map[string]int
+	info, err := index.storage.Stat(name)
+	if nil == err && !info.IsDir() && maxSearchFileSize >= info.Size() {
+		title, counts = readDocument(index.storage, name)
+	}
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if previous, ok := index.documents[name]; ok {
+		for _, term := range previous.terms {
+			delete(index.postings[term], name)
+			if 0 == len(index.postings[term]) {
+				delete(index.postings, term)
+			}
+		}
+		delete(index.documents, name)
+	}
+	if nil == counts {
+		return
+	}
+	document := indexedDocument{title: title, info: info}
+	for term, count := range counts {
+		if nil == index.postings[term] {
+			index.postings[term] = make(map[string]int)
+		}
+		index.postings[term][name] = count
+		document.terms = append(document.terms, term)
+	}
+	index.documents[name] = document
+}
+
+// readDocument returns the title and the number of times each word occurs in
+// the named text file, or nil counts if it is not a text file.
+func readDocument(storage Storage, name string) (string, map[string]int) {
+	ctype, err := contentType(storage, name)
+	if nil != err || !isText(ctype) {
+		return "", nil
+	}
+	file, err := storage.Open(name)
+	if nil != err {
+		return "", nil
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(io.LimitReader(file, maxSearchFileSize))
+	if nil != err {
+		return "", nil
+	}
+
+	var title, text string
+	switch {
+	case strings.HasPrefix(ctype, "text/html"):
+		title, text = htmlText(contents)
+	case ".md" == strings.ToLower(path.Ext(name)):
+		text = string(contents)
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasPrefix(line, "# ") {
+				title = strings.TrimSpace(line[2:])
+				break
+			}
+		}
+	default:
+		text = string(contents)
+	}
+	counts := make(map[string]int)
+	for _, term := range searchTerms(text) {
+		counts[term]++
+	}
+	return title, counts
+}
+
+// htmlText returns the title and the text of the HTML document, without tags,
+// comments, scripts and styles.
+func htmlText(contents []byte) (string, string) {
+	var title string
+	var text strings.Builder
+	// Only ASCII is lowered, so offsets in both match.
+	lower := make([]byte, len(contents))
+	for i, c := range contents {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	for i := 0; i < len(contents); {
+		start := bytes.IndexByte(contents[i:], '<')
+		if 0 > start {
+			text.Write(contents[i:])
+			break
+		}
+		text.Write(contents[i : i+start])
+		text.WriteByte(' ')
+		i += start
+
+		// Skip comments and the contents of elements that are not text.
+		closing := ">"
+		switch {
+		case bytes.HasPrefix(lower[i:], []byte("<!--")):
+			closing = "-->"
+		case bytes.HasPrefix(lower[i:], []byte("<script")):
+			closing = "</script>"
+		case bytes.HasPrefix(lower[i:], []byte("<style")):
+			closing = "</style>"
+		case bytes.HasPrefix(lower[i:], []byte("<title")) && 0 == len(title):
+			if open := bytes.IndexByte(lower[i:], '>'); 0 <= open {
+				if end := bytes.Index(lower[i+open:], []byte("</title>")); 0 <= end {
+					title = html.UnescapeString(strings.TrimSpace(
+						string(contents[i+open+1 : i+open+end]),
+					))
+				}
+			}
+		}
+		end := bytes.Index(lower[i:], []byte(closing))
+		if 0 > end {
+			break
+		}
+		i += end + len(closing)
+	}
+	return title, html.UnescapeString(text.String())
+}
+
+// searchTerms returns the lower-case words of the text, ignoring single
+// characters.
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, word := range words {
+		if 1 < len([]rune(word)) {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// withinFolder returns true if the name is the folder or within it.
+func withinFolder(name, folder string) bool {
+	return "/" == folder || name == folder || strings.HasPrefix(name, folder+"/")
+}
+
+// WithSearchIndex wraps an HTTP request. Requests for searchPath are answered
+// with SearchResults as JSON for the files of the index containing every word
+// of the query, best matches first, with their titles and scores. The 'q',
+// 'path', 'page' and 'limit' query parameters are accepted as by WithSearch.
+// Result paths include urlPrefix. As with WithSearch, files the client could not
+// read past the auth realms and policy rules the request passed through are
+// left out. All other requests are passed through.
+func WithSearchIndex(
+	serve http.HandlerFunc,
+	searchPath string,
+	index *SearchIndex,
+	urlPrefix string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if searchPath != r.URL.Path {
+			serve(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		results := SearchResults{
+			Query:   query.Get("q"),
+			Path:    path.Clean("/" + query.Get("path")),
+			Page:    queryInt(query.Get("page"), 1, 1, int(^uint(0)>>1)),
+			Limit:   queryInt(query.Get("limit"), defaultSearchLimit, 1, maxSearchLimit),
+			Results: []SearchResult{},
+		}
+		if 0 == len(searchTerms(results.Query)) {
+			http.Error(w, "400 missing query", http.StatusBadRequest)
+			return
+		}
+
+		matches := index.Search(results.Query, results.Path)
+		allowed := matches[:0]
+		for _, match := range matches {
+			if match.Path = urlPrefix + match.Path; Allowed(r, match.Path) {
+				allowed = append(allowed, match)
+			}
+		}
+		results.Total = len(allowed)
+		first := (results.Page - 1) * results.Limit
+		for i := first; 0 <= i && i < len(allowed) && i < first+results.Limit; i++ {
+			results.Results = append(results.Results, allowed[i])
+		}
+		Tracef(r, "searched %d indexed files", index.Len())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	}
+}
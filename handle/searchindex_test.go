@@ -0,0 +1,210 @@
+package handle
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearchIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "searchindex")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"index.html": `<html><head><title>Getting &amp; Started</title>
+			<style>.install { color: red }</style>
+			<script>var install = "hidden";</script></head>
+			<body><!-- install notes --><h1>Install</h1><p>Install the server, then
+			configure it.</p></body></html>`,
+		"guide/configure.md": "# Configuration\n\nConfigure the server with a file.\n",
+		"guide/notes.txt":    "Plain notes about the server and Überblick.",
+		"image.png":          "\x89PNG\r\n\x1a\nserver install",
+	}
+	for name, contents := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		ioutil.WriteFile(filename, []byte(contents), 0644)
+	}
+
+	index := NewSearchIndex(Dir(dir))
+	if err := index.Build(context.Background()); nil != err {
+		t.Fatalf("While building the index got %v", err)
+	}
+	if 3 != index.Len() {
+		t.Errorf("Expected 3 indexed files but got %d", index.Len())
+	}
+
+	paths := func(results []SearchResult) (names []string) {
+		for _, result := range results {
+			names = append(names, result.Path)
+		}
+		return
+	}
+	testCases := []struct {
+		name     string
+		query    string
+		folder   string
+		expected []string
+	}{
+		{"Common word", "server", "/", []string{"/guide/configure.md", "/guide/notes.txt", "/index.html"}},
+		{"Every word", "configure SERVER", "/", []string{"/guide/configure.md", "/index.html"}},
+		{"Frequent first", "install", "/", []string{"/index.html"}},
+		{"Title", "started", "/", []string{"/index.html"}},
+		{"Unicode", "überblick", "/", []string{"/guide/notes.txt"}},
+		{"Scoped", "server", "/guide", []string{"/guide/configure.md", "/guide/notes.txt"}},
+		{"Scripts, styles and comments", "hidden notes red", "/", nil},
+		{"Missing word", "server missing", "/", nil},
+		{"No words", "a !", "/", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := paths(index.Search(tc.query, tc.folder)); !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("Expected %v but got %v", tc.expected, actual)
+			}
+		})
+	}
+	results := index.Search("install", "/")
+	if "Getting & Started" != results[0].Title || 0 >= results[0].Score {
+		t.Errorf("Expected the title and a score but got %+v", results[0])
+	}
+	if results = index.Search("configure", "/"); "Configuration" != results[0].Title {
+		t.Errorf("Expected the Markdown heading as title but got %+v", results[0])
+	}
+
+	// Changed files are indexed again and removed files forgotten.
+	ioutil.WriteFile(filepath.Join(dir, "guide", "notes.txt"), []byte("Release notes"), 0644)
+	os.Remove(filepath.Join(dir, "guide", "configure.md"))
+	index.Changed([]string{"/guide/configure.md", "/guide/notes.txt"})
+	if actual := paths(index.Search("server", "/")); !reflect.DeepEqual([]string{"/index.html"}, actual) {
+		t.Errorf("After changes expected only /index.html but got %v", actual)
+	}
+	if actual := paths(index.Search("release", "/")); !reflect.DeepEqual([]string{"/guide/notes.txt"}, actual) {
+		t.Errorf("After changes expected /guide/notes.txt but got %v", actual)
+	}
+
+	// Canceled builds stop early.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewSearchIndex(Dir(dir)).Build(ctx); nil == err {
+		t.Error("With canceled context expected an error but got nil")
+	}
+}
+
+func TestWithSearchIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "searchindex")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("docs "+name), 0644)
+	}
+	index := NewSearchIndex(Dir(dir))
+	index.Build(context.Background())
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}
+	handler := WithSearchIndex(serve, "/__search", index, "/prefix")
+
+	testCases := []struct {
+		name   string
+		target string
+		code   int
+		total  int
+		paths  []string
+	}{
+		{"First page", "/__search?q=docs&limit=2", ok, 3, []string{"/prefix/a.txt", "/prefix/b.txt"}},
+		{"Second page", "/__search?q=docs&limit=2&page=2", ok, 3, []string{"/prefix/c.txt"}},
+		{"Past last page", "/__search?q=docs&page=9", ok, 3, nil},
+		{"Missing query", "/__search", http.StatusBadRequest, 0, nil},
+		{"Other path", "/a.txt", ok, 0, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", "http://localhost"+tc.target, nil))
+			if tc.code != w.Code {
+				t.Fatalf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if "/a.txt" == tc.target {
+				if "served" != w.Body.String() {
+					t.Errorf("Expected request to be passed through but got '%s'", w.Body)
+				}
+				return
+			}
+			if ok != w.Code {
+				return
+			}
+			var results SearchResults
+			if err := json.NewDecoder(w.Body).Decode(&results); nil != err {
+				t.Fatalf("While decoding got %v", err)
+			}
+			var actual []string
+			for _, result := range results.Results {
+				actual = append(actual, result.Path)
+			}
+			if tc.total != results.Total || !reflect.DeepEqual(tc.paths, actual) {
+				t.Errorf("Expected %d total and %v but got %d and %v", tc.total, tc.paths, results.Total, actual)
+			}
+		})
+	}
+}
+
+func TestWithSearchIndexAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "searchindex")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "private"), 0755)
+	for _, name := range []string{"a.txt", "private/b.txt"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("docs "+name), 0644)
+	}
+	index := NewSearchIndex(Dir(dir))
+	index.Build(context.Background())
+	realms := []AuthRealm{{
+		Prefix:      "/private",
+		Scheme:      AuthBasic,
+		Credentials: map[string]string{"alice": "plain"},
+	}}
+	handler := WithAuth(WithSearchIndex(http.NotFound, "/__search", index, ""), realms)
+
+	testCases := []struct {
+		name  string
+		user  string
+		paths []string
+	}{
+		{"Anonymous", "", []string{"/a.txt"}},
+		{"Authenticated", "alice", []string{"/a.txt", "/private/b.txt"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/__search?q=docs", nil)
+			if 0 < len(tc.user) {
+				req.SetBasicAuth(tc.user, "plain")
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+
+			var results SearchResults
+			if err := json.NewDecoder(w.Body).Decode(&results); nil != err {
+				t.Fatalf("While decoding got %v", err)
+			}
+			var actual []string
+			for _, result := range results.Results {
+				actual = append(actual, result.Path)
+			}
+			if len(tc.paths) != results.Total || !reflect.DeepEqual(tc.paths, actual) {
+				t.Errorf("Expected %v but got %v of %d", tc.paths, actual, results.Total)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package handle
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := SelfSignedCertificate([]string{"www.example.test", "127.0.0.1", "::1"})
+	if nil != err {
+		t.Fatalf("While generating got %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+
+	testCases := []struct {
+		host    string
+		isError bool
+	}{
+		{"www.example.test", false},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"example.test", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			_, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: tc.host, Roots: roots})
+			if tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
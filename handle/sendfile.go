@@ -0,0 +1,25 @@
+package handle
+
+import (
+	"io"
+	"net/http"
+)
+
+// readFrom copies the reader to the response writer with the io.ReaderFrom of
+// the writer when it has one, such as the connection of the HTTP server, which
+// sends files with the sendfile or splice system calls rather than copying
+// them through user space. Response writer wrappers implement io.ReaderFrom
+// with readFrom so that files keep the kernel path through every stage.
+func readFrom(w http.ResponseWriter, src io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return copyBuffer(writerOnly{w}, src)
+}
+
+// writerOnly hides any io.ReaderFrom of the writer from io.CopyBuffer, so
+// copying to a wrapper from its own ReadFrom calls its Write rather than
+// recursing.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,66 @@
+package handle
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// readFromRecorder records responses like httptest.ResponseRecorder while
+// counting the bytes copied with ReadFrom, standing in for a connection that
+// sends files with sendfile.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom int64
+}
+
+// ReadFrom counts the bytes copied from the reader.
+func (w *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseRecorder, src)
+	w.readFrom += n
+	return n, err
+}
+
+func TestReadFromPassThrough(t *testing.T) {
+	serve := Basic(FileServer(Dir(baseDir)), "")
+	stats := NewTransferStats()
+
+	testCases := []struct {
+		name     string
+		handler  http.HandlerFunc
+		readFrom bool
+	}{
+		{"File server", serve, true},
+		{"Server header", WithServerHeader(serve, "sfs"), true},
+		{"Metrics", WithMetrics(serve, &testRegistry{values: map[string]float64{}}), true},
+		{"Hooks", WithHooks(serve, Hooks{}), true},
+		{"Transfer stats", WithTransferStats(serve, stats), true},
+		{"Problems", WithProblems(serve), true},
+		{"Cache too small", WithCache(serve, CacheConfig{MaxSize: 1024, MaxEntrySize: 4}), true},
+		{"Cached", WithCache(serve, CacheConfig{MaxSize: 1024, MaxEntrySize: 1024}), false},
+		{"Stacked", WithServerHeader(WithTransferStats(WithProblems(serve), stats), "sfs"), true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/"+tmpFileName, nil)
+			w := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+			tc.handler(w, req)
+
+			if tmpFile != w.Body.String() {
+				t.Errorf("Expected body '%s' but got '%s'", tmpFile, w.Body.String())
+			}
+			expected := int64(0)
+			if tc.readFrom {
+				expected = int64(len(tmpFile))
+			}
+			if expected != w.readFrom {
+				t.Errorf("Expected %d bytes copied with ReadFrom but got %d", expected, w.readFrom)
+			}
+		})
+	}
+	if snapshot := stats.Snapshot(); 0 != snapshot.BytesInFlight {
+		t.Errorf("Expected no bytes in flight but got %d", snapshot.BytesInFlight)
+	}
+}
@@ -0,0 +1,181 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SitemapOptions control which files are listed in a generated sitemap.
+type SitemapOptions struct {
+	// BaseURL such as 'https://my.machine' used for each location. If empty,
+	// the scheme and host of the request are used, so sitemaps generated
+	// without it must not be shared by caches.
+	BaseURL string
+
+	// URLPrefix added to the path of each location.
+	URLPrefix string
+
+	// Include and Exclude glob patterns matched against both the name and the
+	// slash-separated path (relative to the folder) of each file.
+	Include []string
+	Exclude []string
+
+	// Interval after which the folder is walked again. If zero, the folder is
+	// only walked again once files change.
+	Interval time.Duration
+}
+
+// sitemapEntry for a single location in the sitemap, identified by its
+// unescaped URL path without the URL prefix.
+type sitemapEntry struct {
+	path    string
+	lastMod time.Time
+}
+
+// Sitemap generates a 'sitemap.xml' in the format described at
+// https://www.sitemaps.org by walking the storage for matching files. The
+// folder is walked again after the interval of the options or, when passed
+// to Watch, once files change. Safe for concurrent use.
+type Sitemap struct {
+	storage Storage
+	options SitemapOptions
+
+	mutex   sync.Mutex
+	walked  time.Time
+	entries []sitemapEntry
+}
+
+// NewSitemap returns the sitemap of the matching files in the storage.
+func NewSitemap(storage Storage, options SitemapOptions) *Sitemap {
+	return &Sitemap{storage: storage, options: options}
+}
+
+// Changed is a WatchFunc walking the folder again for the next sitemap.
+func (sitemap *Sitemap) Changed([]string) {
+	sitemap.mutex.Lock()
+	sitemap.walked = time.Time{}
+	sitemap.mutex.Unlock()
+}
+
+// Generate is a GeneratorFunc producing the sitemap for the request. Files
+// the client could not read past the auth realms and policy rules the
+// request passed through are left out.
+func (sitemap *Sitemap) Generate(r *http.Request) ([]byte, error) {
+	options := sitemap.options
+	sitemap.mutex.Lock()
+	if sitemap.walked.IsZero() ||
+		(0 < options.Interval && options.Interval <= time.Since(sitemap.walked)) {
+		updated, err := walkSitemap(sitemap.storage, options)
+		if nil != err {
+			sitemap.mutex.Unlock()
+			return nil, err
+		}
+		sitemap.entries = updated
+		sitemap.walked = time.Now()
+	}
+	current := sitemap.entries
+	sitemap.mutex.Unlock()
+
+	allowed := make([]sitemapEntry, 0, len(current))
+	for _, entry := range current {
+		if Allowed(r, options.URLPrefix+entry.path) {
+			allowed = append(allowed, entry)
+		}
+	}
+
+	baseURL := strings.TrimSuffix(options.BaseURL, "/")
+	if 0 == len(baseURL) {
+		scheme := "http"
+		if nil != r.TLS {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + r.Host
+	}
+	return renderSitemap(baseURL+options.URLPrefix, allowed)
+}
+
+// walkSitemap returns an entry for each matching file in the storage.
+func walkSitemap(
+	storage Storage, options SitemapOptions,
+) (entries []sitemapEntry, err error) {
+	err = walkStorage(storage, "/", func(name string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relative := strings.TrimPrefix(name, "/")
+		if !matchesAny(options.Include, relative) ||
+			matchesAny(options.Exclude, relative) {
+			return nil
+		}
+
+		// Index files are located by their folder.
+		urlPath := "/" + relative
+		if "index.html" == path.Base(relative) {
+			urlPath = strings.TrimSuffix(urlPath, "index.html")
+		}
+		entries = append(entries, sitemapEntry{urlPath, info.ModTime()})
+		return nil
+	})
+	return
+}
+
+// matchesAny returns true if any pattern matches either the name or the full
+// relative path.
+func matchesAny(patterns []string, relative string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, path.Base(relative)); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, relative); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// renderSitemap produces the XML document for the entries.
+func renderSitemap(baseURL string, entries []sitemapEntry) ([]byte, error) {
+	type location struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	}
+	document := struct {
+		XMLName   xml.Name   `xml:"urlset"`
+		Namespace string     `xml:"xmlns,attr"`
+		URLs      []location `xml:"url"`
+	}{
+		Namespace: "http://www.sitemaps.org/schemas/sitemap/0.9",
+	}
+	for _, entry := range entries {
+		// Each segment is escaped, so names with spaces, '&' or non-ASCII
+		// characters are valid URLs.
+		segments := strings.Split(entry.path, "/")
+		for index, segment := range segments {
+			segments[index] = url.PathEscape(segment)
+		}
+		document.URLs = append(document.URLs, location{
+			Loc:     baseURL + strings.Join(segments, "/"),
+			LastMod: entry.lastMod.UTC().Format(time.RFC3339),
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); nil != err {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,171 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitemap(t *testing.T) {
+	testCases := []struct {
+		name     string
+		options  SitemapOptions
+		contains []string
+		excludes []string
+	}{
+		{
+			"All HTML from request host",
+			SitemapOptions{Include: []string{"*.html"}},
+			[]string{
+				"<loc>http://my.machine/</loc>",
+				"<loc>http://my.machine/sub/</loc>",
+				"<loc>http://my.machine/sub/deep/</loc>",
+			},
+			[]string{"file.txt"},
+		},
+		{
+			"Base URL and prefix",
+			SitemapOptions{
+				BaseURL:   "https://example.com/",
+				URLPrefix: "/my/prefix",
+				Include:   []string{"*.txt"},
+			},
+			[]string{
+				"<loc>https://example.com/my/prefix/file.txt</loc>",
+				"<loc>https://example.com/my/prefix/sub/deep/file.txt</loc>",
+			},
+			[]string{"index.html"},
+		},
+		{
+			"Excluded folder",
+			SitemapOptions{
+				Include: []string{"*.html"},
+				Exclude: []string{"sub/deep/*"},
+			},
+			[]string{"<loc>http://my.machine/sub/</loc>"},
+			[]string{"deep"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			generate := NewSitemap(Dir(baseDir), tc.options).Generate
+			req := httptest.NewRequest("GET", "http://my.machine/sitemap.xml", nil)
+			result, err := generate(req)
+			if nil != err {
+				t.Fatalf("While generating sitemap got %v", err)
+			}
+			contents := string(result)
+			for _, expected := range tc.contains {
+				if !strings.Contains(contents, expected) {
+					t.Errorf("Expected '%s' in sitemap:\n%s", expected, contents)
+				}
+			}
+			for _, unexpected := range tc.excludes {
+				if strings.Contains(contents, unexpected) {
+					t.Errorf("Unexpected '%s' in sitemap:\n%s", unexpected, contents)
+				}
+			}
+		})
+	}
+}
+
+func TestSitemapInterval(t *testing.T) {
+	folder := baseDir + "sitemap/"
+	if err := os.MkdirAll(folder, 0700); nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+
+	req := httptest.NewRequest("GET", "http://my.machine/sitemap.xml", nil)
+	cached := NewSitemap(Dir(folder), SitemapOptions{
+		Include:  []string{"*.html"},
+		Interval: time.Hour,
+	}).Generate
+	refreshed := NewSitemap(Dir(folder), SitemapOptions{
+		Include:  []string{"*.html"},
+		Interval: time.Nanosecond,
+	}).Generate
+	watched := NewSitemap(Dir(folder), SitemapOptions{Include: []string{"*.html"}})
+	for _, generate := range []GeneratorFunc{cached, refreshed, watched.Generate} {
+		if _, err := generate(req); nil != err {
+			t.Fatalf("While generating sitemap got %v", err)
+		}
+	}
+
+	if err := ioutil.WriteFile(folder+"new.html", nil, 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	expected := "<loc>http://my.machine/new.html</loc>"
+	if result, _ := cached(req); strings.Contains(string(result), expected) {
+		t.Errorf("Expected cached sitemap without new file but got:\n%s", result)
+	}
+	if result, _ := refreshed(req); !strings.Contains(string(result), expected) {
+		t.Errorf("Expected refreshed sitemap with new file but got:\n%s", result)
+	}
+	if result, _ := watched.Generate(req); strings.Contains(string(result), expected) {
+		t.Errorf("Expected watched sitemap without new file but got:\n%s", result)
+	}
+	watched.Changed([]string{"/new.html"})
+	if result, _ := watched.Generate(req); !strings.Contains(string(result), expected) {
+		t.Errorf("Expected changed sitemap with new file but got:\n%s", result)
+	}
+
+	// Names are escaped within locations.
+	if err := ioutil.WriteFile(folder+"a b&ü.html", nil, 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+	expected = "<loc>http://my.machine/a%20b&amp;%C3%BC.html</loc>"
+	if result, _ := refreshed(req); !strings.Contains(string(result), expected) {
+		t.Errorf("Expected escaped location '%s' but got:\n%s", expected, result)
+	}
+
+	missing := NewSitemap(Dir(baseDir+"should/never/exist"), SitemapOptions{}).Generate
+	if _, err := missing(req); nil == err {
+		t.Error("For missing folder expected an error but got nil")
+	}
+}
+
+func TestSitemapAccess(t *testing.T) {
+	realms := []AuthRealm{{
+		Prefix:      "/sub",
+		Scheme:      AuthBasic,
+		Credentials: map[string]string{"alice": "plain"},
+	}}
+	sitemap := NewSitemap(Dir(baseDir), SitemapOptions{
+		BaseURL: "https://example.com",
+		Include: []string{"*.html"},
+	})
+	var result []byte
+	handler := WithAuth(func(w http.ResponseWriter, r *http.Request) {
+		result, _ = sitemap.Generate(r)
+	}, realms)
+
+	testCases := []struct {
+		name   string
+		user   string
+		within bool
+	}{
+		{"Anonymous", "", false},
+		{"Authenticated", "alice", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/sitemap.xml", nil)
+			if 0 < len(tc.user) {
+				req.SetBasicAuth(tc.user, "plain")
+			}
+			handler(httptest.NewRecorder(), req)
+			if !strings.Contains(string(result), "<loc>https://example.com/</loc>") {
+				t.Errorf("Expected the public index in sitemap:\n%s", result)
+			}
+			if within := strings.Contains(string(result), "/sub/"); tc.within != within {
+				t.Errorf("Expected realm files listed %t in sitemap:\n%s", tc.within, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package handle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// htmlReplacer escapes names in directory listings.
+	htmlReplacer = strings.NewReplacer(
+		"&", "&amp;",
+		"<", "&lt;",
+		">", "&gt;",
+		`"`, "&#34;",
+		"'", "&#39;",
+	)
+)
+
+// Storage provides the files served by the handlers. Names are slash-separated
+// paths from the root of the storage (e.g. '/sub/file.txt'). Errors for
+// missing files should match os.ErrNotExist and errors for inaccessible files
+// should match os.ErrPermission.
+//
+// FileServer only reads the bytes it sends. Conditional requests are answered
+// from Stat of the open file, and a range is read by seeking to its start and
+// reading its length, with the size found by seeking to the end. Backends for
+// remote object stores can keep requests cheap by fetching only metadata when
+// a file is opened and fetching a range, such as with a ranged GET, when it is
+// read after a seek. The first 512 bytes are also read to detect the content
+// type of files with unknown extensions.
+type Storage interface {
+	// Open the named file or folder for reading.
+	Open(name string) (http.File, error)
+
+	// Stat returns information describing the named file or folder.
+	Stat(name string) (os.FileInfo, error)
+
+	// ReadDir returns information describing the contents of the named
+	// folder, sorted by name.
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+// Dir is the Storage of a folder on the local file system.
+type Dir string
+
+// Open the named file or folder for reading.
+func (dir Dir) Open(name string) (http.File, error) {
+	return os.Open(dir.resolve(name))
+}
+
+// Stat returns information describing the named file or folder.
+func (dir Dir) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(dir.resolve(name))
+}
+
+// ReadDir returns information describing the contents of the named folder,
+// sorted by name.
+func (dir Dir) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(dir.resolve(name))
+}
+
+// resolve the name to a filename within the folder. Names cannot escape the
+// folder.
+func (dir Dir) resolve(name string) string {
+	folder := string(dir)
+	if 0 == len(folder) {
+		folder = "."
+	}
+	return filepath.Join(folder, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// FileServer returns a function serving files from the storage in the same way
+// as http.ServeFile, where the names passed are paths within the storage.
+// Folders are served by their 'index.html' or, if missing, a listing of their
+// contents.
+func FileServer(storage Storage) FileServerFunc {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		if containsDotDot(r.URL.Path) {
+			http.Error(w, "invalid URL path", http.StatusBadRequest)
+			return
+		}
+
+		// Index files are served by their folder.
+		if strings.HasSuffix(r.URL.Path, "/index.html") {
+			Tracef(r, "redirected to the folder of the index file")
+			localRedirect(w, r, "./")
+			return
+		}
+
+		file, err := storage.Open(name)
+		if nil != err {
+			Tracef(r, "failed to open '%s': %v", name, err)
+			storageError(w, err)
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if nil != err {
+			Tracef(r, "failed to stat '%s': %v", name, err)
+			storageError(w, err)
+			return
+		}
+
+		if info.IsDir() {
+			// Folders are only served with a trailing slash.
+			urlPath := r.URL.Path
+			if 0 == len(urlPath) || !strings.HasSuffix(urlPath, "/") {
+				Tracef(r, "redirected to folder '%s/'", path.Base(urlPath))
+				localRedirect(w, r, path.Base(urlPath)+"/")
+				return
+			}
+
+			// Use the index file of the folder, if present.
+			index := strings.TrimSuffix(name, "/") + "/index.html"
+			if indexFile, err := storage.Open(index); nil == err {
+				defer indexFile.Close()
+				if indexInfo, err := indexFile.Stat(); nil == err {
+					file, info, name = indexFile, indexInfo, index
+				}
+			}
+		}
+
+		// Still a folder as there is no index file.
+		if info.IsDir() {
+			if notModified(r, info.ModTime()) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set(
+				"Last-Modified", info.ModTime().UTC().Format(http.TimeFormat),
+			)
+			Tracef(r, "listing folder '%s'", name)
+			dirList(w, r, file)
+			return
+		}
+		if traced(r) {
+			Tracef(r, "serving file '%s'", name)
+		}
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+	}
+}
+
+// notModified returns true if the request is conditional on the content being
+// modified since a time that is not before the modification time.
+func notModified(r *http.Request, modTime time.Time) bool {
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if nil != err || modTime.IsZero() {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// listingBatch is the number of entries of a folder read at a time when
+// listing it.
+const listingBatch = 1024
+
+// dirList writes an HTML listing of the open folder. Entries are read and
+// written a batch at a time, flushing each, so listing folders with very many
+// entries uses little memory. Folders of a single batch are sorted by name and
+// larger ones are listed in the order they are stored, each batch sorted by
+// name. The 'offset' and 'limit' query parameters list a page of the entries,
+// ending with a link to the next page if there are more.
+func dirList(w http.ResponseWriter, r *http.Request, folder http.File) {
+	offset, limit, err := listingPage(r.URL.Query())
+	if nil != err {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	infos, done, err := readBatch(folder)
+	if nil != err {
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	flusher, _ := w.(http.Flusher)
+	skip, listed, more := offset, 0, false
+	for {
+		sort.Slice(infos, func(i, j int) bool {
+			return infos[i].Name() < infos[j].Name()
+		})
+		for _, info := range infos {
+			if 0 < skip {
+				skip--
+				continue
+			}
+			if 0 < limit && listed == limit {
+				more = true
+				break
+			}
+			listed++
+			name := info.Name()
+			if info.IsDir() {
+				name += "/"
+			}
+			link := url.URL{Path: name}
+			fmt.Fprintf(
+				w, "<a href=\"%s\">%s</a>\n", link.String(), htmlReplacer.Replace(name),
+			)
+		}
+		if done || more {
+			break
+		}
+		if nil != flusher {
+			flusher.Flush()
+		}
+		if infos, done, err = readBatch(folder); nil != err {
+			break
+		}
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	if more {
+		next := url.Values{}
+		next.Set("offset", strconv.Itoa(offset+limit))
+		next.Set("limit", strconv.Itoa(limit))
+		fmt.Fprintf(
+			w, "<a href=\"?%s\" rel=\"next\">next</a>\n",
+			htmlReplacer.Replace(next.Encode()),
+		)
+	}
+}
+
+// listingPage returns the offset and limit of the page of a folder listing
+// requested by the query, where a limit of 0 lists every entry.
+func listingPage(query url.Values) (offset, limit int, err error) {
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{
+		{"offset", &offset},
+		{"limit", &limit},
+	} {
+		value := query.Get(param.name)
+		if 0 == len(value) {
+			continue
+		}
+		if *param.value, err = strconv.Atoi(value); nil != err || 0 > *param.value {
+			return 0, 0, fmt.Errorf("invalid listing %s '%s'", param.name, value)
+		}
+	}
+	return
+}
+
+// readBatch reads up to listingBatch entries of the open folder, returning
+// true if there are no more.
+func readBatch(folder http.File) ([]os.FileInfo, bool, error) {
+	infos, err := folder.Readdir(listingBatch)
+	if io.EOF == err {
+		return infos, true, nil
+	}
+	return infos, len(infos) < listingBatch, err
+}
+
+// storageError writes the response for an error opening a file.
+func storageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// localRedirect gives a 'MOVED PERMANENTLY' response relative to the request
+// path, preserving the query.
+func localRedirect(w http.ResponseWriter, r *http.Request, location string) {
+	if query := r.URL.RawQuery; 0 < len(query) {
+		location += "?" + query
+	}
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// containsDotDot returns true if any element of the slash-separated path
+// is '..'.
+func containsDotDot(urlPath string) bool {
+	if !strings.Contains(urlPath, "..") {
+		return false
+	}
+	for _, element := range strings.FieldsFunc(urlPath, func(r rune) bool {
+		return '/' == r || '\\' == r
+	}) {
+		if ".." == element {
+			return true
+		}
+	}
+	return false
+}
+
+// walkStorage calls fn for the folder or file at root and, for folders, every
+// file and folder inside it in lexical order. Returning filepath.SkipDir from
+// fn for a folder skips its contents. Errors reading folders are passed to fn
+// in the same way as filepath.Walk.
+func walkStorage(
+	storage Storage,
+	root string,
+	fn func(name string, info os.FileInfo, err error) error,
+) error {
+	info, err := storage.Stat(root)
+	if nil != err {
+		return fn(root, nil, err)
+	}
+	err = walkStorageEntry(storage, root, info, fn)
+	if filepath.SkipDir == err {
+		return nil
+	}
+	return err
+}
+
+// walkStorageEntry walks a single file or folder for walkStorage.
+func walkStorageEntry(
+	storage Storage,
+	name string,
+	info os.FileInfo,
+	fn func(name string, info os.FileInfo, err error) error,
+) error {
+	if !info.IsDir() {
+		return fn(name, info, nil)
+	}
+
+	infos, err := storage.ReadDir(name)
+	if err = fn(name, info, err); nil != err || nil == infos {
+		return err
+	}
+	for _, child := range infos {
+		err = walkStorageEntry(storage, path.Join(name, child.Name()), child, fn)
+		if nil != err {
+			if !child.IsDir() || filepath.SkipDir != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFileServer(t *testing.T) {
+	paths := []string{
+		"/",
+		"/" + tmpIndexName,
+		"/" + tmpFileName,
+		"/" + tmpBadName,
+		"/" + tmpFileName + "/",
+		"/sub",
+		"/" + subDir,
+		"/" + tmpSubFileName,
+		"/" + tmpSubBadName,
+		"/" + subDeepDir,
+		"/" + tmpSubDeepFileName,
+		"/sub/../" + tmpFileName,
+	}
+
+	// The storage file server behaves the same as serving from disk.
+	expected := Basic(http.ServeFile, baseDir)
+	handler := Basic(FileServer(Dir(baseDir)), "")
+	for _, urlPath := range paths {
+		t.Run(urlPath, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+urlPath, nil)
+			want := httptest.NewRecorder()
+			got := httptest.NewRecorder()
+
+			expected(want, req)
+			handler(got, req)
+
+			if want.Code != got.Code {
+				t.Errorf("Expected status code %d but got %d", want.Code, got.Code)
+			}
+			if want.Body.String() != got.Body.String() {
+				t.Errorf(
+					"Expected body '%s' but got '%s'",
+					want.Body.String(), got.Body.String(),
+				)
+			}
+			if location := want.Header().Get("Location"); location != got.Header().Get("Location") {
+				t.Errorf(
+					"Expected location '%s' but got '%s'",
+					location, got.Header().Get("Location"),
+				)
+			}
+		})
+	}
+}
+
+func TestFileServerListing(t *testing.T) {
+	folder := baseDir + "listing/"
+	if err := os.MkdirAll(folder+"b&c", 0700); nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	if err := ioutil.WriteFile(folder+"a.txt", nil, 0600); nil != err {
+		t.Fatalf("While writing file got %v", err)
+	}
+
+	handler := Basic(FileServer(Dir(baseDir)), "")
+	req := httptest.NewRequest("GET", "http://localhost/listing/", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	expected := "<pre>\n" +
+		"<a href=\"a.txt\">a.txt</a>\n" +
+		"<a href=\"b&c/\">b&amp;c/</a>\n" +
+		"</pre>\n"
+	if expected != w.Body.String() {
+		t.Errorf("Expected listing '%s' but got '%s'", expected, w.Body.String())
+	}
+	if 0 == len(w.Header().Get("Last-Modified")) {
+		t.Error("Expected the listing to have a modification time")
+	}
+
+	req.Header.Set("If-Modified-Since", w.Header().Get("Last-Modified"))
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if http.StatusNotModified != w.Code {
+		t.Errorf("Expected status code %d but got %d", http.StatusNotModified, w.Code)
+	}
+}
+
+func TestFileServerListingPages(t *testing.T) {
+	folder := baseDir + "pages/"
+	if err := os.MkdirAll(folder, 0700); nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		if err := ioutil.WriteFile(folder+name, nil, 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+	handler := Basic(FileServer(Dir(baseDir)), "")
+
+	testCases := []struct {
+		name     string
+		query    string
+		code     int
+		expected string
+	}{
+		{"Every entry", "", http.StatusOK, "<pre>\n" +
+			"<a href=\"a.txt\">a.txt</a>\n" +
+			"<a href=\"b.txt\">b.txt</a>\n" +
+			"<a href=\"c.txt\">c.txt</a>\n" +
+			"<a href=\"d.txt\">d.txt</a>\n" +
+			"</pre>\n"},
+		{"First page", "?limit=2", http.StatusOK, "<pre>\n" +
+			"<a href=\"a.txt\">a.txt</a>\n" +
+			"<a href=\"b.txt\">b.txt</a>\n" +
+			"</pre>\n" +
+			"<a href=\"?limit=2&amp;offset=2\" rel=\"next\">next</a>\n"},
+		{"Last page", "?offset=2&limit=2", http.StatusOK, "<pre>\n" +
+			"<a href=\"c.txt\">c.txt</a>\n" +
+			"<a href=\"d.txt\">d.txt</a>\n" +
+			"</pre>\n"},
+		{"Past the end", "?offset=10", http.StatusOK, "<pre>\n</pre>\n"},
+		{"Invalid limit", "?limit=x", http.StatusBadRequest, ""},
+		{"Negative offset", "?offset=-1", http.StatusBadRequest, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/pages/"+tc.query, nil)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if http.StatusOK == tc.code && tc.expected != w.Body.String() {
+				t.Errorf("Expected listing '%s' but got '%s'", tc.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestFileServerListingBatches(t *testing.T) {
+	folder := baseDir + "batches/"
+	if err := os.MkdirAll(folder, 0700); nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	count := 2*listingBatch + 1
+	for i := 0; i < count; i++ {
+		name := folder + strconv.Itoa(i) + ".txt"
+		if err := ioutil.WriteFile(name, nil, 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+	}
+	handler := Basic(FileServer(Dir(baseDir)), "")
+
+	// Every entry is listed once across the batches.
+	req := httptest.NewRequest("GET", "http://localhost/batches/", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	listed := make(map[string]bool)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, "<a ") {
+			listed[line] = true
+		}
+	}
+	if count != len(listed) {
+		t.Errorf("Expected %d entries but got %d", count, len(listed))
+	}
+	if !w.Flushed {
+		t.Error("Expected the listing to be flushed between batches")
+	}
+}
+
+func TestDirResolve(t *testing.T) {
+	testCases := []struct {
+		dir      Dir
+		name     string
+		expected string
+	}{
+		{Dir("/web"), "/file.txt", "/web/file.txt"},
+		{Dir("/web"), "sub/file.txt", "/web/sub/file.txt"},
+		{Dir("/web"), "/../../etc/passwd", "/web/etc/passwd"},
+		{Dir(""), "/file.txt", "file.txt"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := filepath.FromSlash(tc.expected)
+			if resolved := tc.dir.resolve(tc.name); expected != resolved {
+				t.Errorf("Expected '%s' but got '%s'", expected, resolved)
+			}
+		})
+	}
+}
+
+func TestWalkStorage(t *testing.T) {
+	var walked []string
+	err := walkStorage(Dir(baseDir), "/sub", func(name string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if info.IsDir() && "/sub/deep" == name {
+			return filepath.SkipDir
+		}
+		walked = append(walked, name)
+		return nil
+	})
+	if nil != err {
+		t.Fatalf("While walking expected no error but got %v", err)
+	}
+
+	expected := []string{"/sub", "/sub/file.txt", "/sub/index.html"}
+	if len(expected) != len(walked) {
+		t.Fatalf("Expected %v but got %v", expected, walked)
+	}
+	for i := range expected {
+		if expected[i] != walked[i] {
+			t.Errorf("Expected %v but got %v", expected, walked)
+		}
+	}
+
+	err = walkStorage(Dir(baseDir), "/missing", func(name string, info os.FileInfo, err error) error {
+		return err
+	})
+	if !os.IsNotExist(err) {
+		t.Errorf("For a missing root expected a not exist error but got %v", err)
+	}
+}
+
+// countingStorage counts the bytes read from the files of a storage.
+type countingStorage struct {
+	Storage
+	read int64
+}
+
+func (storage *countingStorage) Open(name string) (http.File, error) {
+	file, err := storage.Storage.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	return &countingFile{File: file, storage: storage}, nil
+}
+
+// countingFile counts the bytes read from it.
+type countingFile struct {
+	http.File
+	storage *countingStorage
+}
+
+func (f *countingFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.storage.read += int64(n)
+	return n, err
+}
+
+func TestFileServerReadsOnlySentBytes(t *testing.T) {
+	info, err := os.Stat(baseDir + tmpFileName)
+	if nil != err {
+		t.Fatalf("While getting file info got %v", err)
+	}
+	modified := info.ModTime().UTC().Format(http.TimeFormat)
+	partial := http.StatusPartialContent
+	notModified := http.StatusNotModified
+	unsatisfiable := http.StatusRequestedRangeNotSatisfiable
+
+	testCases := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		code   int
+		read   int64
+	}{
+		{"Whole file", http.MethodGet, "", "", http.StatusOK, info.Size()},
+		{"Head", http.MethodHead, "", "", http.StatusOK, 0},
+		{"Range", http.MethodGet, "Range", "bytes=2-5", partial, 4},
+		{"Suffix range", http.MethodGet, "Range", "bytes=-3", partial, 3},
+		{"Not modified", http.MethodGet, "If-Modified-Since", modified, notModified, 0},
+		{"Unsatisfiable range", http.MethodGet, "Range", "bytes=1000-", unsatisfiable, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := &countingStorage{Storage: Dir(baseDir)}
+			handler := Basic(FileServer(storage), "")
+			req := httptest.NewRequest(tc.method, "http://localhost/"+tmpFileName, nil)
+			if 0 < len(tc.header) {
+				req.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+			if tc.read != storage.read {
+				t.Errorf("Expected %d bytes read but got %d", tc.read, storage.read)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handle
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// streamingTypes are the content types of HLS and DASH playlists, segments and
+// subtitles. They are set by WithStreaming rather than registered with the
+// MIME database, as '.ts' segments are TypeScript sources elsewhere.
+var streamingTypes = map[string]string{
+	".aac":  "audio/aac",
+	".cmfa": "audio/mp4",
+	".cmfv": "video/mp4",
+	".m3u8": "application/vnd.apple.mpegurl",
+	".m4a":  "audio/mp4",
+	".m4s":  "video/iso.segment",
+	".m4v":  "video/mp4",
+	".mp4":  "video/mp4",
+	".mpd":  "application/dash+xml",
+	".ts":   "video/mp2t",
+	".vtt":  "text/vtt; charset=utf-8",
+	".webm": "video/webm",
+}
+
+// streamingPlaylists are rewritten as live streams progress, unlike segments.
+var streamingPlaylists = map[string]bool{".m3u8": true, ".mpd": true}
+
+// StreamingConfig controls the headers set by WithStreaming.
+type StreamingConfig struct {
+	// PlaylistMaxAge of playlists in caches. If zero, playlists are
+	// revalidated on every request.
+	PlaylistMaxAge time.Duration
+
+	// SegmentMaxAge of segments in caches. If zero, segments are revalidated
+	// on every request.
+	SegmentMaxAge time.Duration
+
+	// CORSOrigin allowed to fetch playlists and segments, such as '*' or
+	// 'https://player.example.com'. If empty, no CORS headers are set.
+	CORSOrigin string
+}
+
+// WithStreaming wraps an HTTP request. Responses for HLS and DASH playlists
+// and segments are given their content type and a 'Cache-Control' header
+// keeping playlists briefly, so players see new segments of live streams
+// quickly, and segments for longer. Errors, such as segments of live streams
+// not yet written, are not kept. If a CORS origin is configured then
+// players on that origin may fetch them, including ranges, and CORS preflight
+// requests for them are answered. Other requests are served unchanged.
+func WithStreaming(serve http.HandlerFunc, config StreamingConfig) http.HandlerFunc {
+	playlistCache := streamingCacheControl(config.PlaylistMaxAge)
+	segmentCache := streamingCacheControl(config.SegmentMaxAge)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ext := strings.ToLower(path.Ext(r.URL.Path))
+		contentType, ok := streamingTypes[ext]
+		if !ok {
+			serve(w, r)
+			return
+		}
+
+		header := w.Header()
+		if 0 < len(config.CORSOrigin) {
+			header.Set("Access-Control-Allow-Origin", config.CORSOrigin)
+			if "*" != config.CORSOrigin {
+				header.Add("Vary", "Origin")
+			}
+			if http.MethodOptions == r.Method &&
+				0 < len(r.Header.Get("Access-Control-Request-Method")) {
+				header.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+				header.Set("Access-Control-Allow-Headers", "Range")
+				header.Set("Access-Control-Max-Age", "86400")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			header.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range")
+		}
+		header.Set("Content-Type", contentType)
+		if streamingPlaylists[ext] {
+			header.Set("Cache-Control", playlistCache)
+		} else {
+			header.Set("Cache-Control", segmentCache)
+		}
+		serve(&streamingWriter{ResponseWriter: w}, r)
+	}
+}
+
+// streamingWriter removes the 'Cache-Control' header of error responses.
+type streamingWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+// WriteHeader removes the 'Cache-Control' header if the code is an error.
+func (w *streamingWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+	w.written = true
+	if http.StatusBadRequest <= code {
+		w.Header().Del("Cache-Control")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write the body of the response.
+func (w *streamingWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom copies the body of the response from the reader.
+func (w *streamingWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return readFrom(w.ResponseWriter, src)
+}
+
+// Flush flushes the response.
+func (w *streamingWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	flush(w.ResponseWriter)
+}
+
+// streamingCacheControl returns the 'Cache-Control' header value keeping
+// responses for the duration.
+func streamingCacheControl(maxAge time.Duration) string {
+	if 0 >= maxAge/time.Second {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second))
+}
@@ -0,0 +1,101 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithStreaming(t *testing.T) {
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		if "/live/missing.ts" == r.URL.Path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("#EXTM3U"))
+	}
+	config := StreamingConfig{
+		PlaylistMaxAge: time.Second,
+		SegmentMaxAge:  24 * time.Hour,
+		CORSOrigin:     "*",
+	}
+	handler := WithStreaming(serve, config)
+
+	testCases := []struct {
+		name         string
+		method       string
+		path         string
+		code         int
+		contentType  string
+		cacheControl string
+		origin       string
+	}{
+		{"HLS playlist", "GET", "/live/index.m3u8", ok,
+			"application/vnd.apple.mpegurl", "public, max-age=1", "*"},
+		{"DASH manifest", "GET", "/vod/manifest.MPD", ok,
+			"application/dash+xml", "public, max-age=1", "*"},
+		{"Transport segment", "GET", "/live/segment1.ts", ok,
+			"video/mp2t", "public, max-age=86400", "*"},
+		{"Fragmented segment", "HEAD", "/vod/chunk-1.m4s", ok,
+			"video/iso.segment", "public, max-age=86400", "*"},
+		{"Subtitles", "GET", "/vod/en.vtt", ok,
+			"text/vtt; charset=utf-8", "public, max-age=86400", "*"},
+		{"Missing segment", "GET", "/live/missing.ts", http.StatusNotFound,
+			"text/plain; charset=utf-8", "", "*"},
+		{"Preflight", "OPTIONS", "/live/index.m3u8", http.StatusNoContent,
+			"", "", "*"},
+		{"Other file", "GET", "/index.html", ok,
+			"text/plain; charset=utf-8", "", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			if http.MethodOptions == tc.method {
+				req.Header.Set("Origin", "https://player.example.com")
+				req.Header.Set("Access-Control-Request-Method", "GET")
+				req.Header.Set("Access-Control-Request-Headers", "range")
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Fatalf("For %s expected status code %d but got %d", tc.path, tc.code, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); tc.contentType != contentType {
+				t.Errorf("For %s expected type '%s' but got '%s'", tc.path, tc.contentType, contentType)
+			}
+			if cacheControl := w.Header().Get("Cache-Control"); tc.cacheControl != cacheControl {
+				t.Errorf("For %s expected Cache-Control '%s' but got '%s'", tc.path, tc.cacheControl, cacheControl)
+			}
+			if origin := w.Header().Get("Access-Control-Allow-Origin"); tc.origin != origin {
+				t.Errorf("For %s expected origin '%s' but got '%s'", tc.path, tc.origin, origin)
+			}
+			if http.MethodOptions == tc.method &&
+				"Range" != w.Header().Get("Access-Control-Allow-Headers") {
+				t.Errorf("For %s expected the Range header to be allowed", tc.path)
+			}
+		})
+	}
+
+	// Without caching or CORS, playlists are revalidated and only typed.
+	handler = WithStreaming(serve, StreamingConfig{})
+	req := httptest.NewRequest("GET", "http://localhost/live/index.m3u8", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if "no-cache" != w.Header().Get("Cache-Control") {
+		t.Errorf("Expected Cache-Control 'no-cache' but got '%s'", w.Header().Get("Cache-Control"))
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); "" != origin {
+		t.Errorf("Expected no CORS origin but got '%s'", origin)
+	}
+
+	// Specific origins vary responses by the origin of the request.
+	handler = WithStreaming(serve, StreamingConfig{CORSOrigin: "https://player.example.com"})
+	w = httptest.NewRecorder()
+	handler(w, req)
+	if "Origin" != w.Header().Get("Vary") {
+		t.Errorf("Expected 'Vary: Origin' but got '%s'", w.Header().Get("Vary"))
+	}
+}
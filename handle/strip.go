@@ -0,0 +1,315 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxScannedImages limits the images whose metadata locations are kept by a
+// MetadataStripper. The entries are dropped together when the limit is reached.
+const maxScannedImages = 10000
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+	// jpegMetadata identifies APP1 segments holding EXIF and XMP metadata.
+	jpegMetadata = [][]byte{
+		[]byte("Exif\x00"),
+		[]byte("http://ns.adobe.com/xap/1.0/\x00"),
+		[]byte("http://ns.adobe.com/xmp/extension/\x00"),
+	}
+
+	// pngMetadata chunks holding EXIF, text and modification times.
+	pngMetadata = map[string]bool{
+		"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true,
+	}
+
+	errNotImage = errors.New("not a JPEG or PNG image")
+)
+
+// MetadataStripper is Storage serving the JPEG and PNG images of another
+// Storage without their metadata, such as the GPS location and camera details
+// of EXIF, XMP and IPTC in JPEG images and EXIF and text chunks in PNG images.
+// Image data, color profiles and the rest of each file are served unchanged,
+// read from the original file, so the images are not decoded. The locations
+// of the metadata are kept until the file changes. EXIF orientation is
+// removed with the rest of the metadata, so photos relying on it may be shown
+// rotated. Files that cannot be parsed are served unchanged.
+type MetadataStripper struct {
+	storage Storage
+	mutex   sync.Mutex
+	scanned map[string]scannedImage
+}
+
+// span of an original file that is kept, at an offset of the stripped file.
+type span struct {
+	from, length, at int64
+}
+
+// scannedImage records the spans kept of a version of an image.
+type scannedImage struct {
+	size    int64
+	modTime time.Time
+	spans   []span
+}
+
+// NewMetadataStripper returns Storage stripping metadata from the images of
+// the storage.
+func NewMetadataStripper(storage Storage) *MetadataStripper {
+	return &MetadataStripper{storage: storage, scanned: make(map[string]scannedImage)}
+}
+
+// Open the named file or folder for reading. Images are read without their
+// metadata.
+func (stripper *MetadataStripper) Open(name string) (http.File, error) {
+	file, err := stripper.storage.Open(name)
+	if nil != err || !strippable(name) {
+		return file, err
+	}
+	info, err := file.Stat()
+	if nil != err || info.IsDir() {
+		return file, nil
+	}
+	spans, err := stripper.spans(name, info, file)
+	if _, seekErr := file.Seek(0, io.SeekStart); nil != err || nil != seekErr {
+		return file, seekErr
+	}
+	stripped := &strippedFile{File: file, spans: spans}
+	stripped.info = strippedInfo{FileInfo: info, size: stripped.size()}
+	return stripped, nil
+}
+
+// Stat returns information describing the named file or folder, with the size
+// of images without their metadata.
+func (stripper *MetadataStripper) Stat(name string) (os.FileInfo, error) {
+	info, err := stripper.storage.Stat(name)
+	if nil != err || !strippable(name) || info.IsDir() {
+		return info, err
+	}
+	file, err := stripper.Open(name)
+	if nil != err {
+		return info, nil
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// ReadDir returns information describing the contents of the named folder,
+// sorted by name. Sizes are those of the original files.
+func (stripper *MetadataStripper) ReadDir(name string) ([]os.FileInfo, error) {
+	return stripper.storage.ReadDir(name)
+}
+
+// spans returns the spans of the file kept without its metadata, scanning the
+// file if it is new or has changed.
+func (stripper *MetadataStripper) spans(
+	name string, info os.FileInfo, file io.ReadSeeker,
+) ([]span, error) {
+	stripper.mutex.Lock()
+	scanned, found := stripper.scanned[name]
+	stripper.mutex.Unlock()
+	if found && scanned.size == info.Size() && scanned.modTime.Equal(info.ModTime()) {
+		return scanned.spans, nil
+	}
+
+	var spans []span
+	var err error
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png":
+		spans, err = pngSpans(file, info.Size())
+	default:
+		spans, err = jpegSpans(file, info.Size())
+	}
+	if nil != err {
+		return nil, err
+	}
+	stripper.mutex.Lock()
+	if maxScannedImages <= len(stripper.scanned) {
+		stripper.scanned = make(map[string]scannedImage)
+	}
+	stripper.scanned[name] = scannedImage{info.Size(), info.ModTime(), spans}
+	stripper.mutex.Unlock()
+	return spans, nil
+}
+
+// strippable returns true for the names of JPEG and PNG images.
+func strippable(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// keep appends the span of the original file to the spans, joining it to the
+// last span if they are adjacent.
+func keep(spans []span, from, to int64) []span {
+	if 0 < len(spans) {
+		last := &spans[len(spans)-1]
+		if last.from+last.length == from {
+			last.length += to - from
+			return spans
+		}
+		return append(spans, span{from, to - from, last.at + last.length})
+	}
+	return append(spans, span{from, to - from, 0})
+}
+
+// jpegSpans returns the spans of a JPEG image without its APP1 EXIF and XMP
+// segments, APP13 IPTC segments and comments. Segments are read up to the
+// start of the scan, which is kept with the rest of the file.
+func jpegSpans(file io.ReadSeeker, size int64) ([]span, error) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(file, header[:2])
+	if nil != err || 0xFF != header[0] || 0xD8 != header[1] {
+		return nil, errNotImage
+	}
+	spans := keep(nil, 0, 2)
+	for offset := int64(2); offset < size; {
+		if _, err := io.ReadFull(file, header); nil != err || 0xFF != header[0] {
+			return nil, errNotImage
+		}
+		marker := header[1]
+		if 0xDA == marker {
+			return keep(spans, offset, size), nil
+		}
+		length := int64(binary.BigEndian.Uint16(header[2:]))
+		end := offset + 2 + length
+		if 2 > length || size < end {
+			return nil, errNotImage
+		}
+		drop := 0xED == marker || 0xFE == marker
+		if 0xE1 == marker {
+			payload := make([]byte, 35)
+			n, _ := io.ReadFull(file, payload[:min64(int64(len(payload)), length-2)])
+			for _, prefix := range jpegMetadata {
+				drop = drop || bytes.HasPrefix(payload[:n], prefix)
+			}
+		}
+		if !drop {
+			spans = keep(spans, offset, end)
+		}
+		if _, err := file.Seek(end, io.SeekStart); nil != err {
+			return nil, err
+		}
+		offset = end
+	}
+	return spans, nil
+}
+
+// pngSpans returns the spans of a PNG image without its EXIF, text and
+// modification time chunks.
+func pngSpans(file io.ReadSeeker, size int64) ([]span, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); nil != err || !bytes.Equal(pngSignature, header) {
+		return nil, errNotImage
+	}
+	spans := keep(nil, 0, 8)
+	for offset := int64(8); offset < size; {
+		if _, err := io.ReadFull(file, header); nil != err {
+			return nil, errNotImage
+		}
+		end := offset + 12 + int64(binary.BigEndian.Uint32(header))
+		if size < end {
+			return nil, errNotImage
+		}
+		chunk := string(header[4:])
+		if !pngMetadata[chunk] {
+			spans = keep(spans, offset, end)
+		}
+		if "IEND" == chunk {
+			break
+		}
+		if _, err := file.Seek(end, io.SeekStart); nil != err {
+			return nil, err
+		}
+		offset = end
+	}
+	return spans, nil
+}
+
+// min64 returns the smaller of the values.
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// strippedFile reads the spans of an image kept without its metadata.
+type strippedFile struct {
+	http.File
+	spans  []span
+	info   os.FileInfo
+	offset int64
+}
+
+// size of the stripped file.
+func (f *strippedFile) size() int64 {
+	if 0 == len(f.spans) {
+		return 0
+	}
+	last := f.spans[len(f.spans)-1]
+	return last.at + last.length
+}
+
+// Read from the span at the offset.
+func (f *strippedFile) Read(p []byte) (int, error) {
+	for _, s := range f.spans {
+		if f.offset >= s.at+s.length {
+			continue
+		}
+		if _, err := f.File.Seek(s.from+f.offset-s.at, io.SeekStart); nil != err {
+			return 0, err
+		}
+		if remaining := s.at + s.length - f.offset; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+		n, err := f.File.Read(p)
+		f.offset += int64(n)
+		if io.EOF == err && 0 < n {
+			err = nil
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+// Seek sets the offset of the next Read in the stripped file.
+func (f *strippedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size()
+	}
+	if 0 > offset {
+		return f.offset, errors.New("seek to a negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Stat returns information describing the file, with its stripped size.
+func (f *strippedFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// strippedInfo describes an image with the size without its metadata.
+type strippedInfo struct {
+	os.FileInfo
+	size int64
+}
+
+// Size of the image without its metadata.
+func (info strippedInfo) Size() int64 {
+	return info.size
+}
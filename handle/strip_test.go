@@ -0,0 +1,124 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pngChunk returns an encoded PNG chunk.
+func pngChunk(chunk, data string) []byte {
+	encoded := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(encoded, uint32(len(data)))
+	encoded = append(encoded, chunk+data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(encoded[4:]))
+	return append(encoded, crc...)
+}
+
+// jpegSegment returns an encoded JPEG segment.
+func jpegSegment(marker byte, data string) []byte {
+	encoded := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(encoded[2:], uint16(2+len(data)))
+	return append(encoded, data...)
+}
+
+func TestMetadataStripper(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strip")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := image.NewGray(image.Rect(0, 0, 8, 8))
+	var encoded bytes.Buffer
+	jpeg.Encode(&encoded, src, nil)
+	plainJPEG := encoded.Bytes()
+	var withEXIF []byte
+	withEXIF = append(withEXIF, plainJPEG[:2]...)
+	withEXIF = append(withEXIF, jpegSegment(0xE1, "Exif\x00\x00GPS 51.5N 0.1W")...)
+	withEXIF = append(withEXIF, jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")...)
+	withEXIF = append(withEXIF, jpegSegment(0xFE, "Camera X100")...)
+	withEXIF = append(withEXIF, plainJPEG[2:]...)
+
+	encoded = bytes.Buffer{}
+	png.Encode(&encoded, src)
+	plainPNG := encoded.Bytes()
+	iend := len(plainPNG) - 12
+	var withText []byte
+	withText = append(withText, plainPNG[:iend]...)
+	withText = append(withText, pngChunk("tEXt", "GPS\x0051.5N 0.1W")...)
+	withText = append(withText, pngChunk("eXIf", "MM\x00*")...)
+	withText = append(withText, plainPNG[iend:]...)
+
+	files := map[string][]byte{
+		"photo.jpg":  withEXIF,
+		"photo.png":  withText,
+		"broken.jpg": []byte("not an image"),
+		"file.txt":   []byte("Exif"),
+	}
+	for name, contents := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), contents, 0644)
+	}
+	stripper := NewMetadataStripper(Dir(dir))
+
+	testCases := []struct {
+		name     string
+		expected []byte
+	}{
+		{"/photo.jpg", plainJPEG},
+		{"/photo.png", plainPNG},
+		{"/broken.jpg", files["broken.jpg"]},
+		{"/file.txt", files["file.txt"]},
+	}
+	for _, tc := range testCases {
+		// Twice, the second time from the scanned spans.
+		for i := 0; i < 2; i++ {
+			file, err := stripper.Open(tc.name)
+			if nil != err {
+				t.Fatalf("While opening %s got %v", tc.name, err)
+			}
+			contents, err := ioutil.ReadAll(file)
+			file.Close()
+			if nil != err {
+				t.Fatalf("While reading %s got %v", tc.name, err)
+			}
+			if !bytes.Equal(tc.expected, contents) {
+				t.Errorf("For %s expected %d bytes but got %d", tc.name, len(tc.expected), len(contents))
+			}
+		}
+		info, err := stripper.Stat(tc.name)
+		if nil != err {
+			t.Fatalf("While getting information of %s got %v", tc.name, err)
+		}
+		if int64(len(tc.expected)) != info.Size() {
+			t.Errorf("For %s expected size %d but got %d", tc.name, len(tc.expected), info.Size())
+		}
+	}
+
+	// Ranges are read by seeking within the stripped image.
+	file, err := stripper.Open("/photo.jpg")
+	if nil != err {
+		t.Fatalf("While opening photo.jpg got %v", err)
+	}
+	defer file.Close()
+	if size, _ := file.Seek(0, io.SeekEnd); int64(len(plainJPEG)) != size {
+		t.Errorf("Expected the end at %d but got %d", len(plainJPEG), size)
+	}
+	file.Seek(1, io.SeekStart)
+	part := make([]byte, 4)
+	if _, err = io.ReadFull(file, part); nil != err || !bytes.Equal(plainJPEG[1:5], part) {
+		t.Errorf("Expected bytes %x but got %x (%v)", plainJPEG[1:5], part, err)
+	}
+	if _, err = file.Seek(-1, io.SeekStart); nil == err {
+		t.Error("Expected an error seeking to a negative offset")
+	}
+}
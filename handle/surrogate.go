@@ -0,0 +1,114 @@
+package handle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LoadSurrogateKeyManifest reads a JSON object mapping file paths, such as
+// '/js/app.js', to lists of surrogate keys.
+func LoadSurrogateKeyManifest(filename string) (map[string][]string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if nil != err {
+		return nil, err
+	}
+	manifest := make(map[string][]string)
+	if err = json.Unmarshal(contents, &manifest); nil != err {
+		return nil, fmt.Errorf(
+			"invalid surrogate key manifest '%s': %v", filename, err,
+		)
+	}
+	return manifest, nil
+}
+
+// SurrogateKeys of the file with the name in the storage: the top-level folder
+// containing it, if any, followed by the keys listed in the manifest.
+func SurrogateKeys(name string, manifest map[string][]string) []string {
+	var keys []string
+	if parts := strings.SplitN(strings.TrimPrefix(name, "/"), "/", 2); 2 == len(parts) {
+		keys = append(keys, parts[0])
+	}
+	for _, key := range manifest[name] {
+		if !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// WithSurrogateKeys wraps an HTTP request. Responses carry the SurrogateKeys
+// of the requested file in the header, such as 'Surrogate-Key' for Fastly or
+// 'Cache-Tag' for Cloudflare, so CDN purges can target groups of files.
+// Requests are resolved to files in the storage by removing urlPrefix in the
+// same way as Prefix.
+func WithSurrogateKeys(
+	serve http.HandlerFunc,
+	urlPrefix string,
+	header string,
+	manifest map[string][]string,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, urlPrefix) {
+			name := strings.TrimPrefix(r.URL.Path, urlPrefix)
+			if keys := SurrogateKeys(name, manifest); 0 < len(keys) {
+				w.Header().Set(header, strings.Join(keys, " "))
+			}
+		}
+		serve(w, r)
+	}
+}
+
+// Purge of changed files sent to a webhook.
+type Purge struct {
+	Paths []string `json:"paths"`
+	Keys  []string `json:"keys"`
+}
+
+// NewPurge returns the purge of the changed files, with URL paths including
+// urlPrefix and the combined surrogate keys of the files.
+func NewPurge(
+	names []string, urlPrefix string, manifest map[string][]string,
+) Purge {
+	purge := Purge{Paths: make([]string, 0, len(names)), Keys: make([]string, 0)}
+	for _, name := range names {
+		purge.Paths = append(purge.Paths, urlPrefix+name)
+		for _, key := range SurrogateKeys(name, manifest) {
+			if !containsString(purge.Keys, key) {
+				purge.Keys = append(purge.Keys, key)
+			}
+		}
+	}
+	sort.Strings(purge.Keys)
+	return purge
+}
+
+// PurgeWebhook returns a WatchFunc posting the Purge of changed files as JSON
+// to the URL. Failures are logged.
+func PurgeWebhook(
+	url string, urlPrefix string, manifest map[string][]string,
+) WatchFunc {
+	client := &http.Client{Timeout: 30 * time.Second}
+	return func(names []string) {
+		body, err := json.Marshal(NewPurge(names, urlPrefix, manifest))
+		if nil != err {
+			log.Printf("Error: while encoding purge got %v\n", err)
+			return
+		}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if nil != err {
+			log.Printf("Error: while calling purge webhook got %v\n", err)
+			return
+		}
+		resp.Body.Close()
+		if 300 <= resp.StatusCode {
+			log.Printf("Error: purge webhook returned %s\n", resp.Status)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithSurrogateKeys(t *testing.T) {
+	manifest := map[string][]string{"/css/app.css": {"styles", "css"}}
+	handler := WithSurrogateKeys(
+		func(http.ResponseWriter, *http.Request) {}, "/static", "Cache-Tag", manifest,
+	)
+
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/static/index.html", ""},
+		{"/static/js/app.js", "js"},
+		{"/static/css/app.css", "css styles"},
+		{"/other/js/app.js", ""},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", tc.path, nil))
+		if keys := w.Header().Get("Cache-Tag"); tc.expected != keys {
+			t.Errorf("For %s expected keys '%s' but got '%s'", tc.path, tc.expected, keys)
+		}
+	}
+}
+
+func TestPurgeWebhook(t *testing.T) {
+	var purge Purge
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &purge)
+	}))
+	defer server.Close()
+
+	manifest := map[string][]string{"/index.html": {"pages"}}
+	PurgeWebhook(server.URL, "/static", manifest)(
+		[]string{"/index.html", "/js/app.js", "/js/vendor.js"},
+	)
+	if paths := strings.Join(purge.Paths, " "); "/static/index.html /static/js/app.js /static/js/vendor.js" != paths {
+		t.Errorf("Expected the changed paths but got '%s'", paths)
+	}
+	if keys := strings.Join(purge.Keys, " "); "js pages" != keys {
+		t.Errorf("Expected the changed keys but got '%s'", keys)
+	}
+}
+
+func TestLoadSurrogateKeyManifest(t *testing.T) {
+	good := writeCredentials(t, "keys.json", `{"/file.txt": ["docs"]}`)
+	defer os.Remove(good)
+	bad := writeCredentials(t, "bad.json", `{"/file.txt": "docs"}`)
+	defer os.Remove(bad)
+
+	manifest, err := LoadSurrogateKeyManifest(good)
+	if nil != err || 1 != len(manifest["/file.txt"]) {
+		t.Errorf("Expected the manifest but got %v and %v", manifest, err)
+	}
+	if _, err = LoadSurrogateKeyManifest(bad); nil == err {
+		t.Error("With an invalid manifest expected an error but got nil")
+	}
+}
@@ -0,0 +1,155 @@
+package handle
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Extensions of the files rendered by WithTemplates.
+const (
+	templateExt   = ".tmpl"
+	goHTMLExt     = ".gohtml"
+	templateIndex = "index.html"
+)
+
+// executor is a parsed html/template or text/template.
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// parsedTemplate of a file, kept until the file changes.
+type parsedTemplate struct {
+	size     int64
+	modTime  time.Time
+	template executor
+}
+
+// templates parses the template files of a storage, keeping them until they
+// change. Safe for concurrent use.
+type templates struct {
+	storage Storage
+
+	mutex  sync.Mutex
+	parsed map[string]parsedTemplate
+}
+
+// get returns the parsed template of the file, parsing it if it is new or has
+// changed. HTML output is parsed with html/template, escaping the variables
+// by context, and all other output with text/template.
+func (cache *templates) get(name, output string, info os.FileInfo) (executor, error) {
+	cache.mutex.Lock()
+	cached, found := cache.parsed[name]
+	cache.mutex.Unlock()
+	if found && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.template, nil
+	}
+
+	file, err := cache.storage.Open(name)
+	if nil != err {
+		return nil, err
+	}
+	defer file.Close()
+	contents, err := ioutil.ReadAll(file)
+	if nil != err {
+		return nil, err
+	}
+	var parsed executor
+	if strings.HasPrefix(mime.TypeByExtension(path.Ext(output)), "text/html") {
+		parsed, err = htmltemplate.New(name).Option("missingkey=zero").Parse(string(contents))
+	} else {
+		parsed, err = template.New(name).Option("missingkey=zero").Parse(string(contents))
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	cache.parsed[name] = parsedTemplate{info.Size(), info.ModTime(), parsed}
+	cache.mutex.Unlock()
+	return parsed, nil
+}
+
+// WithTemplates wraps an HTTP request. Files ending in '.tmpl' or '.gohtml'
+// are rendered with the variables, referenced as '{{.NAME}}', when requested
+// directly or, for '.tmpl' files, when the file without the extension, such as
+// 'config.js' for 'config.js.tmpl', is requested and missing. Folders are
+// served a missing 'index.html' from 'index.html.tmpl'. Output is typed by the
+// name without '.tmpl' and '.gohtml' output is HTML. Requests are resolved to
+// files in the storage by removing urlPrefix in the same way as Prefix.
+func WithTemplates(
+	serve http.HandlerFunc, storage Storage, urlPrefix string, vars map[string]string,
+) http.HandlerFunc {
+	cache := &templates{storage: storage, parsed: make(map[string]parsedTemplate)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if (http.MethodGet != r.Method && http.MethodHead != r.Method) ||
+			!strings.HasPrefix(r.URL.Path, urlPrefix) {
+			serve(w, r)
+			return
+		}
+		requested := strings.TrimPrefix(r.URL.Path, urlPrefix)
+		if strings.HasSuffix(requested, "/") {
+			requested += templateIndex
+		}
+		name, output, info := findTemplate(storage, requested)
+		if nil == info {
+			serve(w, r)
+			return
+		}
+
+		tmpl, err := cache.get(name, output, info)
+		var rendered bytes.Buffer
+		if nil == err {
+			err = tmpl.Execute(&rendered, vars)
+		}
+		if nil != err {
+			log.Printf("Error: while rendering template %s got %v\n", name, err)
+			http.Error(
+				w,
+				"500 internal server error",
+				http.StatusInternalServerError,
+			)
+			return
+		}
+		Tracef(r, "rendered template %s", name)
+		if ctype := mime.TypeByExtension(path.Ext(output)); "" != ctype {
+			w.Header().Set("Content-Type", ctype)
+		}
+		http.ServeContent(w, r, output, time.Time{}, bytes.NewReader(rendered.Bytes()))
+	}
+}
+
+// findTemplate returns the name of the template file rendered for the
+// requested name, the name of its output and its information, which is nil if
+// no template is rendered.
+func findTemplate(storage Storage, requested string) (string, string, os.FileInfo) {
+	switch ext := path.Ext(requested); ext {
+	case templateExt:
+		if info, err := storage.Stat(requested); nil == err && !info.IsDir() {
+			return requested, strings.TrimSuffix(requested, ext), info
+		}
+	case goHTMLExt:
+		if info, err := storage.Stat(requested); nil == err && !info.IsDir() {
+			return requested, strings.TrimSuffix(requested, ext) + ".html", info
+		}
+	default:
+		if _, err := storage.Stat(requested); !os.IsNotExist(err) {
+			return "", "", nil
+		}
+		name := requested + templateExt
+		if info, err := storage.Stat(name); nil == err && !info.IsDir() {
+			return name, requested, info
+		}
+	}
+	return "", "", nil
+}
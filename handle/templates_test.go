@@ -0,0 +1,97 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"config.js.tmpl":  `var api = "{{.API_URL}}";`,
+		"index.html.tmpl": `<p>{{.NAME}}</p>`,
+		"page.gohtml":     `<a href="{{.API_URL}}">{{.NAME}}</a>`,
+		"static.txt":      `{{.NAME}}`,
+		"static.txt.tmpl": `rendered`,
+		"broken.txt.tmpl": `{{.NAME`,
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); nil != err {
+			t.Fatalf("While writing %s got %v", name, err)
+		}
+	}
+
+	served := "served"
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(served))
+	}
+	vars := map[string]string{"API_URL": "https://api.example.com/?a=1&b=2", "NAME": "<Dev>"}
+	handler := WithTemplates(serve, Dir(dir), "/prefix", vars)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		code     int
+		ctype    string
+		contents string
+	}{
+		{"Missing file", "GET", "/prefix/config.js", ok, "javascript",
+			`var api = "https://api.example.com/?a=1&b=2";`},
+		{"Template file", "GET", "/prefix/config.js.tmpl", ok, "javascript",
+			`var api = "https://api.example.com/?a=1&b=2";`},
+		{"Folder index", "GET", "/prefix/", ok, "text/html", `<p>&lt;Dev&gt;</p>`},
+		{"HTML template", "GET", "/prefix/page.gohtml", ok, "text/html",
+			`<a href="https://api.example.com/?a=1&amp;b=2">&lt;Dev&gt;</a>`},
+		{"Existing file", "GET", "/prefix/static.txt", ok, "", served},
+		{"Other file", "GET", "/prefix/other.txt", ok, "", served},
+		{"Outside prefix", "GET", "/config.js", ok, "", served},
+		{"Other method", "POST", "/prefix/config.js", ok, "", served},
+		{"Head", "HEAD", "/prefix/config.js", ok, "javascript", ""},
+		{"Broken template", "GET", "/prefix/broken.txt", http.StatusInternalServerError, "",
+			"500 internal server error\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf("For %s expected status code %d but got %d", tc.path, tc.code, w.Code)
+			}
+			if ctype := w.Header().Get("Content-Type"); !strings.Contains(ctype, tc.ctype) {
+				t.Errorf("For %s expected content type '%s' but got '%s'", tc.path, tc.ctype, ctype)
+			}
+			if contents := w.Body.String(); tc.contents != contents {
+				t.Errorf("For %s expected '%s' but got '%s'", tc.path, tc.contents, contents)
+			}
+		})
+	}
+
+	// Changed templates are parsed again.
+	name := filepath.Join(dir, "config.js.tmpl")
+	if err = ioutil.WriteFile(name, []byte(`var name = "{{.NAME}}";`), 0644); nil != err {
+		t.Fatalf("While writing config.js.tmpl got %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(name, later, later)
+	req := httptest.NewRequest("GET", "http://localhost/prefix/config.js", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if expected := `var name = "<Dev>";`; expected != w.Body.String() {
+		t.Errorf("Expected '%s' after change but got '%s'", expected, w.Body.String())
+	}
+}
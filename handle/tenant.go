@@ -0,0 +1,223 @@
+package handle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Tenant isolates the requests with paths within Prefix, so many teams can
+// share a server. Each tenant has its own optional authentication realm,
+// request rate limit and bandwidth cap, and its usage is accounted in metrics
+// labelled by Name.
+type Tenant struct {
+	Name      string
+	Prefix    string
+	Realm     *AuthRealm
+	Limiter   *RateLimiter
+	Bandwidth *Bandwidth
+}
+
+// WithTenants returns middleware applying the limits of the tenant with the
+// longest prefix containing the request path. Requests outside every tenant
+// pass through. If registry is not nil, the requests and body bytes served
+// for each tenant are counted, including requests refused by its limits.
+// Later stages check other paths against the tenant realms with Allowed.
+func WithTenants(tenants []Tenant, registry MetricsRegistry) Middleware {
+	var requests, written Counter
+	if nil != registry {
+		requests = registry.Counter(
+			"static_file_server_tenant_requests_total",
+			"Number of HTTP requests served for each tenant.",
+			"tenant", "code",
+		)
+		written = registry.Counter(
+			"static_file_server_tenant_response_bytes_total",
+			"Number of body bytes written in HTTP responses for each tenant.",
+			"tenant",
+		)
+	}
+
+	overrides := make([]PrefixMiddleware, len(tenants))
+	for i, tenant := range tenants {
+		tenant := tenant
+		overrides[i] = PrefixMiddleware{
+			Prefix: tenant.Prefix,
+			Middleware: func(serve http.HandlerFunc) http.HandlerFunc {
+				if nil != tenant.Bandwidth {
+					serve = WithBandwidth(serve, tenant.Bandwidth)
+				}
+				if nil != tenant.Realm {
+					serve = WithAuth(serve, []AuthRealm{*tenant.Realm})
+				}
+				if nil != tenant.Limiter {
+					serve = WithRateLimit(serve, tenant.Limiter)
+				}
+				return withTenantUsage(serve, tenant.Name, requests, written)
+			},
+		}
+	}
+	byPrefix := ByPrefix(nil, overrides)
+	return func(serve http.HandlerFunc) http.HandlerFunc {
+		serve = byPrefix(serve)
+		return func(w http.ResponseWriter, r *http.Request) {
+			serve(w, withTenantCheck(r, tenants))
+		}
+	}
+}
+
+// withTenantCheck returns a copy of the request checking other paths against
+// the realm of the tenant with the longest prefix containing them, as WithAuth
+// does for its realms. Paths outside every tenant realm are checked with the
+// subject the request arrived with.
+func withTenantCheck(r *http.Request, tenants []Tenant) *http.Request {
+	arrived := Subject(r)
+	return withAccessCheck(r, func(r *http.Request) (*http.Request, bool) {
+		match := -1
+		for i, tenant := range tenants {
+			if withinPrefix(r.URL.Path, tenant.Prefix) &&
+				(0 > match || len(tenants[match].Prefix) < len(tenant.Prefix)) {
+				match = i
+			}
+		}
+		if 0 > match || nil == tenants[match].Realm {
+			return WithSubject(r, arrived), true
+		}
+		authenticated := tenants[match].Realm.Authenticate(r)
+		return WithSubject(r, authenticated), 0 < len(authenticated)
+	})
+}
+
+// withTenantUsage wraps an HTTP request, adding the tenant to the access log
+// and counting the request and its body bytes if the counters are set.
+func withTenantUsage(
+	serve http.HandlerFunc, name string, requests, written Counter,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = annotate(r, "tenant", name)
+		if nil == requests {
+			serve(w, r)
+			return
+		}
+		recorder := newStatusWriter(w)
+		serve(recorder, r)
+		requests.Add(1, name, statusCode(recorder.Status()))
+		written.Add(float64(recorder.bytes), name)
+		recorder.release()
+	}
+}
+
+// Bandwidth caps the rate at which the responses sharing it write body bytes.
+// Safe for concurrent use.
+type Bandwidth struct {
+	rate  int64
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// NewBandwidth returns a cap of rate bytes per second.
+func NewBandwidth(rate int64) *Bandwidth {
+	return &Bandwidth{rate: rate, now: time.Now, sleep: sleepContext}
+}
+
+// reserve n bytes, returning how long to wait before writing them so that
+// the bytes reserved so far are written at the capped rate.
+func (bandwidth *Bandwidth) reserve(n int) time.Duration {
+	bandwidth.mutex.Lock()
+	defer bandwidth.mutex.Unlock()
+	now := bandwidth.now()
+	if bandwidth.next.Before(now) {
+		bandwidth.next = now
+	}
+	wait := bandwidth.next.Sub(now)
+	bandwidth.next = bandwidth.next.Add(
+		time.Duration(int64(n) * int64(time.Second) / bandwidth.rate),
+	)
+	return wait
+}
+
+// chunk returns the number of bytes written at a time, a tenth of a second
+// of the rate within 1 byte and DefaultCopyBufferSize.
+func (bandwidth *Bandwidth) chunk() int {
+	chunk := bandwidth.rate / 10
+	if 1 > chunk {
+		chunk = 1
+	}
+	if DefaultCopyBufferSize < chunk {
+		chunk = DefaultCopyBufferSize
+	}
+	return int(chunk)
+}
+
+// sleepContext waits for the duration, returning early with the error of the
+// context if it is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if 0 >= d {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithBandwidth wraps an HTTP request. Response bodies are written no faster
+// than the bandwidth allows, shared with every other response using it.
+// Writing stops early if the client goes away.
+func WithBandwidth(serve http.HandlerFunc, bandwidth *Bandwidth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serve(&bandwidthWriter{
+			ResponseWriter: w,
+			bandwidth:      bandwidth,
+			ctx:            r.Context(),
+		}, r)
+	}
+}
+
+// bandwidthWriter paces the body written to the response.
+type bandwidthWriter struct {
+	http.ResponseWriter
+	bandwidth *Bandwidth
+	ctx       context.Context
+}
+
+// Write the bytes a chunk at a time, waiting for the bandwidth to allow each.
+func (w *bandwidthWriter) Write(b []byte) (written int, err error) {
+	chunk := w.bandwidth.chunk()
+	for 0 < len(b) {
+		size := len(b)
+		if chunk < size {
+			size = chunk
+		}
+		if err = w.bandwidth.sleep(w.ctx, w.bandwidth.reserve(size)); nil != err {
+			return
+		}
+		var n int
+		n, err = w.ResponseWriter.Write(b[:size])
+		written += n
+		if nil != err {
+			return
+		}
+		b = b[size:]
+	}
+	return
+}
+
+// ReadFrom copies through Write so the body is paced, bypassing sendfile.
+func (w *bandwidthWriter) ReadFrom(src io.Reader) (int64, error) {
+	return copyBuffer(writerOnly{w}, src)
+}
+
+// Flush flushes the response.
+func (w *bandwidthWriter) Flush() {
+	flush(w.ResponseWriter)
+}
@@ -0,0 +1,179 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTenants(t *testing.T) {
+	registry := &testRegistry{values: make(map[string]float64)}
+	tenants := []Tenant{
+		{
+			Name:   "alpha",
+			Prefix: "/alpha",
+			Realm: &AuthRealm{
+				Prefix:      "/alpha",
+				Scheme:      AuthKey,
+				Credentials: map[string]string{"ci": "secret"},
+			},
+		},
+		{
+			Name:    "beta",
+			Prefix:  "/beta",
+			Limiter: NewRateLimiter(1, time.Minute),
+		},
+	}
+	handler := WithTenants(tenants, registry)(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	})
+
+	testCases := []struct {
+		name string
+		path string
+		key  string
+		code int
+	}{
+		{"Outside tenants", "/gamma/file.txt", "", ok},
+		{"Authenticated", "/alpha/file.txt", "secret", ok},
+		{"Unauthenticated", "/alpha/file.txt", "", http.StatusUnauthorized},
+		{"Within limit", "/beta/file.txt", "", ok},
+		{"Beyond limit", "/beta/file.txt", "", http.StatusTooManyRequests},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			if 0 < len(tc.key) {
+				req.Header.Set("X-Access-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if tc.code != w.Code {
+				t.Errorf("Expected status code %d but got %d", tc.code, w.Code)
+			}
+		})
+	}
+
+	expected := map[string]float64{
+		"static_file_server_tenant_requests_total alpha 200": 1,
+		"static_file_server_tenant_requests_total alpha 401": 1,
+		"static_file_server_tenant_requests_total beta 200":  1,
+		"static_file_server_tenant_requests_total beta 429":  1,
+		"static_file_server_tenant_response_bytes_total beta": float64(
+			len("content") + len("429 too many requests\n"),
+		),
+	}
+	for key, value := range expected {
+		if value != registry.values[key] {
+			t.Errorf("Expected %s of %v but got %v", key, value, registry.values[key])
+		}
+	}
+	if 7 >= registry.values["static_file_server_tenant_response_bytes_total alpha"] {
+		t.Errorf("Expected the refused response of alpha to be counted")
+	}
+}
+
+func TestWithBandwidth(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	bandwidth := NewBandwidth(100)
+	bandwidth.now = func() time.Time { return now }
+	bandwidth.sleep = func(ctx context.Context, d time.Duration) error {
+		slept += d
+		now = now.Add(d)
+		return ctx.Err()
+	}
+	body := bytes.Repeat([]byte("x"), 1000)
+	handler := WithBandwidth(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}, bandwidth)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "http://localhost/file.txt", nil))
+	if !bytes.Equal(body, w.Body.Bytes()) {
+		t.Errorf("Expected %d bytes but got %d", len(body), w.Body.Len())
+	}
+	// 100 chunks of 10 bytes, each written 0.1 seconds after the previous.
+	if expected := 9900 * time.Millisecond; expected != slept {
+		t.Errorf("Expected to wait %v but waited %v", expected, slept)
+	}
+
+	// Responses sharing the bandwidth wait for each other.
+	slept = 0
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/file.txt", nil))
+	if expected := 10 * time.Second; expected != slept {
+		t.Errorf("Expected to wait %v but waited %v", expected, slept)
+	}
+
+	// Writing stops once the client goes away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://localhost/file.txt", nil).WithContext(ctx)
+	handler(w, req)
+	if 0 != w.Body.Len() {
+		t.Errorf("Expected nothing written after cancel but got %d bytes", w.Body.Len())
+	}
+}
+
+func TestWithTenantsAccess(t *testing.T) {
+	tenants := []Tenant{{
+		Name:   "sub",
+		Prefix: "/sub",
+		Realm: &AuthRealm{
+			Prefix:      "/sub",
+			Scheme:      AuthKey,
+			Credentials: map[string]string{"ci": "secret"},
+		},
+	}}
+	index := NewSearchIndex(Dir(baseDir))
+	if err := index.Build(context.Background()); nil != err {
+		t.Fatalf("While indexing got %v", err)
+	}
+	search := WithTenants(tenants, nil)(
+		WithSearch(http.NotFound, "/__search", Dir(baseDir), "", false),
+	)
+	indexed := WithTenants(tenants, nil)(
+		WithSearchIndex(http.NotFound, "/__search", index, ""),
+	)
+
+	testCases := []struct {
+		name    string
+		handler http.HandlerFunc
+		query   string
+		key     string
+		within  bool
+	}{
+		{"Anonymous search", search, "q=*.txt", "", false},
+		{"Authenticated search", search, "q=*.txt", "secret", true},
+		{"Anonymous index", indexed, "q=new", "", false},
+		{"Authenticated index", indexed, "q=new", "secret", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost/__search?"+tc.query, nil)
+			if 0 < len(tc.key) {
+				req.Header.Set("X-Access-Key", tc.key)
+			}
+			w := httptest.NewRecorder()
+			tc.handler(w, req)
+
+			var results SearchResults
+			if err := json.NewDecoder(w.Body).Decode(&results); nil != err {
+				t.Fatalf("While decoding got %v", err)
+			}
+			within := false
+			for _, result := range results.Results {
+				within = within || strings.HasPrefix(result.Path, "/sub/")
+			}
+			if tc.within != within {
+				t.Errorf("Expected tenant files listed %t but got %+v", tc.within, results.Results)
+			}
+		})
+	}
+}
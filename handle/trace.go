@@ -0,0 +1,98 @@
+package handle
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TraceHeader is the request header carrying the trace key of WithTrace.
+const TraceHeader = "X-Trace-Key"
+
+// traceKey is the request context key holding the trace of a request.
+type traceKey struct{}
+
+// trace of the steps taken while serving a request.
+type trace struct {
+	mutex   sync.Mutex
+	started time.Time
+	steps   []string
+}
+
+// WithTrace wraps an HTTP request. Requests with the key in TraceHeader are
+// traced, logging each pipeline stage they pass through, the mount override
+// applied, cache decisions and how the URL path was resolved to a file, to
+// help find out why a URL serves the wrong file. The header is removed before
+// the request is passed on, so it is never seen by other stages.
+func WithTrace(serve http.HandlerFunc, key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		supplied := r.Header.Get(TraceHeader)
+		if 0 == len(supplied) {
+			serve(w, r)
+			return
+		}
+		r.Header.Del(TraceHeader)
+		if 1 != subtle.ConstantTimeCompare([]byte(key), []byte(supplied)) {
+			serve(w, r)
+			return
+		}
+
+		for i, step := range TraceRequest(serve, w, r) {
+			log.Printf(
+				"TRACE: %s %s %s%s %d: %s\n",
+				r.Method, r.Proto, r.Host, r.URL.Path, i+1, step,
+			)
+		}
+	}
+}
+
+// TraceRequest serves the request with the handler and returns the steps
+// traced, regardless of TraceHeader, ending with the response status code.
+func TraceRequest(
+	handler http.HandlerFunc, w http.ResponseWriter, r *http.Request,
+) []string {
+	t := &trace{started: time.Now()}
+	r = r.WithContext(context.WithValue(r.Context(), traceKey{}, t))
+	recorder := &statusWriter{ResponseWriter: w}
+	handler(recorder, r)
+	Tracef(r, "responded %d after %v", recorder.Status(), time.Since(t.started))
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.steps...)
+}
+
+// traced returns true if the request is being traced. Arguments passed to
+// Tracef are allocated even when the request is not traced, so handlers on
+// the path of every request check first.
+func traced(r *http.Request) bool {
+	t, _ := r.Context().Value(traceKey{}).(*trace)
+	return nil != t
+}
+
+// Tracef adds a step to the trace of the request, if it is being traced by
+// WithTrace. Custom stages may use it to explain their decisions.
+func Tracef(r *http.Request, format string, args ...interface{}) {
+	t, _ := r.Context().Value(traceKey{}).(*trace)
+	if nil == t {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.steps = append(t.steps, fmt.Sprintf(format, args...))
+}
+
+// traceStage wraps the handler of a pipeline stage, adding the stage to the
+// trace of requests it receives.
+func traceStage(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if traced(r) {
+			Tracef(r, "stage '%s'", name)
+		}
+		handler(w, r)
+	}
+}
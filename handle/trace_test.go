@@ -0,0 +1,98 @@
+package handle
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithTrace(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+
+	var forwarded string
+	pipeline := NewPipeline(
+		Stage{Name: "trace", Middleware: func(serve http.HandlerFunc) http.HandlerFunc {
+			return WithTrace(serve, "secret")
+		}},
+		Stage{Name: "disabled"},
+		Stage{Name: "overrides", Middleware: ByPrefix(nil, []PrefixMiddleware{
+			{Prefix: "/sub", Middleware: testStage("sub")},
+		})},
+		Stage{Name: "header", Middleware: func(serve http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				forwarded = r.Header.Get(TraceHeader)
+				serve(w, r)
+			}
+		}},
+	)
+	handler := pipeline.Then(Basic(FileServer(Dir(baseDir)), ""))
+
+	testCases := []struct {
+		name     string
+		urlPath  string
+		key      string
+		expected []string
+	}{
+		{"Untraced", "/" + tmpFileName, "", nil},
+		{"Wrong key", "/" + tmpFileName, "guess", nil},
+		{"File", "/" + tmpFileName, "secret", []string{
+			"TRACE: GET HTTP/1.1 localhost/file.txt 1: stage 'overrides'",
+			"TRACE: GET HTTP/1.1 localhost/file.txt 2: stage 'header'",
+			"TRACE: GET HTTP/1.1 localhost/file.txt 3: resolved '/file.txt' to '/file.txt'",
+			"TRACE: GET HTTP/1.1 localhost/file.txt 4: serving file '/file.txt'",
+			"TRACE: GET HTTP/1.1 localhost/file.txt 5: responded 200 after ",
+		}},
+		{"Index", "/" + subDir, "secret", []string{
+			"TRACE: GET HTTP/1.1 localhost/sub/ 1: stage 'overrides'",
+			"TRACE: GET HTTP/1.1 localhost/sub/ 2: override of prefix '/sub'",
+			"TRACE: GET HTTP/1.1 localhost/sub/ 3: stage 'header'",
+			"TRACE: GET HTTP/1.1 localhost/sub/ 4: resolved '/sub/' to '/sub/'",
+			"TRACE: GET HTTP/1.1 localhost/sub/ 5: serving file '/sub/index.html'",
+			"TRACE: GET HTTP/1.1 localhost/sub/ 6: responded 200 after ",
+		}},
+		{"Missing", "/missing.txt", "secret", []string{
+			"TRACE: GET HTTP/1.1 localhost/missing.txt 1: stage 'overrides'",
+			"TRACE: GET HTTP/1.1 localhost/missing.txt 2: stage 'header'",
+			"TRACE: GET HTTP/1.1 localhost/missing.txt 3: resolved '/missing.txt' to '/missing.txt'",
+			"TRACE: GET HTTP/1.1 localhost/missing.txt 4: failed to open '/missing.txt': ",
+			"TRACE: GET HTTP/1.1 localhost/missing.txt 5: responded 404 after ",
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest("GET", "http://localhost"+tc.urlPath, nil)
+			if 0 < len(tc.key) {
+				req.Header.Set(TraceHeader, tc.key)
+			}
+			handler(httptest.NewRecorder(), req)
+
+			if 0 < len(forwarded) {
+				t.Errorf("Expected the trace key to be removed but got '%s'", forwarded)
+			}
+			var logged []string
+			if 0 < out.Len() {
+				logged = strings.Split(strings.TrimSpace(out.String()), "\n")
+			}
+			if len(tc.expected) != len(logged) {
+				t.Fatalf("Expected %d trace lines but got %v", len(tc.expected), logged)
+			}
+			for i, expected := range tc.expected {
+				if !strings.HasPrefix(logged[i], expected) {
+					t.Errorf("Expected line %d to start with '%s' but got '%s'", i+1, expected, logged[i])
+				}
+			}
+		})
+	}
+}
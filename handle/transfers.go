@@ -0,0 +1,388 @@
+package handle
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ConnectionRequestBuckets used for the requests served by connections.
+	ConnectionRequestBuckets = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000}
+	// ConnectionDurationBuckets in seconds used for the lifetime of
+	// connections.
+	ConnectionDurationBuckets = []float64{
+		.1, .5, 1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600,
+	}
+)
+
+// TransferLimiter limits the number of simultaneous requests of each client IP
+// address and of each connection, which matters to HTTP/2 where a connection
+// carries many requests at once. Safe for concurrent use.
+type TransferLimiter struct {
+	perIP         int
+	perConnection int
+
+	mutex  sync.Mutex
+	active map[string]int
+}
+
+// NewTransferLimiter returns a limiter allowing each client IP address perIP
+// and each connection perConnection simultaneous requests. A limit of 0
+// disables it.
+func NewTransferLimiter(perIP, perConnection int) *TransferLimiter {
+	return &TransferLimiter{
+		perIP:         perIP,
+		perConnection: perConnection,
+		active:        make(map[string]int),
+	}
+}
+
+// Acquire a transfer for the client IP address and connection, returning
+// false if either is already at its limit. Acquired transfers must be
+// released.
+func (limiter *TransferLimiter) Acquire(ip, connection string) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	ipKey, connectionKey := "ip "+ip, "connection "+connection
+	if (0 < limiter.perIP && limiter.perIP <= limiter.active[ipKey]) ||
+		(0 < limiter.perConnection &&
+			limiter.perConnection <= limiter.active[connectionKey]) {
+		return false
+	}
+	limiter.active[ipKey]++
+	limiter.active[connectionKey]++
+	return true
+}
+
+// Release a transfer acquired for the client IP address and connection.
+func (limiter *TransferLimiter) Release(ip, connection string) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for _, key := range []string{"ip " + ip, "connection " + connection} {
+		if limiter.active[key]--; 0 >= limiter.active[key] {
+			delete(limiter.active, key)
+		}
+	}
+}
+
+// WithTransferLimit wraps an HTTP request. Requests beyond the simultaneous
+// transfers allowed for the client IP address or its connection are refused
+// with 'TOO MANY REQUESTS', so download managers opening many parallel
+// connections cannot starve other clients. Unlike WithRateLimit, finished
+// transfers free their place immediately.
+func WithTransferLimit(
+	serve http.HandlerFunc, limiter *TransferLimiter,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if nil == ip {
+			serve(w, r)
+			return
+		}
+		if !limiter.Acquire(ip.String(), r.RemoteAddr) {
+			log.Printf(
+				"DENY: %s %s %s%s transfer limited%s\n",
+				r.Method,
+				r.Proto,
+				r.Host,
+				r.URL.Path,
+				annotations(r),
+			)
+			http.Error(w, "429 too many requests", http.StatusTooManyRequests)
+			return
+		}
+		defer limiter.Release(ip.String(), r.RemoteAddr)
+		serve(w, r)
+	}
+}
+
+// TransferStats counts open connections, active transfers, the bytes active
+// transfers have yet to send and transfers aborted by the client, to diagnose
+// failing downloads. Open connections are also counted by state (new, active
+// or idle), with the requests each served and how long it was open once
+// closed, to diagnose keep-alive connections exhausted or closed early behind
+// load balancers. Safe for concurrent use.
+type TransferStats struct {
+	connections   int64
+	transfers     int64
+	bytesInFlight int64
+	aborted       int64
+
+	connectionsGauge   Gauge
+	transfersGauge     Gauge
+	bytesInFlightGauge Gauge
+	abortedCounter     Counter
+
+	mutex              sync.Mutex
+	tracked            map[net.Conn]*trackedConnection
+	states             [http.StateIdle + 1]int64
+	statesGauge        Gauge
+	changesCounter     Counter
+	requestsHistogram  Histogram
+	durationsHistogram Histogram
+}
+
+// trackedConnection is an open connection counted by TransferStats.
+type trackedConnection struct {
+	state    http.ConnState
+	opened   time.Time
+	requests int
+}
+
+// TransferSnapshot of TransferStats at a point in time.
+type TransferSnapshot struct {
+	OpenConnections   int64 `json:"open_connections"`
+	NewConnections    int64 `json:"new_connections"`
+	ActiveConnections int64 `json:"active_connections"`
+	IdleConnections   int64 `json:"idle_connections"`
+	ActiveTransfers   int64 `json:"active_transfers"`
+	BytesInFlight     int64 `json:"bytes_in_flight"`
+	Aborted           int64 `json:"aborted_transfers"`
+}
+
+// NewTransferStats returns empty stats.
+func NewTransferStats() *TransferStats {
+	return &TransferStats{tracked: make(map[net.Conn]*trackedConnection)}
+}
+
+// Register the stats as metrics created from the registry. Must be called
+// before the stats are used.
+func (stats *TransferStats) Register(registry MetricsRegistry) {
+	stats.connectionsGauge = registry.Gauge(
+		"static_file_server_connections_open",
+		"Number of open client connections.",
+	)
+	stats.transfersGauge = registry.Gauge(
+		"static_file_server_transfers_active",
+		"Number of responses currently being sent.",
+	)
+	stats.bytesInFlightGauge = registry.Gauge(
+		"static_file_server_transfer_bytes_in_flight",
+		"Number of body bytes active responses have yet to send.",
+	)
+	stats.abortedCounter = registry.Counter(
+		"static_file_server_transfers_aborted_total",
+		"Number of responses aborted by the client disconnecting.",
+	)
+	stats.statesGauge = registry.Gauge(
+		"static_file_server_connections",
+		"Number of open client connections by state.",
+		"state",
+	)
+	stats.changesCounter = registry.Counter(
+		"static_file_server_connection_states_total",
+		"Number of times client connections entered each state.",
+		"state",
+	)
+	stats.requestsHistogram = registry.Histogram(
+		"static_file_server_connection_requests",
+		"Number of requests served by closed client connections.",
+		ConnectionRequestBuckets,
+	)
+	stats.durationsHistogram = registry.Histogram(
+		"static_file_server_connection_duration_seconds",
+		"Duration client connections were open.",
+		ConnectionDurationBuckets,
+	)
+}
+
+// ConnState counts open connections when set as the ConnState hook of an
+// HTTP server, such as with ServerListening.
+func (stats *TransferStats) ConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		stats.add(&stats.connections, stats.connectionsGauge, 1)
+	case http.StateHijacked, http.StateClosed:
+		stats.add(&stats.connections, stats.connectionsGauge, -1)
+	}
+	stats.track(conn, state)
+}
+
+// track the state of the connection. Connections leaving a state are no
+// longer counted in it and closed or hijacked connections record the requests
+// they served (each request making them active) and how long they were open.
+func (stats *TransferStats) track(conn net.Conn, state http.ConnState) {
+	now := time.Now()
+	stats.mutex.Lock()
+	defer stats.mutex.Unlock()
+
+	if nil != stats.changesCounter {
+		stats.changesCounter.Add(1, state.String())
+	}
+	tracked, found := stats.tracked[conn]
+	if found {
+		stats.count(tracked.state, -1)
+	} else {
+		tracked = &trackedConnection{opened: now}
+		stats.tracked[conn] = tracked
+	}
+	tracked.state = state
+	switch state {
+	case http.StateActive:
+		tracked.requests++
+	case http.StateHijacked, http.StateClosed:
+		delete(stats.tracked, conn)
+		if nil != stats.requestsHistogram {
+			stats.requestsHistogram.Observe(float64(tracked.requests))
+			stats.durationsHistogram.Observe(now.Sub(tracked.opened).Seconds())
+		}
+		return
+	}
+	stats.count(state, 1)
+}
+
+// count the delta of connections in the state. The mutex must be held.
+func (stats *TransferStats) count(state http.ConnState, delta int64) {
+	if int(state) < len(stats.states) {
+		stats.states[state] += delta
+		if nil != stats.statesGauge {
+			stats.statesGauge.Add(float64(delta), state.String())
+		}
+	}
+}
+
+// ServerFunc returns a ServerFunc setting ConnState as the hook of the server,
+// calling any hook already set.
+func (stats *TransferStats) ServerFunc() ServerFunc {
+	return func(server *http.Server) {
+		previous := server.ConnState
+		server.ConnState = func(conn net.Conn, state http.ConnState) {
+			stats.ConnState(conn, state)
+			if nil != previous {
+				previous(conn, state)
+			}
+		}
+	}
+}
+
+// Snapshot returns the current stats.
+func (stats *TransferStats) Snapshot() TransferSnapshot {
+	stats.mutex.Lock()
+	states := stats.states
+	stats.mutex.Unlock()
+	return TransferSnapshot{
+		OpenConnections:   atomic.LoadInt64(&stats.connections),
+		NewConnections:    states[http.StateNew],
+		ActiveConnections: states[http.StateActive],
+		IdleConnections:   states[http.StateIdle],
+		ActiveTransfers:   atomic.LoadInt64(&stats.transfers),
+		BytesInFlight:     atomic.LoadInt64(&stats.bytesInFlight),
+		Aborted:           atomic.LoadInt64(&stats.aborted),
+	}
+}
+
+// Handler returns a handler serving the Snapshot as JSON.
+func (stats *TransferStats) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats.Snapshot())
+	}
+}
+
+// add the delta to the value and the gauge, if any.
+func (stats *TransferStats) add(value *int64, gauge Gauge, delta int64) {
+	atomic.AddInt64(value, delta)
+	if nil != gauge {
+		gauge.Add(float64(delta))
+	}
+}
+
+// WithTransferStats wraps an HTTP request. The response is counted as an
+// active transfer while it is sent, its remaining 'Content-Length' is counted
+// as bytes in flight and it is counted as aborted if the client disconnects or
+// writing fails before it is complete.
+func WithTransferStats(serve http.HandlerFunc, stats *TransferStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats.add(&stats.transfers, stats.transfersGauge, 1)
+		recorder := &transferWriter{ResponseWriter: w, stats: stats}
+
+		serve(recorder, r)
+
+		if 0 < recorder.remaining {
+			stats.add(&stats.bytesInFlight, stats.bytesInFlightGauge, -recorder.remaining)
+		}
+		if recorder.failed || nil != r.Context().Err() {
+			atomic.AddInt64(&stats.aborted, 1)
+			if nil != stats.abortedCounter {
+				stats.abortedCounter.Add(1)
+			}
+		}
+		stats.add(&stats.transfers, stats.transfersGauge, -1)
+	}
+}
+
+// transferWriter passes the response through while counting the bytes of the
+// declared 'Content-Length' not yet written as bytes in flight.
+type transferWriter struct {
+	http.ResponseWriter
+	stats     *TransferStats
+	started   bool
+	remaining int64
+	failed    bool
+}
+
+// WriteHeader starts counting the bytes in flight.
+func (w *transferWriter) WriteHeader(code int) {
+	w.start()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write counts the bytes written and any failure.
+func (w *transferWriter) Write(b []byte) (int, error) {
+	w.start()
+	n, err := w.ResponseWriter.Write(b)
+	w.sent(int64(n), err)
+	return n, err
+}
+
+// ReadFrom counts the bytes copied from the reader and any failure.
+func (w *transferWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.start()
+	n, err := readFrom(w.ResponseWriter, src)
+	w.sent(n, err)
+	return n, err
+}
+
+// Flush starts counting the bytes in flight and flushes the response.
+func (w *transferWriter) Flush() {
+	w.start()
+	flush(w.ResponseWriter)
+}
+
+// sent removes the bytes written from the bytes in flight, recording whether
+// writing failed.
+func (w *transferWriter) sent(n int64, err error) {
+	if nil != err {
+		w.failed = true
+	}
+	if 0 < w.remaining {
+		if n > w.remaining {
+			n = w.remaining
+		}
+		w.remaining -= n
+		w.stats.add(&w.stats.bytesInFlight, w.stats.bytesInFlightGauge, -n)
+	}
+}
+
+// start counting the declared length of the response once its headers are
+// final.
+func (w *transferWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	length, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+	if nil == err && 0 < length {
+		w.remaining = length
+		w.stats.add(&w.stats.bytesInFlight, w.stats.bytesInFlightGauge, length)
+	}
+}
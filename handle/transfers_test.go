@@ -0,0 +1,134 @@
+package handle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithTransferLimit(t *testing.T) {
+	limiter := NewTransferLimiter(2, 1)
+
+	// Requests made while the first is being served are simultaneous.
+	var codes []int
+	var handler http.HandlerFunc
+	request := func(remoteAddr, path string) int {
+		req := httptest.NewRequest("GET", "http://localhost"+path, nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+	handler = WithTransferLimit(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/first":
+			codes = append(codes, request("10.0.0.1:1000", "/same-connection"))
+			codes = append(codes, request("10.0.0.1:1001", "/second-connection"))
+		case "/second-connection":
+			codes = append(codes, request("10.0.0.1:1002", "/third-connection"))
+			codes = append(codes, request("10.0.0.2:1000", "/other-client"))
+		}
+	}, limiter)
+
+	if code := request("10.0.0.1:1000", "/first"); ok != code {
+		t.Errorf("Expected status code %d but got %d", ok, code)
+	}
+	expected := []int{
+		http.StatusTooManyRequests, http.StatusTooManyRequests, ok, ok,
+	}
+	for i, code := range expected {
+		if code != codes[i] {
+			t.Errorf("For request %d expected status code %d but got %d", i, code, codes[i])
+		}
+	}
+	if code := request("10.0.0.1:1000", "/after"); ok != code {
+		t.Errorf("After transfers finish expected status code %d but got %d", ok, code)
+	}
+	if 0 != len(limiter.active) {
+		t.Errorf("Expected transfers to be released but got %v", limiter.active)
+	}
+}
+
+func TestWithTransferStats(t *testing.T) {
+	stats := NewTransferStats()
+	var during TransferSnapshot
+	handler := WithTransferStats(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("part"))
+		during = stats.Snapshot()
+	}, stats)
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/file.txt", nil))
+	if expected := (TransferSnapshot{ActiveTransfers: 1, BytesInFlight: 6}); expected != during {
+		t.Errorf("While sending expected %+v but got %+v", expected, during)
+	}
+	if expected := (TransferSnapshot{}); expected != stats.Snapshot() {
+		t.Errorf("After sending expected %+v but got %+v", expected, stats.Snapshot())
+	}
+
+	// Clients disconnecting cancel the request context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/file.txt", nil).WithContext(ctx)
+	handler(httptest.NewRecorder(), req)
+	if 1 != stats.Snapshot().Aborted {
+		t.Errorf("Expected an aborted transfer but got %+v", stats.Snapshot())
+	}
+
+	server := &http.Server{}
+	stats.ServerFunc()(server)
+	server.ConnState(nil, http.StateNew)
+	server.ConnState(nil, http.StateNew)
+	server.ConnState(nil, http.StateClosed)
+	if 1 != stats.Snapshot().OpenConnections {
+		t.Errorf("Expected an open connection but got %+v", stats.Snapshot())
+	}
+}
+
+func TestTransferStatsConnections(t *testing.T) {
+	registry := &testRegistry{values: make(map[string]float64)}
+	stats := NewTransferStats()
+	stats.Register(registry)
+	first, second := net.Pipe()
+	defer first.Close()
+	defer second.Close()
+
+	// The first connection serves two requests and is closed, the second is
+	// left idle after its request.
+	for _, change := range []struct {
+		conn  net.Conn
+		state http.ConnState
+	}{
+		{first, http.StateNew},
+		{second, http.StateNew},
+		{first, http.StateActive},
+		{first, http.StateIdle},
+		{second, http.StateActive},
+		{first, http.StateActive},
+		{second, http.StateIdle},
+		{first, http.StateIdle},
+		{first, http.StateClosed},
+	} {
+		stats.ConnState(change.conn, change.state)
+	}
+
+	expected := TransferSnapshot{OpenConnections: 1, IdleConnections: 1}
+	if actual := stats.Snapshot(); expected != actual {
+		t.Errorf("Expected %+v but got %+v", expected, actual)
+	}
+	for key, value := range map[string]float64{
+		"static_file_server_connections new":                   0,
+		"static_file_server_connections active":                0,
+		"static_file_server_connections idle":                  1,
+		"static_file_server_connection_states_total active":    3,
+		"static_file_server_connection_states_total closed":    1,
+		"static_file_server_connection_requests count":         1,
+		"static_file_server_connection_duration_seconds count": 1,
+	} {
+		if value != registry.values[key] {
+			t.Errorf("Expected %v for '%s' but got %v", value, key, registry.values[key])
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package handle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxUsageHosts limits the hosts accounted separately, as the host is chosen
+// by clients. Requests for further hosts are accounted as 'other'.
+const maxUsageHosts = 1024
+
+// UsageRecord of the requests and body bytes served for a host and URL path
+// prefix.
+type UsageRecord struct {
+	Host     string `json:"host"`
+	Prefix   string `json:"prefix"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// UsageReport of the records accounted since a time.
+type UsageReport struct {
+	Since   time.Time     `json:"since"`
+	Records []UsageRecord `json:"records"`
+}
+
+// usageKey identifies the record of a host and prefix.
+type usageKey struct {
+	host, prefix string
+}
+
+// Usage accumulates the requests and body bytes served for each host and the
+// longest of its prefixes containing the request path, or '/' if there is
+// none, so usage can be charged back without parsing access logs. Safe for
+// concurrent use.
+type Usage struct {
+	prefixes []string
+
+	mutex    sync.Mutex
+	since    time.Time
+	totals   map[usageKey]*UsageRecord
+	hosts    map[string]struct{}
+	reported time.Time
+	previous map[usageKey]UsageRecord
+	filename string
+}
+
+// NewUsage returns usage accounted by the prefixes.
+func NewUsage(prefixes []string) *Usage {
+	now := time.Now()
+	return &Usage{
+		prefixes: prefixes,
+		since:    now,
+		totals:   make(map[usageKey]*UsageRecord),
+		hosts:    make(map[string]struct{}),
+		reported: now,
+		previous: make(map[usageKey]UsageRecord),
+	}
+}
+
+// Persist the usage to the state file by Save. Usage in the file is loaded,
+// so totals continue across restarts.
+func (usage *Usage) Persist(filename string) error {
+	var report UsageReport
+	if contents, err := ioutil.ReadFile(filename); nil == err {
+		if err = json.Unmarshal(contents, &report); nil != err {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+	if !report.Since.IsZero() && report.Since.Before(usage.since) {
+		usage.since = report.Since
+	}
+	for _, loaded := range report.Records {
+		record := usage.record(loaded.Host, loaded.Prefix)
+		record.Requests += loaded.Requests
+		record.Bytes += loaded.Bytes
+		usage.previous[usageKey{record.Host, record.Prefix}] = *record
+	}
+	usage.filename = filename
+	return nil
+}
+
+// Save the usage to the state file, if there is one, replacing it only once
+// completely written.
+func (usage *Usage) Save() error {
+	usage.mutex.Lock()
+	filename := usage.filename
+	usage.mutex.Unlock()
+	if 0 == len(filename) {
+		return nil
+	}
+	contents, err := json.Marshal(usage.Report())
+	if nil != err {
+		return err
+	}
+	temporary := filename + ".tmp"
+	if err = ioutil.WriteFile(temporary, contents, 0600); nil == err {
+		err = os.Rename(temporary, filename)
+	}
+	if nil != err {
+		os.Remove(temporary)
+	}
+	return err
+}
+
+// Report returns the records accounted so far, sorted by host and prefix.
+func (usage *Usage) Report() UsageReport {
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+	report := UsageReport{
+		Since:   usage.since,
+		Records: make([]UsageRecord, 0, len(usage.totals)),
+	}
+	for _, record := range usage.totals {
+		report.Records = append(report.Records, *record)
+	}
+	sortUsage(report.Records)
+	return report
+}
+
+// Log the usage accounted since the previous call, one line for each host
+// and prefix with requests.
+func (usage *Usage) Log() {
+	usage.mutex.Lock()
+	now := time.Now()
+	period := now.Sub(usage.reported).Round(time.Second)
+	var records []UsageRecord
+	for key, record := range usage.totals {
+		previous := usage.previous[key]
+		if record.Requests == previous.Requests {
+			continue
+		}
+		records = append(records, UsageRecord{
+			Host:     record.Host,
+			Prefix:   record.Prefix,
+			Requests: record.Requests - previous.Requests,
+			Bytes:    record.Bytes - previous.Bytes,
+		})
+		usage.previous[key] = *record
+	}
+	usage.reported = now
+	usage.mutex.Unlock()
+
+	sortUsage(records)
+	for _, record := range records {
+		log.Printf(
+			"Usage of %s%s in the last %v: %d requests, %d bytes\n",
+			record.Host, record.Prefix, period, record.Requests, record.Bytes,
+		)
+	}
+}
+
+// Handler serves the report of the usage as JSON.
+func (usage *Usage) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(usage.Report())
+	}
+}
+
+// add a request and its body bytes to the usage of the host and path.
+func (usage *Usage) add(host, urlPath string, bytes int64) {
+	prefix := "/"
+	for _, candidate := range usage.prefixes {
+		if withinPrefix(urlPath, candidate) && len(prefix) < len(candidate) {
+			prefix = candidate
+		}
+	}
+
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+	record := usage.record(host, prefix)
+	record.Requests++
+	record.Bytes += bytes
+}
+
+// record returns the record of the host and prefix, creating it if needed.
+// Must be called with the mutex held.
+func (usage *Usage) record(host, prefix string) *UsageRecord {
+	if _, found := usage.hosts[host]; !found {
+		if maxUsageHosts <= len(usage.hosts) {
+			host = "other"
+		}
+		usage.hosts[host] = struct{}{}
+	}
+	key := usageKey{host, prefix}
+	record, found := usage.totals[key]
+	if !found {
+		record = &UsageRecord{Host: host, Prefix: prefix}
+		usage.totals[key] = record
+	}
+	return record
+}
+
+// sortUsage sorts the records by host and prefix.
+func sortUsage(records []UsageRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Host != records[j].Host {
+			return records[i].Host < records[j].Host
+		}
+		return records[i].Prefix < records[j].Prefix
+	})
+}
+
+// WithUsage wraps an HTTP request, accounting it and its body bytes to the
+// host, without port, and the prefix of its path.
+func WithUsage(serve http.HandlerFunc, usage *Usage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := newStatusWriter(w)
+		serve(recorder, r)
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); nil == err {
+			host = hostname
+		}
+		usage.add(strings.ToLower(host), r.URL.Path, recorder.bytes)
+		recorder.release()
+	}
+}
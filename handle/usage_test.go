@@ -0,0 +1,123 @@
+package handle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithUsage(t *testing.T) {
+	usage := NewUsage([]string{"/team", "/team/ci"})
+	handler := WithUsage(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}, usage)
+
+	requests := []string{
+		"http://Example.com:8080/team/file.txt",
+		"http://example.com/team/ci/build.zip",
+		"http://example.com/team/ci/log.txt",
+		"http://example.com/teams/file.txt",
+		"http://other.example.com/index.html",
+	}
+	for _, request := range requests {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", request, nil))
+	}
+
+	expected := []UsageRecord{
+		{"example.com", "/", 1, 7},
+		{"example.com", "/team", 1, 7},
+		{"example.com", "/team/ci", 2, 14},
+		{"other.example.com", "/", 1, 7},
+	}
+	if records := usage.Report().Records; !reflect.DeepEqual(expected, records) {
+		t.Errorf("Expected records %v but got %v", expected, records)
+	}
+}
+
+func TestUsageHosts(t *testing.T) {
+	usage := NewUsage(nil)
+	for i := 0; i < maxUsageHosts+2; i++ {
+		usage.add(strings.Repeat("h", i+1), "/", 1)
+	}
+	records := usage.Report().Records
+	if maxUsageHosts+1 != len(records) {
+		t.Fatalf("Expected %d records but got %d", maxUsageHosts+1, len(records))
+	}
+	if other := records[len(records)-1]; "other" != other.Host || 2 != other.Requests {
+		t.Errorf("Expected 2 requests of 'other' but got %v", other)
+	}
+}
+
+func TestUsagePersist(t *testing.T) {
+	folder, err := ioutil.TempDir("", "usage")
+	if nil != err {
+		t.Fatalf("While creating a folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	filename := filepath.Join(folder, "usage.json")
+
+	usage := NewUsage(nil)
+	if err = usage.Persist(filename); nil != err {
+		t.Fatalf("While loading a missing state file got %v", err)
+	}
+	usage.add("example.com", "/file.txt", 100)
+	if err = usage.Save(); nil != err {
+		t.Fatalf("While saving got %v", err)
+	}
+
+	restarted := NewUsage(nil)
+	if err = restarted.Persist(filename); nil != err {
+		t.Fatalf("While loading got %v", err)
+	}
+	restarted.add("example.com", "/file.txt", 50)
+	report := restarted.Report()
+	expected := []UsageRecord{{"example.com", "/", 2, 150}}
+	if !reflect.DeepEqual(expected, report.Records) {
+		t.Errorf("Expected records %v but got %v", expected, report.Records)
+	}
+	if !report.Since.Equal(usage.Report().Since) {
+		t.Errorf("Expected usage since %v but got %v", usage.Report().Since, report.Since)
+	}
+
+	if err = ioutil.WriteFile(filename, []byte("{"), 0600); nil != err {
+		t.Fatalf("While damaging the state file got %v", err)
+	}
+	if err = NewUsage(nil).Persist(filename); nil == err {
+		t.Error("Expected an error for a damaged state file but got none")
+	}
+}
+
+func TestUsageLog(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}()
+
+	usage := NewUsage(nil)
+	usage.add("example.com", "/file.txt", 100)
+	usage.add("example.com", "/file.txt", 100)
+	usage.Log()
+	if expected := "Usage of example.com/ in the last 0s: 2 requests, 200 bytes\n"; expected != out.String() {
+		t.Errorf("Expected log '%s' but got '%s'", expected, out.String())
+	}
+
+	// Only usage since the previous report is logged.
+	out.Reset()
+	usage.Log()
+	usage.add("example.com", "/file.txt", 10)
+	usage.Log()
+	if expected := "Usage of example.com/ in the last 0s: 1 requests, 10 bytes\n"; expected != out.String() {
+		t.Errorf("Expected log '%s' but got '%s'", expected, out.String())
+	}
+}
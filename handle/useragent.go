@@ -0,0 +1,111 @@
+package handle
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// UserAgentRule matches the User-Agent header of requests for paths beginning
+// with Prefix.
+type UserAgentRule struct {
+	Prefix  string
+	Pattern *regexp.Regexp
+}
+
+// ParseUserAgentRule converts a rule in the form '[/path/prefix=]pattern' into
+// a UserAgentRule, where pattern is a regular expression. If no prefix is
+// provided then the rule applies to all paths.
+func ParseUserAgentRule(rule string) (parsed UserAgentRule, err error) {
+	parsed.Prefix = "/"
+	expr := rule
+	if strings.HasPrefix(rule, "/") {
+		if index := strings.Index(rule, "="); 0 < index {
+			parsed.Prefix = rule[:index]
+			expr = rule[index+1:]
+		}
+	}
+	if parsed.Pattern, err = regexp.Compile(expr); nil != err {
+		err = fmt.Errorf("invalid User-Agent rule '%s': %v", rule, err)
+	}
+	return
+}
+
+// ParseUserAgentRules converts each rule using ParseUserAgentRule.
+func ParseUserAgentRules(rules []string) ([]UserAgentRule, error) {
+	parsed := make([]UserAgentRule, 0, len(rules))
+	for _, rule := range rules {
+		result, err := ParseUserAgentRule(rule)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// String representation of the rule in the form accepted by
+// ParseUserAgentRule.
+func (rule UserAgentRule) String() string {
+	return fmt.Sprintf("%s=%s", rule.Prefix, rule.Pattern)
+}
+
+// WithUserAgent wraps an HTTP request. Requests with a User-Agent matching an
+// applicable deny rule are refused. If any allow rules apply to the requested
+// path then the User-Agent must match at least one of them. Refused requests
+// return 'FORBIDDEN' and are logged. The deciding rule is added to the access
+// log.
+func WithUserAgent(
+	serve http.HandlerFunc, allow, deny []UserAgentRule,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent := r.UserAgent()
+		for _, rule := range deny {
+			if rule.applies(r.URL.Path) && rule.Pattern.MatchString(agent) {
+				audit(r, AuditEvent{Event: AuditUserAgentDeny, Rule: rule.String()})
+				refuseUserAgent(w, r, "denied by "+rule.String())
+				return
+			}
+		}
+
+		applicable := false
+		for _, rule := range allow {
+			if !rule.applies(r.URL.Path) {
+				continue
+			}
+			if rule.Pattern.MatchString(agent) {
+				serve(w, annotate(r, "user-agent-rule", rule.String()))
+				return
+			}
+			applicable = true
+		}
+		if applicable {
+			audit(r, AuditEvent{Event: AuditUserAgentDeny})
+			refuseUserAgent(w, r, "not allowed")
+			return
+		}
+		serve(w, r)
+	}
+}
+
+// applies returns true if the rule covers the passed path.
+func (rule UserAgentRule) applies(path string) bool {
+	return strings.HasPrefix(path, rule.Prefix)
+}
+
+// refuseUserAgent logs and returns 'FORBIDDEN' for the request.
+func refuseUserAgent(w http.ResponseWriter, r *http.Request, reason string) {
+	log.Printf(
+		"DENY: %s %s %s%s user-agent '%s' %s%s\n",
+		r.Method,
+		r.Proto,
+		r.Host,
+		r.URL.Path,
+		r.UserAgent(),
+		reason,
+		annotations(r),
+	)
+	http.Error(w, "403 forbidden", http.StatusForbidden)
+}
@@ -0,0 +1,102 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseUserAgentRule(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    string
+		prefix  string
+		pattern string
+		isError bool
+	}{
+		{"Pattern only", "(?i)bot", "/", "(?i)bot", false},
+		{"Prefix and pattern", "/internal=^tool/", "/internal", "^tool/", false},
+		{"Pattern with equals", "a=b", "/", "a=b", false},
+		{"Prefix without equals", "/abc", "/", "/abc", false},
+		{"Empty pattern", "/internal=", "/internal", "", false},
+		{"Bad pattern", "/internal=(", "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseUserAgentRule(tc.rule)
+			if tc.isError {
+				if nil == err {
+					t.Errorf("For '%s' expected an error but got nil", tc.rule)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("For '%s' expected no error but got %v", tc.rule, err)
+			}
+			if tc.prefix != rule.Prefix {
+				t.Errorf(
+					"For '%s' expected prefix '%s' but got '%s'",
+					tc.rule, tc.prefix, rule.Prefix,
+				)
+			}
+			if tc.pattern != rule.Pattern.String() {
+				t.Errorf(
+					"For '%s' expected pattern '%s' but got '%s'",
+					tc.rule, tc.pattern, rule.Pattern,
+				)
+			}
+		})
+	}
+
+	if _, err := ParseUserAgentRules([]string{"ok", "("}); nil == err {
+		t.Error("For a list with a bad rule expected an error but got nil")
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	allow, err := ParseUserAgentRules([]string{"/internal/=^deploy-tool/"})
+	if nil != err {
+		t.Fatalf("While parsing allow rules got %v", err)
+	}
+	deny, err := ParseUserAgentRules([]string{"(?i)scrapy", "/private/=curl"})
+	if nil != err {
+		t.Fatalf("While parsing deny rules got %v", err)
+	}
+	handler := WithUserAgent(
+		func(w http.ResponseWriter, r *http.Request) {}, allow, deny,
+	)
+
+	forbidden := http.StatusForbidden
+	testCases := []struct {
+		name  string
+		path  string
+		agent string
+		code  int
+	}{
+		{"Browser", "/file.txt", "Mozilla/5.0", ok},
+		{"Scraper", "/file.txt", "Scrapy/2.0", forbidden},
+		{"Curl outside private", "/file.txt", "curl/7.0", ok},
+		{"Curl on private", "/private/file.txt", "curl/7.0", forbidden},
+		{"Tool on internal", "/internal/file.txt", "deploy-tool/1.0", ok},
+		{"Browser on internal", "/internal/file.txt", "Mozilla/5.0", forbidden},
+		{"Empty on internal", "/internal/file.txt", "", forbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			req.Header.Set("User-Agent", tc.agent)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Errorf(
+					"For %s with '%s' expected status code of %d but got %d",
+					tc.path, tc.agent, tc.code, w.Code,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package handle
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AddVary adds the request header fields to the 'Vary' header, keeping each
+// field once and collapsing to '*' if any field is '*'. Features negotiating
+// the response from request headers, such as 'Accept-Encoding',
+// 'Accept-Language' or 'Accept', must add the fields to every response they
+// negotiate, including responses where the default representation is chosen,
+// so caches never replay one client's variant to another.
+func AddVary(header http.Header, fields ...string) {
+	existing := varyFields(header)
+	for _, field := range fields {
+		field = http.CanonicalHeaderKey(strings.TrimSpace(field))
+		if 0 == len(field) || containsString(existing, field) {
+			continue
+		}
+		existing = append(existing, field)
+	}
+	if 0 == len(existing) {
+		return
+	}
+	if containsString(existing, "*") {
+		existing = []string{"*"}
+	}
+	header.Set("Vary", strings.Join(existing, ", "))
+}
+
+// WithVary wraps an HTTP request, adding the request header fields to the
+// 'Vary' header of every response. Useful ahead of handlers that negotiate
+// responses without calling AddVary.
+func WithVary(serve http.HandlerFunc, fields ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		AddVary(w.Header(), fields...)
+		serve(w, r)
+	}
+}
+
+// varyFields returns the canonical fields of all 'Vary' headers.
+func varyFields(header http.Header) []string {
+	var fields []string
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = http.CanonicalHeaderKey(strings.TrimSpace(field))
+			if 0 < len(field) && !containsString(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,82 @@
+package handle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddVary(t *testing.T) {
+	testCases := []struct {
+		name     string
+		existing []string
+		fields   []string
+		expected string
+	}{
+		{"Empty", nil, nil, ""},
+		{"Single", nil, []string{"accept-encoding"}, "Accept-Encoding"},
+		{"Merged", []string{"Accept-Encoding"}, []string{"Accept-Language", "Accept"}, "Accept-Encoding, Accept-Language, Accept"},
+		{"Duplicate", []string{"Accept-Encoding, Accept", "accept"}, []string{"ACCEPT-ENCODING"}, "Accept-Encoding, Accept"},
+		{"Wildcard", []string{"Accept"}, []string{"*"}, "*"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range tc.existing {
+				header.Add("Vary", value)
+			}
+			AddVary(header, tc.fields...)
+			if result := header.Get("Vary"); tc.expected != result {
+				t.Errorf("Expected Vary '%s' but got '%s'", tc.expected, result)
+			}
+			if 1 < len(header.Values("Vary")) {
+				t.Errorf("Expected a single Vary header but got %v", header.Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestWithCacheVary(t *testing.T) {
+	calls := 0
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		AddVary(w.Header(), "Accept-Language")
+		if "/any" == r.URL.Path {
+			AddVary(w.Header(), "*")
+		}
+		w.Write([]byte("contents in " + r.Header.Get("Accept-Language")))
+	}
+	handler := WithVary(WithCache(serve, CacheConfig{
+		MaxSize: 1024, MaxEntrySize: 1024,
+	}), "Accept-Encoding")
+
+	testCases := []struct {
+		path     string
+		language string
+		calls    int
+		body     string
+	}{
+		{"/file.txt", "en", 1, "contents in en"},
+		{"/file.txt", "en", 1, "contents in en"},
+		{"/file.txt", "de", 2, "contents in de"},
+		{"/file.txt", "de", 2, "contents in de"},
+		{"/any", "en", 3, "contents in en"},
+		{"/any", "en", 4, "contents in en"},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+		req.Header.Set("Accept-Language", tc.language)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if tc.calls != calls || tc.body != w.Body.String() {
+			t.Errorf(
+				"For %s in %s expected %d calls and '%s' but got %d and '%s'",
+				tc.path, tc.language, tc.calls, tc.body, calls, w.Body.String(),
+			)
+		}
+		if tc.path != "/any" && "Accept-Encoding, Accept-Language" != w.Header().Get("Vary") {
+			t.Errorf("For %s expected Vary of both fields but got '%s'", tc.path, w.Header().Get("Vary"))
+		}
+	}
+}
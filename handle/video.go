@@ -0,0 +1,214 @@
+package handle
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// videoTypes are registered for extensions missing from the MIME database of
+// the system, so players are sent the type they expect rather than one sniffed
+// from the first bytes.
+var videoTypes = map[string]string{
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".ogv":  "video/ogg",
+	".webm": "video/webm",
+}
+
+func init() {
+	for ext, videoType := range videoTypes {
+		if "" == mime.TypeByExtension(ext) {
+			mime.AddExtensionType(ext, videoType)
+		}
+	}
+}
+
+// VideoConfig controls the delivery of videos by WithVideo.
+type VideoConfig struct {
+	// Rate in bytes per second of each video stream after the Burst. If zero,
+	// streams are not throttled.
+	Rate int64
+
+	// Burst of bytes sent at full speed at the start of each stream, so
+	// playback starts quickly, before it is throttled to the Rate.
+	Burst int64
+
+	// Stats, if set, are updated as videos are streamed.
+	Stats *VideoStats
+}
+
+// VideoStats counts the streams started, the streams starting past the
+// beginning, such as when players seek, and the bytes sent of each video, and
+// the streams being sent. Safe for concurrent use.
+type VideoStats struct {
+	active int64
+
+	activeGauge  Gauge
+	streams      Counter
+	seeks        Counter
+	bytesWritten Counter
+}
+
+// NewVideoStats returns stats recorded in metrics created from the registry,
+// labelled by the URL path of each video.
+func NewVideoStats(registry MetricsRegistry) *VideoStats {
+	return &VideoStats{
+		activeGauge: registry.Gauge(
+			"static_file_server_video_streams_active",
+			"Number of video streams being sent.",
+		),
+		streams: registry.Counter(
+			"static_file_server_video_streams_total",
+			"Number of video streams started.",
+			"path",
+		),
+		seeks: registry.Counter(
+			"static_file_server_video_seeks_total",
+			"Number of video streams requesting a range after the start.",
+			"path",
+		),
+		bytesWritten: registry.Counter(
+			"static_file_server_video_bytes_total",
+			"Number of video bytes sent.",
+			"path",
+		),
+	}
+}
+
+// Active returns the number of video streams being sent.
+func (stats *VideoStats) Active() int64 {
+	return atomic.LoadInt64(&stats.active)
+}
+
+// WithVideo wraps an HTTP request. Successful GET responses for videos, files
+// with a 'video/' MIME type, are sent at full speed for the first Burst bytes
+// and then throttled to the Rate, so players buffer enough to start quickly
+// without clients downloading whole videos they may not watch. Writing stops
+// early if the client goes away. Ranges are served by the later stages as for
+// other files, so each seek starts a new stream with its own burst.
+func WithVideo(serve http.HandlerFunc, config VideoConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if http.MethodGet != r.Method ||
+			!strings.HasPrefix(mime.TypeByExtension(path.Ext(r.URL.Path)), "video/") {
+			serve(w, r)
+			return
+		}
+		writer := &videoWriter{
+			ResponseWriter: w,
+			r:              r,
+			config:         config,
+			burst:          config.Burst,
+		}
+		serve(writer, r)
+		if writer.streaming && nil != config.Stats {
+			config.Stats.activeGauge.Add(-1)
+			atomic.AddInt64(&config.Stats.active, -1)
+		}
+	}
+}
+
+// videoWriter counts and paces the body of a video stream.
+type videoWriter struct {
+	http.ResponseWriter
+	r         *http.Request
+	config    VideoConfig
+	burst     int64
+	written   bool
+	streaming bool
+	paced     *bandwidthWriter
+}
+
+// WriteHeader starts a stream for successful responses.
+func (w *videoWriter) WriteHeader(code int) {
+	if w.written {
+		return
+	}
+	w.written = true
+	if http.StatusOK == code || http.StatusPartialContent == code {
+		w.streaming = true
+		if 0 < w.config.Rate {
+			w.paced = &bandwidthWriter{
+				ResponseWriter: w.ResponseWriter,
+				bandwidth:      NewBandwidth(w.config.Rate),
+				ctx:            w.r.Context(),
+			}
+		}
+		if stats := w.config.Stats; nil != stats {
+			atomic.AddInt64(&stats.active, 1)
+			stats.activeGauge.Add(1)
+			stats.streams.Add(1, w.r.URL.Path)
+			contentRange := w.Header().Get("Content-Range")
+			if http.StatusPartialContent == code &&
+				!strings.HasPrefix(contentRange, "bytes 0-") {
+				stats.seeks.Add(1, w.r.URL.Path)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write the burst at full speed and the rest paced to the rate.
+func (w *videoWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if nil == w.paced {
+		n, err := w.ResponseWriter.Write(b)
+		w.count(int64(n))
+		return n, err
+	}
+	written := 0
+	if 0 < w.burst {
+		size := int64(len(b))
+		if w.burst < size {
+			size = w.burst
+		}
+		n, err := w.ResponseWriter.Write(b[:size])
+		w.burst -= int64(n)
+		w.count(int64(n))
+		written += n
+		if nil != err {
+			return written, err
+		}
+		b = b[size:]
+		if 0 < len(b) {
+			Tracef(w.r, "video burst sent, throttling to %d bytes per second", w.config.Rate)
+		}
+	}
+	n, err := w.paced.Write(b)
+	w.count(int64(n))
+	return written + n, err
+}
+
+// ReadFrom copies through Write when the stream is paced, bypassing sendfile.
+func (w *videoWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if nil != w.paced {
+		return copyBuffer(writerOnly{w}, src)
+	}
+	n, err := readFrom(w.ResponseWriter, src)
+	w.count(n)
+	return n, err
+}
+
+// Flush flushes the response.
+func (w *videoWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	flush(w.ResponseWriter)
+}
+
+// count the bytes sent of a stream.
+func (w *videoWriter) count(n int64) {
+	if w.streaming && nil != w.config.Stats {
+		w.config.Stats.bytesWritten.Add(float64(n), w.r.URL.Path)
+	}
+}
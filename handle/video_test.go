@@ -0,0 +1,126 @@
+package handle
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithVideo(t *testing.T) {
+	video := bytes.Repeat([]byte("0123456789"), 1000)
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(video))
+	}
+	registry := &testRegistry{values: make(map[string]float64)}
+	stats := NewVideoStats(registry)
+	handler := WithVideo(serve, VideoConfig{Stats: stats})
+
+	testCases := []struct {
+		name         string
+		path         string
+		header       http.Header
+		code         int
+		contentRange string
+		contents     []byte
+	}{
+		{"Whole", "/movie.mp4", nil, ok, "", video},
+		{"Range", "/movie.mp4", http.Header{"Range": {"bytes=100-199"}},
+			http.StatusPartialContent, "bytes 100-199/10000", video[100:200]},
+		{"Open range", "/movie.webm", http.Header{"Range": {"bytes=9900-"}},
+			http.StatusPartialContent, "bytes 9900-9999/10000", video[9900:]},
+		{"Suffix range", "/movie.mp4", http.Header{"Range": {"bytes=-100"}},
+			http.StatusPartialContent, "bytes 9900-9999/10000", video[9900:]},
+		{"Start range", "/movie.mp4", http.Header{"Range": {"bytes=0-99"}},
+			http.StatusPartialContent, "bytes 0-99/10000", video[:100]},
+		{"Unsatisfiable", "/movie.mp4", http.Header{"Range": {"bytes=20000-"}},
+			http.StatusRequestedRangeNotSatisfiable, "bytes */10000", nil},
+		{"Stale If-Range", "/movie.mp4",
+			http.Header{"Range": {"bytes=100-199"}, "If-Range": {`"v0"`}}, ok, "", video},
+		{"Matching If-Range", "/movie.mp4",
+			http.Header{"Range": {"bytes=100-199"}, "If-Range": {`"v1"`}},
+			http.StatusPartialContent, "bytes 100-199/10000", video[100:200]},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Fatalf("For %s expected status code %d but got %d", tc.name, tc.code, w.Code)
+			}
+			if contentRange := w.Header().Get("Content-Range"); tc.contentRange != contentRange {
+				t.Errorf("For %s expected range '%s' but got '%s'", tc.name, tc.contentRange, contentRange)
+			}
+			if "bytes" != w.Header().Get("Accept-Ranges") && ok == tc.code {
+				t.Errorf("For %s expected 'Accept-Ranges: bytes'", tc.name)
+			}
+			if ctype := w.Header().Get("Content-Type"); nil != tc.contents &&
+				!strings.HasPrefix(ctype, "video/") {
+				t.Errorf("For %s expected a video type but got '%s'", tc.name, ctype)
+			}
+			if nil != tc.contents && !bytes.Equal(tc.contents, w.Body.Bytes()) {
+				t.Errorf("For %s expected %d bytes but got %d", tc.name, len(tc.contents), w.Body.Len())
+			}
+		})
+	}
+
+	expected := map[string]float64{
+		"static_file_server_video_streams_active":            0,
+		"static_file_server_video_streams_total /movie.mp4":  6,
+		"static_file_server_video_streams_total /movie.webm": 1,
+		"static_file_server_video_seeks_total /movie.mp4":    3,
+		"static_file_server_video_seeks_total /movie.webm":   1,
+		"static_file_server_video_bytes_total /movie.mp4":    float64(2*len(video) + 400),
+		"static_file_server_video_bytes_total /movie.webm":   100,
+	}
+	if !reflect.DeepEqual(expected, registry.values) {
+		t.Errorf("Expected metrics %v but got %v", expected, registry.values)
+	}
+	if 0 != stats.Active() {
+		t.Errorf("Expected no active streams but got %d", stats.Active())
+	}
+}
+
+func TestWithVideoThrottle(t *testing.T) {
+	video := bytes.Repeat([]byte("0123456789"), 1000)
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(video))
+	}
+	handler := WithVideo(serve, VideoConfig{Rate: 40000, Burst: 2000})
+
+	testCases := []struct {
+		name    string
+		path    string
+		minimum time.Duration
+		maximum time.Duration
+	}{
+		{"Throttled after burst", "/movie.mp4", 80 * time.Millisecond, time.Second},
+		{"Not a video", "/file.txt", 0, 50 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+		w := httptest.NewRecorder()
+		start := time.Now()
+
+		handler(w, req)
+
+		elapsed := time.Since(start)
+		if elapsed < tc.minimum || elapsed > tc.maximum {
+			t.Errorf("For %s expected %s to %s but took %s", tc.name, tc.minimum, tc.maximum, elapsed)
+		}
+		if !bytes.Equal(video, w.Body.Bytes()) {
+			t.Errorf("For %s expected the whole file but got %d bytes", tc.name, w.Body.Len())
+		}
+	}
+}
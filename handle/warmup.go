@@ -0,0 +1,98 @@
+package handle
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+// Warmup reads the named files, every file within named folders and the
+// recent most recently modified files of the storage until the context is
+// done, so they are in the page cache of the operating system before they
+// are first requested. It returns the number of files and bytes read, and
+// the first error reading a named file or folder, continuing with the others.
+func Warmup(
+	ctx context.Context, storage Storage, names []string, recent int,
+) (files int, bytes int64, err error) {
+	read := make(map[string]bool)
+	warm := func(name string) {
+		if read[name] || nil != ctx.Err() {
+			return
+		}
+		read[name] = true
+		n, readErr := warmFile(storage, name)
+		if nil != readErr {
+			if nil == err {
+				err = readErr
+			}
+			return
+		}
+		files++
+		bytes += n
+	}
+
+	for _, name := range names {
+		walkErr := walkStorage(
+			storage, path.Clean("/"+name),
+			func(name string, info os.FileInfo, err error) error {
+				if nil != err {
+					return err
+				}
+				if !info.IsDir() {
+					warm(name)
+				}
+				return ctx.Err()
+			},
+		)
+		if nil != walkErr && nil == err && nil == ctx.Err() {
+			err = walkErr
+		}
+	}
+
+	if 0 < recent {
+		for _, name := range recentFiles(storage, recent) {
+			warm(name)
+		}
+	}
+	return
+}
+
+// warmFile reads the whole of the named file, returning the number of bytes
+// read.
+func warmFile(storage Storage, name string) (int64, error) {
+	file, err := storage.Open(name)
+	if nil != err {
+		return 0, err
+	}
+	defer file.Close()
+	return copyBuffer(ioutil.Discard, file)
+}
+
+// recentFiles returns the names of up to count of the most recently modified
+// files of the storage, newest first.
+func recentFiles(storage Storage, count int) []string {
+	type modified struct {
+		name string
+		info os.FileInfo
+	}
+	var files []modified
+	walkStorage(storage, "/", func(name string, info os.FileInfo, err error) error {
+		if nil == err && !info.IsDir() {
+			files = append(files, modified{name, info})
+		}
+		return nil
+	})
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].info.ModTime().After(files[j].info.ModTime())
+	})
+	if count < len(files) {
+		files = files[:count]
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.name
+	}
+	return names
+}
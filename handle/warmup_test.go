@@ -0,0 +1,80 @@
+package handle
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWarmup(t *testing.T) {
+	folder, err := ioutil.TempDir("", "warmup")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(folder)
+	if err := os.Mkdir(filepath.Join(folder, "sub"), 0700); nil != err {
+		t.Fatalf("While creating sub-folder got %v", err)
+	}
+	// Files are modified a minute apart in order.
+	files := []string{"old.txt", "sub/a.txt", "sub/b.txt", "new.txt"}
+	start := time.Now().Add(-time.Hour)
+	for i, name := range files {
+		filename := filepath.Join(folder, filepath.FromSlash(name))
+		if err := ioutil.WriteFile(filename, []byte(name), 0600); nil != err {
+			t.Fatalf("While writing file got %v", err)
+		}
+		modTime := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(filename, modTime, modTime); nil != err {
+			t.Fatalf("While setting modification time got %v", err)
+		}
+	}
+	storage := Dir(folder)
+
+	if names := recentFiles(storage, 2); !reflect.DeepEqual(
+		[]string{"/new.txt", "/sub/b.txt"}, names,
+	) {
+		t.Errorf("Expected the newest files but got %v", names)
+	}
+
+	testCases := []struct {
+		name    string
+		names   []string
+		recent  int
+		files   int
+		bytes   int64
+		isError bool
+	}{
+		{"Nothing", nil, 0, 0, 0, false},
+		{"File", []string{"/old.txt"}, 0, 1, 7, false},
+		{"Folder", []string{"sub"}, 0, 2, 18, false},
+		{"Recent", nil, 1, 1, 7, false},
+		{"Recent already named", []string{"/new.txt"}, 1, 1, 7, false},
+		{"Everything", []string{"/"}, 10, 4, 32, false},
+		{"Missing", []string{"/missing.txt", "/old.txt"}, 0, 1, 7, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files, bytes, err := Warmup(context.Background(), storage, tc.names, tc.recent)
+			if tc.files != files || tc.bytes != bytes {
+				t.Errorf(
+					"Expected %d files of %d bytes but got %d files of %d bytes",
+					tc.files, tc.bytes, files, bytes,
+				)
+			}
+			if tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+
+	// Nothing is read once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if files, _, err := Warmup(ctx, storage, []string{"/"}, 10); 0 != files || nil != err {
+		t.Errorf("Expected nothing read without error but got %d files and %v", files, err)
+	}
+}
@@ -0,0 +1,99 @@
+package handle
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WatchFunc receives the sorted names of files added, changed or removed since
+// the storage was last walked.
+type WatchFunc func(names []string)
+
+// fileState identifies a version of a file.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watch walks the storage every interval until the context is done, passing
+// the names of files that changed between walks to changed. Changes are found
+// by comparing sizes and modification times, so it works with any Storage.
+func Watch(
+	ctx context.Context, storage Storage, interval time.Duration, changed WatchFunc,
+) {
+	previous := snapshot(storage)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := snapshot(storage)
+		if names := changes(previous, current); 0 < len(names) {
+			changed(names)
+		}
+		previous = current
+	}
+}
+
+// WatchLink resolves the symbolic link at the path every interval until the
+// context is done, calling switched with the new target whenever it changes.
+// This detects a folder being atomically switched to a new release by
+// replacing a symbolic link to it.
+func WatchLink(
+	ctx context.Context,
+	path string,
+	interval time.Duration,
+	switched func(target string),
+) {
+	previous, _ := filepath.EvalSymlinks(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := filepath.EvalSymlinks(path)
+		if nil == err && current != previous {
+			switched(current)
+			previous = current
+		}
+	}
+}
+
+// snapshot of the files in the storage.
+func snapshot(storage Storage) map[string]fileState {
+	files := make(map[string]fileState)
+	walkStorage(storage, "/", func(name string, info os.FileInfo, err error) error {
+		if nil == err && !info.IsDir() {
+			files[name] = fileState{info.Size(), info.ModTime()}
+		}
+		return nil
+	})
+	return files
+}
+
+// changes returns the sorted names of files that differ between snapshots.
+func changes(previous, current map[string]fileState) []string {
+	var names []string
+	for name, state := range current {
+		if old, found := previous[name]; !found ||
+			old.size != state.size || !old.modTime.Equal(state.modTime) {
+			names = append(names, name)
+		}
+	}
+	for name := range previous {
+		if _, found := current[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
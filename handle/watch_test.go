@@ -0,0 +1,75 @@
+package handle
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	now := time.Now()
+	previous := map[string]fileState{
+		"/same.txt":    {1, now},
+		"/resized.txt": {1, now},
+		"/touched.txt": {1, now},
+		"/removed.txt": {1, now},
+	}
+	current := map[string]fileState{
+		"/same.txt":    {1, now},
+		"/resized.txt": {2, now},
+		"/touched.txt": {1, now.Add(time.Second)},
+		"/added.txt":   {1, now},
+	}
+	expected := []string{"/added.txt", "/removed.txt", "/resized.txt", "/touched.txt"}
+	if names := changes(previous, current); !reflect.DeepEqual(expected, names) {
+		t.Errorf("Expected %v but got %v", expected, names)
+	}
+	if names := changes(current, current); 0 != len(names) {
+		t.Errorf("Without changes expected none but got %v", names)
+	}
+	if files := snapshot(Dir(baseDir)); 0 == len(files) {
+		t.Error("Expected the files of the test folder but got none")
+	}
+}
+
+func TestWatchLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, release := range []string{"one", "two"} {
+		os.Mkdir(filepath.Join(dir, release), 0755)
+	}
+	link := filepath.Join(dir, "current")
+	if err = os.Symlink(filepath.Join(dir, "one"), link); nil != err {
+		t.Fatalf("While linking got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	switched := make(chan string, 1)
+	go WatchLink(ctx, link, time.Millisecond, func(target string) {
+		switched <- target
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	// Switch atomically by renaming a new link over the old one.
+	next := filepath.Join(dir, "next")
+	os.Symlink(filepath.Join(dir, "two"), next)
+	if err = os.Rename(next, link); nil != err {
+		t.Fatalf("While switching got %v", err)
+	}
+	select {
+	case target := <-switched:
+		if "two" != filepath.Base(target) {
+			t.Errorf("Expected the new target but got %s", target)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the switch to be detected")
+	}
+}
@@ -0,0 +1,160 @@
+package handle
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// wellKnownPrefix of the URIs described by RFC 8615.
+const wellKnownPrefix = "/.well-known/"
+
+// wellKnownTypes are the content types of well-known URIs without extensions,
+// or whose extensions do not match their contents, by their name.
+var wellKnownTypes = map[string]string{
+	"acme-challenge":             "text/plain; charset=utf-8",
+	"apple-app-site-association": "application/json",
+	"assetlinks.json":            "application/json",
+	"host-meta":                  "application/xrd+xml; charset=utf-8",
+	"host-meta.json":             "application/json",
+	"matrix":                     "application/json",
+	"mta-sts.txt":                "text/plain; charset=utf-8",
+	"nodeinfo":                   "application/json",
+	"openid-configuration":       "application/json",
+	"security.txt":               "text/plain; charset=utf-8",
+	"webfinger":                  "application/jrd+json",
+}
+
+// WellKnown configures the handling of well-known URIs, the paths beginning
+// with '/.well-known/'.
+type WellKnown struct {
+	// ACMEFolder holds the tokens of ACME HTTP-01 challenges, such as the
+	// webroot of certbot, served from '/.well-known/acme-challenge/'. If
+	// empty, challenges are served as other files.
+	ACMEFolder string
+
+	// Passthrough names served directly from the root of the storage,
+	// bypassing authentication, URL_PREFIX and the other later stages.
+	Passthrough []string
+
+	// Redirects of well-known URIs to other locations.
+	Redirects []WellKnownRedirect
+}
+
+// WellKnownRedirect sends requests for the well-known URI with Name to URL.
+type WellKnownRedirect struct {
+	Name string
+	URL  string
+}
+
+// ParseWellKnownRedirect converts a rule in the form 'name=URL' into a
+// WellKnownRedirect, where name is the path within '/.well-known/', such as
+// 'carddav', and URL is a path or an 'http://' or 'https://' URL.
+func ParseWellKnownRedirect(rule string) (parsed WellKnownRedirect, err error) {
+	index := strings.Index(rule, "=")
+	if 0 >= index {
+		err = fmt.Errorf("invalid well-known redirect '%s', expected 'name=URL'", rule)
+		return
+	}
+	parsed.Name = strings.Trim(strings.TrimSpace(rule[:index]), "/")
+	parsed.URL = strings.TrimSpace(rule[index+1:])
+	if !strings.HasPrefix(parsed.URL, "/") &&
+		!strings.HasPrefix(parsed.URL, "http://") &&
+		!strings.HasPrefix(parsed.URL, "https://") {
+		err = fmt.Errorf("invalid URL '%s' in well-known redirect '%s'", parsed.URL, rule)
+	}
+	return
+}
+
+// ParseWellKnownRedirects converts each rule using ParseWellKnownRedirect.
+func ParseWellKnownRedirects(rules []string) ([]WellKnownRedirect, error) {
+	parsed := make([]WellKnownRedirect, 0, len(rules))
+	for _, rule := range rules {
+		result, err := ParseWellKnownRedirect(rule)
+		if nil != err {
+			return nil, err
+		}
+		parsed = append(parsed, result)
+	}
+	return parsed, nil
+}
+
+// WithWellKnown wraps an HTTP request. Well-known URIs are given the content
+// types their clients expect, such as JSON for 'apple-app-site-association',
+// which has no extension. Redirected URIs are answered with a temporary
+// redirect keeping the method, as WebDAV clients discovering 'caldav' and
+// 'carddav' expect. ACME challenges are served from the ACME folder and the
+// passthrough names from the storage, so they are reachable before
+// authentication or other rules refuse the request. All other requests are
+// passed through.
+func WithWellKnown(
+	serve http.HandlerFunc, storage Storage, wellKnown WellKnown,
+) http.HandlerFunc {
+	serveFile := FileServer(storage)
+	var serveChallenge FileServerFunc
+	if 0 < len(wellKnown.ACMEFolder) {
+		serveChallenge = FileServer(Dir(wellKnown.ACMEFolder))
+	}
+	passthrough := make(map[string]bool, len(wellKnown.Passthrough))
+	for _, name := range wellKnown.Passthrough {
+		passthrough[strings.Trim(name, "/")] = true
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, wellKnownPrefix) {
+			serve(w, r)
+			return
+		}
+		rest := strings.TrimPrefix(r.URL.Path, wellKnownPrefix)
+		name := rest
+		if index := strings.Index(rest, "/"); 0 <= index {
+			name = rest[:index]
+		}
+
+		for _, redirect := range wellKnown.Redirects {
+			if redirect.Name == rest {
+				Tracef(r, "redirected well-known URI to '%s'", redirect.URL)
+				http.Redirect(w, r, redirect.URL, http.StatusTemporaryRedirect)
+				return
+			}
+		}
+		if http.MethodGet == r.Method || http.MethodHead == r.Method {
+			if contentType, ok := wellKnownTypes[name]; ok {
+				w.Header().Set("Content-Type", contentType)
+			}
+		}
+
+		switch {
+		case "acme-challenge" == name && nil != serveChallenge:
+			token := strings.TrimPrefix(rest, name+"/")
+			if !acmeToken(token) {
+				Tracef(r, "not found as not an ACME challenge token")
+				http.NotFound(w, r)
+				return
+			}
+			serveChallenge(w, r, "/"+token)
+		case passthrough[name] || passthrough[rest]:
+			Tracef(r, "passed well-known URI through to the storage")
+			serveFile(w, r, r.URL.Path)
+		default:
+			serve(w, r)
+		}
+	}
+}
+
+// acmeToken returns true if the token is in the base64url alphabet used by
+// ACME challenge tokens.
+func acmeToken(token string) bool {
+	if 0 == len(token) {
+		return false
+	}
+	for _, c := range token {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			'-' == c, '_' == c:
+		default:
+			return false
+		}
+	}
+	return true
+}
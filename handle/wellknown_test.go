@@ -0,0 +1,139 @@
+package handle
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseWellKnownRedirect(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    string
+		path    string
+		url     string
+		isError bool
+	}{
+		{"Path", "carddav=/dav/", "carddav", "/dav/", false},
+		{"URL", "/openid-configuration/=https://id.example.com/config",
+			"openid-configuration", "https://id.example.com/config", false},
+		{"No name", "=/dav/", "", "", true},
+		{"No equals", "carddav", "", "", true},
+		{"Bad URL", "carddav=dav", "", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			redirect, err := ParseWellKnownRedirect(tc.rule)
+			if tc.isError {
+				if nil == err {
+					t.Errorf("For '%s' expected an error but got nil", tc.rule)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("For '%s' expected no error but got %v", tc.rule, err)
+			}
+			if tc.path != redirect.Name || tc.url != redirect.URL {
+				t.Errorf(
+					"For '%s' expected '%s' to '%s' but got '%s' to '%s'",
+					tc.rule, tc.path, tc.url, redirect.Name, redirect.URL,
+				)
+			}
+		})
+	}
+
+	if _, err := ParseWellKnownRedirects([]string{"caldav=/dav/", "carddav"}); nil == err {
+		t.Error("For a list with a bad rule expected an error but got nil")
+	}
+}
+
+func TestWithWellKnown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wellknown")
+	if nil != err {
+		t.Fatalf("While creating folder got %v", err)
+	}
+	defer os.RemoveAll(dir)
+	acmeDir := filepath.Join(dir, "acme")
+	wellKnownDir := filepath.Join(dir, "files", ".well-known")
+	os.MkdirAll(acmeDir, 0755)
+	os.MkdirAll(filepath.Join(wellKnownDir, "matrix"), 0755)
+	ioutil.WriteFile(filepath.Join(acmeDir, "tok3n_-A"), []byte("tok3n_-A.key"), 0644)
+	ioutil.WriteFile(filepath.Join(wellKnownDir, "apple-app-site-association"), []byte("{}"), 0644)
+	ioutil.WriteFile(filepath.Join(wellKnownDir, "matrix", "server"), []byte("{}"), 0644)
+
+	served := false
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		served = true
+		w.Write([]byte("served"))
+	}
+	redirects, err := ParseWellKnownRedirects([]string{"carddav=/dav/"})
+	if nil != err {
+		t.Fatalf("While parsing redirects got %v", err)
+	}
+	handler := WithWellKnown(serve, Dir(filepath.Join(dir, "files")), WellKnown{
+		ACMEFolder:  acmeDir,
+		Passthrough: []string{"apple-app-site-association", "/matrix/"},
+		Redirects:   redirects,
+	})
+
+	testCases := []struct {
+		name        string
+		path        string
+		code        int
+		contentType string
+		body        string
+		served      bool
+	}{
+		{"ACME challenge", "/.well-known/acme-challenge/tok3n_-A", ok,
+			"text/plain; charset=utf-8", "tok3n_-A.key", false},
+		{"Missing challenge", "/.well-known/acme-challenge/missing", http.StatusNotFound,
+			"text/plain; charset=utf-8", "404 page not found\n", false},
+		{"Bad token", "/.well-known/acme-challenge/a.b", http.StatusNotFound,
+			"text/plain; charset=utf-8", "404 page not found\n", false},
+		{"Passthrough", "/.well-known/apple-app-site-association", ok,
+			"application/json", "{}", false},
+		{"Passthrough folder", "/.well-known/matrix/server", ok,
+			"application/json", "{}", false},
+		{"Typed", "/.well-known/assetlinks.json", ok,
+			"application/json", "served", true},
+		{"Redirect", "/.well-known/carddav", http.StatusTemporaryRedirect,
+			"", "", false},
+		{"Other well-known", "/.well-known/other", ok, "", "served", true},
+		{"Other file", "/index.html", ok, "", "served", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			served = false
+			req := httptest.NewRequest("GET", "http://localhost"+tc.path, nil)
+			w := httptest.NewRecorder()
+
+			handler(w, req)
+
+			if tc.code != w.Code {
+				t.Fatalf("For %s expected status code %d but got %d", tc.path, tc.code, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); 0 < len(tc.contentType) &&
+				tc.contentType != contentType {
+				t.Errorf("For %s expected type '%s' but got '%s'", tc.path, tc.contentType, contentType)
+			}
+			if 0 < len(tc.body) && tc.body != w.Body.String() {
+				t.Errorf("For %s expected body '%s' but got '%s'", tc.path, tc.body, w.Body)
+			}
+			if tc.served != served {
+				t.Errorf("For %s expected served to be %t", tc.path, tc.served)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("PROPFIND", "http://localhost/.well-known/carddav", nil)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if location := w.Header().Get("Location"); "/dav/" != location {
+		t.Errorf("Expected a redirect to '/dav/' but got '%s'", location)
+	}
+}
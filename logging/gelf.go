@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// gelfChunkSize is the largest GELF UDP datagram sent, leaving room for
+	// the chunk header within common network MTUs.
+	gelfChunkSize = 1420
+	// gelfMaxChunks is the most chunks a GELF message may be split into.
+	gelfMaxChunks = 128
+)
+
+// gelfFormat returns a formatFunc encoding entries as GELF 1.1 messages,
+// terminated by a null byte for TCP and split into chunks for UDP if needed.
+// The kind and fields of the entry are sent as additional fields.
+func gelfFormat(hostname string, tcp bool) formatFunc {
+	return func(e entry) ([][]byte, error) {
+		message := map[string]interface{}{
+			"version":       "1.1",
+			"host":          hostname,
+			"short_message": e.message,
+			"timestamp":     float64(e.time.UnixNano()/1e6) / 1e3,
+			"level":         e.severity,
+		}
+		if 0 < len(e.kind) {
+			message["_kind"] = e.kind
+		}
+		for _, f := range e.fields {
+			// '_id' is reserved by GELF.
+			if name := "_" + strings.ReplaceAll(f.name, "-", "_"); "_id" != name {
+				message[name] = f.value
+			}
+		}
+		encoded, err := json.Marshal(message)
+		if nil != err {
+			return nil, err
+		}
+		if tcp {
+			return [][]byte{append(encoded, 0)}, nil
+		}
+		return gelfChunks(encoded)
+	}
+}
+
+// gelfChunks splits the encoded message into GELF UDP chunks, each with the
+// magic bytes, a message ID, its sequence number and the number of chunks.
+func gelfChunks(encoded []byte) ([][]byte, error) {
+	if gelfChunkSize >= len(encoded) {
+		return [][]byte{encoded}, nil
+	}
+	size := gelfChunkSize - 12
+	count := (len(encoded) + size - 1) / size
+	if gelfMaxChunks < count {
+		return nil, fmt.Errorf(
+			"GELF message of %d bytes exceeds %d chunks", len(encoded), gelfMaxChunks,
+		)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); nil != err {
+		return nil, err
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if len(encoded) < end {
+			end = len(encoded)
+		}
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, encoded[i*size:end]...))
+	}
+	return chunks, nil
+}
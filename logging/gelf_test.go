@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFFormat(t *testing.T) {
+	e := parse(
+		"DENY: GET HTTP/1.1 localhost/ policy 403 policy-rule='deny' id=1",
+		time.Unix(1600000000, 250000000),
+	)
+	frames, err := gelfFormat("web-1", false)(e)
+	if nil != err || 1 != len(frames) {
+		t.Fatalf("Expected a frame but got %d and %v", len(frames), err)
+	}
+	var message map[string]interface{}
+	if err = json.Unmarshal(frames[0], &message); nil != err {
+		t.Fatalf("While decoding got %v", err)
+	}
+	expected := map[string]interface{}{
+		"version":       "1.1",
+		"host":          "web-1",
+		"short_message": e.message,
+		"timestamp":     1600000000.25,
+		"level":         float64(severityWarning),
+		"_kind":         "DENY",
+		"_policy_rule":  "deny",
+	}
+	for name, value := range expected {
+		if value != message[name] {
+			t.Errorf("Expected %s of %v but got %v", name, value, message[name])
+		}
+	}
+	if _, found := message["_id"]; found {
+		t.Error("Expected the reserved '_id' field to be skipped")
+	}
+
+	frames, _ = gelfFormat("web-1", true)(e)
+	if !bytes.HasSuffix(frames[0], []byte{0}) {
+		t.Error("Expected TCP frames to be null terminated")
+	}
+}
+
+func TestGELFChunks(t *testing.T) {
+	encoded := []byte(strings.Repeat("x", 3000))
+	chunks, err := gelfChunks(encoded)
+	if nil != err || 3 != len(chunks) {
+		t.Fatalf("Expected 3 chunks but got %d and %v", len(chunks), err)
+	}
+	var joined []byte
+	for i, chunk := range chunks {
+		if gelfChunkSize < len(chunk) || 0x1e != chunk[0] || 0x0f != chunk[1] ||
+			byte(i) != chunk[10] || 3 != chunk[11] {
+			t.Errorf("Chunk %d has an invalid header % x", i, chunk[:12])
+		}
+		if !bytes.Equal(chunks[0][2:10], chunk[2:10]) {
+			t.Errorf("Chunk %d has a different message ID", i)
+		}
+		joined = append(joined, chunk[12:]...)
+	}
+	if !bytes.Equal(encoded, joined) {
+		t.Error("Expected the chunks to hold the message")
+	}
+
+	if _, err = gelfChunks(make([]byte, gelfMaxChunks*gelfChunkSize)); nil == err {
+		t.Error("With an oversized message expected an error but got nil")
+	}
+}
@@ -0,0 +1,163 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Values to be overridden to simplify unit testing.
+	now              = time.Now
+	stderr io.Writer = os.Stderr
+)
+
+// formatFunc converts a log entry into the frames sent for it.
+type formatFunc func(e entry) ([][]byte, error)
+
+// Open returns a writer shipping each line of the log to the destination, in
+// the form 'format+network://host:port'. The format is 'gelf' for Graylog
+// Extended Log Format or 'syslog' for RFC 5424 syslog and the network is 'udp'
+// or 'tcp'. Lines that cannot be shipped are written to standard error so
+// they are not lost. Use with a log.Logger without flags, as the time is sent
+// with each line.
+func Open(destination string) (io.Writer, error) {
+	parsed, err := url.Parse(destination)
+	if nil != err {
+		return nil, fmt.Errorf("invalid log destination '%s': %v", destination, err)
+	}
+	scheme := strings.SplitN(parsed.Scheme, "+", 2)
+	if 2 != len(scheme) || ("udp" != scheme[1] && "tcp" != scheme[1]) ||
+		0 == len(parsed.Host) {
+		return nil, fmt.Errorf(
+			"invalid log destination '%s': expected 'format+udp://host:port' "+
+				"or 'format+tcp://host:port'",
+			destination,
+		)
+	}
+	hostname, _ := os.Hostname()
+	network, tcp := scheme[1], "tcp" == scheme[1]
+
+	var format formatFunc
+	switch scheme[0] {
+	case "gelf":
+		format = gelfFormat(hostname, tcp)
+	case "syslog":
+		format = syslogFormat(hostname, os.Getpid(), tcp)
+	default:
+		return nil, fmt.Errorf(
+			"invalid log destination '%s': unknown format '%s'",
+			destination, scheme[0],
+		)
+	}
+	return &shipper{network: network, address: parsed.Host, format: format}, nil
+}
+
+// shipper sends the frames of each line to a network address, reconnecting
+// after failures.
+type shipper struct {
+	network string
+	address string
+	format  formatFunc
+
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+// Write ships each line, always reporting success so that logging continues
+// while the destination is unavailable.
+func (s *shipper) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if 0 == len(line) {
+			continue
+		}
+		if err := s.ship(line); nil != err {
+			fmt.Fprintf(stderr, "Error: while shipping log got %v\n%s\n", err, line)
+		}
+	}
+	return len(p), nil
+}
+
+// ship the frames of the line, reconnecting once if sending fails.
+func (s *shipper) ship(line string) error {
+	frames, err := s.format(parse(line, now()))
+	if nil != err {
+		return err
+	}
+	if err = s.send(frames); nil != err {
+		err = s.send(frames)
+	}
+	return err
+}
+
+// send the frames, connecting if needed.
+func (s *shipper) send(frames [][]byte) (err error) {
+	if nil == s.conn {
+		if s.conn, err = net.DialTimeout(s.network, s.address, 5*time.Second); nil != err {
+			s.conn = nil
+			return
+		}
+	}
+	s.conn.SetWriteDeadline(now().Add(5 * time.Second))
+	for _, frame := range frames {
+		if _, err = s.conn.Write(frame); nil != err {
+			s.conn.Close()
+			s.conn = nil
+			return
+		}
+	}
+	return
+}
+
+// Severities of log entries, as defined by syslog.
+const (
+	severityError   = 3
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// field of a log entry.
+type field struct {
+	name, value string
+}
+
+// entry of the log, parsed from a line written by the server.
+type entry struct {
+	time     time.Time
+	kind     string
+	message  string
+	severity int
+	fields   []field
+}
+
+// annotation matches access log annotations, such as 'subject=alice'.
+var annotation = regexp.MustCompile(`^([a-z][a-z0-9-]*)=(\S+)$`)
+
+// parse the line. The kind is the leading 'REQ:', 'DENY:' or 'Error:' word and
+// the fields are the annotations of the line.
+func parse(line string, at time.Time) entry {
+	e := entry{time: at, message: line, severity: severityInfo}
+	if index := strings.Index(line, ": "); 0 < index && !strings.Contains(line[:index], " ") {
+		switch e.kind = line[:index]; e.kind {
+		case "Error":
+			e.severity = severityError
+		case "DENY":
+			e.severity = severityWarning
+		}
+	}
+	for _, token := range strings.Fields(line) {
+		if match := annotation.FindStringSubmatch(token); nil != match {
+			e.fields = append(e.fields, field{match[1], strings.Trim(match[2], "'")})
+		}
+	}
+	return e
+}
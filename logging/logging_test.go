@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	testCases := []struct {
+		destination string
+		isError     bool
+	}{
+		{"gelf+udp://localhost:12201", false},
+		{"gelf+tcp://localhost:12201", false},
+		{"syslog+udp://localhost:514", false},
+		{"syslog+tcp://localhost:514", false},
+		{"syslog://localhost:514", true},
+		{"syslog+unix://localhost:514", true},
+		{"json+tcp://localhost:514", true},
+		{"gelf+udp://", true},
+		{"gelf+udp://local host", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.destination, func(t *testing.T) {
+			if _, err := Open(tc.destination); tc.isError != (nil != err) {
+				t.Errorf("Expected error %t but got %v", tc.isError, err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	at := time.Now()
+	testCases := []struct {
+		line     string
+		kind     string
+		severity int
+		fields   []field
+	}{
+		{
+			"REQ: GET HTTP/1.1 localhost/file.txt -> file.txt subject=alice status=200",
+			"REQ", severityInfo, []field{{"subject", "alice"}, {"status", "200"}},
+		},
+		{
+			"DENY: GET HTTP/1.1 localhost/ policy 403 policy-rule='deny'",
+			"DENY", severityWarning, []field{{"policy-rule", "deny"}},
+		},
+		{"Error: while generating /robots.txt got EOF", "Error", severityError, nil},
+		{"Using config file path", "", severityInfo, nil},
+	}
+	for _, tc := range testCases {
+		e := parse(tc.line, at)
+		if tc.kind != e.kind || tc.severity != e.severity || tc.line != e.message {
+			t.Errorf("For '%s' expected %s at %d but got %+v", tc.line, tc.kind, tc.severity, e)
+		}
+		if !reflect.DeepEqual(tc.fields, e.fields) {
+			t.Errorf("For '%s' expected fields %v but got %v", tc.line, tc.fields, e.fields)
+		}
+	}
+}
+
+func TestShipperTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if nil != err {
+			return
+		}
+		// Octet counting frames messages without separators.
+		var data []byte
+		buffer := make([]byte, 1024)
+		for !bytes.Contains(data, []byte("second")) {
+			n, err := conn.Read(buffer)
+			if nil != err {
+				break
+			}
+			data = append(data, buffer[:n]...)
+		}
+		received <- string(data)
+	}()
+
+	out, err := Open("syslog+tcp://" + ln.Addr().String())
+	if nil != err {
+		t.Fatalf("While opening got %v", err)
+	}
+	out.Write([]byte("REQ: first\nREQ: second\n"))
+	select {
+	case data := <-received:
+		for _, expected := range []string{"REQ - REQ: first", "REQ - REQ: second"} {
+			if !strings.Contains(data, expected) {
+				t.Errorf("Expected '%s' in '%s'", expected, data)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the lines to be shipped")
+	}
+}
+
+func TestShipperUnavailable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("While listening got %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	var fallback bytes.Buffer
+	stderr = &fallback
+	defer func() { stderr = os.Stderr }()
+
+	out, err := Open("gelf+tcp://" + address)
+	if nil != err {
+		t.Fatalf("While opening got %v", err)
+	}
+	if n, err := out.Write([]byte("REQ: lost\n")); 10 != n || nil != err {
+		t.Errorf("Expected the write to succeed but got %d and %v", n, err)
+	}
+	if !strings.Contains(fallback.String(), "REQ: lost") {
+		t.Errorf("Expected the line on standard error but got '%s'", fallback.String())
+	}
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// syslogFacility of the messages, 'daemon'.
+	syslogFacility = 3
+	// syslogSDID identifies the structured data of the messages, using the
+	// enterprise number reserved for documentation by RFC 5612.
+	syslogSDID = "sfs@32473"
+)
+
+// syslogParamEscaper escapes structured data parameter values.
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogFormat returns a formatFunc encoding entries as RFC 5424 syslog
+// messages, framed by octet counting (RFC 6587) for TCP. The kind of the
+// entry is the message ID and its fields are structured data.
+func syslogFormat(hostname string, pid int, tcp bool) formatFunc {
+	if 0 == len(hostname) {
+		hostname = "-"
+	}
+	return func(e entry) ([][]byte, error) {
+		msgID := e.kind
+		if 0 == len(msgID) {
+			msgID = "-"
+		}
+		data := "-"
+		if 0 < len(e.fields) {
+			params := make([]string, len(e.fields))
+			for i, f := range e.fields {
+				params[i] = fmt.Sprintf(`%s="%s"`, f.name, syslogParamEscaper.Replace(f.value))
+			}
+			data = "[" + syslogSDID + " " + strings.Join(params, " ") + "]"
+		}
+		message := fmt.Sprintf(
+			"<%d>1 %s %s static-file-server %d %s %s %s",
+			8*syslogFacility+e.severity,
+			e.time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+			hostname,
+			pid,
+			msgID,
+			data,
+			e.message,
+		)
+		if tcp {
+			message = fmt.Sprintf("%d %s", len(message), message)
+		}
+		return [][]byte{[]byte(message)}, nil
+	}
+}
@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyslogFormat(t *testing.T) {
+	at := time.Date(2020, time.January, 2, 3, 4, 5, 6000, time.UTC)
+	testCases := []struct {
+		name     string
+		line     string
+		tcp      bool
+		expected string
+	}{
+		{
+			"Structured", `REQ: GET /a subject=al"ice] status=200`, false,
+			`<30>1 2020-01-02T03:04:05.000006Z web-1 static-file-server 42 REQ ` +
+				`[sfs@32473 subject="al\"ice\]" status="200"] REQ: GET /a subject=al"ice] status=200`,
+		},
+		{
+			"Plain", "Error: failed", false,
+			"<27>1 2020-01-02T03:04:05.000006Z web-1 static-file-server 42 Error - Error: failed",
+		},
+		{
+			"Octet counted", "started", true,
+			"73 <30>1 2020-01-02T03:04:05.000006Z web-1 static-file-server 42 - - started",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			frames, err := syslogFormat("web-1", 42, tc.tcp)(parse(tc.line, at))
+			if nil != err || 1 != len(frames) {
+				t.Fatalf("Expected a frame but got %d and %v", len(frames), err)
+			}
+			if tc.expected != string(frames[0]) {
+				t.Errorf("Expected '%s' but got '%s'", tc.expected, frames[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/halverneus/static-file-server/handle"
+)
+
+// Registry of metrics rendered in the Prometheus text, OpenMetrics or protobuf
+// exposition format. It implements handle.MetricsRegistry, and its histograms
+// implement handle.ExemplarHistogram. Histograms count observations both in
+// their classic buckets and in native histogram buckets, which are only
+// served in the protobuf format.
+type Registry struct {
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+// family of series sharing a name, type and label names.
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*series
+}
+
+// series of a family for a single combination of label values.
+type series struct {
+	labels []string
+	value  float64
+	sum    float64
+	count  uint64
+
+	// Classic histogram buckets and the last exemplar of each, including the
+	// '+Inf' bucket.
+	counts    []uint64
+	exemplars []exemplar
+
+	// Native histogram buckets by index, as described for nativeIndex.
+	zero     uint64
+	positive map[int]uint64
+	negative map[int]uint64
+}
+
+// exemplar of an observation, linking a histogram bucket to a trace.
+type exemplar struct {
+	traceID   string
+	value     float64
+	timestamp time.Time
+}
+
+const (
+	// nativeSchema of native histograms, whose bucket boundaries grow by a
+	// factor of 2^(2^-3), about 9%, as with the Prometheus client's default.
+	nativeSchema = 3
+	// nativeZeroThreshold is the largest absolute value counted in the zero
+	// bucket of native histograms.
+	nativeZeroThreshold = 2.938735877055719e-39
+)
+
+// nativeBounds are the bucket boundaries of native histograms within each
+// power of two, as fractions in [0.5, 1).
+var nativeBounds = func() (bounds [1 << nativeSchema]float64) {
+	for index := range bounds {
+		bounds[index] = math.Exp2(float64(index)/float64(len(bounds))) / 2
+	}
+	return
+}()
+
+// nativeIndex returns the index of the native histogram bucket of the absolute
+// value. Bucket i holds values in (2^((i-1)/8), 2^(i/8)].
+func nativeIndex(value float64) int {
+	frac, exp := math.Frexp(value)
+	return sort.SearchFloat64s(nativeBounds[:], frac) + (exp-1)*len(nativeBounds)
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter registers, or returns the already registered, counter.
+func (registry *Registry) Counter(
+	name, help string, labels ...string,
+) handle.Counter {
+	return registry.register(name, help, "counter", nil, labels)
+}
+
+// Gauge registers, or returns the already registered, gauge.
+func (registry *Registry) Gauge(
+	name, help string, labels ...string,
+) handle.Gauge {
+	return registry.register(name, help, "gauge", nil, labels)
+}
+
+// Histogram registers, or returns the already registered, histogram with the
+// passed upper bounds for each bucket.
+func (registry *Registry) Histogram(
+	name, help string, buckets []float64, labels ...string,
+) handle.Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return registry.register(name, help, "histogram", sorted, labels)
+}
+
+// Handler returns an HTTP handler serving the metrics in the format ranked
+// highest by the 'Accept' header, which is the Prometheus text format unless
+// the OpenMetrics or protobuf format is accepted.
+func (registry *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch acceptedFormat(r.Header.Get("Accept")) {
+		case protobufType:
+			w.Header().Set("Content-Type", protobufType)
+			registry.WriteProtobuf(w)
+		case openMetricsType:
+			w.Header().Set("Content-Type", openMetricsType)
+			registry.WriteOpenMetrics(w)
+		default:
+			w.Header().Set("Content-Type", textType)
+			registry.Write(w)
+		}
+	}
+}
+
+const (
+	// textType is the media type of the Prometheus text format.
+	textType = "text/plain; version=0.0.4"
+	// openMetricsType is the media type of the OpenMetrics text format.
+	openMetricsType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	// protobufType is the media type of the Prometheus protobuf format.
+	protobufType = "application/vnd.google.protobuf; " +
+		"proto=io.prometheus.client.MetricFamily; encoding=delimited"
+)
+
+// acceptedFormat returns the media type of the format ranked highest by the
+// 'Accept' header value, preferring earlier media ranges of equal quality.
+func acceptedFormat(accept string) string {
+	format, best := textType, 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if nil != err {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); nil != err {
+				continue
+			}
+		}
+		var candidate string
+		switch mediaType {
+		case "application/vnd.google.protobuf":
+			if "io.prometheus.client.MetricFamily" == params["proto"] &&
+				"delimited" == params["encoding"] {
+				candidate = protobufType
+			}
+		case "application/openmetrics-text":
+			candidate = openMetricsType
+		case "text/plain", "text/*", "*/*":
+			candidate = textType
+		}
+		if "" != candidate && quality > best {
+			format, best = candidate, quality
+		}
+	}
+	return format
+}
+
+// Write all metrics in the Prometheus text exposition format.
+func (registry *Registry) Write(w io.Writer) error {
+	for _, f := range registry.sorted() {
+		if err := f.write(w, false); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteOpenMetrics writes all metrics in the OpenMetrics text format, which
+// includes the exemplars of histogram buckets.
+func (registry *Registry) WriteOpenMetrics(w io.Writer) error {
+	for _, f := range registry.sorted() {
+		if err := f.write(w, true); nil != err {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+// sorted returns the families ordered by name.
+func (registry *Registry) sorted() []*family {
+	registry.mutex.Lock()
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	families := make([]*family, len(names))
+	for index, name := range names {
+		families[index] = registry.families[name]
+	}
+	registry.mutex.Unlock()
+	return families
+}
+
+// register the family, returning the existing family if the name is taken.
+func (registry *Registry) register(
+	name, help, kind string, buckets []float64, labels []string,
+) *family {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if existing, found := registry.families[name]; found {
+		return existing
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	registry.families[name] = f
+	return f
+}
+
+// Add the value to the series for the label values.
+func (f *family) Add(value float64, labelValues ...string) {
+	f.mutex.Lock()
+	f.get(labelValues).value += value
+	f.mutex.Unlock()
+}
+
+// Set the value of the series for the label values.
+func (f *family) Set(value float64, labelValues ...string) {
+	f.mutex.Lock()
+	f.get(labelValues).value = value
+	f.mutex.Unlock()
+}
+
+// Observe the value in the histogram series for the label values.
+func (f *family) Observe(value float64, labelValues ...string) {
+	f.observe(value, "", labelValues)
+}
+
+// ObserveWithTraceID observes the value in the histogram series for the label
+// values, keeping the trace ID as the exemplar of its bucket.
+func (f *family) ObserveWithTraceID(
+	value float64, traceID string, labelValues ...string,
+) {
+	f.observe(value, traceID, labelValues)
+}
+
+// observe the value, keeping the trace ID as exemplar unless it is empty.
+func (f *family) observe(value float64, traceID string, labelValues []string) {
+	f.mutex.Lock()
+	s := f.get(labelValues)
+	// The buckets are sorted, so the value is counted in the first bucket
+	// holding it and every later one.
+	first := sort.SearchFloat64s(f.buckets, value)
+	for index := first; index < len(f.buckets); index++ {
+		s.counts[index]++
+	}
+	if "" != traceID {
+		s.exemplars[first] = exemplar{traceID, value, time.Now()}
+	}
+	switch abs := math.Abs(value); {
+	case nativeZeroThreshold >= abs:
+		s.zero++
+	case 0 < value:
+		s.positive[nativeIndex(abs)]++
+	default:
+		s.negative[nativeIndex(abs)]++
+	}
+	s.sum += value
+	s.count++
+	f.mutex.Unlock()
+}
+
+// get the series for the label values, creating it if necessary. The mutex
+// must be held. The key is built on the stack, so finding an existing series
+// does not allocate.
+func (f *family) get(labelValues []string) *series {
+	var buffer [128]byte
+	key := buffer[:0]
+	for index, value := range labelValues {
+		if 0 < index {
+			key = append(key, '\xff')
+		}
+		key = append(key, value...)
+	}
+	s, found := f.series[string(key)]
+	if !found {
+		s = &series{labels: append([]string(nil), labelValues...)}
+		if "histogram" == f.kind {
+			s.counts = make([]uint64, len(f.buckets))
+			s.exemplars = make([]exemplar, len(f.buckets)+1)
+			s.positive = make(map[int]uint64)
+			s.negative = make(map[int]uint64)
+		}
+		f.series[string(key)] = s
+	}
+	return s
+}
+
+// keys returns the keys of the series in order. The mutex must be held.
+func (f *family) keys() []string {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// write the family in the Prometheus text exposition format or, with
+// openMetrics, in the OpenMetrics text format. OpenMetrics names counters
+// without the '_total' suffix of their samples and adds the exemplars of
+// histogram buckets.
+func (f *family) write(w io.Writer, openMetrics bool) (err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	name, sample := f.name, f.name
+	if openMetrics && "counter" == f.kind {
+		name = strings.TrimSuffix(f.name, "_total")
+		sample = name + "_total"
+	}
+	if _, err = fmt.Fprintf(
+		w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind,
+	); nil != err {
+		return
+	}
+	for _, key := range f.keys() {
+		s := f.series[key]
+		labels := f.labelPairs(s.labels)
+		if "histogram" != f.kind {
+			if _, err = fmt.Fprintf(
+				w, "%s%s %s\n", sample, braces(labels), formatFloat(s.value),
+			); nil != err {
+				return
+			}
+			continue
+		}
+		for index := 0; index <= len(f.buckets); index++ {
+			bound, count := "+Inf", s.count
+			if index < len(f.buckets) {
+				bound, count = formatFloat(f.buckets[index]), s.counts[index]
+				if openMetrics && !strings.ContainsAny(bound, ".eI") {
+					bound += ".0"
+				}
+			}
+			bucket := append(append([]string(nil), labels...), pair("le", bound))
+			line := fmt.Sprintf("%s_bucket%s %d", f.name, braces(bucket), count)
+			if e := s.exemplars[index]; openMetrics && "" != e.traceID {
+				line += fmt.Sprintf(
+					" # {%s} %s %.3f", pair("trace_id", e.traceID),
+					formatFloat(e.value), float64(e.timestamp.UnixNano())/1e9,
+				)
+			}
+			if _, err = fmt.Fprintln(w, line); nil != err {
+				return
+			}
+		}
+		if _, err = fmt.Fprintf(
+			w, "%s_sum%s %s\n%s_count%s %d\n",
+			f.name, braces(labels), formatFloat(s.sum),
+			f.name, braces(labels), s.count,
+		); nil != err {
+			return
+		}
+	}
+	return
+}
+
+// labelPairs formats each label name with the corresponding value.
+func (f *family) labelPairs(values []string) []string {
+	pairs := make([]string, 0, len(f.labels))
+	for index, name := range f.labels {
+		value := ""
+		if index < len(values) {
+			value = values[index]
+		}
+		pairs = append(pairs, pair(name, value))
+	}
+	return pairs
+}
+
+// pair formats a label name and escaped value.
+func pair(name, value string) string {
+	return fmt.Sprintf("%s=%s", name, strconv.Quote(value))
+}
+
+// braces surrounds the joined label pairs, if any.
+func braces(pairs []string) string {
+	if 0 == len(pairs) {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat in the form expected by Prometheus.
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
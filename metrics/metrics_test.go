@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/halverneus/static-file-server/handle"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := New()
+	counter := registry.Counter("test_total", "Counter.", "code")
+	counter.Add(1, "200")
+	counter.Add(2, "200")
+	counter.Add(1, "404")
+	if registry.Counter("test_total", "Duplicate.", "code") != counter {
+		t.Error("Expected registering a duplicate name to return the existing metric")
+	}
+
+	gauge := registry.Gauge("test_gauge", "Gauge.")
+	gauge.Add(5)
+	gauge.Set(2)
+	gauge.Add(-1)
+
+	histogram := registry.Histogram("test_seconds", "Histogram.", []float64{1, 0.1}, "method")
+	histogram.Observe(0.05, "GET")
+	histogram.Observe(0.5, "GET")
+	histogram.Observe(5, "GET")
+
+	var buf bytes.Buffer
+	if err := registry.Write(&buf); nil != err {
+		t.Fatalf("While writing metrics got %v", err)
+	}
+	expected := `# HELP test_gauge Gauge.
+# TYPE test_gauge gauge
+test_gauge 1
+# HELP test_seconds Histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{method="GET",le="0.1"} 1
+test_seconds_bucket{method="GET",le="1"} 2
+test_seconds_bucket{method="GET",le="+Inf"} 3
+test_seconds_sum{method="GET"} 5.55
+test_seconds_count{method="GET"} 3
+# HELP test_total Counter.
+# TYPE test_total counter
+test_total{code="200"} 3
+test_total{code="404"} 1
+`
+	if expected != buf.String() {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	registry := New()
+	registry.Counter("test_total", "Counter.").Add(1)
+
+	w := httptest.NewRecorder()
+	registry.Handler()(w, httptest.NewRequest("GET", "http://localhost/metrics", nil))
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected text content type but got '%s'", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "test_total 1\n") {
+		t.Errorf("Expected counter in body but got:\n%s", w.Body.String())
+	}
+
+	testCases := []struct {
+		name   string
+		accept string
+		ctype  string
+	}{
+		{"Text", "text/plain;version=0.0.4;q=0.5,*/*;q=0.1", textType},
+		{"OpenMetrics", "application/openmetrics-text;version=1.0.0,text/plain;q=0.5", openMetricsType},
+		{"Protobuf", "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited," +
+			"application/openmetrics-text;version=1.0.0;q=0.8", protobufType},
+		{"Ranked by quality", "text/plain;q=0.9,application/openmetrics-text;q=0.5", textType},
+		{"Unknown protobuf", "application/vnd.google.protobuf;proto=other", textType},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "http://localhost/metrics", nil)
+			r.Header.Set("Accept", tc.accept)
+			registry.Handler()(w, r)
+			if tc.ctype != w.Header().Get("Content-Type") {
+				t.Errorf("Expected content type '%s' but got '%s'", tc.ctype, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestOpenMetrics(t *testing.T) {
+	registry := New()
+	registry.Counter("test_total", "Counter.").Add(1)
+	histogram := registry.Histogram("test_seconds", "Histogram.", []float64{0.1, 1}, "method")
+	histogram.Observe(0.05, "GET")
+	histogram.(handle.ExemplarHistogram).ObserveWithTraceID(0.5, "4bf92f3577b34da6", "GET")
+	registry.families["test_seconds"].series["GET"].exemplars[1].timestamp = time.Unix(1700000000, 250000000)
+
+	var buf bytes.Buffer
+	if err := registry.WriteOpenMetrics(&buf); nil != err {
+		t.Fatalf("While writing metrics got %v", err)
+	}
+	expected := `# HELP test_seconds Histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{method="GET",le="0.1"} 1
+test_seconds_bucket{method="GET",le="1.0"} 2 # {trace_id="4bf92f3577b34da6"} 0.5 1700000000.250
+test_seconds_bucket{method="GET",le="+Inf"} 2
+test_seconds_sum{method="GET"} 0.55
+test_seconds_count{method="GET"} 2
+# HELP test Counter.
+# TYPE test counter
+test_total 1
+# EOF
+`
+	if expected != buf.String() {
+		t.Errorf("Expected:\n%s\nbut got:\n%s", expected, buf.String())
+	}
+}
+
+func TestNativeIndex(t *testing.T) {
+	testCases := []struct {
+		value float64
+		index int
+	}{
+		{1, 0},
+		{1.01, 1},
+		{1.5, 5},
+		{2, 8},
+		{0.5, -8},
+		{0.001, -79},
+	}
+	for _, tc := range testCases {
+		if index := nativeIndex(tc.value); tc.index != index {
+			t.Errorf("For %v expected bucket %d but got %d", tc.value, tc.index, index)
+		}
+	}
+}
+
+// field of a protobuf message.
+type field struct {
+	number int
+	varint uint64
+	bytes  []byte
+}
+
+// decode the fields of a protobuf message.
+func decode(t *testing.T, b []byte) (fields []field) {
+	t.Helper()
+	for 0 < len(b) {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		f := field{number: int(tag >> 3)}
+		switch tag & 7 {
+		case varintWire:
+			f.varint, n = binary.Uvarint(b)
+		case fixed64Wire:
+			f.varint, n = binary.LittleEndian.Uint64(b), 8
+		case bytesWire:
+			length, size := binary.Uvarint(b)
+			f.bytes, n = b[size:size+int(length)], size+int(length)
+		default:
+			t.Fatalf("Unexpected wire type in tag %d", tag)
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return
+}
+
+// only returns the fields with the number.
+func only(fields []field, number int) (found []field) {
+	for _, f := range fields {
+		if number == f.number {
+			found = append(found, f)
+		}
+	}
+	return
+}
+
+func TestProtobuf(t *testing.T) {
+	registry := New()
+	histogram := registry.Histogram("test_seconds", "Histogram.", []float64{1}).(handle.ExemplarHistogram)
+	for _, value := range []float64{0, 1, 1, 1.01, 1.5} {
+		histogram.Observe(value)
+	}
+	histogram.ObserveWithTraceID(2, "4bf92f3577b34da6")
+
+	var buf bytes.Buffer
+	if err := registry.WriteProtobuf(&buf); nil != err {
+		t.Fatalf("While writing metrics got %v", err)
+	}
+	length, n := binary.Uvarint(buf.Bytes())
+	if int(length) != buf.Len()-n {
+		t.Fatalf("Expected a single delimited message of %d bytes but got %d", length, buf.Len()-n)
+	}
+	family := decode(t, buf.Bytes()[n:])
+	if "test_seconds" != string(only(family, 1)[0].bytes) || histogramType != only(family, 3)[0].varint {
+		t.Errorf("Expected the histogram family but got %v", family)
+	}
+	metric := decode(t, only(family, 4)[0].bytes)
+	h := decode(t, only(metric, 7)[0].bytes)
+
+	if 6 != only(h, 1)[0].varint || 3 != only(decode(t, only(h, 3)[0].bytes), 1)[0].varint {
+		t.Errorf("Expected 6 observations and 3 in the classic bucket but got %v", h)
+	}
+	if 6 != only(h, 5)[0].varint || 1 != only(h, 7)[0].varint {
+		t.Errorf("Expected schema 3 and 1 zero observation but got %v", h)
+	}
+	// Buckets 0 and 1 are consecutive, then 5 and 8 follow gaps.
+	var spans [][2]uint64
+	for _, span := range only(h, 12) {
+		fields := decode(t, span.bytes)
+		spans = append(spans, [2]uint64{only(fields, 1)[0].varint, only(fields, 2)[0].varint})
+	}
+	var deltas []uint64
+	for _, delta := range only(h, 13) {
+		deltas = append(deltas, delta.varint)
+	}
+	// Offsets and deltas are zigzag encoded: 0, 3, 2 and 2, -1, 0, 0.
+	if !reflect.DeepEqual([][2]uint64{{0, 2}, {6, 1}, {4, 1}}, spans) ||
+		!reflect.DeepEqual([]uint64{4, 1, 0, 0}, deltas) {
+		t.Errorf("Expected native buckets 0, 1, 5 and 8 but got spans %v and deltas %v", spans, deltas)
+	}
+	exemplars := only(h, 16)
+	if 1 != len(exemplars) || !bytes.Contains(exemplars[0].bytes, []byte("4bf92f3577b34da6")) {
+		t.Errorf("Expected the exemplar but got %v", exemplars)
+	}
+	if 0 != len(only(h, 9)) {
+		t.Errorf("Expected no negative buckets but got %v", h)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	testCases := []struct {
+		value  float64
+		result string
+	}{
+		{1, "1"},
+		{0.25, "0.25"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+	}
+	for _, tc := range testCases {
+		if result := formatFloat(tc.value); tc.result != result {
+			t.Errorf("For %v expected '%s' but got '%s'", tc.value, tc.result, result)
+		}
+	}
+}
+
+func TestRecordingAllocations(t *testing.T) {
+	registry := New()
+	counter := registry.Counter("test_total", "Counter.", "method", "code")
+	histogram := registry.Histogram(
+		"test_seconds", "Histogram.", []float64{0.1, 1}, "method", "code",
+	)
+	labels := []string{"GET", "200"}
+	counter.Add(1, labels...)
+	histogram.Observe(0.5, labels...)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		counter.Add(1, labels...)
+		histogram.Observe(0.5, labels...)
+	})
+	if 0 != allocs {
+		t.Errorf("Expected no allocations for existing series but got %v", allocs)
+	}
+}
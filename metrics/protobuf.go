@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+// Metric types of the Prometheus client model ('metrics.proto') and the
+// protobuf wire types of its fields.
+const (
+	counterType   = 0
+	gaugeType     = 1
+	histogramType = 4
+
+	varintWire  = 0
+	fixed64Wire = 1
+	bytesWire   = 2
+)
+
+// metricTypes holds the client model type of each kind of family.
+var metricTypes = map[string]uint64{
+	"counter":   counterType,
+	"gauge":     gaugeType,
+	"histogram": histogramType,
+}
+
+// WriteProtobuf writes all metrics in the Prometheus protobuf exposition
+// format, as length-delimited MetricFamily messages. Histograms include their
+// native histogram buckets alongside the classic ones, and the exemplars of
+// both.
+func (registry *Registry) WriteProtobuf(w io.Writer) error {
+	for _, f := range registry.sorted() {
+		message := f.protobuf()
+		if _, err := w.Write(
+			append(appendVarint(nil, uint64(len(message))), message...),
+		); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// protobuf returns the family encoded as a MetricFamily message.
+func (f *family) protobuf() []byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	b := appendString(nil, 1, f.name)
+	b = appendString(b, 2, f.help)
+	b = appendUint(b, 3, metricTypes[f.kind])
+	for _, key := range f.keys() {
+		s := f.series[key]
+		var metric []byte
+		for index, name := range f.labels {
+			value := ""
+			if index < len(s.labels) {
+				value = s.labels[index]
+			}
+			metric = appendBytes(metric, 1, appendString(appendString(nil, 1, name), 2, value))
+		}
+		switch f.kind {
+		case "counter":
+			metric = appendBytes(metric, 3, appendDouble(nil, 1, s.value))
+		case "gauge":
+			metric = appendBytes(metric, 2, appendDouble(nil, 1, s.value))
+		case "histogram":
+			metric = appendBytes(metric, 7, f.histogram(s))
+		}
+		b = appendBytes(b, 4, metric)
+	}
+	return b
+}
+
+// histogram returns the series encoded as a Histogram message.
+func (f *family) histogram(s *series) []byte {
+	b := appendUint(nil, 1, s.count)
+	b = appendDouble(b, 2, s.sum)
+	for index, bound := range f.buckets {
+		bucket := appendUint(nil, 1, s.counts[index])
+		bucket = appendDouble(bucket, 2, bound)
+		if e := s.exemplars[index]; "" != e.traceID {
+			bucket = appendBytes(bucket, 3, e.protobuf())
+		}
+		b = appendBytes(b, 3, bucket)
+	}
+
+	// The zero threshold marks the histogram as native even before the first
+	// observation.
+	b = appendSint(b, 5, nativeSchema)
+	b = appendDouble(b, 6, nativeZeroThreshold)
+	b = appendUint(b, 7, s.zero)
+	b = appendNative(b, 9, 10, s.negative)
+	b = appendNative(b, 12, 13, s.positive)
+	for _, e := range s.exemplars {
+		if "" != e.traceID {
+			b = appendBytes(b, 16, e.protobuf())
+		}
+	}
+	return b
+}
+
+// appendNative appends the native histogram buckets as spans of consecutive
+// bucket indexes and the differences between the counts of each bucket and the
+// previous one.
+func appendNative(b []byte, spanField, deltaField int, buckets map[int]uint64) []byte {
+	indexes := make([]int, 0, len(buckets))
+	for index := range buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for end := 0; end < len(indexes); {
+		start := end
+		for end++; end < len(indexes) && indexes[end] == indexes[end-1]+1; end++ {
+		}
+		// The first span is offset from index 0, the rest from the end of the
+		// previous span.
+		offset := indexes[start]
+		if 0 < start {
+			offset -= indexes[start-1] + 1
+		}
+		span := appendSint(nil, 1, int64(offset))
+		b = appendBytes(b, spanField, appendUint(span, 2, uint64(end-start)))
+	}
+	var previous int64
+	for _, index := range indexes {
+		count := int64(buckets[index])
+		b = appendSint(b, deltaField, count-previous)
+		previous = count
+	}
+	return b
+}
+
+// protobuf returns the exemplar encoded as an Exemplar message.
+func (e exemplar) protobuf() []byte {
+	label := appendString(appendString(nil, 1, "trace_id"), 2, e.traceID)
+	b := appendBytes(nil, 1, label)
+	b = appendDouble(b, 2, e.value)
+	timestamp := appendUint(nil, 1, uint64(e.timestamp.Unix()))
+	timestamp = appendUint(timestamp, 2, uint64(e.timestamp.Nanosecond()))
+	return appendBytes(b, 3, timestamp)
+}
+
+// appendVarint appends the value in base 128, least significant group first.
+func appendVarint(b []byte, value uint64) []byte {
+	for 0x80 <= value {
+		b = append(b, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(b, byte(value))
+}
+
+// appendUint appends an unsigned integer or enum field.
+func appendUint(b []byte, field int, value uint64) []byte {
+	return appendVarint(appendVarint(b, uint64(field)<<3|varintWire), value)
+}
+
+// appendSint appends a zigzag encoded signed integer field.
+func appendSint(b []byte, field int, value int64) []byte {
+	return appendUint(b, field, uint64(value<<1)^uint64(value>>63))
+}
+
+// appendDouble appends a double field.
+func appendDouble(b []byte, field int, value float64) []byte {
+	b = appendVarint(b, uint64(field)<<3|fixed64Wire)
+	var buffer [8]byte
+	binary.LittleEndian.PutUint64(buffer[:], math.Float64bits(value))
+	return append(b, buffer[:]...)
+}
+
+// appendBytes appends a length-delimited field, such as an embedded message.
+func appendBytes(b []byte, field int, value []byte) []byte {
+	b = appendVarint(appendVarint(b, uint64(field)<<3|bytesWire), uint64(len(value)))
+	return append(b, value...)
+}
+
+// appendString appends a string field.
+func appendString(b []byte, field int, value string) []byte {
+	return appendBytes(b, field, []byte(value))
+}